@@ -0,0 +1,97 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary cijitter-monitor is the host-wide Cijitter monitor. It takes over
+// the runsc sandboxes created with --jitter-daemon under the root directory,
+// over their control sockets, and delays each as it was configured. It is
+// meant to run as a service, see cijitter-monitor.service.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/monitor"
+)
+
+var (
+	rootDir         = flag.String("root", "/var/run/runsc", "root directory of the runsc containers to monitor, as given to runsc.")
+	debug           = flag.Bool("debug", false, "enable debug logging.")
+	debugLog        = flag.String("debug-log", "", "file to append the logs to. Defaults to stderr, which systemd sends to the journal.")
+	jitterSampler   = flag.String("jitter-sampler", "auto", "how memory accesses are sampled, as runsc --jitter-sampler. Shared by all the sandboxes.")
+	jitterIOUring   = flag.Bool("jitter-io-uring", false, "read the sample events of --jitter-sampler=daptrace-events with io_uring, as runsc --jitter-io-uring.")
+	jitterWorkDir   = flag.String("jitter-work-dir", "", "directory the samples of the kernel module are kept in. Defaults to 'jitter' in the root directory.")
+	jitterModule    = flag.String("jitter-module", "", "daptrace kernel module to load. Defaults to $"+monitor.DaptraceModuleEnv+", then to the module for the running kernel found in /lib/modules or /monitor/kernel.")
+	jitterModuleSrc = flag.String("jitter-module-src", "", "sources of the daptrace kernel module, with a dkms.conf, to build the module from with DKMS when none is found for the running kernel. Empty disables building.")
+	jitterConfig    = flag.String("jitter-config", "", "file of jitter flags, one name=value per line, that override the parameters of every sandbox and are read again on SIGHUP, as runsc --jitter-config.")
+)
+
+// fatalf logs and prints the error, then exits.
+func fatalf(format string, args ...interface{}) {
+	log.Warningf(format, args...)
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+
+	sampler, err := boot.MakeJitterSampler(*jitterSampler)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if *jitterIOUring && sampler != boot.JitterSamplerDaptraceEvents {
+		fatalf("jitter_io_uring reads netlink sample events, it requires jitter_sampler=daptrace-events, got: %v", sampler)
+	}
+	workDir := *jitterWorkDir
+	if workDir == "" {
+		workDir = filepath.Join(*rootDir, "jitter")
+	}
+
+	// The configuration of the daemon itself: the sampler shared by all the
+	// sandboxes and the file reloaded on SIGHUP. Each sandbox is monitored
+	// with the jitter parameters it was created with.
+	conf := &boot.Config{
+		RootDir:         *rootDir,
+		Debug:           *debug,
+		DebugLog:        *debugLog,
+		JitterSampler:   sampler,
+		JitterIOUring:   *jitterIOUring,
+		JitterWorkDir:   workDir,
+		JitterModule:    *jitterModule,
+		JitterModuleSrc: *jitterModuleSrc,
+		JitterConfig:    *jitterConfig,
+	}
+
+	if *debug {
+		log.SetLevel(log.Debug)
+	}
+	var w io.Writer = os.Stderr
+	if *debugLog != "" {
+		f, err := os.OpenFile(*debugLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			fatalf("error opening debug log file %q: %v", *debugLog, err)
+		}
+		w = f
+	}
+	log.SetTarget(log.GoogleEmitter{&log.Writer{Next: w}})
+
+	log.Infof("[Cijitter] PID: %d, UID: %d, GID: %d", os.Getpid(), os.Getuid(), os.Getgid())
+	monitor.RunDaemon(conf)
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// attack recovers the secret of a victim with a cache side channel, and prints
+// how much of it was recovered:
+//
+//   attack flush-reload|prime-probe [rounds]
+//
+// The victim does one secret dependent table lookup per secret nibble, like a
+// T-table cipher. It runs in the attacker's thread, as a library call would,
+// so that the attacks don't depend on how the sandbox schedules threads.
+// Every table entry is on its own page and L1 set, so that the monitor sees
+// the entries as distinct targets and prime+probe can tell them apart.
+
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/mman.h>
+#include <time.h>
+#include <unistd.h>
+#include <x86intrin.h>
+
+#define PAGE 4096
+#define LINE 64
+#define VALUES 16  // Secret nibbles.
+#define MAX_WAYS 16
+#define SECRET_LEN 32
+
+// FIRST_SET is the L1 set of the first table entry. Sets low in the page are
+// busy with the attacker's own stack and globals.
+#define FIRST_SET 40
+
+static uint8_t *table;
+static uint8_t *evict;
+static int ways;  // L1D associativity.
+static uint8_t secret[SECRET_LEN];
+
+static inline volatile uint8_t *entry(uint8_t *base, int v) {
+  return base + v * PAGE + (FIRST_SET + v) * LINE;
+}
+
+// evict_line returns way w of the eviction set of the L1 set of entry v.
+static inline volatile uint8_t *evict_line(int w, int v) {
+  return evict + w * PAGE + (FIRST_SET + v) * LINE;
+}
+
+static inline uint64_t timed_read(volatile uint8_t *p) {
+  unsigned aux;
+  _mm_mfence();
+  uint64_t start = __rdtscp(&aux);
+  (void)*p;
+  uint64_t end = __rdtscp(&aux);
+  return end - start;
+}
+
+// victim looks up entry secret[i]. It does nothing if i is -1, to measure
+// the noise of the attacks.
+__attribute__((noinline)) static void victim(int i) {
+  if (i >= 0) {
+    (void)*entry(table, secret[i]);
+  }
+}
+
+// flush_reload returns the entry the victim accessed: the only one that is
+// cached again after all were flushed.
+static int flush_reload(int i) {
+  for (int v = 0; v < VALUES; v++) {
+    _mm_clflush((void *)entry(table, v));
+  }
+  _mm_mfence();
+  victim(i);
+
+  int best = 0;
+  uint64_t min = UINT64_MAX;
+  for (int k = 0; k < VALUES; k++) {
+    // Shuffled to defeat the prefetcher.
+    int v = (k * 7 + 3) % VALUES;
+    uint64_t t = timed_read(entry(table, v));
+    if (t < min) {
+      min = t;
+      best = v;
+    }
+  }
+  return best;
+}
+
+// prime_probe returns the entry the victim accessed: the one whose L1 set
+// lost a line of the eviction set.
+static int prime_probe(int i) {
+  // Twice, since one pass doesn't always evict everything with pseudo-LRU.
+  for (int pass = 0; pass < 2; pass++) {
+    for (int v = 0; v < VALUES; v++) {
+      for (int w = 0; w < ways; w++) {
+        (void)*evict_line(w, v);
+      }
+    }
+  }
+  _mm_mfence();
+  victim(i);
+
+  int best = 0;
+  uint64_t max = 0;
+  for (int v = 0; v < VALUES; v++) {
+    unsigned aux;
+    _mm_mfence();
+    uint64_t start = __rdtscp(&aux);
+    for (int w = 0; w < ways; w++) {
+      (void)*evict_line(w, v);
+    }
+    uint64_t t = __rdtscp(&aux) - start;
+    if (t > max) {
+      max = t;
+      best = v;
+    }
+  }
+  return best;
+}
+
+int main(int argc, char **argv) {
+  if (argc < 2) {
+    fprintf(stderr, "usage: %s flush-reload|prime-probe [rounds]\n", argv[0]);
+    return 2;
+  }
+  int (*attack)(int);
+  if (strcmp(argv[1], "flush-reload") == 0) {
+    attack = flush_reload;
+  } else if (strcmp(argv[1], "prime-probe") == 0) {
+    attack = prime_probe;
+  } else {
+    fprintf(stderr, "unknown attack %s\n", argv[1]);
+    return 2;
+  }
+  int rounds = argc > 2 ? atoi(argv[2]) : 1000;
+
+  ways = sysconf(_SC_LEVEL1_DCACHE_ASSOC);
+  if (ways <= 0 || ways > MAX_WAYS) {
+    ways = 8;
+  }
+
+  table = mmap(NULL, VALUES * PAGE, PROT_READ | PROT_WRITE,
+               MAP_PRIVATE | MAP_ANONYMOUS, -1, 0);
+  evict = mmap(NULL, MAX_WAYS * PAGE, PROT_READ | PROT_WRITE,
+               MAP_PRIVATE | MAP_ANONYMOUS, -1, 0);
+  if (table == MAP_FAILED || evict == MAP_FAILED) {
+    perror("mmap");
+    return 1;
+  }
+  memset(table, 1, VALUES * PAGE);
+  memset(evict, 1, MAX_WAYS * PAGE);
+  srand(time(NULL) ^ getpid());
+  for (int i = 0; i < SECRET_LEN; i++) {
+    secret[i] = rand() % VALUES;
+  }
+
+  // Every nibble is the entry that won most rounds, less the rounds it wins
+  // when the victim does nothing: lines the attack itself uses end up in some
+  // of the entries' sets.
+  int correct = 0;
+  for (int i = 0; i < SECRET_LEN; i++) {
+    int votes[VALUES] = {0};
+    for (int r = 0; r < rounds; r++) {
+      votes[attack(i)]++;
+      votes[attack(-1)]--;
+    }
+    int guess = 0;
+    for (int v = 1; v < VALUES; v++) {
+      if (votes[v] > votes[guess]) {
+        guess = v;
+      }
+    }
+    if (guess == secret[i]) {
+      correct++;
+    }
+  }
+  printf("%s accuracy: %.3f (%d/%d)\n", argv[1],
+         (double)correct / SECRET_LEN, correct, SECRET_LEN);
+  return 0;
+}
@@ -121,6 +121,14 @@ func (s *Server) serve() {
 	}
 }
 
+// HandleConn handles the requests on conn, a connected socket whose peer was
+// handed it by a trusted process, in addition to the clients of the bound
+// socket. Unlike them, the peer is not authenticated. HandleConn does not
+// block.
+func (s *Server) HandleConn(conn *unet.Socket) {
+	s.server.StartHandling(conn)
+}
+
 // Register registers a specific control interface with the server.
 func (s *Server) Register(obj interface{}) {
 	s.server.Register(obj)
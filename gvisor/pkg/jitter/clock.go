@@ -0,0 +1,42 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jitter
+
+import "time"
+
+// Clock is the time source of a Monitor.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel receiving the current time once d has
+	// passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// RealClock is the wall clock.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+// Now implements Clock.Now.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// After implements Clock.After.
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jitter
+
+import "gvisor.dev/gvisor/pkg/maid"
+
+// Notifier sends messages to the sentry of the monitored sandbox.
+type Notifier interface {
+	// Send queues m for the sentry. It may drop m, e.g. once the sandbox
+	// is gone.
+	Send(m *maid.Message)
+}
+
+// NotifierFunc is a Notifier sending with a function.
+type NotifierFunc func(m *maid.Message)
+
+// Send implements Notifier.Send.
+func (f NotifierFunc) Send(m *maid.Message) {
+	f(m)
+}
+
+// Delayer slows down the sandbox while the monitor has a delay window open.
+type Delayer interface {
+	// Start opens a delay window on targets, the first of which is the
+	// primary target, with delays scaled by intensity, 0 for the usual
+	// ones, and waited out with wait.
+	Start(targets []maid.Target, intensity float64, wait maid.WaitMode) error
+
+	// Update replaces the targets of the open delay window, whose primary
+	// target is kept.
+	Update(targets []maid.Target) error
+
+	// Stop closes the delay window, if any.
+	Stop() error
+}
+
+// MessageDelayer asks the sentry to delay accesses to the target pages.
+type MessageDelayer struct {
+	Notifier Notifier
+}
+
+// Start implements Delayer.Start.
+func (d *MessageDelayer) Start(targets []maid.Target, intensity float64, wait maid.WaitMode) error {
+	m := maid.NewStartBatchMessage(targets)
+	m.Intensity = intensity
+	m.Wait = wait
+	d.Notifier.Send(m)
+	return nil
+}
+
+// Update implements Delayer.Update. The sentry swaps the new targets in once
+// they are all there, the window keeps delaying the previous ones until then.
+func (d *MessageDelayer) Update(targets []maid.Target) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	for _, m := range maid.NewTargetSetMessages(targets) {
+		d.Notifier.Send(m)
+	}
+	return nil
+}
+
+// Stop implements Delayer.Stop.
+func (d *MessageDelayer) Stop() error {
+	d.Notifier.Send(maid.NewStopMessage())
+	return nil
+}
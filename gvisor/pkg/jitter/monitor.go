@@ -0,0 +1,341 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jitter implements the jitter monitor: it samples the page accesses
+// of a sandbox, decides with a maid.Policy when they look like a hot phase
+// worth hiding, and opens delay windows on the pages sampled hottest.
+//
+// The monitor reaches the sandbox only through the interfaces it is given,
+// so that it can run against simulated address streams.
+package jitter
+
+import (
+	"context"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Sample is a sample of the page accesses of the sandbox.
+type Sample struct {
+	// Addr and Accesses are the primary target and its access count. Addr
+	// is 0 if the address sampled is invalid.
+	Addr     usermem.Addr
+	Accesses int
+
+	// Batch are the targets sampled, the primary target first.
+	Batch []maid.Target
+
+	// HITM is the number of loads sampled on the cache lines of Batch that
+	// hit a line modified by another core, 0 if they aren't sampled.
+	HITM int
+}
+
+// Sampler samples the page accesses of the sandbox.
+type Sampler interface {
+	// Sample returns the next sample, or false if nothing could be
+	// sampled.
+	Sample() (Sample, bool)
+}
+
+// Monitor decides when to delay a sandbox and delays it. Policy, Clock,
+// Sampler, Notifier and Delayer must be set; the other fields are optional.
+type Monitor struct {
+	// Name names the sandbox in logs and audit records.
+	Name string
+
+	// Policy decides which windows are delayed.
+	Policy *maid.Policy
+
+	// Clock paces sampling and delay windows.
+	Clock Clock
+
+	// Sampler samples the sandbox.
+	Sampler Sampler
+
+	// Notifier sends messages to the sentry.
+	Notifier Notifier
+
+	// Delayer delays the sandbox during delay windows.
+	Delayer Delayer
+
+	// SentrySchedules has the sentry run the policy: the monitor then
+	// only hands it the samples. Otherwise, the sentry is kept a copy of
+	// the policy history to save with checkpoints.
+	SentrySchedules bool
+
+	// Calibrator, if set, derives the thresholds of Policy from the first
+	// samples, with Thresholds as a base.
+	Calibrator *maid.Calibrator
+	Thresholds maid.Thresholds
+
+	// Chaos, if set, delays random sampled pages at random times instead
+	// of the windows the policy decides on.
+	Chaos *maid.Chaos
+
+	// Entropy maps the entropy of the sample a window is opened on to the
+	// intensity of its delays.
+	Entropy maid.EntropyMapping
+
+	// Contention opens windows on samples with cross-core contention on
+	// their targets, and delays them harder.
+	Contention maid.Contention
+
+	// Gate returns why the sandbox must not be delayed now, or "" if it
+	// may be.
+	Gate func() string
+
+	// Suspended returns whether the sandbox is suspended, e.g. paused or
+	// being checkpointed. It is neither sampled nor delayed then.
+	Suspended func() bool
+
+	// Refine applies the per-function policies to a batch of targets. It
+	// returns the targets left with their symbols, and whether they must
+	// always be delayed.
+	Refine func(batch []maid.Target) ([]maid.Target, []maid.Symbol, bool)
+
+	// Lighten trims the targets of a window, e.g. while the host is
+	// loaded.
+	Lighten func(targets []maid.Target) []maid.Target
+
+	// Observe is called with every sample the decision stage takes.
+	Observe func(smp Sample)
+
+	// Learn is called with the targets of every window decided on and
+	// their symbols, if known.
+	Learn func(targets []maid.Target, syms []maid.Symbol)
+
+	// Wait is called before a window is opened, and returns false if it
+	// must not be.
+	Wait func() bool
+
+	// Record is called with every decision.
+	Record func(rec maid.TraceRecord)
+
+	// Audit is called with every window once it closed.
+	Audit func(rec maid.AuditRecord)
+}
+
+// record passes rec to m.Record, if set.
+func (m *Monitor) record(rec maid.TraceRecord) {
+	if m.Record != nil {
+		m.Record(rec)
+	}
+}
+
+// lighten passes targets through m.Lighten, if set.
+func (m *Monitor) lighten(targets []maid.Target) []maid.Target {
+	if m.Lighten == nil {
+		return targets
+	}
+	return m.Lighten(targets)
+}
+
+// suspended returns whether the sandbox is suspended, if m.Suspended is set.
+func (m *Monitor) suspended() bool {
+	return m.Suspended != nil && m.Suspended()
+}
+
+// refine passes batch through m.Refine, if set.
+func (m *Monitor) refine(batch []maid.Target) ([]maid.Target, []maid.Symbol, bool) {
+	if m.Refine == nil || len(batch) == 0 {
+		return batch, nil, false
+	}
+	return m.Refine(batch)
+}
+
+// Run samples the sandbox and delays it until ctx is done. It returns once
+// the last delay window closed.
+func (m *Monitor) Run(ctx context.Context) {
+	sampling := newSamplingStage(m)
+	injection := newInjectionStage(m)
+	go sampling.run(ctx)
+	go injection.run(ctx)
+	defer func() {
+		<-sampling.done
+		<-injection.done
+	}()
+
+	// The decision stage. next is when the policy takes its next decision,
+	// samples coming in earlier are dropped. While a window is open, the
+	// samples refresh its targets instead.
+	var (
+		next    time.Time
+		open    bool
+		refresh bool
+	)
+	for {
+		var smp Sample
+		select {
+		case <-ctx.Done():
+			return
+		case <-injection.closed:
+			open = false
+			sampling.setPace(maid.SampleInterval)
+			continue
+		case smp = <-sampling.samples:
+		}
+		if m.Observe != nil {
+			m.Observe(smp)
+		}
+
+		if open {
+			if !refresh {
+				// Chaos windows are on random pages.
+				continue
+			}
+			if batch, _, _ := m.refine(smp.Batch); len(batch) != 0 {
+				targets := m.lighten(m.Policy.Filter(batch))
+				log.Debugf("[Cijitter] refreshing %d targets of %s", len(targets), m.Name)
+				m.record(maid.TraceRecord{Delay: true, Addr: targets[0].Addr, Targets: targets, Reason: "refresh"})
+				injection.update(targets)
+			}
+			continue
+		}
+		if m.Clock.Now().Before(next) {
+			continue
+		}
+		// Unless the decision says otherwise, the next one is taken on
+		// the next sample.
+		next = time.Time{}
+		sampling.setPace(maid.SampleInterval)
+
+		w, idle := m.decide(smp)
+		if w == nil {
+			if idle != 0 {
+				next = m.Clock.Now().Add(idle)
+				sampling.setPace(idle)
+			}
+			continue
+		}
+		// Sampling goes on during the window to keep its targets
+		// current.
+		open, refresh = true, w.reason != "chaos"
+		injection.windows <- *w
+	}
+}
+
+// decide takes a decision on smp. It returns the window to open, if any, or
+// else how long to wait before the next decision, 0 for the next sample.
+func (m *Monitor) decide(smp Sample) (*delayWindow, time.Duration) {
+	addr, accesses, batch := smp.Addr, smp.Accesses, smp.Batch
+	// The entropy is that of the whole sample, before it is refined.
+	intensity := maid.WindowIntensity(m.Entropy, batch)
+	contended := m.Contention.Observed(smp.HITM)
+	if contended {
+		intensity = m.Contention.Boosted(intensity)
+	}
+
+	if !m.SentrySchedules {
+		// Keep the sandbox's copy of the history current in case it
+		// is checkpointed.
+		m.Notifier.Send(maid.NewHistoryMessage(m.Policy.State()))
+	}
+
+	if m.Calibrator != nil && m.Calibrator.Add(accesses) {
+		t := m.Calibrator.Thresholds(m.Thresholds)
+		log.Infof("[Cijitter] calibrated thresholds of %q: min %d, spike %d accesses", m.Name, t.Min, t.Spike)
+		m.Policy.SetThresholds(t)
+		m.Calibrator = nil
+	}
+
+	if m.Gate != nil {
+		if reason := m.Gate(); reason != "" {
+			m.record(maid.TraceRecord{Reason: reason})
+			return nil, 0
+		}
+	}
+
+	if m.SentrySchedules {
+		// The sentry runs the policy, just hand it what was sampled.
+		if batch = m.lighten(batch); len(batch) != 0 {
+			m.Notifier.Send(maid.NewSamplesMessage(batch))
+		}
+		return nil, 0
+	}
+
+	// Per-function policies need the symbols of the batch before
+	// deciding.
+	var syms []maid.Symbol
+	always := false
+	if len(batch) != 0 {
+		primary := batch[0].Addr
+		batch, syms, always = m.refine(batch)
+		if len(batch) == 0 {
+			m.record(maid.TraceRecord{Reason: "never"})
+			return nil, 0
+		}
+		if batch[0].Addr != primary {
+			// The hottest page is never delayed, the next one is
+			// the primary target.
+			addr, accesses = batch[0].Addr, batch[0].Accesses
+		}
+	}
+
+	delay, idle := m.Policy.Decide(accesses)
+	reason := "hot"
+	if !delay && always {
+		delay, reason = true, "always"
+	}
+	if !delay && contended {
+		delay, reason = true, "contention"
+	}
+	chaos := false
+	if m.Chaos != nil {
+		// As many windows, on random pages at random times.
+		m.Chaos.Observe(batch)
+		if delay {
+			m.Chaos.Owe(len(m.Policy.Filter(batch)))
+		}
+		targets := m.Chaos.Next()
+		delay, reason, chaos = targets != nil, "chaos", true
+		if delay {
+			addr, batch, syms = targets[0].Addr, targets, nil
+		}
+	}
+	if !delay {
+		m.record(maid.TraceRecord{Reason: "strip"})
+		return nil, idle
+	}
+
+	if addr == 0 {
+		log.Debugf("[Cijitter] invalid target address")
+		m.record(maid.TraceRecord{Reason: "invalid"})
+		m.Policy.Skip()
+		return nil, 0
+	}
+	if !chaos && m.Policy.Dropped(addr) {
+		log.Debugf("[Cijitter] addr %x was never touched in past windows, pass...", addr)
+		m.record(maid.TraceRecord{Addr: addr, Reason: "dropped"})
+		m.Policy.Skip()
+		return nil, idle
+	}
+	targets := batch
+	if !chaos {
+		targets = m.Policy.Filter(batch)
+	}
+	targets = m.lighten(targets)
+	if m.Learn != nil {
+		m.Learn(targets, syms)
+	}
+	names := maid.SymbolNames(targets, syms)
+	m.record(maid.TraceRecord{Delay: true, Addr: addr, Targets: targets, Reason: reason, Symbols: names, Intensity: intensity, HITM: smp.HITM})
+	log.Debugf("[Cijitter] start to send addr %s with %d targets", m.Name, len(targets))
+	if names != nil {
+		log.Infof("[Cijitter] delaying %q on %v", m.Name, names)
+	}
+	return &delayWindow{targets: targets, reason: reason, intensity: intensity, wait: m.Policy.WaitMode()}, 0
+}
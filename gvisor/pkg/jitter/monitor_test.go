@@ -0,0 +1,426 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jitter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// fakeClock is a Clock whose time only moves when advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// Now implements Clock.Now.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After implements Clock.After.
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), c: ch})
+	return ch
+}
+
+// advance moves the clock d forward, firing the waiters due.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiters
+}
+
+// streamSampler replays a simulated address stream: a function of the
+// sample index.
+type streamSampler struct {
+	mu     sync.Mutex
+	n      int
+	stream func(i int) []maid.Target
+}
+
+// Sample implements Sampler.Sample.
+func (s *streamSampler) Sample() (Sample, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := s.stream(s.n)
+	s.n++
+	if len(batch) == 0 {
+		return Sample{}, false
+	}
+	return Sample{Addr: batch[0].Addr, Accesses: batch[0].Accesses, Batch: batch}, true
+}
+
+// samples returns the number of samples taken so far.
+func (s *streamSampler) samples() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.n
+}
+
+// steady returns a stream sampling accesses on the pages at addrs, the first
+// the hottest.
+func steady(accesses int, addrs ...usermem.Addr) func(int) []maid.Target {
+	return func(int) []maid.Target {
+		batch := make([]maid.Target, 0, len(addrs))
+		for i, addr := range addrs {
+			batch = append(batch, maid.Target{Addr: addr, Accesses: accesses - i})
+		}
+		return batch
+	}
+}
+
+// recorder is a Notifier keeping the messages sent.
+type recorder struct {
+	mu   sync.Mutex
+	msgs []*maid.Message
+}
+
+// Send implements Notifier.Send.
+func (r *recorder) Send(m *maid.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, m)
+}
+
+// count returns the number of messages of type t sent so far.
+func (r *recorder) count(t maid.MessageType) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, m := range r.msgs {
+		if m.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+// first returns the position of the first message of type t sent, or -1.
+func (r *recorder) first(t maid.MessageType) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, m := range r.msgs {
+		if m.Type == t {
+			return i
+		}
+	}
+	return -1
+}
+
+// last returns the last message of type t sent, or nil.
+func (r *recorder) last(t maid.MessageType) *maid.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.msgs) - 1; i >= 0; i-- {
+		if r.msgs[i].Type == t {
+			return r.msgs[i]
+		}
+	}
+	return nil
+}
+
+// newTestMonitor returns a monitor of a fresh policy sampling stream.
+func newTestMonitor(stream func(int) []maid.Target) (*Monitor, *fakeClock, *streamSampler, *recorder) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	smp := &streamSampler{stream: stream}
+	r := &recorder{}
+	m := &Monitor{
+		Name:     "test",
+		Policy:   maid.NewPolicy(),
+		Clock:    clock,
+		Sampler:  smp,
+		Notifier: r,
+		Delayer:  &MessageDelayer{Notifier: r},
+	}
+	return m, clock, smp, r
+}
+
+// simulate runs m, advancing clock by step until done returns true or steps
+// ran out, and returns whether done returned true.
+func simulate(t *testing.T, m *Monitor, clock *fakeClock, step time.Duration, steps int, done func() bool) bool {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	for i := 0; i < steps; i++ {
+		if done() {
+			return true
+		}
+		// Let the stages take the last step before the next one.
+		time.Sleep(time.Millisecond)
+		clock.advance(step)
+	}
+	return done()
+}
+
+func TestMonitorDelaysHotPhase(t *testing.T) {
+	m, clock, _, r := newTestMonitor(steady(500, 0x1000, 0x2000))
+	var audits []maid.AuditRecord
+	var mu sync.Mutex
+	m.Audit = func(rec maid.AuditRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		audits = append(audits, rec)
+	}
+	if !simulate(t, m, clock, maid.SampleInterval, 200, func() bool { return r.count(maid.MessageStop) >= 2 }) {
+		t.Fatalf("hot phase delayed %d times, want 2", r.count(maid.MessageStop))
+	}
+	start := r.last(maid.MessageStart)
+	if start == nil || len(start.Targets) != 2 || start.Targets[0].Addr != 0x1000 {
+		t.Errorf("window opened with %+v, want the pages sampled, hottest first", start)
+	}
+	if r.count(maid.MessageHistory) == 0 {
+		t.Errorf("no history sent to the sentry")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(audits) < 2 || audits[0].Duration < maid.DelayWindow {
+		t.Errorf("windows audited as %+v, want 2 of at least %v", audits, maid.DelayWindow)
+	}
+}
+
+// uncompensated returns a monitor of stream whose policy takes samples as
+// they are. New policies compensate their first sample, as if the window
+// before was delayed.
+func uncompensated(stream func(int) []maid.Target) (*Monitor, *fakeClock, *streamSampler, *recorder) {
+	m, clock, smp, r := newTestMonitor(stream)
+	m.Policy.SetCompensation(maid.Compensation{Kind: maid.CompensateNone})
+	return m, clock, smp, r
+}
+
+func TestMonitorSkipsStrips(t *testing.T) {
+	m, clock, smp, r := uncompensated(steady(10, 0x1000))
+	var mu sync.Mutex
+	strips := 0
+	m.Record = func(rec maid.TraceRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		if rec.Reason == "strip" {
+			strips++
+		}
+	}
+	simulate(t, m, clock, maid.SampleInterval, 200, func() bool { return smp.samples() >= 20 })
+	if n := r.count(maid.MessageStart); n != 0 {
+		t.Errorf("cold stream delayed %d times, want 0", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strips == 0 {
+		t.Errorf("no strip recorded")
+	}
+}
+
+func TestMonitorCompensatedDecay(t *testing.T) {
+	// A compensated hot phase that ends is delayed a few more times, then
+	// no more.
+	m, clock, smp, r := newTestMonitor(steady(10, 0x1000))
+	simulate(t, m, clock, maid.SampleInterval, 1000, func() bool { return smp.samples() >= 100 })
+	if n := r.count(maid.MessageStart); n == 0 || n > 2*maid.DefaultHistoryWindow {
+		t.Errorf("ended hot phase delayed %d times, want a few", n)
+	}
+}
+
+func TestMonitorBacksOff(t *testing.T) {
+	// Strips back off sampling: far fewer samples are taken over a minute
+	// than at maid.SampleInterval.
+	m, clock, smp, _ := uncompensated(steady(10, 0x1000))
+	steps := int(time.Minute / maid.SampleInterval)
+	simulate(t, m, clock, maid.SampleInterval, steps, func() bool { return false })
+	if n := smp.samples(); n >= steps/2 {
+		t.Errorf("%d samples over a minute, want sampling to back off", n)
+	}
+}
+
+func TestMonitorRefreshesTargets(t *testing.T) {
+	// The workload moves to other pages once the window is open.
+	var mu sync.Mutex
+	moved := false
+	m, clock, _, r := newTestMonitor(func(i int) []maid.Target {
+		mu.Lock()
+		defer mu.Unlock()
+		if moved {
+			return steady(500, 0x5000, 0x6000)(i)
+		}
+		return steady(500, 0x1000, 0x2000)(i)
+	})
+	refreshed := simulate(t, m, clock, maid.SampleInterval, 200, func() bool {
+		if r.count(maid.MessageStart) == 0 {
+			return false
+		}
+		mu.Lock()
+		moved = true
+		mu.Unlock()
+		return r.count(maid.MessageUpdateTargets) != 0
+	})
+	if !refreshed {
+		t.Fatalf("targets of the open window not refreshed")
+	}
+	if u := r.last(maid.MessageUpdateTargets); u.Targets[0].Addr != 0x5000 {
+		t.Errorf("window refreshed to %+v, want the pages sampled last", u.Targets)
+	}
+	if stop := r.first(maid.MessageStop); stop >= 0 && stop < r.first(maid.MessageUpdateTargets) {
+		t.Errorf("window closed before its refresh")
+	}
+}
+
+func TestMonitorSentrySchedules(t *testing.T) {
+	m, clock, _, r := newTestMonitor(steady(500, 0x1000))
+	m.SentrySchedules = true
+	if !simulate(t, m, clock, maid.SampleInterval, 200, func() bool { return r.count(maid.MessageSamples) >= 3 }) {
+		t.Fatalf("samples not handed to the sentry")
+	}
+	if n := r.count(maid.MessageStart) + r.count(maid.MessageHistory); n != 0 {
+		t.Errorf("monitor ran the policy: %d windows and histories sent", n)
+	}
+}
+
+func TestMonitorGate(t *testing.T) {
+	m, clock, smp, r := newTestMonitor(steady(500, 0x1000))
+	m.Gate = func() string { return "unsuspected" }
+	simulate(t, m, clock, maid.SampleInterval, 200, func() bool { return smp.samples() >= 20 })
+	if n := r.count(maid.MessageStart); n != 0 {
+		t.Errorf("gated monitor delayed %d times, want 0", n)
+	}
+}
+
+func TestMonitorRefine(t *testing.T) {
+	// The hottest page is never delayed, the next one becomes the
+	// primary target.
+	m, clock, _, r := newTestMonitor(steady(500, 0x1000, 0x2000))
+	m.Refine = func(batch []maid.Target) ([]maid.Target, []maid.Symbol, bool) {
+		return batch[1:], nil, false
+	}
+	if !simulate(t, m, clock, maid.SampleInterval, 200, func() bool { return r.count(maid.MessageStart) != 0 }) {
+		t.Fatalf("hot phase not delayed")
+	}
+	if start := r.last(maid.MessageStart); len(start.Targets) != 1 || start.Targets[0].Addr != 0x2000 {
+		t.Errorf("window opened with %+v, want the second page alone", start.Targets)
+	}
+}
+
+func TestMonitorSuspended(t *testing.T) {
+	m, clock, smp, r := newTestMonitor(steady(500, 0x1000))
+	var mu sync.Mutex
+	suspended := true
+	m.Suspended = func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return suspended
+	}
+	simulate(t, m, clock, maid.SampleInterval, 50, func() bool { return false })
+	if n := smp.samples(); n != 0 {
+		t.Errorf("suspended sandbox sampled %d times, want 0", n)
+	}
+	if n := r.count(maid.MessageStart); n != 0 {
+		t.Errorf("suspended sandbox delayed %d times, want 0", n)
+	}
+
+	mu.Lock()
+	suspended = false
+	mu.Unlock()
+	if !simulate(t, m, clock, maid.SampleInterval, 200, func() bool { return r.count(maid.MessageStart) != 0 }) {
+		t.Errorf("hot phase not delayed once resumed")
+	}
+}
+
+func TestMonitorEntropyIntensity(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stream func(int) []maid.Target
+		want   float64
+	}{
+		{name: "concentrated", stream: steady(500, 0x1000), want: 2},
+		{name: "off", stream: steady(500, 0x1000), want: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, clock, _, r := newTestMonitor(tc.stream)
+			if tc.want != 0 {
+				m.Entropy = maid.EntropyMapping{Kind: maid.EntropyLinear, Min: 0.5, Max: tc.want}
+			}
+			if !simulate(t, m, clock, maid.SampleInterval, 200, func() bool { return r.count(maid.MessageStart) >= 1 }) {
+				t.Fatalf("hot phase never delayed")
+			}
+			if got := r.last(maid.MessageStart).Intensity; got != tc.want {
+				t.Errorf("window opened with intensity %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMonitorContention(t *testing.T) {
+	m, _, _, _ := newTestMonitor(nil)
+	m.Contention = maid.Contention{MinHITM: 4, Boost: 3}
+	smp := Sample{Addr: 0x1000, Accesses: 1, Batch: []maid.Target{{Addr: 0x1000, Accesses: 1}}}
+
+	// The first decisions are biased by the delays of the window the
+	// policy assumes came before.
+	for i := 0; ; i++ {
+		if w, _ := m.decide(smp); w == nil {
+			break
+		}
+		if i == 10 {
+			t.Fatalf("cold sample still delayed after %d decisions", i)
+		}
+	}
+
+	// A cold sample is only delayed under contention.
+	for _, hitm := range []int{0, 3} {
+		smp.HITM = hitm
+		if w, _ := m.decide(smp); w != nil {
+			t.Errorf("cold sample with %d HITM loads delayed (%s)", hitm, w.reason)
+		}
+	}
+	smp.HITM = 4
+	w, _ := m.decide(smp)
+	if w == nil {
+		t.Fatalf("cold sample under contention not delayed")
+	}
+	if w.reason != "contention" || w.intensity != 3 {
+		t.Errorf("window opened for %q with intensity %v, want contention with 3", w.reason, w.intensity)
+	}
+}
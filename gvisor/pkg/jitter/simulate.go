@@ -0,0 +1,181 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jitter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// simBatchSize is the number of pages of a recorded sample kept as its batch,
+// as the monitor does.
+const simBatchSize = 8
+
+// PolicySetup configures the decisions of a Monitor. seed seeds the policies
+// that decide at random.
+type PolicySetup func(m *Monitor, seed int64)
+
+var (
+	policiesMu sync.Mutex
+
+	// policies are the registered policies, by name.
+	policies = map[string]PolicySetup{
+		// adaptive is the default: Policy alone decides.
+		"adaptive": func(*Monitor, int64) {},
+
+		// chaos delays as many windows as adaptive, on random sampled
+		// pages at random times.
+		"chaos": func(m *Monitor, seed int64) { m.Chaos = maid.NewChaos(seed) },
+	}
+)
+
+// RegisterPolicy registers setup as the policy name, replacing any policy of
+// that name.
+func RegisterPolicy(name string, setup PolicySetup) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	policies[name] = setup
+}
+
+// Policies returns the names of the registered policies, sorted.
+func Policies() []string {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetPolicy configures m with the registered policy name.
+func SetPolicy(m *Monitor, name string, seed int64) error {
+	policiesMu.Lock()
+	setup, ok := policies[name]
+	policiesMu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown policy %q, registered: %v", name, Policies())
+	}
+	setup(m, seed)
+	return nil
+}
+
+// SimulationResult sums up a simulation.
+type SimulationResult struct {
+	// Samples is the number of samples simulated, and Windows the number
+	// of delay windows decided on.
+	Samples int
+	Windows int
+}
+
+// Simulate takes the decisions of m on the samples of the trace read from r,
+// in the time of the trace, as Run would have on a sandbox sampled like that.
+// Nothing is delayed: windows are assumed to last maid.DelayWindow, during
+// which samples are skipped. Decisions are passed to m.Record, stamped with
+// the time of their sample, after the sample itself, so that the records make
+// a trace of the simulation. Only m.Policy must be set.
+func (m *Monitor) Simulate(r *maid.TraceReader) (SimulationResult, error) {
+	var (
+		res    SimulationResult
+		now    time.Time
+		next   time.Time
+		closes time.Time
+		open   bool
+	)
+	if m.Notifier == nil {
+		m.Notifier = NotifierFunc(func(*maid.Message) {})
+	}
+	m.SentrySchedules = false
+	record := m.Record
+	if record == nil {
+		record = func(maid.TraceRecord) {}
+	}
+	m.Record = func(rec maid.TraceRecord) {
+		rec.Time, rec.Event = now, maid.TraceDecision
+		record(rec)
+	}
+
+	for n := 1; ; n++ {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("reading record %d: %v", n, err)
+		}
+		if rec.Event != maid.TraceSample {
+			continue
+		}
+		now = rec.Time
+		record(rec)
+		if len(rec.Targets) == 0 {
+			// Run never sees samples of nothing.
+			continue
+		}
+		if open {
+			if now.Before(closes) {
+				continue
+			}
+			open = false
+			m.Policy.Delayed()
+		}
+		if now.Before(next) {
+			continue
+		}
+		next = time.Time{}
+
+		res.Samples++
+		w, idle := m.decide(simSample(rec.Targets))
+		if w == nil {
+			if idle != 0 {
+				next = now.Add(idle)
+			}
+			continue
+		}
+		res.Windows++
+		open, closes = true, now.Add(maid.DelayWindow)
+	}
+	if open {
+		m.Policy.Delayed()
+	}
+	return res, nil
+}
+
+// simSample returns the sample of the recorded targets, hottest first, as
+// the monitor would have sampled them. targets must not be empty.
+func simSample(targets []maid.Target) Sample {
+	var smp Sample
+	smp.Addr, smp.Accesses = targets[0].Addr.RoundDown(), targets[0].Accesses
+	seen := make(map[usermem.Addr]bool)
+	for _, t := range targets {
+		if len(smp.Batch) == simBatchSize {
+			break
+		}
+		page := t.Addr.RoundDown()
+		if page == 0 || t.Accesses <= 0 || seen[page] {
+			continue
+		}
+		seen[page] = true
+		smp.Batch = append(smp.Batch, maid.Target{Addr: page, Accesses: t.Accesses})
+	}
+	return smp
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jitter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/maid"
+)
+
+// recordedTrace returns a trace of n samples of stream, one every
+// maid.SampleInterval.
+func recordedTrace(t *testing.T, stream func(int) []maid.Target, n int) *maid.TraceReader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := maid.NewTraceWriter(&buf)
+	start := time.Unix(100, 0)
+	for i := 0; i < n; i++ {
+		rec := maid.TraceRecord{
+			Time:    start.Add(time.Duration(i) * maid.SampleInterval),
+			Event:   maid.TraceSample,
+			Targets: stream(i),
+		}
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("Write(%+v) failed: %v", rec, err)
+		}
+	}
+	return maid.NewTraceReader(&buf)
+}
+
+func TestSimulateDelaysHotPhase(t *testing.T) {
+	m := &Monitor{Policy: maid.NewPolicy()}
+	var windows []maid.TraceRecord
+	samples := 0
+	m.Record = func(rec maid.TraceRecord) {
+		switch {
+		case rec.Event == maid.TraceSample:
+			samples++
+		case rec.Delay:
+			windows = append(windows, rec)
+		}
+	}
+	res, err := m.Simulate(recordedTrace(t, steady(500, 0x1000, 0x2000), 200))
+	if err != nil {
+		t.Fatalf("Simulate() failed: %v", err)
+	}
+	if res.Windows < 2 || res.Windows != len(windows) {
+		t.Fatalf("Simulate() = %+v with %d windows recorded, want at least 2", res, len(windows))
+	}
+	if samples != 200 {
+		t.Errorf("%d samples recorded, want all 200", samples)
+	}
+	if res.Samples >= 200 {
+		t.Errorf("Simulate() decided on all %d samples, want those during windows skipped", res.Samples)
+	}
+	for i, w := range windows {
+		if w.Time.IsZero() || w.Event != maid.TraceDecision || len(w.Targets) != 2 || w.Targets[0].Addr != 0x1000 {
+			t.Errorf("window %d recorded as %+v, want a decision at the sample time on its pages, hottest first", i, w)
+		}
+		if i > 0 && w.Time.Sub(windows[i-1].Time) < maid.DelayWindow {
+			t.Errorf("window %d opened %v after the previous one, want at least %v", i, w.Time.Sub(windows[i-1].Time), maid.DelayWindow)
+		}
+	}
+}
+
+func TestSimulateColdStream(t *testing.T) {
+	m := &Monitor{Policy: maid.NewPolicy()}
+	m.Policy.SetCompensation(maid.Compensation{Kind: maid.CompensateNone})
+	res, err := m.Simulate(recordedTrace(t, steady(10, 0x1000), 50))
+	if err != nil {
+		t.Fatalf("Simulate() failed: %v", err)
+	}
+	if res.Windows != 0 {
+		t.Errorf("cold stream delayed %d times, want 0", res.Windows)
+	}
+}
+
+func TestSetPolicy(t *testing.T) {
+	m := &Monitor{Policy: maid.NewPolicy()}
+	if err := SetPolicy(m, "chaos", 1); err != nil || m.Chaos == nil {
+		t.Errorf("SetPolicy(chaos) = %v with chaos %v, want chaos set", err, m.Chaos)
+	}
+	if err := SetPolicy(m, "nonexistent", 1); err == nil {
+		t.Errorf("SetPolicy(nonexistent) succeeded")
+	}
+	RegisterPolicy("test", func(m *Monitor, _ int64) { m.Name = "test" })
+	if err := SetPolicy(m, "test", 1); err != nil || m.Name != "test" {
+		t.Errorf("SetPolicy(test) = %v, want the registered setup applied", err)
+	}
+}
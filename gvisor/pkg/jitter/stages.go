@@ -0,0 +1,234 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jitter
+
+import (
+	"context"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+)
+
+// The monitor runs as three concurrent stages: sampling goes on all the
+// time, decisions are taken on its samples at the pace of the policy, and
+// delay windows are injected while both keep going, so that the targets of a
+// window follow the workload rather than the sample it was opened on.
+
+// samplingStage samples the sandbox continuously and hands the last sample
+// to the decision stage.
+type samplingStage struct {
+	m *Monitor
+
+	// samples holds the last sample the decision stage hasn't taken yet.
+	samples chan Sample
+
+	// pace receives the time to wait between two samples.
+	pace chan time.Duration
+
+	// done is closed once the stage stopped.
+	done chan struct{}
+}
+
+// newSamplingStage returns a sampling stage of m sampling every
+// maid.SampleInterval until told otherwise.
+func newSamplingStage(m *Monitor) *samplingStage {
+	return &samplingStage{
+		m:       m,
+		samples: make(chan Sample, 1),
+		pace:    make(chan time.Duration, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// setPace has the stage wait d before its next sample, replacing the pace
+// it hasn't taken yet.
+func (st *samplingStage) setPace(d time.Duration) {
+	for {
+		select {
+		case st.pace <- d:
+			return
+		default:
+		}
+		select {
+		case <-st.pace:
+		default:
+		}
+	}
+}
+
+// offer hands smp to the decision stage, replacing the sample it hasn't
+// taken yet.
+func (st *samplingStage) offer(smp Sample) {
+	for {
+		select {
+		case st.samples <- smp:
+			return
+		default:
+		}
+		select {
+		case <-st.samples:
+		default:
+		}
+	}
+}
+
+// run samples until ctx is done.
+func (st *samplingStage) run(ctx context.Context) {
+	defer close(st.done)
+	interval := maid.SampleInterval
+	for ctx.Err() == nil {
+		if st.m.suspended() {
+			// A frozen or disappearing sandbox has nothing to sample.
+		} else if smp, ok := st.m.Sampler.Sample(); ok {
+			log.Debugf("[Cijitter] addr: %#x, access: %d", smp.Addr, smp.Accesses)
+			st.offer(smp)
+		} else {
+			log.Debugf("[Cijitter] failed to get target address...")
+		}
+
+		select {
+		case <-st.m.Clock.After(interval):
+		case interval = <-st.pace:
+			// Wait the new pace from now on.
+			select {
+			case <-st.m.Clock.After(interval):
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+	}
+}
+
+// delayWindow is a delay window the decision stage asks the injection stage
+// to open.
+type delayWindow struct {
+	targets   []maid.Target
+	reason    string
+	intensity float64
+	wait      maid.WaitMode
+}
+
+// injectionStage opens the delay windows decided on, one at a time, and
+// keeps their targets current until they close.
+type injectionStage struct {
+	m *Monitor
+
+	// windows receives the windows to open.
+	windows chan delayWindow
+
+	// updates holds the last targets of the open window the stage hasn't
+	// applied yet.
+	updates chan []maid.Target
+
+	// closed receives a value when a window handed over in windows is
+	// done, whether it was opened or not.
+	closed chan struct{}
+
+	// done is closed once the stage stopped, with its last window closed.
+	done chan struct{}
+}
+
+// newInjectionStage returns an injection stage of m.
+func newInjectionStage(m *Monitor) *injectionStage {
+	return &injectionStage{
+		m:       m,
+		windows: make(chan delayWindow, 1),
+		updates: make(chan []maid.Target, 1),
+		closed:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// update replaces the targets of the open window, or of the window about to
+// open.
+func (in *injectionStage) update(targets []maid.Target) {
+	for {
+		select {
+		case in.updates <- targets:
+			return
+		default:
+		}
+		select {
+		case <-in.updates:
+		default:
+		}
+	}
+}
+
+// run opens the windows handed over until ctx is done.
+func (in *injectionStage) run(ctx context.Context) {
+	defer close(in.done)
+	for {
+		select {
+		case w := <-in.windows:
+			in.inject(ctx, w)
+			in.closed <- struct{}{}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// inject opens w for maid.DelayWindow, applying the updates of its targets
+// as they come.
+func (in *injectionStage) inject(ctx context.Context, w delayWindow) {
+	m := in.m
+	// Updates meant for the previous window are stale.
+	select {
+	case <-in.updates:
+	default:
+	}
+	if m.suspended() {
+		log.Debugf("[Cijitter] %s suspended, dropping delay window", m.Name)
+		return
+	}
+	if m.Wait != nil && !m.Wait() {
+		return
+	}
+	if err := m.Delayer.Start(w.targets, w.intensity, w.wait); err != nil {
+		log.Warningf("[Cijitter] starting delay window failed: %v", err)
+		m.Policy.Skip()
+		return
+	}
+
+	start := m.Clock.Now()
+	targets := w.targets
+	timer := m.Clock.After(maid.DelayWindow)
+loop:
+	for {
+		select {
+		case t := <-in.updates:
+			if err := m.Delayer.Update(t); err != nil {
+				log.Warningf("[Cijitter] updating delay window targets failed: %v", err)
+				continue
+			}
+			targets = t
+		case <-timer:
+			break loop
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	log.Debugf("[Cijitter] stop delay and start to profiling %s", m.Name)
+	if err := m.Delayer.Stop(); err != nil {
+		log.Warningf("[Cijitter] stopping delay window failed: %v", err)
+	}
+	if m.Audit != nil {
+		m.Audit(maid.AuditRecord{Time: start, Container: m.Name, Targets: targets, Duration: m.Clock.Now().Sub(start), Reason: w.reason})
+	}
+	m.Policy.Delayed()
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SyslogSocket is where the syslog daemon receives messages.
+	SyslogSocket = "/dev/log"
+
+	// JournaldSocket is where journald receives messages in its native
+	// protocol.
+	JournaldSocket = "/run/systemd/journal/socket"
+)
+
+// syslogFacility is the facility messages are logged with, LOG_DAEMON.
+const syslogFacility = 3
+
+// syslogSeverity returns the syslog severity of level.
+func syslogSeverity(level Level) int {
+	switch level {
+	case Warning:
+		return 4 // LOG_WARNING.
+	case Info:
+		return 6 // LOG_INFO.
+	default:
+		return 7 // LOG_DEBUG.
+	}
+}
+
+// SyslogEmitter emits messages to a syslog daemon, in the format of RFC 3164
+// read from /dev/log.
+type SyslogEmitter struct {
+	// Next is the connection to the daemon. Each write is a message, it
+	// must be a datagram socket.
+	Next io.Writer
+
+	// Tag identifies the program in messages.
+	Tag string
+}
+
+// Emit implements Emitter.Emit.
+func (e SyslogEmitter) Emit(_ int, level Level, timestamp time.Time, format string, v ...interface{}) {
+	msg := fmt.Sprintf("<%d>%s %s[%d]: %s", syslogFacility<<3|syslogSeverity(level), timestamp.Format(time.Stamp), e.Tag, pid, fmt.Sprintf(format, v...))
+	// There is no one to report errors to, the message is dropped.
+	e.Next.Write([]byte(msg))
+}
+
+// JournaldEmitter emits messages to journald in its native protocol, keeping
+// multi-line messages, e.g. stack dumps, as a single entry. Journald
+// timestamps messages on receipt.
+type JournaldEmitter struct {
+	// Next is the connection to journald. Each write is a message, it must
+	// be a datagram socket.
+	Next io.Writer
+
+	// Tag identifies the program in messages.
+	Tag string
+}
+
+// Emit implements Emitter.Emit.
+func (e JournaldEmitter) Emit(_ int, level Level, _ time.Time, format string, v ...interface{}) {
+	var b bytes.Buffer
+	journaldField(&b, "PRIORITY", strconv.Itoa(syslogSeverity(level)))
+	journaldField(&b, "SYSLOG_IDENTIFIER", e.Tag)
+	journaldField(&b, "SYSLOG_PID", strconv.Itoa(pid))
+	journaldField(&b, "MESSAGE", fmt.Sprintf(format, v...))
+	// There is no one to report errors to, the message is dropped.
+	e.Next.Write(b.Bytes())
+}
+
+// journaldField appends the field name=value to b. Values with newlines are
+// length-prefixed instead.
+func journaldField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b.Write(size[:])
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
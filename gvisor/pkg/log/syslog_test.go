@@ -0,0 +1,63 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// datagrams records every write as a message.
+type datagrams struct {
+	msgs []string
+}
+
+// Write implements io.Writer.Write.
+func (d *datagrams) Write(b []byte) (int, error) {
+	d.msgs = append(d.msgs, string(b))
+	return len(b), nil
+}
+
+func TestSyslogEmitter(t *testing.T) {
+	var d datagrams
+	e := SyslogEmitter{Next: &d, Tag: "runsc"}
+	ts := time.Date(2021, time.May, 4, 10, 0, 0, 0, time.UTC)
+	e.Emit(0, Warning, ts, "hello %d", 1)
+	e.Emit(0, Debug, ts, "multi\nline")
+	want := []string{
+		fmt.Sprintf("<28>May  4 10:00:00 runsc[%d]: hello 1", pid),
+		fmt.Sprintf("<31>May  4 10:00:00 runsc[%d]: multi\nline", pid),
+	}
+	if len(d.msgs) != len(want) {
+		t.Fatalf("got %d messages, want %d: %q", len(d.msgs), len(want), d.msgs)
+	}
+	for i := range want {
+		if d.msgs[i] != want[i] {
+			t.Errorf("message %d = %q, want %q", i, d.msgs[i], want[i])
+		}
+	}
+}
+
+func TestJournaldEmitter(t *testing.T) {
+	var d datagrams
+	e := JournaldEmitter{Next: &d, Tag: "runsc"}
+	ts := time.Unix(1, 0)
+	e.Emit(0, Info, ts, "a\nb")
+	want := fmt.Sprintf("PRIORITY=6\nSYSLOG_IDENTIFIER=runsc\nSYSLOG_PID=%d\nMESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n", pid)
+	if len(d.msgs) != 1 || d.msgs[0] != want {
+		t.Errorf("messages = %q, want [%q]", d.msgs, want)
+	}
+}
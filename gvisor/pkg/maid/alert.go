@@ -0,0 +1,82 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// AlertAttackSuspected is raised when the detector starts suspecting
+	// a cache attack.
+	AlertAttackSuspected = "attack-suspected"
+
+	// AlertAccessSpike is raised when a sample counts more accesses on the
+	// hottest page than the spike threshold.
+	AlertAccessSpike = "access-spike"
+)
+
+// Alert reports suspected attack activity against a sandbox, for security
+// tooling to act on. It is sent as JSON.
+type Alert struct {
+	// Time is when the activity was observed.
+	Time time.Time `json:"time"`
+
+	// Container is the ID of the container observed.
+	Container string `json:"container"`
+
+	// Kind is AlertAttackSuspected or AlertAccessSpike.
+	Kind string `json:"kind"`
+
+	// References and Misses are the last level cache references and misses
+	// of the observation that raised an AlertAttackSuspected.
+	References uint64 `json:"references,omitempty"`
+	Misses     uint64 `json:"misses,omitempty"`
+
+	// Addr and Accesses are the hottest page and its access count of the
+	// sample that raised an AlertAccessSpike.
+	Addr     string `json:"addr,omitempty"`
+	Accesses int    `json:"accesses,omitempty"`
+}
+
+// AlertLimiter keeps a sustained attack from flooding alert receivers: an
+// alert of a kind is dropped if the last one of the kind is more recent than
+// the interval.
+type AlertLimiter struct {
+	interval time.Duration
+
+	mu sync.Mutex
+
+	// last is when each kind of alert was last allowed.
+	last map[string]time.Time
+}
+
+// NewAlertLimiter returns a limiter allowing an alert per kind per interval.
+func NewAlertLimiter(interval time.Duration) *AlertLimiter {
+	return &AlertLimiter{interval: interval, last: make(map[string]time.Time)}
+}
+
+// Allow returns whether an alert of kind raised at now may be sent, and
+// records it if so.
+func (l *AlertLimiter) Allow(kind string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last, ok := l.last[kind]; ok && now.Sub(last) < l.interval {
+		return false
+	}
+	l.last[kind] = now
+	return true
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAlertLimiter(t *testing.T) {
+	l := NewAlertLimiter(time.Minute)
+	now := time.Unix(1000, 0)
+	if !l.Allow(AlertAttackSuspected, now) {
+		t.Errorf("first alert dropped")
+	}
+	if l.Allow(AlertAttackSuspected, now.Add(30*time.Second)) {
+		t.Errorf("repeated alert within the interval allowed")
+	}
+	if !l.Allow(AlertAccessSpike, now.Add(30*time.Second)) {
+		t.Errorf("alert of another kind dropped")
+	}
+	if !l.Allow(AlertAttackSuspected, now.Add(time.Minute)) {
+		t.Errorf("alert after the interval dropped")
+	}
+}
+
+func TestAlertJSON(t *testing.T) {
+	a := Alert{
+		Time:      time.Unix(1000, 0).UTC(),
+		Container: "c",
+		Kind:      AlertAccessSpike,
+		Addr:      "0x7f0000001000",
+		Accesses:  5000,
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	want := `{"time":"1970-01-01T00:16:40Z","container":"c","kind":"access-spike","addr":"0x7f0000001000","accesses":5000}`
+	if string(data) != want {
+		t.Errorf("json.Marshal = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditRecord is an entry of the audit log: a delay window the defense
+// injected into a container.
+//
+// Records are chained: each one carries the hash of the previous one, and
+// its own hash is signed with the host key. Changing, inserting or removing a
+// record breaks the chain. Truncating the log can only be told from the
+// last hash, which operators should keep elsewhere.
+type AuditRecord struct {
+	// Seq is the position of the record in the log, starting at 1.
+	Seq uint64 `json:"seq"`
+
+	// Time is when the window started.
+	Time time.Time `json:"time"`
+
+	// Container is the ID of the delayed container.
+	Container string `json:"container"`
+
+	// Targets are the delayed pages, as the monitor sampled them.
+	Targets []Target `json:"targets"`
+
+	// Duration is how long the window lasted.
+	Duration time.Duration `json:"duration"`
+
+	// Reason is why the policy delayed the window.
+	Reason string `json:"reason"`
+
+	// Prev is the hash of the previous record, empty for the first one.
+	Prev string `json:"prev"`
+
+	// Hash is the hex SHA-256 of the record without Hash and Sig.
+	Hash string `json:"hash"`
+
+	// Sig is the hex ed25519 signature of Hash by the host key.
+	Sig string `json:"sig"`
+}
+
+// digest returns the hash of r, without Hash and Sig.
+func (r AuditRecord) digest() ([]byte, error) {
+	r.Hash = ""
+	r.Sig = ""
+	b, err := json.Marshal(&r)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+// AuditSigner signs the hashes of audit records.
+type AuditSigner interface {
+	// SignAudit returns the signature of hash.
+	SignAudit(hash []byte) ([]byte, error)
+}
+
+// AuditKey is an AuditSigner signing with an ed25519 private key.
+type AuditKey ed25519.PrivateKey
+
+// SignAudit implements AuditSigner.SignAudit.
+func (k AuditKey) SignAudit(hash []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(k), hash), nil
+}
+
+// ParseAuditKey parses a PEM encoded PKCS #8 ed25519 private key, as written
+// by "openssl genpkey -algorithm ed25519".
+func ParseAuditKey(data []byte) (AuditKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("audit key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing audit key: %v", err)
+	}
+	k, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("audit key is a %T, not an ed25519 key", key)
+	}
+	return AuditKey(k), nil
+}
+
+// ParseAuditPublicKey parses a PEM encoded PKIX ed25519 public key, as
+// written by "openssl pkey -pubout".
+func ParseAuditPublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("audit public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing audit public key: %v", err)
+	}
+	k, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("audit public key is a %T, not an ed25519 key", key)
+	}
+	return k, nil
+}
+
+// AuditLog appends signed, chained records to an audit log. It is safe for
+// concurrent use.
+type AuditLog struct {
+	signer AuditSigner
+
+	mu   sync.Mutex
+	enc  *json.Encoder
+	seq  uint64
+	prev string
+}
+
+// NewAuditLog returns an AuditLog appending to w. last is the last record
+// already in the log, which new records are chained to, or nil if the log is
+// empty.
+func NewAuditLog(w io.Writer, signer AuditSigner, last *AuditRecord) *AuditLog {
+	l := &AuditLog{
+		signer: signer,
+		enc:    json.NewEncoder(w),
+	}
+	if last != nil {
+		l.seq = last.Seq
+		l.prev = last.Hash
+	}
+	return l
+}
+
+// Record chains, signs and appends r. Records without a time are stamped
+// with the current time.
+func (l *AuditLog) Record(r AuditRecord) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r.Seq = l.seq + 1
+	r.Prev = l.prev
+	hash, err := r.digest()
+	if err != nil {
+		return err
+	}
+	sig, err := l.signer.SignAudit(hash)
+	if err != nil {
+		return fmt.Errorf("signing audit record: %v", err)
+	}
+	r.Hash = hex.EncodeToString(hash)
+	r.Sig = hex.EncodeToString(sig)
+	if err := l.enc.Encode(&r); err != nil {
+		return err
+	}
+	l.seq = r.Seq
+	l.prev = r.Hash
+	return nil
+}
+
+// LastAuditRecord returns the last record of the audit log read from r, or
+// nil if it is empty.
+func LastAuditRecord(r io.Reader) (*AuditRecord, error) {
+	dec := json.NewDecoder(r)
+	var last *AuditRecord
+	for {
+		var rec AuditRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return last, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("reading audit record: %v", err)
+		}
+		last = &rec
+	}
+}
+
+// VerifyAudit checks the chain and the signatures of the audit log read from
+// r with the host public key pub. It returns the records read, which are all
+// valid if the error is nil.
+func VerifyAudit(r io.Reader, pub ed25519.PublicKey) ([]AuditRecord, error) {
+	dec := json.NewDecoder(r)
+	var recs []AuditRecord
+	prev := ""
+	for seq := uint64(1); ; seq++ {
+		var rec AuditRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return recs, nil
+		} else if err != nil {
+			return recs, fmt.Errorf("reading audit record %d: %v", seq, err)
+		}
+		if rec.Seq != seq {
+			return recs, fmt.Errorf("audit record %d has sequence number %d, records are missing", seq, rec.Seq)
+		}
+		if rec.Prev != prev {
+			return recs, fmt.Errorf("audit record %d is not chained to the previous one", seq)
+		}
+		hash, err := rec.digest()
+		if err != nil {
+			return recs, err
+		}
+		if rec.Hash != hex.EncodeToString(hash) {
+			return recs, fmt.Errorf("audit record %d was modified", seq)
+		}
+		sig, err := hex.DecodeString(rec.Sig)
+		if err != nil || !ed25519.Verify(pub, hash, sig) {
+			return recs, fmt.Errorf("audit record %d has an invalid signature", seq)
+		}
+		recs = append(recs, rec)
+		prev = rec.Hash
+	}
+}
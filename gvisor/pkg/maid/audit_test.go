@@ -0,0 +1,157 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+// auditLog returns a log of n records signed with a new key, along with the
+// public key.
+func auditLog(t *testing.T, n int) (string, ed25519.PublicKey, AuditKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	var buf bytes.Buffer
+	l := NewAuditLog(&buf, AuditKey(priv), nil)
+	for i := 0; i < n; i++ {
+		r := AuditRecord{
+			Container: "c",
+			Targets:   []Target{{Addr: 0x1000, Accesses: i + 1}},
+			Duration:  DelayWindow,
+			Reason:    "hot",
+		}
+		if err := l.Record(r); err != nil {
+			t.Fatalf("Record() failed: %v", err)
+		}
+	}
+	return buf.String(), pub, AuditKey(priv)
+}
+
+func TestAuditVerify(t *testing.T) {
+	log, pub, _ := auditLog(t, 3)
+	recs, err := VerifyAudit(strings.NewReader(log), pub)
+	if err != nil {
+		t.Fatalf("VerifyAudit() failed: %v", err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("VerifyAudit() returned %d records, want 3", len(recs))
+	}
+	for i, r := range recs {
+		if r.Seq != uint64(i+1) || r.Targets[0].Accesses != i+1 {
+			t.Errorf("record %d: got %+v", i, r)
+		}
+	}
+}
+
+func TestAuditTampering(t *testing.T) {
+	log, pub, _ := auditLog(t, 3)
+	lines := strings.SplitAfter(log, "\n")
+
+	for _, tc := range []struct {
+		name string
+		log  string
+	}{
+		{
+			name: "modified",
+			log:  lines[0] + strings.Replace(lines[1], `"Accesses":2`, `"Accesses":7`, 1) + lines[2],
+		},
+		{
+			name: "removed",
+			log:  lines[0] + lines[2],
+		},
+		{
+			name: "reordered",
+			log:  lines[1] + lines[0] + lines[2],
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := VerifyAudit(strings.NewReader(tc.log), pub); err == nil {
+				t.Errorf("VerifyAudit() succeeded on a %s log", tc.name)
+			}
+		})
+	}
+
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	if _, err := VerifyAudit(strings.NewReader(log), other); err == nil {
+		t.Errorf("VerifyAudit() succeeded with another key")
+	}
+}
+
+func TestAuditAppend(t *testing.T) {
+	log, pub, key := auditLog(t, 2)
+	last, err := LastAuditRecord(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("LastAuditRecord() failed: %v", err)
+	}
+	if last == nil || last.Seq != 2 {
+		t.Fatalf("LastAuditRecord() = %+v, want record 2", last)
+	}
+
+	// Reopening the log continues the chain.
+	buf := bytes.NewBufferString(log)
+	l := NewAuditLog(buf, key, last)
+	if err := l.Record(AuditRecord{Time: time.Unix(1, 0), Container: "c", Reason: "hot"}); err != nil {
+		t.Fatalf("Record() failed: %v", err)
+	}
+	recs, err := VerifyAudit(buf, pub)
+	if err != nil {
+		t.Fatalf("VerifyAudit() failed: %v", err)
+	}
+	if len(recs) != 3 {
+		t.Errorf("VerifyAudit() returned %d records, want 3", len(recs))
+	}
+}
+
+func TestParseAuditKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() failed: %v", err)
+	}
+	key, err := ParseAuditKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseAuditKey() failed: %v", err)
+	}
+	der, err = x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() failed: %v", err)
+	}
+	got, err := ParseAuditPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseAuditPublicKey() failed: %v", err)
+	}
+	if !bytes.Equal(got, pub) || !bytes.Equal(ed25519.PrivateKey(key).Public().(ed25519.PublicKey), pub) {
+		t.Errorf("parsed keys don't match the generated ones")
+	}
+
+	if _, err := ParseAuditKey([]byte("not a key")); err == nil {
+		t.Errorf("ParseAuditKey() succeeded on garbage")
+	}
+}
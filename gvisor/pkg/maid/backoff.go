@@ -0,0 +1,154 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BackoffKind is how the sampling interval grows while no window is delayed.
+type BackoffKind int32
+
+const (
+	// BackoffExponential multiplies the interval by a factor.
+	BackoffExponential BackoffKind = iota
+
+	// BackoffLinear adds a step to the interval.
+	BackoffLinear
+)
+
+// String implements fmt.Stringer.
+func (k BackoffKind) String() string {
+	switch k {
+	case BackoffExponential:
+		return "exponential"
+	case BackoffLinear:
+		return "linear"
+	default:
+		return fmt.Sprintf("unknown(%d)", k)
+	}
+}
+
+// BackoffReset is a set of events which bring the sampling interval back to
+// SampleInterval.
+type BackoffReset uint32
+
+const (
+	// ResetOnDelay resets the interval when a window is delayed.
+	ResetOnDelay BackoffReset = 1 << iota
+
+	// ResetOnHit resets the interval when a delay window observed delayed
+	// accesses.
+	ResetOnHit
+)
+
+// String implements fmt.Stringer.
+func (r BackoffReset) String() string {
+	var events []string
+	if r&ResetOnDelay != 0 {
+		events = append(events, "delay")
+	}
+	if r&ResetOnHit != 0 {
+		events = append(events, "hit")
+	}
+	if len(events) == 0 {
+		return "none"
+	}
+	return strings.Join(events, ",")
+}
+
+// ParseBackoffReset parses a comma separated list of reset events, as
+// printed by BackoffReset.String.
+func ParseBackoffReset(s string) (BackoffReset, error) {
+	var r BackoffReset
+	for _, event := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(event)) {
+		case "delay":
+			r |= ResetOnDelay
+		case "hit":
+			r |= ResetOnHit
+		case "none", "":
+		default:
+			return 0, fmt.Errorf("invalid backoff reset event %q", event)
+		}
+	}
+	return r, nil
+}
+
+// Backoff configures how the policy backs off sampling while nothing is
+// delayed.
+//
+// +stateify savable
+type Backoff struct {
+	// Kind is how the interval grows.
+	Kind BackoffKind
+
+	// Factor multiplies the interval with BackoffExponential.
+	Factor int
+
+	// Step is added to the interval with BackoffLinear.
+	Step time.Duration
+
+	// Max caps the interval.
+	Max time.Duration
+
+	// Reset is the set of events which reset the interval.
+	Reset BackoffReset
+}
+
+// DefaultBackoff is the back-off of new policies.
+var DefaultBackoff = Backoff{
+	Kind:   BackoffExponential,
+	Factor: 10,
+	Step:   SampleInterval,
+	Max:    MaxSampleInterval,
+	Reset:  ResetOnDelay,
+}
+
+// Validate returns an error if b can't back off.
+func (b Backoff) Validate() error {
+	switch b.Kind {
+	case BackoffExponential:
+		if b.Factor < 1 {
+			return fmt.Errorf("backoff factor must be >= 1, got: %d", b.Factor)
+		}
+	case BackoffLinear:
+		if b.Step < 0 {
+			return fmt.Errorf("backoff step must be >= 0, got: %v", b.Step)
+		}
+	default:
+		return fmt.Errorf("unknown backoff kind %v", b.Kind)
+	}
+	if b.Max < SampleInterval {
+		return fmt.Errorf("backoff max must be >= %v, got: %v", SampleInterval, b.Max)
+	}
+	return nil
+}
+
+// next returns the interval following interval.
+func (b Backoff) next(interval time.Duration) time.Duration {
+	switch b.Kind {
+	case BackoffLinear:
+		interval += b.Step
+	default:
+		interval *= time.Duration(b.Factor)
+	}
+	if interval > b.Max {
+		interval = b.Max
+	}
+	return interval
+}
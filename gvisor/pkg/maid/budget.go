@@ -0,0 +1,92 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// delayBucket is a token bucket of delay time. It fills at rate per second,
+// up to one second worth of tokens, and every delay takes its duration from
+// it.
+type delayBucket struct {
+	mu sync.Mutex
+
+	// rate is the delay time allowed per second. 0 means unlimited.
+	rate time.Duration
+
+	// tokens is the delay time left.
+	tokens time.Duration
+
+	// last is when tokens was last refilled.
+	last time.Time
+}
+
+// reset sets the rate of b and fills it.
+func (b *delayBucket) reset(rate time.Duration, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate = rate
+	b.tokens = rate
+	b.last = now
+}
+
+// take returns how much of the delay d is allowed at now and takes it from
+// b.
+func (b *delayBucket) take(d time.Duration, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 || d <= 0 {
+		return d
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += time.Duration(float64(b.rate) * elapsed.Seconds())
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+		b.last = now
+	}
+	if d > b.tokens {
+		d = b.tokens
+	}
+	b.tokens -= d
+	return d
+}
+
+// delayBudget bounds the delays injected into the sandbox.
+var delayBudget delayBucket
+
+// SetDelayBudget sets the ceiling on the time the sandbox is delayed per
+// second, whatever the monitor asks for, so that a misbehaving policy or a
+// malicious target feed can't stall the workload indefinitely. Delays
+// running over the budget are shortened or skipped. 0 disables the ceiling.
+func SetDelayBudget(perSecond time.Duration) {
+	delayBudget.reset(perSecond, time.Now())
+}
+
+// LimitDelay returns how much of the delay d fits in the delay budget, and
+// charges it. Callers must only delay for the returned duration.
+func LimitDelay(d time.Duration) time.Duration {
+	allowed := delayBudget.take(d, time.Now())
+	if allowed < d {
+		atomic.AddUint64(&stats.ThrottledDelays, 1)
+	}
+	if allowed > 0 {
+		atomic.AddUint64(&stats.DelayNanos, uint64(allowed))
+	}
+	return allowed
+}
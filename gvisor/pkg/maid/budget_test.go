@@ -0,0 +1,73 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayBucketUnlimited(t *testing.T) {
+	var b delayBucket
+	now := time.Unix(0, 0)
+	b.reset(0, now)
+	for i := 0; i < 10; i++ {
+		if got := b.take(time.Second, now); got != time.Second {
+			t.Fatalf("take(1s) = %v without a budget, want 1s", got)
+		}
+	}
+}
+
+func TestDelayBucketCeiling(t *testing.T) {
+	var b delayBucket
+	now := time.Unix(0, 0)
+	b.reset(100*time.Millisecond, now)
+
+	// A burst is bounded by one second worth of budget.
+	var total time.Duration
+	for i := 0; i < 100; i++ {
+		total += b.take(10*time.Millisecond, now)
+	}
+	if total != 100*time.Millisecond {
+		t.Errorf("burst delayed for %v, want 100ms", total)
+	}
+
+	// Over a longer run, delays don't exceed the rate.
+	total = 0
+	for i := 0; i < 1000; i++ {
+		now = now.Add(10 * time.Millisecond)
+		total += b.take(50*time.Millisecond, now)
+	}
+	if want := time.Second; total > want+time.Millisecond || total < want-time.Millisecond {
+		t.Errorf("delayed for %v over 10s, want %v", total, want)
+	}
+}
+
+func TestDelayBucketRefill(t *testing.T) {
+	var b delayBucket
+	now := time.Unix(0, 0)
+	b.reset(100*time.Millisecond, now)
+	if got := b.take(time.Second, now); got != 100*time.Millisecond {
+		t.Fatalf("take(1s) = %v, want 100ms", got)
+	}
+	if got := b.take(time.Millisecond, now); got != 0 {
+		t.Errorf("take(1ms) = %v on an empty bucket, want 0", got)
+	}
+	// Idle time doesn't accumulate more than one second worth.
+	now = now.Add(time.Hour)
+	if got := b.take(time.Second, now); got != 100*time.Millisecond {
+		t.Errorf("take(1s) = %v after an hour, want 100ms", got)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// labelPrefix marks the calendar entries that are labels.
+const labelPrefix = "label:"
+
+// CalendarEntry is a period during which the sandbox is protected: the
+// minutes matching a schedule, or the whole life of a container carrying a
+// label.
+type CalendarEntry struct {
+	// Schedule has the five fields of crontab(5): minute, hour, day of
+	// month, month and day of week. Each field is *, a value, a range
+	// a-b, a step */n, a-b/n or a/n, or a comma separated list of those.
+	// Days of week go from 0, Sunday, to 7, Sunday again. As with cron,
+	// when both days are restricted, either matching is enough. Empty for
+	// a label.
+	Schedule string
+
+	// Label is a KEY=VALUE label the container must carry, or just a KEY
+	// it must carry with any value. Empty for a schedule.
+	Label string
+}
+
+// String implements fmt.Stringer.
+func (e CalendarEntry) String() string {
+	if e.Label != "" {
+		return labelPrefix + e.Label
+	}
+	return e.Schedule
+}
+
+// cronFields are the ranges of the fields of a schedule.
+var cronFields = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Calendar is when the sandbox is protected: while any of its entries is
+// active. An empty calendar always protects it.
+type Calendar []CalendarEntry
+
+// ParseCalendar parses a semicolon separated list of entries, as printed by
+// Calendar.String: schedules, e.g. "* 9-17 * * 1-5" for business hours, and
+// label:KEY[=VALUE] labels, e.g. "label:job=payments".
+func ParseCalendar(s string) (Calendar, error) {
+	var c Calendar
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, labelPrefix) {
+			label := strings.TrimPrefix(entry, labelPrefix)
+			if label == "" || strings.HasPrefix(label, "=") {
+				return nil, fmt.Errorf("invalid calendar label %q, want label:KEY or label:KEY=VALUE", entry)
+			}
+			c = append(c, CalendarEntry{Label: label})
+			continue
+		}
+		fields := strings.Fields(entry)
+		if len(fields) != len(cronFields) {
+			return nil, fmt.Errorf("invalid calendar schedule %q, want %d fields", entry, len(cronFields))
+		}
+		for i, f := range fields {
+			if _, err := parseCronField(f, cronFields[i].min, cronFields[i].max); err != nil {
+				return nil, fmt.Errorf("invalid %s of calendar schedule %q: %v", cronFields[i].name, entry, err)
+			}
+		}
+		c = append(c, CalendarEntry{Schedule: strings.Join(fields, " ")})
+	}
+	return c, nil
+}
+
+// String implements fmt.Stringer.
+func (c Calendar) String() string {
+	entries := make([]string, 0, len(c))
+	for _, e := range c {
+		entries = append(entries, e.String())
+	}
+	return strings.Join(entries, ";")
+}
+
+// HasLabels returns whether entries of c are labels.
+func (c Calendar) HasLabels() bool {
+	for _, e := range c {
+		if e.Label != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns whether c protects a container carrying labels at t, in the
+// time zone of t.
+func (c Calendar) Active(t time.Time, labels map[string]string) bool {
+	if len(c) == 0 {
+		return true
+	}
+	for _, e := range c {
+		if e.active(t, labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// active returns whether e protects a container carrying labels at t.
+func (e CalendarEntry) active(t time.Time, labels map[string]string) bool {
+	if e.Label != "" {
+		kv := strings.SplitN(e.Label, "=", 2)
+		v, ok := labels[kv[0]]
+		return ok && (len(kv) == 1 || v == kv[1])
+	}
+	fields := strings.Fields(e.Schedule)
+	if len(fields) != len(cronFields) {
+		return false
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return false
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	in := func(set uint64, v int) bool { return set&(1<<uint(v)) != 0 }
+	if !in(sets[0], t.Minute()) || !in(sets[1], t.Hour()) || !in(sets[3], int(t.Month())) {
+		return false
+	}
+	dom, dow := in(sets[2], t.Day()), in(sets[4], int(t.Weekday()))
+	if strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[4], "*") {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// parseCronField returns the set of values of the schedule field f, whose
+// values go from min to max, as bits.
+func parseCronField(f string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		step, stepped := 1, false
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			step, stepped, part = n, true, part[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[1])
+			}
+		default:
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			lo = v
+			if !stepped {
+				// a/n runs to the end of the range, a alone
+				// is a single value.
+				hi = v
+			}
+		}
+		if lo < min || hi > max {
+			return 0, fmt.Errorf("range %d-%d out of %d-%d", lo, hi, min, max)
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("empty range %d-%d", lo, hi)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCalendar(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{in: "", want: "", ok: true},
+		{in: " * 9-17  * * 1-5 ; label:job=payments", want: "* 9-17 * * 1-5;label:job=payments", ok: true},
+		{in: "*/15 0,12 1 1-12/2 7;label:batch", want: "*/15 0,12 1 1-12/2 7;label:batch", ok: true},
+		{in: "* * * *"},
+		{in: "60 * * * *"},
+		{in: "* 17-9 * * *"},
+		{in: "*/0 * * * *"},
+		{in: "* * 0 * *"},
+		{in: "label:"},
+		{in: "label:=x"},
+	} {
+		c, err := ParseCalendar(tc.in)
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseCalendar(%q) = %v, want ok %t", tc.in, err, tc.ok)
+			continue
+		}
+		if err == nil && c.String() != tc.want {
+			t.Errorf("ParseCalendar(%q) = %q, want %q", tc.in, c.String(), tc.want)
+		}
+	}
+}
+
+func TestCalendarActive(t *testing.T) {
+	// A Wednesday.
+	wed := func(hour, min int) time.Time { return time.Date(2021, time.March, 3, hour, min, 0, 0, time.UTC) }
+	sun := time.Date(2021, time.March, 7, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		cal    string
+		at     time.Time
+		labels map[string]string
+		want   bool
+	}{
+		{cal: "", at: sun, want: true},
+		{cal: "* 9-17 * * 1-5", at: wed(9, 0), want: true},
+		{cal: "* 9-17 * * 1-5", at: wed(17, 59), want: true},
+		{cal: "* 9-17 * * 1-5", at: wed(18, 0)},
+		{cal: "* 9-17 * * 1-5", at: sun},
+		{cal: "* * * * 7", at: sun, want: true},
+		{cal: "*/20 * * * *", at: wed(3, 40), want: true},
+		{cal: "*/20 * * * *", at: wed(3, 41)},
+		{cal: "10/20 * * * *", at: wed(3, 50), want: true},
+		// Either day is enough when both are restricted...
+		{cal: "* * 7 * 3", at: wed(1, 0), want: true},
+		{cal: "* * 7 * 3", at: sun, want: true},
+		// ...both must match otherwise.
+		{cal: "* * 7 * *", at: wed(1, 0)},
+		{cal: "label:job=payments", at: sun, labels: map[string]string{"job": "payments"}, want: true},
+		{cal: "label:job=payments", at: sun, labels: map[string]string{"job": "reports"}},
+		{cal: "label:job", at: sun, labels: map[string]string{"job": "reports"}, want: true},
+		{cal: "* 9-17 * * 1-5;label:job=payments", at: sun, labels: map[string]string{"job": "payments"}, want: true},
+	} {
+		c, err := ParseCalendar(tc.cal)
+		if err != nil {
+			t.Fatalf("ParseCalendar(%q): %v", tc.cal, err)
+		}
+		if got := c.Active(tc.at, tc.labels); got != tc.want {
+			t.Errorf("%q.Active(%v, %v) = %t, want %t", tc.cal, tc.at, tc.labels, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"math/rand"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	// MaxChaosPages is the number of sampled pages Chaos draws random
+	// targets from.
+	MaxChaosPages = 4096
+
+	// ChaosHorizon is the number of sampling cycles over which Chaos
+	// spreads the windows the policy decided, uniformly.
+	ChaosHorizon = 64
+)
+
+// Chaos is the control arm of an evaluation: it delays as much as the policy
+// decides, but uniformly at random in space and time instead of on the hot
+// pages in hot phases. Comparing it with targeted delays tells how much of
+// the protection comes from targeting rather than from noise alone.
+//
+// Every window the policy decides is opened at a random cycle within the next
+// ChaosHorizon cycles, on as many pages drawn uniformly from all the pages
+// sampled so far. Random pages are drawn from sampled ones rather than from
+// the whole address space, most of which isn't mapped and can't be delayed.
+type Chaos struct {
+	rand *rand.Rand
+
+	// pages is a uniform sample of the pages sampled so far, and seen the
+	// number of pages added to it.
+	pages []usermem.Addr
+	seen  int
+
+	// cycle is the current sampling cycle, and due the number of targets
+	// of the windows owed, by the cycle they open at.
+	cycle int
+	due   map[int][]int
+}
+
+// NewChaos returns a Chaos drawing from a source seeded with seed.
+func NewChaos(seed int64) *Chaos {
+	return &Chaos{
+		rand: rand.New(rand.NewSource(seed)),
+		due:  make(map[int][]int),
+	}
+}
+
+// Observe adds the pages of a sampled batch to those random targets are drawn
+// from.
+func (c *Chaos) Observe(batch []Target) {
+	for _, t := range batch {
+		c.seen++
+		if len(c.pages) < MaxChaosPages {
+			c.pages = append(c.pages, t.Addr)
+		} else if i := c.rand.Intn(c.seen); i < MaxChaosPages {
+			c.pages[i] = t.Addr
+		}
+	}
+}
+
+// Owe records that the policy decided a window on n targets in the current
+// cycle.
+func (c *Chaos) Owe(n int) {
+	if n <= 0 {
+		return
+	}
+	at := c.cycle + c.rand.Intn(ChaosHorizon)
+	c.due[at] = append(c.due[at], n)
+}
+
+// Next ends the current cycle and returns the targets of the window to open
+// in it, or nil if none is due. If several are, the others are postponed to
+// the next cycle.
+func (c *Chaos) Next() []Target {
+	cur := c.cycle
+	c.cycle++
+	due := c.due[cur]
+	delete(c.due, cur)
+	if len(due) == 0 || len(c.pages) == 0 {
+		if len(due) != 0 {
+			c.due[c.cycle] = append(c.due[c.cycle], due...)
+		}
+		return nil
+	}
+	if len(due) > 1 {
+		c.due[c.cycle] = append(c.due[c.cycle], due[1:]...)
+	}
+
+	n := due[0]
+	if n > MaxBatchTargets {
+		n = MaxBatchTargets
+	}
+	targets := make([]Target, 0, n)
+	picked := make(map[usermem.Addr]bool, n)
+	for tries := 0; len(targets) < n && tries < 4*n; tries++ {
+		addr := c.pages[c.rand.Intn(len(c.pages))]
+		if picked[addr] {
+			continue
+		}
+		picked[addr] = true
+		targets = append(targets, Target{Addr: addr, Accesses: 1})
+	}
+	return targets
+}
+
+// Owed returns the number of windows decided but not opened yet.
+func (c *Chaos) Owed() int {
+	n := 0
+	for _, due := range c.due {
+		n += len(due)
+	}
+	return n
+}
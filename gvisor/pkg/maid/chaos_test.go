@@ -0,0 +1,94 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestChaosMatchesWindows(t *testing.T) {
+	c := NewChaos(1)
+	sampled := make(map[usermem.Addr]bool)
+	var batch []Target
+	for i := 0; i < 32; i++ {
+		addr := usermem.Addr(0x10000 + i*usermem.PageSize)
+		sampled[addr] = true
+		batch = append(batch, Target{Addr: addr, Accesses: 100})
+	}
+	c.Observe(batch)
+
+	// The policy decides a window of 3 targets every 4 cycles.
+	const cycles = 1000
+	decided, opened := 0, 0
+	for cycle := 0; cycle < cycles+2*ChaosHorizon; cycle++ {
+		if cycle < cycles && cycle%4 == 0 {
+			c.Owe(3)
+			decided++
+		}
+		targets := c.Next()
+		if targets == nil {
+			continue
+		}
+		opened++
+		if len(targets) != 3 {
+			t.Errorf("cycle %d: got %d targets, want 3", cycle, len(targets))
+		}
+		for _, target := range targets {
+			if !sampled[target.Addr] {
+				t.Errorf("cycle %d: target %#x was never sampled", cycle, target.Addr)
+			}
+		}
+	}
+	if opened != decided || c.Owed() != 0 {
+		t.Errorf("opened %d windows with %d owed, want %d windows", opened, c.Owed(), decided)
+	}
+}
+
+func TestChaosSpreadsWindows(t *testing.T) {
+	c := NewChaos(1)
+	c.Observe([]Target{{Addr: 0x1000, Accesses: 1}})
+
+	// A burst of decisions in one cycle is spread over the horizon.
+	for i := 0; i < 8; i++ {
+		c.Owe(1)
+	}
+	windows := 0
+	for cycle := 0; cycle < ChaosHorizon+8; cycle++ {
+		if c.Next() != nil {
+			windows++
+			if windows == 8 && cycle < 8 {
+				t.Errorf("all windows opened by cycle %d, want them spread over %d cycles", cycle, ChaosHorizon)
+			}
+		}
+	}
+	if windows != 8 {
+		t.Errorf("opened %d windows, want 8", windows)
+	}
+}
+
+func TestChaosWithoutSamples(t *testing.T) {
+	c := NewChaos(1)
+	c.Owe(1)
+	for cycle := 0; cycle < ChaosHorizon; cycle++ {
+		if targets := c.Next(); targets != nil {
+			t.Fatalf("Next() = %v without any sampled page, want nil", targets)
+		}
+	}
+	if c.Owed() != 1 {
+		t.Errorf("Owed() = %d, want 1", c.Owed())
+	}
+}
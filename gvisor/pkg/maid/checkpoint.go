@@ -0,0 +1,270 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// PolicyState is the learned history of a Policy. The monitor hands it to
+// the sentry so that it is saved with the sandbox and given back to the
+// monitor of the restored sandbox.
+//
+// +stateify savable
+type PolicyState struct {
+	// Accesses are the last compensated access counts, oldest first.
+	Accesses []int
+
+	// Delayed records whether the window after the last sample was
+	// delayed.
+	Delayed bool
+
+	// Index counts the samples seen so far.
+	Index int
+
+	// Interval is the time to wait before sampling again.
+	Interval time.Duration
+
+	// Idle counts, per address, the consecutive idle delay windows.
+	Idle map[usermem.Addr]int
+
+	// Delaying and Dwell are the hysteresis state: whether the last
+	// decision was to delay and for how many decisions it has been so.
+	Delaying bool
+	Dwell    int
+
+	// Slowdown is the slowdown of the access rate during delay windows
+	// measured so far, 0 if unknown.
+	Slowdown float64
+}
+
+// maxHistoryIdle bounds the number of idle addresses a PolicyState handed
+// over by the monitor may carry.
+const maxHistoryIdle = 4096
+
+// Validate checks that s is a history a Policy could have produced.
+func (s *PolicyState) Validate() error {
+	if len(s.Accesses) > MaxHistoryWindow {
+		return fmt.Errorf("history of %d accesses, at most %d allowed", len(s.Accesses), MaxHistoryWindow)
+	}
+	for _, n := range s.Accesses {
+		if n < 0 || n > MaxTargetAccesses {
+			return fmt.Errorf("invalid access count %d", n)
+		}
+	}
+	if s.Index < 0 {
+		return fmt.Errorf("invalid sample index %d", s.Index)
+	}
+	if s.Interval < 0 {
+		return fmt.Errorf("invalid sample interval %v", s.Interval)
+	}
+	if s.Dwell < 0 {
+		return fmt.Errorf("invalid dwell %d", s.Dwell)
+	}
+	if s.Slowdown != 0 && (s.Slowdown < minSlowdown || s.Slowdown > 1) {
+		return fmt.Errorf("invalid slowdown %v", s.Slowdown)
+	}
+	if len(s.Idle) > maxHistoryIdle {
+		return fmt.Errorf("%d idle addresses, at most %d allowed", len(s.Idle), maxHistoryIdle)
+	}
+	for addr, n := range s.Idle {
+		if addr == 0 || !addr.IsPageAligned() || addr >= maxTargetAddr {
+			return fmt.Errorf("invalid idle address %#x", addr)
+		}
+		if n < 0 {
+			return fmt.Errorf("invalid idle count %d for %#x", n, addr)
+		}
+	}
+	return nil
+}
+
+// State returns a copy of the learned history of p.
+func (p *Policy) State() *PolicyState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := &PolicyState{
+		Delayed:  p.delayed,
+		Index:    p.index,
+		Interval: p.interval,
+		Idle:     make(map[usermem.Addr]int, len(p.idle)),
+		Delaying: p.delaying,
+		Dwell:    p.dwell,
+		Slowdown: p.slowdown,
+	}
+	for _, x := range p.history.Samples() {
+		s.Accesses = append(s.Accesses, int(x))
+	}
+	for addr, n := range p.idle {
+		s.Idle[addr] = n
+	}
+	return s
+}
+
+// SetState replaces the learned history of p with s. The back-off
+// configuration and history window of p are kept: a longer history is cut to
+// its last samples.
+func (p *Policy) SetState(s *PolicyState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(s.Accesses) > 0 {
+		samples := make([]float64, 0, len(s.Accesses))
+		for _, n := range s.Accesses {
+			samples = append(samples, float64(n))
+		}
+		p.history = newHistory(p.history.Size(), samples)
+	}
+	p.delayed = s.Delayed
+	p.index = s.Index
+	p.interval = s.Interval
+	p.idle = make(map[usermem.Addr]int, len(s.Idle))
+	for addr, n := range s.Idle {
+		p.idle[addr] = n
+	}
+	p.delaying = s.Delaying
+	p.dwell = s.Dwell
+	if s.Slowdown != 0 {
+		p.slowdown = s.Slowdown
+	}
+}
+
+// State is the jitter state of the sentry. It is saved with the kernel.
+//
+// +stateify savable
+type State struct {
+	// Targets is the target set.
+	Targets map[usermem.Addr]int
+
+	// Primary is the primary target and Origin the primary target as the
+	// monitor knows it.
+	Primary usermem.Addr
+	Origin  usermem.Addr
+
+	// SleepTime and WaitTime are the delay parameters of the primary
+	// target.
+	SleepTime int
+	WaitTime  int
+
+	// Wait is how the delays of the last window were waited out.
+	Wait WaitMode
+
+	// Monitor is the last history the monitor handed over, if any.
+	Monitor *PolicyState
+}
+
+// monitorHistory is the last history the monitor handed over.
+var monitorHistory struct {
+	mu    sync.Mutex
+	state *PolicyState
+}
+
+// setMonitorHistory records the history handed over by the monitor.
+func setMonitorHistory(s *PolicyState) {
+	monitorHistory.mu.Lock()
+	monitorHistory.state = s
+	monitorHistory.mu.Unlock()
+}
+
+// currentMonitorHistory returns the last history handed over by the monitor.
+func currentMonitorHistory() *PolicyState {
+	monitorHistory.mu.Lock()
+	defer monitorHistory.mu.Unlock()
+	return monitorHistory.state
+}
+
+// SaveState returns the jitter state of the sentry.
+func SaveState() *State {
+	TAddrs.Lock()
+	TAddr.Lock()
+	s := &State{
+		Targets:   make(map[usermem.Addr]int, len(TAddrs.Addrs)),
+		Primary:   TAddr.Addr,
+		Origin:    TAddr.Origin,
+		SleepTime: TAddr.SleepTime,
+		WaitTime:  TAddr.WaitTime,
+		Wait:      CurrentWaitMode(),
+	}
+	for addr, n := range TAddrs.Addrs {
+		s.Targets[addr] = n
+	}
+	TAddr.Unlock()
+	TAddrs.Unlock()
+	s.Monitor = currentMonitorHistory()
+	return s
+}
+
+// RestoreState restores the jitter state saved by SaveState. The targets
+// are restored with the delay window closed: protections are not part of
+// the saved address spaces, so the monitor opens the next window.
+func RestoreState(s *State) {
+	if s == nil {
+		return
+	}
+	TAddrs.Lock()
+	TAddr.Lock()
+	TAddrs.Addrs = make(map[usermem.Addr]int, len(s.Targets))
+	for addr, n := range s.Targets {
+		TAddrs.Addrs[addr] = n
+	}
+	// Cache lines are not saved, the targets are delayed whole.
+	TAddrs.lines = make(map[usermem.Addr]uint64)
+	TAddrs.hot = hotRegionOf(TAddrs.Addrs)
+	TAddrs.discard()
+	TAddr.Addr = s.Primary
+	TAddr.Origin = s.Origin
+	TAddr.SleepTime = s.SleepTime
+	TAddr.WaitTime = s.WaitTime
+	TAddr.Flag = false
+	TAddr.Hits = 0
+	TAddr.Unlock()
+	TAddrs.Unlock()
+	setWindowWaitMode(s.Wait)
+
+	Modaddr.Lock()
+	Modaddr.Perms = make(map[usermem.Addr]usermem.AccessType)
+	Modaddr.Unlock()
+
+	setMonitorHistory(s.Monitor)
+}
+
+// started is closed once the sandbox has started or been restored, and
+// restored tells which.
+var (
+	started     = make(chan struct{})
+	startedOnce sync.Once
+	restored    bool
+)
+
+// SetStarted records that the sandbox has started, from a checkpoint if
+// fromCheckpoint is true. MessageResume is only answered after it is called.
+func SetStarted(fromCheckpoint bool) {
+	startedOnce.Do(func() {
+		restored = fromCheckpoint
+		close(started)
+	})
+}
+
+// resume waits for the sandbox to start and fills ack with what the monitor
+// needs to resume.
+func resume(ack *Ack) {
+	<-started
+	ack.Restored = restored
+	if restored {
+		ack.History = currentMonitorHistory()
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+)
+
+func TestPolicyStateRoundTrip(t *testing.T) {
+	p := NewPolicy()
+	for i := 0; i < 2*DefaultHistoryWindow; i++ {
+		decideIdle(p)
+	}
+	p.Record(0x1000, 0)
+
+	q := NewPolicy()
+	q.SetState(p.State())
+	if got, want := q.State(), p.State(); got.Index != want.Index || got.Interval != want.Interval || got.Idle[0x1000] != 1 {
+		t.Errorf("restored state %+v, want %+v", got, want)
+	}
+	if _, got := q.Decide(10); got != p.interval {
+		t.Errorf("restored policy backs off to %v, want %v", got, p.interval)
+	}
+}
+
+func TestStateRestore(t *testing.T) {
+	startDelay([]Target{{Addr: 0x1000, Accesses: 100}, {Addr: 0x2000, Accesses: 50}}, 0x5000, 0, WaitSleep)
+	setMonitorHistory(&PolicyState{Index: 7})
+	s := SaveState()
+	stopDelay()
+	setMonitorHistory(nil)
+
+	RestoreState(s)
+	defer stopDelay()
+	if TAddr.Flag {
+		t.Errorf("delay window open after restore")
+	}
+	if TAddr.Addr != 0x1000 || TAddr.Origin != 0x5000 {
+		t.Errorf("primary target %x (origin %x), want 1000 (origin 5000)", TAddr.Addr, TAddr.Origin)
+	}
+	if len(TAddrs.Addrs) != 2 || TAddrs.Addrs[0x2000] != 50 {
+		t.Errorf("target set %v, want both targets", TAddrs.Addrs)
+	}
+	if h := currentMonitorHistory(); h == nil || h.Index != 7 {
+		t.Errorf("monitor history %+v, want index 7", h)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// TraceSummary is what a trace did, as compared by CompareTraces.
+type TraceSummary struct {
+	// Samples is the number of samples recorded, and Windows the number
+	// of delay windows decided on.
+	Samples int
+	Windows int
+
+	// Delay is the delay injected, assuming each window lasted
+	// DelayWindow.
+	Delay time.Duration
+
+	// Delayed are the pages delayed in at least one window.
+	Delayed map[usermem.Addr]struct{}
+
+	// Accesses are the accesses sampled on each page.
+	Accesses map[usermem.Addr]int
+}
+
+// SummarizeTrace returns the summary of the trace read from r.
+func SummarizeTrace(r *TraceReader) (TraceSummary, error) {
+	s := TraceSummary{
+		Delayed:  make(map[usermem.Addr]struct{}),
+		Accesses: make(map[usermem.Addr]int),
+	}
+	for n := 1; ; n++ {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return s, fmt.Errorf("reading record %d: %v", n, err)
+		}
+		switch {
+		case rec.Event == TraceSample:
+			s.Samples++
+			for _, t := range rec.Targets {
+				s.Accesses[t.Addr.RoundDown()] += t.Accesses
+			}
+		case rec.Delay:
+			// Refreshes change the targets of the open window.
+			if rec.Reason != "refresh" {
+				s.Windows++
+				s.Delay += DelayWindow
+			}
+			for _, t := range rec.Targets {
+				s.Delayed[t.Addr.RoundDown()] = struct{}{}
+			}
+		}
+	}
+}
+
+// TraceComparison compares the decisions of two traces, e.g. recorded with
+// two policies on the same workload.
+type TraceComparison struct {
+	A, B TraceSummary
+
+	// Common are the pages both traces delayed, and OnlyA and OnlyB those
+	// only one of them did. Overlap is the Jaccard index of the pages
+	// they delayed, 1 if they delayed the same pages.
+	Common  int
+	OnlyA   int
+	OnlyB   int
+	Overlap float64
+
+	// Hot are the ground truth hot pages: those sampled most over both
+	// traces, hottest first.
+	Hot []usermem.Addr
+
+	// CoverageA and CoverageB are the fractions of the accesses sampled
+	// on Hot that fall on pages each trace delayed.
+	CoverageA float64
+	CoverageB float64
+}
+
+// CompareTraces compares the traces read from a and b, taking the hot pages
+// sampled most over both as the ground truth hot regions.
+func CompareTraces(a, b *TraceReader, hot int) (*TraceComparison, error) {
+	var (
+		c   TraceComparison
+		err error
+	)
+	if c.A, err = SummarizeTrace(a); err != nil {
+		return nil, fmt.Errorf("first trace: %v", err)
+	}
+	if c.B, err = SummarizeTrace(b); err != nil {
+		return nil, fmt.Errorf("second trace: %v", err)
+	}
+
+	for page := range c.A.Delayed {
+		if _, ok := c.B.Delayed[page]; ok {
+			c.Common++
+		} else {
+			c.OnlyA++
+		}
+	}
+	c.OnlyB = len(c.B.Delayed) - c.Common
+	if union := c.Common + c.OnlyA + c.OnlyB; union != 0 {
+		c.Overlap = float64(c.Common) / float64(union)
+	}
+
+	totals := make(map[usermem.Addr]int)
+	for _, s := range []TraceSummary{c.A, c.B} {
+		for page, n := range s.Accesses {
+			totals[page] += n
+		}
+	}
+	for page := range totals {
+		c.Hot = append(c.Hot, page)
+	}
+	sort.Slice(c.Hot, func(i, j int) bool {
+		if ti, tj := totals[c.Hot[i]], totals[c.Hot[j]]; ti != tj {
+			return ti > tj
+		}
+		return c.Hot[i] < c.Hot[j]
+	})
+	if len(c.Hot) > hot {
+		c.Hot = c.Hot[:hot]
+	}
+	c.CoverageA = coverage(c.Hot, totals, c.A.Delayed)
+	c.CoverageB = coverage(c.Hot, totals, c.B.Delayed)
+	return &c, nil
+}
+
+// coverage returns the fraction of the accesses to the pages hot that fall
+// on pages of delayed.
+func coverage(hot []usermem.Addr, accesses map[usermem.Addr]int, delayed map[usermem.Addr]struct{}) float64 {
+	var total, covered int
+	for _, page := range hot {
+		total += accesses[page]
+		if _, ok := delayed[page]; ok {
+			covered += accesses[page]
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(covered) / float64(total)
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// writeTrace returns a trace of recs.
+func writeTrace(t *testing.T, recs []TraceRecord) *TraceReader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewTraceWriter(&buf)
+	for _, r := range recs {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("Write(%+v) failed: %v", r, err)
+		}
+	}
+	return NewTraceReader(&buf)
+}
+
+func TestCompareTraces(t *testing.T) {
+	sample := TraceRecord{
+		Event:   TraceSample,
+		Targets: []Target{{Addr: 0x1010, Accesses: 60}, {Addr: 0x2000, Accesses: 30}, {Addr: 0x3000, Accesses: 10}},
+	}
+	a := writeTrace(t, []TraceRecord{
+		sample,
+		{Event: TraceDecision, Delay: true, Reason: "hot", Targets: []Target{{Addr: 0x1000, Accesses: 60}, {Addr: 0x2000, Accesses: 30}}},
+		{Event: TraceDecision, Delay: true, Reason: "refresh", Targets: []Target{{Addr: 0x3000, Accesses: 10}}},
+	})
+	b := writeTrace(t, []TraceRecord{
+		sample,
+		{Event: TraceDecision, Reason: "strip"},
+		sample,
+		{Event: TraceDecision, Delay: true, Reason: "hot", Targets: []Target{{Addr: 0x2000, Accesses: 30}, {Addr: 0x9000, Accesses: 1}}},
+		{Event: TraceDecision, Delay: true, Reason: "hot", Targets: []Target{{Addr: 0x2000, Accesses: 30}}},
+	})
+
+	c, err := CompareTraces(a, b, 2)
+	if err != nil {
+		t.Fatalf("CompareTraces() failed: %v", err)
+	}
+	if c.A.Samples != 1 || c.A.Windows != 1 || c.A.Delay != DelayWindow {
+		t.Errorf("first trace: %d samples, %d windows, %v delay, want 1, 1, %v", c.A.Samples, c.A.Windows, c.A.Delay, DelayWindow)
+	}
+	if c.B.Samples != 2 || c.B.Windows != 2 || c.B.Delay != 2*DelayWindow {
+		t.Errorf("second trace: %d samples, %d windows, %v delay, want 2, 2, %v", c.B.Samples, c.B.Windows, c.B.Delay, 2*DelayWindow)
+	}
+	// A delayed 0x1000, 0x2000 and 0x3000, B 0x2000 and 0x9000.
+	if c.Common != 1 || c.OnlyA != 2 || c.OnlyB != 1 || c.Overlap != 0.25 {
+		t.Errorf("overlap: %d common, %d only A, %d only B, %v, want 1, 2, 1, 0.25", c.Common, c.OnlyA, c.OnlyB, c.Overlap)
+	}
+	if want := []usermem.Addr{0x1000, 0x2000}; !reflect.DeepEqual(c.Hot, want) {
+		t.Errorf("Hot = %v, want %v", c.Hot, want)
+	}
+	if c.CoverageA != 1 {
+		t.Errorf("CoverageA = %v, want 1", c.CoverageA)
+	}
+	if c.CoverageB != 1.0/3 {
+		t.Errorf("CoverageB = %v, want 1/3", c.CoverageB)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import "fmt"
+
+// CompensationKind is how the policy corrects the access count sampled after
+// a delayed window, which the delays themselves bias low.
+type CompensationKind int32
+
+const (
+	// CompensateNone takes samples as they are. A delay then tends to
+	// end the hot phase it was meant to cover.
+	CompensateNone CompensationKind = iota
+
+	// CompensateLinear makes up a fixed fraction of the drop from the
+	// previous sample.
+	CompensateLinear
+
+	// CompensateMeasured divides samples by the slowdown measured over
+	// the previous delayed windows.
+	CompensateMeasured
+)
+
+// String implements fmt.Stringer.
+func (k CompensationKind) String() string {
+	switch k {
+	case CompensateNone:
+		return "none"
+	case CompensateLinear:
+		return "linear"
+	case CompensateMeasured:
+		return "measured"
+	default:
+		return fmt.Sprintf("unknown(%d)", k)
+	}
+}
+
+const (
+	// initialSlowdown is the slowdown assumed until one is measured: as if
+	// delays halved the access rate.
+	initialSlowdown = 0.5
+
+	// minSlowdown bounds the measured slowdown, and so the correction, as
+	// a genuine end of a hot phase also shows as a slowdown.
+	minSlowdown = 0.1
+
+	// slowdownWeight is the weight of the last measure in the measured
+	// slowdown.
+	slowdownWeight = 0.25
+)
+
+// Compensation configures how the policy corrects the access count sampled
+// after a delayed window. Corrected counts never exceed the previous one.
+//
+// +stateify savable
+type Compensation struct {
+	// Kind is how samples are corrected.
+	Kind CompensationKind
+
+	// Factor is the fraction of the drop from the previous sample made up
+	// with CompensateLinear, between 0 and 1.
+	Factor float64
+}
+
+// DefaultCompensation is the compensation of new policies.
+var DefaultCompensation = Compensation{
+	Kind:   CompensateLinear,
+	Factor: 0.67,
+}
+
+// Validate returns an error if c can't correct samples.
+func (c Compensation) Validate() error {
+	switch c.Kind {
+	case CompensateNone, CompensateMeasured:
+	case CompensateLinear:
+		if c.Factor < 0 || c.Factor > 1 {
+			return fmt.Errorf("compensation factor must be between 0 and 1, got: %v", c.Factor)
+		}
+	default:
+		return fmt.Errorf("unknown compensation kind %v", c.Kind)
+	}
+	return nil
+}
+
+// correct returns the access count accesses, sampled after a delayed window
+// and last, corrected for the slowdown the delays caused, which slowdown
+// estimates.
+func (c Compensation) correct(accesses, last int, slowdown float64) int {
+	if accesses >= last {
+		return accesses
+	}
+	switch c.Kind {
+	case CompensateLinear:
+		return accesses + int(float64(last-accesses)*c.Factor)
+	case CompensateMeasured:
+		if cmp := int(float64(accesses) / slowdown); cmp < last {
+			return cmp
+		}
+		return last
+	default:
+		return accesses
+	}
+}
+
+// measureSlowdown returns the slowdown estimate following slowdown once
+// accesses were sampled after a delayed window and last.
+func measureSlowdown(slowdown float64, accesses, last int) float64 {
+	if last <= 0 {
+		return slowdown
+	}
+	r := float64(accesses) / float64(last)
+	if r > 1 {
+		r = 1
+	}
+	if r < minSlowdown {
+		r = minSlowdown
+	}
+	return (1-slowdownWeight)*slowdown + slowdownWeight*r
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompensationCorrect(t *testing.T) {
+	for _, tc := range []struct {
+		c        Compensation
+		accesses int
+		last     int
+		slowdown float64
+		want     int
+	}{
+		{c: Compensation{Kind: CompensateNone}, accesses: 100, last: 400, want: 100},
+		{c: DefaultCompensation, accesses: 100, last: 400, want: 301},
+		{c: Compensation{Kind: CompensateLinear, Factor: 1}, accesses: 100, last: 400, want: 400},
+		{c: Compensation{Kind: CompensateMeasured}, accesses: 100, last: 400, slowdown: 0.5, want: 200},
+		// Corrections never exceed the previous sample.
+		{c: Compensation{Kind: CompensateMeasured}, accesses: 300, last: 400, slowdown: 0.5, want: 400},
+		// Nor do they apply to samples that didn't drop.
+		{c: DefaultCompensation, accesses: 500, last: 400, want: 500},
+		{c: Compensation{Kind: CompensateMeasured}, accesses: 500, last: 400, slowdown: 0.5, want: 500},
+	} {
+		if got := tc.c.correct(tc.accesses, tc.last, tc.slowdown); got != tc.want {
+			t.Errorf("%+v.correct(%d, %d, %v) = %d, want %d", tc.c, tc.accesses, tc.last, tc.slowdown, got, tc.want)
+		}
+	}
+}
+
+func TestMeasureSlowdown(t *testing.T) {
+	s := initialSlowdown
+	for i := 0; i < 50; i++ {
+		s = measureSlowdown(s, 200, 1000)
+	}
+	if math.Abs(s-0.2) > 1e-3 {
+		t.Errorf("slowdown converged to %v, want 0.2", s)
+	}
+	for i := 0; i < 50; i++ {
+		s = measureSlowdown(s, 0, 1000)
+	}
+	if math.Abs(s-minSlowdown) > 1e-3 {
+		t.Errorf("slowdown converged to %v, want at least %v", s, minSlowdown)
+	}
+	if got := measureSlowdown(s, 10, 0); got != s {
+		t.Errorf("slowdown measured against no previous sample: %v, want %v", got, s)
+	}
+}
+
+func TestCompensationValidate(t *testing.T) {
+	for _, c := range []Compensation{
+		DefaultCompensation,
+		{Kind: CompensateNone},
+		{Kind: CompensateMeasured},
+		{Kind: CompensateLinear, Factor: 0},
+		{Kind: CompensateLinear, Factor: 1},
+	} {
+		if err := c.Validate(); err != nil {
+			t.Errorf("%+v.Validate() failed: %v", c, err)
+		}
+	}
+	for _, c := range []Compensation{
+		{Kind: CompensateLinear, Factor: -0.1},
+		{Kind: CompensateLinear, Factor: 1.5},
+		{Kind: 42},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v.Validate() succeeded, want error", c)
+		}
+	}
+}
+
+func TestPolicyCompensation(t *testing.T) {
+	// A delay halves the access count of a steady hot phase, here that of
+	// the initial history, as new policies take the previous window as
+	// delayed. Without compensation the policy takes that for the end of
+	// the phase.
+	for _, tc := range []struct {
+		c    Compensation
+		want bool
+	}{
+		{c: Compensation{Kind: CompensateNone}, want: false},
+		{c: DefaultCompensation, want: true},
+		{c: Compensation{Kind: CompensateMeasured}, want: true},
+	} {
+		p := NewPolicy()
+		p.SetCompensation(tc.c)
+		if delay, _ := p.Decide(250); delay != tc.want {
+			t.Errorf("%v: Decide(250) after a delay = %v, want %v", tc.c.Kind, delay, tc.want)
+		}
+	}
+}
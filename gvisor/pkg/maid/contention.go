@@ -0,0 +1,95 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"math"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// DefaultContentionBoost is the factor the intensity of windows opened under
+// contention is raised by unless set otherwise.
+const DefaultContentionBoost = 2
+
+// Contention configures the cross-core contention signal. Loads of the
+// sandbox that hit a cache line modified in the cache of another core, HITM
+// loads as perf c2c reports them, mean that another party writes the lines
+// the sandbox reads, as the Prime+Probe and Flush+Reload attacks on shared
+// memory do. Once enough of them fall on the lines of the sampled targets,
+// contention is observed: the sample opens a delay window even if the policy
+// wouldn't, and the window delays harder.
+type Contention struct {
+	// MinHITM is the number of HITM loads sampled on the lines of the
+	// targets from which contention is observed. 0 disables the signal.
+	MinHITM int
+
+	// Boost is the factor the intensity of the windows opened under
+	// contention is raised by.
+	Boost float64
+}
+
+// Validate checks that c is well formed.
+func (c Contention) Validate() error {
+	if c.MinHITM < 0 {
+		return fmt.Errorf("contention threshold must be positive, got %d HITM loads", c.MinHITM)
+	}
+	if c.MinHITM > 0 && !(c.Boost >= 1 && c.Boost <= MaxIntensity) {
+		return fmt.Errorf("contention boost must be in [1, %d], got %v", MaxIntensity, c.Boost)
+	}
+	return nil
+}
+
+// Observed returns whether hitm HITM loads on the lines of the targets are
+// contention.
+func (c Contention) Observed(hitm int) bool {
+	return c.MinHITM > 0 && hitm >= c.MinHITM
+}
+
+// Boosted returns the intensity of a window of intensity i, 0 for the usual
+// delays, opened under contention.
+func (c Contention) Boosted(i float64) float64 {
+	if i == 0 {
+		i = 1
+	}
+	return math.Min(i*c.Boost, MaxIntensity)
+}
+
+// ContendedLoads returns how many of the data addresses of HITM loads hitm
+// fall on the cache lines of the targets of batch. The lines of targets whose
+// lines aren't known are the whole page.
+func ContendedLoads(batch []Target, hitm []usermem.Addr) int {
+	if len(hitm) == 0 {
+		return 0
+	}
+	lines := make(map[usermem.Addr]uint64, len(batch))
+	for _, t := range batch {
+		page := t.Addr.RoundDown()
+		if prev, ok := lines[page]; ok {
+			lines[page] = MergeLines(prev, t.Lines)
+		} else {
+			lines[page] = t.Lines
+		}
+	}
+	n := 0
+	for _, addr := range hitm {
+		l, ok := lines[addr.RoundDown()]
+		if ok && (l == 0 || l&LineOf(addr) != 0) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestContentionValidate(t *testing.T) {
+	for _, tc := range []struct {
+		c  Contention
+		ok bool
+	}{
+		{c: Contention{}, ok: true},
+		{c: Contention{MinHITM: 4, Boost: DefaultContentionBoost}, ok: true},
+		{c: Contention{MinHITM: 4, Boost: MaxIntensity}, ok: true},
+		{c: Contention{MinHITM: -1}},
+		{c: Contention{MinHITM: 4, Boost: 0.5}},
+		{c: Contention{MinHITM: 4, Boost: MaxIntensity + 1}},
+	} {
+		if err := tc.c.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%+v.Validate() = %v, want ok %t", tc.c, err, tc.ok)
+		}
+	}
+}
+
+func TestContentionObserved(t *testing.T) {
+	c := Contention{MinHITM: 3, Boost: 2}
+	if c.Observed(2) {
+		t.Errorf("Observed(2) = true below the threshold")
+	}
+	if !c.Observed(3) {
+		t.Errorf("Observed(3) = false at the threshold")
+	}
+	if (Contention{}).Observed(100) {
+		t.Errorf("Observed(100) = true with the signal disabled")
+	}
+
+	for _, tc := range []struct {
+		i, want float64
+	}{
+		{i: 0, want: 2},
+		{i: 1.5, want: 3},
+		{i: MaxIntensity, want: MaxIntensity},
+	} {
+		if got := c.Boosted(tc.i); got != tc.want {
+			t.Errorf("Boosted(%v) = %v, want %v", tc.i, got, tc.want)
+		}
+	}
+}
+
+func TestContendedLoads(t *testing.T) {
+	batch := []Target{
+		{Addr: 0x5000, Accesses: 10, Lines: LineOf(0x5040)},
+		{Addr: 0x6000, Accesses: 5},
+	}
+	hitm := []usermem.Addr{
+		0x5044, // On a sampled line.
+		0x5080, // On the page but another line.
+		0x6ff8, // Anywhere on a page of unknown lines.
+		0x7000, // Not a target.
+	}
+	if got, want := ContendedLoads(batch, hitm), 2; got != want {
+		t.Errorf("ContendedLoads() = %d, want %d", got, want)
+	}
+	if got := ContendedLoads(nil, hitm); got != 0 {
+		t.Errorf("ContendedLoads() without targets = %d, want 0", got)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// DecoyMode defines whether the sentry issues decoy accesses during delay
+// windows. Decoy accesses touch pages the application isn't interested in, so
+// that the access pattern an attacker observes is flattened.
+type DecoyMode int
+
+const (
+	// DecoyOff issues no decoy accesses.
+	DecoyOff DecoyMode = iota
+
+	// DecoyOnly issues decoy accesses instead of delaying the target.
+	DecoyOnly
+
+	// DecoyBoth issues decoy accesses in addition to delaying the target.
+	DecoyBoth
+)
+
+func (m DecoyMode) String() string {
+	switch m {
+	case DecoyOff:
+		return "off"
+	case DecoyOnly:
+		return "decoy"
+	case DecoyBoth:
+		return "both"
+	default:
+		return fmt.Sprintf("unknown(%d)", m)
+	}
+}
+
+// decoys holds the decoy configuration set with SetDecoys.
+var decoys struct {
+	mu       sync.Mutex
+	mode     DecoyMode
+	addrs    []usermem.Addr
+	interval time.Duration
+}
+
+// SetDecoys configures decoy accesses. If addrs is empty, the secondary
+// targets of the current batch are used as decoys.
+func SetDecoys(mode DecoyMode, addrs []usermem.Addr, interval time.Duration) {
+	decoys.mu.Lock()
+	defer decoys.mu.Unlock()
+	decoys.mode = mode
+	decoys.addrs = append([]usermem.Addr(nil), addrs...)
+	decoys.interval = interval
+}
+
+// CurrentDecoyMode returns the configured DecoyMode.
+func CurrentDecoyMode() DecoyMode {
+	decoys.mu.Lock()
+	defer decoys.mu.Unlock()
+	return decoys.mode
+}
+
+// DecoyInterval returns how often decoy accesses are issued.
+func DecoyInterval() time.Duration {
+	decoys.mu.Lock()
+	defer decoys.mu.Unlock()
+	return decoys.interval
+}
+
+// DecoyTargets returns the pages to access in one round of decoy accesses,
+// in random order. The primary target is never a decoy.
+func DecoyTargets() []usermem.Addr {
+	TAddr.Lock()
+	primary := TAddr.Addr
+	TAddr.Unlock()
+
+	decoys.mu.Lock()
+	addrs := make([]usermem.Addr, 0, len(decoys.addrs))
+	for _, addr := range decoys.addrs {
+		if addr.RoundDown() != primary {
+			addrs = append(addrs, addr)
+		}
+	}
+	decoys.mu.Unlock()
+
+	if len(addrs) == 0 {
+		TAddrs.Lock()
+		for addr := range TAddrs.Addrs {
+			if addr != primary {
+				addrs = append(addrs, addr)
+			}
+		}
+		TAddrs.Unlock()
+	}
+	rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	return addrs
+}
+
+// ParseDecoyAddrs parses a comma separated list of hexadecimal addresses.
+func ParseDecoyAddrs(s string) ([]usermem.Addr, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var addrs []usermem.Addr
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(f), "0x"), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decoy address %q: %v", f, err)
+		}
+		addrs = append(addrs, usermem.Addr(v))
+	}
+	return addrs, nil
+}
+
+// FormatDecoyAddrs is the inverse of ParseDecoyAddrs.
+func FormatDecoyAddrs(addrs []usermem.Addr) string {
+	fs := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		fs = append(fs, fmt.Sprintf("%#x", uint64(addr)))
+	}
+	return strings.Join(fs, ",")
+}
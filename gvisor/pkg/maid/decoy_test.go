@@ -0,0 +1,67 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestDecoyAddrsRoundTrip(t *testing.T) {
+	want := []usermem.Addr{0x1000, 0x7fff0000}
+	got, err := ParseDecoyAddrs(FormatDecoyAddrs(want))
+	if err != nil {
+		t.Fatalf("ParseDecoyAddrs failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %v, want %v", got, want)
+	}
+	if _, err := ParseDecoyAddrs("0x1000,bogus"); err == nil {
+		t.Errorf("ParseDecoyAddrs(bogus) succeeded, want error")
+	}
+}
+
+func TestDecoyTargets(t *testing.T) {
+	defer SetDecoys(DecoyOff, nil, 0)
+	TAddr.Lock()
+	TAddr.Addr = 0x1000
+	TAddr.Unlock()
+	TAddrs.Lock()
+	TAddrs.Addrs = map[usermem.Addr]int{0x1000: 1, 0x2000: 1, 0x3000: 1}
+	TAddrs.Unlock()
+	defer func() {
+		TAddrs.Lock()
+		TAddrs.Addrs = make(map[usermem.Addr]int)
+		TAddrs.Unlock()
+	}()
+
+	// Without configured decoys, the secondary targets are used.
+	SetDecoys(DecoyBoth, nil, time.Millisecond)
+	got := DecoyTargets()
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if want := []usermem.Addr{0x2000, 0x3000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DecoyTargets() = %v, want %v", got, want)
+	}
+
+	// The primary target is never a decoy.
+	SetDecoys(DecoyBoth, []usermem.Addr{0x1000, 0x5000}, time.Millisecond)
+	if got, want := DecoyTargets(), []usermem.Addr{0x5000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DecoyTargets() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Observation is what the host saw of the sandbox during one sampling
+// period.
+type Observation struct {
+	// References and Misses are the last level cache references and misses
+	// counted on the sandbox.
+	References uint64
+	Misses     uint64
+
+	// Addrs are the sampled addresses.
+	Addrs []usermem.Addr
+}
+
+const (
+	// detectorHistory is the number of observations the detector looks
+	// back on to find periodic probing.
+	detectorHistory = 16
+
+	// missRatioThreshold is the cache miss ratio above which an observation
+	// looks like probing: flush+reload and prime+probe both miss on
+	// purpose.
+	missRatioThreshold = 0.5
+
+	// minMisses is the minimum number of misses for the miss ratio to be
+	// meaningful.
+	minMisses = 1000
+
+	// periodicityThreshold is the autocorrelation of the miss counts above
+	// which probing is considered periodic.
+	periodicityThreshold = 0.6
+
+	// minStrideAddrs is the minimum number of sampled addresses on a
+	// uniform stride for the access pattern to look like probing.
+	minStrideAddrs = 8
+
+	// strideShare is the share of consecutive sampled addresses that must
+	// be on the same stride.
+	strideShare = 0.75
+
+	// suspectHold is the number of observations jitter stays active after
+	// the last suspicious one, so that it doesn't flap during an attack.
+	suspectHold = 8
+)
+
+// Detector looks for flush+reload and prime+probe signatures: a high cache
+// miss ratio together with either periodic miss counts or uniform-stride
+// probing of pages.
+type Detector struct {
+	mu sync.Mutex
+
+	// misses are the last miss counts, oldest first.
+	misses []float64
+
+	// hold is the number of observations left before the suspicion is
+	// lifted.
+	hold int
+}
+
+// NewDetector returns a detector with no history.
+func NewDetector() *Detector {
+	return &Detector{}
+}
+
+// Observe records o and returns whether an attack is suspected.
+func (d *Detector) Observe(o Observation) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.misses = append(d.misses, float64(o.Misses))
+	if len(d.misses) > detectorHistory {
+		d.misses = d.misses[1:]
+	}
+
+	if probing(o) && (periodic(d.misses) || strided(o.Addrs)) {
+		if d.hold == 0 {
+			log.Infof("[Cijitter] cache attack suspected: %d misses out of %d references", o.Misses, o.References)
+		}
+		d.hold = suspectHold
+		return true
+	}
+	if d.hold > 0 {
+		d.hold--
+		if d.hold == 0 {
+			log.Infof("[Cijitter] cache attack no longer suspected")
+		}
+	}
+	return d.hold > 0
+}
+
+// Suspected returns whether an attack is currently suspected.
+func (d *Detector) Suspected() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.hold > 0
+}
+
+// probing returns true if o misses in the cache much more than a regular
+// workload does.
+func probing(o Observation) bool {
+	if o.Misses < minMisses || o.References == 0 {
+		return false
+	}
+	return float64(o.Misses)/float64(o.References) >= missRatioThreshold
+}
+
+// periodic returns true if the autocorrelation of the series has a peak above
+// periodicityThreshold at some lag.
+func periodic(series []float64) bool {
+	n := len(series)
+	if n < detectorHistory/2 {
+		return false
+	}
+	mean := 0.0
+	for _, v := range series {
+		mean += v
+	}
+	mean /= float64(n)
+	variance := 0.0
+	for _, v := range series {
+		variance += (v - mean) * (v - mean)
+	}
+	if variance == 0 {
+		// A perfectly steady miss count is the degenerate period.
+		return mean > 0
+	}
+	for lag := 1; lag <= n/2; lag++ {
+		c := 0.0
+		for i := 0; i+lag < n; i++ {
+			c += (series[i] - mean) * (series[i+lag] - mean)
+		}
+		if c/variance >= periodicityThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// strided returns true if most of addrs are spaced by the same stride.
+func strided(addrs []usermem.Addr) bool {
+	if len(addrs) < minStrideAddrs {
+		return false
+	}
+	sorted := append([]usermem.Addr(nil), addrs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	strides := make(map[usermem.Addr]int)
+	best := 0
+	for i := 1; i < len(sorted); i++ {
+		s := sorted[i] - sorted[i-1]
+		if s == 0 {
+			continue
+		}
+		strides[s]++
+		if strides[s] > best {
+			best = strides[s]
+		}
+	}
+	return best+1 >= minStrideAddrs && float64(best) >= math.Ceil(strideShare*float64(len(sorted)-1))
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// stridedAddrs returns n pages spaced by stride from base.
+func stridedAddrs(base, stride usermem.Addr, n int) []usermem.Addr {
+	addrs := make([]usermem.Addr, n)
+	for i := range addrs {
+		addrs[i] = base + usermem.Addr(i)*stride
+	}
+	return addrs
+}
+
+func TestDetectorStridedProbing(t *testing.T) {
+	d := NewDetector()
+	o := Observation{
+		References: 10000,
+		Misses:     9000,
+		Addrs:      stridedAddrs(0x10000, 0x2000, 16),
+	}
+	if !d.Observe(o) {
+		t.Fatalf("Observe(%+v) = false, want true", o)
+	}
+	if !d.Suspected() {
+		t.Errorf("Suspected() = false after a probing observation")
+	}
+}
+
+func TestDetectorPeriodicProbing(t *testing.T) {
+	d := NewDetector()
+	var suspected bool
+	for i := 0; i < detectorHistory; i++ {
+		misses := uint64(5000)
+		if i%2 == 0 {
+			misses = 20000
+		}
+		suspected = d.Observe(Observation{References: misses + 1000, Misses: misses})
+	}
+	if !suspected {
+		t.Errorf("alternating high miss counts were not detected")
+	}
+}
+
+func TestDetectorRegularWorkload(t *testing.T) {
+	d := NewDetector()
+	for i := 0; i < 2*detectorHistory; i++ {
+		// Few misses, scattered accesses.
+		o := Observation{
+			References: 100000,
+			Misses:     uint64(1000 + 37*i%500),
+			Addrs:      []usermem.Addr{0x1000, 0x5000, 0x6000, 0x20000, 0x21000, 0x90000, 0x91000, 0x100000},
+		}
+		if d.Observe(o) {
+			t.Fatalf("observation %d: Observe(%+v) = true, want false", i, o)
+		}
+	}
+}
+
+func TestDetectorHold(t *testing.T) {
+	d := NewDetector()
+	d.Observe(Observation{References: 10000, Misses: 9000, Addrs: stridedAddrs(0, usermem.PageSize, 16)})
+	quiet := Observation{References: 100000, Misses: 10}
+	for i := 0; i < suspectHold-1; i++ {
+		if !d.Observe(quiet) {
+			t.Fatalf("suspicion lifted after %d quiet observations, want %d", i+1, suspectHold)
+		}
+	}
+	if d.Observe(quiet) {
+		t.Errorf("suspicion not lifted after %d quiet observations", suspectHold)
+	}
+}
+
+func TestStrided(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		addrs []usermem.Addr
+		want  bool
+	}{
+		{"too few", stridedAddrs(0, 0x1000, minStrideAddrs-1), false},
+		{"uniform", stridedAddrs(0, 0x1000, minStrideAddrs), true},
+		{"unsorted", []usermem.Addr{0x7000, 0x1000, 0x3000, 0x0, 0x5000, 0x2000, 0x6000, 0x4000}, true},
+		{"scattered", []usermem.Addr{0x0, 0x1000, 0x5000, 0x6000, 0x10000, 0x13000, 0x30000, 0x31000}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := strided(tc.addrs); got != tc.want {
+				t.Errorf("strided(%v) = %t, want %t", tc.addrs, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package maid implements the memory access jitter engine of the sentry: it
+// delays application accesses to a set of target pages, chosen by a monitor
+// outside the sandbox, to blur the timing signal of cache side channels.
+//
+// The monitor normally drives the engine over the socket handed to the
+// sentry at boot, with the messages of protocol.go. Embedders of the sentry
+// and test harnesses can drive it directly with an Engine instead.
+package maid
+
+import (
+	"errors"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Engine drives the jitter engine of the sentry programmatically. The engine
+// state is global to the sentry, so there must be at most one Engine, and it
+// must not be used while a monitor is connected.
+type Engine struct {
+	// wait is how the windows the engine opens wait out their delays.
+	wait WaitMode
+}
+
+// engineOptions are the settings of an Engine.
+type engineOptions struct {
+	primitive      DelayPrimitive
+	scope          DelayScope
+	wait           WaitMode
+	deferHolders   bool
+	splitHugePages bool
+	decoyMode      DecoyMode
+	decoyAddrs     []usermem.Addr
+	decoyInterval  time.Duration
+	preempt        time.Duration
+	syscallDelay   time.Duration
+	delayBudget    time.Duration
+	translator     AddrTranslator
+	validator      AddrValidator
+}
+
+// Option configures an Engine.
+type Option func(*engineOptions)
+
+// WithDelayPrimitive sets how target accesses are delayed. The default is
+// DelayTrap.
+func WithDelayPrimitive(p DelayPrimitive) Option {
+	return func(o *engineOptions) { o.primitive = p }
+}
+
+// WithDelayScope sets which tasks are delayed. The default is DelaySandbox.
+func WithDelayScope(s DelayScope) Option {
+	return func(o *engineOptions) { o.scope = s }
+}
+
+// WithWaitMode sets how the delays of the windows the engine opens are waited
+// out. The default is WaitSleep.
+func WithWaitMode(m WaitMode) Option {
+	return func(o *engineOptions) { o.wait = m }
+}
+
+// WithDeferLockHolders sets whether the delays of tasks holding a contended
+// lock are deferred until they release it. See SetDeferLockHolders.
+func WithDeferLockHolders(enabled bool) Option {
+	return func(o *engineOptions) { o.deferHolders = enabled }
+}
+
+// WithSplitHugePages sets whether huge pages backing targets are split so
+// that only the target page is protected.
+func WithSplitHugePages(split bool) Option {
+	return func(o *engineOptions) { o.splitHugePages = split }
+}
+
+// WithDecoys sets the decoy pages delayed alongside the targets. See
+// SetDecoys.
+func WithDecoys(mode DecoyMode, addrs []usermem.Addr, interval time.Duration) Option {
+	return func(o *engineOptions) {
+		o.decoyMode = mode
+		o.decoyAddrs = addrs
+		o.decoyInterval = interval
+	}
+}
+
+// WithPreemptInterval sets the bound of the random preemptions injected
+// during delay windows. 0, the default, disables them.
+func WithPreemptInterval(max time.Duration) Option {
+	return func(o *engineOptions) { o.preempt = max }
+}
+
+// WithSyscallDelay sets the bound of the random delay injected into system
+// calls during delay windows. 0, the default, disables it.
+func WithSyscallDelay(max time.Duration) Option {
+	return func(o *engineOptions) { o.syscallDelay = max }
+}
+
+// WithDelayBudget sets the ceiling on the time the sandbox is delayed per
+// second. 0, the default, disables it. See SetDelayBudget.
+func WithDelayBudget(perSecond time.Duration) Option {
+	return func(o *engineOptions) { o.delayBudget = perSecond }
+}
+
+// WithAddrTranslator sets the translator applied to targets. nil, the
+// default, leaves targets unchanged.
+func WithAddrTranslator(t AddrTranslator) Option {
+	return func(o *engineOptions) { o.translator = t }
+}
+
+// WithAddrValidator sets the validator translated targets must pass. nil,
+// the default, accepts all targets.
+func WithAddrValidator(v AddrValidator) Option {
+	return func(o *engineOptions) { o.validator = v }
+}
+
+// NewEngine configures the jitter engine with opts and returns it. Settings
+// without an option are reset to their default.
+func NewEngine(opts ...Option) *Engine {
+	o := engineOptions{
+		primitive: DelayTrap,
+		scope:     DelaySandbox,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	SetDelayPrimitive(o.primitive)
+	SetDelayScope(o.scope)
+	SetDeferLockHolders(o.deferHolders)
+	SetSplitHugePages(o.splitHugePages)
+	SetDecoys(o.decoyMode, o.decoyAddrs, o.decoyInterval)
+	SetPreemptInterval(o.preempt)
+	SetSyscallDelay(o.syscallDelay)
+	SetDelayBudget(o.delayBudget)
+	SetAddrTranslator(o.translator)
+	SetAddrValidator(o.validator)
+	return &Engine{wait: o.wait}
+}
+
+// Start opens a delay window on targets, the first of which is the primary
+// target. It replaces the targets of any window already open.
+func (e *Engine) Start(targets []Target) error {
+	m := NewStartBatchMessage(targets)
+	m.Wait = e.wait
+	return send(m)
+}
+
+// Stop closes the delay window and returns its primary target, together with
+// the number of delayed accesses observed on it. It is a no-op if no window
+// is open.
+func (*Engine) Stop() (usermem.Addr, uint64) {
+	ack := Listen_target_addrs(NewStopMessage())
+	return ack.Addr, ack.Hits
+}
+
+// SetTargets replaces the targets of the delay window without changing its
+// primary target. Delays go on with the previous targets until the new ones
+// are all in.
+func (*Engine) SetTargets(targets []Target) error {
+	if len(targets) == 0 {
+		return send(NewUpdateTargetsMessage(nil))
+	}
+	for _, m := range NewTargetSetMessages(targets) {
+		if err := send(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Active returns true if a delay window is open.
+func (*Engine) Active() bool {
+	return WindowOpen()
+}
+
+// Stats returns the delay statistics since the sentry started.
+func (*Engine) Stats() Stats {
+	return CurrentStats()
+}
+
+// send applies m as if it came from the monitor, which keeps the validation
+// and bookkeeping of both paths identical.
+func send(m *Message) error {
+	if ack := Listen_target_addrs(m); ack.Err != "" {
+		return errors.New(ack.Err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestEngineOptions(t *testing.T) {
+	e := NewEngine(WithDelayPrimitive(DelaySleep), WithDelayScope(DelayTask), WithWaitMode(WaitSpin), WithDeferLockHolders(true), WithPreemptInterval(time.Millisecond))
+	if got := CurrentDelayPrimitive(); got != DelaySleep {
+		t.Errorf("delay primitive is %v, want %v", got, DelaySleep)
+	}
+	if got := CurrentDelayScope(); got != DelayTask {
+		t.Errorf("delay scope is %v, want %v", got, DelayTask)
+	}
+	if err := e.Start([]Target{{Addr: 0x1000, Accesses: 1}}); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	if got := CurrentWaitMode(); got != WaitSpin {
+		t.Errorf("wait mode of the window is %v, want %v", got, WaitSpin)
+	}
+	e.Stop()
+	if !DeferLockHolders() {
+		t.Errorf("lock holders not deferred")
+	}
+	if got := PreemptInterval(); got != time.Millisecond {
+		t.Errorf("preempt interval is %v, want 1ms", got)
+	}
+
+	// Settings without an option go back to their default.
+	e = NewEngine()
+	if got := CurrentDelayPrimitive(); got != DelayTrap {
+		t.Errorf("delay primitive is %v, want %v", got, DelayTrap)
+	}
+	if got := CurrentDelayScope(); got != DelaySandbox {
+		t.Errorf("delay scope is %v, want %v", got, DelaySandbox)
+	}
+	if err := e.Start([]Target{{Addr: 0x1000, Accesses: 1}}); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	if got := CurrentWaitMode(); got != WaitSleep {
+		t.Errorf("wait mode of the window is %v, want %v", got, WaitSleep)
+	}
+	e.Stop()
+	if DeferLockHolders() {
+		t.Errorf("lock holders still deferred")
+	}
+	if got := PreemptInterval(); got != 0 {
+		t.Errorf("preempt interval is %v, want 0", got)
+	}
+}
+
+func TestEngineWindow(t *testing.T) {
+	e := NewEngine()
+	before := e.Stats()
+
+	if err := e.Start([]Target{{Addr: 0x1000, Accesses: 10}, {Addr: 0x2000, Accesses: 5}}); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	if !e.Active() {
+		t.Errorf("Active() = false after Start()")
+	}
+	if err := e.SetTargets([]Target{{Addr: 0x3000, Accesses: 1}}); err != nil {
+		t.Fatalf("SetTargets() failed: %v", err)
+	}
+	TAddrs.Lock()
+	_, ok := TAddrs.Addrs[0x3000]
+	n := len(TAddrs.Addrs)
+	TAddrs.Unlock()
+	if !ok || n != 1 {
+		t.Errorf("targets after SetTargets() don't match the new set")
+	}
+	RecordDelayedAccess(0x1000)
+
+	addr, hits := e.Stop()
+	if addr != 0x1000 || hits != 1 {
+		t.Errorf("Stop() = %#x, %d, want 0x1000, 1", addr, hits)
+	}
+	if e.Active() {
+		t.Errorf("Active() = true after Stop()")
+	}
+	if got := e.Stats().Windows - before.Windows; got != 1 {
+		t.Errorf("Stats() counted %d windows, want 1", got)
+	}
+}
+
+func TestEngineRejectsInvalidTargets(t *testing.T) {
+	e := NewEngine()
+	for _, targets := range [][]Target{
+		nil,
+		{{Addr: 0x1234, Accesses: 1}},
+		{{Addr: 0x1000, Accesses: 0}},
+		{{Addr: 0x1000, Accesses: 1}, {Addr: 0x1000, Accesses: 2}},
+	} {
+		if err := e.Start(targets); err == nil {
+			t.Errorf("Start(%+v) succeeded, want error", targets)
+		}
+	}
+	if e.Active() {
+		t.Errorf("Active() = true after rejected starts")
+	}
+}
+
+func TestEngineTranslator(t *testing.T) {
+	e := NewEngine(WithAddrTranslator(func(addr usermem.Addr) (usermem.Addr, bool) {
+		return 0, false
+	}))
+	defer NewEngine()
+	if err := e.Start([]Target{{Addr: 0x1000, Accesses: 1}}); err == nil {
+		t.Errorf("Start() succeeded with no translatable target, want error")
+	}
+}
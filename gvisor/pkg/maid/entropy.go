@@ -0,0 +1,185 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// MaxIntensity is the largest intensity of a delay window: its delays are at
+// most that many times as long as usual.
+const MaxIntensity = 16
+
+// EntropyMappingKind is the shape of an EntropyMapping.
+type EntropyMappingKind int32
+
+const (
+	// EntropyOff delays every window with the usual intensity, 1.
+	EntropyOff EntropyMappingKind = iota
+
+	// EntropyLinear interpolates linearly from Max at entropy 0 to Min at
+	// entropy 1.
+	EntropyLinear
+
+	// EntropyExp interpolates geometrically from Max at entropy 0 to Min at
+	// entropy 1, so that the intensity falls off quickly once accesses
+	// spread.
+	EntropyExp
+
+	// EntropyStep delays with Max below entropy Step, and with Min at or
+	// above it.
+	EntropyStep
+)
+
+// String implements fmt.Stringer.
+func (k EntropyMappingKind) String() string {
+	switch k {
+	case EntropyOff:
+		return "off"
+	case EntropyLinear:
+		return "linear"
+	case EntropyExp:
+		return "exp"
+	case EntropyStep:
+		return "step"
+	default:
+		return fmt.Sprintf("unknown(%d)", k)
+	}
+}
+
+// EntropyMapping maps the entropy of the sample a delay window is opened on
+// to the intensity of its delays. Accesses concentrated on few pages, a low
+// entropy, are typical of the phases that leak, e.g. table lookups keyed by
+// a secret, so they are delayed harder; accesses spread over many pages are
+// delayed lighter.
+type EntropyMapping struct {
+	Kind EntropyMappingKind
+
+	// Min is the intensity at entropy 1, accesses spread evenly over the
+	// sampled pages, and Max the intensity at entropy 0, all accesses on a
+	// single page.
+	Min float64
+	Max float64
+
+	// Step is the entropy below which EntropyStep delays with Max.
+	Step float64
+}
+
+// DefaultEntropyMapping is the mapping of each kind unless set otherwise:
+// from half to twice the usual delays, with a step halfway.
+var DefaultEntropyMapping = EntropyMapping{Min: 0.5, Max: 2, Step: 0.5}
+
+// Validate checks that m is well formed.
+func (m EntropyMapping) Validate() error {
+	switch m.Kind {
+	case EntropyOff:
+		return nil
+	case EntropyLinear, EntropyExp, EntropyStep:
+	default:
+		return fmt.Errorf("unknown entropy mapping %v", m.Kind)
+	}
+	if !(m.Min > 0 && m.Min <= m.Max && m.Max <= MaxIntensity) {
+		return fmt.Errorf("entropy mapping intensities must satisfy 0 < min <= max <= %d, got min %v, max %v", MaxIntensity, m.Min, m.Max)
+	}
+	if !(m.Step >= 0 && m.Step <= 1) {
+		return fmt.Errorf("entropy mapping step must be in [0, 1], got %v", m.Step)
+	}
+	return nil
+}
+
+// Intensity returns the intensity of the delays of a window opened on a
+// sample of entropy e, in [0, 1].
+func (m EntropyMapping) Intensity(e float64) float64 {
+	e = math.Max(0, math.Min(1, e))
+	switch m.Kind {
+	case EntropyLinear:
+		return m.Max - (m.Max-m.Min)*e
+	case EntropyExp:
+		return m.Max * math.Pow(m.Min/m.Max, e)
+	case EntropyStep:
+		if e < m.Step {
+			return m.Max
+		}
+		return m.Min
+	default:
+		return 1
+	}
+}
+
+// SampleEntropy returns the Shannon entropy of the accesses of batch over its
+// pages, normalized to [0, 1] by the entropy of accesses spread evenly over
+// them. A batch of a single page has entropy 0.
+func SampleEntropy(batch []Target) float64 {
+	total, n := 0, 0
+	for _, t := range batch {
+		if t.Accesses > 0 {
+			total += t.Accesses
+			n++
+		}
+	}
+	if n < 2 {
+		return 0
+	}
+	var h float64
+	for _, t := range batch {
+		if t.Accesses > 0 {
+			p := float64(t.Accesses) / float64(total)
+			h -= p * math.Log(p)
+		}
+	}
+	return h / math.Log(float64(n))
+}
+
+// WindowIntensity returns the intensity of a window opened on the sample
+// batch with the mapping m, 0 for the usual delays.
+func WindowIntensity(m EntropyMapping, batch []Target) float64 {
+	if m.Kind == EntropyOff {
+		return 0
+	}
+	return m.Intensity(SampleEntropy(batch))
+}
+
+// entropyMapping is the mapping of the windows the sentry schedules.
+var entropyMapping struct {
+	mu sync.Mutex
+	m  EntropyMapping
+}
+
+// SetEntropyMapping sets the mapping of the delay windows the sentry
+// schedules itself. m must be valid.
+func SetEntropyMapping(m EntropyMapping) {
+	entropyMapping.mu.Lock()
+	entropyMapping.m = m
+	entropyMapping.mu.Unlock()
+}
+
+// CurrentEntropyMapping returns the mapping of the delay windows the sentry
+// schedules itself.
+func CurrentEntropyMapping() EntropyMapping {
+	entropyMapping.mu.Lock()
+	defer entropyMapping.mu.Unlock()
+	return entropyMapping.m
+}
+
+// scaleDelay returns the delay d, in microseconds, of a window of intensity
+// i, 0 for the usual delays.
+func scaleDelay(d int, i float64) int {
+	if i == 0 {
+		return d
+	}
+	return int(float64(d) * i)
+}
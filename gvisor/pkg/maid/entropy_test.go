@@ -0,0 +1,115 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSampleEntropy(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		batch []Target
+		want  float64
+	}{
+		{name: "empty", want: 0},
+		{name: "single page", batch: []Target{{Addr: 0x1000, Accesses: 100}}, want: 0},
+		{name: "even", batch: []Target{{Addr: 0x1000, Accesses: 10}, {Addr: 0x2000, Accesses: 10}, {Addr: 0x3000, Accesses: 10}}, want: 1},
+		{name: "skewed", batch: []Target{{Addr: 0x1000, Accesses: 3}, {Addr: 0x2000, Accesses: 1}}, want: 0.8113},
+	} {
+		if got := SampleEntropy(tc.batch); math.Abs(got-tc.want) > 1e-4 {
+			t.Errorf("%s: SampleEntropy() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEntropyMapping(t *testing.T) {
+	for _, tc := range []struct {
+		kind EntropyMappingKind
+		e    float64
+		want float64
+	}{
+		{kind: EntropyOff, e: 0, want: 1},
+		{kind: EntropyLinear, e: 0, want: 2},
+		{kind: EntropyLinear, e: 1, want: 0.5},
+		{kind: EntropyLinear, e: 0.5, want: 1.25},
+		{kind: EntropyExp, e: 0.5, want: 1},
+		{kind: EntropyStep, e: 0.4, want: 2},
+		{kind: EntropyStep, e: 0.5, want: 0.5},
+	} {
+		m := DefaultEntropyMapping
+		m.Kind = tc.kind
+		if got := m.Intensity(tc.e); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%v.Intensity(%v) = %v, want %v", tc.kind, tc.e, got, tc.want)
+		}
+	}
+}
+
+func TestEntropyMappingValidate(t *testing.T) {
+	for _, tc := range []struct {
+		m  EntropyMapping
+		ok bool
+	}{
+		{m: EntropyMapping{}, ok: true},
+		{m: EntropyMapping{Kind: EntropyLinear, Min: 0.5, Max: 2}, ok: true},
+		{m: EntropyMapping{Kind: EntropyLinear, Min: 0, Max: 2}},
+		{m: EntropyMapping{Kind: EntropyLinear, Min: 2, Max: 1}},
+		{m: EntropyMapping{Kind: EntropyExp, Min: 1, Max: MaxIntensity + 1}},
+		{m: EntropyMapping{Kind: EntropyStep, Min: 1, Max: 2, Step: 1.5}},
+		{m: EntropyMapping{Kind: 42, Min: 1, Max: 2}},
+	} {
+		if err := tc.m.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%+v.Validate() = %v, want ok %t", tc.m, err, tc.ok)
+		}
+	}
+}
+
+func TestStartIntensity(t *testing.T) {
+	msg := NewStartMessage(0x5000, 10)
+	if ack := Listen_target_addrs(msg); ack.Err != "" {
+		t.Fatalf("Start rejected: %s", ack.Err)
+	}
+	TAddr.Lock()
+	usual := TAddr.SleepTime
+	TAddr.Unlock()
+	stopDelay()
+
+	msg = NewStartMessage(0x5000, 10)
+	msg.Intensity = 2
+	if ack := Listen_target_addrs(msg); ack.Err != "" {
+		t.Fatalf("Start rejected: %s", ack.Err)
+	}
+	defer stopDelay()
+	TAddr.Lock()
+	got := TAddr.SleepTime
+	TAddr.Unlock()
+	if got != 2*usual {
+		t.Errorf("sleep time of a window of intensity 2 is %d, want %d", got, 2*usual)
+	}
+
+	for _, i := range []float64{-1, MaxIntensity + 1} {
+		msg = NewStartMessage(0x5000, 10)
+		msg.Intensity = i
+		if err := msg.Validate(); err == nil {
+			t.Errorf("Start message of intensity %v validated", i)
+		}
+	}
+	msg = NewStopMessage()
+	msg.Intensity = 1
+	if err := msg.Validate(); err == nil {
+		t.Errorf("Stop message with an intensity validated")
+	}
+}
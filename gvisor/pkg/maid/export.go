@@ -0,0 +1,102 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// TraceCSVColumns are the columns written by ExportTraceCSV. They are a stable
+// schema: columns are only ever added at the end.
+//
+// Every target of a record is a row, so that the trace loads as a flat table;
+// records without targets are a single row with empty target columns. cycle
+// numbers the sampling cycles, a decision belongs to the cycle of the sample
+// before it. rank is the position of the target in its record, 0 being the
+// hottest or primary one.
+var TraceCSVColumns = []string{
+	"time",
+	"cycle",
+	"event",
+	"delay",
+	"addr",
+	"reason",
+	"rank",
+	"target",
+	"accesses",
+	"symbol",
+}
+
+// ExportTraceCSV writes the trace read from r to w as CSV, with a header row of
+// TraceCSVColumns. It returns the number of records exported.
+func ExportTraceCSV(r *TraceReader, w io.Writer) (int, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(TraceCSVColumns); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	cycle := 0
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, fmt.Errorf("reading record %d: %v", n+1, err)
+		}
+		if rec.Event == TraceSample {
+			cycle++
+		}
+		common := []string{
+			rec.Time.UTC().Format(time.RFC3339Nano),
+			strconv.Itoa(cycle),
+			string(rec.Event),
+			strconv.FormatBool(rec.Delay),
+			formatAddr(uint64(rec.Addr)),
+			rec.Reason,
+		}
+		if len(rec.Targets) == 0 {
+			if err := cw.Write(append(common, "", "", "", "")); err != nil {
+				return n, err
+			}
+		}
+		for i, t := range rec.Targets {
+			symbol := ""
+			if i < len(rec.Symbols) {
+				symbol = rec.Symbols[i]
+			}
+			row := append(append([]string(nil), common...), strconv.Itoa(i), formatAddr(uint64(t.Addr)), strconv.Itoa(t.Accesses), symbol)
+			if err := cw.Write(row); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// formatAddr formats addr in hex, or as "" if it is zero.
+func formatAddr(addr uint64) string {
+	if addr == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%#x", addr)
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestExportTraceCSV(t *testing.T) {
+	var trace bytes.Buffer
+	w := NewTraceWriter(&trace)
+	for _, r := range []TraceRecord{
+		{
+			Time:    time.Unix(1, 0),
+			Event:   TraceSample,
+			Targets: []Target{{Addr: 0x1234, Accesses: 10}, {Addr: 0x5000, Accesses: 3}},
+		},
+		{
+			Time:    time.Unix(2, 0),
+			Event:   TraceDecision,
+			Delay:   true,
+			Addr:    0x1000,
+			Reason:  "hot",
+			Targets: []Target{{Addr: 0x1000, Accesses: 10}},
+			Symbols: []string{"AES_encrypt+0x20"},
+		},
+		{
+			Time:   time.Unix(3, 0),
+			Event:  TraceDecision,
+			Reason: "strip",
+		},
+	} {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("Write(%+v) failed: %v", r, err)
+		}
+	}
+
+	var out bytes.Buffer
+	n, err := ExportTraceCSV(NewTraceReader(&trace), &out)
+	if err != nil {
+		t.Fatalf("ExportTraceCSV() failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("ExportTraceCSV() exported %d records, want 3", n)
+	}
+	want := `time,cycle,event,delay,addr,reason,rank,target,accesses,symbol
+1970-01-01T00:00:01Z,1,sample,false,,,0,0x1234,10,
+1970-01-01T00:00:01Z,1,sample,false,,,1,0x5000,3,
+1970-01-01T00:00:02Z,1,decision,true,0x1000,hot,0,0x1000,10,AES_encrypt+0x20
+1970-01-01T00:00:03Z,1,decision,false,,strip,,,,
+`
+	if got := out.String(); got != want {
+		t.Errorf("ExportTraceCSV() wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
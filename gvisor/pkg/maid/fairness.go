@@ -0,0 +1,51 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import "time"
+
+// fairSlack is the time left at the end of each turn, after the delay
+// window, for the monitor to stop it before the next sandbox's turn.
+const fairSlack = 250 * time.Millisecond
+
+// FairSlot returns the length of the turn of a sandbox when delay windows
+// lasting window are scheduled round-robin between several sandboxes.
+func FairSlot(window time.Duration) time.Duration {
+	return window + fairSlack
+}
+
+// NextTurn returns the earliest time from now at which member index of
+// members may open a delay window lasting window, when windows take turns in
+// slots of FairSlot(window). Slots are aligned on the Unix epoch, so that
+// processes agree on whose turn it is without talking to each other, and slot
+// k belongs to member k mod members. It returns now if the slot at now is the
+// member's and there is a whole window left in it.
+func NextTurn(now time.Time, window time.Duration, index, members int) time.Time {
+	if members <= 1 || window <= 0 {
+		return now
+	}
+	slot := FairSlot(window)
+	n := int64(members)
+	k := now.UnixNano() / int64(slot)
+	start := time.Unix(0, k*int64(slot))
+	if k%n == int64(index) && now.Sub(start) < slot-window {
+		return now
+	}
+	wait := (int64(index) - k%n + n) % n
+	if wait == 0 {
+		wait = n
+	}
+	return start.Add(time.Duration(wait) * slot)
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextTurnAlone(t *testing.T) {
+	now := time.Unix(1000, 123)
+	if got := NextTurn(now, DelayWindow, 0, 1); !got.Equal(now) {
+		t.Errorf("NextTurn() = %v for a single member, want now %v", got, now)
+	}
+}
+
+func TestNextTurnRoundRobin(t *testing.T) {
+	const members = 3
+	slot := FairSlot(DelayWindow)
+	// Start of a slot belonging to member 0.
+	base := time.Unix(0, (1000/int64(members))*int64(members)*int64(slot))
+	now := base.Add(time.Millisecond)
+
+	for index := 0; index < members; index++ {
+		got := NextTurn(now, DelayWindow, index, members)
+		want := base.Add(time.Duration(index) * slot)
+		if index == 0 {
+			want = now
+		}
+		if !got.Equal(want) {
+			t.Errorf("NextTurn(member %d) = %v, want %v", index, got, want)
+		}
+	}
+
+	// Too late in its own slot for a whole window, member 0 waits for
+	// the next round.
+	late := base.Add(slot - DelayWindow + time.Millisecond)
+	if got, want := NextTurn(late, DelayWindow, 0, members), base.Add(members*slot); !got.Equal(want) {
+		t.Errorf("NextTurn(late) = %v, want %v", got, want)
+	}
+}
+
+func TestNextTurnWindow(t *testing.T) {
+	// Shorter windows take shorter turns.
+	window := 100 * time.Millisecond
+	slot := FairSlot(window)
+	base := time.Unix(0, 1000*int64(slot))
+	if got, want := NextTurn(base, window, 1, 2), base.Add(slot); !got.Equal(want) {
+		t.Errorf("NextTurn() = %v, want %v", got, want)
+	}
+}
+
+func TestNextTurnDisjoint(t *testing.T) {
+	const members = 4
+	slot := FairSlot(DelayWindow)
+	now := time.Unix(12345, 6789)
+	seen := make(map[int64]int)
+	for index := 0; index < members; index++ {
+		turn := NextTurn(now, DelayWindow, index, members)
+		if turn.Before(now) {
+			t.Errorf("NextTurn(member %d) = %v, before now %v", index, turn, now)
+		}
+		k := turn.UnixNano() / int64(slot)
+		if other, ok := seen[k]; ok {
+			t.Errorf("members %d and %d share slot %d", other, index, k)
+		}
+		seen[k] = index
+		if end := time.Unix(0, (k+1)*int64(slot)); turn.Add(DelayWindow).After(end) {
+			t.Errorf("window of member %d at %v overruns its slot ending at %v", index, turn, end)
+		}
+	}
+}
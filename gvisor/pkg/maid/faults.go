@@ -0,0 +1,88 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// The sentry-native sampler counts the application page faults the sentry
+// handles. Between samples, the sampler unmaps the application from the
+// platform address space so that every page touched faults again once,
+// which makes the fault counts of a sample the pages touched during it.
+// They are of page granularity and count each page at most once per re-arm,
+// but need neither perf events nor a kernel module.
+
+// faultCounts are the application page faults counted during the current
+// sample.
+var faultCounts struct {
+	// counting is 1 while faults are counted. It is accessed atomically,
+	// so that faults outside samples only cost a load.
+	counting uint32
+
+	mu    sync.Mutex
+	pages map[usermem.Addr]int
+}
+
+// StartFaultCount starts counting application page faults, forgetting those
+// of the previous sample.
+func StartFaultCount() {
+	faultCounts.mu.Lock()
+	faultCounts.pages = make(map[usermem.Addr]int)
+	faultCounts.mu.Unlock()
+	atomic.StoreUint32(&faultCounts.counting, 1)
+}
+
+// CountFault counts an application page fault at addr, if faults are being
+// counted.
+func CountFault(addr usermem.Addr) {
+	if atomic.LoadUint32(&faultCounts.counting) == 0 {
+		return
+	}
+	faultCounts.mu.Lock()
+	if faultCounts.pages != nil {
+		faultCounts.pages[addr.RoundDown()]++
+	}
+	faultCounts.mu.Unlock()
+}
+
+// StopFaultCount stops counting application page faults and returns the n
+// pages that faulted most, most first.
+func StopFaultCount(n int) []Target {
+	atomic.StoreUint32(&faultCounts.counting, 0)
+	faultCounts.mu.Lock()
+	pages := faultCounts.pages
+	faultCounts.pages = nil
+	faultCounts.mu.Unlock()
+
+	batch := make([]Target, 0, len(pages))
+	for page, count := range pages {
+		batch = append(batch, Target{Addr: page, Accesses: count})
+	}
+	sort.Slice(batch, func(i, j int) bool {
+		if batch[i].Accesses != batch[j].Accesses {
+			return batch[i].Accesses > batch[j].Accesses
+		}
+		return batch[i].Addr < batch[j].Addr
+	})
+	if len(batch) > n {
+		batch = batch[:n]
+	}
+	return batch
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestFaultCountHottestFirst(t *testing.T) {
+	StartFaultCount()
+	for i, addr := range []usermem.Addr{0x1010, 0x3000, 0x1fff, 0x2000, 0x3004, 0x1000} {
+		CountFault(addr)
+		if i == 0 {
+			// Counted once per page.
+			CountFault(0x5000)
+		}
+	}
+	got := StopFaultCount(2)
+	want := []Target{{Addr: 0x1000, Accesses: 3}, {Addr: 0x3000, Accesses: 2}}
+	if len(got) != len(want) {
+		t.Fatalf("StopFaultCount(2) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("StopFaultCount(2)[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFaultCountOnlyWhileCounting(t *testing.T) {
+	CountFault(0x1000)
+	StartFaultCount()
+	CountFault(0x2000)
+	if got := StopFaultCount(8); len(got) != 1 || got[0].Addr != 0x2000 {
+		t.Errorf("StopFaultCount(8) = %v, want only 0x2000", got)
+	}
+	CountFault(0x3000)
+	StartFaultCount()
+	if got := StopFaultCount(8); len(got) != 0 {
+		t.Errorf("StopFaultCount(8) = %v, want no faults from before the sample", got)
+	}
+}
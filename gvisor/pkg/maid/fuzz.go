@@ -0,0 +1,56 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build gofuzz
+
+package maid
+
+import (
+	"fmt"
+)
+
+// Fuzz targets for go-fuzz, e.g.:
+//
+//   go-fuzz-build -func FuzzDecode gvisor.dev/gvisor/pkg/maid
+//   go-fuzz -bin maid-fuzz.zip -workdir corpus
+//
+// Inputs that crash can be injected into a running sandbox with
+// "runsc jitter-inject".
+
+// FuzzDecode decodes data as a stream of messages from the monitor and applies
+// them as the sentry does.
+func FuzzDecode(data []byte) int {
+	res := Inject(data)
+	Listen_target_addrs(NewClearMessage())
+	if res.Applied == 0 {
+		return 0
+	}
+	return 1
+}
+
+// FuzzTarget parses data as a sampled target address, as the monitor does
+// with the output of the sampler.
+func FuzzTarget(data []byte) int {
+	addr, err := Hex2addr(string(data))
+	if err != nil {
+		return 0
+	}
+	if addr != addr.RoundDown() {
+		panic(fmt.Sprintf("Hex2addr(%q) = %#x is not page aligned", data, addr))
+	}
+	if err := NewStartMessage(addr, 1).Validate(); err != nil {
+		return 0
+	}
+	return 1
+}
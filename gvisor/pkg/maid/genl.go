@@ -0,0 +1,256 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Generic netlink interface of the daptrace kernel module, as defined in
+// daptrace.c.
+const (
+	// DaptraceGenlName is the name of the generic netlink family.
+	DaptraceGenlName = "daptrace"
+
+	// DaptraceGenlVersion is the version of the family.
+	DaptraceGenlVersion = 1
+)
+
+// Commands of the daptrace family.
+const (
+	DaptraceCmdGetVersion uint8 = 1 + iota
+	DaptraceCmdSetPids
+	DaptraceCmdSetTracing
+	DaptraceCmdSubscribe
+	DaptraceCmdSamples
+)
+
+// Attributes of the daptrace family.
+const (
+	DaptraceAttrVersion uint16 = 1 + iota
+	DaptraceAttrPids
+	DaptraceAttrTracingOn
+	DaptraceAttrEpoch
+	DaptraceAttrRecords
+)
+
+// Generic netlink controller, which resolves family names to IDs.
+const (
+	genlIDCtrl             = 0x10
+	genlCtrlCmdGetFamily   = 3
+	genlCtrlVersion        = 1
+	genlCtrlAttrFamilyID   = 1
+	genlCtrlAttrFamilyName = 2
+)
+
+// genlHeaderSize is the size of struct genlmsghdr.
+const genlHeaderSize = 4
+
+// netlinkAlign rounds n up to the netlink alignment.
+func netlinkAlign(n int) int {
+	return (n + syscall.NLMSG_ALIGNTO - 1) &^ (syscall.NLMSG_ALIGNTO - 1)
+}
+
+// NetlinkAttr is a netlink attribute.
+type NetlinkAttr struct {
+	Type uint16
+	Data []byte
+}
+
+// U8Attr returns an attribute holding v.
+func U8Attr(typ uint16, v uint8) NetlinkAttr {
+	return NetlinkAttr{Type: typ, Data: []byte{v}}
+}
+
+// U32ArrayAttr returns an attribute holding vs.
+func U32ArrayAttr(typ uint16, vs []uint32) NetlinkAttr {
+	data := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		usermem.ByteOrder.PutUint32(data[4*i:], v)
+	}
+	return NetlinkAttr{Type: typ, Data: data}
+}
+
+// EncodeGenlRequest returns the generic netlink request cmd to family, with
+// attrs. The kernel acks it.
+func EncodeGenlRequest(family uint16, cmd, version uint8, seq uint32, attrs ...NetlinkAttr) []byte {
+	size := syscall.NLMSG_HDRLEN + genlHeaderSize
+	for _, a := range attrs {
+		size += netlinkAlign(syscall.SizeofRtAttr + len(a.Data))
+	}
+	b := make([]byte, size)
+	usermem.ByteOrder.PutUint32(b[0:4], uint32(size))
+	usermem.ByteOrder.PutUint16(b[4:6], family)
+	usermem.ByteOrder.PutUint16(b[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	usermem.ByteOrder.PutUint32(b[8:12], seq)
+	b[syscall.NLMSG_HDRLEN] = cmd
+	b[syscall.NLMSG_HDRLEN+1] = version
+	off := syscall.NLMSG_HDRLEN + genlHeaderSize
+	for _, a := range attrs {
+		usermem.ByteOrder.PutUint16(b[off:], uint16(syscall.SizeofRtAttr+len(a.Data)))
+		usermem.ByteOrder.PutUint16(b[off+2:], a.Type)
+		copy(b[off+syscall.SizeofRtAttr:], a.Data)
+		off += netlinkAlign(syscall.SizeofRtAttr + len(a.Data))
+	}
+	return b
+}
+
+// EncodeGetFamilyRequest returns the request resolving the ID of the generic
+// netlink family name.
+func EncodeGetFamilyRequest(name string, seq uint32) []byte {
+	return EncodeGenlRequest(genlIDCtrl, genlCtrlCmdGetFamily, genlCtrlVersion, seq,
+		NetlinkAttr{Type: genlCtrlAttrFamilyName, Data: append([]byte(name), 0)})
+}
+
+// GenlMessage is a message received on a generic netlink socket.
+type GenlMessage struct {
+	// Type is the family of the message, or NLMSG_ERROR for acks.
+	Type uint16
+
+	// Seq is the sequence number of the request the message answers.
+	Seq uint32
+
+	// Cmd is the command of the message.
+	Cmd uint8
+
+	// Attrs are the attributes of the message, by type.
+	Attrs map[uint16][]byte
+
+	// Errno is the error of the request if the message is an ack, 0 if
+	// it succeeded.
+	Errno syscall.Errno
+}
+
+// IsAck returns whether m acks a request.
+func (m *GenlMessage) IsAck() bool {
+	return m.Type == syscall.NLMSG_ERROR
+}
+
+// ParseGenlMessages parses the messages of a datagram received on a generic
+// netlink socket.
+func ParseGenlMessages(b []byte) ([]GenlMessage, error) {
+	var msgs []GenlMessage
+	for len(b) >= syscall.NLMSG_HDRLEN {
+		size := int(usermem.ByteOrder.Uint32(b[0:4]))
+		if size < syscall.NLMSG_HDRLEN || size > len(b) {
+			return nil, fmt.Errorf("invalid netlink message length %d, %d bytes left", size, len(b))
+		}
+		m := GenlMessage{
+			Type: usermem.ByteOrder.Uint16(b[4:6]),
+			Seq:  usermem.ByteOrder.Uint32(b[8:12]),
+		}
+		payload := b[syscall.NLMSG_HDRLEN:size]
+		switch {
+		case m.Type == syscall.NLMSG_ERROR:
+			if len(payload) < 4 {
+				return nil, fmt.Errorf("short netlink ack")
+			}
+			m.Errno = syscall.Errno(-int32(usermem.ByteOrder.Uint32(payload[0:4])))
+		case m.Type == syscall.NLMSG_DONE || m.Type == syscall.NLMSG_NOOP:
+		default:
+			if len(payload) < genlHeaderSize {
+				return nil, fmt.Errorf("short generic netlink message")
+			}
+			m.Cmd = payload[0]
+			attrs, err := parseNetlinkAttrs(payload[genlHeaderSize:])
+			if err != nil {
+				return nil, err
+			}
+			m.Attrs = attrs
+		}
+		msgs = append(msgs, m)
+		if netlinkAlign(size) >= len(b) {
+			break
+		}
+		b = b[netlinkAlign(size):]
+	}
+	return msgs, nil
+}
+
+// parseNetlinkAttrs parses the attributes in b.
+func parseNetlinkAttrs(b []byte) (map[uint16][]byte, error) {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= syscall.SizeofRtAttr {
+		size := int(usermem.ByteOrder.Uint16(b[0:2]))
+		if size < syscall.SizeofRtAttr || size > len(b) {
+			return nil, fmt.Errorf("invalid netlink attribute length %d, %d bytes left", size, len(b))
+		}
+		// Drop the nested and byte order flags.
+		typ := usermem.ByteOrder.Uint16(b[2:4]) & 0x3fff
+		attrs[typ] = b[syscall.SizeofRtAttr:size]
+		if netlinkAlign(size) >= len(b) {
+			break
+		}
+		b = b[netlinkAlign(size):]
+	}
+	return attrs, nil
+}
+
+// FamilyID returns the family ID in the answer of EncodeGetFamilyRequest.
+func (m *GenlMessage) FamilyID() (uint16, error) {
+	id, ok := m.Attrs[genlCtrlAttrFamilyID]
+	if !ok || len(id) < 2 {
+		return 0, fmt.Errorf("no family ID in answer")
+	}
+	return usermem.ByteOrder.Uint16(id), nil
+}
+
+// U32 returns the value of the u32 attribute typ.
+func (m *GenlMessage) U32(typ uint16) (uint32, error) {
+	v, ok := m.Attrs[typ]
+	if !ok || len(v) < 4 {
+		return 0, fmt.Errorf("no attribute %d", typ)
+	}
+	return usermem.ByteOrder.Uint32(v), nil
+}
+
+// DaptraceRecord is an aggregated sample of the daptrace module, as struct
+// daptrace_record.
+type DaptraceRecord struct {
+	// Epoch is the aggregation the record belongs to.
+	Epoch uint64
+
+	// Addr is the sampled page.
+	Addr usermem.Addr
+
+	// Accesses is the number of accesses to the page.
+	Accesses uint64
+}
+
+// DaptraceRecordSize is the size of struct daptrace_record.
+const DaptraceRecordSize = 24
+
+// DaptraceRecords returns the records of a DaptraceCmdSamples event.
+func (m *GenlMessage) DaptraceRecords() ([]DaptraceRecord, error) {
+	data, ok := m.Attrs[DaptraceAttrRecords]
+	if !ok {
+		return nil, fmt.Errorf("no records in %s event", DaptraceGenlName)
+	}
+	if len(data)%DaptraceRecordSize != 0 {
+		return nil, fmt.Errorf("%s records of %d bytes, not a multiple of %d", DaptraceGenlName, len(data), DaptraceRecordSize)
+	}
+	records := make([]DaptraceRecord, 0, len(data)/DaptraceRecordSize)
+	for ; len(data) > 0; data = data[DaptraceRecordSize:] {
+		records = append(records, DaptraceRecord{
+			Epoch:    usermem.ByteOrder.Uint64(data[0:8]),
+			Addr:     usermem.Addr(usermem.ByteOrder.Uint64(data[8:16])),
+			Accesses: usermem.ByteOrder.Uint64(data[16:24]),
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bytes"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestGenlRequestRoundTrip(t *testing.T) {
+	b := EncodeGenlRequest(0x20, DaptraceCmdSetPids, DaptraceGenlVersion, 7,
+		U32ArrayAttr(DaptraceAttrPids, []uint32{10, 20, 30}),
+		U8Attr(DaptraceAttrTracingOn, 1))
+	if len(b)%syscall.NLMSG_ALIGNTO != 0 {
+		t.Errorf("request of %d bytes is not aligned", len(b))
+	}
+	if flags := usermem.ByteOrder.Uint16(b[6:8]); flags != syscall.NLM_F_REQUEST|syscall.NLM_F_ACK {
+		t.Errorf("request flags = %#x, want request and ack", flags)
+	}
+
+	msgs, err := ParseGenlMessages(b)
+	if err != nil {
+		t.Fatalf("ParseGenlMessages() failed: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("ParseGenlMessages() = %d messages, want 1", len(msgs))
+	}
+	m := msgs[0]
+	if m.Type != 0x20 || m.Seq != 7 || m.Cmd != DaptraceCmdSetPids || m.IsAck() {
+		t.Errorf("ParseGenlMessages() = %+v, want family 0x20, seq 7, cmd %d", m, DaptraceCmdSetPids)
+	}
+	if want := U32ArrayAttr(0, []uint32{10, 20, 30}).Data; !bytes.Equal(m.Attrs[DaptraceAttrPids], want) {
+		t.Errorf("pids attribute = %v, want %v", m.Attrs[DaptraceAttrPids], want)
+	}
+	// The one byte attribute is padded, the padding isn't part of it.
+	if got := m.Attrs[DaptraceAttrTracingOn]; !bytes.Equal(got, []byte{1}) {
+		t.Errorf("tracing attribute = %v, want [1]", got)
+	}
+}
+
+// genlAck returns an ack of the request seq with errno.
+func genlAck(seq uint32, errno syscall.Errno) []byte {
+	b := make([]byte, syscall.NLMSG_HDRLEN+4+syscall.NLMSG_HDRLEN)
+	usermem.ByteOrder.PutUint32(b[0:4], uint32(len(b)))
+	usermem.ByteOrder.PutUint16(b[4:6], syscall.NLMSG_ERROR)
+	usermem.ByteOrder.PutUint32(b[8:12], seq)
+	usermem.ByteOrder.PutUint32(b[syscall.NLMSG_HDRLEN:], uint32(-int32(errno)))
+	return b
+}
+
+func TestParseGenlAcks(t *testing.T) {
+	b := append(genlAck(1, 0), genlAck(2, syscall.EBUSY)...)
+	msgs, err := ParseGenlMessages(b)
+	if err != nil {
+		t.Fatalf("ParseGenlMessages() failed: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("ParseGenlMessages() = %d messages, want 2", len(msgs))
+	}
+	for i, want := range []syscall.Errno{0, syscall.EBUSY} {
+		if !msgs[i].IsAck() || msgs[i].Seq != uint32(i+1) || msgs[i].Errno != want {
+			t.Errorf("message %d = %+v, want ack of %d with %v", i, msgs[i], i+1, want)
+		}
+	}
+}
+
+func TestParseGenlMessagesInvalid(t *testing.T) {
+	b := genlAck(1, 0)
+	usermem.ByteOrder.PutUint32(b[0:4], uint32(len(b)+1))
+	if _, err := ParseGenlMessages(b); err == nil {
+		t.Errorf("ParseGenlMessages() accepted a message longer than the datagram")
+	}
+}
+
+func TestGetFamilyRequest(t *testing.T) {
+	msgs, err := ParseGenlMessages(EncodeGetFamilyRequest(DaptraceGenlName, 1))
+	if err != nil {
+		t.Fatalf("ParseGenlMessages() failed: %v", err)
+	}
+	name := msgs[0].Attrs[genlCtrlAttrFamilyName]
+	if msgs[0].Type != genlIDCtrl || string(name) != DaptraceGenlName+"\x00" {
+		t.Errorf("get family request = %+v, want %q to the controller", msgs[0], DaptraceGenlName)
+	}
+}
+
+func TestDaptraceRecords(t *testing.T) {
+	want := []DaptraceRecord{
+		{Epoch: 3, Addr: 0x1000, Accesses: 5},
+		{Epoch: 3, Addr: 0x7f0000002000, Accesses: 1},
+	}
+	data := make([]byte, 0, len(want)*DaptraceRecordSize)
+	for _, r := range want {
+		var rec [DaptraceRecordSize]byte
+		usermem.ByteOrder.PutUint64(rec[0:8], r.Epoch)
+		usermem.ByteOrder.PutUint64(rec[8:16], uint64(r.Addr))
+		usermem.ByteOrder.PutUint64(rec[16:24], r.Accesses)
+		data = append(data, rec[:]...)
+	}
+	b := EncodeGenlRequest(0x20, DaptraceCmdSamples, DaptraceGenlVersion, 0,
+		NetlinkAttr{Type: DaptraceAttrRecords, Data: data})
+	msgs, err := ParseGenlMessages(b)
+	if err != nil {
+		t.Fatalf("ParseGenlMessages() failed: %v", err)
+	}
+	got, err := msgs[0].DaptraceRecords()
+	if err != nil {
+		t.Fatalf("DaptraceRecords() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DaptraceRecords() = %+v, want %+v", got, want)
+	}
+
+	msgs[0].Attrs[DaptraceAttrRecords] = data[:DaptraceRecordSize+1]
+	if _, err := msgs[0].DaptraceRecords(); err == nil {
+		t.Errorf("DaptraceRecords() accepted a truncated record")
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// HeartbeatAction defines what the sentry does when the monitor stops
+// sending heartbeats.
+type HeartbeatAction int
+
+const (
+	// HeartbeatLog logs a warning and keeps the current targets.
+	HeartbeatLog HeartbeatAction = iota
+
+	// HeartbeatDisable logs a warning and stops delaying, as if the
+	// monitor had sent MessageStop.
+	HeartbeatDisable
+
+	// HeartbeatWatchdog hands the problem to the sentry watchdog, which
+	// takes its configured action.
+	HeartbeatWatchdog
+)
+
+// String returns HeartbeatAction's string representation.
+func (a HeartbeatAction) String() string {
+	switch a {
+	case HeartbeatLog:
+		return "log"
+	case HeartbeatDisable:
+		return "disable"
+	case HeartbeatWatchdog:
+		return "watchdog"
+	default:
+		return fmt.Sprintf("unknown(%d)", a)
+	}
+}
+
+// HeartbeatMissLimit is the number of heartbeat intervals that may pass
+// without a message from the monitor before it is considered dead.
+const HeartbeatMissLimit = 3
+
+// lastBeat is the time of the last message from the monitor, in nanoseconds
+// since the Unix epoch.
+var lastBeat int64
+
+// Beat records that the monitor is alive.
+func Beat() {
+	atomic.StoreInt64(&lastBeat, time.Now().UnixNano())
+}
+
+// Heartbeat states, as seen by the HeartbeatChecker.
+const (
+	heartbeatUnchecked int32 = iota
+	heartbeatHealthy
+	heartbeatSilent
+)
+
+// heartbeatState is the heartbeat state of the monitor. It is accessed
+// atomically.
+var heartbeatState int32
+
+// MonitorHealth tells whether the sentry hears from the monitor.
+type MonitorHealth struct {
+	// Checked is set if the sentry checks the heartbeats of the monitor.
+	// Healthy is meaningless otherwise.
+	Checked bool
+
+	// Healthy is set unless the monitor has been silent for longer than
+	// HeartbeatMissLimit intervals.
+	Healthy bool
+
+	// LastBeat is when the monitor last sent a message.
+	LastBeat time.Time
+}
+
+// CurrentMonitorHealth returns whether the sentry hears from the monitor.
+func CurrentMonitorHealth() MonitorHealth {
+	h := MonitorHealth{}
+	switch atomic.LoadInt32(&heartbeatState) {
+	case heartbeatHealthy:
+		h.Checked, h.Healthy = true, true
+	case heartbeatSilent:
+		h.Checked = true
+	}
+	if beat := atomic.LoadInt64(&lastBeat); beat != 0 {
+		h.LastBeat = time.Unix(0, beat)
+	}
+	return h
+}
+
+// HeartbeatChecker periodically checks that the monitor is still sending
+// messages and takes an action when it is not.
+type HeartbeatChecker struct {
+	// interval is the heartbeat interval the monitor was configured with.
+	interval time.Duration
+
+	// action is taken once per outage.
+	action HeartbeatAction
+
+	// report is called for HeartbeatWatchdog.
+	report func(msg string)
+
+	// stop is used to notify the checker that it should stop.
+	stop chan struct{}
+
+	// done is closed when the checker has stopped.
+	done chan struct{}
+}
+
+// NewHeartbeatChecker creates a new checker. report is only used with
+// HeartbeatWatchdog and is normally the sentry watchdog's Report method.
+func NewHeartbeatChecker(interval time.Duration, action HeartbeatAction, report func(msg string)) *HeartbeatChecker {
+	return &HeartbeatChecker{
+		interval: interval,
+		action:   action,
+		report:   report,
+	}
+}
+
+// Start starts the checker. The monitor is given a full timeout from now to
+// send its first heartbeat.
+func (c *HeartbeatChecker) Start() {
+	Beat()
+	atomic.StoreInt32(&heartbeatState, heartbeatHealthy)
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.loop()
+}
+
+// Stop stops the checker and waits for it to finish.
+func (c *HeartbeatChecker) Stop() {
+	if c.stop == nil {
+		return
+	}
+	close(c.stop)
+	<-c.done
+	c.stop = nil
+	atomic.StoreInt32(&heartbeatState, heartbeatUnchecked)
+}
+
+func (c *HeartbeatChecker) loop() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	timeout := HeartbeatMissLimit * c.interval
+	expired := false
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			silence := now.Sub(time.Unix(0, atomic.LoadInt64(&lastBeat)))
+			if silence <= timeout {
+				if expired {
+					log.Infof("[Cijitter] Monitor heartbeat resumed")
+					atomic.StoreInt32(&heartbeatState, heartbeatHealthy)
+					expired = false
+				}
+				continue
+			}
+			if !expired {
+				expired = true
+				atomic.StoreInt32(&heartbeatState, heartbeatSilent)
+				c.expire(silence)
+			}
+		}
+	}
+}
+
+// expire takes the configured action for a monitor that has been silent for
+// the given duration.
+func (c *HeartbeatChecker) expire(silence time.Duration) {
+	msg := fmt.Sprintf("[Cijitter] No heartbeat from the monitor for %v, accesses are no longer protected", silence)
+	switch c.action {
+	case HeartbeatLog:
+		log.Warningf("%s", msg)
+	case HeartbeatDisable:
+		addr, hits := stopDelay()
+		log.Warningf("%s; stopped delaying %#x after %d delayed accesses", msg, addr, hits)
+	case HeartbeatWatchdog:
+		c.report(msg)
+	default:
+		panic(fmt.Sprintf("Unknown heartbeat action %v", c.action))
+	}
+}
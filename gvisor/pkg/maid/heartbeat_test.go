@@ -0,0 +1,102 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+const testInterval = 10 * time.Millisecond
+
+func TestHeartbeatWatchdog(t *testing.T) {
+	reported := make(chan string, 1)
+	c := NewHeartbeatChecker(testInterval, HeartbeatWatchdog, func(msg string) {
+		reported <- msg
+	})
+	c.Start()
+	defer c.Stop()
+
+	select {
+	case <-reported:
+	case <-time.After(100 * testInterval):
+		t.Fatalf("watchdog not triggered after monitor went silent")
+	}
+}
+
+func TestHeartbeatKeepsAlive(t *testing.T) {
+	c := NewHeartbeatChecker(testInterval, HeartbeatWatchdog, func(msg string) {
+		t.Errorf("watchdog triggered while monitor is alive: %s", msg)
+	})
+	c.Start()
+
+	deadline := time.Now().Add(10 * HeartbeatMissLimit * testInterval)
+	for time.Now().Before(deadline) {
+		if ack := Listen_target_addrs(NewHeartbeatMessage()); ack.Err != "" {
+			t.Fatalf("heartbeat rejected: %s", ack.Err)
+		}
+		time.Sleep(testInterval)
+	}
+	c.Stop()
+}
+
+func TestHeartbeatDisable(t *testing.T) {
+	if ack := Listen_target_addrs(NewStartMessage(0x1000, 10)); ack.Err != "" {
+		t.Fatalf("start rejected: %s", ack.Err)
+	}
+
+	c := NewHeartbeatChecker(testInterval, HeartbeatDisable, nil)
+	c.Start()
+	defer c.Stop()
+
+	deadline := time.Now().Add(100 * testInterval)
+	for time.Now().Before(deadline) {
+		TAddr.Lock()
+		flag := TAddr.Flag
+		TAddr.Unlock()
+		if !flag {
+			return
+		}
+		time.Sleep(testInterval)
+	}
+	t.Errorf("delaying still enabled after monitor went silent")
+}
+
+func TestMonitorHealth(t *testing.T) {
+	if h := CurrentMonitorHealth(); h.Checked {
+		t.Errorf("CurrentMonitorHealth() = %+v without a checker, want unchecked", h)
+	}
+
+	reported := make(chan string, 1)
+	c := NewHeartbeatChecker(testInterval, HeartbeatWatchdog, func(msg string) {
+		reported <- msg
+	})
+	c.Start()
+	if h := CurrentMonitorHealth(); !h.Checked || !h.Healthy || h.LastBeat.IsZero() {
+		t.Errorf("CurrentMonitorHealth() = %+v after Start(), want healthy", h)
+	}
+	select {
+	case <-reported:
+	case <-time.After(100 * testInterval):
+		t.Fatalf("watchdog not triggered after monitor went silent")
+	}
+	if h := CurrentMonitorHealth(); !h.Checked || h.Healthy {
+		t.Errorf("CurrentMonitorHealth() = %+v after the monitor went silent, want unhealthy", h)
+	}
+	c.Stop()
+	if h := CurrentMonitorHealth(); h.Checked {
+		t.Errorf("CurrentMonitorHealth() = %+v after Stop(), want unchecked", h)
+	}
+}
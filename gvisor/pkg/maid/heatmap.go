@@ -0,0 +1,101 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// minHeat is the heat below which an address is forgotten.
+const minHeat = 1.0
+
+// Heatmap aggregates the sampled access counts of pages across sampling
+// cycles. Every cycle, the score of each page decays by a constant factor
+// before the new accesses are added, so that targets are the pages which are
+// persistently hot rather than the hottest of the last sample.
+type Heatmap struct {
+	mu sync.Mutex
+
+	// decay is the factor scores are multiplied by every cycle.
+	decay float64
+
+	// scores are the decayed access counts, per page.
+	scores map[usermem.Addr]float64
+}
+
+// NewHeatmap returns an empty heatmap whose scores decay by decay, in [0, 1),
+// every cycle.
+func NewHeatmap(decay float64) (*Heatmap, error) {
+	if decay < 0 || decay >= 1 {
+		return nil, fmt.Errorf("heat decay must be in [0, 1), got: %v", decay)
+	}
+	return &Heatmap{
+		decay:  decay,
+		scores: make(map[usermem.Addr]float64),
+	}, nil
+}
+
+// Add records one sampling cycle. Addresses are rounded down to their page.
+func (h *Heatmap) Add(sample []Target) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for addr, s := range h.scores {
+		s *= h.decay
+		if h.heat(s) < minHeat {
+			delete(h.scores, addr)
+			continue
+		}
+		h.scores[addr] = s
+	}
+	for _, t := range sample {
+		if t.Accesses > 0 {
+			h.scores[t.Addr.RoundDown()] += float64(t.Accesses)
+		}
+	}
+}
+
+// Top returns the n hottest pages, hottest first. Their access count is their
+// heat: the access count per cycle of a page sampled with a steady count
+// converges to that count, while one-off spikes fade away.
+func (h *Heatmap) Top(n int) []Target {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	top := make([]Target, 0, len(h.scores))
+	for addr, s := range h.scores {
+		top = append(top, Target{Addr: addr, Accesses: int(math.Round(h.heat(s)))})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Accesses != top[j].Accesses {
+			return top[i].Accesses > top[j].Accesses
+		}
+		return top[i].Addr < top[j].Addr
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// heat normalizes score to an access count per cycle.
+//
+// Preconditions: h.mu must be locked.
+func (h *Heatmap) heat(score float64) float64 {
+	return score * (1 - h.decay)
+}
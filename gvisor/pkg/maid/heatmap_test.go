@@ -0,0 +1,87 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+)
+
+func TestHeatmapPersistentBeatsSpike(t *testing.T) {
+	h, err := NewHeatmap(0.8)
+	if err != nil {
+		t.Fatalf("NewHeatmap() failed: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		sample := []Target{{Addr: 0x1000, Accesses: 300}}
+		if i == 19 {
+			// A one-off spike on another page.
+			sample = append(sample, Target{Addr: 0x5000, Accesses: 1000})
+		}
+		h.Add(sample)
+	}
+
+	top := h.Top(2)
+	if len(top) != 2 {
+		t.Fatalf("Top(2) returned %d targets, want 2", len(top))
+	}
+	if top[0].Addr != 0x1000 {
+		t.Errorf("hottest page is %#x, want 0x1000", top[0].Addr)
+	}
+	// The steady page converges to its access count.
+	if top[0].Accesses < 290 || top[0].Accesses > 300 {
+		t.Errorf("heat of the steady page is %d, want ~300", top[0].Accesses)
+	}
+	if top[1].Accesses != 200 {
+		t.Errorf("heat of the spike is %d, want 200", top[1].Accesses)
+	}
+}
+
+func TestHeatmapForgets(t *testing.T) {
+	h, err := NewHeatmap(0.5)
+	if err != nil {
+		t.Fatalf("NewHeatmap() failed: %v", err)
+	}
+	h.Add([]Target{{Addr: 0x1234, Accesses: 100}})
+	if top := h.Top(1); len(top) != 1 || top[0].Addr != 0x1000 {
+		t.Fatalf("Top(1) = %+v, want page 0x1000", top)
+	}
+	for i := 0; i < 10; i++ {
+		h.Add(nil)
+	}
+	if top := h.Top(1); len(top) != 0 {
+		t.Errorf("Top(1) = %+v after the page cooled down, want none", top)
+	}
+}
+
+func TestHeatmapNoDecay(t *testing.T) {
+	h, err := NewHeatmap(0)
+	if err != nil {
+		t.Fatalf("NewHeatmap() failed: %v", err)
+	}
+	h.Add([]Target{{Addr: 0x1000, Accesses: 50}})
+	h.Add([]Target{{Addr: 0x2000, Accesses: 70}})
+	top := h.Top(8)
+	if len(top) != 1 || top[0].Addr != 0x2000 || top[0].Accesses != 70 {
+		t.Errorf("Top(8) = %+v, want only the last sample", top)
+	}
+}
+
+func TestNewHeatmapInvalid(t *testing.T) {
+	for _, decay := range []float64{-0.1, 1, 2} {
+		if _, err := NewHeatmap(decay); err == nil {
+			t.Errorf("NewHeatmap(%v) succeeded, want error", decay)
+		}
+	}
+}
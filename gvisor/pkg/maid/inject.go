@@ -0,0 +1,63 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bytes"
+	"io"
+)
+
+// MaxInjectBytes is the maximum size of a stream that can be injected at
+// once.
+const MaxInjectBytes = 1 << 20
+
+// InjectResult is what Inject did with a stream.
+type InjectResult struct {
+	// Applied counts the messages applied, Errors those of them that were
+	// acked with an error, and Rejected the messages that failed validation.
+	Applied  int `json:"applied"`
+	Errors   int `json:"errors"`
+	Rejected int `json:"rejected"`
+
+	// Err is why decoding stopped before the end of the stream, if it did.
+	Err string `json:"err,omitempty"`
+}
+
+// Inject applies a stream of encoded messages, as the listener of the addr
+// pipe does. It is how fuzzed inputs reach the sentry: the monitor to sentry
+// channel crosses a privilege boundary, so any input must be handled safely.
+func Inject(data []byte) InjectResult {
+	var res InjectResult
+	dec := NewDecoder(bytes.NewReader(data))
+	for {
+		msg, err := dec.Decode()
+		switch verr := err.(type) {
+		case nil:
+			res.Applied++
+			if ack := Listen_target_addrs(msg); ack.Err != "" {
+				res.Errors++
+			}
+			continue
+		case *ValidationError:
+			RejectMessage(msg, verr.Err)
+			res.Rejected++
+			continue
+		}
+		if err != io.EOF {
+			res.Err = err.Error()
+		}
+		return res
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInject(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, m := range []*Message{
+		NewHeartbeatMessage(),
+		NewStartMessage(0x7f0000001000, 120),
+		NewStopMessage(),
+		NewStartMessage(0x7f0000001000, -1),
+	} {
+		if err := enc.Encode(m); err != nil {
+			t.Fatalf("Encode(%+v) failed: %v", m, err)
+		}
+	}
+	defer Listen_target_addrs(NewClearMessage())
+
+	want := InjectResult{Applied: 3, Rejected: 1}
+	if got := Inject(buf.Bytes()); got != want {
+		t.Errorf("Inject() = %+v, want %+v", got, want)
+	}
+
+	// Garbage after valid messages stops the injection.
+	buf.Reset()
+	enc = NewEncoder(&buf)
+	if err := enc.Encode(NewHeartbeatMessage()); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	buf.WriteString("garbage")
+	got := Inject(buf.Bytes())
+	if got.Applied != 1 || got.Err == "" {
+		t.Errorf("Inject() with trailing garbage = %+v, want 1 applied message and an error", got)
+	}
+}
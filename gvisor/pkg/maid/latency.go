@@ -0,0 +1,158 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBounds are the upper bounds of the buckets of a LatencyHistogram,
+// the last bucket counting the latencies above all of them.
+var LatencyBounds = [...]time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// LatencyHistogram is the distribution of the latencies measured on delays.
+type LatencyHistogram struct {
+	// Buckets counts the latencies up to LatencyBounds[i] and above
+	// LatencyBounds[i-1]. The last bucket counts the latencies above all
+	// bounds.
+	Buckets [len(LatencyBounds) + 1]uint64
+
+	// Count is the number of latencies measured, SumNanos their sum and
+	// MaxNanos the longest, in nanoseconds.
+	Count    uint64
+	SumNanos uint64
+	MaxNanos uint64
+}
+
+// Mean returns the mean latency of h, 0 if it is empty.
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return time.Duration(h.SumNanos / h.Count)
+}
+
+// Quantile returns an upper bound of the latency below which the fraction q
+// of the latencies of h fall: the bound of the bucket it is in, or the
+// longest latency for the last bucket. It returns 0 if h is empty.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.Count))
+	if rank >= h.Count {
+		rank = h.Count - 1
+	}
+	var seen uint64
+	for i, n := range h.Buckets {
+		seen += n
+		if seen > rank {
+			if i < len(LatencyBounds) && LatencyBounds[i] < time.Duration(h.MaxNanos) {
+				return LatencyBounds[i]
+			}
+			break
+		}
+	}
+	return time.Duration(h.MaxNanos)
+}
+
+// Merge adds the latencies of o to h.
+func (h *LatencyHistogram) Merge(o LatencyHistogram) {
+	for i, n := range o.Buckets {
+		h.Buckets[i] += n
+	}
+	h.Count += o.Count
+	h.SumNanos += o.SumNanos
+	if o.MaxNanos > h.MaxNanos {
+		h.MaxNanos = o.MaxNanos
+	}
+}
+
+// observe adds d to h. It is safe to call concurrently with other calls to
+// observe and with load.
+func (h *LatencyHistogram) observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := 0
+	for i < len(LatencyBounds) && d > LatencyBounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.Buckets[i], 1)
+	atomic.AddUint64(&h.Count, 1)
+	atomic.AddUint64(&h.SumNanos, uint64(d))
+	for {
+		max := atomic.LoadUint64(&h.MaxNanos)
+		if uint64(d) <= max || atomic.CompareAndSwapUint64(&h.MaxNanos, max, uint64(d)) {
+			return
+		}
+	}
+}
+
+// load returns a copy of h, which is updated with observe.
+func (h *LatencyHistogram) load() LatencyHistogram {
+	var c LatencyHistogram
+	for i := range h.Buckets {
+		c.Buckets[i] = atomic.LoadUint64(&h.Buckets[i])
+	}
+	c.Count = atomic.LoadUint64(&h.Count)
+	c.SumNanos = atomic.LoadUint64(&h.SumNanos)
+	c.MaxNanos = atomic.LoadUint64(&h.MaxNanos)
+	return c
+}
+
+// windowLatency is the latency measured on the delays of the open delay
+// window so far, in nanoseconds, and windowMeasured is 1 while a window is
+// open. They are accessed atomically.
+var (
+	windowLatency  uint64
+	windowMeasured uint32
+)
+
+// measureDelay records that a delay of the sandbox lasted d, as measured on
+// the monotonic clock.
+func measureDelay(d time.Duration) {
+	stats.AccessLatency.observe(d)
+	atomic.AddUint64(&windowLatency, uint64(d))
+}
+
+// beginWindowLatency starts measuring the latency of a new delay window,
+// recording that of the previous one, if open.
+func beginWindowLatency() {
+	endWindowLatency()
+	atomic.StoreUint64(&windowLatency, 0)
+	atomic.StoreUint32(&windowMeasured, 1)
+}
+
+// endWindowLatency records the latency of the open delay window, if any.
+func endWindowLatency() {
+	if atomic.SwapUint32(&windowMeasured, 0) == 0 {
+		return
+	}
+	stats.WindowLatency.observe(time.Duration(atomic.SwapUint64(&windowLatency, 0)))
+}
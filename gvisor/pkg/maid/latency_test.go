@@ -0,0 +1,80 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var h LatencyHistogram
+	for _, d := range []time.Duration{
+		5 * time.Microsecond,
+		80 * time.Microsecond,
+		90 * time.Microsecond,
+		2 * time.Millisecond,
+		3 * time.Second,
+	} {
+		h.observe(d)
+	}
+	got := h.load()
+	if got.Count != 5 {
+		t.Errorf("Count = %d, want 5", got.Count)
+	}
+	if want := 3*time.Second + 2175*time.Microsecond; got.Mean() != want/5 {
+		t.Errorf("Mean() = %v, want %v", got.Mean(), want/5)
+	}
+	for _, tc := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0, 10 * time.Microsecond},
+		{0.5, 100 * time.Microsecond},
+		{0.7, 5 * time.Millisecond},
+		{0.99, 3 * time.Second},
+	} {
+		if got := got.Quantile(tc.q); got != tc.want {
+			t.Errorf("Quantile(%v) = %v, want %v", tc.q, got, tc.want)
+		}
+	}
+
+	var merged LatencyHistogram
+	merged.Merge(got)
+	merged.Merge(got)
+	if merged.Count != 10 || merged.MaxNanos != uint64(3*time.Second) || merged.Buckets[2] != 4 {
+		t.Errorf("merged histogram = %+v, want twice %+v", merged, got)
+	}
+}
+
+func TestWindowLatency(t *testing.T) {
+	before := CurrentStats()
+	startDelay([]Target{{Addr: 0x1000, Accesses: 1}}, 0x1000, 0, WaitSleep)
+	Wait(100 * time.Microsecond)
+	Wait(100 * time.Microsecond)
+	stopDelay()
+	stopDelay()
+
+	after := CurrentStats()
+	if got := after.AccessLatency.Count - before.AccessLatency.Count; got != 2 {
+		t.Errorf("AccessLatency grew by %d, want 2", got)
+	}
+	if got := after.WindowLatency.Count - before.WindowLatency.Count; got != 1 {
+		t.Fatalf("WindowLatency grew by %d, want 1", got)
+	}
+	if got := time.Duration(after.WindowLatency.SumNanos - before.WindowLatency.SumNanos); got < 200*time.Microsecond {
+		t.Errorf("window latency = %v, want at least 200µs", got)
+	}
+}
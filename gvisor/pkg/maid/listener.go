@@ -0,0 +1,387 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+const (
+	// MinErrorBackoff and MaxErrorBackoff bound the wait after consecutive
+	// failures on the address pipe, so that a peer sending garbage or a
+	// pipe failing persistently doesn't make its user spin.
+	MinErrorBackoff = 10 * time.Millisecond
+	MaxErrorBackoff = time.Second
+)
+
+// ErrorBackoff is an exponential backoff between consecutive failures.
+type ErrorBackoff struct {
+	min time.Duration
+	max time.Duration
+
+	// next is the wait after the next failure.
+	next time.Duration
+}
+
+// NewErrorBackoff returns a backoff waiting min after the first failure and
+// doubling up to max.
+func NewErrorBackoff(min, max time.Duration) *ErrorBackoff {
+	return &ErrorBackoff{min: min, max: max, next: min}
+}
+
+// Reset is called after a success, the next failure waits min again.
+func (b *ErrorBackoff) Reset() {
+	b.next = b.min
+}
+
+// Wait is called after a failure. It waits for the current backoff and
+// returns false if ctx is cancelled first.
+func (b *ErrorBackoff) Wait(ctx context.Context) bool {
+	d := b.next
+	if b.next *= 2; b.next > b.max {
+		b.next = b.max
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ListenerState is what the listener of the address pipe is doing.
+type ListenerState int32
+
+const (
+	// ListenerStopped is the state of a listener that isn't running.
+	ListenerStopped ListenerState = iota
+
+	// ListenerWaiting waits for the monitor to hand over an address pipe.
+	ListenerWaiting
+
+	// ListenerServing reads the messages of the monitor.
+	ListenerServing
+
+	// ListenerBackingOff waits after a failure before reading again.
+	ListenerBackingOff
+)
+
+// String implements fmt.Stringer.
+func (s ListenerState) String() string {
+	switch s {
+	case ListenerStopped:
+		return "stopped"
+	case ListenerWaiting:
+		return "waiting"
+	case ListenerServing:
+		return "serving"
+	case ListenerBackingOff:
+		return "backing-off"
+	default:
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+}
+
+// ListenerHealth tells whether the sentry reads the messages of the monitor.
+type ListenerHealth struct {
+	// State is what the listener is doing.
+	State ListenerState
+
+	// Pipes is the number of address pipes served, the first one and
+	// those handed over on reconnection.
+	Pipes uint64
+
+	// Errors is the number of reads of the address pipe that failed, other
+	// than the end of a pipe. TransientErrors are those retried on the same
+	// pipe, the others made the listener give up the pipe.
+	Errors          uint64
+	TransientErrors uint64
+
+	// LastError is the last of Errors, empty if there was none.
+	LastError string
+}
+
+// listenerHealth is the health of the listener.
+var listenerHealth struct {
+	mu sync.Mutex
+	h  ListenerHealth
+}
+
+// CurrentListenerHealth returns the health of the listener.
+func CurrentListenerHealth() ListenerHealth {
+	listenerHealth.mu.Lock()
+	defer listenerHealth.mu.Unlock()
+	return listenerHealth.h
+}
+
+// setListenerState records that the listener is now in state s.
+func setListenerState(s ListenerState) {
+	listenerHealth.mu.Lock()
+	defer listenerHealth.mu.Unlock()
+	listenerHealth.h.State = s
+}
+
+// servingPipe records that the listener serves a new address pipe.
+func servingPipe() {
+	listenerHealth.mu.Lock()
+	defer listenerHealth.mu.Unlock()
+	listenerHealth.h.State = ListenerServing
+	listenerHealth.h.Pipes++
+}
+
+// recordListenerError records a failed read of the address pipe, retried on
+// the same pipe if transient.
+func recordListenerError(err error, transient bool) {
+	listenerHealth.mu.Lock()
+	defer listenerHealth.mu.Unlock()
+	listenerHealth.h.Errors++
+	if transient {
+		listenerHealth.h.TransientErrors++
+	}
+	listenerHealth.h.LastError = err.Error()
+}
+
+// transientReadError returns whether a read that failed with err may succeed
+// if retried.
+func transientReadError(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case syscall.EINTR, syscall.EAGAIN, syscall.ENOBUFS, syscall.ENOMEM:
+		return true
+	default:
+		return false
+	}
+}
+
+// pipeClosed returns whether a read that failed with err did because the
+// address pipe is gone: the monitor closed its end, or the pipe was closed
+// under the listener.
+func pipeClosed(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF || errors.Is(err, os.ErrClosed) {
+		return true
+	}
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	return errno == syscall.ECONNRESET || errno == syscall.EPIPE || errno == syscall.EBADF
+}
+
+// retryReader reads an address pipe, retrying the reads that fail
+// transiently after backing off. The decoder reading from it can't recover
+// from a failed read, so it only sees the end of the pipe and persistent
+// errors.
+type retryReader struct {
+	ctx     context.Context
+	r       io.Reader
+	backoff *ErrorBackoff
+}
+
+// Read implements io.Reader.Read.
+func (r *retryReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.r.Read(p)
+		if err == nil || !transientReadError(err) {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+		recordListenerError(err, true)
+		log.Debugf("[Cijitter] Addr pipe read failed, retrying: %v", err)
+		setListenerState(ListenerBackingOff)
+		if !r.backoff.Wait(r.ctx) {
+			return 0, r.ctx.Err()
+		}
+		setListenerState(ListenerServing)
+	}
+}
+
+// CloseAddrPipe shuts down and closes the address pipe f. Unlike a bare
+// Close, the shutdown wakes up a reader blocked on f, e.g. an ack reader.
+func CloseAddrPipe(f *os.File) {
+	if rc, err := f.SyscallConn(); err == nil {
+		rc.Control(func(fd uintptr) {
+			// Fails with ENOTSOCK on a plain pipe, which has no
+			// blocked reader to wake up on our side.
+			syscall.Shutdown(int(fd), syscall.SHUT_RDWR)
+		})
+	}
+	f.Close()
+}
+
+// Listen applies the messages the monitor sends through pipe and sends back
+// the acks. When the pipe breaks, it goes on with the next one handed over
+// with SetAddrPipe; pipe may be nil to start with one. A pipe that can't be
+// read anymore is given up after backing off, so that a monitor handing over
+// broken pipes doesn't make it spin. It returns ctx.Err() once ctx is
+// cancelled, after closing the pipe it reads from.
+func Listen(ctx context.Context, pipe *os.File) error {
+	defer setListenerState(ListenerStopped)
+	var (
+		mu  sync.Mutex
+		cur *os.File
+	)
+	closePipe := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if cur != nil {
+			CloseAddrPipe(cur)
+			cur = nil
+		}
+	}
+	defer closePipe()
+
+	// Cancellation closes the pipe, to wake up the read in progress.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			closePipe()
+		case <-done:
+		}
+	}()
+
+	backoff := NewErrorBackoff(MinErrorBackoff, MaxErrorBackoff)
+	for {
+		if pipe == nil {
+			setListenerState(ListenerWaiting)
+			select {
+			case pipe = <-AddrPipe:
+				log.Debugf("[Cijitter] Addr pipe re-established")
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		mu.Lock()
+		if ctx.Err() != nil {
+			mu.Unlock()
+			pipe.Close()
+			return ctx.Err()
+		}
+		cur = pipe
+		mu.Unlock()
+		servingPipe()
+
+		err := servePipe(ctx, pipe, backoff)
+		closePipe()
+		pipe = nil
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Either the monitor end is gone or the stream can no longer
+		// be decoded. Wait for the monitor to hand us a new pipe
+		// through the control socket.
+		if pipeClosed(err) {
+			log.Debugf("[Cijitter] Addr pipe closed, waiting for the monitor to reconnect...")
+			continue
+		}
+		log.Warningf("[Cijitter] Addr pipe unreadable, waiting for the monitor to reconnect: %v", err)
+		recordListenerError(err, false)
+		setListenerState(ListenerBackingOff)
+		if !backoff.Wait(ctx) {
+			return ctx.Err()
+		}
+	}
+}
+
+// servePipe applies the messages read from pipe until it can't be read
+// anymore. Malformed messages are rejected, and make it back off so that a
+// monitor sending garbage doesn't keep the sentry busy. Transient read errors
+// are retried after backing off too.
+func servePipe(ctx context.Context, pipe *os.File, backoff *ErrorBackoff) error {
+	decoder := NewDecoder(&retryReader{ctx: ctx, r: pipe, backoff: backoff})
+	encoder := &ackEncoder{enc: NewEncoder(pipe)}
+	done := make(chan struct{})
+	defer close(done)
+	go notifySuspension(encoder, done)
+	for {
+		msg, err := decoder.Decode()
+		var ack *Ack
+		rejected := false
+		if err == nil {
+			log.Debugf("[Cijitter] Addr received from child pipe: %v %+v\n", msg.Type, msg.Targets)
+			ack = Listen_target_addrs(msg)
+			backoff.Reset()
+		} else if verr, ok := err.(*ValidationError); ok {
+			ack = RejectMessage(msg, verr.Err)
+			rejected = true
+		} else {
+			return err
+		}
+		if err := encoder.encode(ack); err != nil {
+			log.Debugf("[Cijitter] Ack sended failed: %v", err)
+		}
+		if rejected {
+			setListenerState(ListenerBackingOff)
+			if !backoff.Wait(ctx) {
+				return ctx.Err()
+			}
+			setListenerState(ListenerServing)
+		}
+	}
+}
+
+// ackEncoder serializes the acks and notices written to an address pipe.
+type ackEncoder struct {
+	mu  sync.Mutex
+	enc *Encoder
+}
+
+// encode writes a to the pipe.
+func (e *ackEncoder) encode(a *Ack) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EncodeAck(a)
+}
+
+// notifySuspension tells the monitor over enc whenever the sandbox is
+// suspended or resumed, until done is closed. A monitor connecting while the
+// sandbox is suspended is told right away.
+func notifySuspension(enc *ackEncoder, done <-chan struct{}) {
+	notify := func(suspended bool) {
+		if err := enc.encode(NewSuspendNotice(suspended)); err != nil {
+			log.Debugf("[Cijitter] Suspend notice sended failed: %v", err)
+		}
+	}
+	changed, suspended := suspensionState()
+	if suspended {
+		notify(true)
+	}
+	for {
+		select {
+		case <-changed:
+		case <-done:
+			return
+		}
+		changed, suspended = suspensionState()
+		notify(suspended)
+	}
+}
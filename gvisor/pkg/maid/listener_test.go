@@ -0,0 +1,255 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// addrPipePair returns both ends of an address pipe, the monitor end first.
+func addrPipePair(t *testing.T) (*os.File, *os.File) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("socketpair: %v", err)
+	}
+	return os.NewFile(uintptr(fds[0]), "monitor"), os.NewFile(uintptr(fds[1]), "sandbox")
+}
+
+func TestErrorBackoff(t *testing.T) {
+	b := NewErrorBackoff(time.Millisecond, 4*time.Millisecond)
+	for _, want := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond} {
+		if b.next != want {
+			t.Errorf("next backoff = %v, want %v", b.next, want)
+		}
+		if !b.Wait(context.Background()) {
+			t.Fatalf("Wait() = false without cancellation")
+		}
+	}
+	b.Reset()
+	if b.next != time.Millisecond {
+		t.Errorf("next backoff after Reset() = %v, want %v", b.next, time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if NewErrorBackoff(time.Hour, time.Hour).Wait(ctx) {
+		t.Errorf("Wait() = true after cancellation")
+	}
+}
+
+func TestListenCancel(t *testing.T) {
+	monitor, sandbox := addrPipePair(t)
+	defer monitor.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Listen(ctx, sandbox) }()
+
+	// A malformed message is rejected and the pipe stays usable.
+	if err := NewEncoder(monitor).Encode(NewStartMessage(0, 1)); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	decoder := NewDecoder(monitor)
+	ack, err := decoder.DecodeAck()
+	if err != nil {
+		t.Fatalf("DecodeAck() failed: %v", err)
+	}
+	if ack.Err == "" {
+		t.Errorf("malformed message accepted")
+	}
+
+	// Cancellation wakes up the blocked read and closes the sandbox end.
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Listen() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listen() still running after cancellation")
+	}
+	if _, err := decoder.DecodeAck(); err == nil {
+		t.Errorf("sandbox end still open after Listen() returned")
+	}
+}
+
+func TestListenWaitsForPipe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Listen(ctx, nil) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Listen() = %v without a pipe", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listen() still waiting for a pipe after cancellation")
+	}
+}
+
+func TestCloseAddrPipeWakesReader(t *testing.T) {
+	monitor, sandbox := addrPipePair(t)
+	defer sandbox.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewDecoder(monitor).DecodeAck()
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	CloseAddrPipe(monitor)
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("DecodeAck() succeeded on a closed pipe")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("reader still blocked after CloseAddrPipe()")
+	}
+}
+
+// waitListenerState waits until the listener is in state want.
+func waitListenerState(t *testing.T, want ListenerState) ListenerHealth {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h := CurrentListenerHealth()
+		if h.State == want {
+			return h
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("listener state = %v, want %v", h.State, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// flakyReader fails its first reads with errs before reading r.
+type flakyReader struct {
+	errs []error
+	r    io.Reader
+}
+
+// Read implements io.Reader.Read.
+func (f *flakyReader) Read(p []byte) (int, error) {
+	if len(f.errs) != 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return 0, err
+	}
+	return f.r.Read(p)
+}
+
+func TestRetryReader(t *testing.T) {
+	before := CurrentListenerHealth()
+	// No listener runs, the reader changes the state on its own.
+	defer setListenerState(before.State)
+	r := &retryReader{
+		ctx:     context.Background(),
+		r:       &flakyReader{errs: []error{syscall.EAGAIN, &os.PathError{Op: "read", Path: "pipe", Err: syscall.EINTR}}, r: strings.NewReader("ok")},
+		backoff: NewErrorBackoff(time.Millisecond, time.Millisecond),
+	}
+	buf := make([]byte, 2)
+	if n, err := r.Read(buf); err != nil || string(buf[:n]) != "ok" {
+		t.Errorf("Read() = %q, %v, want \"ok\" after the transient errors", buf[:n], err)
+	}
+	if got := CurrentListenerHealth().TransientErrors - before.TransientErrors; got != 2 {
+		t.Errorf("%d transient errors recorded, want 2", got)
+	}
+	if _, err := r.Read(buf); err != io.EOF {
+		t.Errorf("Read() at the end = %v, want %v", err, io.EOF)
+	}
+
+	r = &retryReader{
+		ctx:     context.Background(),
+		r:       &flakyReader{errs: []error{syscall.EBADF}},
+		backoff: NewErrorBackoff(time.Hour, time.Hour),
+	}
+	if _, err := r.Read(buf); err != syscall.EBADF {
+		t.Errorf("Read() = %v, want %v returned without retrying", err, syscall.EBADF)
+	}
+}
+
+func TestPipeClosed(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		closed bool
+	}{
+		{err: io.EOF, closed: true},
+		{err: io.ErrUnexpectedEOF, closed: true},
+		{err: &os.PathError{Op: "read", Path: "pipe", Err: os.ErrClosed}, closed: true},
+		{err: &os.PathError{Op: "read", Path: "pipe", Err: syscall.ECONNRESET}, closed: true},
+		{err: syscall.EBADF, closed: true},
+		{err: io.ErrShortBuffer},
+	} {
+		if got := pipeClosed(tc.err); got != tc.closed {
+			t.Errorf("pipeClosed(%v) = %t, want %t", tc.err, got, tc.closed)
+		}
+	}
+}
+
+func TestListenerHealth(t *testing.T) {
+	// Listeners of other tests may still be winding down.
+	before := waitListenerState(t, ListenerStopped)
+	monitor, sandbox := addrPipePair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Listen(ctx, sandbox) }()
+
+	if h := waitListenerState(t, ListenerServing); h.Pipes != before.Pipes+1 {
+		t.Errorf("Pipes = %d, want %d", h.Pipes, before.Pipes+1)
+	}
+
+	// The end of the pipe is no error, the listener waits for the next.
+	monitor.Close()
+	if h := waitListenerState(t, ListenerWaiting); h.Errors != before.Errors {
+		t.Errorf("Errors = %d after the monitor closed the pipe, want %d", h.Errors, before.Errors)
+	}
+
+	// A stream that can't be decoded is an error, and the listener backs
+	// off before serving the next pipe.
+	monitor, sandbox = addrPipePair(t)
+	defer monitor.Close()
+	SetAddrPipe(sandbox)
+	waitListenerState(t, ListenerServing)
+	if _, err := monitor.Write([]byte("\x03garbage")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	monitor.Close()
+	h := waitListenerState(t, ListenerWaiting)
+	if h.Errors != before.Errors+1 || h.LastError == "" {
+		t.Errorf("health = %+v after an undecodable stream, want one more error", h)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listen() still running after cancellation")
+	}
+	if h := CurrentListenerHealth(); h.State != ListenerStopped {
+		t.Errorf("state = %v after Listen() returned, want %v", h.State, ListenerStopped)
+	}
+}
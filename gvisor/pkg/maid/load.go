@@ -0,0 +1,191 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LoadAction defines what the monitor does while the host is overloaded.
+type LoadAction int
+
+const (
+	// LoadSuspend delays no window until the host load recovers.
+	LoadSuspend LoadAction = iota
+
+	// LoadLighten only delays the primary target of each window until the
+	// host load recovers.
+	LoadLighten
+)
+
+// String returns LoadAction's string representation.
+func (a LoadAction) String() string {
+	switch a {
+	case LoadSuspend:
+		return "suspend"
+	case LoadLighten:
+		return "lighten"
+	default:
+		return fmt.Sprintf("unknown(%d)", a)
+	}
+}
+
+// LoadLimits are the host load above which the monitor backs off. Delays
+// take CPU time from the host, so under overload they compound it.
+type LoadLimits struct {
+	// CPU is the share of host CPU time spent busy, between 0 and 1. 0
+	// disables the limit.
+	CPU float64
+
+	// Pressure is the share of time, in percent over the last 10 seconds,
+	// some runnable task waited for a CPU, as reported by PSI. 0 disables
+	// the limit.
+	Pressure float64
+}
+
+// Enabled returns whether any limit is set.
+func (l LoadLimits) Enabled() bool {
+	return l.CPU > 0 || l.Pressure > 0
+}
+
+// loadRecovery is the fraction of the limits the load must fall below before
+// an overloaded host is considered recovered, so that a load hovering around
+// a limit doesn't toggle jitter every sample.
+const loadRecovery = 0.9
+
+// CPUTimes are the cumulative CPU times of the host, in clock ticks.
+type CPUTimes struct {
+	// Busy is the time spent outside of idle and iowait.
+	Busy uint64
+
+	// Total is the time spent overall.
+	Total uint64
+}
+
+// ParseCPUStat parses the aggregate cpu line of /proc/stat.
+func ParseCPUStat(data []byte) (CPUTimes, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+		if len(fields) < 5 {
+			return CPUTimes{}, fmt.Errorf("short cpu line %q", line)
+		}
+		// Guest times, from the ninth field on, are already counted
+		// in user and nice.
+		fields = fields[1:]
+		if len(fields) > 8 {
+			fields = fields[:8]
+		}
+		var t CPUTimes
+		for i, f := range fields {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return CPUTimes{}, fmt.Errorf("invalid cpu line %q: %v", line, err)
+			}
+			// Fields 3 and 4 are idle and iowait.
+			t.Total += v
+			if i != 3 && i != 4 {
+				t.Busy += v
+			}
+		}
+		return t, nil
+	}
+	return CPUTimes{}, fmt.Errorf("no cpu line")
+}
+
+// Utilization returns the share of CPU time spent busy since prev, between 0
+// and 1.
+func (t CPUTimes) Utilization(prev CPUTimes) float64 {
+	if t.Total <= prev.Total || t.Busy < prev.Busy {
+		return 0
+	}
+	return float64(t.Busy-prev.Busy) / float64(t.Total-prev.Total)
+}
+
+// ParsePressure returns the avg10 value of the "some" line of a PSI file such
+// as /proc/pressure/cpu.
+func ParsePressure(data []byte) (float64, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "avg10=") {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimPrefix(f, "avg10="), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid pressure line %q: %v", line, err)
+			}
+			return v, nil
+		}
+		return 0, fmt.Errorf("no avg10 in pressure line %q", line)
+	}
+	return 0, fmt.Errorf("no some line")
+}
+
+// LoadSample is a reading of the host load.
+type LoadSample struct {
+	// CPU are the CPU times of the host at the time of the reading.
+	CPU CPUTimes
+
+	// Pressure is the CPU pressure of the host, if HasPressure is set.
+	// Kernels without PSI don't report it.
+	Pressure    float64
+	HasPressure bool
+}
+
+// LoadGovernor judges readings of the host load against LoadLimits.
+type LoadGovernor struct {
+	limits LoadLimits
+
+	// prev is the last reading, CPU utilization is measured between two
+	// readings.
+	prev    CPUTimes
+	hasPrev bool
+
+	// overloaded is the outcome of the last reading.
+	overloaded bool
+}
+
+// NewLoadGovernor returns a governor judging against limits.
+func NewLoadGovernor(limits LoadLimits) *LoadGovernor {
+	return &LoadGovernor{limits: limits}
+}
+
+// Observe records reading s and returns whether the host is overloaded. A
+// host overloaded by the last reading stays so until the load falls below
+// loadRecovery of every limit exceeded.
+func (g *LoadGovernor) Observe(s LoadSample) bool {
+	scale := 1.0
+	if g.overloaded {
+		scale = loadRecovery
+	}
+	over := false
+	if g.limits.CPU > 0 && g.hasPrev && s.CPU.Utilization(g.prev) > g.limits.CPU*scale {
+		over = true
+	}
+	if g.limits.Pressure > 0 && s.HasPressure && s.Pressure > g.limits.Pressure*scale {
+		over = true
+	}
+	g.prev, g.hasPrev = s.CPU, true
+	g.overloaded = over
+	return over
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+)
+
+func TestParseCPUStat(t *testing.T) {
+	data := []byte("cpu  100 10 50 800 40 5 5 0 30 0\ncpu0 50 5 25 400 20 2 3 0 15 0\nintr 1234\n")
+	got, err := ParseCPUStat(data)
+	if err != nil {
+		t.Fatalf("ParseCPUStat failed: %v", err)
+	}
+	// Guest times are not counted twice, idle and iowait are not busy.
+	want := CPUTimes{Busy: 170, Total: 1010}
+	if got != want {
+		t.Errorf("ParseCPUStat = %+v, want %+v", got, want)
+	}
+	if _, err := ParseCPUStat([]byte("intr 1234\n")); err == nil {
+		t.Errorf("ParseCPUStat without a cpu line succeeded")
+	}
+}
+
+func TestParsePressure(t *testing.T) {
+	data := []byte("some avg10=12.50 avg60=3.00 avg300=1.00 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+	got, err := ParsePressure(data)
+	if err != nil {
+		t.Fatalf("ParsePressure failed: %v", err)
+	}
+	if got != 12.5 {
+		t.Errorf("ParsePressure = %v, want 12.5", got)
+	}
+	if _, err := ParsePressure([]byte("full avg10=1.00\n")); err == nil {
+		t.Errorf("ParsePressure without a some line succeeded")
+	}
+}
+
+func TestLoadGovernorCPU(t *testing.T) {
+	g := NewLoadGovernor(LoadLimits{CPU: 0.8})
+	// The first reading has nothing to measure utilization against.
+	if g.Observe(LoadSample{CPU: CPUTimes{Busy: 0, Total: 0}}) {
+		t.Errorf("overloaded on the first reading")
+	}
+	if !g.Observe(LoadSample{CPU: CPUTimes{Busy: 90, Total: 100}}) {
+		t.Errorf("not overloaded at 90%% CPU")
+	}
+	// Below the limit, but not below the recovery point.
+	if !g.Observe(LoadSample{CPU: CPUTimes{Busy: 165, Total: 200}}) {
+		t.Errorf("recovered at 75%% CPU, above the recovery point")
+	}
+	if g.Observe(LoadSample{CPU: CPUTimes{Busy: 215, Total: 300}}) {
+		t.Errorf("still overloaded at 50%% CPU")
+	}
+}
+
+func TestLoadGovernorPressure(t *testing.T) {
+	g := NewLoadGovernor(LoadLimits{Pressure: 20})
+	if g.Observe(LoadSample{Pressure: 10, HasPressure: true}) {
+		t.Errorf("overloaded at 10%% pressure")
+	}
+	if !g.Observe(LoadSample{Pressure: 30, HasPressure: true}) {
+		t.Errorf("not overloaded at 30%% pressure")
+	}
+	if !g.Observe(LoadSample{Pressure: 19, HasPressure: true}) {
+		t.Errorf("recovered at 19%% pressure, above the recovery point")
+	}
+	if g.Observe(LoadSample{Pressure: 30}) {
+		t.Errorf("overloaded on a reading without pressure")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// deferLockHolders is 1 if the delays of tasks holding a contended lock are
+// deferred until they release it. It is accessed atomically.
+var deferLockHolders int32
+
+// SetDeferLockHolders sets whether the delays of tasks holding a lock other
+// tasks wait for are deferred until they release it. Delaying a lock holder
+// stalls every waiter with it, which turns a short delay into a convoy.
+func SetDeferLockHolders(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&deferLockHolders, v)
+}
+
+// DeferLockHolders returns whether the delays of lock holders are deferred.
+func DeferLockHolders() bool {
+	return atomic.LoadInt32(&deferLockHolders) != 0
+}
+
+// DeferDelay returns the delay a lock holder owes once it released its lock,
+// owed already plus d, and counts the deferral. d must have been charged to
+// the delay budget already.
+func DeferDelay(owed, d time.Duration) time.Duration {
+	atomic.AddUint64(&stats.DeferredDelays, 1)
+	return owed + d
+}
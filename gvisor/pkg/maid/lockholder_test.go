@@ -0,0 +1,43 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetDeferLockHolders(t *testing.T) {
+	defer SetDeferLockHolders(false)
+	if DeferLockHolders() {
+		t.Errorf("lock holders deferred by default")
+	}
+	SetDeferLockHolders(true)
+	if !DeferLockHolders() {
+		t.Errorf("lock holders not deferred once enabled")
+	}
+}
+
+func TestDeferDelayAccumulates(t *testing.T) {
+	before := CurrentStats().DeferredDelays
+	owed := DeferDelay(0, 100*time.Microsecond)
+	owed = DeferDelay(owed, 50*time.Microsecond)
+	if owed != 150*time.Microsecond {
+		t.Errorf("owed %v after two deferrals, want %v", owed, 150*time.Microsecond)
+	}
+	if got := CurrentStats().DeferredDelays - before; got != 2 {
+		t.Errorf("%d deferrals counted, want 2", got)
+	}
+}
@@ -1,26 +1,115 @@
 package maid
 
 import (
+    "fmt"
+    "os"
+    "sort"
     "sync"
     "strconv"
     "strings"
+    "sync/atomic"
     "gvisor.dev/gvisor/pkg/usermem"
     "gvisor.dev/gvisor/pkg/log"
 )
 
+// maxStagedTargets bounds the targets staged in the back buffer of a
+// TargetAddrs, over as many StageTargets messages as they take.
+const maxStagedTargets = 16 * MaxBatchTargets
+
 // multiple address
+//
+// The target set is double buffered: the next set is staged in the back
+// buffer while delays go on with the active one, then the buffers are
+// swapped in a single step. The monitor thus refreshes the targets of an
+// open window without a stop and start that would leave it unprotected.
 type TargetAddrs struct {
    sync.Mutex
+   // Addrs is the active target set, the one delays go by.
    Addrs map[usermem.Addr]int
+   // staged is the back buffer, the next target set.
+   staged map[usermem.Addr]int
+   // lines and stagedLines are the sampled cache lines of the targets of
+   // Addrs and staged that have them, as Target.Lines.
+   lines       map[usermem.Addr]uint64
+   stagedLines map[usermem.Addr]uint64
+   // hot is the hot region: the hottest targets of the last set swapped
+   // in, kept once the window closes.
+   hot []usermem.Addr
+   // Generation counts the target sets swapped in.
+   Generation uint64
 }
 
 func NewTargetAddrs() *TargetAddrs {
     maddr := new(TargetAddrs)
     maddr.Addrs = make(map[usermem.Addr]int)
+    maddr.staged = make(map[usermem.Addr]int)
+    maddr.lines = make(map[usermem.Addr]uint64)
+    maddr.stagedLines = make(map[usermem.Addr]uint64)
 
     return maddr
 }
 
+// stage adds targets to the back buffer of t, emptied first if replace is
+// set.
+//
+// Preconditions: t must be locked.
+func (t *TargetAddrs) stage(targets []Target, replace bool) error {
+    if replace {
+        t.discard()
+    }
+    added := 0
+    for _, target := range targets {
+        if _, ok := t.staged[target.Addr]; !ok {
+            added++
+        }
+    }
+    if len(t.staged)+added > maxStagedTargets {
+        return fmt.Errorf("%d targets staged, at most %d allowed", len(t.staged)+added, maxStagedTargets)
+    }
+    for _, target := range targets {
+        t.stageTarget(target)
+    }
+    return nil
+}
+
+// stageTarget adds target to the back buffer of t.
+//
+// Preconditions: t must be locked.
+func (t *TargetAddrs) stageTarget(target Target) {
+    t.staged[target.Addr] = target.Accesses
+    if target.Lines != 0 {
+        t.stagedLines[target.Addr] = target.Lines
+    } else {
+        delete(t.stagedLines, target.Addr)
+    }
+}
+
+// swap makes the back buffer of t the active target set and returns its
+// generation. The previous set becomes the empty back buffer: every reader
+// of Addrs holds the lock, so no one is left reading it.
+//
+// Preconditions: t must be locked.
+func (t *TargetAddrs) swap() uint64 {
+    t.Addrs, t.staged = t.staged, t.Addrs
+    t.lines, t.stagedLines = t.stagedLines, t.lines
+    t.discard()
+    t.hot = hotRegionOf(t.Addrs)
+    t.Generation++
+    return t.Generation
+}
+
+// discard empties the back buffer of t.
+//
+// Preconditions: t must be locked.
+func (t *TargetAddrs) discard() {
+    for addr := range t.staged {
+        delete(t.staged, addr)
+    }
+    for addr := range t.stagedLines {
+        delete(t.stagedLines, addr)
+    }
+}
+
 // single address
 type TargetAddr struct {
     sync.Mutex
@@ -28,6 +117,10 @@ type TargetAddr struct {
     Flag bool
     SleepTime int
     WaitTime int
+    // Hits counts the delayed accesses observed since the last Start.
+    Hits uint64
+    // Origin is Addr as the monitor sent it, before translation.
+    Origin usermem.Addr
 }
 
 func NewTargetAddr() *TargetAddr {
@@ -66,6 +159,24 @@ func init() {
     Modaddr = NewModAddr()
 }
 
+// AddrPipe carries replacement read ends of the monitor address pipe. The
+// monitor hands them over through the sandbox control socket when the
+// original pipe breaks, and the listener picks them up once it sees EOF.
+var AddrPipe = make(chan *os.File, 1)
+
+// SetAddrPipe queues f as the next address pipe for the listener. A pipe that
+// was queued earlier but never picked up is closed and replaced.
+func SetAddrPipe(f *os.File) {
+    for {
+        select {
+        case AddrPipe <- f:
+            return
+        case old := <-AddrPipe:
+            old.Close()
+        }
+    }
+}
+
 func Hex2addr(hexStr string) (usermem.Addr, error) {
     // remove 0x suffix if found in the input string
     cleaned := strings.Replace(hexStr, "0x", "", -1)
@@ -82,50 +193,292 @@ func Hex2addr(hexStr string) (usermem.Addr, error) {
     return addr, nil
 }
 
-func Listen_target_addrs(addrInfo string) {
-    log.Debugf("[Cijitter] Get Target Address: %s\n", addrInfo)
-
-    addr_acc := strings.Split(addrInfo, " ")
-    if len(addr_acc) != 2 {
-        log.Debugf("[Cijitter] Address format error: %s\n", addrInfo)
-        return
+// RecordDelayedAccess is called by the sentry when the victim faults on a
+// page it protected, i.e. when an access was actually delayed.
+func RecordDelayedAccess(addr usermem.Addr) {
+    atomic.AddUint64(&stats.DelayedAccesses, 1)
+    TAddr.Lock()
+    if TAddr.Flag && TAddr.Addr == addr {
+        TAddr.Hits++
     }
+    TAddr.Unlock()
+}
 
-    // get target address
-    addr, err := Hex2addr(addr_acc[0])
-    if err != nil {
-        log.Debugf("[Cijitter] Address %s transform error: %s\n", addr_acc[0], err)
-        return
+// Listen_target_addrs applies a message received from the monitor and
+// returns the ack to send back. The message is validated again here so that
+// callers other than the listener cannot bypass the checks.
+func Listen_target_addrs(msg *Message) *Ack {
+    log.Debugf("[Cijitter] Get %v message: %+v\n", msg.Type, msg.Targets)
+
+    if err := msg.Validate(); err != nil {
+        return RejectMessage(msg, err)
     }
+    ack := NewAck(msg)
 
-    // get access number of target address
-    access, err := strconv.Atoi(addr_acc[1])
-    if err != nil {
-        log.Debugf("[Cijitter] Access Number %s transform error: %s\n", addr_acc[1], err)
-        access = 1
+    // Every well formed message proves that the monitor is alive.
+    Beat()
+
+    // No window opens while the sandbox is suspended.
+    if Suspended() && (msg.Type == MessageStart || msg.Type == MessageSamples) {
+        ack.Err = "sandbox is suspended"
+        return ack
     }
 
-    log.Debugf("[Cijitter] sysno addr %x, %d\n", addr, access)
+    switch msg.Type {
+    case MessageHeartbeat:
+        recordMonitorDrops(msg.Drops)
+        recordMonitorSamplerErrors(msg.SamplerErrors)
+
+    case MessageStop:
+        log.Debugf("[Cijitter] stop delay...\n")
+        ack.Addr, ack.Hits = stopDelay()
+        log.Debugf("[Cijitter] window on %x observed %d delayed accesses\n", ack.Addr, ack.Hits)
+
+    case MessageClear:
+        log.Debugf("[Cijitter] clear targets...\n")
+        if s := currentScheduler(); s != nil {
+            s.Clear()
+        }
+        ack.Addr, ack.Hits = stopDelay()
+        clearHotRegion()
+        setHeavyHitters(nil)
+
+    case MessageStart:
+        targets, origins := translateTargets(msg.Targets)
+        if err := checkAddrSpace(targets); err != nil {
+            return RejectMessage(msg, err)
+        }
+        targets = widenTargets(targets)
+        if len(targets) == 0 {
+            ack.Err = "no target maps application memory"
+            break
+        }
+        ack.Generation = startDelay(targets, origins[0], msg.Intensity, msg.Wait)
+        ack.Addr = origins[0]
+
+    case MessageUpdateTargets:
+        targets, _ := translateTargets(msg.Targets)
+        if err := checkAddrSpace(targets); err != nil {
+            return RejectMessage(msg, err)
+        }
+        targets = widenTargets(targets)
+        TAddrs.Lock()
+        err := TAddrs.stage(targets, true)
+        if err == nil {
+            ack.Generation = TAddrs.swap()
+        }
+        TAddrs.Unlock()
+        if err != nil {
+            return RejectMessage(msg, err)
+        }
+
+    case MessageStageTargets:
+        targets, _ := translateTargets(msg.Targets)
+        err := checkAddrSpace(targets)
+        if err == nil {
+            targets = widenTargets(targets)
+        }
+        TAddrs.Lock()
+        if err == nil {
+            err = TAddrs.stage(targets, false)
+        }
+        if err != nil {
+            // Don't let a later swap make a partial set active.
+            TAddrs.discard()
+        }
+        ack.Generation = TAddrs.Generation
+        TAddrs.Unlock()
+        if err != nil {
+            return RejectMessage(msg, err)
+        }
+
+    case MessageSwapTargets:
+        TAddrs.Lock()
+        if len(TAddrs.staged) == 0 {
+            ack.Err = "no targets staged"
+        } else {
+            ack.Generation = TAddrs.swap()
+        }
+        TAddrs.Unlock()
 
-    if addr == usermem.Addr(0) {
-	    log.Debugf("[Cijitter] addr is %x, stop delay...\n", addr)
-	    TAddr.Lock()
-	    TAddr.Addr = addr
-	    TAddr.Flag = false
-	    TAddr.Unlock()
-	    return
+    case MessageHistory:
+        setMonitorHistory(msg.History)
+
+    case MessageResume:
+        resume(ack)
+
+    case MessageHeavyHitters:
+        setHeavyHitters(msg.Targets)
+
+    case MessageSamples:
+        s := currentScheduler()
+        if s == nil {
+            log.Debugf("[Cijitter] Samples received but the sentry does not schedule delays\n")
+            ack.Err = "sentry scheduling is disabled"
+            break
+        }
+        targets, _ := translateTargets(msg.Targets)
+        if err := checkAddrSpace(targets); err != nil {
+            return RejectMessage(msg, err)
+        }
+        if len(targets) == 0 {
+            break
+        }
+        s.Submit(targets)
     }
+    return ack
+}
+
+// RejectMessage drops the malformed message msg, counts it and returns the
+// ack reporting err to the monitor.
+func RejectMessage(msg *Message, err error) *Ack {
+    atomic.AddUint64(&stats.RejectedMessages, 1)
+    log.Warningf("[Cijitter] Dropping %v message from monitor: %v\n", msg.Type, err)
+    ack := NewAck(msg)
+    ack.Err = err.Error()
+    return ack
+}
+
+// startDelay starts delaying a batch of targets, the first of which is the
+// primary target, and returns the generation of the target set. origin is
+// the primary target as the monitor knows it, intensity scales the delays, 0
+// for the usual ones, and wait is how they are waited out. Targets staged
+// before are discarded.
+func startDelay(targets []Target, origin usermem.Addr, intensity float64, wait WaitMode) uint64 {
+    addr := targets[0].Addr
+    access := targets[0].Accesses
+    log.Debugf("[Cijitter] sysno addr %x, %d, batch of %d\n", addr, access, len(targets))
 
     //sleep time - Microsenconds, 400 is tf
     sleep_time := (0.09 - float64(1/access/270)) * 10000000 - 400
     log.Debugf("[Cijitter] sleep time is %f\n", sleep_time)
     wait_time := 100000/access
+    setWindowWaitMode(wait)
 
-    // start to clear the addr's perms
+    // Replace the whole target set and the primary target in one
+    // step, so the delayer never sees a mix of old and new targets.
+    TAddrs.Lock()
     TAddr.Lock()
+    TAddrs.discard()
+    for _, t := range targets {
+        TAddrs.stageTarget(t)
+    }
+    gen := TAddrs.swap()
     TAddr.Addr = addr
     TAddr.Flag = true
-    TAddr.SleepTime = int(sleep_time)
+    TAddr.SleepTime = scaleDelay(int(sleep_time), intensity)
     TAddr.WaitTime = int(wait_time) + 1
+    TAddr.Hits = 0
+    TAddr.Origin = origin
+    TAddr.Unlock()
+    TAddrs.Unlock()
+    atomic.AddUint64(&stats.Windows, 1)
+    recordWindowTargets(targets)
+    beginWindowLatency()
+    return gen
+}
+
+// stopDelay clears all targets, staged ones included, and returns the
+// primary target, as the monitor knows it, together with the delayed
+// accesses observed on it.
+func stopDelay() (usermem.Addr, uint64) {
+    TAddrs.Lock()
+    TAddr.Lock()
+    addr, hits := TAddr.Origin, TAddr.Hits
+    TAddrs.Addrs = make(map[usermem.Addr]int)
+    TAddrs.lines = make(map[usermem.Addr]uint64)
+    TAddrs.discard()
+    TAddr.Addr = usermem.Addr(0)
+    TAddr.Origin = usermem.Addr(0)
+    TAddr.Flag = false
+    TAddr.Unlock()
+    TAddrs.Unlock()
+    endWindowLatency()
+    return addr, hits
+}
+
+// DelayPages returns the pages the delayer protects in the current window:
+// the primary target first, then the rest of the batch by decreasing
+// accesses, then the pages the application marked secret. Outside of windows
+// it returns the secret pages alone, and nil if there are none.
+func DelayPages() []usermem.Addr {
+    TAddrs.Lock()
+    TAddr.Lock()
+    if !TAddr.Flag {
+        TAddr.Unlock()
+        TAddrs.Unlock()
+        if secret := SecretPages(); len(secret) > 0 {
+            return secret
+        }
+        return nil
+    }
+    primary := TAddr.Addr
+    pages := []usermem.Addr{primary}
+    rest := make([]Target, 0, len(TAddrs.Addrs))
+    for addr, accesses := range TAddrs.Addrs {
+        if addr != primary {
+            rest = append(rest, Target{Addr: addr, Accesses: accesses})
+        }
+    }
+    TAddr.Unlock()
+    TAddrs.Unlock()
+
+    sort.Slice(rest, func(i, j int) bool {
+        if rest[i].Accesses != rest[j].Accesses {
+            return rest[i].Accesses > rest[j].Accesses
+        }
+        return rest[i].Addr < rest[j].Addr
+    })
+    seen := make(map[usermem.Addr]bool, len(rest)+1)
+    seen[primary] = true
+    for _, t := range rest {
+        pages = append(pages, t.Addr)
+        seen[t.Addr] = true
+    }
+    // pages the application marked secret are delayed in every window
+    for _, page := range SecretPages() {
+        if !seen[page] {
+            pages = append(pages, page)
+            seen[page] = true
+        }
+    }
+    return pages
+}
+
+// IsDelayed returns whether addr is to be delayed now, i.e. is the primary
+// target or another target of the batch of the current window, or a secret
+// page.
+func IsDelayed(addr usermem.Addr) bool {
+    TAddrs.Lock()
+    TAddr.Lock()
+    open := TAddr.Flag
+    _, ok := TAddrs.Addrs[addr]
+    ok = ok || TAddr.Addr == addr
     TAddr.Unlock()
+    TAddrs.Unlock()
+    return (open && ok) || IsSecret(addr)
+}
+
+// Secret pages are delayed between windows too, with these parameters in
+// microseconds, since no Start message set any.
+const (
+    SecretWaitTime  = 10000
+    SecretSleepTime = 100
+)
+
+// DelayTimes returns the time between delay rounds and the delay of each
+// access, in microseconds: those of the current window, or the secret page
+// ones outside of windows if any page is secret.
+func DelayTimes() (wait, sleep int) {
+    TAddr.Lock()
+    open, wait, sleep := TAddr.Flag, TAddr.WaitTime, TAddr.SleepTime
+    TAddr.Unlock()
+    if !open && len(SecretPages()) > 0 {
+        return SecretWaitTime, SecretSleepTime
+    }
+    if wait <= 0 {
+        // time.NewTicker panics on non-positive intervals
+        wait = SecretWaitTime
+    }
+    return wait, sleep
 }
@@ -0,0 +1,103 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// MigrationCostPerPage is the estimated cost of migrating a page to another
+// NUMA node: copying it over the interconnect, remapping it and shooting down
+// the TLB entries of the threads that map it.
+const MigrationCostPerPage = 25 * time.Microsecond
+
+// NUMAPlacement is where the targets of a delay window and the suspected
+// attacker are on a multi-socket host.
+type NUMAPlacement struct {
+	// Nodes are the online NUMA nodes of the host.
+	Nodes []int
+
+	// Pages are the target pages by the node they live on. Pages whose
+	// node isn't known, e.g. not faulted in yet, are left out.
+	Pages map[int][]usermem.Addr
+
+	// Attacker is the node the suspected attacker runs on, -1 if unknown.
+	Attacker int
+}
+
+// String implements fmt.Stringer.
+func (p NUMAPlacement) String() string {
+	nodes := make([]int, 0, len(p.Pages))
+	for node := range p.Pages {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+	var b strings.Builder
+	b.WriteString("pages on")
+	for _, node := range nodes {
+		fmt.Fprintf(&b, " node %d: %d,", node, len(p.Pages[node]))
+	}
+	if len(nodes) == 0 {
+		b.WriteString(" no known node,")
+	}
+	if p.Attacker < 0 {
+		b.WriteString(" attacker on unknown node")
+	} else {
+		fmt.Fprintf(&b, " attacker on node %d", p.Attacker)
+	}
+	return b.String()
+}
+
+// Migration returns the pages of p to migrate away from the node of the
+// attacker, and the node to migrate them to, if migrating them costs less
+// than delay, the cost of the delay window it replaces. The pages go to the
+// node holding most of the other targets.
+func (p NUMAPlacement) Migration(delay time.Duration) ([]usermem.Addr, int, bool) {
+	if len(p.Nodes) < 2 || p.Attacker < 0 {
+		return nil, 0, false
+	}
+	pages := p.Pages[p.Attacker]
+	if len(pages) == 0 || time.Duration(len(pages))*MigrationCostPerPage >= delay {
+		return nil, 0, false
+	}
+	dest := -1
+	for _, node := range p.Nodes {
+		if node == p.Attacker {
+			continue
+		}
+		if dest < 0 || len(p.Pages[node]) > len(p.Pages[dest]) {
+			dest = node
+		}
+	}
+	if dest < 0 {
+		return nil, 0, false
+	}
+	return pages, dest, true
+}
+
+// WindowCost returns the estimated cost of a delay window of intensity i, 0
+// for the usual delays, to the sandbox. It is an upper bound: the sandbox is
+// only slowed down while it accesses the targets.
+func WindowCost(i float64) time.Duration {
+	if i == 0 {
+		i = 1
+	}
+	return time.Duration(float64(DelayWindow) * i)
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestNUMAMigration(t *testing.T) {
+	pages := map[int][]usermem.Addr{
+		0: {0x1000, 0x2000},
+		1: {0x3000},
+		2: {0x4000, 0x5000, 0x6000},
+	}
+	for _, tc := range []struct {
+		name  string
+		p     NUMAPlacement
+		delay time.Duration
+		want  []usermem.Addr
+		dest  int
+		ok    bool
+	}{
+		{
+			name:  "to the node of most targets",
+			p:     NUMAPlacement{Nodes: []int{0, 1, 2}, Pages: pages, Attacker: 0},
+			delay: time.Second,
+			want:  []usermem.Addr{0x1000, 0x2000},
+			dest:  2,
+			ok:    true,
+		},
+		{
+			name:  "costlier than the window",
+			p:     NUMAPlacement{Nodes: []int{0, 1, 2}, Pages: pages, Attacker: 0},
+			delay: MigrationCostPerPage,
+		},
+		{
+			name:  "no target on the attacker's node",
+			p:     NUMAPlacement{Nodes: []int{0, 1, 2, 3}, Pages: pages, Attacker: 3},
+			delay: time.Second,
+		},
+		{
+			name:  "attacker unknown",
+			p:     NUMAPlacement{Nodes: []int{0, 1, 2}, Pages: pages, Attacker: -1},
+			delay: time.Second,
+		},
+		{
+			name:  "single node",
+			p:     NUMAPlacement{Nodes: []int{0}, Pages: pages, Attacker: 0},
+			delay: time.Second,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, dest, ok := tc.p.Migration(tc.delay)
+			if ok != tc.ok || !reflect.DeepEqual(got, tc.want) || (ok && dest != tc.dest) {
+				t.Errorf("Migration(%v) = %v, %d, %t, want %v, %d, %t", tc.delay, got, dest, ok, tc.want, tc.dest, tc.ok)
+			}
+		})
+	}
+}
+
+func TestNUMAPlacementString(t *testing.T) {
+	p := NUMAPlacement{Pages: map[int][]usermem.Addr{1: {0x1000}, 0: {0x2000, 0x3000}}, Attacker: 1}
+	if got, want := p.String(), "pages on node 0: 2, node 1: 1, attacker on node 1"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
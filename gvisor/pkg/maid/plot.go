@@ -0,0 +1,171 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// TraceHeatmap is the heatmap of the page accesses sampled in a trace over
+// time, with the delayed targets overlaid, to check by eye that the delays
+// follow the hot spots of the workload.
+type TraceHeatmap struct {
+	// Start is the time of the first record, and Bucket the length of a
+	// column of the heatmap.
+	Start  time.Time     `json:"start"`
+	Bucket time.Duration `json:"bucket_ns"`
+
+	// Pages are the rows of the heatmap, lowest address first: the pages
+	// sampled most over the whole trace.
+	Pages []usermem.Addr `json:"pages"`
+
+	// Accesses are the accesses sampled on each page of Pages in each
+	// bucket, indexed by bucket then page.
+	Accesses [][]int `json:"accesses"`
+
+	// Delayed is whether each page of Pages was delayed in each bucket,
+	// indexed like Accesses.
+	Delayed [][]bool `json:"delayed"`
+}
+
+// NewTraceHeatmap returns the heatmap of the trace read from r, in buckets of
+// bucket, of the pages pages sampled most.
+func NewTraceHeatmap(r *TraceReader, bucket time.Duration, pages int) (*TraceHeatmap, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("bucket must be positive, got %v", bucket)
+	}
+	if pages <= 0 {
+		return nil, fmt.Errorf("pages must be positive, got %d", pages)
+	}
+
+	h := &TraceHeatmap{Bucket: bucket}
+	var (
+		accesses []map[usermem.Addr]int
+		delayed  []map[usermem.Addr]bool
+	)
+	totals := make(map[usermem.Addr]int)
+	for n := 1; ; n++ {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading record %d: %v", n, err)
+		}
+		if h.Start.IsZero() {
+			h.Start = rec.Time
+		}
+		// Records written concurrently may be slightly out of order.
+		i := 0
+		if d := rec.Time.Sub(h.Start); d > 0 {
+			i = int(d / bucket)
+		}
+		for len(accesses) <= i {
+			accesses = append(accesses, make(map[usermem.Addr]int))
+			delayed = append(delayed, make(map[usermem.Addr]bool))
+		}
+		for _, t := range rec.Targets {
+			page := t.Addr.RoundDown()
+			switch {
+			case rec.Event == TraceSample:
+				accesses[i][page] += t.Accesses
+				totals[page] += t.Accesses
+			case rec.Delay:
+				delayed[i][page] = true
+			}
+		}
+	}
+
+	for page := range totals {
+		h.Pages = append(h.Pages, page)
+	}
+	sort.Slice(h.Pages, func(i, j int) bool {
+		if ti, tj := totals[h.Pages[i]], totals[h.Pages[j]]; ti != tj {
+			return ti > tj
+		}
+		return h.Pages[i] < h.Pages[j]
+	})
+	if len(h.Pages) > pages {
+		h.Pages = h.Pages[:pages]
+	}
+	sort.Slice(h.Pages, func(i, j int) bool { return h.Pages[i] < h.Pages[j] })
+
+	h.Accesses = make([][]int, len(accesses))
+	h.Delayed = make([][]bool, len(accesses))
+	for i := range accesses {
+		h.Accesses[i] = make([]int, len(h.Pages))
+		h.Delayed[i] = make([]bool, len(h.Pages))
+		for j, page := range h.Pages {
+			h.Accesses[i][j] = accesses[i][page]
+			h.Delayed[i][j] = delayed[i][page]
+		}
+	}
+	return h, nil
+}
+
+// Layout of the SVG rendering, in pixels.
+const (
+	plotCell   = 8
+	plotMargin = 120
+	plotFooter = 40
+)
+
+// WriteSVG renders h as an SVG image to w: a column per bucket and a row per
+// page, red as hot as the page was sampled on a log scale, and outlined in
+// blue where it was delayed.
+func (h *TraceHeatmap) WriteSVG(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	width := plotMargin + len(h.Accesses)*plotCell
+	height := len(h.Pages)*plotCell + plotFooter
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"%d\">\n", width, height, plotCell)
+	fmt.Fprintf(bw, "<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", width, height)
+
+	max := 0
+	for _, row := range h.Accesses {
+		for _, n := range row {
+			if n > max {
+				max = n
+			}
+		}
+	}
+	for j, page := range h.Pages {
+		fmt.Fprintf(bw, "<text x=\"0\" y=\"%d\">%#x</text>\n", (j+1)*plotCell, uint64(page))
+	}
+	for i, row := range h.Accesses {
+		x := plotMargin + i*plotCell
+		for j, n := range row {
+			y := j * plotCell
+			if n > 0 {
+				heat := math.Log1p(float64(n)) / math.Log1p(float64(max))
+				fmt.Fprintf(bw, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"red\" fill-opacity=\"%.3f\"><title>%#x: %d</title></rect>\n", x, y, plotCell, plotCell, heat, uint64(h.Pages[j]), n)
+			}
+			if h.Delayed[i][j] {
+				fmt.Fprintf(bw, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"none\" stroke=\"blue\"/>\n", x, y, plotCell, plotCell)
+			}
+		}
+	}
+	end := h.Start.Add(time.Duration(len(h.Accesses)) * h.Bucket)
+	fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\">from %s</text>\n", plotMargin, height-plotFooter/2, h.Start.UTC().Format(time.RFC3339))
+	fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\">to %s, %v per column</text>\n", plotMargin, height-plotFooter/4, end.UTC().Format(time.RFC3339), h.Bucket)
+	fmt.Fprintf(bw, "</svg>\n")
+	return bw.Flush()
+}
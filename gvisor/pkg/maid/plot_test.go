@@ -0,0 +1,101 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestTraceHeatmap(t *testing.T) {
+	var trace bytes.Buffer
+	w := NewTraceWriter(&trace)
+	for _, r := range []TraceRecord{
+		{
+			Time:    time.Unix(10, 0),
+			Event:   TraceSample,
+			Targets: []Target{{Addr: 0x1234, Accesses: 10}, {Addr: 0x5000, Accesses: 3}, {Addr: 0x9000, Accesses: 1}},
+		},
+		{
+			Time:    time.Unix(10, int64(500*time.Millisecond)),
+			Event:   TraceDecision,
+			Delay:   true,
+			Addr:    0x1000,
+			Reason:  "hot",
+			Targets: []Target{{Addr: 0x1000, Accesses: 10}},
+		},
+		{
+			Time:    time.Unix(12, 0),
+			Event:   TraceSample,
+			Targets: []Target{{Addr: 0x5008, Accesses: 20}},
+		},
+		{
+			Time:   time.Unix(12, 0),
+			Event:  TraceDecision,
+			Reason: "strip",
+		},
+	} {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("Write(%+v) failed: %v", r, err)
+		}
+	}
+
+	h, err := NewTraceHeatmap(NewTraceReader(&trace), time.Second, 2)
+	if err != nil {
+		t.Fatalf("NewTraceHeatmap() failed: %v", err)
+	}
+	if want := time.Unix(10, 0); !h.Start.Equal(want) {
+		t.Errorf("Start = %v, want %v", h.Start, want)
+	}
+	// 0x9000 is sampled least and left out.
+	if want := []usermem.Addr{0x1000, 0x5000}; !reflect.DeepEqual(h.Pages, want) {
+		t.Errorf("Pages = %v, want %v", h.Pages, want)
+	}
+	if want := [][]int{{10, 3}, {0, 0}, {0, 20}}; !reflect.DeepEqual(h.Accesses, want) {
+		t.Errorf("Accesses = %v, want %v", h.Accesses, want)
+	}
+	if want := [][]bool{{true, false}, {false, false}, {false, false}}; !reflect.DeepEqual(h.Delayed, want) {
+		t.Errorf("Delayed = %v, want %v", h.Delayed, want)
+	}
+
+	var svg bytes.Buffer
+	if err := h.WriteSVG(&svg); err != nil {
+		t.Fatalf("WriteSVG() failed: %v", err)
+	}
+	out := svg.String()
+	if !strings.HasPrefix(out, "<svg ") || !strings.HasSuffix(out, "</svg>\n") {
+		t.Errorf("WriteSVG() wrote no SVG document: %q", out)
+	}
+	if got := strings.Count(out, `stroke="blue"`); got != 1 {
+		t.Errorf("WriteSVG() outlined %d delayed cells, want 1", got)
+	}
+	if got := strings.Count(out, `fill="red"`); got != 3 {
+		t.Errorf("WriteSVG() filled %d cells, want 3", got)
+	}
+}
+
+func TestTraceHeatmapBadArgs(t *testing.T) {
+	if _, err := NewTraceHeatmap(NewTraceReader(&bytes.Buffer{}), 0, 8); err == nil {
+		t.Errorf("NewTraceHeatmap() with a zero bucket succeeded")
+	}
+	if _, err := NewTraceHeatmap(NewTraceReader(&bytes.Buffer{}), time.Second, 0); err == nil {
+		t.Errorf("NewTraceHeatmap() with no pages succeeded")
+	}
+}
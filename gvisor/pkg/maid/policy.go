@@ -0,0 +1,423 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	// WarmUp is how long the monitor waits before it starts sampling by
+	// default.
+	WarmUp = 40 * time.Second
+
+	// SampleInterval is the time between two samples while the workload
+	// looks like it has a hot phase.
+	SampleInterval = 500 * time.Millisecond
+
+	// MaxSampleInterval caps the sampling back-off when the workload has
+	// no hot phase.
+	MaxSampleInterval = 30 * time.Second
+
+	// DelayWindow is how long a single delay window lasts.
+	DelayWindow = 8050 * time.Millisecond
+)
+
+// maxIdleWindows is the number of consecutive delay windows without a single
+// observed delayed access after which an address is no longer targeted.
+const maxIdleWindows = 2
+
+// Policy decides from the access count sampled on the hottest page whether
+// the next window should be delayed. It judges samples against the mean and
+// deviation of a window of the last ones, and backs off sampling while
+// nothing is delayed.
+//
+// The same policy runs either in the monitor or, when scheduling is done by
+// the sentry, next to the delayer. In the latter case it is saved with the
+// kernel.
+//
+// +stateify savable
+type Policy struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// history is the window of the last compensated access counts.
+	history *Window
+
+	// delayed records whether the window after the last sample was
+	// delayed.
+	delayed bool
+
+	// index counts the samples seen so far.
+	index int
+
+	// interval is the time to wait before sampling again.
+	interval time.Duration
+
+	// cfg is how interval backs off.
+	cfg Backoff
+
+	// compensation is how samples after a delayed window are corrected,
+	// and slowdown the ratio of the access rate while delayed to the rate
+	// before, as measured so far. slowdown is measured whatever the
+	// compensation, so that it can be switched to at any time.
+	compensation Compensation
+	slowdown     float64
+
+	// thresholds are the access counts samples are judged against.
+	thresholds Thresholds
+
+	// hysteresis keeps decisions from oscillating.
+	hysteresis Hysteresis
+
+	// wait is how the windows p opens wait out their delays.
+	wait WaitMode
+
+	// delaying is whether the last decision was to delay, and dwell the
+	// number of consecutive decisions it has been so.
+	delaying bool
+	dwell    int
+
+	// idle counts, per address, the consecutive delay windows in which the
+	// sentry observed no delayed access.
+	idle map[usermem.Addr]int
+
+	// rules are the per-function policies. They only apply where targets
+	// are symbolized, in the monitor.
+	rules SymbolRules `state:"nosave"`
+
+	// calendar is when the sandbox is protected. It only applies in the
+	// monitor, which gates delays.
+	calendar Calendar `state:"nosave"`
+}
+
+// initialAccesses is the access count the history of a new policy is filled
+// with, so that the first samples are judged against a hot phase.
+const initialAccesses = 500
+
+// NewPolicy returns a policy with an empty history.
+func NewPolicy() *Policy {
+	return &Policy{
+		history:      newHistory(DefaultHistoryWindow, nil),
+		delayed:      true,
+		interval:     SampleInterval,
+		cfg:          DefaultBackoff,
+		compensation: DefaultCompensation,
+		slowdown:     initialSlowdown,
+		thresholds:   DefaultThresholds,
+		delaying:     true,
+		idle:         make(map[usermem.Addr]int),
+	}
+}
+
+// newHistory returns a window over the last size samples holding the last of
+// samples or, if there are none, filled with initialAccesses.
+func newHistory(size int, samples []float64) *Window {
+	w := NewWindow(size)
+	if len(samples) == 0 {
+		for i := 0; i < size; i++ {
+			w.Add(initialAccesses)
+		}
+		return w
+	}
+	if len(samples) > size {
+		samples = samples[len(samples)-size:]
+	}
+	for _, x := range samples {
+		w.Add(x)
+	}
+	return w
+}
+
+// SetHistoryWindow changes the number of samples the policy looks back on,
+// keeping the last ones. n must be valid for ValidateHistoryWindow.
+func (p *Policy) SetHistoryWindow(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n != p.history.Size() {
+		p.history = newHistory(n, p.history.Samples())
+	}
+}
+
+// HistoryWindow returns the number of samples the policy looks back on.
+func (p *Policy) HistoryWindow() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.history.Size()
+}
+
+// SetBackoff changes how the policy backs off sampling. b must be valid.
+func (p *Policy) SetBackoff(b Backoff) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = b
+}
+
+// SetCompensation changes how the policy corrects samples after a delayed
+// window. c must be valid.
+func (p *Policy) SetCompensation(c Compensation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.compensation = c
+}
+
+// Slowdown returns the slowdown of the access rate during delay windows
+// measured so far.
+func (p *Policy) Slowdown() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.slowdown
+}
+
+// SetThresholds changes the access counts samples are judged against. t must
+// be valid.
+func (p *Policy) SetThresholds(t Thresholds) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.thresholds = t
+}
+
+// Thresholds returns the access counts samples are judged against.
+func (p *Policy) Thresholds() Thresholds {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.thresholds
+}
+
+// SetSymbolRules changes the per-function policies of p.
+func (p *Policy) SetSymbolRules(rules SymbolRules) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = rules
+}
+
+// SymbolRules returns the per-function policies of p.
+func (p *Policy) SymbolRules() SymbolRules {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rules
+}
+
+// SetCalendar changes when p protects the sandbox.
+func (p *Policy) SetCalendar(c Calendar) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calendar = c
+}
+
+// Calendar returns when p protects the sandbox.
+func (p *Policy) Calendar() Calendar {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calendar
+}
+
+// SetWaitMode changes how the delay windows p opens wait out their delays.
+func (p *Policy) SetWaitMode(m WaitMode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.wait = m
+}
+
+// WaitMode returns how the delay windows p opens wait out their delays.
+func (p *Policy) WaitMode() WaitMode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.wait
+}
+
+// SetHysteresis changes how the policy keeps decisions from oscillating. h
+// must be valid for the thresholds of p.
+func (p *Policy) SetHysteresis(h Hysteresis) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hysteresis = h
+}
+
+// Decide records the access count sampled on the hottest page and returns
+// whether the next window should be delayed, along with how long to wait
+// before sampling again if it is not.
+func (p *Policy) Decide(accesses int) (bool, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Whether the previous window was delayed, in which case the sample
+	// is biased low by the delays themselves.
+	compensate := p.backoff()
+	p.index++
+
+	last := int(p.history.Last())
+	cmp := accesses
+	if compensate {
+		cmp = p.compensation.correct(accesses, last, p.slowdown)
+		p.slowdown = measureSlowdown(p.slowdown, accesses, last)
+		log.Debugf("[Cijitter] access %d compensated to %d (%v), slowdown now %.2f", accesses, cmp, p.compensation.Kind, p.slowdown)
+	}
+
+	if accesses > p.thresholds.Spike {
+		// Spikes are delayed even while the policy dwells in skipping,
+		// and kept out of the history.
+		p.switchTo(true)
+		return true, p.interval
+	}
+	hot := p.hot(cmp, last)
+	if hot != p.delaying && p.dwell < p.minDwell() {
+		log.Debugf("[Cijitter] dwelling for %d more decisions", p.minDwell()-p.dwell)
+		hot = p.delaying
+	}
+	p.switchTo(hot)
+	if !hot {
+		log.Debugf("[Cijitter] this is a strip, pass... %d\n", accesses)
+		// A compensated count is a guess, only kept to back a delay.
+		if !compensate {
+			p.history.Add(float64(cmp))
+		}
+		p.delayed = false
+		return false, p.interval
+	}
+	p.history.Add(float64(cmp))
+	return true, p.interval
+}
+
+// hot returns whether the compensated access count cmp, sampled after last,
+// is worth delaying. A policy that is delaying windows only stops once the
+// count drops to the off threshold of its hysteresis.
+//
+// Preconditions: p.mu must be locked.
+func (p *Policy) hot(cmp, last int) bool {
+	threshold := p.thresholds.Min
+	// Calibration may have lowered Min below Off.
+	if p.delaying && p.hysteresis.Off != 0 && p.hysteresis.Off < threshold {
+		threshold = p.hysteresis.Off
+	}
+	return cmp > threshold && judgeDelay(p.history, cmp, last)
+}
+
+// minDwell returns the number of decisions the policy must stick to its
+// current state for.
+//
+// Preconditions: p.mu must be locked.
+func (p *Policy) minDwell() int {
+	if p.delaying {
+		return p.hysteresis.MinOn
+	}
+	return p.hysteresis.MinOff
+}
+
+// switchTo records a decision to delay, or not, the next window.
+//
+// Preconditions: p.mu must be locked.
+func (p *Policy) switchTo(delaying bool) {
+	if delaying != p.delaying {
+		p.delaying = delaying
+		p.dwell = 0
+	}
+	p.dwell++
+}
+
+// backoff updates the sampling interval before a new sample is recorded and
+// returns whether the previous window was delayed. Preconditions: p.mu must
+// be locked.
+func (p *Policy) backoff() bool {
+	if p.index == 0 {
+		p.interval = SampleInterval
+		return true
+	}
+	if p.delayed && p.cfg.Reset&ResetOnDelay != 0 {
+		p.interval = SampleInterval
+		return true
+	}
+	p.interval = p.cfg.next(p.interval)
+	return p.delayed
+}
+
+// Skip records that the window the last decision asked for was not delayed.
+func (p *Policy) Skip() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delayed = false
+}
+
+// Delayed records that the window the last decision asked for was delayed.
+func (p *Policy) Delayed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delayed = true
+	if p.cfg.Reset&ResetOnDelay != 0 {
+		p.interval = SampleInterval
+	}
+}
+
+// Record notes that a delay window on addr observed hits delayed accesses.
+func (p *Policy) Record(addr usermem.Addr, hits uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if hits > 0 {
+		delete(p.idle, addr)
+		if p.cfg.Reset&ResetOnHit != 0 {
+			p.interval = SampleInterval
+		}
+		return
+	}
+	p.idle[addr]++
+	if p.idle[addr] == maxIdleWindows {
+		log.Infof("[Cijitter] addr %x is never touched inside the sandbox, dropping it", addr)
+	}
+}
+
+// Dropped returns true if addr has been idle for too many windows.
+func (p *Policy) Dropped(addr usermem.Addr) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.idle[addr] >= maxIdleWindows
+}
+
+// Filter removes dropped addresses from a batch of targets. The primary
+// target is always kept since the policy has already looked at it.
+func (p *Policy) Filter(batch []Target) []Target {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	filtered := make([]Target, 0, len(batch))
+	for i, t := range batch {
+		if i > 0 && p.idle[t.Addr] >= maxIdleWindows {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+	return filtered
+}
+
+// judgeDelay returns true if the access count cmp, sampled after last, is
+// stable and high enough against the history to be a hot phase worth
+// delaying.
+func judgeDelay(history *Window, cmp, last int) bool {
+	mean, stddev := history.With(float64(cmp))
+	log.Debugf("[Cijitter] access is %d, mean %.1f, stddev %.1f over %d samples", cmp, mean, stddev, history.Size())
+
+	diff := cmp - last
+	if diff < 0 {
+		diff = -diff
+	}
+	count := float64(diff) / float64(last)
+	ratio := stddev / mean
+
+	if count <= 0.1 || ratio <= 0.2 || (ratio <= 0.35 && count <= 0.35) {
+		return mean >= 100.0
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyStablePhase(t *testing.T) {
+	p := NewPolicy()
+	for i := 0; i < 2*DefaultHistoryWindow; i++ {
+		delay, idle := p.Decide(500)
+		if !delay {
+			t.Fatalf("sample %d: Decide(500) = false, want true", i)
+		}
+		if idle != SampleInterval {
+			t.Errorf("sample %d: interval %v, want %v", i, idle, SampleInterval)
+		}
+		p.Delayed()
+	}
+}
+
+// decideIdle feeds the policy a sample of 10 accesses, as if every window it
+// asks for were skipped.
+func decideIdle(p *Policy) (bool, time.Duration) {
+	delay, idle := p.Decide(10)
+	if delay {
+		p.Skip()
+	}
+	return delay, idle
+}
+
+func TestPolicyStrip(t *testing.T) {
+	p := NewPolicy()
+	// The initial history is compensated for, but a steadily low access
+	// count must eventually not be delayed.
+	for i := 0; i < DefaultHistoryWindow; i++ {
+		decideIdle(p)
+	}
+	if delay, _ := decideIdle(p); delay {
+		t.Errorf("Decide(10) = true, want false")
+	}
+}
+
+func TestPolicyHistoryWindow(t *testing.T) {
+	// A single low sample in a long window of hot ones is too weak a
+	// signal to stop delaying, but steady low ones are.
+	p := NewPolicy()
+	p.SetHistoryWindow(8)
+	if got := p.HistoryWindow(); got != 8 {
+		t.Fatalf("HistoryWindow() = %d, want 8", got)
+	}
+	for i := 0; i < 8; i++ {
+		p.Decide(500)
+		p.Delayed()
+	}
+	if got := p.State().Accesses; len(got) != 8 {
+		t.Errorf("history of %d samples, want 8", len(got))
+	}
+	strip := false
+	for i := 0; i < 8 && !strip; i++ {
+		strip, _ = decideIdle(p)
+		strip = !strip
+	}
+	if !strip {
+		t.Errorf("steady low samples still delayed")
+	}
+
+	// Shrinking the window keeps the last samples.
+	want := p.State().Accesses
+	p.SetHistoryWindow(MinHistoryWindow)
+	if got := p.State().Accesses; len(got) != MinHistoryWindow || got[1] != want[len(want)-1] {
+		t.Errorf("shrunk history %v, want the last %d of %v", got, MinHistoryWindow, want)
+	}
+}
+
+func TestPolicyBackoff(t *testing.T) {
+	p := NewPolicy()
+	var idle time.Duration
+	for i := 0; i < 10*DefaultHistoryWindow; i++ {
+		_, idle = decideIdle(p)
+	}
+	if idle != MaxSampleInterval {
+		t.Errorf("interval after idle phase %v, want %v", idle, MaxSampleInterval)
+	}
+
+	// A single delayed window restarts the back-off.
+	p.Delayed()
+	if _, idle := p.Decide(10); idle >= MaxSampleInterval {
+		t.Errorf("interval after delayed window %v, want less than %v", idle, MaxSampleInterval)
+	}
+}
+
+func TestPolicyLinearBackoff(t *testing.T) {
+	p := NewPolicy()
+	p.SetBackoff(Backoff{
+		Kind:  BackoffLinear,
+		Step:  time.Second,
+		Max:   3 * time.Second,
+		Reset: ResetOnDelay,
+	})
+	var intervals []time.Duration
+	for i := 0; i < 10*DefaultHistoryWindow; i++ {
+		_, idle := decideIdle(p)
+		intervals = append(intervals, idle)
+	}
+	for i := 1; i < len(intervals); i++ {
+		if d := intervals[i] - intervals[i-1]; d < 0 || d > time.Second {
+			t.Fatalf("interval grew from %v to %v, want steps of at most %v", intervals[i-1], intervals[i], time.Second)
+		}
+	}
+	if last := intervals[len(intervals)-1]; last != 3*time.Second {
+		t.Errorf("interval after idle phase %v, want %v", last, 3*time.Second)
+	}
+}
+
+func TestPolicyResetOnHit(t *testing.T) {
+	p := NewPolicy()
+	p.SetBackoff(Backoff{
+		Kind:   BackoffExponential,
+		Factor: 2,
+		Max:    MaxSampleInterval,
+		Reset:  ResetOnHit,
+	})
+	for i := 0; i < 10*DefaultHistoryWindow; i++ {
+		decideIdle(p)
+	}
+
+	// A delayed window alone no longer resets the back-off...
+	p.Delayed()
+	if _, idle := p.Decide(10); idle != MaxSampleInterval {
+		t.Errorf("interval after delayed window %v, want %v", idle, MaxSampleInterval)
+	}
+
+	// ... but one that observed delayed accesses does.
+	p.Record(0x1000, 1)
+	if _, idle := p.Decide(10); idle >= MaxSampleInterval {
+		t.Errorf("interval after hit %v, want less than %v", idle, MaxSampleInterval)
+	}
+}
+
+func TestParseBackoffReset(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want BackoffReset
+	}{
+		{"delay", ResetOnDelay},
+		{"hit", ResetOnHit},
+		{"delay,hit", ResetOnDelay | ResetOnHit},
+		{"none", 0},
+	} {
+		got, err := ParseBackoffReset(tc.in)
+		if err != nil {
+			t.Errorf("ParseBackoffReset(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseBackoffReset(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+		if back, err := ParseBackoffReset(got.String()); err != nil || back != got {
+			t.Errorf("ParseBackoffReset(%q) = %v, %v, want %v", got.String(), back, err, got)
+		}
+	}
+	if _, err := ParseBackoffReset("never"); err == nil {
+		t.Errorf("ParseBackoffReset(\"never\") succeeded, want error")
+	}
+}
+
+func TestPolicyFeedback(t *testing.T) {
+	p := NewPolicy()
+	batch := []Target{
+		{Addr: 0x1000, Accesses: 100},
+		{Addr: 0x2000, Accesses: 50},
+	}
+	for i := 0; i < maxIdleWindows; i++ {
+		if p.Dropped(0x1000) || p.Dropped(0x2000) {
+			t.Fatalf("window %d: address dropped too early", i)
+		}
+		p.Record(0x1000, 0)
+		p.Record(0x2000, 0)
+	}
+	if !p.Dropped(0x2000) {
+		t.Errorf("Dropped(0x2000) = false after %d idle windows", maxIdleWindows)
+	}
+	if got := p.Filter(batch); len(got) != 1 || got[0] != batch[0] {
+		t.Errorf("Filter() = %+v, want only the primary target", got)
+	}
+
+	p.Record(0x2000, 1)
+	if p.Dropped(0x2000) {
+		t.Errorf("Dropped(0x2000) = true after a delayed access")
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// WindowOpen returns true while a delay window is open.
+func WindowOpen() bool {
+	TAddr.Lock()
+	defer TAddr.Unlock()
+	return TAddr.Flag
+}
+
+// preemptInterval bounds the random time between two preemptions of the
+// delayed task, in nanoseconds. It is accessed atomically.
+var preemptInterval int64
+
+// SetPreemptInterval sets the bound of the random time between two
+// preemptions of the delayed task during delay windows. 0 disables
+// preemption.
+func SetPreemptInterval(max time.Duration) {
+	atomic.StoreInt64(&preemptInterval, int64(max))
+}
+
+// PreemptInterval returns the bound set with SetPreemptInterval.
+func PreemptInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&preemptInterval))
+}
+
+// NextPreempt returns a random time until the next preemption of the delayed
+// task, or 0 if preemption is disabled.
+func NextPreempt() time.Duration {
+	max := atomic.LoadInt64(&preemptInterval)
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(max) + 1)
+}
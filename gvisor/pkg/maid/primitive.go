@@ -0,0 +1,162 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DelayPrimitive is the mechanism the sentry uses to slow down accesses to
+// the target page.
+type DelayPrimitive int32
+
+const (
+	// DelayTrap revokes access to the target with mprotect(PROT_NONE) and
+	// holds the page for the sleep time, so that accesses in the meantime
+	// fault and wait for it to be released.
+	DelayTrap DelayPrimitive = iota
+
+	// DelaySleep revokes access to the target like DelayTrap, but delays
+	// in the fault handler instead. Every trapped access is delayed by the
+	// full sleep time, at the cost of one more sleep per access.
+	DelaySleep
+
+	// DelayFlush evicts the target from the CPU caches on every tick. No
+	// access traps, so it is cheap but only costs a cache miss per access.
+	DelayFlush
+
+	// DelayUnmap drops the target from the platform address space on every
+	// tick, so that the next access faults into the sentry and maps it back
+	// in. It is cheaper than a trap and delays by the cost of the fault.
+	DelayUnmap
+
+	// DelayRecolor moves the target to a different physical frame on every
+	// tick. Accesses are not delayed, but the target's cache set changes, so
+	// eviction sets built against it go stale.
+	DelayRecolor
+)
+
+// String returns DelayPrimitive's string representation.
+func (p DelayPrimitive) String() string {
+	switch p {
+	case DelayTrap:
+		return "mprotect"
+	case DelaySleep:
+		return "sleep"
+	case DelayFlush:
+		return "clflush"
+	case DelayUnmap:
+		return "unmap"
+	case DelayRecolor:
+		return "recolor"
+	default:
+		return fmt.Sprintf("unknown(%d)", p)
+	}
+}
+
+// delayPrimitive is the DelayPrimitive in use. It is accessed atomically.
+var delayPrimitive int32 = int32(DelayTrap)
+
+// SetDelayPrimitive sets the mechanism used to delay accesses.
+func SetDelayPrimitive(p DelayPrimitive) {
+	atomic.StoreInt32(&delayPrimitive, int32(p))
+}
+
+// CurrentDelayPrimitive returns the mechanism used to delay accesses.
+func CurrentDelayPrimitive() DelayPrimitive {
+	return DelayPrimitive(atomic.LoadInt32(&delayPrimitive))
+}
+
+// splitHugePages is 1 if huge pages around targets are split. It is accessed
+// atomically.
+var splitHugePages int32
+
+// SetSplitHugePages sets whether huge pages around targets are split before
+// they are delayed.
+func SetSplitHugePages(split bool) {
+	var v int32
+	if split {
+		v = 1
+	}
+	atomic.StoreInt32(&splitHugePages, v)
+}
+
+// SplitHugePages returns true if huge pages around targets are split before
+// they are delayed.
+func SplitHugePages() bool {
+	return atomic.LoadInt32(&splitHugePages) != 0
+}
+
+// DelayScope is which tasks are stalled by a trapping delay primitive.
+type DelayScope int32
+
+const (
+	// DelaySandbox holds the sentry's fault handling for the whole delay,
+	// so every task that faults meanwhile waits, whether it touched the
+	// target or not.
+	DelaySandbox DelayScope = iota
+
+	// DelayTask only delays the tasks whose access to the target trapped.
+	// Other tasks keep running and faulting freely, which reduces the
+	// collateral slowdown of multi-threaded applications.
+	DelayTask
+)
+
+// String returns DelayScope's string representation.
+func (s DelayScope) String() string {
+	switch s {
+	case DelaySandbox:
+		return "sandbox"
+	case DelayTask:
+		return "task"
+	default:
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+}
+
+// delayScope is the DelayScope in use. It is accessed atomically.
+var delayScope int32 = int32(DelaySandbox)
+
+// SetDelayScope sets which tasks are stalled by trapping delay primitives.
+func SetDelayScope(s DelayScope) {
+	atomic.StoreInt32(&delayScope, int32(s))
+}
+
+// CurrentDelayScope returns which tasks are stalled by trapping delay
+// primitives.
+func CurrentDelayScope() DelayScope {
+	return DelayScope(atomic.LoadInt32(&delayScope))
+}
+
+// TaskDelay returns how long a task whose access to a target trapped at now
+// waits with DelayTask, for a target protected at protectedAt and a delay
+// of sleep. With DelayTrap, the task waits for the rest of the time the
+// target is held, as it would for the worker to release it with
+// DelaySandbox. With DelaySleep, it waits for the full delay.
+func TaskDelay(p DelayPrimitive, sleep time.Duration, protectedAt, now time.Time) time.Duration {
+	switch p {
+	case DelayTrap:
+		if left := protectedAt.Add(sleep).Sub(now); left > 0 {
+			return left
+		}
+		return 0
+	case DelaySleep:
+		return sleep
+	default:
+		return 0
+	}
+}
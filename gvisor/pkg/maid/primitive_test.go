@@ -0,0 +1,42 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskDelay(t *testing.T) {
+	protected := time.Unix(100, 0)
+	sleep := 10 * time.Millisecond
+	for _, tc := range []struct {
+		name      string
+		primitive DelayPrimitive
+		after     time.Duration
+		want      time.Duration
+	}{
+		{"trap waits for release", DelayTrap, 4 * time.Millisecond, 6 * time.Millisecond},
+		{"trap after release", DelayTrap, 15 * time.Millisecond, 0},
+		{"sleep waits fully", DelaySleep, 15 * time.Millisecond, sleep},
+		{"flush doesn't trap", DelayFlush, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := TaskDelay(tc.primitive, sleep, protected, protected.Add(tc.after)); got != tc.want {
+				t.Errorf("TaskDelay(%v, %v) = %v, want %v", tc.primitive, tc.after, got, tc.want)
+			}
+		})
+	}
+}
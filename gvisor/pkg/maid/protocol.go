@@ -0,0 +1,497 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// ProtocolVersion is the version of the monitor to sentry message protocol.
+// It must be bumped whenever Message changes in an incompatible way.
+const ProtocolVersion = 11
+
+// MaxBatchTargets is the maximum number of targets a single message may
+// carry.
+const MaxBatchTargets = 64
+
+// MaxTargetAccesses is the largest access count a target may carry. The
+// monitor samples far fewer accesses per page between two messages.
+const MaxTargetAccesses = 1 << 24
+
+// maxTargetAddr bounds target addresses to the 48-bit user address spaces
+// of all supported platforms. The sentry checks targets against the actual
+// address space of the application once they are translated.
+const maxTargetAddr = usermem.Addr(1) << 47
+
+// MessageType identifies the kind of a Message.
+type MessageType uint8
+
+const (
+	// MessageStart asks the sentry to start delaying. The first target is
+	// the primary target; the whole batch atomically replaces the sentry's
+	// target set.
+	MessageStart MessageType = iota + 1
+
+	// MessageStop asks the sentry to stop delaying. It carries no targets.
+	MessageStop
+
+	// MessageUpdateTargets replaces the sentry's set of target addresses.
+	MessageUpdateTargets
+
+	// MessageHeartbeat tells the sentry that the monitor is still alive. It
+	// carries no targets.
+	MessageHeartbeat
+
+	// MessageSamples carries a raw batch of sampled pages, hottest first,
+	// for the sentry to schedule delays on. It is only accepted when the
+	// sentry runs the scheduling policy.
+	MessageSamples
+
+	// MessageHistory hands the learned history of the monitor's policy to
+	// the sentry, which saves it with the sandbox. It carries no targets.
+	MessageHistory
+
+	// MessageResume is sent by a starting monitor. It is acknowledged once
+	// the sandbox has started; if it was restored from a checkpoint, the
+	// ack carries the history saved with it. It carries no targets.
+	MessageResume
+
+	// MessageHeavyHitters reports the pages the monitor sampled the most
+	// over the life of the container, most accessed first, for the sentry
+	// to serve to queries. It doesn't change the targets.
+	MessageHeavyHitters
+
+	// MessageClear asks the sentry to stop delaying and to forget the
+	// targets and heavy hitters the monitor reported, e.g. because they
+	// belong to a process that is no longer sampled. It carries no
+	// targets.
+	MessageClear
+
+	// MessageStageTargets adds targets to the next target set of the
+	// sentry, without changing the active one. Sets larger than
+	// MaxBatchTargets are staged over several messages.
+	MessageStageTargets
+
+	// MessageSwapTargets makes the staged targets the active target set
+	// of the sentry in a single step, delay windows open or not. It
+	// carries no targets.
+	MessageSwapTargets
+
+	// MessageSuspend is sent by the sentry, unprompted, when the sandbox is
+	// suspended for a pause or a checkpoint and when it resumes. The
+	// Suspended field of the notice tells which. The monitor must not
+	// send it.
+	MessageSuspend
+)
+
+// String implements fmt.Stringer.
+func (t MessageType) String() string {
+	switch t {
+	case MessageStart:
+		return "Start"
+	case MessageStop:
+		return "Stop"
+	case MessageUpdateTargets:
+		return "UpdateTargets"
+	case MessageHeartbeat:
+		return "Heartbeat"
+	case MessageSamples:
+		return "Samples"
+	case MessageHistory:
+		return "History"
+	case MessageResume:
+		return "Resume"
+	case MessageHeavyHitters:
+		return "HeavyHitters"
+	case MessageClear:
+		return "Clear"
+	case MessageStageTargets:
+		return "StageTargets"
+	case MessageSwapTargets:
+		return "SwapTargets"
+	case MessageSuspend:
+		return "Suspend"
+	default:
+		return fmt.Sprintf("unknown(%d)", t)
+	}
+}
+
+// Header is sent at the start of every Message.
+type Header struct {
+	// Version is the protocol version the sender speaks.
+	Version uint32
+
+	// Type is the kind of message.
+	Type MessageType
+
+	// Seq is the sequence number of the message. It is assigned by the
+	// Encoder and strictly increases over the lifetime of a stream. Acks
+	// carry the sequence number of the message they acknowledge.
+	Seq uint64
+}
+
+// Target is a page to delay together with the number of accesses the
+// monitor sampled on it.
+type Target struct {
+	// Addr is the page-aligned target address.
+	Addr usermem.Addr
+
+	// Accesses is the sampled access count. It must be positive and at most
+	// MaxTargetAccesses.
+	Accesses int
+
+	// Lines are the cache lines of the page accesses were sampled on, as
+	// LineOf returns them. It is 0 if the sampler doesn't tell lines
+	// apart, in which case the whole page is meant.
+	Lines uint64 `json:",omitempty"`
+}
+
+// Message is a single message sent by the monitor to the sentry.
+type Message struct {
+	Header
+
+	// Targets are the addresses the message applies to. Their meaning
+	// depends on Type.
+	Targets []Target
+
+	// History is the policy history of MessageHistory.
+	History *PolicyState
+
+	// Drops are the messages the monitor dropped so far, reported by
+	// MessageHeartbeat.
+	Drops MessageDrops
+
+	// SamplerErrors is the number of sampling cycles of the monitor that
+	// failed so far, reported by MessageHeartbeat.
+	SamplerErrors uint64
+
+	// Intensity scales the delays of the window MessageStart opens, up to
+	// MaxIntensity. 0 is the usual delays.
+	Intensity float64
+
+	// Wait is how the window MessageStart opens waits out its delays, as
+	// chosen by the policy of the monitor.
+	Wait WaitMode
+}
+
+// NewStartMessage returns a message asking to delay addr.
+func NewStartMessage(addr usermem.Addr, accesses int) *Message {
+	return NewStartBatchMessage([]Target{{Addr: addr, Accesses: accesses}})
+}
+
+// NewStartBatchMessage returns a message asking to delay a batch of targets,
+// the first of which is the primary target.
+func NewStartBatchMessage(targets []Target) *Message {
+	return &Message{
+		Header:  Header{Version: ProtocolVersion, Type: MessageStart},
+		Targets: targets,
+	}
+}
+
+// NewStopMessage returns a message asking to stop delaying.
+func NewStopMessage() *Message {
+	return &Message{
+		Header: Header{Version: ProtocolVersion, Type: MessageStop},
+	}
+}
+
+// NewClearMessage returns a message asking to forget all targets.
+func NewClearMessage() *Message {
+	return &Message{
+		Header: Header{Version: ProtocolVersion, Type: MessageClear},
+	}
+}
+
+// NewHeartbeatMessage returns a heartbeat message.
+func NewHeartbeatMessage() *Message {
+	return &Message{
+		Header: Header{Version: ProtocolVersion, Type: MessageHeartbeat},
+	}
+}
+
+// NewSamplesMessage returns a message carrying a raw sample batch.
+func NewSamplesMessage(samples []Target) *Message {
+	return &Message{
+		Header:  Header{Version: ProtocolVersion, Type: MessageSamples},
+		Targets: samples,
+	}
+}
+
+// NewHistoryMessage returns a message handing over the policy history h.
+func NewHistoryMessage(h *PolicyState) *Message {
+	return &Message{
+		Header:  Header{Version: ProtocolVersion, Type: MessageHistory},
+		History: h,
+	}
+}
+
+// NewResumeMessage returns a message asking how to resume.
+func NewResumeMessage() *Message {
+	return &Message{
+		Header: Header{Version: ProtocolVersion, Type: MessageResume},
+	}
+}
+
+// NewHeavyHittersMessage returns a message reporting the top set top. At
+// most MaxBatchTargets pages are reported, and counts are capped at
+// MaxTargetAccesses.
+func NewHeavyHittersMessage(top []HeavyHitter) *Message {
+	if len(top) > MaxBatchTargets {
+		top = top[:MaxBatchTargets]
+	}
+	targets := make([]Target, 0, len(top))
+	for _, h := range top {
+		count := h.Count
+		if count > MaxTargetAccesses {
+			count = MaxTargetAccesses
+		}
+		targets = append(targets, Target{Addr: h.Addr, Accesses: int(count)})
+	}
+	return &Message{
+		Header:  Header{Version: ProtocolVersion, Type: MessageHeavyHitters},
+		Targets: targets,
+	}
+}
+
+// NewUpdateTargetsMessage returns a message replacing the target set.
+func NewUpdateTargetsMessage(targets []Target) *Message {
+	return &Message{
+		Header:  Header{Version: ProtocolVersion, Type: MessageUpdateTargets},
+		Targets: targets,
+	}
+}
+
+// NewTargetSetMessages returns the messages replacing the target set with
+// targets, which must not be empty: a single UpdateTargets message if they
+// fit in one, else the StageTargets messages carrying them followed by a
+// SwapTargets message.
+func NewTargetSetMessages(targets []Target) []*Message {
+	if len(targets) <= MaxBatchTargets {
+		return []*Message{NewUpdateTargetsMessage(targets)}
+	}
+	var msgs []*Message
+	for len(targets) > 0 {
+		n := len(targets)
+		if n > MaxBatchTargets {
+			n = MaxBatchTargets
+		}
+		msgs = append(msgs, &Message{
+			Header:  Header{Version: ProtocolVersion, Type: MessageStageTargets},
+			Targets: targets[:n],
+		})
+		targets = targets[n:]
+	}
+	return append(msgs, &Message{
+		Header: Header{Version: ProtocolVersion, Type: MessageSwapTargets},
+	})
+}
+
+// Ack is sent by the sentry in reply to every Message.
+type Ack struct {
+	// Header carries the type of the acknowledged message.
+	Header
+
+	// Addr is the target of the delay window the ack refers to, if any.
+	Addr usermem.Addr
+
+	// Hits is the number of delayed accesses the sentry observed on Addr.
+	// It is only set in acks for MessageStop and MessageClear, which close
+	// a delay window.
+	Hits uint64
+
+	// Err is set if the message was rejected.
+	Err string
+
+	// Restored is set in acks for MessageResume if the sandbox was restored
+	// from a checkpoint, in which case History is the policy history saved
+	// with it, if any.
+	Restored bool
+	History  *PolicyState
+
+	// Generation is the generation of the active target set, in acks for
+	// MessageStart, MessageUpdateTargets, MessageStageTargets and
+	// MessageSwapTargets. It grows every time a target set is swapped in.
+	Generation uint64
+
+	// Suspended is set in MessageSuspend notices while the sandbox is
+	// suspended.
+	Suspended bool
+}
+
+// NewAck returns an Ack for m.
+func NewAck(m *Message) *Ack {
+	return &Ack{Header: Header{Version: ProtocolVersion, Type: m.Type, Seq: m.Seq}}
+}
+
+// Validate checks that m is well formed.
+func (m *Message) Validate() error {
+	if m.Version != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d, want %d", m.Version, ProtocolVersion)
+	}
+	switch m.Type {
+	case MessageStart, MessageUpdateTargets, MessageStageTargets, MessageSamples, MessageHeavyHitters:
+		if len(m.Targets) == 0 {
+			return fmt.Errorf("%v message must carry at least one target", m.Type)
+		}
+		if len(m.Targets) > MaxBatchTargets {
+			return fmt.Errorf("%v message carries %d targets, at most %d allowed", m.Type, len(m.Targets), MaxBatchTargets)
+		}
+	case MessageStop, MessageClear, MessageHeartbeat, MessageHistory, MessageResume, MessageSwapTargets:
+		if len(m.Targets) != 0 {
+			return fmt.Errorf("%v message must not carry targets, got %d", m.Type, len(m.Targets))
+		}
+	case MessageSuspend:
+		return fmt.Errorf("%v messages are only sent by the sentry", m.Type)
+	default:
+		return fmt.Errorf("unknown message type %v", m.Type)
+	}
+	if (m.History != nil) != (m.Type == MessageHistory) {
+		return fmt.Errorf("only History messages carry a history")
+	}
+	if m.History != nil {
+		if err := m.History.Validate(); err != nil {
+			return fmt.Errorf("invalid history: %v", err)
+		}
+	}
+	if m.Drops != (MessageDrops{}) && m.Type != MessageHeartbeat {
+		return fmt.Errorf("only Heartbeat messages carry drop counts")
+	}
+	if m.SamplerErrors != 0 && m.Type != MessageHeartbeat {
+		return fmt.Errorf("only Heartbeat messages carry sampler error counts")
+	}
+	if m.Intensity != 0 {
+		if m.Type != MessageStart {
+			return fmt.Errorf("only Start messages carry an intensity")
+		}
+		if !(m.Intensity > 0 && m.Intensity <= MaxIntensity) {
+			return fmt.Errorf("intensity must be in (0, %d], got %v", MaxIntensity, m.Intensity)
+		}
+	}
+	if m.Wait != WaitSleep {
+		if m.Type != MessageStart {
+			return fmt.Errorf("only Start messages carry a wait mode")
+		}
+		if m.Wait != WaitSpin && m.Wait != WaitHybrid {
+			return fmt.Errorf("unknown wait mode %v", m.Wait)
+		}
+	}
+
+	seen := make(map[usermem.Addr]struct{}, len(m.Targets))
+	for _, t := range m.Targets {
+		if t.Addr == 0 {
+			return fmt.Errorf("target address must not be zero")
+		}
+		if !t.Addr.IsPageAligned() {
+			return fmt.Errorf("target address %#x is not page aligned", t.Addr)
+		}
+		if t.Addr >= maxTargetAddr {
+			return fmt.Errorf("target address %#x is out of range", t.Addr)
+		}
+		if t.Accesses <= 0 || t.Accesses > MaxTargetAccesses {
+			return fmt.Errorf("target %#x has invalid access count %d", t.Addr, t.Accesses)
+		}
+		if _, ok := seen[t.Addr]; ok {
+			return fmt.Errorf("duplicate target address %#x", t.Addr)
+		}
+		seen[t.Addr] = struct{}{}
+	}
+	return nil
+}
+
+// Encoder writes Messages and Acks to a stream.
+type Encoder struct {
+	enc *gob.Encoder
+
+	// seq is the sequence number of the last message written.
+	seq uint64
+}
+
+// NewEncoder returns an Encoder writing to w. A single Encoder must be used
+// for the lifetime of the stream.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{enc: gob.NewEncoder(w)}
+}
+
+// Encode assigns m the next sequence number and writes it to the stream.
+func (e *Encoder) Encode(m *Message) error {
+	e.seq++
+	m.Seq = e.seq
+	return e.enc.Encode(m)
+}
+
+// EncodeAck writes a to the stream.
+func (e *Encoder) EncodeAck(a *Ack) error {
+	return e.enc.Encode(a)
+}
+
+// Decoder reads Messages and Acks from a stream.
+type Decoder struct {
+	dec *gob.Decoder
+
+	// seq is the sequence number of the last message read.
+	seq uint64
+}
+
+// NewDecoder returns a Decoder reading from r. A single Decoder must be used
+// for the lifetime of the stream.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: gob.NewDecoder(r)}
+}
+
+// Decode reads the next message from the stream. It returns io.EOF when the
+// stream ends cleanly. Messages that decode but fail validation are returned
+// together with a *ValidationError; the stream remains usable.
+func (d *Decoder) Decode() (*Message, error) {
+	var m Message
+	if err := d.dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return &m, &ValidationError{Err: err}
+	}
+	if m.Seq <= d.seq {
+		return &m, &ValidationError{Err: fmt.Errorf("stale sequence number %d, last was %d", m.Seq, d.seq)}
+	}
+	d.seq = m.Seq
+	return &m, nil
+}
+
+// DecodeAck reads the next ack from the stream. It returns io.EOF when the
+// stream ends cleanly.
+func (d *Decoder) DecodeAck() (*Ack, error) {
+	var a Ack
+	if err := d.dec.Decode(&a); err != nil {
+		return nil, err
+	}
+	if a.Version != ProtocolVersion {
+		return &a, &ValidationError{Err: fmt.Errorf("unsupported protocol version %d, want %d", a.Version, ProtocolVersion)}
+	}
+	return &a, nil
+}
+
+// ValidationError is returned by Decoder.Decode for messages that were read
+// successfully but are not well formed.
+type ValidationError struct {
+	Err error
+}
+
+// Error implements error.Error.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid message: %v", e.Err)
+}
@@ -0,0 +1,471 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestRoundTrip(t *testing.T) {
+	msgs := []*Message{
+		NewStartMessage(0x7f0000001000, 120),
+		NewStopMessage(),
+		NewUpdateTargetsMessage([]Target{
+			{Addr: 0x1000, Accesses: 1},
+			{Addr: 0x2000, Accesses: 3000},
+		}),
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			t.Fatalf("Encode(%+v) failed: %v", m, err)
+		}
+	}
+
+	dec := NewDecoder(&buf)
+	for _, want := range msgs {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("Decode() failed: %v", err)
+		}
+		if got.Type != want.Type || len(got.Targets) != len(want.Targets) {
+			t.Fatalf("Decode() got %+v, want %+v", got, want)
+		}
+		for i := range want.Targets {
+			if got.Targets[i] != want.Targets[i] {
+				t.Errorf("target %d: got %+v, want %+v", i, got.Targets[i], want.Targets[i])
+			}
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("Decode() at end of stream got err %v, want %v", err, io.EOF)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for i := 0; i < 3; i++ {
+		if err := enc.Encode(NewStopMessage()); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+	}
+
+	dec := NewDecoder(&buf)
+	for want := uint64(1); want <= 3; want++ {
+		m, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("Decode() failed: %v", err)
+		}
+		if m.Seq != want {
+			t.Errorf("Decode() got seq %d, want %d", m.Seq, want)
+		}
+	}
+}
+
+func TestStaleSequence(t *testing.T) {
+	var buf bytes.Buffer
+	// Two independent encoders both start at sequence 1, so the second
+	// message looks like a replay to the decoder.
+	for i := 0; i < 2; i++ {
+		if err := NewEncoder(&buf).Encode(NewStopMessage()); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+	}
+
+	dec := NewDecoder(&buf)
+	if _, err := dec.Decode(); err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if _, err := dec.Decode(); err == nil {
+		t.Errorf("Decode() of replayed message succeeded, want error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		msg   *Message
+		valid bool
+	}{
+		{
+			name:  "start",
+			msg:   NewStartMessage(0x1000, 1),
+			valid: true,
+		},
+		{
+			name: "bad version",
+			msg: &Message{
+				Header:  Header{Version: ProtocolVersion + 1, Type: MessageStart},
+				Targets: []Target{{Addr: 0x1000, Accesses: 1}},
+			},
+		},
+		{
+			name: "swap with targets",
+			msg: &Message{
+				Header:  Header{Version: ProtocolVersion, Type: MessageSwapTargets},
+				Targets: []Target{{Addr: 0x1000, Accesses: 1}},
+			},
+		},
+		{
+			name: "empty stage",
+			msg:  &Message{Header: Header{Version: ProtocolVersion, Type: MessageStageTargets}},
+		},
+		{
+			name:  "heartbeat with drops",
+			msg:   &Message{Header: Header{Version: ProtocolVersion, Type: MessageHeartbeat}, Drops: MessageDrops{Oldest: 3}},
+			valid: true,
+		},
+		{
+			name: "stop with drops",
+			msg:  &Message{Header: Header{Version: ProtocolVersion, Type: MessageStop}, Drops: MessageDrops{Newest: 1}},
+		},
+		{
+			name:  "heartbeat with sampler errors",
+			msg:   &Message{Header: Header{Version: ProtocolVersion, Type: MessageHeartbeat}, SamplerErrors: 2},
+			valid: true,
+		},
+		{
+			name: "stop with sampler errors",
+			msg:  &Message{Header: Header{Version: ProtocolVersion, Type: MessageStop}, SamplerErrors: 2},
+		},
+		{
+			name: "unknown type",
+			msg:  &Message{Header: Header{Version: ProtocolVersion, Type: 42}},
+		},
+		{
+			name: "suspend from the monitor",
+			msg:  &Message{Header: Header{Version: ProtocolVersion, Type: MessageSuspend}},
+		},
+		{
+			name: "start batch",
+			msg: NewStartBatchMessage([]Target{
+				{Addr: 0x1000, Accesses: 10},
+				{Addr: 0x2000, Accesses: 5},
+			}),
+			valid: true,
+		},
+		{
+			name: "heavy hitters",
+			msg: NewHeavyHittersMessage([]HeavyHitter{
+				{Addr: 0x1000, Count: 100},
+				{Addr: 0x3000, Count: 40, Error: 10},
+			}),
+			valid: true,
+		},
+		{
+			name: "oversized batch",
+			msg:  NewUpdateTargetsMessage(make([]Target, MaxBatchTargets+1)),
+		},
+		{
+			name: "start without target",
+			msg:  &Message{Header: Header{Version: ProtocolVersion, Type: MessageStart}},
+		},
+		{
+			name: "stop with target",
+			msg: &Message{
+				Header:  Header{Version: ProtocolVersion, Type: MessageStop},
+				Targets: []Target{{Addr: 0x1000, Accesses: 1}},
+			},
+		},
+		{
+			name:  "clear",
+			msg:   NewClearMessage(),
+			valid: true,
+		},
+		{
+			name: "clear with target",
+			msg: &Message{
+				Header:  Header{Version: ProtocolVersion, Type: MessageClear},
+				Targets: []Target{{Addr: 0x1000, Accesses: 1}},
+			},
+		},
+		{
+			name: "zero address",
+			msg:  NewStartMessage(0, 1),
+		},
+		{
+			name: "unaligned address",
+			msg:  NewStartMessage(0x1001, 1),
+		},
+		{
+			name: "zero accesses",
+			msg:  NewStartMessage(0x1000, 0),
+		},
+		{
+			name: "empty update",
+			msg:  NewUpdateTargetsMessage(nil),
+		},
+		{
+			name: "duplicate targets",
+			msg: NewUpdateTargetsMessage([]Target{
+				{Addr: usermem.PageSize, Accesses: 1},
+				{Addr: usermem.PageSize, Accesses: 2},
+			}),
+		},
+		{
+			name: "too many accesses",
+			msg:  NewStartMessage(0x1000, MaxTargetAccesses+1),
+		},
+		{
+			name: "address out of range",
+			msg:  NewStartMessage(maxTargetAddr, 1),
+		},
+		{
+			name:  "history",
+			msg:   NewHistoryMessage(&PolicyState{Accesses: []int{10, 20}, Index: 2}),
+			valid: true,
+		},
+		{
+			name: "history with negative index",
+			msg:  NewHistoryMessage(&PolicyState{Index: -1}),
+		},
+		{
+			name: "history too long",
+			msg:  NewHistoryMessage(&PolicyState{Accesses: make([]int, MaxHistoryWindow+1)}),
+		},
+		{
+			name: "history with unaligned idle address",
+			msg:  NewHistoryMessage(&PolicyState{Idle: map[usermem.Addr]int{0x1001: 1}}),
+		},
+		{
+			name: "history with slowdown above 1",
+			msg:  NewHistoryMessage(&PolicyState{Slowdown: 1.5}),
+		},
+		{
+			name: "start with wait mode",
+			msg: &Message{
+				Header:  Header{Version: ProtocolVersion, Type: MessageStart},
+				Targets: []Target{{Addr: 0x1000, Accesses: 1}},
+				Wait:    WaitHybrid,
+			},
+			valid: true,
+		},
+		{
+			name: "start with unknown wait mode",
+			msg: &Message{
+				Header:  Header{Version: ProtocolVersion, Type: MessageStart},
+				Targets: []Target{{Addr: 0x1000, Accesses: 1}},
+				Wait:    WaitHybrid + 1,
+			},
+		},
+		{
+			name: "stop with wait mode",
+			msg: &Message{
+				Header: Header{Version: ProtocolVersion, Type: MessageStop},
+				Wait:   WaitSpin,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.msg.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("Validate() failed: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("Validate() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRejectOutsideAddrSpace(t *testing.T) {
+	SetAddrSpace(0x10000, 0x20000)
+	defer SetAddrSpace(0, 0)
+
+	before := CurrentStats().RejectedMessages
+	if ack := Listen_target_addrs(NewUpdateTargetsMessage([]Target{{Addr: 0x30000, Accesses: 1}})); ack.Err == "" {
+		t.Errorf("Listen_target_addrs() accepted target outside of the address space")
+	}
+	if ack := Listen_target_addrs(NewStartMessage(0, 1)); ack.Err == "" {
+		t.Errorf("Listen_target_addrs() accepted malformed message")
+	}
+	if got := CurrentStats().RejectedMessages - before; got != 2 {
+		t.Errorf("RejectedMessages increased by %d, want 2", got)
+	}
+	if ack := Listen_target_addrs(NewUpdateTargetsMessage([]Target{{Addr: 0x10000, Accesses: 1}})); ack.Err != "" {
+		t.Errorf("Listen_target_addrs() rejected valid target: %s", ack.Err)
+	}
+}
+
+func TestClear(t *testing.T) {
+	if ack := Listen_target_addrs(NewStartMessage(0x1000, 10)); ack.Err != "" {
+		t.Fatalf("Start rejected: %s", ack.Err)
+	}
+	if ack := Listen_target_addrs(NewHeavyHittersMessage([]HeavyHitter{{Addr: 0x2000, Count: 5}})); ack.Err != "" {
+		t.Fatalf("HeavyHitters rejected: %s", ack.Err)
+	}
+	ack := Listen_target_addrs(NewClearMessage())
+	if ack.Err != "" {
+		t.Fatalf("Clear rejected: %s", ack.Err)
+	}
+	if ack.Addr != 0x1000 {
+		t.Errorf("Clear ack addr = %#x, want %#x", ack.Addr, 0x1000)
+	}
+	TAddr.Lock()
+	flag := TAddr.Flag
+	TAddr.Unlock()
+	if flag {
+		t.Errorf("still delaying after Clear")
+	}
+	if top := CurrentHeavyHitters(); len(top) != 0 {
+		t.Errorf("CurrentHeavyHitters() = %v after Clear, want none", top)
+	}
+}
+
+func TestStartBatchDelaysEveryTarget(t *testing.T) {
+	batch := []Target{
+		{Addr: 0x1000, Accesses: 10},
+		{Addr: 0x3000, Accesses: 2},
+		{Addr: 0x2000, Accesses: 7},
+	}
+	if ack := Listen_target_addrs(NewStartBatchMessage(batch)); ack.Err != "" {
+		t.Fatalf("Start rejected: %s", ack.Err)
+	}
+	defer stopDelay()
+
+	want := []usermem.Addr{0x1000, 0x2000, 0x3000}
+	got := DelayPages()
+	if len(got) != len(want) {
+		t.Fatalf("DelayPages() = %x, want %x", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("DelayPages() = %x, want %x", got, want)
+		}
+	}
+	for _, addr := range want {
+		if !IsDelayed(addr) {
+			t.Errorf("IsDelayed(%#x) = false for a target of the batch", addr)
+		}
+	}
+	if IsDelayed(0x4000) {
+		t.Errorf("IsDelayed(0x4000) = true, not a target")
+	}
+
+	stopDelay()
+	if pages := DelayPages(); pages != nil {
+		t.Errorf("DelayPages() = %x after Stop, want none", pages)
+	}
+	if IsDelayed(0x1000) {
+		t.Errorf("IsDelayed(0x1000) = true after Stop")
+	}
+}
+
+// activeTargets returns the active target set of the sentry.
+func activeTargets() map[usermem.Addr]int {
+	TAddrs.Lock()
+	defer TAddrs.Unlock()
+	addrs := make(map[usermem.Addr]int, len(TAddrs.Addrs))
+	for addr, n := range TAddrs.Addrs {
+		addrs[addr] = n
+	}
+	return addrs
+}
+
+func TestStageAndSwapTargets(t *testing.T) {
+	ack := Listen_target_addrs(NewStartMessage(0x1000, 10))
+	if ack.Err != "" {
+		t.Fatalf("Start rejected: %s", ack.Err)
+	}
+	defer stopDelay()
+	gen := ack.Generation
+
+	// A set larger than a message is staged over several of them, while
+	// the window keeps delaying the previous set.
+	var targets []Target
+	for i := 0; i < MaxBatchTargets+2; i++ {
+		targets = append(targets, Target{Addr: usermem.Addr(0x10000 + i*usermem.PageSize), Accesses: 1})
+	}
+	msgs := NewTargetSetMessages(targets)
+	if len(msgs) != 3 || msgs[2].Type != MessageSwapTargets {
+		t.Fatalf("NewTargetSetMessages() = %d messages, want 2 stages and a swap", len(msgs))
+	}
+	for _, m := range msgs[:2] {
+		if ack := Listen_target_addrs(m); ack.Err != "" || ack.Generation != gen {
+			t.Fatalf("%v ack %+v, want generation %d", m.Type, ack, gen)
+		}
+		if got := activeTargets(); len(got) != 1 || !IsDelayed(0x1000) {
+			t.Fatalf("active targets %v while staging, want the started one", got)
+		}
+	}
+	ack = Listen_target_addrs(msgs[2])
+	if ack.Err != "" || ack.Generation != gen+1 {
+		t.Fatalf("SwapTargets ack %+v, want generation %d", ack, gen+1)
+	}
+	if got := activeTargets(); len(got) != len(targets) {
+		t.Errorf("%d active targets after the swap, want %d", len(got), len(targets))
+	}
+	// The window and its primary target are left alone.
+	if !IsDelayed(0x1000) || !IsDelayed(targets[len(targets)-1].Addr) {
+		t.Errorf("primary or new targets not delayed after the swap")
+	}
+
+	// Nothing is left staged to swap in.
+	if ack := Listen_target_addrs(NewTargetSetMessages(targets)[2]); ack.Err == "" {
+		t.Errorf("SwapTargets without staged targets accepted")
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(NewStartMessage(0x1000, 0)); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if err := enc.Encode(NewStopMessage()); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	dec := NewDecoder(&buf)
+	if _, err := dec.Decode(); err == nil {
+		t.Fatalf("Decode() succeeded, want validation error")
+	} else if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("Decode() got err %v, want *ValidationError", err)
+	}
+
+	// The stream must remain usable after an invalid message.
+	m, err := dec.Decode()
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if m.Type != MessageStop {
+		t.Errorf("Decode() got type %v, want %v", m.Type, MessageStop)
+	}
+}
+
+func TestAckRoundTrip(t *testing.T) {
+	want := NewAck(NewStopMessage())
+	want.Addr = 0x1000
+	want.Hits = 17
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAck(want); err != nil {
+		t.Fatalf("EncodeAck failed: %v", err)
+	}
+	got, err := NewDecoder(&buf).DecodeAck()
+	if err != nil {
+		t.Fatalf("DecodeAck failed: %v", err)
+	}
+	if *got != *want {
+		t.Errorf("DecodeAck() got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DropPolicy defines what the monitor does with a message to the sentry when
+// its queue is full.
+type DropPolicy int
+
+const (
+	// DropNone blocks the sender until there is room.
+	DropNone DropPolicy = iota
+
+	// DropOldest drops the oldest droppable message queued to make room.
+	DropOldest
+
+	// DropNewest drops the message sent.
+	DropNewest
+)
+
+// String returns DropPolicy's string representation.
+func (p DropPolicy) String() string {
+	switch p {
+	case DropNone:
+		return "block"
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	default:
+		return fmt.Sprintf("unknown(%d)", p)
+	}
+}
+
+// MessageDrops counts the messages to the sentry the monitor dropped, by
+// policy.
+type MessageDrops struct {
+	Oldest uint64
+	Newest uint64
+}
+
+// Droppable returns whether m may be dropped when the queue is full: it only
+// refreshes state that the next message of its type replaces. Messages that
+// open, close or build a delay window are never dropped.
+func (m *Message) Droppable() bool {
+	switch m.Type {
+	case MessageHeartbeat, MessageSamples, MessageHistory, MessageHeavyHitters, MessageUpdateTargets:
+		return true
+	default:
+		return false
+	}
+}
+
+// MessageQueue is a bounded queue of messages to the sentry, which drops
+// messages according to its DropPolicy when full.
+type MessageQueue struct {
+	size   int
+	policy DropPolicy
+
+	// ready and space are signalled when messages are queued, resp.
+	// taken.
+	ready chan struct{}
+	space chan struct{}
+
+	mu    sync.Mutex
+	msgs  []*Message
+	drops MessageDrops
+}
+
+// NewMessageQueue returns a queue of at most size messages, which must be
+// positive.
+func NewMessageQueue(size int, policy DropPolicy) *MessageQueue {
+	return &MessageQueue{
+		size:   size,
+		policy: policy,
+		ready:  make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+	}
+}
+
+// signal signals c without blocking.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// Send queues m. It returns false if done was closed before m could be
+// queued; m being dropped by the policy isn't an error.
+func (q *MessageQueue) Send(done <-chan struct{}, m *Message) bool {
+	q.mu.Lock()
+	for len(q.msgs) >= q.size {
+		if q.drop(m) {
+			continue
+		}
+		if m.Droppable() && q.policy == DropNewest {
+			q.drops.Newest++
+			q.mu.Unlock()
+			return true
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.space:
+		case <-done:
+			return false
+		}
+		q.mu.Lock()
+	}
+	q.msgs = append(q.msgs, m)
+	if len(q.msgs) < q.size {
+		// Let the next blocked sender in.
+		signal(q.space)
+	}
+	q.mu.Unlock()
+	signal(q.ready)
+	return true
+}
+
+// drop drops the oldest droppable message queued to make room for m, if the
+// policy allows it, and returns whether it did.
+//
+// Preconditions: q.mu must be locked.
+func (q *MessageQueue) drop(m *Message) bool {
+	if q.policy != DropOldest || !m.Droppable() {
+		return false
+	}
+	for i, old := range q.msgs {
+		if old.Droppable() {
+			q.msgs = append(q.msgs[:i], q.msgs[i+1:]...)
+			q.drops.Oldest++
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the oldest message queued, waiting for one if there is none.
+// It returns false if done was closed first.
+func (q *MessageQueue) Next(done <-chan struct{}) (*Message, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.msgs) != 0 {
+			m := q.msgs[0]
+			q.msgs[0] = nil
+			q.msgs = q.msgs[1:]
+			if len(q.msgs) != 0 {
+				signal(q.ready)
+			}
+			q.mu.Unlock()
+			signal(q.space)
+			return m, true
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.ready:
+		case <-done:
+			return nil, false
+		}
+	}
+}
+
+// Drops returns the number of messages dropped so far.
+func (q *MessageQueue) Drops() MessageDrops {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.drops
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+// drain returns the types of the messages queued in q.
+func drain(q *MessageQueue) []MessageType {
+	var types []MessageType
+	done := make(chan struct{})
+	close(done)
+	for {
+		q.mu.Lock()
+		n := len(q.msgs)
+		q.mu.Unlock()
+		if n == 0 {
+			return types
+		}
+		m, _ := q.Next(done)
+		types = append(types, m.Type)
+	}
+}
+
+func TestMessageQueueDropOldest(t *testing.T) {
+	q := NewMessageQueue(2, DropOldest)
+	q.Send(nil, NewStopMessage())
+	q.Send(nil, NewHeartbeatMessage())
+	q.Send(nil, NewHistoryMessage(&PolicyState{}))
+	got := drain(q)
+	if len(got) != 2 || got[0] != MessageStop || got[1] != MessageHistory {
+		t.Errorf("queued %v, want the stop and the newest message", got)
+	}
+	if d := q.Drops(); d.Oldest != 1 || d.Newest != 0 {
+		t.Errorf("Drops() = %+v, want one oldest", d)
+	}
+}
+
+func TestMessageQueueDropNewest(t *testing.T) {
+	q := NewMessageQueue(1, DropNewest)
+	q.Send(nil, NewHeartbeatMessage())
+	q.Send(nil, NewHistoryMessage(&PolicyState{}))
+	if got := drain(q); len(got) != 1 || got[0] != MessageHeartbeat {
+		t.Errorf("queued %v, want the oldest message", got)
+	}
+	if d := q.Drops(); d.Oldest != 0 || d.Newest != 1 {
+		t.Errorf("Drops() = %+v, want one newest", d)
+	}
+}
+
+func TestMessageQueueNeverDropsWindows(t *testing.T) {
+	for _, policy := range []DropPolicy{DropNone, DropOldest, DropNewest} {
+		q := NewMessageQueue(1, policy)
+		q.Send(nil, NewStartMessage(0x1000, 1))
+
+		// A stop waits for room, whatever the policy.
+		sent := make(chan bool, 1)
+		go func() { sent <- q.Send(nil, NewStopMessage()) }()
+		select {
+		case <-sent:
+			t.Fatalf("%v: stop queued in a full queue", policy)
+		case <-time.After(10 * time.Millisecond):
+		}
+		if m, _ := q.Next(nil); m.Type != MessageStart {
+			t.Errorf("%v: Next() = %v, want Start", policy, m.Type)
+		}
+		select {
+		case <-sent:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: stop still blocked after Next()", policy)
+		}
+		if m, _ := q.Next(nil); m.Type != MessageStop {
+			t.Errorf("%v: Next() = %v, want Stop", policy, m.Type)
+		}
+		if d := q.Drops(); d != (MessageDrops{}) {
+			t.Errorf("%v: Drops() = %+v, want none", policy, d)
+		}
+	}
+}
+
+func TestMessageQueueDone(t *testing.T) {
+	q := NewMessageQueue(1, DropNone)
+	q.Send(nil, NewHeartbeatMessage())
+	done := make(chan struct{})
+	close(done)
+	if q.Send(done, NewHeartbeatMessage()) {
+		t.Errorf("Send() = true on a full queue after done")
+	}
+	q.Next(nil)
+	if _, ok := q.Next(done); ok {
+		t.Errorf("Next() = true on an empty queue after done")
+	}
+}
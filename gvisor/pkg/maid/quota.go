@@ -0,0 +1,39 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"time"
+)
+
+// MaxQuotaCredit bounds the CPU quota credited for delays, as a multiple of
+// the base quota, so that a sandbox delayed most of the time can't claim the
+// whole host.
+const MaxQuotaCredit = 1.0
+
+// CompensatedQuota returns the CPU quota per period of a cgroup whose base
+// quota is base, credited with delayed, the time the sandbox was delayed
+// over the last elapsed. The credit is the delay time per period, at most
+// MaxQuotaCredit times base.
+func CompensatedQuota(base, period, delayed, elapsed time.Duration) time.Duration {
+	if base <= 0 || period <= 0 || delayed <= 0 || elapsed <= 0 {
+		return base
+	}
+	credit := time.Duration(float64(delayed) * float64(period) / float64(elapsed))
+	if max := time.Duration(float64(base) * MaxQuotaCredit); credit > max {
+		credit = max
+	}
+	return base + credit
+}
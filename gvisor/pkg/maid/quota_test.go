@@ -0,0 +1,41 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompensatedQuota(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		base    time.Duration
+		delayed time.Duration
+		want    time.Duration
+	}{
+		{name: "no delay", base: 50 * time.Millisecond, delayed: 0, want: 50 * time.Millisecond},
+		// 1s of delays over 10s is 10ms per 100ms period.
+		{name: "credit", base: 50 * time.Millisecond, delayed: time.Second, want: 60 * time.Millisecond},
+		{name: "capped", base: 50 * time.Millisecond, delayed: 8 * time.Second, want: 100 * time.Millisecond},
+		{name: "unlimited", base: -1, delayed: time.Second, want: -1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CompensatedQuota(tc.base, 100*time.Millisecond, tc.delayed, 10*time.Second); got != tc.want {
+				t.Errorf("CompensatedQuota = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
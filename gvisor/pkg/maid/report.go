@@ -0,0 +1,163 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// ReportTopRegions is the number of most targeted regions an exit report
+// lists.
+const ReportTopRegions = 10
+
+// targetedCounters is the number of pages tracked to find the most targeted
+// ones. Tracking more pages than are reported keeps the counts of the
+// reported ones close to exact.
+const targetedCounters = 4 * ReportTopRegions
+
+// targeted tracks the pages the delay windows targeted the most, with their
+// symbols as of the first window on them: by the time the report is made,
+// the processes that mapped them may be gone.
+var targeted = struct {
+	mu      sync.Mutex
+	top     *TopK
+	symbols map[usermem.Addr]Symbol
+}{
+	top:     NewTopK(targetedCounters),
+	symbols: make(map[usermem.Addr]Symbol),
+}
+
+// recordWindowTargets counts a window on each of targets, application
+// addresses.
+func recordWindowTargets(targets []Target) {
+	symbolizerMu.Lock()
+	s := symbolizer
+	symbolizerMu.Unlock()
+
+	targeted.mu.Lock()
+	defer targeted.mu.Unlock()
+	for _, t := range targets {
+		page := t.Addr.RoundDown()
+		targeted.top.Add(page, 1)
+		if _, ok := targeted.symbols[page]; ok || !targeted.top.tracks(page) {
+			continue
+		}
+		sym := Symbol{Addr: page}
+		if s != nil {
+			sym.Path, sym.Offset, sym.Mapped = s(page)
+		}
+		targeted.symbols[page] = sym
+	}
+	// Forget the pages evicted from top.
+	if len(targeted.symbols) > 2*targetedCounters {
+		symbols := make(map[usermem.Addr]Symbol, targetedCounters)
+		for _, hh := range targeted.top.Top() {
+			if sym, ok := targeted.symbols[hh.Addr]; ok {
+				symbols[hh.Addr] = sym
+			}
+		}
+		targeted.symbols = symbols
+	}
+}
+
+// TargetedRegion is a page delay windows targeted, as listed in a Report.
+type TargetedRegion struct {
+	// Symbol is what the page belongs to. Its Addr is the application
+	// address of the page.
+	Symbol
+
+	// Windows is the number of windows that targeted the page. It may
+	// overestimate it for pages outside of the most targeted ones.
+	Windows uint64 `json:"windows"`
+}
+
+// Report summarizes what the defense did over the life of a sandbox, as a
+// self-contained record of the run.
+type Report struct {
+	// Container is the container the report was made for, on its exit.
+	Container string `json:"container"`
+
+	// Windows is the number of delay windows opened.
+	Windows uint64 `json:"windows"`
+
+	// DelayedAccesses is the number of accesses to targets that were
+	// delayed.
+	DelayedAccesses uint64 `json:"delayedAccesses"`
+
+	// Delay is the total time tasks of the sandbox were delayed for.
+	Delay time.Duration `json:"delay"`
+
+	// ThrottledDelays is the number of delays cut by the delay budget.
+	ThrottledDelays uint64 `json:"throttledDelays"`
+
+	// RejectedMessages is the number of malformed monitor messages.
+	RejectedMessages uint64 `json:"rejectedMessages"`
+
+	// SamplerErrors is the number of sampling cycles of the monitor that
+	// failed, as of its last heartbeat. It stays 0 without heartbeats.
+	SamplerErrors uint64 `json:"samplerErrors"`
+
+	// TopRegions are the pages the windows targeted the most, most
+	// targeted first, at most ReportTopRegions of them.
+	TopRegions []TargetedRegion `json:"topRegions"`
+}
+
+// CurrentReport returns the report of the sandbox since the sentry started,
+// made on the exit of container cid.
+func CurrentReport(cid string) Report {
+	st := CurrentStats()
+	r := Report{
+		Container:        cid,
+		Windows:          st.Windows,
+		DelayedAccesses:  st.DelayedAccesses,
+		Delay:            time.Duration(st.DelayNanos),
+		ThrottledDelays:  st.ThrottledDelays,
+		RejectedMessages: st.RejectedMessages,
+		SamplerErrors:    st.MonitorSamplerErrors,
+	}
+	targeted.mu.Lock()
+	defer targeted.mu.Unlock()
+	for _, hh := range targeted.top.Top() {
+		if len(r.TopRegions) == ReportTopRegions {
+			break
+		}
+		sym, ok := targeted.symbols[hh.Addr]
+		if !ok {
+			sym = Symbol{Addr: hh.Addr}
+		}
+		r.TopRegions = append(r.TopRegions, TargetedRegion{Symbol: sym, Windows: hh.Count})
+	}
+	return r
+}
+
+// String returns r as the lines of a log entry.
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "exit report of %q: %d windows, %d delayed accesses, %v of delay, %d throttled delays, %d rejected messages, %d sampler errors",
+		r.Container, r.Windows, r.DelayedAccesses, r.Delay, r.ThrottledDelays, r.RejectedMessages, r.SamplerErrors)
+	for i, region := range r.TopRegions {
+		fmt.Fprintf(&b, "\n  #%d %v", i+1, region.Symbol)
+		if region.Mapped {
+			fmt.Fprintf(&b, " at %#x", region.Addr)
+		}
+		fmt.Fprintf(&b, ": %d windows", region.Windows)
+	}
+	return b.String()
+}
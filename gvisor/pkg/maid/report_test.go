@@ -0,0 +1,76 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// resetTargeted forgets the targets of past windows.
+func resetTargeted() {
+	targeted.mu.Lock()
+	defer targeted.mu.Unlock()
+	targeted.top = NewTopK(targetedCounters)
+	targeted.symbols = make(map[usermem.Addr]Symbol)
+}
+
+func TestReportTopRegions(t *testing.T) {
+	resetTargeted()
+	defer resetTargeted()
+	SetAddrSymbolizer(func(addr usermem.Addr) (string, uint64, bool) {
+		if addr >= 0x400000 && addr < 0x500000 {
+			return "/usr/lib/libcrypto.so", uint64(addr - 0x400000), true
+		}
+		return "", 0, false
+	})
+	for i := 0; i < 3; i++ {
+		recordWindowTargets([]Target{{Addr: 0x401234, Accesses: 1}, {Addr: 0x800000, Accesses: 1}})
+	}
+	recordWindowTargets([]Target{{Addr: 0x800000, Accesses: 1}})
+	// The symbols are those of the first window, even once the mappings
+	// are gone.
+	SetAddrSymbolizer(nil)
+
+	r := CurrentReport("c")
+	if len(r.TopRegions) != 2 {
+		t.Fatalf("TopRegions = %+v, want 2 regions", r.TopRegions)
+	}
+	if got := r.TopRegions[0]; got.Addr != 0x800000 || got.Windows != 4 || got.Mapped {
+		t.Errorf("TopRegions[0] = %+v, want 4 windows on unmapped 0x800000", got)
+	}
+	if got := r.TopRegions[1]; got.Addr != 0x401000 || got.Windows != 3 || got.String() != "/usr/lib/libcrypto.so+0x1000" {
+		t.Errorf("TopRegions[1] = %+v, want 3 windows on /usr/lib/libcrypto.so+0x1000", got)
+	}
+	if s := r.String(); !strings.Contains(s, "#2 /usr/lib/libcrypto.so+0x1000 at 0x401000: 3 windows") {
+		t.Errorf("String() = %q, missing the second region", s)
+	}
+}
+
+func TestReportBoundedRegions(t *testing.T) {
+	resetTargeted()
+	defer resetTargeted()
+	for i := 0; i < 10*targetedCounters; i++ {
+		recordWindowTargets([]Target{{Addr: usermem.Addr(0x100000 + i*usermem.PageSize), Accesses: 1}})
+	}
+	if n := len(targeted.symbols); n > 2*targetedCounters {
+		t.Errorf("%d symbols kept, want at most %d", n, 2*targetedCounters)
+	}
+	if n := len(CurrentReport("c").TopRegions); n != ReportTopRegions {
+		t.Errorf("report lists %d regions, want %d", n, ReportTopRegions)
+	}
+}
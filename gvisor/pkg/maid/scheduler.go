@@ -0,0 +1,162 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// Scheduler runs a Policy inside the sentry on raw samples streamed by the
+// monitor, and starts and stops delay windows itself. This saves the round
+// trip to the monitor between a sample and the delay it triggers.
+type Scheduler struct {
+	policy *Policy
+
+	// samples holds the latest sample batch that was not consumed yet.
+	samples chan []Target
+
+	// stop is used to notify the scheduler that it should stop.
+	stop chan struct{}
+
+	// done is closed when the scheduler has stopped.
+	done chan struct{}
+}
+
+// NewScheduler creates a scheduler running p.
+func NewScheduler(p *Policy) *Scheduler {
+	return &Scheduler{
+		policy:  p,
+		samples: make(chan []Target, 1),
+	}
+}
+
+// Start starts the scheduler.
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop()
+}
+
+// Stop stops the scheduler, closing any open delay window, and waits for it
+// to finish.
+func (s *Scheduler) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+// Submit hands a sample batch, hottest page first, to the scheduler. A batch
+// that was submitted earlier but not consumed yet is replaced.
+func (s *Scheduler) Submit(batch []Target) {
+	for {
+		select {
+		case s.samples <- batch:
+			return
+		case <-s.samples:
+		}
+	}
+}
+
+// Clear discards a sample batch that was submitted but not consumed yet.
+func (s *Scheduler) Clear() {
+	select {
+	case <-s.samples:
+	default:
+	}
+}
+
+func (s *Scheduler) loop() {
+	defer close(s.done)
+	for {
+		var batch []Target
+		select {
+		case <-s.stop:
+			return
+		case batch = <-s.samples:
+		}
+
+		delay, idle := s.policy.Decide(batch[0].Accesses)
+		if delay && s.policy.Dropped(batch[0].Addr) {
+			log.Debugf("[Cijitter] addr %x was never touched in past windows, pass...", batch[0].Addr)
+			s.policy.Skip()
+			delay = false
+		}
+		if !delay {
+			if !s.wait(idle) {
+				return
+			}
+			continue
+		}
+
+		startDelay(widenTargets(s.policy.Filter(batch)), batch[0].Addr, WindowIntensity(CurrentEntropyMapping(), batch), s.policy.WaitMode())
+		stopped := !s.wait(DelayWindow)
+		addr, hits := stopDelay()
+		log.Debugf("[Cijitter] window on %x observed %d delayed accesses\n", addr, hits)
+		if stopped {
+			return
+		}
+		s.policy.Record(addr, hits)
+		s.policy.Delayed()
+
+		// Keep sampling stable.
+		if !s.wait(SampleInterval) {
+			return
+		}
+	}
+}
+
+// wait waits for d and then discards the samples taken meanwhile, which are
+// stale by the time the next decision is made. It returns false if the
+// scheduler was stopped.
+func (s *Scheduler) wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-s.stop:
+		return false
+	case <-t.C:
+	}
+	select {
+	case <-s.samples:
+	default:
+	}
+	return true
+}
+
+var (
+	schedMu sync.Mutex
+	sched   *Scheduler
+)
+
+// SetScheduler installs the scheduler that receives sample batches from the
+// monitor. A nil scheduler means that the monitor schedules delays itself.
+func SetScheduler(s *Scheduler) {
+	schedMu.Lock()
+	defer schedMu.Unlock()
+	sched = s
+}
+
+// currentScheduler returns the installed scheduler, if any.
+func currentScheduler() *Scheduler {
+	schedMu.Lock()
+	defer schedMu.Unlock()
+	return sched
+}
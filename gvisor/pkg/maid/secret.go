@@ -0,0 +1,103 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Applications opt memory into protection with madvise(2) and these advice
+// values, which Linux doesn't use. Secret pages are delayed whether or not the
+// monitor sampled them, and whether or not a delay window is open.
+const (
+	// MadvSecret marks a range as secret.
+	MadvSecret = 0x434a
+
+	// MadvNoSecret unmarks a range.
+	MadvNoSecret = 0x434b
+)
+
+// MaxSecretPages is the maximum number of pages that can be marked secret,
+// since all of them are protected again on every delay tick.
+const MaxSecretPages = MaxBatchTargets
+
+// secretPages are the pages applications marked secret.
+var secretPages struct {
+	mu    sync.Mutex
+	pages map[usermem.Addr]struct{}
+}
+
+// MarkSecret marks the page-aligned range ar as secret if secret is true, and
+// unmarks it otherwise. Addresses are application addresses; they are not
+// told apart between processes.
+func MarkSecret(ar usermem.AddrRange, secret bool) error {
+	// Ranges can span the whole address space, so never walk them page by
+	// page: at most MaxSecretPages pages are ever marked.
+	if secret && ar.Length()/usermem.PageSize > MaxSecretPages {
+		return fmt.Errorf("marking %d secret pages would exceed the limit of %d", ar.Length()/usermem.PageSize, MaxSecretPages)
+	}
+
+	secretPages.mu.Lock()
+	defer secretPages.mu.Unlock()
+	if !secret {
+		for addr := range secretPages.pages {
+			if ar.Contains(addr) {
+				delete(secretPages.pages, addr)
+			}
+		}
+		return nil
+	}
+
+	added := 0
+	for addr := ar.Start; addr < ar.End; addr += usermem.PageSize {
+		if _, ok := secretPages.pages[addr]; !ok {
+			added++
+		}
+	}
+	if len(secretPages.pages)+added > MaxSecretPages {
+		return fmt.Errorf("marking %d more secret pages would exceed the limit of %d", added, MaxSecretPages)
+	}
+	if secretPages.pages == nil {
+		secretPages.pages = make(map[usermem.Addr]struct{})
+	}
+	for addr := ar.Start; addr < ar.End; addr += usermem.PageSize {
+		secretPages.pages[addr] = struct{}{}
+	}
+	return nil
+}
+
+// IsSecret returns whether the page containing addr is secret.
+func IsSecret(addr usermem.Addr) bool {
+	secretPages.mu.Lock()
+	defer secretPages.mu.Unlock()
+	_, ok := secretPages.pages[addr.RoundDown()]
+	return ok
+}
+
+// SecretPages returns the secret pages by increasing address.
+func SecretPages() []usermem.Addr {
+	secretPages.mu.Lock()
+	defer secretPages.mu.Unlock()
+	pages := make([]usermem.Addr, 0, len(secretPages.pages))
+	for addr := range secretPages.pages {
+		pages = append(pages, addr)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i] < pages[j] })
+	return pages
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"reflect"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestMarkSecret(t *testing.T) {
+	ar := usermem.AddrRange{Start: 0x10000, End: 0x13000}
+	if err := MarkSecret(ar, true); err != nil {
+		t.Fatalf("MarkSecret() failed: %v", err)
+	}
+	defer MarkSecret(ar, false)
+
+	if !IsSecret(0x11234) {
+		t.Errorf("IsSecret(0x11234) = false, want true")
+	}
+	if IsSecret(0x13000) {
+		t.Errorf("IsSecret(0x13000) = true, want false")
+	}
+
+	// Unmarking part of the range keeps the rest.
+	if err := MarkSecret(usermem.AddrRange{Start: 0x11000, End: 0x12000}, false); err != nil {
+		t.Fatalf("MarkSecret() failed: %v", err)
+	}
+	if got, want := SecretPages(), []usermem.Addr{0x10000, 0x12000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SecretPages() = %v, want %v", got, want)
+	}
+
+	// Marking is all or nothing.
+	big := usermem.AddrRange{Start: 0x100000, End: 0x100000 + MaxSecretPages*usermem.PageSize}
+	if err := MarkSecret(big, true); err == nil {
+		t.Errorf("MarkSecret() of %d more pages succeeded, want error", MaxSecretPages)
+	}
+	if got := len(SecretPages()); got != 2 {
+		t.Errorf("%d secret pages after a failed MarkSecret(), want 2", got)
+	}
+}
+
+func TestMarkSecretHugeRange(t *testing.T) {
+	ar := usermem.AddrRange{Start: 0x10000, End: 0x12000}
+	if err := MarkSecret(ar, true); err != nil {
+		t.Fatalf("MarkSecret() failed: %v", err)
+	}
+	defer MarkSecret(ar, false)
+
+	// Ranges as large as the address space are handled without walking
+	// them page by page.
+	all := usermem.AddrRange{Start: 0, End: usermem.Addr(1) << 47}
+	if err := MarkSecret(all, true); err == nil {
+		t.Errorf("MarkSecret() of the whole address space succeeded, want error")
+	}
+	if got := len(SecretPages()); got != 2 {
+		t.Errorf("%d secret pages after a failed MarkSecret(), want 2", got)
+	}
+	if err := MarkSecret(all, false); err != nil {
+		t.Fatalf("MarkSecret() failed: %v", err)
+	}
+	if got := SecretPages(); len(got) != 0 {
+		t.Errorf("SecretPages() = %v after unmarking the whole address space, want none", got)
+	}
+}
+
+func TestSecretPagesWithoutWindow(t *testing.T) {
+	// No Start message ever opened a window.
+	stopDelay()
+	ar := usermem.AddrRange{Start: 0x10000, End: 0x12000}
+	if err := MarkSecret(ar, true); err != nil {
+		t.Fatalf("MarkSecret() failed: %v", err)
+	}
+	defer MarkSecret(ar, false)
+
+	if got, want := DelayPages(), []usermem.Addr{0x10000, 0x11000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DelayPages() = %x, want %x", got, want)
+	}
+	if !IsDelayed(0x11000) {
+		t.Errorf("IsDelayed(0x11000) = false, want secret pages delayed outside of windows")
+	}
+	if IsDelayed(0x12000) {
+		t.Errorf("IsDelayed(0x12000) = true, not a secret page")
+	}
+	if wait, sleep := DelayTimes(); wait != SecretWaitTime || sleep != SecretSleepTime {
+		t.Errorf("DelayTimes() = %d, %d, want %d, %d", wait, sleep, SecretWaitTime, SecretSleepTime)
+	}
+
+	MarkSecret(ar, false)
+	if pages := DelayPages(); pages != nil {
+		t.Errorf("DelayPages() = %x without secret pages, want none", pages)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+)
+
+// MinShuffleInterval is the shortest interval between shuffles of the secret
+// pages, since every shuffle copies all of them twice.
+const MinShuffleInterval = time.Millisecond
+
+// shuffleInterval is how often the secret pages are shuffled, 0 if they
+// aren't. It is accessed atomically.
+var shuffleInterval int64
+
+// SetShuffleInterval sets how often the sentry permutes the frames that back
+// the pages applications marked secret, 0 to never.
+//
+// This is an aggressive mode, in the spirit of ORAM but far cheaper: an
+// attacker who learned which cache sets the frames of a secret region map to
+// only keeps that knowledge until the next shuffle, and can't tell which page
+// of the region an access went to.
+func SetShuffleInterval(d time.Duration) {
+	atomic.StoreInt64(&shuffleInterval, int64(d))
+}
+
+// ShuffleInterval returns how often the secret pages are shuffled, 0 if they
+// aren't.
+func ShuffleInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&shuffleInterval))
+}
+
+// ShufflePermutation returns a uniformly random permutation of [0, n). It
+// draws from the system's secure source, which the application can't predict.
+func ShufflePermutation(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	var b [8]byte
+	for i := n - 1; i > 0; i-- {
+		if _, err := rand.Read(b[:]); err != nil {
+			panic("reading random bytes: " + err.Error())
+		}
+		// The modulo bias is negligible for the few pages shuffled.
+		j := int(binary.LittleEndian.Uint64(b[:]) % uint64(i+1))
+		p[i], p[j] = p[j], p[i]
+	}
+	return p
+}
+
+// RecordShuffle counts a shuffle of n secret pages.
+func RecordShuffle(n int) {
+	atomic.AddUint64(&stats.Shuffles, 1)
+	atomic.AddUint64(&stats.ShuffledPages, uint64(n))
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+)
+
+func TestShufflePermutation(t *testing.T) {
+	const n = 8
+	moved := false
+	for try := 0; try < 16; try++ {
+		p := ShufflePermutation(n)
+		if len(p) != n {
+			t.Fatalf("ShufflePermutation(%d) has %d elements", n, len(p))
+		}
+		seen := make(map[int]bool)
+		for i, j := range p {
+			if j < 0 || j >= n || seen[j] {
+				t.Fatalf("ShufflePermutation(%d) = %v is not a permutation", n, p)
+			}
+			seen[j] = true
+			if i != j {
+				moved = true
+			}
+		}
+	}
+	if !moved {
+		t.Errorf("ShufflePermutation(%d) never moved anything", n)
+	}
+}
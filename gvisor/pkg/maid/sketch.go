@@ -0,0 +1,174 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// HeavyHitter is a page tracked by TopK.
+type HeavyHitter struct {
+	// Addr is the page address.
+	Addr usermem.Addr
+
+	// Count is the estimated number of accesses to Addr. It overestimates
+	// the actual count by at most Error.
+	Count uint64
+	Error uint64
+}
+
+// TopK tracks the most accessed pages over the whole life of a container in
+// fixed memory, with the Space-Saving algorithm: it keeps k counters and, when
+// a page without one is sampled, reassigns the smallest counter to it. Every
+// page whose actual count is above the total count divided by k is
+// guaranteed to be tracked.
+type TopK struct {
+	mu sync.Mutex
+
+	// k is the number of counters.
+	k int
+
+	// counters is a min-heap of the counters, by count.
+	counters hitterHeap
+
+	// index maps a tracked page to its position in counters.
+	index map[usermem.Addr]int
+}
+
+// NewTopK returns a TopK tracking k pages. k must be positive.
+func NewTopK(k int) *TopK {
+	t := &TopK{
+		k:     k,
+		index: make(map[usermem.Addr]int, k),
+	}
+	t.counters.index = t.index
+	return t
+}
+
+// Add records n accesses to the page of addr.
+func (t *TopK) Add(addr usermem.Addr, n uint64) {
+	if n == 0 {
+		return
+	}
+	addr = addr.RoundDown()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i, ok := t.index[addr]; ok {
+		t.counters.hitters[i].Count += n
+		heap.Fix(&t.counters, i)
+		return
+	}
+	if len(t.counters.hitters) < t.k {
+		heap.Push(&t.counters, HeavyHitter{Addr: addr, Count: n})
+		return
+	}
+	// Evict the smallest counter. The new page may have been accessed up
+	// to that many times while it wasn't tracked.
+	min := t.counters.hitters[0]
+	delete(t.index, min.Addr)
+	t.counters.hitters[0] = HeavyHitter{Addr: addr, Count: min.Count + n, Error: min.Count}
+	t.index[addr] = 0
+	heap.Fix(&t.counters, 0)
+}
+
+// AddTargets records the accesses of a sample.
+func (t *TopK) AddTargets(sample []Target) {
+	for _, s := range sample {
+		if s.Accesses > 0 {
+			t.Add(s.Addr, uint64(s.Accesses))
+		}
+	}
+}
+
+// tracks returns whether t has a counter for the page of addr.
+func (t *TopK) tracks(addr usermem.Addr) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.index[addr.RoundDown()]
+	return ok
+}
+
+// Top returns the tracked pages, most accessed first.
+func (t *TopK) Top() []HeavyHitter {
+	t.mu.Lock()
+	top := append([]HeavyHitter(nil), t.counters.hitters...)
+	t.mu.Unlock()
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Addr < top[j].Addr
+	})
+	return top
+}
+
+// hitterHeap implements heap.Interface, keeping index up to date.
+type hitterHeap struct {
+	hitters []HeavyHitter
+	index   map[usermem.Addr]int
+}
+
+// Len implements sort.Interface.Len.
+func (h *hitterHeap) Len() int { return len(h.hitters) }
+
+// Less implements sort.Interface.Less.
+func (h *hitterHeap) Less(i, j int) bool { return h.hitters[i].Count < h.hitters[j].Count }
+
+// Swap implements sort.Interface.Swap.
+func (h *hitterHeap) Swap(i, j int) {
+	h.hitters[i], h.hitters[j] = h.hitters[j], h.hitters[i]
+	h.index[h.hitters[i].Addr] = i
+	h.index[h.hitters[j].Addr] = j
+}
+
+// Push implements heap.Interface.Push.
+func (h *hitterHeap) Push(x interface{}) {
+	hh := x.(HeavyHitter)
+	h.index[hh.Addr] = len(h.hitters)
+	h.hitters = append(h.hitters, hh)
+}
+
+// Pop implements heap.Interface.Pop.
+func (h *hitterHeap) Pop() interface{} {
+	last := h.hitters[len(h.hitters)-1]
+	h.hitters = h.hitters[:len(h.hitters)-1]
+	delete(h.index, last.Addr)
+	return last
+}
+
+// heavyHitters is the last top set reported by the monitor.
+var heavyHitters struct {
+	mu  sync.Mutex
+	top []Target
+}
+
+// setHeavyHitters records the top set reported by the monitor.
+func setHeavyHitters(top []Target) {
+	heavyHitters.mu.Lock()
+	heavyHitters.top = append([]Target(nil), top...)
+	heavyHitters.mu.Unlock()
+}
+
+// CurrentHeavyHitters returns the last top set reported by the monitor, most
+// accessed first, with the estimated access counts.
+func CurrentHeavyHitters() []Target {
+	heavyHitters.mu.Lock()
+	defer heavyHitters.mu.Unlock()
+	return append([]Target(nil), heavyHitters.top...)
+}
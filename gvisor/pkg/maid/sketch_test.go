@@ -0,0 +1,77 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestTopKExact(t *testing.T) {
+	k := NewTopK(4)
+	k.Add(0x1000, 5)
+	k.Add(0x2234, 7)
+	k.Add(0x1000, 5)
+
+	top := k.Top()
+	want := []HeavyHitter{{Addr: 0x1000, Count: 10}, {Addr: 0x2000, Count: 7}}
+	if len(top) != len(want) {
+		t.Fatalf("Top() = %+v, want %+v", top, want)
+	}
+	for i := range want {
+		if top[i] != want[i] {
+			t.Errorf("Top()[%d] = %+v, want %+v", i, top[i], want[i])
+		}
+	}
+}
+
+func TestTopKBoundedMemory(t *testing.T) {
+	const k = 8
+	s := NewTopK(k)
+	// Two heavy pages among a long tail of pages sampled once.
+	for i := 0; i < 10000; i++ {
+		s.Add(0x1000, 10)
+		s.Add(0x2000, 5)
+		s.Add(usermem.Addr(0x100000+i*usermem.PageSize), 1)
+	}
+
+	top := s.Top()
+	if len(top) != k {
+		t.Fatalf("Top() returned %d pages, want %d", len(top), k)
+	}
+	if top[0].Addr != 0x1000 || top[1].Addr != 0x2000 {
+		t.Errorf("heaviest pages are %#x and %#x, want 0x1000 and 0x2000", top[0].Addr, top[1].Addr)
+	}
+	for _, h := range top[:2] {
+		if h.Error != 0 {
+			t.Errorf("page %#x tracked from the start has error %d, want 0", h.Addr, h.Error)
+		}
+	}
+	if len(s.index) != k {
+		t.Errorf("index has %d entries, want %d", len(s.index), k)
+	}
+}
+
+func TestTopKEvictionError(t *testing.T) {
+	s := NewTopK(1)
+	s.Add(0x1000, 3)
+	s.Add(0x2000, 1)
+	top := s.Top()
+	want := HeavyHitter{Addr: 0x2000, Count: 4, Error: 3}
+	if len(top) != 1 || top[0] != want {
+		t.Errorf("Top() = %+v, want [%+v]", top, want)
+	}
+}
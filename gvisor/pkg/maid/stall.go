@@ -0,0 +1,150 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// StallAction defines what the monitor does when sampling overruns its
+// deadline.
+type StallAction int
+
+const (
+	// StallLog logs a warning followed by a stack dump of all goroutines.
+	StallLog StallAction = iota
+
+	// StallPanic does the same logging as StallLog and panics.
+	StallPanic
+
+	// StallDisable does the same logging as StallLog and stops delaying
+	// in the sandbox until sampling completes.
+	StallDisable
+)
+
+// String returns StallAction's string representation.
+func (a StallAction) String() string {
+	switch a {
+	case StallLog:
+		return "log"
+	case StallPanic:
+		return "panic"
+	case StallDisable:
+		return "disable-jitter"
+	default:
+		return fmt.Sprintf("unknown(%d)", a)
+	}
+}
+
+// StallWatchdog watches the sampling cycles of the monitor. A sample that
+// doesn't complete within the deadline, e.g. because the kernel module hung,
+// leaves accesses unprotected, so the watchdog takes an action rather than
+// letting the monitor stall silently.
+type StallWatchdog struct {
+	// deadline bounds the duration of a sample.
+	deadline time.Duration
+
+	// action is taken once per stalled sample.
+	action StallAction
+
+	// disable is called for StallDisable.
+	disable func()
+
+	mu sync.Mutex
+
+	// cycle identifies the current sample. It changes whenever a sample
+	// begins or ends, so that a timer firing late is ignored.
+	cycle uint64
+
+	// start is the time the current sample began.
+	start time.Time
+
+	// timer fires when the current sample overruns the deadline.
+	timer *time.Timer
+
+	// stalled is set once the current sample overran the deadline.
+	stalled bool
+}
+
+// NewStallWatchdog creates a new watchdog. disable is only used with
+// StallDisable and normally tells the sandbox to stop delaying.
+func NewStallWatchdog(deadline time.Duration, action StallAction, disable func()) *StallWatchdog {
+	return &StallWatchdog{
+		deadline: deadline,
+		action:   action,
+		disable:  disable,
+	}
+}
+
+// Begin records that a sample begins. w may be nil, in which case it does
+// nothing.
+func (w *StallWatchdog) Begin() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cycle++
+	cycle := w.cycle
+	w.start = time.Now()
+	w.timer = time.AfterFunc(w.deadline, func() { w.expire(cycle) })
+}
+
+// End records that the sample begun last ended. w may be nil, in which case
+// it does nothing.
+func (w *StallWatchdog) End() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cycle++
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.stalled {
+		log.Infof("[Cijitter] Sampling resumed after %v", time.Since(w.start))
+		w.stalled = false
+	}
+}
+
+// expire takes the configured action if the sample cycle is still running.
+func (w *StallWatchdog) expire(cycle uint64) {
+	w.mu.Lock()
+	if cycle != w.cycle {
+		w.mu.Unlock()
+		return
+	}
+	w.stalled = true
+	w.mu.Unlock()
+
+	msg := fmt.Sprintf("[Cijitter] Sampling has not completed in %v, accesses are no longer protected", w.deadline)
+	log.TracebackAll("%s", msg)
+	switch w.action {
+	case StallLog:
+	case StallPanic:
+		panic(msg)
+	case StallDisable:
+		w.disable()
+		log.Warningf("[Cijitter] Stopped delaying until sampling completes")
+	default:
+		panic(fmt.Sprintf("Unknown stall action %v", w.action))
+	}
+}
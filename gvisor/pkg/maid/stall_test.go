@@ -0,0 +1,58 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStallWatchdogFires(t *testing.T) {
+	disabled := make(chan struct{}, 1)
+	w := NewStallWatchdog(testInterval, StallDisable, func() {
+		disabled <- struct{}{}
+	})
+	w.Begin()
+	select {
+	case <-disabled:
+	case <-time.After(100 * testInterval):
+		t.Fatalf("watchdog not triggered by a stalled sample")
+	}
+	w.End()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stalled {
+		t.Errorf("sample still stalled after End()")
+	}
+}
+
+func TestStallWatchdogQuiet(t *testing.T) {
+	w := NewStallWatchdog(10*testInterval, StallDisable, func() {
+		t.Errorf("watchdog triggered by samples within the deadline")
+	})
+	for i := 0; i < 20; i++ {
+		w.Begin()
+		time.Sleep(testInterval)
+		w.End()
+	}
+	// Give a late timer the chance to fire.
+	time.Sleep(20 * testInterval)
+}
+
+func TestStallWatchdogNil(t *testing.T) {
+	var w *StallWatchdog
+	w.Begin()
+	w.End()
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sync/atomic"
+)
+
+// Stats are cumulative delay statistics of the sentry.
+type Stats struct {
+	// Windows is the number of delay windows opened.
+	Windows uint64
+
+	// DelayedAccesses is the number of accesses to target pages that were
+	// delayed.
+	DelayedAccesses uint64
+
+	// DelayNanos is the time, in nanoseconds, tasks of the sandbox were
+	// delayed for.
+	DelayNanos uint64
+
+	// ThrottledDelays is the number of delays shortened or skipped because
+	// they ran over the delay budget.
+	ThrottledDelays uint64
+
+	// RejectedMessages is the number of monitor messages dropped because
+	// they were malformed.
+	RejectedMessages uint64
+
+	// Shuffles is the number of times the secret pages were shuffled, and
+	// ShuffledPages the number of pages moved in all.
+	Shuffles      uint64
+	ShuffledPages uint64
+
+	// PageTierRounds is the number of rounds of the page tier, and
+	// PageTierPages the number of pages it was applied to in all.
+	PageTierRounds uint64
+	PageTierPages  uint64
+
+	// DeferredDelays is the number of delays of lock holders deferred until
+	// they released their lock.
+	DeferredDelays uint64
+
+	// UnmappedTargets is the number of sampled targets dropped because
+	// they had no guest mapping.
+	UnmappedTargets uint64
+
+	// AccessLatency is the distribution of the latency the delays added
+	// to the delayed accesses, and WindowLatency that of the latency they
+	// added over each delay window, as measured on the monotonic clock.
+	// They show the delay the workload actually experiences, timer slack
+	// and scheduling latency included.
+	AccessLatency LatencyHistogram
+	WindowLatency LatencyHistogram
+
+	// MonitorDroppedOldest and MonitorDroppedNewest are the messages the
+	// monitor dropped from its full queue, as of its last heartbeat.
+	MonitorDroppedOldest uint64
+	MonitorDroppedNewest uint64
+
+	// MonitorSamplerErrors is the number of sampling cycles of the monitor
+	// that failed, as of its last heartbeat.
+	MonitorSamplerErrors uint64
+
+	// Listener is the health of the listener of the address pipe.
+	Listener ListenerHealth
+}
+
+// stats are the statistics since the sentry started. They are updated
+// atomically.
+var stats Stats
+
+// CurrentStats returns the delay statistics since the sentry started.
+func CurrentStats() Stats {
+	return Stats{
+		Windows:          atomic.LoadUint64(&stats.Windows),
+		DelayedAccesses:  atomic.LoadUint64(&stats.DelayedAccesses),
+		DelayNanos:       atomic.LoadUint64(&stats.DelayNanos),
+		ThrottledDelays:  atomic.LoadUint64(&stats.ThrottledDelays),
+		RejectedMessages: atomic.LoadUint64(&stats.RejectedMessages),
+		Shuffles:         atomic.LoadUint64(&stats.Shuffles),
+		ShuffledPages:    atomic.LoadUint64(&stats.ShuffledPages),
+		PageTierRounds:   atomic.LoadUint64(&stats.PageTierRounds),
+		PageTierPages:    atomic.LoadUint64(&stats.PageTierPages),
+		DeferredDelays:   atomic.LoadUint64(&stats.DeferredDelays),
+		UnmappedTargets:  atomic.LoadUint64(&stats.UnmappedTargets),
+		AccessLatency:    stats.AccessLatency.load(),
+		WindowLatency:    stats.WindowLatency.load(),
+
+		MonitorDroppedOldest: atomic.LoadUint64(&stats.MonitorDroppedOldest),
+		MonitorDroppedNewest: atomic.LoadUint64(&stats.MonitorDroppedNewest),
+		MonitorSamplerErrors: atomic.LoadUint64(&stats.MonitorSamplerErrors),
+		Listener:             CurrentListenerHealth(),
+	}
+}
+
+// recordMonitorDrops records the drop counts d reported by the monitor.
+func recordMonitorDrops(d MessageDrops) {
+	atomic.StoreUint64(&stats.MonitorDroppedOldest, d.Oldest)
+	atomic.StoreUint64(&stats.MonitorDroppedNewest, d.Newest)
+}
+
+// recordMonitorSamplerErrors records the sampler error count n reported by
+// the monitor.
+func recordMonitorSamplerErrors(n uint64) {
+	atomic.StoreUint64(&stats.MonitorSamplerErrors, n)
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// suspension tracks the operations the sandbox is suspended for, such as a
+// pause and a checkpoint taken while paused. No delay window is open while
+// the sandbox is suspended, and the monitor is told not to sample it.
+var suspension struct {
+	mu sync.Mutex
+
+	// depth is the number of operations under way.
+	depth int
+
+	// changed is closed, and replaced, when the sandbox is suspended or
+	// resumed.
+	changed chan struct{}
+}
+
+func init() {
+	suspension.changed = make(chan struct{})
+}
+
+// Suspend suspends jitter for an operation that stops the sandbox, such as a
+// pause or a checkpoint: it closes the open delay window, if any, and tells
+// the monitor to stop sampling and delaying until the matching Unsuspend.
+func Suspend() {
+	suspension.mu.Lock()
+	suspension.depth++
+	first := suspension.depth == 1
+	if first {
+		close(suspension.changed)
+		suspension.changed = make(chan struct{})
+	}
+	suspension.mu.Unlock()
+	if first {
+		addr, _ := stopDelay()
+		log.Infof("[Cijitter] sandbox suspended, delay window on %x closed", addr)
+	}
+}
+
+// Unsuspend ends an operation Suspend was called for. Jitter resumes once
+// the last one ended.
+func Unsuspend() {
+	suspension.mu.Lock()
+	defer suspension.mu.Unlock()
+	if suspension.depth == 0 {
+		return
+	}
+	suspension.depth--
+	if suspension.depth == 0 {
+		close(suspension.changed)
+		suspension.changed = make(chan struct{})
+		log.Infof("[Cijitter] sandbox resumed, jitter resumes")
+	}
+}
+
+// Suspended returns whether the sandbox is suspended.
+func Suspended() bool {
+	suspension.mu.Lock()
+	defer suspension.mu.Unlock()
+	return suspension.depth != 0
+}
+
+// suspensionState returns whether the sandbox is suspended, and a channel
+// closed once that changes.
+func suspensionState() (<-chan struct{}, bool) {
+	suspension.mu.Lock()
+	defer suspension.mu.Unlock()
+	return suspension.changed, suspension.depth != 0
+}
+
+// NewSuspendNotice returns the notice telling the monitor whether the sandbox
+// is suspended.
+func NewSuspendNotice(suspended bool) *Ack {
+	return &Ack{Header: Header{Version: ProtocolVersion, Type: MessageSuspend}, Suspended: suspended}
+}
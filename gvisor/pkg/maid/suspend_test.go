@@ -0,0 +1,107 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSuspendClosesWindow(t *testing.T) {
+	defer Listen_target_addrs(NewClearMessage())
+	if ack := Listen_target_addrs(NewStartMessage(0x1000, 10)); ack.Err != "" {
+		t.Fatalf("start rejected: %s", ack.Err)
+	}
+
+	Suspend()
+	if WindowOpen() {
+		t.Errorf("delay window still open once suspended")
+	}
+	if ack := Listen_target_addrs(NewStartMessage(0x1000, 10)); ack.Err == "" {
+		t.Errorf("start accepted while suspended")
+	}
+	Unsuspend()
+	if ack := Listen_target_addrs(NewStartMessage(0x1000, 10)); ack.Err != "" {
+		t.Errorf("start rejected once resumed: %s", ack.Err)
+	}
+}
+
+func TestSuspendNests(t *testing.T) {
+	// A checkpoint of a paused sandbox.
+	Suspend()
+	Suspend()
+	Unsuspend()
+	if !Suspended() {
+		t.Errorf("resumed with an operation still under way")
+	}
+	Unsuspend()
+	if Suspended() {
+		t.Errorf("still suspended once every operation ended")
+	}
+
+	// Unmatched resumes are ignored.
+	Unsuspend()
+	Suspend()
+	if !Suspended() {
+		t.Errorf("not suspended after an unmatched resume")
+	}
+	Unsuspend()
+}
+
+func TestSuspendNotifiesMonitor(t *testing.T) {
+	monitor, sandbox := addrPipePair(t)
+	defer monitor.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Listen(ctx, sandbox)
+
+	acks := make(chan *Ack)
+	go func() {
+		decoder := NewDecoder(monitor)
+		for {
+			ack, err := decoder.DecodeAck()
+			if err != nil {
+				close(acks)
+				return
+			}
+			acks <- ack
+		}
+	}()
+	next := func() *Ack {
+		select {
+		case ack := <-acks:
+			return ack
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no notice from the sandbox")
+			return nil
+		}
+	}
+
+	// Let the listener take the pipe.
+	if err := NewEncoder(monitor).Encode(NewHeartbeatMessage()); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	next()
+
+	Suspend()
+	if ack := next(); ack.Type != MessageSuspend || !ack.Suspended {
+		t.Errorf("got %v ack, suspended %t, want a suspend notice", ack.Type, ack.Suspended)
+	}
+	Unsuspend()
+	if ack := next(); ack.Type != MessageSuspend || ack.Suspended {
+		t.Errorf("got %v ack, suspended %t, want a resume notice", ack.Type, ack.Suspended)
+	}
+}
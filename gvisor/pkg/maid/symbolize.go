@@ -0,0 +1,162 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Symbol describes what a sampled address belongs to.
+type Symbol struct {
+	// Addr is the address as the monitor sampled it.
+	Addr usermem.Addr `json:"addr"`
+
+	// Mapped is whether Addr maps application memory. The other fields are
+	// only set if it does.
+	Mapped bool `json:"mapped"`
+
+	// Path is the mapping that contains Addr, as shown in /proc/[pid]/maps,
+	// e.g. a library path. It is empty for anonymous memory.
+	Path string `json:"path,omitempty"`
+
+	// Offset is the offset of Addr into Path.
+	Offset uint64 `json:"offset,omitempty"`
+
+	// Func is the function that contains Addr, if Path is an ELF file with
+	// symbols, and FuncOffset the offset of Addr into it.
+	Func       string `json:"func,omitempty"`
+	FuncOffset uint64 `json:"funcOffset,omitempty"`
+}
+
+// String returns s as func+offset, lib+offset or [anon], whichever is most
+// precise.
+func (s Symbol) String() string {
+	switch {
+	case !s.Mapped:
+		return fmt.Sprintf("%#x", s.Addr)
+	case s.Func != "":
+		return fmt.Sprintf("%s+%#x", s.Func, s.FuncOffset)
+	case s.Path != "":
+		return fmt.Sprintf("%s+%#x", s.Path, s.Offset)
+	default:
+		return "[anon]"
+	}
+}
+
+// SymbolNames returns the names of the symbols of targets, as Symbol.String
+// does. syms must hold the symbols of all targets.
+func SymbolNames(targets []Target, syms []Symbol) []string {
+	if syms == nil {
+		return nil
+	}
+	byAddr := make(map[usermem.Addr]Symbol, len(syms))
+	for _, sym := range syms {
+		byAddr[sym.Addr] = sym
+	}
+	names := make([]string, 0, len(targets))
+	for _, t := range targets {
+		names = append(names, byAddr[t.Addr].String())
+	}
+	return names
+}
+
+// AddrSymbolizer returns the mapping that contains the application address
+// addr and the offset of addr into it. ok is false if addr is not mapped.
+type AddrSymbolizer func(addr usermem.Addr) (path string, off uint64, ok bool)
+
+// MappingResolver is the inverse of AddrSymbolizer: it returns the
+// application address at which offset off of mapping path is mapped.
+type MappingResolver func(path string, off uint64) (addr usermem.Addr, ok bool)
+
+var (
+	symbolizerMu sync.Mutex
+	symbolizer   AddrSymbolizer
+	resolver     MappingResolver
+)
+
+// SetAddrSymbolizer sets the symbolizer used by Symbolize. nil disables
+// symbolization.
+func SetAddrSymbolizer(s AddrSymbolizer) {
+	symbolizerMu.Lock()
+	defer symbolizerMu.Unlock()
+	symbolizer = s
+}
+
+// Symbolize resolves addresses sampled by the monitor to the mappings that
+// contain them. Addresses are translated to application addresses first.
+func Symbolize(addrs []usermem.Addr) []Symbol {
+	symbolizerMu.Lock()
+	s := symbolizer
+	symbolizerMu.Unlock()
+	translatorMu.Lock()
+	t := translator
+	translatorMu.Unlock()
+
+	syms := make([]Symbol, 0, len(addrs))
+	for _, addr := range addrs {
+		sym := Symbol{Addr: addr}
+		app, ok := addr, true
+		if t != nil {
+			app, ok = t(addr)
+		}
+		if ok && s != nil {
+			sym.Path, sym.Offset, sym.Mapped = s(app)
+		}
+		syms = append(syms, sym)
+	}
+	return syms
+}
+
+// SetMappingResolver sets the resolver used by Preload.
+func SetMappingResolver(r MappingResolver) {
+	symbolizerMu.Lock()
+	defer symbolizerMu.Unlock()
+	resolver = r
+}
+
+// Preload marks the pages of regions, given by mapping Path and Offset, as
+// secret, so that they are delayed from the first delay window on. It returns
+// the number of regions that could be resolved; the others may not be mapped
+// yet.
+func Preload(regions []Symbol) int {
+	symbolizerMu.Lock()
+	r := resolver
+	symbolizerMu.Unlock()
+	if r == nil {
+		return 0
+	}
+
+	n := 0
+	for _, region := range regions {
+		addr, ok := r(region.Path, region.Offset)
+		if !ok {
+			continue
+		}
+		ar, ok := addr.RoundDown().ToRange(usermem.PageSize)
+		if !ok {
+			continue
+		}
+		if err := MarkSecret(ar, true); err != nil {
+			log.Debugf("[Cijitter] preloading %s+%#x: %v", region.Path, region.Offset, err)
+			break
+		}
+		n++
+	}
+	return n
+}
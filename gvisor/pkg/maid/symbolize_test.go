@@ -0,0 +1,50 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestSymbolize(t *testing.T) {
+	SetAddrSymbolizer(func(addr usermem.Addr) (string, uint64, bool) {
+		switch {
+		case addr >= 0x400000 && addr < 0x500000:
+			return "/usr/lib/libcrypto.so", uint64(addr - 0x400000), true
+		case addr >= 0x600000 && addr < 0x700000:
+			return "", uint64(addr - 0x600000), true
+		}
+		return "", 0, false
+	})
+	defer SetAddrSymbolizer(nil)
+
+	syms := Symbolize([]usermem.Addr{0x401000, 0x600000, 0x800000})
+	want := []string{"/usr/lib/libcrypto.so+0x1000", "[anon]", "0x800000"}
+	if len(syms) != len(want) {
+		t.Fatalf("Symbolize() returned %d symbols, want %d", len(syms), len(want))
+	}
+	for i, sym := range syms {
+		if got := sym.String(); got != want[i] {
+			t.Errorf("symbol %d = %q, want %q", i, got, want[i])
+		}
+	}
+
+	sym := Symbol{Addr: 0x401000, Mapped: true, Path: "/usr/lib/libcrypto.so", Offset: 0x1000, Func: "AES_encrypt", FuncOffset: 0x20}
+	if got, want := sym.String(), "AES_encrypt+0x20"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
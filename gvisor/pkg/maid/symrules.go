@@ -0,0 +1,134 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SymbolAction is what a SymbolRule does to the targets it matches.
+type SymbolAction int
+
+const (
+	// SymbolAlways delays the window if one of its targets matches, however
+	// few accesses were sampled.
+	SymbolAlways SymbolAction = iota
+
+	// SymbolNever removes matching targets from every window.
+	SymbolNever
+)
+
+// String implements fmt.Stringer.
+func (a SymbolAction) String() string {
+	switch a {
+	case SymbolAlways:
+		return "always"
+	case SymbolNever:
+		return "never"
+	default:
+		return fmt.Sprintf("unknown(%d)", a)
+	}
+}
+
+// SymbolRule applies Action to the targets whose function or mapping name
+// contains Pattern.
+type SymbolRule struct {
+	Action  SymbolAction
+	Pattern string
+}
+
+// Match returns whether r applies to sym.
+func (r SymbolRule) Match(sym Symbol) bool {
+	if !sym.Mapped {
+		return false
+	}
+	return (sym.Func != "" && strings.Contains(sym.Func, r.Pattern)) || (sym.Path != "" && strings.Contains(sym.Path, r.Pattern))
+}
+
+// SymbolRules are per-function jitter policies. The first rule that matches a
+// target applies.
+type SymbolRules []SymbolRule
+
+// ParseSymbolRules parses a comma separated list of ACTION:PATTERN rules, as
+// printed by SymbolRules.String, e.g. "always:libcrypto,never:Interpreter".
+func ParseSymbolRules(s string) (SymbolRules, error) {
+	var rules SymbolRules
+	for _, rule := range strings.Split(s, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid symbol rule %q, want ACTION:PATTERN", rule)
+		}
+		var r SymbolRule
+		switch parts[0] {
+		case "always":
+			r.Action = SymbolAlways
+		case "never":
+			r.Action = SymbolNever
+		default:
+			return nil, fmt.Errorf("invalid symbol rule action %q, want always or never", parts[0])
+		}
+		r.Pattern = parts[1]
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// String implements fmt.Stringer.
+func (rs SymbolRules) String() string {
+	rules := make([]string, 0, len(rs))
+	for _, r := range rs {
+		rules = append(rules, r.Action.String()+":"+r.Pattern)
+	}
+	return strings.Join(rules, ",")
+}
+
+// Apply removes the targets of a window matching a never rule. syms are the
+// symbols of targets, in the same order. It returns the remaining targets and
+// their symbols, and whether one of them matches an always rule.
+func (rs SymbolRules) Apply(targets []Target, syms []Symbol) ([]Target, []Symbol, bool) {
+	if len(rs) == 0 || len(syms) != len(targets) {
+		return targets, syms, false
+	}
+	var (
+		keptTargets []Target
+		keptSyms    []Symbol
+		always      bool
+	)
+	for i, sym := range syms {
+		action, ok := rs.action(sym)
+		if ok && action == SymbolNever {
+			continue
+		}
+		always = always || (ok && action == SymbolAlways)
+		keptTargets = append(keptTargets, targets[i])
+		keptSyms = append(keptSyms, sym)
+	}
+	return keptTargets, keptSyms, always
+}
+
+// action returns the action of the first rule matching sym.
+func (rs SymbolRules) action(sym Symbol) (SymbolAction, bool) {
+	for _, r := range rs {
+		if r.Match(sym) {
+			return r.Action, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSymbolRules(t *testing.T) {
+	rules, err := ParseSymbolRules("always:libcrypto, never:Interpreter")
+	if err != nil {
+		t.Fatalf("ParseSymbolRules() failed: %v", err)
+	}
+	want := SymbolRules{{Action: SymbolAlways, Pattern: "libcrypto"}, {Action: SymbolNever, Pattern: "Interpreter"}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("ParseSymbolRules() = %v, want %v", rules, want)
+	}
+	if got, want := rules.String(), "always:libcrypto,never:Interpreter"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if rules, err := ParseSymbolRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("ParseSymbolRules(\"\") = %v, %v, want no rules", rules, err)
+	}
+	for _, s := range []string{"libcrypto", "sometimes:libcrypto", "always:"} {
+		if _, err := ParseSymbolRules(s); err == nil {
+			t.Errorf("ParseSymbolRules(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestSymbolRulesApply(t *testing.T) {
+	rules := SymbolRules{
+		{Action: SymbolNever, Pattern: "Interpreter"},
+		{Action: SymbolAlways, Pattern: "libcrypto"},
+	}
+	targets := []Target{{Addr: 0x1000, Accesses: 10}, {Addr: 0x2000, Accesses: 5}, {Addr: 0x3000, Accesses: 1}}
+	syms := []Symbol{
+		{Addr: 0x1000, Mapped: true, Path: "/opt/jvm/libjvm.so", Func: "TemplateInterpreter::run"},
+		{Addr: 0x2000, Mapped: true},
+		{Addr: 0x3000, Mapped: true, Path: "/usr/lib/libcrypto.so.1.1"},
+	}
+
+	got, gotSyms, always := rules.Apply(targets, syms)
+	if want := targets[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() targets = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(gotSyms, syms[1:]) {
+		t.Errorf("Apply() symbols = %v, want %v", gotSyms, syms[1:])
+	}
+	if !always {
+		t.Errorf("Apply() did not match the always rule")
+	}
+
+	// Without symbols, targets are left alone.
+	if got, _, always := rules.Apply(targets, nil); !reflect.DeepEqual(got, targets) || always {
+		t.Errorf("Apply() without symbols = %v, %v, want %v, false", got, always, targets)
+	}
+}
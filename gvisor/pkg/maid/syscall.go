@@ -0,0 +1,43 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// syscallDelay bounds the random delay injected into selected system calls
+// during delay windows, in nanoseconds. It is accessed atomically.
+var syscallDelay int64
+
+// SetSyscallDelay sets the bound of the random delay injected into selected
+// system calls during delay windows. Which system calls are delayed is up to
+// the syscall table.
+func SetSyscallDelay(max time.Duration) {
+	atomic.StoreInt64(&syscallDelay, int64(max))
+}
+
+// SyscallDelay returns how long the system call about to run should be
+// delayed: a random duration below the configured bound while a delay window
+// is open, within the delay budget, and 0 otherwise.
+func SyscallDelay() time.Duration {
+	max := atomic.LoadInt64(&syscallDelay)
+	if max <= 0 || !WindowOpen() {
+		return 0
+	}
+	return LimitDelay(time.Duration(rand.Int63n(max)))
+}
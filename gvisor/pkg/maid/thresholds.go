@@ -0,0 +1,151 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Thresholds are the access counts the policy judges samples against. What
+// counts as hot depends on the workload.
+//
+// +stateify savable
+type Thresholds struct {
+	// Min is the access count at or below which a window is never
+	// delayed.
+	Min int
+
+	// Spike is the access count above which a window is always delayed,
+	// whatever the history.
+	Spike int
+}
+
+// DefaultThresholds are the thresholds of new policies.
+var DefaultThresholds = Thresholds{
+	Min:   80,
+	Spike: 3000,
+}
+
+// Validate returns an error if t can't tell samples apart.
+func (t Thresholds) Validate() error {
+	if t.Min < 0 {
+		return fmt.Errorf("minimum access count must be >= 0, got: %d", t.Min)
+	}
+	if t.Spike <= t.Min {
+		return fmt.Errorf("spike access count must be above the minimum access count %d, got: %d", t.Min, t.Spike)
+	}
+	return nil
+}
+
+// Hysteresis keeps the policy from flipping between delaying and skipping
+// windows, every cycle, when access counts hover around the thresholds. The
+// zero value disables it.
+//
+// +stateify savable
+type Hysteresis struct {
+	// Off is the access count at or below which a policy that is delaying
+	// windows stops, while one that is not only starts above
+	// Thresholds.Min. It must not be above Thresholds.Min. 0 uses
+	// Thresholds.Min.
+	Off int
+
+	// MinOn and MinOff are the minimum number of consecutive decisions
+	// the policy delays, resp. skips, windows for once it switched. Spikes
+	// are delayed regardless.
+	MinOn  int
+	MinOff int
+}
+
+// Validate returns an error if h doesn't fit t.
+func (h Hysteresis) Validate(t Thresholds) error {
+	if h.Off < 0 || h.Off > t.Min {
+		return fmt.Errorf("off access count must be in [0, %d], got: %d", t.Min, h.Off)
+	}
+	if h.MinOn < 0 || h.MinOff < 0 {
+		return fmt.Errorf("minimum dwell must be >= 0, got: %d on, %d off", h.MinOn, h.MinOff)
+	}
+	return nil
+}
+
+const (
+	// calibrationMinPercentile is the percentile of the calibration samples
+	// that becomes Thresholds.Min: the quietest cycles are not delayed.
+	calibrationMinPercentile = 20
+
+	// calibrationSpikePercentile is the percentile of the calibration
+	// samples that becomes Thresholds.Spike: only outliers are delayed
+	// regardless of the history.
+	calibrationSpikePercentile = 95
+)
+
+// Calibrator derives thresholds from the access counts sampled over the first
+// cycles of a workload.
+type Calibrator struct {
+	// cycles is the number of samples to observe.
+	cycles int
+
+	// samples are the access counts observed so far.
+	samples []int
+}
+
+// NewCalibrator returns a calibrator observing cycles samples. cycles must be
+// positive.
+func NewCalibrator(cycles int) *Calibrator {
+	return &Calibrator{
+		cycles:  cycles,
+		samples: make([]int, 0, cycles),
+	}
+}
+
+// Add records the access count of a cycle and returns true once enough
+// cycles have been observed.
+func (c *Calibrator) Add(accesses int) bool {
+	if len(c.samples) < c.cycles {
+		c.samples = append(c.samples, accesses)
+	}
+	return len(c.samples) == c.cycles
+}
+
+// Thresholds returns the thresholds derived from the cycles observed so far,
+// or def if none were.
+func (c *Calibrator) Thresholds(def Thresholds) Thresholds {
+	if len(c.samples) == 0 {
+		return def
+	}
+	sorted := append([]int(nil), c.samples...)
+	sort.Ints(sorted)
+	t := Thresholds{
+		Min:   percentile(sorted, calibrationMinPercentile),
+		Spike: percentile(sorted, calibrationSpikePercentile),
+	}
+	if t.Min < 0 {
+		t.Min = 0
+	}
+	if t.Spike <= t.Min {
+		t.Spike = t.Min + 1
+	}
+	return t
+}
+
+// percentile returns the p-th percentile of sorted, with the nearest-rank
+// method.
+func percentile(sorted []int, p int) int {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+)
+
+func TestCalibrator(t *testing.T) {
+	c := NewCalibrator(100)
+	for i := 1; i <= 100; i++ {
+		done := c.Add(i * 10)
+		if done != (i == 100) {
+			t.Fatalf("Add() after %d cycles = %t", i, done)
+		}
+	}
+	got := c.Thresholds(DefaultThresholds)
+	want := Thresholds{Min: 200, Spike: 950}
+	if got != want {
+		t.Errorf("Thresholds() = %+v, want %+v", got, want)
+	}
+	if err := got.Validate(); err != nil {
+		t.Errorf("calibrated thresholds are invalid: %v", err)
+	}
+}
+
+func TestCalibratorFlat(t *testing.T) {
+	c := NewCalibrator(4)
+	for i := 0; i < 4; i++ {
+		c.Add(500)
+	}
+	if got := c.Thresholds(DefaultThresholds); got.Validate() != nil {
+		t.Errorf("Thresholds() of a flat workload = %+v, want valid thresholds", got)
+	}
+}
+
+func TestCalibratorEmpty(t *testing.T) {
+	if got := NewCalibrator(4).Thresholds(DefaultThresholds); got != DefaultThresholds {
+		t.Errorf("Thresholds() without samples = %+v, want the defaults", got)
+	}
+}
+
+func TestPolicyThresholds(t *testing.T) {
+	p := NewPolicy()
+	p.SetThresholds(Thresholds{Min: 1000, Spike: 5000})
+	if delay, _ := p.Decide(500); delay {
+		t.Errorf("Decide(500) = true below the minimum access count")
+	}
+	if delay, _ := p.Decide(6000); !delay {
+		t.Errorf("Decide(6000) = false above the spike access count")
+	}
+}
+
+func TestThresholdsValidate(t *testing.T) {
+	for _, th := range []Thresholds{
+		{Min: -1, Spike: 10},
+		{Min: 10, Spike: 10},
+	} {
+		if err := th.Validate(); err == nil {
+			t.Errorf("%+v.Validate() succeeded, want error", th)
+		}
+	}
+}
+
+// hysteresisRun feeds p 12 samples of 500 accesses, 6 of 250 and 14 of 500
+// again, and returns its decisions as a string of 'D' (delayed) and '.'
+// (skipped).
+func hysteresisRun(h Hysteresis) string {
+	p := NewPolicy()
+	p.SetThresholds(Thresholds{Min: 300, Spike: 5000})
+	p.SetHysteresis(h)
+	var s []byte
+	for i := 0; i < 32; i++ {
+		accesses := 500
+		if i >= 12 && i < 18 {
+			accesses = 250
+		}
+		if delay, _ := p.Decide(accesses); delay {
+			p.Delayed()
+			s = append(s, 'D')
+		} else {
+			s = append(s, '.')
+		}
+	}
+	return string(s)
+}
+
+func TestPolicyHysteresis(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		h    Hysteresis
+		want string
+	}{
+		{
+			name: "disabled",
+			want: "DDDDDDDDDDDDDDD....DDDDDDDDDDDDD",
+		},
+		{
+			// The policy keeps delaying windows until the count
+			// drops to 200.
+			name: "off threshold",
+			h:    Hysteresis{Off: 200},
+			want: "DDDDDDDDDDDDDDDDDD..DDDDDDDDDDDD",
+		},
+		{
+			name: "minimum off dwell",
+			h:    Hysteresis{MinOff: 8},
+			want: "DDDDDDDDDDDDDDD........DDDDDDDDD",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := hysteresisRun(tc.h); got != tc.want {
+				t.Errorf("decisions = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPolicyHysteresisSpike(t *testing.T) {
+	p := NewPolicy()
+	p.SetThresholds(Thresholds{Min: 1000, Spike: 5000})
+	p.SetHysteresis(Hysteresis{MinOff: 100})
+	if delay, _ := p.Decide(500); delay {
+		t.Fatalf("Decide(500) = true below the minimum access count")
+	}
+	if delay, _ := p.Decide(6000); !delay {
+		t.Errorf("Decide(6000) = false while dwelling, want spikes delayed")
+	}
+}
+
+func TestHysteresisValidate(t *testing.T) {
+	for _, h := range []Hysteresis{
+		{Off: -1},
+		{Off: DefaultThresholds.Min + 1},
+		{MinOn: -1},
+		{MinOff: -1},
+	} {
+		if err := h.Validate(DefaultThresholds); err == nil {
+			t.Errorf("%+v.Validate() succeeded, want error", h)
+		}
+	}
+	if err := (Hysteresis{}).Validate(DefaultThresholds); err != nil {
+		t.Errorf("zero Hysteresis is invalid: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Jitter can be applied in two tiers, configured independently of each other
+// and of the delay primitive:
+//
+//  - The page tier applies a cheap page-level primitive to the hot region,
+//    the hottest targets of the last target set, all the time: windows open
+//    or not. It blunts attacks the monitor hasn't detected yet.
+//
+//  - The line tier replaces the delay primitive during delay windows: only
+//    the cache lines of the targets that accesses were sampled on are
+//    flushed, leaving the rest of their pages alone.
+
+// CacheLineSize is the size of the cache lines the line tier delays, the
+// smallest of the supported architectures. A page has at most 64 of them, one
+// per bit of Target.Lines.
+const CacheLineSize = 64
+
+// MaxHotRegionPages is the maximum number of pages in the hot region, since
+// all of them are delayed on every round of the page tier.
+const MaxHotRegionPages = MaxBatchTargets
+
+// MinPageTierInterval is the shortest interval between two rounds of the page
+// tier.
+const MinPageTierInterval = time.Millisecond
+
+// LineOf returns the bit of Target.Lines of the cache line containing addr.
+func LineOf(addr usermem.Addr) uint64 {
+	return 1 << (addr.PageOffset() / CacheLineSize)
+}
+
+// MergeLines returns the cache lines of two targets on the same page. Either
+// being 0, the whole page, makes the result the whole page.
+func MergeLines(a, b uint64) uint64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return a | b
+}
+
+// PageTier configures the page tier.
+type PageTier struct {
+	// Primitive is applied to every page of the hot region on every round.
+	// Only primitives that don't hold the delay worker may be used:
+	// DelayFlush, DelayUnmap and DelayRecolor.
+	Primitive DelayPrimitive
+
+	// Interval is the time between two rounds. 0 disables the tier.
+	Interval time.Duration
+}
+
+// Validate checks that t can be applied.
+func (t PageTier) Validate() error {
+	if t.Interval == 0 {
+		return nil
+	}
+	if t.Interval < MinPageTierInterval {
+		return fmt.Errorf("page tier interval must be 0 or at least %v, got %v", MinPageTierInterval, t.Interval)
+	}
+	switch t.Primitive {
+	case DelayFlush, DelayUnmap, DelayRecolor:
+		return nil
+	default:
+		return fmt.Errorf("page tier primitive must be %v, %v or %v, got %v", DelayFlush, DelayUnmap, DelayRecolor, t.Primitive)
+	}
+}
+
+// pageTier is the PageTier in use.
+var pageTier struct {
+	mu   sync.Mutex
+	tier PageTier
+}
+
+// SetPageTier sets the page tier, which must be valid.
+func SetPageTier(t PageTier) {
+	pageTier.mu.Lock()
+	pageTier.tier = t
+	pageTier.mu.Unlock()
+}
+
+// CurrentPageTier returns the page tier in use.
+func CurrentPageTier() PageTier {
+	pageTier.mu.Lock()
+	defer pageTier.mu.Unlock()
+	return pageTier.tier
+}
+
+// lineTier is 1 if the line tier is enabled. It is accessed atomically.
+var lineTier int32
+
+// SetLineTier sets whether delay windows flush the sampled cache lines of
+// their targets instead of applying the delay primitive.
+func SetLineTier(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&lineTier, v)
+}
+
+// LineTier returns whether delay windows flush the sampled cache lines of
+// their targets instead of applying the delay primitive.
+func LineTier() bool {
+	return atomic.LoadInt32(&lineTier) != 0
+}
+
+// TargetLines returns the sampled cache lines of the target page addr, 0 for
+// the whole page if they aren't known or addr is not a target.
+func TargetLines(addr usermem.Addr) uint64 {
+	TAddrs.Lock()
+	defer TAddrs.Unlock()
+	return TAddrs.lines[addr]
+}
+
+// HotRegion returns the pages the page tier applies to, hottest first, and the
+// pages applications marked secret.
+func HotRegion() []usermem.Addr {
+	TAddrs.Lock()
+	pages := append([]usermem.Addr(nil), TAddrs.hot...)
+	TAddrs.Unlock()
+	seen := make(map[usermem.Addr]bool, len(pages))
+	for _, page := range pages {
+		seen[page] = true
+	}
+	for _, page := range SecretPages() {
+		if !seen[page] {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// clearHotRegion empties the hot region, e.g. because it belongs to a process
+// that is no longer sampled.
+func clearHotRegion() {
+	TAddrs.Lock()
+	TAddrs.hot = nil
+	TAddrs.Unlock()
+}
+
+// hotRegionOf returns the MaxHotRegionPages hottest targets of addrs, hottest
+// first.
+func hotRegionOf(addrs map[usermem.Addr]int) []usermem.Addr {
+	hot := make([]usermem.Addr, 0, len(addrs))
+	for addr := range addrs {
+		hot = append(hot, addr)
+	}
+	sort.Slice(hot, func(i, j int) bool {
+		if addrs[hot[i]] != addrs[hot[j]] {
+			return addrs[hot[i]] > addrs[hot[j]]
+		}
+		return hot[i] < hot[j]
+	})
+	if len(hot) > MaxHotRegionPages {
+		hot = hot[:MaxHotRegionPages]
+	}
+	return hot
+}
+
+// RecordPageTier counts a round of the page tier over n pages.
+func RecordPageTier(n int) {
+	atomic.AddUint64(&stats.PageTierRounds, 1)
+	atomic.AddUint64(&stats.PageTierPages, uint64(n))
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestLineOf(t *testing.T) {
+	for _, tc := range []struct {
+		addr usermem.Addr
+		want uint64
+	}{
+		{addr: 0x5000, want: 1},
+		{addr: 0x503f, want: 1},
+		{addr: 0x5040, want: 1 << 1},
+		{addr: 0x5fff, want: 1 << 63},
+	} {
+		if got := LineOf(tc.addr); got != tc.want {
+			t.Errorf("LineOf(%#x) = %#x, want %#x", tc.addr, got, tc.want)
+		}
+	}
+	if got := MergeLines(1, 1<<4); got != 1|1<<4 {
+		t.Errorf("MergeLines(1, 1<<4) = %#x, want %#x", got, 1|1<<4)
+	}
+	if got := MergeLines(1, 0); got != 0 {
+		t.Errorf("MergeLines(1, 0) = %#x, want the whole page", got)
+	}
+}
+
+func TestPageTierValidate(t *testing.T) {
+	for _, tc := range []struct {
+		tier PageTier
+		ok   bool
+	}{
+		{tier: PageTier{}, ok: true},
+		{tier: PageTier{Primitive: DelayTrap}, ok: true},
+		{tier: PageTier{Primitive: DelayUnmap, Interval: 10 * time.Millisecond}, ok: true},
+		{tier: PageTier{Primitive: DelayFlush, Interval: time.Microsecond}},
+		{tier: PageTier{Primitive: DelayTrap, Interval: 10 * time.Millisecond}},
+		{tier: PageTier{Primitive: DelaySleep, Interval: 10 * time.Millisecond}},
+	} {
+		if err := tc.tier.Validate(); (err == nil) != tc.ok {
+			t.Errorf("%+v.Validate() = %v, want ok %t", tc.tier, err, tc.ok)
+		}
+	}
+}
+
+func TestTargetLines(t *testing.T) {
+	msg := NewStartBatchMessage([]Target{
+		{Addr: 0x5000, Accesses: 10, Lines: LineOf(0x5040)},
+		{Addr: 0x6000, Accesses: 5},
+	})
+	if ack := Listen_target_addrs(msg); ack.Err != "" {
+		t.Fatalf("Start rejected: %s", ack.Err)
+	}
+	defer stopDelay()
+
+	if got, want := TargetLines(0x5000), LineOf(0x5040); got != want {
+		t.Errorf("TargetLines(0x5000) = %#x, want %#x", got, want)
+	}
+	if got := TargetLines(0x6000); got != 0 {
+		t.Errorf("TargetLines(0x6000) = %#x, want the whole page", got)
+	}
+
+	// Lines follow the target set.
+	msg = NewUpdateTargetsMessage([]Target{{Addr: 0x6000, Accesses: 5, Lines: 1}})
+	if ack := Listen_target_addrs(msg); ack.Err != "" {
+		t.Fatalf("UpdateTargets rejected: %s", ack.Err)
+	}
+	if got := TargetLines(0x5000); got != 0 {
+		t.Errorf("TargetLines(0x5000) = %#x after update, want 0", got)
+	}
+	if got := TargetLines(0x6000); got != 1 {
+		t.Errorf("TargetLines(0x6000) = %#x after update, want 1", got)
+	}
+}
+
+func TestHotRegion(t *testing.T) {
+	defer Listen_target_addrs(NewClearMessage())
+	msg := NewStartBatchMessage([]Target{
+		{Addr: 0x5000, Accesses: 10},
+		{Addr: 0x7000, Accesses: 3},
+		{Addr: 0x6000, Accesses: 5},
+	})
+	if ack := Listen_target_addrs(msg); ack.Err != "" {
+		t.Fatalf("Start rejected: %s", ack.Err)
+	}
+
+	want := []usermem.Addr{0x5000, 0x6000, 0x7000}
+	if got := HotRegion(); !reflect.DeepEqual(got, want) {
+		t.Errorf("HotRegion() = %v, want %v", got, want)
+	}
+	// The hot region outlives the window...
+	Listen_target_addrs(NewStopMessage())
+	if got := HotRegion(); !reflect.DeepEqual(got, want) {
+		t.Errorf("HotRegion() = %v after stop, want %v", got, want)
+	}
+	// ...but not the targets.
+	Listen_target_addrs(NewClearMessage())
+	if got := HotRegion(); len(got) != 0 {
+		t.Errorf("HotRegion() = %v after clear, want none", got)
+	}
+}
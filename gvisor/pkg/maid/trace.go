@@ -0,0 +1,112 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// TraceEvent is the kind of a TraceRecord.
+type TraceEvent string
+
+const (
+	// TraceSample records the addresses sampled in one sampling period.
+	TraceSample TraceEvent = "sample"
+
+	// TraceDecision records what the policy made of a sample.
+	TraceDecision TraceEvent = "decision"
+)
+
+// TraceRecord is a single entry of a jitter trace.
+type TraceRecord struct {
+	// Time is when the event happened.
+	Time time.Time `json:"time"`
+
+	// Event is the kind of record.
+	Event TraceEvent `json:"event"`
+
+	// Targets are the sampled addresses, hottest first, of TraceSample, or
+	// the targets of a delayed TraceDecision. Sampled addresses are kept as
+	// sampled and may not be page aligned.
+	Targets []Target `json:"targets,omitempty"`
+
+	// Delay is whether the window after the sample is delayed, for
+	// TraceDecision.
+	Delay bool `json:"delay,omitempty"`
+
+	// Addr is the primary target of TraceDecision, if any.
+	Addr usermem.Addr `json:"addr,omitempty"`
+
+	// Reason explains TraceDecision.
+	Reason string `json:"reason,omitempty"`
+
+	// Symbols are the mappings or functions that contain Targets, in the
+	// same order, if the monitor symbolizes them.
+	Symbols []string `json:"symbols,omitempty"`
+
+	// Intensity scales the delays of a delayed TraceDecision, 0 for the
+	// usual delays.
+	Intensity float64 `json:"intensity,omitempty"`
+
+	// HITM is the number of loads sampled on the lines of the targets of
+	// a delayed TraceDecision that hit a line modified by another core.
+	HITM int `json:"hitm,omitempty"`
+}
+
+// TraceWriter writes a jitter trace as a stream of JSON records. It is safe
+// for concurrent use.
+type TraceWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewTraceWriter returns a TraceWriter writing to w.
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{enc: json.NewEncoder(w)}
+}
+
+// Write appends r to the trace. Records without a time are stamped with the
+// current time.
+func (w *TraceWriter) Write(r TraceRecord) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(&r)
+}
+
+// TraceReader reads a jitter trace written by TraceWriter.
+type TraceReader struct {
+	dec *json.Decoder
+}
+
+// NewTraceReader returns a TraceReader reading from r.
+func NewTraceReader(r io.Reader) *TraceReader {
+	return &TraceReader{dec: json.NewDecoder(r)}
+}
+
+// Next returns the next record of the trace. It returns io.EOF at the end of
+// the trace.
+func (r *TraceReader) Next() (TraceRecord, error) {
+	var rec TraceRecord
+	err := r.dec.Decode(&rec)
+	return rec, err
+}
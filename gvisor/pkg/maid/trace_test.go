@@ -0,0 +1,80 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTraceRoundTrip(t *testing.T) {
+	want := []TraceRecord{
+		{
+			Time:    time.Unix(1, 0).UTC(),
+			Event:   TraceSample,
+			Targets: []Target{{Addr: 0x1234, Accesses: 10}, {Addr: 0x5000, Accesses: 3}},
+		},
+		{
+			Time:   time.Unix(2, 0).UTC(),
+			Event:  TraceDecision,
+			Delay:  true,
+			Addr:   0x1000,
+			Reason: "hot",
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewTraceWriter(&buf)
+	for _, r := range want {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("Write(%+v) failed: %v", r, err)
+		}
+	}
+
+	r := NewTraceReader(&buf)
+	for i, w := range want {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("record %d: Next() failed: %v", i, err)
+		}
+		if !got.Time.Equal(w.Time) || got.Event != w.Event || got.Delay != w.Delay || got.Addr != w.Addr || got.Reason != w.Reason || len(got.Targets) != len(w.Targets) {
+			t.Errorf("record %d: got %+v, want %+v", i, got, w)
+		}
+		for j := range w.Targets {
+			if got.Targets[j] != w.Targets[j] {
+				t.Errorf("record %d: target %d is %+v, want %+v", i, j, got.Targets[j], w.Targets[j])
+			}
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next() at end of trace = %v, want EOF", err)
+	}
+}
+
+func TestTraceWriterStampsTime(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewTraceWriter(&buf).Write(TraceRecord{Event: TraceSample}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	got, err := NewTraceReader(&buf).Next()
+	if err != nil {
+		t.Fatalf("Next() failed: %v", err)
+	}
+	if got.Time.IsZero() {
+		t.Errorf("record has no time")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// AddrTranslator translates an address sampled by the monitor to the
+// application address of the same page. ok is false if addr maps no
+// application memory.
+//
+// Which addresses the monitor samples depends on the platform: with ptrace,
+// the application runs in host processes of its own and samples are already
+// application addresses. With KVM, the application runs inside the sentry
+// process, and samples are sentry addresses of application memory.
+type AddrTranslator func(addr usermem.Addr) (app usermem.Addr, ok bool)
+
+// AddrValidator returns whether the application address addr is mapped in
+// the guest, i.e. by an address space of the sentry's memory manager.
+type AddrValidator func(addr usermem.Addr) bool
+
+var (
+	translatorMu sync.Mutex
+	translator   AddrTranslator
+	validator    AddrValidator
+
+	// addrSpaceMin and addrSpaceMax bound the application address space.
+	// They are protected by translatorMu. An empty range disables the
+	// check.
+	addrSpaceMin usermem.Addr
+	addrSpaceMax usermem.Addr
+)
+
+// SetAddrTranslator sets the translator applied to all incoming targets. nil
+// leaves targets unchanged.
+func SetAddrTranslator(t AddrTranslator) {
+	translatorMu.Lock()
+	defer translatorMu.Unlock()
+	translator = t
+}
+
+// SetAddrValidator sets the validator every translated target must pass. nil
+// accepts all targets.
+func SetAddrValidator(v AddrValidator) {
+	translatorMu.Lock()
+	defer translatorMu.Unlock()
+	validator = v
+}
+
+// SetAddrSpace sets the bounds [min, max) of the application address space.
+// Messages whose translated targets fall outside of it are rejected.
+func SetAddrSpace(min, max usermem.Addr) {
+	translatorMu.Lock()
+	defer translatorMu.Unlock()
+	addrSpaceMin, addrSpaceMax = min, max
+}
+
+// checkAddrSpace returns an error if a translated target lies outside of the
+// application address space.
+func checkAddrSpace(targets []Target) error {
+	translatorMu.Lock()
+	min, max := addrSpaceMin, addrSpaceMax
+	translatorMu.Unlock()
+
+	if min >= max {
+		return nil
+	}
+	for _, t := range targets {
+		if t.Addr < min || t.Addr >= max {
+			return fmt.Errorf("target address %#x is outside of the address space [%#x, %#x)", t.Addr, min, max)
+		}
+	}
+	return nil
+}
+
+// translateTargets returns targets with every address translated to an
+// application address, and the address each of them was translated from.
+// Targets that can't be translated or that the validator rejects are dropped
+// and counted in Stats.UnmappedTargets, and targets that translate to the
+// same page are merged.
+func translateTargets(targets []Target) ([]Target, []usermem.Addr) {
+	translatorMu.Lock()
+	t, v := translator, validator
+	translatorMu.Unlock()
+
+	out := make([]Target, 0, len(targets))
+	origins := make([]usermem.Addr, 0, len(targets))
+	if t == nil && v == nil {
+		for _, target := range targets {
+			out = append(out, target)
+			origins = append(origins, target.Addr)
+		}
+		return out, origins
+	}
+	seen := make(map[usermem.Addr]int, len(targets))
+	for _, target := range targets {
+		addr, ok := target.Addr, true
+		if t != nil {
+			if addr, ok = t(target.Addr); !ok {
+				log.Debugf("[Cijitter] sampled address %#x backs no application memory, dropped", target.Addr)
+			}
+		}
+		if ok && v != nil {
+			if ok = v(addr); !ok {
+				log.Debugf("[Cijitter] sampled address %#x has no guest mapping at %#x, dropped", target.Addr, addr)
+			}
+		}
+		if !ok {
+			atomic.AddUint64(&stats.UnmappedTargets, 1)
+			continue
+		}
+		addr = addr.RoundDown()
+		if i, ok := seen[addr]; ok {
+			out[i].Accesses += target.Accesses
+			out[i].Lines = MergeLines(out[i].Lines, target.Lines)
+			continue
+		}
+		seen[addr] = len(out)
+		out = append(out, Target{Addr: addr, Accesses: target.Accesses, Lines: target.Lines})
+		origins = append(origins, target.Addr)
+	}
+	return out, origins
+}
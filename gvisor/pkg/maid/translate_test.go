@@ -0,0 +1,76 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"reflect"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestTranslateTargets(t *testing.T) {
+	targets := []Target{
+		{Addr: 0x7f0000001000, Accesses: 10},
+		{Addr: 0x7f0000001800, Accesses: 5},
+		{Addr: 0x7f0000009000, Accesses: 3},
+		{Addr: 0x7f0000002000, Accesses: 1},
+	}
+	if got, _ := translateTargets(targets); !reflect.DeepEqual(got, targets) {
+		t.Errorf("translateTargets() without translator = %+v, want %+v", got, targets)
+	}
+
+	SetAddrTranslator(func(addr usermem.Addr) (usermem.Addr, bool) {
+		if addr >= 0x7f0000009000 {
+			return 0, false
+		}
+		return addr - 0x7f0000000000 + 0x400000, true
+	})
+	defer SetAddrTranslator(nil)
+	want := []Target{
+		{Addr: 0x401000, Accesses: 15},
+		{Addr: 0x402000, Accesses: 1},
+	}
+	got, origins := translateTargets(targets)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("translateTargets() = %+v, want %+v", got, want)
+	}
+	if want := []usermem.Addr{0x7f0000001000, 0x7f0000002000}; !reflect.DeepEqual(origins, want) {
+		t.Errorf("translateTargets() origins = %v, want %v", origins, want)
+	}
+}
+
+func TestTranslateTargetsValidator(t *testing.T) {
+	SetAddrValidator(func(addr usermem.Addr) bool {
+		return addr < 0x7f0000009000
+	})
+	defer SetAddrValidator(nil)
+	targets := []Target{
+		{Addr: 0x7f0000001000, Accesses: 10},
+		{Addr: 0x7f0000009000, Accesses: 3},
+		{Addr: 0x7f0000002000, Accesses: 1},
+	}
+	before := CurrentStats().UnmappedTargets
+	want := []Target{
+		{Addr: 0x7f0000001000, Accesses: 10},
+		{Addr: 0x7f0000002000, Accesses: 1},
+	}
+	if got, _ := translateTargets(targets); !reflect.DeepEqual(got, want) {
+		t.Errorf("translateTargets() = %+v, want %+v", got, want)
+	}
+	if got := CurrentStats().UnmappedTargets - before; got != 1 {
+		t.Errorf("UnmappedTargets grew by %d, want 1", got)
+	}
+}
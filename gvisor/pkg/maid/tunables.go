@@ -0,0 +1,101 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"time"
+)
+
+// Tunables are the jitter parameters that can be changed while the sandbox
+// runs, to tune a long experiment without restarting the container.
+type Tunables struct {
+	// Primitive, Scope, SyscallDelay, PreemptInterval, DelayBudget and
+	// WidenRadius configure how the sentry delays the sandbox.
+	Primitive       DelayPrimitive
+	Scope           DelayScope
+	SyscallDelay    time.Duration
+	PreemptInterval time.Duration
+	DelayBudget     time.Duration
+	WidenRadius     int
+
+	// Thresholds, Hysteresis, Backoff, Compensation and Wait configure the
+	// scheduling policy, wherever it runs. Wait applies from the next
+	// window the policy opens.
+	Thresholds   Thresholds
+	Hysteresis   Hysteresis
+	Backoff      Backoff
+	Compensation Compensation
+	Wait         WaitMode
+
+	// SymbolRules are the per-function policies of the monitor.
+	SymbolRules SymbolRules
+
+	// Calendar is when the monitor protects the sandbox.
+	Calendar Calendar
+}
+
+// Validate checks that t can be applied.
+func (t *Tunables) Validate() error {
+	if t.SyscallDelay < 0 || t.PreemptInterval < 0 {
+		return fmt.Errorf("syscall delay and preempt interval must be >= 0, got: %v, %v", t.SyscallDelay, t.PreemptInterval)
+	}
+	if t.DelayBudget < 0 || t.DelayBudget > time.Second {
+		return fmt.Errorf("delay budget must be between 0 and 1s, got: %v", t.DelayBudget)
+	}
+	if t.WidenRadius < 0 || t.WidenRadius > MaxWidenRadius {
+		return fmt.Errorf("widen radius must be between 0 and %d pages, got: %d", MaxWidenRadius, t.WidenRadius)
+	}
+	if err := t.Thresholds.Validate(); err != nil {
+		return err
+	}
+	if err := t.Hysteresis.Validate(t.Thresholds); err != nil {
+		return err
+	}
+	if err := t.Backoff.Validate(); err != nil {
+		return err
+	}
+	return t.Compensation.Validate()
+}
+
+// Apply applies t to p.
+func (t *Tunables) Apply(p *Policy) {
+	p.SetThresholds(t.Thresholds)
+	p.SetHysteresis(t.Hysteresis)
+	p.SetBackoff(t.Backoff)
+	p.SetCompensation(t.Compensation)
+	p.SetWaitMode(t.Wait)
+	p.SetSymbolRules(t.SymbolRules)
+	p.SetCalendar(t.Calendar)
+}
+
+// Reload applies t to the sentry: to the delay mechanism and, when the sentry
+// schedules delays itself, to its policy. Windows already open keep going
+// with the previous settings until they close.
+func Reload(t *Tunables) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	SetDelayPrimitive(t.Primitive)
+	SetDelayScope(t.Scope)
+	SetSyscallDelay(t.SyscallDelay)
+	SetPreemptInterval(t.PreemptInterval)
+	SetDelayBudget(t.DelayBudget)
+	SetWidenRadius(t.WidenRadius)
+	if s := currentScheduler(); s != nil {
+		t.Apply(s.policy)
+	}
+	return nil
+}
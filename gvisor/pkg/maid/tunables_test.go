@@ -0,0 +1,83 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func defaultTunables() Tunables {
+	return Tunables{
+		Primitive:    DelayTrap,
+		Scope:        DelaySandbox,
+		Thresholds:   DefaultThresholds,
+		Backoff:      DefaultBackoff,
+		Compensation: DefaultCompensation,
+	}
+}
+
+func TestReload(t *testing.T) {
+	defer func() {
+		def := defaultTunables()
+		Reload(&def)
+		SetScheduler(nil)
+	}()
+
+	p := NewPolicy()
+	SetScheduler(NewScheduler(p))
+	tun := defaultTunables()
+	tun.Primitive = DelaySleep
+	tun.Wait = WaitHybrid
+	tun.SyscallDelay = time.Millisecond
+	tun.Thresholds = Thresholds{Min: 1000, Spike: 5000}
+	if err := Reload(&tun); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if got := CurrentDelayPrimitive(); got != DelaySleep {
+		t.Errorf("delay primitive after Reload() = %v, want %v", got, DelaySleep)
+	}
+	if got := p.WaitMode(); got != WaitHybrid {
+		t.Errorf("scheduler policy wait mode after Reload() = %v, want %v", got, WaitHybrid)
+	}
+	if delay, _ := p.Decide(500); delay {
+		t.Errorf("scheduler policy doesn't use the reloaded thresholds")
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mod  func(*Tunables)
+	}{
+		{name: "budget", mod: func(t *Tunables) { t.DelayBudget = 2 * time.Second }},
+		{name: "widen radius", mod: func(t *Tunables) { t.WidenRadius = MaxWidenRadius + 1 }},
+		{name: "thresholds", mod: func(t *Tunables) { t.Thresholds.Spike = t.Thresholds.Min }},
+		{name: "hysteresis", mod: func(t *Tunables) { t.Hysteresis.Off = t.Thresholds.Min + 1 }},
+		{name: "syscall delay", mod: func(t *Tunables) { t.SyscallDelay = -1 }},
+		{name: "compensation", mod: func(t *Tunables) { t.Compensation.Factor = 2 }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tun := defaultTunables()
+			tc.mod(&tun)
+			if err := Reload(&tun); err == nil {
+				t.Errorf("Reload() succeeded with invalid tunables %+v", tun)
+			}
+		})
+	}
+	if got := CurrentDelayPrimitive(); got != DelayTrap {
+		t.Errorf("rejected tunables were applied: delay primitive is %v", got)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WaitMode is how the sentry waits out the delays of the delay primitives.
+// It is chosen by the policy opening each delay window.
+type WaitMode int32
+
+const (
+	// WaitSleep sleeps. It costs no CPU, but the delay is rounded up to
+	// the timer slack and scheduling latency of the host, tens of
+	// microseconds or more.
+	WaitSleep WaitMode = iota
+
+	// WaitSpin busy-waits on the monotonic clock. Delays are precise to
+	// the microsecond, but the waiting thread keeps its CPU busy. Delays
+	// of maxSpin or more are waited out as with WaitHybrid.
+	WaitSpin
+
+	// WaitHybrid sleeps for the delay less the oversleep measured on
+	// previous sleeps, then busy-waits for the rest. It is about as precise
+	// as WaitSpin and only spins for the oversleep.
+	WaitHybrid
+)
+
+// String returns WaitMode's string representation.
+func (m WaitMode) String() string {
+	switch m {
+	case WaitSleep:
+		return "sleep"
+	case WaitSpin:
+		return "spin"
+	case WaitHybrid:
+		return "hybrid"
+	default:
+		return fmt.Sprintf("unknown(%d)", m)
+	}
+}
+
+const (
+	// calibrationSleeps is the number of sleeps timed to calibrate the
+	// oversleep of WaitHybrid.
+	calibrationSleeps = 8
+
+	// calibrationSleep is the length of the sleeps timed to calibrate
+	// the oversleep.
+	calibrationSleep = 50 * time.Microsecond
+
+	// maxOversleep caps the oversleep WaitHybrid spins for, so that a
+	// stall of the host while sleeping doesn't turn the following waits
+	// into busy-waits.
+	maxOversleep = time.Millisecond
+
+	// oversleepWeight is the weight of the last sleep in the moving
+	// average of the oversleep.
+	oversleepWeight = 0.125
+
+	// maxSpin bounds the delays WaitSpin busy-waits for, so that a long
+	// delay doesn't keep a CPU busy for its whole length.
+	maxSpin = time.Millisecond
+)
+
+// windowWait is the WaitMode of the last delay window opened. It is accessed
+// atomically.
+var windowWait int32 = int32(WaitSleep)
+
+// calibration calibrates the oversleep when the first window that may sleep
+// and spin opens.
+var calibration sync.Once
+
+// oversleep is the average time, in nanoseconds, sleeps last longer than
+// asked for. It is accessed atomically.
+var oversleep int64
+
+// setWindowWaitMode sets how the delays of the window being opened are waited
+// out. The first window waiting with WaitSpin or WaitHybrid calibrates the
+// oversleep of the host, which takes under a millisecond.
+func setWindowWaitMode(m WaitMode) {
+	if m != WaitSleep {
+		calibration.Do(calibrateOversleep)
+	}
+	atomic.StoreInt32(&windowWait, int32(m))
+}
+
+// CurrentWaitMode returns how the delays of the open delay window, or of the
+// last one outside of windows, are waited out.
+func CurrentWaitMode() WaitMode {
+	return WaitMode(atomic.LoadInt32(&windowWait))
+}
+
+// waitModeFor returns how a delay of d is waited out with m.
+func waitModeFor(m WaitMode, d time.Duration) WaitMode {
+	if m == WaitSpin && d >= maxSpin {
+		return WaitHybrid
+	}
+	return m
+}
+
+// Oversleep returns the current estimate of the time sleeps last longer
+// than asked for, which WaitHybrid spins for.
+func Oversleep() time.Duration {
+	return time.Duration(atomic.LoadInt64(&oversleep))
+}
+
+// calibrateOversleep sets the oversleep estimate from a few short sleeps.
+func calibrateOversleep() {
+	var total time.Duration
+	for i := 0; i < calibrationSleeps; i++ {
+		start := time.Now()
+		time.Sleep(calibrationSleep)
+		total += time.Since(start) - calibrationSleep
+	}
+	atomic.StoreInt64(&oversleep, int64(clampOversleep(total/calibrationSleeps)))
+}
+
+// nextOversleep returns the oversleep estimate est updated with a sleep that
+// lasted over longer than asked for.
+func nextOversleep(est, over time.Duration) time.Duration {
+	return clampOversleep(est + time.Duration(oversleepWeight*float64(over-est)))
+}
+
+// clampOversleep bounds the oversleep estimate d to [0, maxOversleep].
+func clampOversleep(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	if d > maxOversleep {
+		return maxOversleep
+	}
+	return d
+}
+
+// Wait waits for d with the WaitMode of the current window, and records how
+// long it actually waited in Stats.AccessLatency.
+func Wait(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	start := time.Now()
+	defer func() { measureDelay(time.Since(start)) }()
+	switch waitModeFor(CurrentWaitMode(), d) {
+	case WaitSpin:
+		spinUntil(time.Now().Add(d))
+	case WaitHybrid:
+		deadline := time.Now().Add(d)
+		if s := d - Oversleep(); s > 0 {
+			start := time.Now()
+			time.Sleep(s)
+			over := time.Since(start) - s
+			atomic.StoreInt64(&oversleep, int64(nextOversleep(Oversleep(), over)))
+		}
+		spinUntil(deadline)
+	default:
+		time.Sleep(d)
+	}
+}
+
+// spinUntil busy-waits until deadline.
+func spinUntil(deadline time.Time) {
+	for time.Now().Before(deadline) {
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitLastsAtLeastTheDelay(t *testing.T) {
+	defer setWindowWaitMode(WaitSleep)
+	const d = 300 * time.Microsecond
+	for _, m := range []WaitMode{WaitSleep, WaitSpin, WaitHybrid} {
+		t.Run(m.String(), func(t *testing.T) {
+			setWindowWaitMode(m)
+			for i := 0; i < 5; i++ {
+				start := time.Now()
+				Wait(d)
+				if got := time.Since(start); got < d {
+					t.Errorf("Wait(%v) returned after %v", d, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSetWindowWaitModeCalibrates(t *testing.T) {
+	defer setWindowWaitMode(WaitSleep)
+	setWindowWaitMode(WaitHybrid)
+	if got := Oversleep(); got < 0 || got > maxOversleep {
+		t.Errorf("calibrated oversleep = %v, want in [0, %v]", got, maxOversleep)
+	}
+}
+
+func TestWaitModeFor(t *testing.T) {
+	for _, tc := range []struct {
+		m    WaitMode
+		d    time.Duration
+		want WaitMode
+	}{
+		{WaitSpin, 100 * time.Microsecond, WaitSpin},
+		{WaitSpin, maxSpin - time.Microsecond, WaitSpin},
+		{WaitSpin, maxSpin, WaitHybrid},
+		{WaitSpin, time.Second, WaitHybrid},
+		{WaitSleep, time.Second, WaitSleep},
+		{WaitHybrid, 100 * time.Microsecond, WaitHybrid},
+	} {
+		if got := waitModeFor(tc.m, tc.d); got != tc.want {
+			t.Errorf("waitModeFor(%v, %v) = %v, want %v", tc.m, tc.d, got, tc.want)
+		}
+	}
+}
+
+func TestNextOversleep(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		est, over time.Duration
+		want      time.Duration
+	}{
+		{"steady", 80 * time.Microsecond, 80 * time.Microsecond, 80 * time.Microsecond},
+		{"moves towards the sleep", 0, 80 * time.Microsecond, 10 * time.Microsecond},
+		{"undersleep", 10 * time.Microsecond, -70 * time.Microsecond, 0},
+		{"host stall", maxOversleep, time.Second, maxOversleep},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextOversleep(tc.est, tc.over); got != tc.want {
+				t.Errorf("nextOversleep(%v, %v) = %v, want %v", tc.est, tc.over, got, tc.want)
+			}
+		})
+	}
+}
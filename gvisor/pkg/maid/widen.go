@@ -0,0 +1,91 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// MaxWidenRadius is the largest widening radius, in pages.
+const MaxWidenRadius = 16
+
+// widenRadius is the number of pages around every target that are delayed
+// with it. It is accessed atomically.
+var widenRadius int32
+
+// SetWidenRadius sets the number of pages on each side of every target that
+// are delayed with it.
+//
+// Delays are page granular, so the cache lines around a target within its
+// page are always delayed with it. Widening reaches the lines of neighboring
+// pages, for tables that cross page boundaries: an attacker probing the lines
+// next to a delayed one could otherwise still observe them undisturbed.
+func SetWidenRadius(pages int) {
+	atomic.StoreInt32(&widenRadius, int32(pages))
+}
+
+// WidenRadius returns the number of pages on each side of every target that
+// are delayed with it.
+func WidenRadius() int {
+	return int(atomic.LoadInt32(&widenRadius))
+}
+
+// widenTargets returns targets followed by the pages within the widening
+// radius of each of them, nearest first, with the accesses of the target
+// they widen. Pages outside of the application address space are left out,
+// and there are at most MaxBatchTargets targets in all, so that the closest
+// neighbors of the hottest targets are kept.
+func widenTargets(targets []Target) []Target {
+	radius := WidenRadius()
+	if radius == 0 || len(targets) == 0 {
+		return targets
+	}
+	translatorMu.Lock()
+	min, max := addrSpaceMin, addrSpaceMax
+	translatorMu.Unlock()
+
+	seen := make(map[usermem.Addr]bool, len(targets))
+	for _, t := range targets {
+		seen[t.Addr] = true
+	}
+	widened := append([]Target(nil), targets...)
+	add := func(addr usermem.Addr, accesses int) {
+		if seen[addr] || (min < max && (addr < min || addr >= max)) {
+			return
+		}
+		seen[addr] = true
+		widened = append(widened, Target{Addr: addr, Accesses: accesses})
+	}
+	for d := 1; d <= radius; d++ {
+		off := usermem.Addr(d * usermem.PageSize)
+		for _, t := range targets {
+			if len(widened) >= MaxBatchTargets {
+				return widened[:MaxBatchTargets]
+			}
+			if t.Addr >= off {
+				add(t.Addr-off, t.Accesses)
+			}
+			if t.Addr+off > t.Addr {
+				add(t.Addr+off, t.Accesses)
+			}
+		}
+	}
+	if len(widened) > MaxBatchTargets {
+		widened = widened[:MaxBatchTargets]
+	}
+	return widened
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"reflect"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestWidenTargets(t *testing.T) {
+	defer SetWidenRadius(0)
+	defer SetAddrSpace(0, 0)
+	SetAddrSpace(0x1000, 0x100000)
+
+	for _, tc := range []struct {
+		name    string
+		radius  int
+		targets []Target
+		want    []Target
+	}{
+		{
+			name:    "disabled",
+			targets: []Target{{Addr: 0x5000, Accesses: 10}},
+			want:    []Target{{Addr: 0x5000, Accesses: 10}},
+		},
+		{
+			name:    "nearest first",
+			radius:  2,
+			targets: []Target{{Addr: 0x5000, Accesses: 10}},
+			want: []Target{
+				{Addr: 0x5000, Accesses: 10},
+				{Addr: 0x4000, Accesses: 10},
+				{Addr: 0x6000, Accesses: 10},
+				{Addr: 0x3000, Accesses: 10},
+				{Addr: 0x7000, Accesses: 10},
+			},
+		},
+		{
+			name:   "overlapping",
+			radius: 1,
+			targets: []Target{
+				{Addr: 0x5000, Accesses: 10},
+				{Addr: 0x6000, Accesses: 5},
+			},
+			want: []Target{
+				{Addr: 0x5000, Accesses: 10},
+				{Addr: 0x6000, Accesses: 5},
+				{Addr: 0x4000, Accesses: 10},
+				{Addr: 0x7000, Accesses: 5},
+			},
+		},
+		{
+			name:    "address space bounds",
+			radius:  1,
+			targets: []Target{{Addr: 0x1000, Accesses: 10}},
+			want: []Target{
+				{Addr: 0x1000, Accesses: 10},
+				{Addr: 0x2000, Accesses: 10},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			SetWidenRadius(tc.radius)
+			if got := widenTargets(tc.targets); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("widenTargets(%v) = %v, want %v", tc.targets, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWidenTargetsLimit(t *testing.T) {
+	defer SetWidenRadius(0)
+	SetWidenRadius(MaxWidenRadius)
+
+	var targets []Target
+	for i := 0; i < 8; i++ {
+		targets = append(targets, Target{Addr: usermem.Addr(0x100000 + i*0x100000), Accesses: 8 - i})
+	}
+	got := widenTargets(targets)
+	if len(got) != MaxBatchTargets {
+		t.Fatalf("widenTargets() returned %d targets, want %d", len(got), MaxBatchTargets)
+	}
+	// All targets are kept, with their closest neighbors.
+	if !reflect.DeepEqual(got[:len(targets)], targets) {
+		t.Errorf("widenTargets() starts with %v, want %v", got[:len(targets)], targets)
+	}
+	if want := (Target{Addr: 0xff000, Accesses: 8}); got[len(targets)] != want {
+		t.Errorf("first neighbor is %v, want %v", got[len(targets)], want)
+	}
+}
+
+func TestWidenedNeighborsDelayed(t *testing.T) {
+	defer SetWidenRadius(0)
+	defer SetAddrSpace(0, 0)
+	SetAddrSpace(0x1000, 0x100000)
+	SetWidenRadius(1)
+
+	if ack := Listen_target_addrs(NewStartMessage(0x5000, 10)); ack.Err != "" {
+		t.Fatalf("Start rejected: %s", ack.Err)
+	}
+	defer stopDelay()
+
+	// The delayer protects the pages returned by DelayPages, and
+	// start_delay only those for which IsDelayed holds.
+	want := []usermem.Addr{0x5000, 0x4000, 0x6000}
+	if got := DelayPages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DelayPages() = %x, want %x", got, want)
+	}
+	for _, addr := range want {
+		if !IsDelayed(addr) {
+			t.Errorf("IsDelayed(%#x) = false, want the neighbors of 0x5000 delayed", addr)
+		}
+	}
+	if IsDelayed(0x7000) {
+		t.Errorf("IsDelayed(0x7000) = true, beyond the widening radius")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// DefaultHistoryWindow is the number of samples policies look back on
+	// by default.
+	DefaultHistoryWindow = 3
+
+	// MinHistoryWindow and MaxHistoryWindow bound the number of samples a
+	// policy looks back on. A variance needs two samples.
+	MinHistoryWindow = 2
+	MaxHistoryWindow = 256
+)
+
+// ValidateHistoryWindow returns an error if a policy can't look back on n
+// samples.
+func ValidateHistoryWindow(n int) error {
+	if n < MinHistoryWindow || n > MaxHistoryWindow {
+		return fmt.Errorf("history window must be between %d and %d samples, got: %d", MinHistoryWindow, MaxHistoryWindow, n)
+	}
+	return nil
+}
+
+// welford is the running mean and sum of squared deviations of a set of
+// samples, as updated by Welford's algorithm.
+//
+// +stateify savable
+type welford struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+// add adds x to the set.
+func (s *welford) add(x float64) {
+	s.n++
+	d := x - s.mean
+	s.mean += d / float64(s.n)
+	s.m2 += d * (x - s.mean)
+}
+
+// remove removes x, which must be in the set, from it.
+func (s *welford) remove(x float64) {
+	if s.n <= 1 {
+		*s = welford{}
+		return
+	}
+	d := x - s.mean
+	s.mean -= d / float64(s.n-1)
+	s.m2 -= d * (x - s.mean)
+	s.n--
+	// Rounding must not make the variance negative.
+	if s.m2 < 0 {
+		s.m2 = 0
+	}
+}
+
+// stddev returns the population standard deviation of the set.
+func (s *welford) stddev() float64 {
+	if s.n == 0 {
+		return 0
+	}
+	return math.Sqrt(s.m2 / float64(s.n))
+}
+
+// Window is a sliding window over the last samples of a series, whose mean
+// and standard deviation are updated online as samples come and go. A
+// larger window makes them steadier, a smaller one quicker to follow the
+// series.
+//
+// +stateify savable
+type Window struct {
+	// samples holds the samples in the window, next the position of the
+	// next one. samples wraps around once the window is full.
+	samples []float64
+	next    int
+
+	// stats are those of the samples in the window.
+	stats welford
+}
+
+// NewWindow returns an empty window over the last size samples. size must be
+// valid for ValidateHistoryWindow.
+func NewWindow(size int) *Window {
+	return &Window{samples: make([]float64, size)}
+}
+
+// Size returns the number of samples w holds at most.
+func (w *Window) Size() int {
+	return len(w.samples)
+}
+
+// Len returns the number of samples in w.
+func (w *Window) Len() int {
+	return w.stats.n
+}
+
+// Add adds x to w, evicting the oldest sample if w is full.
+func (w *Window) Add(x float64) {
+	if w.stats.n == len(w.samples) {
+		w.stats.remove(w.samples[w.next])
+	}
+	w.samples[w.next] = x
+	w.stats.add(x)
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+	}
+}
+
+// Last returns the last sample added to w, 0 if it is empty.
+func (w *Window) Last() float64 {
+	if w.stats.n == 0 {
+		return 0
+	}
+	if w.next == 0 {
+		return w.samples[len(w.samples)-1]
+	}
+	return w.samples[w.next-1]
+}
+
+// Mean returns the mean of the samples in w.
+func (w *Window) Mean() float64 {
+	return w.stats.mean
+}
+
+// StdDev returns the standard deviation of the samples in w.
+func (w *Window) StdDev() float64 {
+	return w.stats.stddev()
+}
+
+// With returns the mean and standard deviation w would have if x were added
+// to it. w is left unchanged.
+func (w *Window) With(x float64) (mean, stddev float64) {
+	s := w.stats
+	if s.n == len(w.samples) {
+		s.remove(w.samples[w.next])
+	}
+	s.add(x)
+	return s.mean, s.stddev()
+}
+
+// Samples returns the samples in w, oldest first.
+func (w *Window) Samples() []float64 {
+	out := make([]float64, 0, w.stats.n)
+	start := w.next - w.stats.n
+	if start < 0 {
+		start += len(w.samples)
+	}
+	for i := 0; i < w.stats.n; i++ {
+		out = append(out, w.samples[(start+i)%len(w.samples)])
+	}
+	return out
+}
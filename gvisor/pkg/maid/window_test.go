@@ -0,0 +1,86 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maid
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// meanStdDev returns the mean and population standard deviation of xs.
+func meanStdDev(xs []float64) (float64, float64) {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+	sq := 0.0
+	for _, x := range xs {
+		sq += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(xs)))
+}
+
+func TestWindowSlides(t *testing.T) {
+	w := NewWindow(4)
+	xs := []float64{500, 20, 7, 1300, 80, 80, 81, 2, 90000, 3}
+	for i, x := range xs {
+		w.Add(x)
+		start := i + 1 - w.Size()
+		if start < 0 {
+			start = 0
+		}
+		want := xs[start : i+1]
+		if got := w.Samples(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("after %d samples: Samples() = %v, want %v", i+1, got, want)
+		}
+		if w.Last() != x {
+			t.Errorf("after %d samples: Last() = %v, want %v", i+1, w.Last(), x)
+		}
+		mean, stddev := meanStdDev(want)
+		if math.Abs(w.Mean()-mean) > 1e-6*mean || math.Abs(w.StdDev()-stddev) > 1e-6*(stddev+1) {
+			t.Errorf("after %d samples: mean %v, stddev %v, want %v, %v", i+1, w.Mean(), w.StdDev(), mean, stddev)
+		}
+	}
+}
+
+func TestWindowWith(t *testing.T) {
+	w := NewWindow(3)
+	for _, x := range []float64{100, 200, 300} {
+		w.Add(x)
+	}
+	mean, stddev := w.With(600)
+	wantMean, wantStdDev := meanStdDev([]float64{200, 300, 600})
+	if math.Abs(mean-wantMean) > 1e-9 || math.Abs(stddev-wantStdDev) > 1e-9 {
+		t.Errorf("With(600) = %v, %v, want %v, %v", mean, stddev, wantMean, wantStdDev)
+	}
+	if got := w.Samples(); !reflect.DeepEqual(got, []float64{100, 200, 300}) {
+		t.Errorf("With() changed the window to %v", got)
+	}
+}
+
+func TestValidateHistoryWindow(t *testing.T) {
+	for _, n := range []int{MinHistoryWindow, DefaultHistoryWindow, MaxHistoryWindow} {
+		if err := ValidateHistoryWindow(n); err != nil {
+			t.Errorf("ValidateHistoryWindow(%d) failed: %v", n, err)
+		}
+	}
+	for _, n := range []int{0, 1, MaxHistoryWindow + 1} {
+		if err := ValidateHistoryWindow(n); err == nil {
+			t.Errorf("ValidateHistoryWindow(%d) succeeded, want error", n)
+		}
+	}
+}
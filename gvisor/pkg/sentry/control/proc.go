@@ -286,19 +286,21 @@ type Process struct {
 	STime string `json:"stime"`
 	// CPU time
 	Time string `json:"time"`
+	// Time spent in the delays injected by Cijitter
+	Delay string `json:"delay"`
 	// Executable shortname (e.g. "sh" for /bin/sh)
 	Cmd string `json:"cmd"`
 }
 
 // ProcessListToTable prints a table with the following format:
-// UID       PID       PPID      C         TTY		STIME     TIME       CMD
-// 0         1         0         0         pty/4	14:04     505262ns   tail
+// UID       PID       PPID      C         TTY		STIME     TIME       DELAY     CMD
+// 0         1         0         0         pty/4	14:04     505262ns   1.2ms     tail
 func ProcessListToTable(pl []*Process) string {
 	var buf bytes.Buffer
 	tw := tabwriter.NewWriter(&buf, 10, 1, 3, ' ', 0)
-	fmt.Fprint(tw, "UID\tPID\tPPID\tC\tTTY\tSTIME\tTIME\tCMD")
+	fmt.Fprint(tw, "UID\tPID\tPPID\tC\tTTY\tSTIME\tTIME\tDELAY\tCMD")
 	for _, d := range pl {
-		fmt.Fprintf(tw, "\n%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s",
+		fmt.Fprintf(tw, "\n%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s",
 			d.UID,
 			d.PID,
 			d.PPID,
@@ -306,6 +308,7 @@ func ProcessListToTable(pl []*Process) string {
 			d.TTY,
 			d.STime,
 			d.Time,
+			d.Delay,
 			d.Cmd)
 	}
 	tw.Flush()
@@ -365,6 +368,7 @@ func Processes(k *kernel.Kernel, containerID string, out *[]*Process) error {
 			STime:   formatStartTime(now, tg.Leader().StartTime()),
 			C:       percentCPU(tg.CPUStats(), tg.Leader().StartTime(), now),
 			Time:    tg.CPUStats().SysTime.String(),
+			Delay:   tg.JitterDelay().String(),
 			Cmd:     tg.Leader().Name(),
 			TTY:     ttyName(tg.TTY()),
 		})
@@ -34,7 +34,7 @@ func TestProcessListTable(t *testing.T) {
 	}{
 		{
 			pl:       []*Process{},
-			expected: "UID       PID       PPID      C         TTY       STIME     TIME      CMD",
+			expected: "UID       PID       PPID      C         TTY       STIME     TIME      DELAY     CMD",
 		},
 		{
 			pl: []*Process{
@@ -46,6 +46,7 @@ func TestProcessListTable(t *testing.T) {
 					TTY:   "?",
 					STime: "0",
 					Time:  "0",
+					Delay: "0s",
 					Cmd:   "zero",
 				},
 				{
@@ -56,12 +57,13 @@ func TestProcessListTable(t *testing.T) {
 					TTY:   "pts/4",
 					STime: "1",
 					Time:  "1",
+					Delay: "1.5ms",
 					Cmd:   "one",
 				},
 			},
-			expected: `UID       PID       PPID      C         TTY       STIME     TIME      CMD
-0         0         0         0         ?         0         0         zero
-1         1         1         1         pts/4     1         1         one`,
+			expected: `UID       PID       PPID      C         TTY       STIME     TIME      DELAY     CMD
+0         0         0         0         ?         0         0         0s        zero
+1         1         1         1         pts/4     1         1         1.5ms     one`,
 		},
 	}
 
@@ -793,3 +793,22 @@ func (m *Manager) unlockPILocked(t Target, addr usermem.Addr, tid uint32, b *buc
 	b.wakeWaiterLocked(next)
 	return nil
 }
+
+// Contended returns whether tasks wait on the private futex at addr and fn
+// returns true. fn is called with the bucket of the futex locked, so it may
+// access the futex word but must not call m.
+func (m *Manager) Contended(t Target, addr usermem.Addr, fn func() bool) bool {
+	k, err := getKey(t, addr, true)
+	if err != nil {
+		return false
+	}
+	defer k.release()
+	b := m.lockBucket(&k)
+	defer b.mu.Unlock()
+	for w := b.waiters.Front(); w != nil; w = w.Next() {
+		if w.key.matches(&k) {
+			return fn()
+		}
+	}
+	return false
+}
@@ -528,3 +528,36 @@ func TestMutexStress(t *testing.T) {
 		<-c
 	}
 }
+
+func TestContended(t *testing.T) {
+	m := NewManager()
+	d := newTestData(3 * sizeofInt32)
+
+	// Wait on the first futex, privately, and on the last one, shared.
+	w1 := newPreparedTestWaiter(t, m, d, 0, true, 0, ^uint32(0))
+	defer m.WaitComplete(w1)
+	w3 := newPreparedTestWaiter(t, m, d, 2*sizeofInt32, false, 0, ^uint32(0))
+	defer m.WaitComplete(w3)
+
+	yes := func() bool { return true }
+	if !m.Contended(d, 0, yes) {
+		t.Errorf("Contended(0): got false, wanted true")
+	}
+	if m.Contended(d, 0, func() bool { return false }) {
+		t.Errorf("Contended(0) with fn returning false: got true, wanted false")
+	}
+	if m.Contended(d, sizeofInt32, yes) {
+		t.Errorf("Contended(%d): got true for a futex nobody waits on", sizeofInt32)
+	}
+	if m.Contended(d, 2*sizeofInt32, yes) {
+		t.Errorf("Contended(%d): got true for a shared futex", 2*sizeofInt32)
+	}
+
+	// Waking the futex leaves it uncontended.
+	if _, err := m.Wake(d, 0, true, ^uint32(0), 1); err != nil {
+		t.Fatalf("Wake failed: %v", err)
+	}
+	if m.Contended(d, 0, yes) {
+		t.Errorf("Contended(0): got true after the wakeup, wanted false")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// forEachMM calls fn with every address space of the kernel, once each, until
+// fn returns true. fn holds a user of the address space.
+func (k *Kernel) forEachMM(fn func(*mm.MemoryManager) bool) {
+	ctx := k.SupervisorContext()
+	seen := make(map[*mm.MemoryManager]struct{})
+	for _, t := range k.tasks.Root.Tasks() {
+		var m *mm.MemoryManager
+		t.WithMuLocked(func(t *Task) {
+			if m = t.MemoryManager(); m != nil && !m.IncUsers() {
+				m = nil
+			}
+		})
+		if m == nil {
+			continue
+		}
+		if _, ok := seen[m]; ok {
+			m.DecUsers(ctx)
+			continue
+		}
+		seen[m] = struct{}{}
+		done := fn(m)
+		m.DecUsers(ctx)
+		if done {
+			return
+		}
+	}
+}
+
+// RearmFaults removes the application from the platform address space of
+// every address space of the kernel, so that the next access to each page
+// faults into the sentry and maid.CountFault counts it.
+func (k *Kernel) RearmFaults() {
+	k.forEachMM(func(m *mm.MemoryManager) bool {
+		m.UnmapAllAS()
+		return false
+	})
+}
+
+// AppAddrOfSentryAddr translates addr, an address of the sentry's internal
+// mapping of application memory, to the application address it backs. It is
+// a maid.AddrTranslator for platforms, like KVM, on which the application
+// runs inside the sentry address space, so that the monitor samples sentry
+// addresses.
+//
+// Memory shared between address spaces is translated to the address of the
+// first address space found that maps it.
+func (k *Kernel) AppAddrOfSentryAddr(addr usermem.Addr) (app usermem.Addr, ok bool) {
+	off, inFile := k.mf.OffsetOf(uintptr(addr))
+	if !inFile {
+		return 0, false
+	}
+	k.forEachMM(func(m *mm.MemoryManager) bool {
+		app, ok = m.AddrOfFileOffset(k.mf, off)
+		return ok
+	})
+	return app, ok
+}
+
+// IsAppAddrMapped returns whether the page of the application address addr is
+// mapped by any address space of the kernel. It is a maid.AddrValidator.
+func (k *Kernel) IsAppAddrMapped(addr usermem.Addr) bool {
+	page := addr.RoundDown()
+	ar, ok := page.ToRange(usermem.PageSize)
+	if !ok {
+		return false
+	}
+	mapped := false
+	k.forEachMM(func(m *mm.MemoryManager) bool {
+		mapped = m.IsMapped(ar)
+		return mapped
+	})
+	return mapped
+}
+
+// MappingOfAppAddr returns the mapping that contains the application address
+// addr, as mm.MemoryManager.MappingOf does. It is a maid.AddrSymbolizer.
+//
+// Addresses mapped by several address spaces are resolved in the first one
+// found that maps them.
+func (k *Kernel) MappingOfAppAddr(addr usermem.Addr) (name string, off uint64, ok bool) {
+	ctx := k.SupervisorContext()
+	k.forEachMM(func(m *mm.MemoryManager) bool {
+		name, off, ok = m.MappingOf(ctx, addr)
+		return ok
+	})
+	return name, off, ok
+}
+
+// AppAddrOfMapping returns the application address at which offset off of the
+// mapping named name is mapped, as mm.MemoryManager.AddrOfMapping does. It is
+// a maid.MappingResolver.
+func (k *Kernel) AppAddrOfMapping(name string, off uint64) (addr usermem.Addr, ok bool) {
+	ctx := k.SupervisorContext()
+	k.forEachMM(func(m *mm.MemoryManager) bool {
+		addr, ok = m.AddrOfMapping(ctx, name, off)
+		return ok
+	})
+	return addr, ok
+}
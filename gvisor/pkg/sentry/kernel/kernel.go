@@ -44,6 +44,7 @@ import (
 	"gvisor.dev/gvisor/pkg/eventchannel"
 	"gvisor.dev/gvisor/pkg/fspath"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
@@ -84,12 +85,19 @@ type ShareAddr struct {
         modified map[usermem.Addr]int
 	perms map[usermem.Addr]usermem.AccessType
 	master string
+	// unmapped holds the pages dropped from the address space by the
+	// unmap delay primitive that were not accessed since.
+	unmapped map[usermem.Addr]bool
+	// protectedAt is when each page in modified was protected.
+	protectedAt map[usermem.Addr]time.Time
 }
 
 func newShareAddr() *ShareAddr {
     maddr := new(ShareAddr)
     maddr.modified = make(map[usermem.Addr]int)
     maddr.perms = make(map[usermem.Addr]usermem.AccessType)
+    maddr.unmapped = make(map[usermem.Addr]bool)
+    maddr.protectedAt = make(map[usermem.Addr]time.Time)
     maddr.master = ""
 
     return maddr
@@ -310,6 +318,22 @@ type Kernel struct {
 	// If set to true, report address space activation waits as if the task is in
 	// external wait so that the watchdog doesn't report the task stuck.
 	SleepForAddressSpaceActivation bool
+
+	// JitterPolicy is the delay scheduling policy when it runs in the sentry
+	// rather than in the monitor. It is saved with the kernel so that a
+	// restored sandbox keeps its sampling history. It may be nil.
+	JitterPolicy *maid.Policy
+
+	// JitterState is the jitter state of the sentry, captured when the
+	// kernel is saved. It is only meaningful on a restored kernel, where it
+	// may be nil.
+	JitterState *maid.State
+
+	// realtimeFuzz and monotonicFuzz, if not nil, degrade the times of the
+	// realtime and monotonic clocks returned to applications. They are set
+	// by SetClockFuzz.
+	realtimeFuzz  *ktime.Fuzzer
+	monotonicFuzz *ktime.Fuzzer
 }
 
 // InitKernelArgs holds arguments to Init.
@@ -522,6 +546,10 @@ func (k *Kernel) SaveTo(w wire.Writer) error {
 	}
 	log.Infof("CPUID save took [%s].", time.Since(cpuidStart))
 
+	// Carry the jitter targets and the monitor's history over to the
+	// restored sandbox.
+	k.JitterState = maid.SaveState()
+
 	// Save the kernel state.
 	kernelStart := time.Now()
 	stats, err := state.Save(k.SupervisorContext(), w, k)
@@ -1442,6 +1470,37 @@ func (k *Kernel) MonotonicClock() ktime.Clock {
 	return k.monotonicClock
 }
 
+// SetClockFuzz degrades the times of the realtime and monotonic clocks that
+// are returned to applications. Fuzzed clocks are no longer read by the VDSO,
+// so that every read goes through ApplicationTime.
+//
+// The TSC is still read natively by applications and is not fuzzed.
+func (k *Kernel) SetClockFuzz(realtime, monotonic ktime.Fuzz) {
+	k.realtimeFuzz, k.monotonicFuzz = nil, nil
+	if realtime.Enabled() {
+		k.realtimeFuzz = ktime.NewFuzzer(realtime)
+	}
+	if monotonic.Enabled() {
+		k.monotonicFuzz = ktime.NewFuzzer(monotonic)
+	}
+	k.timekeeper.SetVDSOFallback(sentrytime.Realtime, realtime.Enabled())
+	k.timekeeper.SetVDSOFallback(sentrytime.Monotonic, monotonic.Enabled())
+}
+
+// ApplicationTime returns the current time of c as it is returned to
+// applications, i.e. degraded as configured with SetClockFuzz.
+func (k *Kernel) ApplicationTime(c ktime.Clock) ktime.Time {
+	now := c.Now()
+	switch {
+	case c == k.RealtimeClock() && k.realtimeFuzz != nil:
+		return k.realtimeFuzz.Apply(now)
+	case c == k.MonotonicClock() && k.monotonicFuzz != nil:
+		return k.monotonicFuzz.Apply(now)
+	default:
+		return now
+	}
+}
+
 // CPUClockNow returns the current value of k.cpuClock.
 func (k *Kernel) CPUClockNow() uint64 {
 	return atomic.LoadUint64(&k.cpuClock)
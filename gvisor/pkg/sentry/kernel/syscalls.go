@@ -101,6 +101,10 @@ const (
 
 	// ExternalAfterEnable enables the external hook after syscall execution.
 	ExternalAfterEnable
+
+	// JitterEnable delays the syscall by a random amount during delay
+	// windows.
+	JitterEnable
 )
 
 // StraceEnableBits combines both strace log and event flags.
@@ -18,6 +18,7 @@ import (
 	gocontext "context"
 	"runtime/trace"
 	"sync/atomic"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/bpf"
@@ -563,6 +564,30 @@ type Task struct {
 	// using for get the perms of a page
 	At usermem.AccessType
 	atFlag bool
+
+	// jitterPreempt is set to 1 by preemptJitter to have the task goroutine
+	// yield before it next switches to the application. It is accessed
+	// atomically.
+	jitterPreempt uint32 `state:"nosave"`
+
+	// jitterOwed is the delay deferred by jitterDelay while t held a
+	// contended futex. It is owned by the task goroutine.
+	jitterOwed time.Duration `state:"nosave"`
+
+	// jitterFutexMu guards jitterFutexes.
+	jitterFutexMu sync.Mutex `state:"nosave"`
+
+	// jitterFutexes are the private futexes other tasks of the thread
+	// group started waiting on while their word named t as the owner, and
+	// whether they are PI futexes. Entries are dropped once t no longer
+	// holds them or they have no waiters left.
+	//
+	// jitterFutexes is guarded by jitterFutexMu.
+	jitterFutexes map[usermem.Addr]bool `state:"nosave"`
+
+	// jitterDelayed is the total time, in nanoseconds, t has spent in the
+	// delays injected by Cijitter. It is accessed atomically.
+	jitterDelayed int64 `state:"nosave"`
 }
 
 func (t *Task) savePtraceTracer() *Task {
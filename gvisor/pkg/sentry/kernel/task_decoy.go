@@ -0,0 +1,63 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// decoyAccesses reads the decoy pages of maid.DecoyTargets while a delay
+// window is open, so that accesses to the target don't stand out in what an
+// attacker observes. Like monitor_timer, it only does work while t is the
+// delay worker, and exits with t.
+func (t *Task) decoyAccesses() {
+	interval := maid.DecoyInterval()
+	if interval <= 0 {
+		return
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	var b [1]byte
+	for range tick.C {
+		if !t.pgf {
+			return
+		}
+		Dthread.RLock()
+		worker := t.tid == Dthread.Worker
+		Dthread.RUnlock()
+		if !worker {
+			continue
+		}
+		if !maid.WindowOpen() {
+			continue
+		}
+		mm := t.MemoryManager()
+		if mm == nil {
+			continue
+		}
+		for _, addr := range maid.DecoyTargets() {
+			// Decoys may be protected by a delay of their own, or unmapped
+			// since they were configured; neither matters.
+			if _, err := mm.CopyIn(t, addr, b[:], usermem.IOOpts{IgnorePermissions: true}); err != nil {
+				log.Debugf("[Cijitter] decoy access to %x failed: %v", addr, err)
+			}
+		}
+	}
+}
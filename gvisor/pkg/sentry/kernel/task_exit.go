@@ -666,6 +666,7 @@ func (t *Task) exitNotifyLocked(fromPtraceDetach bool) {
 			}
 		}
 		t.tg.exitedCPUStats.Accumulate(t.CPUStats())
+		t.tg.exitedJitterDelay += t.JitterDelay()
 		t.tg.ioUsage.Accumulate(t.ioUsage)
 		t.tg.signalHandlers.mu.Lock()
 		t.tg.tasks.Remove(t)
@@ -0,0 +1,314 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// syscallJitter delays a system call enabled with JitterEnable by
+// maid.SyscallDelay. The delay is interruptible; an interrupted task goes on
+// with the system call, which will notice the pending signal itself.
+func (t *Task) syscallJitter() {
+	if d := maid.SyscallDelay(); d > 0 {
+		start := time.Now()
+		t.BlockWithTimeout(nil, true, d)
+		t.accountJitterDelay(time.Since(start))
+	}
+}
+
+// preemptJitter preempts t at random times while it is the delay worker and a
+// delay window is open, so that it doesn't stay on the same host thread, and
+// hence vCPU or core, for the whole window. It exits with t.
+func (t *Task) preemptJitter() {
+	for {
+		d := maid.NextPreempt()
+		if d == 0 || !t.pgf {
+			return
+		}
+		time.Sleep(d)
+
+		Dthread.RLock()
+		worker := t.tid == Dthread.Worker
+		Dthread.RUnlock()
+		if !worker || !maid.WindowOpen() {
+			continue
+		}
+		atomic.StoreUint32(&t.jitterPreempt, 1)
+		t.p.Interrupt()
+	}
+}
+
+// jitterYield yields the task goroutine if preemptJitter preempted t, giving
+// the Go scheduler a chance to resume it on another thread. Like any other
+// preemption, it may move the task to another CPU, so rseq is interrupted.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) jitterYield() {
+	if atomic.CompareAndSwapUint32(&t.jitterPreempt, 1, 0) {
+		runtime.Gosched()
+		t.rseqPreempted = true
+	}
+}
+
+// MarkJitterSecret implements madvise(maid.MadvSecret) and
+// madvise(maid.MadvNoSecret): it marks [addr, addr+length) of t's address
+// space as secret, so that it is delayed in every delay window, or unmarks
+// it.
+func (t *Task) MarkJitterSecret(addr usermem.Addr, length uint64, secret bool) error {
+	ar, ok := addr.ToRange(length)
+	if !ok {
+		return syserror.EINVAL
+	}
+	if secret && !t.MemoryManager().IsMapped(ar) {
+		return syserror.ENOMEM
+	}
+	if err := maid.MarkSecret(ar, secret); err != nil {
+		t.Debugf("[Cijitter] %v", err)
+		return syserror.EAGAIN
+	}
+	return nil
+}
+
+// shuffleJitterSecret permutes the frames of the pages marked secret in t's
+// address space every maid.ShuffleInterval, if t leads its thread group, so
+// that every address space is shuffled once. It exits with t.
+func (t *Task) shuffleJitterSecret() {
+	tick := time.NewTicker(maid.ShuffleInterval())
+	defer tick.Stop()
+	for range tick.C {
+		if !t.pgf {
+			return
+		}
+		if t.tg.Leader() != t {
+			continue
+		}
+		pages := maid.SecretPages()
+		if len(pages) < 2 {
+			continue
+		}
+		mm := t.MemoryManager()
+		if mm == nil {
+			continue
+		}
+		n, err := mm.ShufflePages(pages, maid.ShufflePermutation)
+		if err != nil {
+			log.Debugf("[Cijitter] shuffling %d secret pages failed: %v", len(pages), err)
+			continue
+		}
+		if n != 0 {
+			maid.RecordShuffle(n)
+		}
+	}
+}
+
+// pageTierJitter applies the primitive of the page tier to the hot region of
+// t's address space every maid.CurrentPageTier().Interval, if t leads its
+// thread group, so that every address space is covered once. Delay windows
+// open or not. It exits with t.
+func (t *Task) pageTierJitter() {
+	tier := maid.CurrentPageTier()
+	tick := time.NewTicker(tier.Interval)
+	defer tick.Stop()
+	for range tick.C {
+		if !t.pgf {
+			return
+		}
+		if t.tg.Leader() != t || maid.Suspended() {
+			continue
+		}
+		pages := maid.HotRegion()
+		if len(pages) == 0 {
+			continue
+		}
+		mm := t.MemoryManager()
+		if mm == nil {
+			continue
+		}
+		n := 0
+		for _, page := range pages {
+			var err error
+			switch tier.Primitive {
+			case maid.DelayFlush:
+				err = mm.FlushPage(t, page)
+			case maid.DelayUnmap:
+				err = mm.UnmapAS(page)
+			case maid.DelayRecolor:
+				err = mm.RecolorPage(page)
+			}
+			if err != nil {
+				log.Debugf("[Cijitter] page tier %v of %x failed: %v", tier.Primitive, page, err)
+				continue
+			}
+			n++
+		}
+		maid.RecordPageTier(n)
+	}
+}
+
+// Layout of a glibc pthread_mutex_t, whose lock word comes first.
+const (
+	// glibcMutexOwnerOffset is the offset of the owner TID.
+	glibcMutexOwnerOffset = 8
+
+	// glibcMutexKindOffset is the offset of the mutex type and flags.
+	glibcMutexKindOffset = 16
+
+	// glibcMutexContended is the lock word of a mutex that is locked and
+	// has waiters, as lll_lock leaves it.
+	glibcMutexContended = 2
+
+	// glibcMutexPlainKinds are the bits of the type and flags of the
+	// mutexes that lock with lll_lock: normal, recursive, error checking
+	// and adaptive, possibly process-shared or elided. Robust, PI and
+	// priority protected mutexes keep other values in the lock word.
+	glibcMutexPlainKinds = 0x3 | 0x80 | 0x100 | 0x200
+)
+
+// futexOwner returns the TID of the task holding the futex at addr: the TID
+// in the word of a PI futex, or the owner field of a glibc mutex whose lock
+// word is contended. Condition variables, semaphores and other plain futexes
+// carry no owner, and ok is false for them.
+func (t *Task) futexOwner(addr usermem.Addr, pi bool) (owner uint32, ok bool) {
+	word, err := t.LoadUint32(addr)
+	if err != nil {
+		return 0, false
+	}
+	if pi {
+		owner = word & linux.FUTEX_TID_MASK
+		return owner, owner != 0
+	}
+	if word != glibcMutexContended {
+		return 0, false
+	}
+	kind, err := t.LoadUint32(addr + glibcMutexKindOffset)
+	if err != nil || kind&^glibcMutexPlainKinds != 0 {
+		return 0, false
+	}
+	owner, err = t.LoadUint32(addr + glibcMutexOwnerOffset)
+	return owner, err == nil && owner != 0
+}
+
+// JitterFutexWait records that t is about to wait on the private futex at
+// addr, a PI futex if pi is true, on the task of its thread group holding
+// it, if maid.DeferLockHolders is set. The holder then knows the futex is
+// contended without looking at the futexes of the whole address space.
+func (t *Task) JitterFutexWait(addr usermem.Addr, pi bool) {
+	if !maid.DeferLockHolders() {
+		return
+	}
+	tid, ok := t.futexOwner(addr, pi)
+	if !ok {
+		return
+	}
+	holder := t.tg.pidns.TaskWithID(ThreadID(tid))
+	if holder == nil || holder == t || holder.tg != t.tg {
+		return
+	}
+	holder.jitterFutexMu.Lock()
+	if holder.jitterFutexes == nil {
+		holder.jitterFutexes = make(map[usermem.Addr]bool)
+	}
+	holder.jitterFutexes[addr] = pi
+	holder.jitterFutexMu.Unlock()
+}
+
+// holdsContendedFutex returns whether t holds a futex other tasks of its
+// thread group are waiting on: a PI futex whose word names t, or a glibc
+// mutex whose owner field names t. Only the futexes recorded by
+// JitterFutexWait are checked. Plain futexes carry no owner, so locks other
+// than these go unnoticed.
+func (t *Task) holdsContendedFutex() bool {
+	tid := uint32(t.ThreadID())
+	t.jitterFutexMu.Lock()
+	defer t.jitterFutexMu.Unlock()
+	for addr, pi := range t.jitterFutexes {
+		if t.Futex().Contended(t, addr, func() bool {
+			owner, ok := t.futexOwner(addr, pi)
+			return ok && owner == tid
+		}) {
+			return true
+		}
+		// Released, or given up on by its waiters.
+		delete(t.jitterFutexes, addr)
+	}
+	return false
+}
+
+// jitterDelay waits out the delay d of t, unless maid.DeferLockHolders is set
+// and t holds a contended futex: delaying it would stall its waiters too, so
+// the delay is owed until t releases the futex.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) jitterDelay(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if maid.DeferLockHolders() && t.holdsContendedFutex() {
+		log.Debugf("[Cijitter] thread %s holds a contended futex, deferring %v", t.tid, d)
+		t.jitterOwed = maid.DeferDelay(t.jitterOwed, d)
+		return
+	}
+	maid.Wait(d)
+	t.accountJitterDelay(d)
+}
+
+// jitterRelease waits out the delays t owes once it no longer holds a
+// contended futex. It is called after every futex system call of t while it
+// owes delays, since releasing a contended lock takes one.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) jitterRelease() {
+	if t.holdsContendedFutex() {
+		return
+	}
+	d := t.jitterOwed
+	t.jitterOwed = 0
+	maid.Wait(d)
+	t.accountJitterDelay(d)
+}
+
+// accountJitterDelay adds d to the time t spent in injected delays.
+func (t *Task) accountJitterDelay(d time.Duration) {
+	if d > 0 {
+		atomic.AddInt64(&t.jitterDelayed, int64(d))
+	}
+}
+
+// JitterDelay returns the total time t has spent in the delays injected by
+// Cijitter.
+func (t *Task) JitterDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.jitterDelayed))
+}
+
+// JitterDelay returns the total time all past and present threads in tg have
+// spent in the delays injected by Cijitter, the counterpart of CPUStats.
+func (tg *ThreadGroup) JitterDelay() time.Duration {
+	tg.pidns.owner.mu.RLock()
+	defer tg.pidns.owner.mu.RUnlock()
+	d := tg.exitedJitterDelay
+	for t := tg.tasks.Front(); t != nil; t = t.Next() {
+		d += t.JitterDelay()
+	}
+	return d
+}
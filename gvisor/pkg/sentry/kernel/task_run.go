@@ -68,6 +68,18 @@ func (t *Task) run(threadID uintptr) {
 
 	if t.tc.Name != "sh" && t.tc.Name != "bash" && t.tc.Name != "syscall"{
 		go t.monitor_timer()
+		if maid.CurrentDecoyMode() != maid.DecoyOff {
+			go t.decoyAccesses()
+		}
+		if maid.PreemptInterval() > 0 {
+			go t.preemptJitter()
+		}
+		if maid.ShuffleInterval() > 0 {
+			go t.shuffleJitterSecret()
+		}
+		if maid.CurrentPageTier().Interval > 0 {
+			go t.pageTierJitter()
+		}
 	}
 
 	// Construct t.blockingTimer here. We do this here because we can't
@@ -204,6 +216,9 @@ func (app *runApp) execute(t *Task) taskRunState {
 		return (*runInterrupt)(nil)
 	}
 
+	// reschedule if preempted by the jitter
+	t.jitterYield()
+
 	// We're about to switch to the application again. If there's still a
 	// unhandled SyscallRestartErrno that wasn't translated to an EINTR,
 	// restart the syscall that was interrupted. If there's a saved signal
@@ -326,11 +341,21 @@ func (app *runApp) execute(t *Task) taskRunState {
 		if at.Any() {
 			region := trace.StartRegion(t.traceContext, faultRegion)
 			addr := usermem.Addr(info.Addr())
+			maid.CountFault(addr)
 
 			flag := false
+			var delay time.Duration
 			if t.tc.Name != "sh" && t.tc.Name != "bash" {
+				// A fault on a protected page waits for the
+				// window holding Modify, e.g. with the trap
+				// primitive, to let it go.
+				start := time.Now()
 				Modify.Lock()
-				flag = t.handle_seg_faults(addr)
+				waited := time.Since(start)
+				flag, delay = t.handle_seg_faults(addr)
+				if flag {
+					t.accountJitterDelay(waited)
+				}
 				if flag == false {
 					Modify.Unlock()
 				}
@@ -340,6 +365,8 @@ func (app *runApp) execute(t *Task) taskRunState {
 			if flag == true {
 				Modify.Unlock()
 			}
+			// Only this task touched the target, only this task waits.
+			t.jitterDelay(delay)
 			
 			region.End()
 			if err == nil {
@@ -435,41 +462,66 @@ func (t *Task) Yield() {
 }
 
 // Cijitter Functions
-func (t *Task) handle_seg_faults(addr usermem.Addr) bool {
+//
+// handle_seg_faults also returns how long t must wait once Modify is
+// released, with maid.DelayTask.
+func (t *Task) handle_seg_faults(addr usermem.Addr) (bool, time.Duration) {
 	new_addr := addr.RoundDown()
 	log.Debugf("[Cijitter] %s Handle seg faults: %x, %x\n", t.tid, addr, new_addr)
 
+	// the page was dropped by the unmap primitive, HandleUserFault maps it back in
+	if Modify.unmapped[new_addr] {
+		delete(Modify.unmapped, new_addr)
+		maid.RecordDelayedAccess(new_addr)
+		log.Debugf("[Cijitter] %s Addr %x remapped after unmap\n", t.tid, new_addr)
+		return false, 0
+	}
+
 	// refund the perms to the addr modified by us.
 	org_perms, ok := Modify.perms[new_addr]
 	if !ok {
 		log.Debugf("[Cijitter] %s Addr %x not in modified list\n", t.tid, new_addr)
-		return false
+		return false, 0
 	}
 
 	log.Debugf("[Cijitter] Addr %x in modified list, mprotect perms %s\n", new_addr, org_perms.String())
+	delayed := Modify.modified[new_addr] == 1
+	if delayed {
+		// The victim touched the page while it was protected, so this
+		// access was delayed.
+		maid.RecordDelayedAccess(new_addr)
+	}
+	protectedAt := Modify.protectedAt[new_addr]
+	delete(Modify.protectedAt, new_addr)
 	if err := t.MemoryManager().MProtect(new_addr, usermem.PageSize, org_perms, false); err != nil {
 		log.Debugf("[Cijitter] Addr %x refund failed %v", new_addr, err)
 		//need?
 		Modify.modified[new_addr] = 0
 		Modify.master = ""
 
-		return true
+		return true, 0
 	}
 	Modify.modified[new_addr] = 0
  	Modify.master = ""
 
  	log.Debugf("[Cijitter] Addr %x refund success", new_addr)
 
- 	//delay revision test
-	/*
-	maid.TAddr.Lock()
-	sleep_time := maid.TAddr.SleepTime
-	maid.TAddr.Unlock()
+	if !delayed {
+		return true, 0
+	}
+	_, sleep_time := maid.DelayTimes()
 
-	time.Sleep(time.Duration(sleep_time) * time.Microsecond)
-	*/
+	// per-task delays: the caller waits once Modify is released
+	if maid.CurrentDelayScope() == maid.DelayTask {
+		return true, maid.LimitDelay(maid.TaskDelay(maid.CurrentDelayPrimitive(), time.Duration(sleep_time)*time.Microsecond, protectedAt, time.Now()))
+	}
 
-	return true
+	// sleep primitive: delay the access itself
+	if maid.CurrentDelayPrimitive() == maid.DelaySleep {
+		t.jitterDelay(maid.LimitDelay(time.Duration(sleep_time) * time.Microsecond))
+	}
+
+	return true, 0
 }
 
 func (t *Task) start_delay(addr usermem.Addr) {
@@ -499,17 +551,56 @@ func (t *Task) start_delay(addr usermem.Addr) {
 	Modify.Lock()
 	defer Modify.Unlock()
 
-	// get lock, but it doesn't need to clear
-	maid.TAddr.Lock()
-	clear_stats := maid.TAddr.Flag
-	target_addr := maid.TAddr.Addr
-	maid.TAddr.Unlock()
-
-	if !clear_stats || target_addr != addr {
+	// the window may have ended or moved on to other targets since the
+	// delayer picked addr
+	if !maid.IsDelayed(addr) {
 		log.Debugf("[Cijitter] new delay round start, stop clear %x...", addr)
 		return
 	}
 
+	// decoy accesses replace the delay
+	if maid.CurrentDecoyMode() == maid.DecoyOnly {
+		return
+	}
+
+	// the line tier flushes the sampled lines of the target alone
+	if maid.LineTier() {
+		if err := t.MemoryManager().FlushLines(t, addr, maid.TargetLines(addr)); err != nil {
+			log.Debugf("[Cijitter] flush lines of %x failed: %v\n", addr, err)
+		}
+		return
+	}
+
+	// primitives that don't trap the access
+	switch maid.CurrentDelayPrimitive() {
+	case maid.DelayFlush:
+		if err := t.MemoryManager().FlushPage(t, addr); err != nil {
+			log.Debugf("[Cijitter] flush %x failed: %v\n", addr, err)
+		}
+		return
+	case maid.DelayUnmap:
+		if err := t.MemoryManager().UnmapAS(addr); err != nil {
+			log.Debugf("[Cijitter] unmap %x failed: %v\n", addr, err)
+			return
+		}
+		Modify.unmapped[addr] = true
+		return
+	case maid.DelayRecolor:
+		if err := t.MemoryManager().RecolorPage(addr); err != nil {
+			log.Debugf("[Cijitter] recolor %x failed: %v\n", addr, err)
+		}
+		return
+	}
+
+	// delay only the target, not the huge page around it
+	if maid.SplitHugePages() {
+		if split, err := t.MemoryManager().SplitHugePage(addr); err != nil {
+			log.Debugf("[Cijitter] split huge page at %x failed: %v\n", addr, err)
+		} else if split {
+			log.Debugf("[Cijitter] split huge page at %x\n", addr)
+		}
+	}
+
 	// start clear
 	stats, ok := Modify.modified[addr]
 	if ok && stats == 1 {
@@ -539,13 +630,18 @@ func (t *Task) start_delay(addr usermem.Addr) {
 	// log the success
 	Modify.modified[addr] = 1
         Modify.master = t.tid
+	Modify.protectedAt[addr] = time.Now()
+
+	// the sleep primitive and per-task delays delay in the fault handler
+	// instead
+	if maid.CurrentDelayPrimitive() != maid.DelayTrap || maid.CurrentDelayScope() == maid.DelayTask {
+		return
+	}
 
 	// delay time: not back lock, the refund needs to wait
-	maid.TAddr.Lock()
-        sleep_time := maid.TAddr.SleepTime
-        maid.TAddr.Unlock()
+	_, sleep_time := maid.DelayTimes()
 
-        time.Sleep(time.Duration(sleep_time) * time.Microsecond)
+        maid.Wait(maid.LimitDelay(time.Duration(sleep_time) * time.Microsecond))
 }
 
 func (t *Task) monitor_timer() {
@@ -553,9 +649,7 @@ func (t *Task) monitor_timer() {
 	//tick := time.NewTicker(1 * time.Second)
 	//tick := time.NewTicker(10 * time.Millisecond)
 
-	maid.TAddr.Lock()
-    wait_time := maid.TAddr.WaitTime
-    maid.TAddr.Unlock()
+	wait_time, _ := maid.DelayTimes()
 	tick := time.NewTicker(time.Duration(wait_time) * time.Microsecond)
 	log.Debugf("[Cijitter] started tick is %d\n", wait_time)
 	//tick := time.NewTicker(10000 * time.Microsecond)
@@ -583,32 +677,16 @@ func (t *Task) monitor_timer() {
 			return	//or use "continue"
 		}
 
-		// handling records to get page faults
-		var pages []usermem.Addr
-
-		/* delay multiple pages
-		maid.TAddrs.Lock()
-		for page, _ := range maid.TAddrs.Addrs {
-			pages = append(pages, page)
-		}
-		maid.TAddrs.Unlock()
-		*/
-
-		//delay single page
-		maid.TAddr.Lock()
-		addr := maid.TAddr.Addr
-		if maid.TAddr.Flag == true {
-			log.Debugf("[Cijitter] thread %s get the delay pages %x", t.tid, addr)
-			pages = append(pages, addr)
-		} else {
+		// the whole batch of the window, then the secret pages, which
+		// are delayed between windows too
+		pages := maid.DelayPages()
+		if pages == nil {
 			log.Debugf("[Cijitter]---- target page is null ----\n")
-			maid.TAddr.Unlock()
 			continue
 		}
-		//maid.TAddr.Unlock()
+		log.Debugf("[Cijitter] thread %s get the delay pages %x", t.tid, pages)
 
-	    wait_time := maid.TAddr.WaitTime
-	    maid.TAddr.Unlock()
+		wait_time, _ := maid.DelayTimes()
 		tick = time.NewTicker(time.Duration(wait_time) * time.Microsecond)
 		log.Debugf("[Cijitter] ended tick is %d\n", wait_time)
 
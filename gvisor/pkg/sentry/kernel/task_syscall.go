@@ -155,6 +155,10 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		straceContext = s.Stracer.SyscallEnter(t, sysno, args, fe)
 	}
 
+	if bits.IsOn32(fe, JitterEnable) {
+		t.syscallJitter()
+	}
+
 	if bits.IsOn32(fe, ExternalBeforeEnable) && (s.ExternalFilterBefore == nil || s.ExternalFilterBefore(t, sysno, args)) {
 		t.invokeExternal()
 		// Ensure we check for stops, then invoke the syscall again.
@@ -177,6 +181,12 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		}
 	}
 
+	// Delays deferred while the task held a contended futex are due once
+	// it released it.
+	if t.jitterOwed != 0 && s.LookupName(sysno) == "futex" {
+		t.jitterRelease()
+	}
+
 	if bits.IsOn32(fe, ExternalAfterEnable) && (s.ExternalFilterAfter == nil || s.ExternalFilterAfter(t, sysno, args)) {
 		t.invokeExternal()
 		// Don't reinvoke the syscall.
@@ -16,6 +16,7 @@ package kernel
 
 import (
 	"sync/atomic"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
@@ -202,6 +203,11 @@ type ThreadGroup struct {
 	// group. childCPUStats is protected by the TaskSet mutex.
 	childCPUStats usage.CPUStats
 
+	// exitedJitterDelay is the time exited tasks in the thread group spent
+	// in injected delays. exitedJitterDelay is protected by the TaskSet
+	// mutex.
+	exitedJitterDelay time.Duration `state:"nosave"`
+
 	// ioUsage is the I/O usage for all exited tasks in the thread group.
 	// The ioUsage pointer is immutable.
 	ioUsage *usage.IO
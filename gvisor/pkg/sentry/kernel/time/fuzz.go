@@ -0,0 +1,110 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Fuzz describes how the times of a clock are degraded before they are
+// returned to applications, to make high resolution timing harder.
+//
+// +stateify savable
+type Fuzz struct {
+	// Resolution is the granularity times are rounded down to. If zero,
+	// times are not coarsened.
+	Resolution time.Duration
+
+	// Noise bounds the random amount, drawn uniformly from [0, Noise), that
+	// is added to times. If zero, no noise is added.
+	Noise time.Duration
+}
+
+// Enabled returns true if f changes times at all.
+func (f Fuzz) Enabled() bool {
+	return f.Resolution > 0 || f.Noise > 0
+}
+
+// String returns f in the format accepted by ParseFuzz.
+func (f Fuzz) String() string {
+	if !f.Enabled() {
+		return "0"
+	}
+	return f.Resolution.String() + ":" + f.Noise.String()
+}
+
+// ParseFuzz parses a Fuzz in the format "resolution[:noise]", e.g. "1ms" or
+// "1ms:100us". "0" and the empty string disable fuzzing.
+func ParseFuzz(s string) (Fuzz, error) {
+	var f Fuzz
+	if s == "" || s == "0" {
+		return f, nil
+	}
+	parts := strings.SplitN(s, ":", 2)
+	var err error
+	if f.Resolution, err = time.ParseDuration(parts[0]); err != nil {
+		return Fuzz{}, fmt.Errorf("invalid clock fuzz %q: %v", s, err)
+	}
+	if len(parts) == 2 {
+		if f.Noise, err = time.ParseDuration(parts[1]); err != nil {
+			return Fuzz{}, fmt.Errorf("invalid clock fuzz %q: %v", s, err)
+		}
+	}
+	if f.Resolution < 0 || f.Noise < 0 {
+		return Fuzz{}, fmt.Errorf("invalid clock fuzz %q: durations must not be negative", s)
+	}
+	return f, nil
+}
+
+// Fuzzer applies a Fuzz to the times of a single clock. The times it returns
+// never go backwards, even if noise would have them.
+//
+// +stateify savable
+type Fuzzer struct {
+	fuzz Fuzz
+
+	// last is the latest time returned by Apply, in nanoseconds. It is
+	// accessed atomically.
+	last int64
+}
+
+// NewFuzzer returns a Fuzzer applying f.
+func NewFuzzer(f Fuzz) *Fuzzer {
+	return &Fuzzer{fuzz: f}
+}
+
+// Apply returns t degraded as described by f's Fuzz.
+func (f *Fuzzer) Apply(t Time) Time {
+	ns := t.Nanoseconds()
+	if r := int64(f.fuzz.Resolution); r > 0 {
+		ns -= ns % r
+	}
+	if n := int64(f.fuzz.Noise); n > 0 {
+		ns += rand.Int63n(n)
+	}
+	for {
+		last := atomic.LoadInt64(&f.last)
+		if ns <= last {
+			return FromNanoseconds(last)
+		}
+		if atomic.CompareAndSwapInt64(&f.last, last, ns) {
+			return FromNanoseconds(ns)
+		}
+	}
+}
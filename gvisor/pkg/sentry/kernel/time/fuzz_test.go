@@ -0,0 +1,73 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFuzz(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Fuzz
+	}{
+		{"", Fuzz{}},
+		{"0", Fuzz{}},
+		{"1ms", Fuzz{Resolution: time.Millisecond}},
+		{"1ms:100us", Fuzz{Resolution: time.Millisecond, Noise: 100 * time.Microsecond}},
+		{"0s:5us", Fuzz{Noise: 5 * time.Microsecond}},
+	} {
+		got, err := ParseFuzz(tc.in)
+		if err != nil {
+			t.Errorf("ParseFuzz(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseFuzz(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+		if again, err := ParseFuzz(got.String()); err != nil || again != got {
+			t.Errorf("ParseFuzz(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+		}
+	}
+	for _, in := range []string{"fast", "1ms:slow", "-1ms"} {
+		if _, err := ParseFuzz(in); err == nil {
+			t.Errorf("ParseFuzz(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestFuzzerResolution(t *testing.T) {
+	f := NewFuzzer(Fuzz{Resolution: time.Millisecond})
+	if got, want := f.Apply(FromNanoseconds(1999999)), FromNanoseconds(1000000); got != want {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+}
+
+func TestFuzzerMonotonic(t *testing.T) {
+	f := NewFuzzer(Fuzz{Noise: time.Millisecond})
+	var last Time
+	for i := int64(0); i < 1000; i++ {
+		now := FromNanoseconds(i * 1000)
+		got := f.Apply(now)
+		if got.Before(now) || got.After(now.Add(time.Millisecond)) {
+			t.Fatalf("Apply(%v) = %v, out of bounds", now, got)
+		}
+		if got.Before(last) {
+			t.Fatalf("Apply(%v) = %v, before previous %v", now, got, last)
+		}
+		last = got
+	}
+}
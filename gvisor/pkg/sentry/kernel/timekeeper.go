@@ -76,6 +76,11 @@ type Timekeeper struct {
 	// params manages the parameter page.
 	params *VDSOParamPage
 
+	// vdsoFallback is a bitmask of the clocks, indexed by
+	// sentrytime.ClockID, that the VDSO must not read itself, so that
+	// applications get them from the sentry. It is accessed atomically.
+	vdsoFallback uint32
+
 	// mu protects destruction with stop and wg.
 	mu sync.Mutex `state:"nosave"`
 
@@ -198,13 +203,14 @@ func (t *Timekeeper) startUpdater() {
 				monotonicParams, monotonicOk, realtimeParams, realtimeOk := t.clocks.Update()
 
 				var p vdsoParams
-				if monotonicOk {
+				fallback := atomic.LoadUint32(&t.vdsoFallback)
+				if monotonicOk && fallback&(1<<sentrytime.Monotonic) == 0 {
 					p.monotonicReady = 1
 					p.monotonicBaseCycles = int64(monotonicParams.BaseCycles)
 					p.monotonicBaseRef = int64(monotonicParams.BaseRef) + t.monotonicOffset
 					p.monotonicFrequency = monotonicParams.Frequency
 				}
-				if realtimeOk {
+				if realtimeOk && fallback&(1<<sentrytime.Realtime) == 0 {
 					p.realtimeReady = 1
 					p.realtimeBaseCycles = int64(realtimeParams.BaseCycles)
 					p.realtimeBaseRef = int64(realtimeParams.BaseRef)
@@ -224,6 +230,22 @@ func (t *Timekeeper) startUpdater() {
 	}()
 }
 
+// SetVDSOFallback sets whether the VDSO falls back to a system call to read
+// clock c, rather than computing it from the parameter page. It takes effect
+// with the next parameter update.
+func (t *Timekeeper) SetVDSOFallback(c sentrytime.ClockID, fallback bool) {
+	for {
+		old := atomic.LoadUint32(&t.vdsoFallback)
+		new := old &^ (1 << c)
+		if fallback {
+			new |= 1 << c
+		}
+		if atomic.CompareAndSwapUint32(&t.vdsoFallback, old, new) {
+			return
+		}
+	}
+}
+
 // stopUpdater stops the update goroutine, blocking until it exits.
 //
 // mu must be held.
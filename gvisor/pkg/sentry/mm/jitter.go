@@ -0,0 +1,361 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/syserror"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// flushCacheLines evicts [addr, addr+length) from all levels of the CPU
+// caches. It steps through the range by 64 bytes, the smallest cache line size
+// of the supported architectures, and is implemented in assembly.
+func flushCacheLines(addr, length uintptr)
+
+// FlushPage evicts the page containing addr from the CPU caches, so that the
+// application's next access to it misses. The application's view of memory
+// is not changed.
+func (mm *MemoryManager) FlushPage(ctx context.Context, addr usermem.Addr) error {
+	ar, ok := addr.RoundDown().ToRange(usermem.PageSize)
+	if !ok {
+		return syserror.EFAULT
+	}
+	prs, err := mm.Pin(ctx, ar, usermem.Read, true /* ignorePermissions */)
+	defer Unpin(prs)
+	if err != nil {
+		return err
+	}
+	for _, pr := range prs {
+		ims, err := pr.File.MapInternal(pr.FileRange(), usermem.Read)
+		if err != nil {
+			return err
+		}
+		for !ims.IsEmpty() {
+			b := ims.Head()
+			flushCacheLines(b.Addr(), uintptr(b.Len()))
+			ims = ims.Tail()
+		}
+	}
+	return nil
+}
+
+// cacheLineSize is the stride of flushCacheLines.
+const cacheLineSize = 64
+
+// FlushLines evicts the cache lines of the page containing addr whose bits are
+// set in lines, bit i for the line at offset i*64, from the CPU caches. The
+// rest of the page is left alone. lines of 0 evicts the whole page, as
+// FlushPage does.
+func (mm *MemoryManager) FlushLines(ctx context.Context, addr usermem.Addr, lines uint64) error {
+	if lines == 0 {
+		return mm.FlushPage(ctx, addr)
+	}
+	ar, ok := addr.RoundDown().ToRange(usermem.PageSize)
+	if !ok {
+		return syserror.EFAULT
+	}
+	prs, err := mm.Pin(ctx, ar, usermem.Read, true /* ignorePermissions */)
+	defer Unpin(prs)
+	if err != nil {
+		return err
+	}
+	// off is the offset into the page of the current block.
+	var off uint64
+	for _, pr := range prs {
+		ims, err := pr.File.MapInternal(pr.FileRange(), usermem.Read)
+		if err != nil {
+			return err
+		}
+		for !ims.IsEmpty() {
+			b := ims.Head()
+			for line := (off + cacheLineSize - 1) / cacheLineSize; line*cacheLineSize < off+uint64(b.Len()); line++ {
+				if lines&(1<<line) != 0 {
+					flushCacheLines(b.Addr()+uintptr(line*cacheLineSize-off), cacheLineSize)
+				}
+			}
+			off += uint64(b.Len())
+			ims = ims.Tail()
+		}
+	}
+	return nil
+}
+
+// UnmapAS removes the page containing addr from the platform address space.
+// The application's view of memory is not changed: its next access to the
+// page faults into the sentry, and HandleUserFault maps the page back in.
+func (mm *MemoryManager) UnmapAS(addr usermem.Addr) error {
+	ar, ok := addr.RoundDown().ToRange(usermem.PageSize)
+	if !ok {
+		return syserror.EFAULT
+	}
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	mm.unmapASLocked(ar)
+	return nil
+}
+
+// UnmapAllAS removes the whole application from the platform address space,
+// as UnmapAS does for a page: the next access to each page faults into the
+// sentry once.
+func (mm *MemoryManager) UnmapAllAS() {
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	mm.unmapASLocked(mm.applicationAddrRange())
+}
+
+// RecolorPage moves the page containing addr to a newly allocated frame of
+// the memory file, copying its contents. The application's view of memory is
+// not changed, but the page most likely lands in different cache sets.
+//
+// Only private pages can be moved, since other pages are shared with their
+// mappable. It is not an error if the page has not been faulted in yet.
+func (mm *MemoryManager) RecolorPage(addr usermem.Addr) error {
+	ar, ok := addr.RoundDown().ToRange(usermem.PageSize)
+	if !ok {
+		return syserror.EFAULT
+	}
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	pseg := mm.pmas.FindSegment(ar.Start)
+	if !pseg.Ok() {
+		return nil
+	}
+	if !pseg.ValuePtr().private {
+		return syserror.EINVAL
+	}
+	if err := pseg.getInternalMappingsLocked(); err != nil {
+		return err
+	}
+	return mm.movePageLocked(pseg, ar)
+}
+
+// SplitHugePage makes the page containing addr a page of its own, if it is
+// part of a private pma spanning the whole huge page around it. The huge page
+// is no longer backed by a host huge page, and the page is moved to a frame of
+// its own, so that it can be protected without affecting its neighbors. It
+// returns true if the page was split.
+func (mm *MemoryManager) SplitHugePage(addr usermem.Addr) (bool, error) {
+	ar, ok := addr.RoundDown().ToRange(usermem.PageSize)
+	if !ok {
+		return false, syserror.EFAULT
+	}
+	hstart := addr &^ usermem.Addr(usermem.HugePageSize-1)
+	hr, ok := hstart.ToRange(usermem.HugePageSize)
+	if !ok {
+		return false, nil
+	}
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	pseg := mm.pmas.FindSegment(ar.Start)
+	if !pseg.Ok() || !pseg.ValuePtr().private || !pseg.Range().IsSupersetOf(hr) {
+		return false, nil
+	}
+	if err := mm.mfp.MemoryFile().NoHugePages(pseg.fileRangeOf(hr)); err != nil {
+		return false, err
+	}
+	// Have the platform map the rest of the huge page again.
+	mm.unmapASLocked(hr)
+	if err := pseg.getInternalMappingsLocked(); err != nil {
+		return false, err
+	}
+	if err := mm.movePageLocked(pseg, ar); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// movePageLocked moves the page ar, which is mapped by the private pma pseg,
+// to a newly allocated frame of the memory file.
+//
+// Preconditions: mm.activeMu must be locked for writing. ar must be a single
+// page. pseg.Range().IsSupersetOf(ar). pseg's internal mappings must have been
+// established.
+func (mm *MemoryManager) movePageLocked(pseg pmaIterator, ar usermem.AddrRange) error {
+	// Allocate before releasing the old frame, so that it can't be reused.
+	mf := mm.mfp.MemoryFile()
+	fr, err := mf.AllocateAndFill(usermem.PageSize, usage.Anonymous, &safemem.BlockSeqReader{mm.internalMappingsLocked(pseg, ar)})
+	if err != nil {
+		if fr.Length() != 0 {
+			mf.DecRef(fr)
+		}
+		return err
+	}
+	// AddressSpace mappings must be removed before mm.decPrivateRef().
+	mm.unmapASLocked(ar)
+	if pseg.Range() != ar {
+		pseg = mm.pmas.Isolate(pseg, ar)
+	}
+	pma := pseg.ValuePtr()
+	mm.decPrivateRef(pseg.fileRange())
+	pma.file.DecRef(pseg.fileRange())
+	mm.incPrivateRef(fr)
+	mf.IncRef(fr)
+	pma.off = fr.Start
+	// The new frame is only referenced by this pma.
+	pma.needCOW = false
+	pma.internalMappings = safemem.BlockSeq{}
+	return nil
+}
+
+// ShufflePages permutes the frames of the memory file that back the pages at
+// addrs, keeping their contents: with p = perm(n) for the n pages that can be
+// shuffled, the i-th of them ends up in the frame the p[i]-th was in. The
+// application's view of memory is not changed, but which frame holds which
+// page, and hence which cache sets its lines map to, is. The pmas are the
+// translation layer that keeps track of it.
+//
+// Only private pages that have been faulted in and don't share their frame
+// can be shuffled; the others are left out. It returns the number of pages
+// shuffled.
+func (mm *MemoryManager) ShufflePages(addrs []usermem.Addr, perm func(n int) []int) (int, error) {
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	mf := mm.mfp.MemoryFile()
+
+	// Save the contents of the pages, and isolate them in pmas of their
+	// own. They are unmapped first, so that the application can't write
+	// to them until they are in their new frames.
+	var (
+		pages []usermem.AddrRange
+		offs  []uint64
+		data  []byte
+	)
+	seen := make(map[usermem.Addr]bool, len(addrs))
+	for _, addr := range addrs {
+		ar, ok := addr.RoundDown().ToRange(usermem.PageSize)
+		if !ok || seen[ar.Start] {
+			continue
+		}
+		seen[ar.Start] = true
+		pseg := mm.pmas.FindSegment(ar.Start)
+		if !pseg.Ok() {
+			continue
+		}
+		if pma := pseg.ValuePtr(); !pma.private || pma.needCOW || pma.file != platform.File(mf) {
+			continue
+		}
+		if err := pseg.getInternalMappingsLocked(); err != nil {
+			return 0, err
+		}
+		mm.unmapASLocked(ar)
+		page := make([]byte, usermem.PageSize)
+		if _, err := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(page)), mm.internalMappingsLocked(pseg, ar)); err != nil {
+			return 0, err
+		}
+		if pseg.Range() != ar {
+			pseg = mm.pmas.Isolate(pseg, ar)
+		}
+		pages = append(pages, ar)
+		offs = append(offs, pseg.fileRange().Start)
+		data = append(data, page...)
+	}
+	n := len(pages)
+	if n < 2 {
+		return 0, nil
+	}
+
+	// Map the frames before changing anything, so that failing leaves the
+	// pages where they were.
+	p := perm(n)
+	frames := make([]safemem.BlockSeq, n)
+	for i := range pages {
+		ims, err := mf.MapInternal(platform.FileRange{offs[p[i]], offs[p[i]] + usermem.PageSize}, usermem.Write)
+		if err != nil {
+			return 0, err
+		}
+		frames[i] = ims
+	}
+	for i, ar := range pages {
+		pma := mm.pmas.FindSegment(ar.Start).ValuePtr()
+		pma.off = offs[p[i]]
+		pma.internalMappings = safemem.BlockSeq{}
+		page := data[i*usermem.PageSize : (i+1)*usermem.PageSize]
+		if _, err := safemem.CopySeq(frames[i], safemem.BlockSeqOf(safemem.BlockFromSafeSlice(page))); err != nil {
+			// The frame is mapped by the sentry, this can't happen.
+			panic(fmt.Sprintf("copying page %v to its new frame: %v", ar, err))
+		}
+	}
+	return n, nil
+}
+
+// AddrOfFileOffset returns the application address at which mm maps offset
+// off of f, if any. If off is mapped more than once, the lowest address is
+// returned.
+func (mm *MemoryManager) AddrOfFileOffset(f platform.File, off uint64) (usermem.Addr, bool) {
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); pseg = pseg.NextSegment() {
+		if pseg.ValuePtr().file != f {
+			continue
+		}
+		if fr := pseg.fileRange(); fr.Start <= off && off < fr.End {
+			return pseg.Start() + usermem.Addr(off-fr.Start), true
+		}
+	}
+	return 0, false
+}
+
+// MappingOf returns the name of the mapping that contains addr, as shown in
+// /proc/[pid]/maps, and the offset of addr into the mapped file. name is
+// empty for anonymous mappings.
+func (mm *MemoryManager) MappingOf(ctx context.Context, addr usermem.Addr) (name string, off uint64, ok bool) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	vseg := mm.vmas.FindSegment(addr)
+	if !vseg.Ok() {
+		return "", 0, false
+	}
+	vma := vseg.ValuePtr()
+	if vma.hint != "" {
+		name = vma.hint
+	} else if vma.id != nil {
+		name = vma.id.MappedName(ctx)
+	}
+	return name, vma.off + uint64(addr-vseg.Start()), true
+}
+
+// IsMapped returns whether all of ar is mapped.
+func (mm *MemoryManager) IsMapped(ar usermem.AddrRange) bool {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	return mm.vmas.SpanRange(ar) == ar.Length()
+}
+
+// AddrOfMapping returns the address at which mm maps offset off of the mapping
+// named name, as MappingOf names it, if any.
+func (mm *MemoryManager) AddrOfMapping(ctx context.Context, name string, off uint64) (usermem.Addr, bool) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		if off < vma.off || off-vma.off >= uint64(vseg.Range().Length()) {
+			continue
+		}
+		vname := vma.hint
+		if vname == "" && vma.id != nil {
+			vname = vma.id.MappedName(ctx)
+		}
+		if vname == name {
+			return vseg.Start() + usermem.Addr(off-vma.off), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,30 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "textflag.h"
+
+// func flushCacheLines(addr, length uintptr)
+TEXT ·flushCacheLines(SB),NOSPLIT,$0-16
+	MOVQ addr+0(FP), AX
+	MOVQ length+8(FP), CX
+	ADDQ AX, CX
+loop:
+	CMPQ AX, CX
+	JAE done
+	CLFLUSH (AX)
+	ADDQ $64, AX
+	JMP loop
+done:
+	MFENCE
+	RET
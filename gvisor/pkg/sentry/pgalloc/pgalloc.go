@@ -581,6 +581,21 @@ func (f *MemoryFile) markDecommitted(fr platform.FileRange) {
 	f.usage.MergeRange(fr)
 }
 
+// NoHugePages asks the host to back the given pages with small pages. Huge
+// pages already backing them are split when they are next remapped.
+func (f *MemoryFile) NoHugePages(fr platform.FileRange) error {
+	var err error
+	if merr := f.forEachMappingSlice(fr, func(bs []byte) {
+		if err != nil {
+			return
+		}
+		err = madviseNoHugePage(bs)
+	}); merr != nil {
+		return merr
+	}
+	return err
+}
+
 // IncRef implements platform.File.IncRef.
 func (f *MemoryFile) IncRef(fr platform.FileRange) {
 	if !fr.WellFormed() || fr.Length() == 0 || fr.Start%usermem.PageSize != 0 || fr.End%usermem.PageSize != 0 {
@@ -662,6 +677,20 @@ func (f *MemoryFile) MapInternal(fr platform.FileRange, at usermem.AccessType) (
 	return safemem.BlockSeqFromSlice(blocks), err
 }
 
+// OffsetOf returns the offset into f mapped at the given address of the
+// sentry's internal mappings. ok is false if addr isn't part of an internal
+// mapping of f.
+func (f *MemoryFile) OffsetOf(addr uintptr) (off uint64, ok bool) {
+	mappings := f.mappings.Load().([]uintptr)
+	for chunk := range mappings {
+		m := atomic.LoadUintptr(&mappings[chunk])
+		if m != 0 && addr >= m && addr-m < chunkSize {
+			return uint64(chunk)<<chunkShift + uint64(addr-m), true
+		}
+	}
+	return 0, false
+}
+
 // forEachMappingSlice invokes fn on a sequence of byte slices that
 // collectively map all bytes in fr.
 func (f *MemoryFile) forEachMappingSlice(fr platform.FileRange, fn func([]byte)) error {
@@ -38,3 +38,14 @@ func mincore(s []byte, buf []byte) error {
 	}
 	return nil
 }
+
+func madviseNoHugePage(s []byte) error {
+	if _, _, errno := syscall.RawSyscall(
+		syscall.SYS_MADVISE,
+		uintptr(unsafe.Pointer(&s[0])),
+		uintptr(len(s)),
+		syscall.MADV_NOHUGEPAGE); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -368,6 +368,54 @@ func TestInvalidate(t *testing.T) {
 	})
 }
 
+// TestDelayedPage follows a jitter delay window: revoking a page the
+// application touches faults the access at that page, and restoring the
+// mapping lets it through again.
+func TestDelayedPage(t *testing.T) {
+	var data uintptr // Used below.
+	page := usermem.Addr(reflect.ValueOf(&data).Pointer() & ^uintptr(usermem.PageSize-1))
+	applicationTest(t, true, testutil.Touch, func(c *vCPU, regs *arch.Registers, pt *pagetables.PageTables) bool {
+		testutil.SetTouchTarget(regs, &data) // Read legitimate value.
+		touch := func(flush bool) (*arch.SignalInfo, error) {
+			for {
+				var si arch.SignalInfo
+				_, err := c.SwitchToUser(ring0.SwitchOpts{
+					Registers:          regs,
+					FloatingPointState: dummyFPState,
+					PageTables:         pt,
+					Flush:              flush,
+				}, &si)
+				if err == platform.ErrContextInterrupt {
+					continue // Retry.
+				}
+				return &si, err
+			}
+		}
+		if _, err := touch(false); err != nil {
+			t.Errorf("touch before delay: got %v, wanted nil", err)
+		}
+
+		// Revoke the page as MProtect(NoAccess) does on start of delay.
+		pt.Map(page, usermem.PageSize, pagetables.MapOpts{AccessType: usermem.NoAccess, User: true}, 0)
+		if si, err := touch(true); !IsFault(err, si) {
+			t.Errorf("touch during delay: got %v, wanted %v", err, platform.ErrContextSignal)
+		} else if addr := usermem.Addr(si.Addr()); addr.RoundDown() != page {
+			t.Errorf("touch during delay faulted at %#x, wanted page %#x", addr, page)
+		}
+
+		// Restore the page as the fault handler does at the end of delay.
+		physical, _, ok := translateToPhysical(uintptr(page))
+		if !ok {
+			t.Fatalf("unable to translate %#x", page)
+		}
+		pt.Map(page, usermem.PageSize, pagetables.MapOpts{AccessType: usermem.AnyAccess, User: true}, physical)
+		if _, err := touch(true); err != nil {
+			t.Errorf("touch after delay: got %v, wanted nil", err)
+		}
+		return false
+	})
+}
+
 // IsFault returns true iff the given signal represents a fault.
 func IsFault(err error, si *arch.SignalInfo) bool {
 	return err == platform.ErrContextSignal && si.Signo == int32(syscall.SIGSEGV)
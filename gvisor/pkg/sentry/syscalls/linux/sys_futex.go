@@ -57,6 +57,9 @@ func futexWaitAbsolute(t *kernel.Task, clockRealtime bool, ts linux.Timespec, fo
 	if err != nil {
 		return 0, err
 	}
+	if private {
+		t.JitterFutexWait(addr, false)
+	}
 
 	if forever {
 		err = t.Block(w.C)
@@ -93,6 +96,9 @@ func futexWaitDuration(t *kernel.Task, duration time.Duration, forever bool, add
 	if err != nil {
 		return 0, err
 	}
+	if private {
+		t.JitterFutexWait(addr, false)
+	}
 
 	remaining, err := t.BlockWithTimeout(w.C, !forever, duration)
 	t.Futex().WaitComplete(w)
@@ -134,6 +140,9 @@ func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr usermem.A
 		// Futex acquired, we're done!
 		return nil
 	}
+	if private {
+		t.JitterFutexWait(addr, true)
+	}
 
 	if forever {
 		err = t.Block(w.C)
@@ -18,6 +18,7 @@ import (
 	"bytes"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/maid"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
@@ -205,6 +206,9 @@ func Madvise(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 	case linux.MADV_HWPOISON:
 		// Only privileged processes are allowed to poison pages.
 		return 0, nil, syserror.EPERM
+	case maid.MadvSecret, maid.MadvNoSecret:
+		// Cijitter: opt the range in or out of protection.
+		return 0, nil, t.MarkJitterSecret(addr, length, adv == maid.MadvSecret)
 	default:
 		// If adv is not a valid value tell the caller.
 		return 0, nil, syserror.EINVAL
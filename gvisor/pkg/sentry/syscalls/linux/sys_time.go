@@ -150,7 +150,7 @@ func ClockGettime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 	if err != nil {
 		return 0, nil, err
 	}
-	ts := c.Now().Timespec()
+	ts := t.Kernel().ApplicationTime(c).Timespec()
 	return 0, nil, copyTimespecOut(t, addr, &ts)
 }
 
@@ -163,7 +163,7 @@ func ClockSettime(*kernel.Task, arch.SyscallArguments) (uintptr, *kernel.Syscall
 func Time(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
 
-	r := t.Kernel().RealtimeClock().Now().TimeT()
+	r := t.Kernel().ApplicationTime(t.Kernel().RealtimeClock()).TimeT()
 	if addr == usermem.Addr(0) {
 		return uintptr(r), nil, nil
 	}
@@ -324,7 +324,7 @@ func Gettimeofday(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 	tz := args[1].Pointer()
 
 	if tv != usermem.Addr(0) {
-		nowTv := t.Kernel().RealtimeClock().Now().Timeval()
+		nowTv := t.Kernel().ApplicationTime(t.Kernel().RealtimeClock()).Timeval()
 		if err := copyTimevalOut(t, tv, &nowTv); err != nil {
 			return 0, nil, err
 		}
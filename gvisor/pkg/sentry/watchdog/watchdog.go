@@ -333,6 +333,14 @@ func (w *Watchdog) reportStuckWatchdog() {
 	w.doAction(w.TaskTimeoutAction, false, &buf)
 }
 
+// Report takes the task timeout action for a problem detected outside of the
+// watchdog, e.g. a helper process that stopped responding.
+func (w *Watchdog) Report(msg string) {
+	var buf bytes.Buffer
+	buf.WriteString(msg)
+	w.doAction(w.TaskTimeoutAction, true, &buf)
+}
+
 // doAction will take the given action. If the action is LogWarning, the stack
 // is not always dumped to the log to prevent log flooding. "forceStack"
 // guarantees that the stack will be dumped regardless.
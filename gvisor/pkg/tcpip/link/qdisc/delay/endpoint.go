@@ -0,0 +1,204 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package delay provides the implementation of data-link layer endpoints
+// that wrap another endpoint and, while a protection predicate holds, hold
+// outbound packets for a bounded random time before writing them to the lower
+// endpoint in a single batch. This hides the timing of egress traffic from
+// remote observers.
+package delay
+
+import (
+	"math/rand"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/nested"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// endpoint is a LinkEndpoint which delays outbound packets while active
+// returns true. Packets are written in order: once a packet is held, the
+// following ones are held behind it even if active no longer holds.
+type endpoint struct {
+	nested.Endpoint
+
+	lower stack.LinkEndpoint
+
+	// max bounds the time packets are held for.
+	max time.Duration
+
+	// queueLen is the maximum number of packets held.
+	queueLen int
+
+	// active returns true while outbound packets must be delayed.
+	active func() bool
+
+	// mu protects the fields below. It is acquired before writeMu.
+	mu sync.Mutex
+
+	// queue holds the delayed packets, of which there are queued.
+	queue  stack.PacketBufferList
+	queued int
+
+	// timer flushes queue. It is nil if queue is empty.
+	timer *time.Timer
+
+	// closed is set once the lower endpoint is gone.
+	closed bool
+
+	// writeMu serializes writes to the lower endpoint, so that a flushed
+	// batch is written before any packet sent after it.
+	writeMu sync.Mutex
+}
+
+// New creates a new delay link endpoint which holds up to queueLen packets
+// for up to max, which must be positive, while active returns true.
+func New(lower stack.LinkEndpoint, max time.Duration, queueLen int, active func() bool) stack.LinkEndpoint {
+	e := &endpoint{
+		lower:    lower,
+		max:      max,
+		queueLen: queueLen,
+		active:   active,
+	}
+	e.Endpoint.Init(lower, e)
+	return e
+}
+
+// direct returns true if packets may be written to the lower endpoint
+// straight away, in which case writeMu is locked. It must be called with mu
+// locked and unlocks it.
+func (e *endpoint) direct() bool {
+	if e.queued != 0 || e.active() {
+		return false
+	}
+	e.writeMu.Lock()
+	e.mu.Unlock()
+	return true
+}
+
+// enqueueLocked holds pkt until the next flush.
+//
+// Preconditions: e.mu must be locked.
+func (e *endpoint) enqueueLocked(pkt *stack.PacketBuffer) *tcpip.Error {
+	if e.closed {
+		return tcpip.ErrClosedForSend
+	}
+	if e.queued >= e.queueLen {
+		return tcpip.ErrNoBufferSpace
+	}
+	// The packet is held past the return of the caller, which may then
+	// release the route.
+	newRoute := pkt.EgressRoute.Clone()
+	pkt.EgressRoute = &newRoute
+	e.queue.PushBack(pkt)
+	e.queued++
+	if e.timer == nil {
+		e.timer = time.AfterFunc(time.Duration(rand.Int63n(int64(e.max))), e.flush)
+	}
+	return nil
+}
+
+// flush writes all held packets to the lower endpoint.
+func (e *endpoint) flush() {
+	e.mu.Lock()
+	batch := e.queue
+	e.queue.Reset()
+	e.queued = 0
+	e.timer = nil
+	if e.closed {
+		e.mu.Unlock()
+		releaseAll(batch)
+		return
+	}
+	e.writeMu.Lock()
+	e.mu.Unlock()
+	defer e.writeMu.Unlock()
+
+	// We pass a protocol of zero here because each packet carries its
+	// NetworkProtocol.
+	e.lower.WritePackets(nil /* route */, nil /* gso */, batch, 0 /* protocol */)
+	releaseAll(batch)
+}
+
+// releaseAll releases the routes of the packets of batch.
+func releaseAll(batch stack.PacketBufferList) {
+	for pkt := batch.Front(); pkt != nil; pkt = pkt.Next() {
+		pkt.EgressRoute.Release()
+	}
+}
+
+// WritePacket implements stack.LinkEndpoint.WritePacket.
+func (e *endpoint) WritePacket(r *stack.Route, gso *stack.GSO, protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) *tcpip.Error {
+	e.mu.Lock()
+	if e.direct() {
+		defer e.writeMu.Unlock()
+		return e.lower.WritePacket(r, gso, protocol, pkt)
+	}
+	defer e.mu.Unlock()
+
+	// WritePacket caller's do not set the following fields in
+	// PacketBuffer so we populate them here.
+	pkt.EgressRoute = r
+	pkt.GSOOptions = gso
+	pkt.NetworkProtocolNumber = protocol
+	return e.enqueueLocked(pkt)
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+//
+// Being a batch API, each packet in pkts should have the following fields
+// populated:
+//   - pkt.EgressRoute
+//   - pkt.GSOOptions
+//   - pkt.NetworkProtocolNumber
+func (e *endpoint) WritePackets(r *stack.Route, gso *stack.GSO, pkts stack.PacketBufferList, protocol tcpip.NetworkProtocolNumber) (int, *tcpip.Error) {
+	e.mu.Lock()
+	if e.direct() {
+		defer e.writeMu.Unlock()
+		return e.lower.WritePackets(r, gso, pkts, protocol)
+	}
+	defer e.mu.Unlock()
+
+	enqueued := 0
+	for pkt := pkts.Front(); pkt != nil; {
+		nxt := pkt.Next()
+		if err := e.enqueueLocked(pkt); err != nil {
+			return enqueued, err
+		}
+		pkt = nxt
+		enqueued++
+	}
+	return enqueued, nil
+}
+
+// Wait implements stack.LinkEndpoint.Wait.
+func (e *endpoint) Wait() {
+	e.lower.Wait()
+
+	// The linkEP is gone, drop the held packets.
+	e.mu.Lock()
+	e.closed = true
+	if e.timer != nil && e.timer.Stop() {
+		batch := e.queue
+		e.queue.Reset()
+		e.queued = 0
+		e.timer = nil
+		e.mu.Unlock()
+		releaseAll(batch)
+		return
+	}
+	e.mu.Unlock()
+}
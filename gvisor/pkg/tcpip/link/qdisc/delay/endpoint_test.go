@@ -0,0 +1,127 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delay
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// recorder is a lower endpoint recording the hash of the packets written to
+// it, in order.
+type recorder struct {
+	stack.LinkEndpoint
+
+	mu      sync.Mutex
+	written []uint32
+	batches int
+}
+
+func (r *recorder) WritePacket(_ *stack.Route, _ *stack.GSO, _ tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) *tcpip.Error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.written = append(r.written, pkt.Hash)
+	return nil
+}
+
+func (r *recorder) WritePackets(_ *stack.Route, _ *stack.GSO, pkts stack.PacketBufferList, _ tcpip.NetworkProtocolNumber) (int, *tcpip.Error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches++
+	n := 0
+	for pkt := pkts.Front(); pkt != nil; pkt = pkt.Next() {
+		r.written = append(r.written, pkt.Hash)
+		n++
+	}
+	return n, nil
+}
+
+func (r *recorder) Wait() {}
+
+func (r *recorder) snapshot() ([]uint32, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]uint32(nil), r.written...), r.batches
+}
+
+func TestHoldsWhileActive(t *testing.T) {
+	var (
+		lower  recorder
+		mu     sync.Mutex
+		active bool
+	)
+	e := New(&lower, 10*time.Millisecond, 16, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return active
+	})
+
+	if err := e.WritePacket(&stack.Route{}, nil, 0, &stack.PacketBuffer{Hash: 1}); err != nil {
+		t.Fatalf("WritePacket() failed: %v", err)
+	}
+	if got, _ := lower.snapshot(); len(got) != 1 {
+		t.Fatalf("inactive write was not sent straight away, written: %v", got)
+	}
+
+	mu.Lock()
+	active = true
+	mu.Unlock()
+	for i := uint32(2); i <= 4; i++ {
+		if err := e.WritePacket(&stack.Route{}, nil, 0, &stack.PacketBuffer{Hash: i}); err != nil {
+			t.Fatalf("WritePacket() failed: %v", err)
+		}
+	}
+	if got, _ := lower.snapshot(); len(got) != 1 {
+		t.Errorf("active writes were sent straight away, written: %v", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, batches := lower.snapshot()
+		if len(got) == 4 {
+			for i, h := range got {
+				if h != uint32(i+1) {
+					t.Errorf("packets written out of order: %v", got)
+					break
+				}
+			}
+			if batches != 1 {
+				t.Errorf("held packets were written in %d batches, want 1", batches)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("held packets were never written, written: %v", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	var lower recorder
+	e := New(&lower, time.Hour, 1, func() bool { return true })
+	defer e.Wait()
+
+	if err := e.WritePacket(&stack.Route{}, nil, 0, &stack.PacketBuffer{}); err != nil {
+		t.Fatalf("WritePacket() failed: %v", err)
+	}
+	if err := e.WritePacket(&stack.Route{}, nil, 0, &stack.PacketBuffer{}); err != tcpip.ErrNoBufferSpace {
+		t.Errorf("WritePacket() on a full queue = %v, want %v", err, tcpip.ErrNoBufferSpace)
+	}
+}
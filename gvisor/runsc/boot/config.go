@@ -16,11 +16,16 @@ package boot
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"gvisor.dev/gvisor/pkg/maid"
 	"gvisor.dev/gvisor/pkg/refs"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/usermem"
 )
 
 // FileAccessType tells how the filesystem is accessed.
@@ -113,6 +118,776 @@ func MakeWatchdogAction(s string) (watchdog.Action, error) {
 	}
 }
 
+// JitterSchedulingMode tells where the delay scheduling policy runs.
+type JitterSchedulingMode int
+
+const (
+	// JitterSchedulingMonitor runs the policy in the monitor, which sends
+	// start and stop messages to the sentry.
+	JitterSchedulingMonitor JitterSchedulingMode = iota
+
+	// JitterSchedulingSentry runs the policy in the sentry. The monitor
+	// only streams raw samples.
+	JitterSchedulingSentry
+)
+
+// MakeJitterSchedulingMode converts type from string.
+func MakeJitterSchedulingMode(s string) (JitterSchedulingMode, error) {
+	switch s {
+	case "monitor":
+		return JitterSchedulingMonitor, nil
+	case "sentry":
+		return JitterSchedulingSentry, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter scheduling mode %q", s)
+	}
+}
+
+func (m JitterSchedulingMode) String() string {
+	switch m {
+	case JitterSchedulingMonitor:
+		return "monitor"
+	case JitterSchedulingSentry:
+		return "sentry"
+	default:
+		return fmt.Sprintf("unknown(%d)", m)
+	}
+}
+
+// JitterBackend tells how the sandbox is slowed down while a delay window is
+// open.
+type JitterBackend int
+
+const (
+	// JitterBackendMaid delays accesses to the target pages in the sentry.
+	JitterBackendMaid JitterBackend = iota
+
+	// JitterBackendMBA throttles the memory bandwidth of the whole sandbox
+	// with Intel Memory Bandwidth Allocation.
+	JitterBackendMBA
+
+	// JitterBackendCAT isolates the sandbox into dedicated last level cache
+	// ways with Intel Cache Allocation Technology.
+	JitterBackendCAT
+)
+
+// MakeJitterBackend converts type from string.
+func MakeJitterBackend(s string) (JitterBackend, error) {
+	switch s {
+	case "maid":
+		return JitterBackendMaid, nil
+	case "mba":
+		return JitterBackendMBA, nil
+	case "cat":
+		return JitterBackendCAT, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter backend %q", s)
+	}
+}
+
+func (b JitterBackend) String() string {
+	switch b {
+	case JitterBackendMaid:
+		return "maid"
+	case JitterBackendMBA:
+		return "mba"
+	case JitterBackendCAT:
+		return "cat"
+	default:
+		return fmt.Sprintf("unknown(%d)", b)
+	}
+}
+
+// JitterPrefetch is which hardware prefetchers the monitor disables on the
+// CPUs of the sandbox during delay windows.
+type JitterPrefetch int
+
+const (
+	// JitterPrefetchOff leaves the prefetchers alone.
+	JitterPrefetchOff JitterPrefetch = iota
+
+	// JitterPrefetchAll disables all the prefetchers.
+	JitterPrefetchAll
+
+	// JitterPrefetchL1 disables the L1 data cache prefetchers.
+	JitterPrefetchL1
+
+	// JitterPrefetchL2 disables the L2 prefetchers.
+	JitterPrefetchL2
+)
+
+// MakeJitterPrefetch converts type from string.
+func MakeJitterPrefetch(s string) (JitterPrefetch, error) {
+	switch strings.ToLower(s) {
+	case "off":
+		return JitterPrefetchOff, nil
+	case "all":
+		return JitterPrefetchAll, nil
+	case "l1":
+		return JitterPrefetchL1, nil
+	case "l2":
+		return JitterPrefetchL2, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter prefetch %q", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (p JitterPrefetch) String() string {
+	switch p {
+	case JitterPrefetchOff:
+		return "off"
+	case JitterPrefetchAll:
+		return "all"
+	case JitterPrefetchL1:
+		return "l1"
+	case JitterPrefetchL2:
+		return "l2"
+	default:
+		return fmt.Sprintf("unknown(%d)", p)
+	}
+}
+
+// JitterSampler is how the monitor samples the memory accesses of the
+// sandbox.
+type JitterSampler int
+
+const (
+	// JitterSamplerAuto uses JitterSamplerPerf in rootless mode and
+	// JitterSamplerDaptrace otherwise.
+	JitterSamplerAuto JitterSampler = iota
+
+	// JitterSamplerDaptrace samples with the daptrace kernel module, which
+	// requires root.
+	JitterSamplerDaptrace
+
+	// JitterSamplerPerf samples page faults with unprivileged perf events.
+	JitterSamplerPerf
+
+	// JitterSamplerDaptraceRing streams samples from the ring buffer of
+	// the daptrace kernel module, which keeps tracing between samples. It
+	// requires root.
+	JitterSamplerDaptraceRing
+
+	// JitterSamplerDaptraceEvents receives the samples of the daptrace
+	// kernel module as netlink events, as the module aggregates them. The
+	// module keeps tracing between samples. It requires root.
+	JitterSamplerDaptraceEvents
+
+	// JitterSamplerSentry counts the application page faults the sentry
+	// handles, unmapping the application from the platform address space
+	// before each sample so that every page touched faults again. It
+	// needs neither perf events nor a kernel module, but only counts
+	// pages touched, not accesses. It requires JitterInSandbox.
+	JitterSamplerSentry
+)
+
+// MakeJitterSampler converts type from string.
+func MakeJitterSampler(s string) (JitterSampler, error) {
+	switch strings.ToLower(s) {
+	case "auto":
+		return JitterSamplerAuto, nil
+	case "daptrace":
+		return JitterSamplerDaptrace, nil
+	case "perf":
+		return JitterSamplerPerf, nil
+	case "daptrace-ring":
+		return JitterSamplerDaptraceRing, nil
+	case "daptrace-events":
+		return JitterSamplerDaptraceEvents, nil
+	case "sentry":
+		return JitterSamplerSentry, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter sampler %q", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (s JitterSampler) String() string {
+	switch s {
+	case JitterSamplerAuto:
+		return "auto"
+	case JitterSamplerDaptrace:
+		return "daptrace"
+	case JitterSamplerPerf:
+		return "perf"
+	case JitterSamplerDaptraceRing:
+		return "daptrace-ring"
+	case JitterSamplerDaptraceEvents:
+		return "daptrace-events"
+	case JitterSamplerSentry:
+		return "sentry"
+	default:
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+}
+
+// JitterPerfPMU is what the perf sampler samples.
+type JitterPerfPMU int
+
+const (
+	// JitterPerfAuto uses JitterPerfIBS if the host has AMD IBS, and
+	// JitterPerfFaults otherwise or if IBS events can't be opened.
+	JitterPerfAuto JitterPerfPMU = iota
+
+	// JitterPerfFaults samples page faults with software events.
+	JitterPerfFaults
+
+	// JitterPerfIBS samples the data addresses of memory operations with
+	// AMD Instruction-Based Sampling.
+	JitterPerfIBS
+)
+
+// MakeJitterPerfPMU converts type from string.
+func MakeJitterPerfPMU(s string) (JitterPerfPMU, error) {
+	switch strings.ToLower(s) {
+	case "auto":
+		return JitterPerfAuto, nil
+	case "faults":
+		return JitterPerfFaults, nil
+	case "ibs":
+		return JitterPerfIBS, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter perf PMU %q", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (p JitterPerfPMU) String() string {
+	switch p {
+	case JitterPerfAuto:
+		return "auto"
+	case JitterPerfFaults:
+		return "faults"
+	case JitterPerfIBS:
+		return "ibs"
+	default:
+		return fmt.Sprintf("unknown(%d)", p)
+	}
+}
+
+// JitterActivation tells when the monitor delays the sandbox.
+type JitterActivation int
+
+const (
+	// JitterActivationAlways delays the sandbox whenever the policy finds
+	// hot targets.
+	JitterActivationAlways JitterActivation = iota
+
+	// JitterActivationSuspected only delays the sandbox while cache
+	// counters suggest a flush+reload or prime+probe attack.
+	JitterActivationSuspected
+)
+
+// MakeJitterActivation converts type from string.
+func MakeJitterActivation(s string) (JitterActivation, error) {
+	switch strings.ToLower(s) {
+	case "always":
+		return JitterActivationAlways, nil
+	case "suspected":
+		return JitterActivationSuspected, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter activation %q", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (a JitterActivation) String() string {
+	switch a {
+	case JitterActivationAlways:
+		return "always"
+	case JitterActivationSuspected:
+		return "suspected"
+	default:
+		return fmt.Sprintf("unknown(%d)", a)
+	}
+}
+
+// JitterCoResidency is what the monitor does when the sandbox runs on
+// dedicated cores, i.e. shares neither physical cores nor last level cache
+// with other host workloads.
+type JitterCoResidency int
+
+const (
+	// JitterCoResidencyIgnore delays the sandbox regardless of co-residency.
+	JitterCoResidencyIgnore JitterCoResidency = iota
+
+	// JitterCoResidencyDisable doesn't delay a sandbox on dedicated cores.
+	JitterCoResidencyDisable
+
+	// JitterCoResidencyDowngrade only delays a sandbox on dedicated cores
+	// while an attack is suspected, as with JitterActivationSuspected.
+	JitterCoResidencyDowngrade
+)
+
+// MakeJitterCoResidency converts type from string.
+func MakeJitterCoResidency(s string) (JitterCoResidency, error) {
+	switch strings.ToLower(s) {
+	case "ignore":
+		return JitterCoResidencyIgnore, nil
+	case "disable":
+		return JitterCoResidencyDisable, nil
+	case "downgrade":
+		return JitterCoResidencyDowngrade, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter co-residency mode %q", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (c JitterCoResidency) String() string {
+	switch c {
+	case JitterCoResidencyIgnore:
+		return "ignore"
+	case JitterCoResidencyDisable:
+		return "disable"
+	case JitterCoResidencyDowngrade:
+		return "downgrade"
+	default:
+		return fmt.Sprintf("unknown(%d)", c)
+	}
+}
+
+// JitterNUMA is how the monitor takes the NUMA nodes of the host into account
+// on multi-socket hosts.
+type JitterNUMA int
+
+const (
+	// JitterNUMAOff ignores NUMA nodes.
+	JitterNUMAOff JitterNUMA = iota
+
+	// JitterNUMARecord logs the nodes of the targets of each delay window
+	// and of the suspected attacker.
+	JitterNUMARecord
+
+	// JitterNUMAMigrate also migrates the targets living on the node of
+	// the suspected attacker to another node instead of delaying them,
+	// when that is cheaper.
+	JitterNUMAMigrate
+)
+
+// MakeJitterNUMA converts type from string.
+func MakeJitterNUMA(s string) (JitterNUMA, error) {
+	switch strings.ToLower(s) {
+	case "off":
+		return JitterNUMAOff, nil
+	case "record":
+		return JitterNUMARecord, nil
+	case "migrate":
+		return JitterNUMAMigrate, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter NUMA mode %q", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (n JitterNUMA) String() string {
+	switch n {
+	case JitterNUMAOff:
+		return "off"
+	case JitterNUMARecord:
+		return "record"
+	case JitterNUMAMigrate:
+		return "migrate"
+	default:
+		return fmt.Sprintf("unknown(%d)", n)
+	}
+}
+
+// JitterSampleScope is how much of the processes selected by the target
+// policy the monitor samples.
+type JitterSampleScope int
+
+const (
+	// JitterSampleProcess samples every thread of the selected processes.
+	JitterSampleProcess JitterSampleScope = iota
+
+	// JitterSampleThread samples the busiest thread of the busiest
+	// selected process alone, e.g. the worker of a single-threaded crypto
+	// daemon.
+	JitterSampleThread
+
+	// JitterSampleCgroup samples every process of the container cgroup
+	// once the policy selected any.
+	JitterSampleCgroup
+)
+
+// MakeJitterSampleScope converts type from string.
+func MakeJitterSampleScope(s string) (JitterSampleScope, error) {
+	switch strings.ToLower(s) {
+	case "process":
+		return JitterSampleProcess, nil
+	case "thread":
+		return JitterSampleThread, nil
+	case "cgroup":
+		return JitterSampleCgroup, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter sample scope %q", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (s JitterSampleScope) String() string {
+	switch s {
+	case JitterSampleProcess:
+		return "process"
+	case JitterSampleThread:
+		return "thread"
+	case JitterSampleCgroup:
+		return "cgroup"
+	default:
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+}
+
+// JitterFailurePolicy is what the monitor does when sampling keeps failing,
+// leaving the workload unprotected.
+type JitterFailurePolicy int
+
+const (
+	// JitterFailOpen lets the workload run unprotected while the monitor
+	// keeps retrying.
+	JitterFailOpen JitterFailurePolicy = iota
+
+	// JitterFailClosed kills the processes of the container.
+	JitterFailClosed
+
+	// JitterFailPause pauses the container until it is resumed with
+	// "runsc resume".
+	JitterFailPause
+)
+
+// MakeJitterFailurePolicy converts type from string.
+func MakeJitterFailurePolicy(s string) (JitterFailurePolicy, error) {
+	switch strings.ToLower(s) {
+	case "open":
+		return JitterFailOpen, nil
+	case "closed":
+		return JitterFailClosed, nil
+	case "pause-container":
+		return JitterFailPause, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter failure policy %q", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (p JitterFailurePolicy) String() string {
+	switch p {
+	case JitterFailOpen:
+		return "open"
+	case JitterFailClosed:
+		return "closed"
+	case JitterFailPause:
+		return "pause-container"
+	default:
+		return fmt.Sprintf("unknown(%d)", p)
+	}
+}
+
+// JitterTargetKind tells how the monitor selects the processes it samples.
+type JitterTargetKind int
+
+const (
+	// JitterTargetCPU samples the sandbox process using the most CPU. In
+	// rootless mode, the workload doesn't run as nobody and the process is
+	// picked from the sandbox process tree instead.
+	JitterTargetCPU JitterTargetKind = iota
+
+	// JitterTargetExe samples the sandbox processes whose executable name
+	// matches a regular expression.
+	JitterTargetExe
+
+	// JitterTargetArgs samples the container processes if the OCI process
+	// args match a regular expression.
+	JitterTargetArgs
+
+	// JitterTargetEnv samples the container processes if the OCI process
+	// environment carries a marker variable.
+	JitterTargetEnv
+
+	// JitterTargetCgroup samples the sandbox processes in a cgroup.
+	JitterTargetCgroup
+
+	// JitterTargetAll samples all container processes.
+	JitterTargetAll
+)
+
+// String implements fmt.Stringer.
+func (k JitterTargetKind) String() string {
+	switch k {
+	case JitterTargetCPU:
+		return "cpu"
+	case JitterTargetExe:
+		return "exe"
+	case JitterTargetArgs:
+		return "args"
+	case JitterTargetEnv:
+		return "env"
+	case JitterTargetCgroup:
+		return "cgroup"
+	case JitterTargetAll:
+		return "all"
+	default:
+		return fmt.Sprintf("unknown(%d)", k)
+	}
+}
+
+// JitterTargetPolicy selects the processes the monitor samples.
+type JitterTargetPolicy struct {
+	// Kind is how processes are selected.
+	Kind JitterTargetKind
+
+	// Pattern is the argument of Kind: a regular expression for
+	// JitterTargetExe and JitterTargetArgs, a NAME or NAME=VALUE marker for
+	// JitterTargetEnv and a cgroup path prefix for JitterTargetCgroup.
+	Pattern string
+}
+
+// String implements fmt.Stringer.
+func (p JitterTargetPolicy) String() string {
+	if p.Pattern == "" {
+		return p.Kind.String()
+	}
+	return p.Kind.String() + ":" + p.Pattern
+}
+
+// MakeJitterTargetPolicy converts type from string. The format is
+// kind[:pattern].
+func MakeJitterTargetPolicy(s string) (JitterTargetPolicy, error) {
+	kind, pattern := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		kind, pattern = s[:i], s[i+1:]
+	}
+	var p JitterTargetPolicy
+	switch strings.ToLower(kind) {
+	case "cpu":
+		p.Kind = JitterTargetCPU
+	case "exe":
+		p.Kind = JitterTargetExe
+	case "args":
+		p.Kind = JitterTargetArgs
+	case "env":
+		p.Kind = JitterTargetEnv
+	case "cgroup":
+		p.Kind = JitterTargetCgroup
+	case "all":
+		p.Kind = JitterTargetAll
+	default:
+		return p, fmt.Errorf("invalid jitter target policy %q", s)
+	}
+	p.Pattern = pattern
+
+	switch p.Kind {
+	case JitterTargetCPU, JitterTargetAll:
+		if pattern != "" {
+			return p, fmt.Errorf("jitter target policy %q takes no pattern", kind)
+		}
+	case JitterTargetExe, JitterTargetArgs:
+		if _, err := regexp.Compile(pattern); err != nil {
+			return p, fmt.Errorf("invalid jitter target policy %q: %v", s, err)
+		}
+	case JitterTargetEnv, JitterTargetCgroup:
+		if pattern == "" || strings.HasPrefix(pattern, "=") {
+			return p, fmt.Errorf("jitter target policy %q requires a pattern", kind)
+		}
+	}
+	return p, nil
+}
+
+// MatchesProcess returns whether a process started with argv and envv matches
+// p. Only JitterTargetArgs and JitterTargetEnv select processes by how they
+// were started, other kinds match none.
+func (p JitterTargetPolicy) MatchesProcess(argv, envv []string) bool {
+	switch p.Kind {
+	case JitterTargetArgs:
+		re, err := regexp.Compile(p.Pattern)
+		return err == nil && re.MatchString(strings.Join(argv, " "))
+	case JitterTargetEnv:
+		return hasEnvMarker(envv, p.Pattern)
+	default:
+		return false
+	}
+}
+
+// hasEnvMarker returns whether env has the marker NAME or NAME=VALUE.
+func hasEnvMarker(env []string, marker string) bool {
+	for _, e := range env {
+		if strings.Contains(marker, "=") {
+			if e == marker {
+				return true
+			}
+		} else if strings.HasPrefix(e, marker+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeJitterHeartbeatAction converts type from string.
+func MakeJitterHeartbeatAction(s string) (maid.HeartbeatAction, error) {
+	switch strings.ToLower(s) {
+	case "log":
+		return maid.HeartbeatLog, nil
+	case "disable":
+		return maid.HeartbeatDisable, nil
+	case "watchdog":
+		return maid.HeartbeatWatchdog, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter heartbeat action %q", s)
+	}
+}
+
+// MakeJitterMsgDrop converts type from string.
+func MakeJitterMsgDrop(s string) (maid.DropPolicy, error) {
+	switch strings.ToLower(s) {
+	case "block":
+		return maid.DropNone, nil
+	case "drop-oldest":
+		return maid.DropOldest, nil
+	case "drop-newest":
+		return maid.DropNewest, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter message drop policy %q", s)
+	}
+}
+
+// MakeJitterStallAction converts type from string.
+func MakeJitterStallAction(s string) (maid.StallAction, error) {
+	switch strings.ToLower(s) {
+	case "log":
+		return maid.StallLog, nil
+	case "panic":
+		return maid.StallPanic, nil
+	case "disable-jitter":
+		return maid.StallDisable, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter stall action %q", s)
+	}
+}
+
+// MakeJitterLoadAction converts type from string.
+func MakeJitterLoadAction(s string) (maid.LoadAction, error) {
+	switch strings.ToLower(s) {
+	case "suspend":
+		return maid.LoadSuspend, nil
+	case "lighten":
+		return maid.LoadLighten, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter load action %q", s)
+	}
+}
+
+// MakeJitterDelayPrimitive converts type from string.
+func MakeJitterDelayPrimitive(s string) (maid.DelayPrimitive, error) {
+	switch strings.ToLower(s) {
+	case "mprotect":
+		return maid.DelayTrap, nil
+	case "sleep":
+		return maid.DelaySleep, nil
+	case "clflush":
+		return maid.DelayFlush, nil
+	case "unmap":
+		return maid.DelayUnmap, nil
+	case "recolor":
+		return maid.DelayRecolor, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter delay primitive %q", s)
+	}
+}
+
+// MakeJitterEntropyMapping converts type from string.
+func MakeJitterEntropyMapping(s string) (maid.EntropyMappingKind, error) {
+	switch strings.ToLower(s) {
+	case "off":
+		return maid.EntropyOff, nil
+	case "linear":
+		return maid.EntropyLinear, nil
+	case "exp":
+		return maid.EntropyExp, nil
+	case "step":
+		return maid.EntropyStep, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter entropy mapping %q", s)
+	}
+}
+
+// DefaultJitterHITMEvent is the raw hardware event the contention signal
+// samples unless set otherwise: MEM_LOAD_L3_HIT_RETIRED.XSNP_HITM of Intel
+// Skylake and later, which perf c2c samples too.
+const DefaultJitterHITMEvent = 0x04d2
+
+// MakeJitterDelayScope converts type from string.
+func MakeJitterDelayScope(s string) (maid.DelayScope, error) {
+	switch strings.ToLower(s) {
+	case "sandbox":
+		return maid.DelaySandbox, nil
+	case "task":
+		return maid.DelayTask, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter delay scope %q", s)
+	}
+}
+
+// MakeJitterDelayWait converts type from string.
+func MakeJitterDelayWait(s string) (maid.WaitMode, error) {
+	switch strings.ToLower(s) {
+	case "sleep":
+		return maid.WaitSleep, nil
+	case "spin":
+		return maid.WaitSpin, nil
+	case "hybrid":
+		return maid.WaitHybrid, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter delay wait %q", s)
+	}
+}
+
+// MakeJitterDecoyMode converts type from string.
+func MakeJitterDecoyMode(s string) (maid.DecoyMode, error) {
+	switch strings.ToLower(s) {
+	case "off":
+		return maid.DecoyOff, nil
+	case "decoy":
+		return maid.DecoyOnly, nil
+	case "both":
+		return maid.DecoyBoth, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter decoy mode %q", s)
+	}
+}
+
+// MakeJitterBackoffKind converts type from string.
+func MakeJitterBackoffKind(s string) (maid.BackoffKind, error) {
+	switch strings.ToLower(s) {
+	case "exponential":
+		return maid.BackoffExponential, nil
+	case "linear":
+		return maid.BackoffLinear, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter backoff %q", s)
+	}
+}
+
+// MakeJitterCompensationKind converts type from string.
+func MakeJitterCompensationKind(s string) (maid.CompensationKind, error) {
+	switch strings.ToLower(s) {
+	case "none":
+		return maid.CompensateNone, nil
+	case "linear":
+		return maid.CompensateLinear, nil
+	case "measured":
+		return maid.CompensateMeasured, nil
+	default:
+		return 0, fmt.Errorf("invalid jitter compensation %q", s)
+	}
+}
+
+// MakeJitterClockFuzz converts type from string.
+func MakeJitterClockFuzz(s string) (ktime.Fuzz, error) {
+	return ktime.ParseFuzz(s)
+}
+
 // MakeRefsLeakMode converts type from string.
 func MakeRefsLeakMode(s string) (refs.LeakMode, error) {
 	switch strings.ToLower(s) {
@@ -277,6 +1052,338 @@ type Config struct {
 
 	// Enables FUSE usage (not plumbled through yet).
 	FUSE bool
+
+	// Jitter starts the jitter monitor next to the sandbox. Without it,
+	// nothing is ever delayed.
+	Jitter bool
+
+	// JitterHeartbeatInterval is how often the monitor tells the sentry
+	// that it is alive. Zero disables heartbeats.
+	JitterHeartbeatInterval time.Duration
+
+	// JitterHeartbeatAction sets what the sentry does when heartbeats from
+	// the monitor stop.
+	JitterHeartbeatAction maid.HeartbeatAction
+
+	// JitterMsgBuffer is the number of messages the monitor queues for the
+	// sentry.
+	JitterMsgBuffer int
+
+	// JitterMsgDrop sets which messages the monitor drops when its queue
+	// to the sentry is full.
+	JitterMsgDrop maid.DropPolicy
+
+	// JitterScheduling is where the delay scheduling policy runs.
+	JitterScheduling JitterSchedulingMode
+
+	// JitterDelayPrimitive is the mechanism the sentry uses to slow down
+	// accesses to target pages.
+	JitterDelayPrimitive maid.DelayPrimitive
+
+	// JitterSplitHugePages splits huge pages around target pages, so that
+	// they are delayed at small page granularity.
+	JitterSplitHugePages bool
+
+	// JitterDecoyMode is whether the sentry issues decoy accesses during
+	// delay windows.
+	JitterDecoyMode maid.DecoyMode
+
+	// JitterDecoyAddrs are the pages decoy accesses go to. If empty, the
+	// secondary targets of the current batch are used.
+	JitterDecoyAddrs []usermem.Addr
+
+	// JitterDecoyInterval is how often decoy accesses are issued.
+	JitterDecoyInterval time.Duration
+
+	// JitterClockFuzzRealtime degrades CLOCK_REALTIME as read by the
+	// application.
+	JitterClockFuzzRealtime ktime.Fuzz
+
+	// JitterClockFuzzMonotonic degrades CLOCK_MONOTONIC as read by the
+	// application.
+	JitterClockFuzzMonotonic ktime.Fuzz
+
+	// JitterSyscalls is the set of syscalls delayed during delay windows.
+	JitterSyscalls []string
+
+	// JitterSyscallDelay bounds the random delay of JitterSyscalls.
+	JitterSyscallDelay time.Duration
+
+	// JitterPreemptInterval bounds the random time between two preemptions
+	// of the delayed task during delay windows. 0 disables preemption.
+	JitterPreemptInterval time.Duration
+
+	// JitterBackend is how the sandbox is slowed down during a delay
+	// window.
+	JitterBackend JitterBackend
+
+	// JitterMBAPercent is the memory bandwidth, in percent, the sandbox is
+	// throttled to by JitterBackendMBA.
+	JitterMBAPercent int
+
+	// JitterCATWays is the number of last level cache ways reserved for the
+	// sandbox by JitterBackendCAT.
+	JitterCATWays int
+
+	// JitterPrefetch is which hardware prefetchers are disabled on the CPUs
+	// of the sandbox during delay windows.
+	JitterPrefetch JitterPrefetch
+
+	// JitterTargetPolicy selects the processes the monitor samples.
+	JitterTargetPolicy JitterTargetPolicy
+
+	// JitterSampleScope is how much of the selected processes the monitor
+	// samples: a thread, whole processes or the container cgroup.
+	JitterSampleScope JitterSampleScope
+
+	// JitterSampler is how the monitor samples the memory accesses of the
+	// sandbox.
+	JitterSampler JitterSampler
+
+	// JitterPerfPMU is what the perf sampler samples.
+	JitterPerfPMU JitterPerfPMU
+
+	// JitterWarmUp is how long the monitor waits before it starts sampling.
+	JitterWarmUp time.Duration
+
+	// JitterStartOnExec makes the monitor start sampling as soon as the
+	// sandbox reports that the workload has started, instead of after
+	// JitterWarmUp.
+	JitterStartOnExec bool
+
+	// JitterBackoff is how the jitter policy backs off sampling while
+	// nothing is delayed.
+	JitterBackoff maid.Backoff
+
+	// JitterCompensation is how the jitter policy corrects the access count
+	// sampled after a delayed window.
+	JitterCompensation maid.Compensation
+
+	// JitterRecord is the file the monitor records its samples and
+	// decisions to. Empty disables recording.
+	JitterRecord string
+
+	// JitterReplay is a trace recorded with JitterRecord that drives the
+	// monitor instead of live sampling. Empty samples the sandbox.
+	JitterReplay string
+
+	// JitterActivation tells when the monitor delays the sandbox.
+	JitterActivation JitterActivation
+
+	// JitterCoResidency is what the monitor does when the sandbox runs on
+	// dedicated cores.
+	JitterCoResidency JitterCoResidency
+
+	// JitterNUMA is how the monitor takes the NUMA nodes of the host into
+	// account.
+	JitterNUMA JitterNUMA
+
+	// JitterCPUSet is the list of CPUs the sandbox, its gofer and the
+	// monitor are pinned to, so that delays are injected on the cores the
+	// workload runs on. Empty leaves CPU placement alone.
+	JitterCPUSet string
+
+	// JitterCPUSetExclusive extends JitterCPUSet to whole physical cores
+	// and reserves them for the sandbox, so that no other workload runs on
+	// a hyperthread sibling.
+	JitterCPUSetExclusive bool
+
+	// JitterDelayScope is which tasks are stalled when an access to a target
+	// traps.
+	JitterDelayScope maid.DelayScope
+
+	// JitterDelayWait is how the sentry waits out the delays of the windows
+	// the policy opens: sleeping, or busy-waiting for sub-millisecond
+	// precision.
+	JitterDelayWait maid.WaitMode
+
+	// JitterDeferLockHolders defers the delays of tasks holding a futex
+	// other tasks wait on until they release it.
+	JitterDeferLockHolders bool
+
+	// JitterHeatDecay is the factor the heat of sampled pages decays by
+	// every sampling cycle. 0 targets the hottest pages of each sample.
+	JitterHeatDecay float64
+
+	// JitterTopK is the number of most sampled pages the monitor tracks over
+	// the life of the container and reports to the sandbox. 0 disables
+	// tracking.
+	JitterTopK int
+
+	// JitterDaemon hands the sandbox to the host-wide jitter daemon instead
+	// of starting a monitor process for it.
+	JitterDaemon bool
+
+	// JitterGoferDelay bounds the random delay the gofer adds to reads and
+	// stats of hot files. 0 disables it.
+	JitterGoferDelay time.Duration
+
+	// JitterGoferHotAccesses is the number of accesses to a file within a
+	// second from which the gofer delays them.
+	JitterGoferHotAccesses int
+
+	// JitterNetDelay bounds the time the network stack holds outbound
+	// packets for during delay windows. 0 disables it.
+	JitterNetDelay time.Duration
+
+	// JitterThresholds are the access counts the jitter policy judges
+	// samples against.
+	JitterThresholds maid.Thresholds
+
+	// JitterCalibrate is the number of sampling cycles the monitor
+	// observes to derive JitterThresholds from the workload. 0 disables
+	// calibration.
+	JitterCalibrate int
+
+	// JitterHysteresis keeps the jitter policy from oscillating between
+	// delaying and skipping windows.
+	JitterHysteresis maid.Hysteresis
+
+	// JitterHistoryWindow is the number of past samples the jitter policy
+	// judges a sample against.
+	JitterHistoryWindow int
+
+	// JitterEntropy maps the entropy of the sample a delay window opens on
+	// to the intensity of its delays.
+	JitterEntropy maid.EntropyMapping
+
+	// JitterContention opens delay windows on samples with cross-core
+	// contention on their targets, HITM loads of the raw hardware event
+	// JitterHITMEvent, and delays them harder.
+	JitterContention maid.Contention
+	JitterHITMEvent  uint64
+
+	// JitterSampleDeadline bounds the duration of a sample in the monitor
+	// before JitterStallAction is taken. 0 disables the check.
+	JitterSampleDeadline time.Duration
+
+	// JitterStallAction sets what the monitor does when a sample overruns
+	// JitterSampleDeadline.
+	JitterStallAction maid.StallAction
+
+	// JitterLogMaxSize and JitterLogMaxAge bound the sample archive and
+	// record file of the monitor before they are rotated. 0 disables the
+	// bound.
+	JitterLogMaxSize int64
+	JitterLogMaxAge  time.Duration
+
+	// JitterLogKeep is the number of rotated files the monitor keeps.
+	JitterLogKeep int
+
+	// JitterWorkDir is the directory the monitors keep their files in, in a
+	// subdirectory each.
+	JitterWorkDir string
+
+	// JitterModule is the daptrace kernel module to load. If empty, it is
+	// looked for in the standard locations.
+	JitterModule string
+
+	// JitterModuleSrc holds the sources of the daptrace kernel module to
+	// build with DKMS when none is found. Empty disables building.
+	JitterModuleSrc string
+
+	// JitterInSandbox samples the sandbox with perf events, or the sentry's
+	// own page faults with JitterSamplerSentry, from within the boot
+	// process instead of a monitor process. Delays are then scheduled by
+	// the sentry.
+	JitterInSandbox bool
+
+	// JitterPrivsep runs the monitor as nobody and leaves the operations on
+	// the daptrace kernel module to a helper process with reduced
+	// capabilities.
+	JitterPrivsep bool
+
+	// JitterAuditKey is the path of the key the monitor signs its audit log
+	// of delay windows with. Auditing is disabled if empty.
+	JitterAuditKey string
+
+	// JitterDelayBudget is the ceiling on the time the sandbox is delayed
+	// per second. 0 disables it.
+	JitterDelayBudget time.Duration
+
+	// JitterFailurePolicy is what the monitor does when sampling keeps
+	// failing.
+	JitterFailurePolicy JitterFailurePolicy
+
+	// JitterBlindPeriod is the period of the duty-cycle throttling the
+	// monitor falls back to when no sampler is available. 0 disables the
+	// fallback.
+	JitterBlindPeriod time.Duration
+
+	// JitterBlindDuty is the average percentage of JitterBlindPeriod the
+	// workload is stopped for in blind mode.
+	JitterBlindDuty int
+
+	// JitterConfig is the file the jitter parameters that can change while
+	// the sandbox runs are read from, see JitterTunables.
+	JitterConfig string
+
+	// JitterSymbolize resolves the targets of the monitor's decisions to the
+	// libraries and functions that contain them.
+	JitterSymbolize bool
+
+	// JitterSymbolRules are per-function policies applied to the targets of
+	// the monitor, by function or mapping name.
+	JitterSymbolRules maid.SymbolRules
+
+	// JitterCalendar is when the monitor protects the sandbox: during the
+	// minutes matching its schedules, or while the container carries one of
+	// its labels. Empty always protects it.
+	JitterCalendar maid.Calendar
+
+	// JitterProfileDir is the directory the monitor keeps the profiles it
+	// learns per container image in. Profiles are disabled if empty.
+	JitterProfileDir string
+
+	// JitterExitReport is the file the sentry appends its exit report to,
+	// as a line of JSON. It is a pattern as DebugLog is. Empty only logs
+	// the report.
+	JitterExitReport string
+
+	// JitterChaos delays random sampled pages at random times instead of the
+	// targets the policy decides on, as many of them, as a control arm.
+	JitterChaos bool
+
+	// JitterFairTurns schedules the delay windows of the sandboxes of the
+	// host round-robin instead of simultaneously.
+	JitterFairTurns bool
+
+	// JitterWidenRadius is the number of pages on each side of every target
+	// that are delayed with it.
+	JitterWidenRadius int
+
+	// JitterShuffleInterval is how often the frames of the secret pages are
+	// permuted. 0 disables it.
+	JitterShuffleInterval time.Duration
+
+	// JitterPageTier is the primitive the page tier applies to the hot
+	// region every JitterPageTierInterval, 0 if the page tier is disabled.
+	JitterPageTier         maid.DelayPrimitive
+	JitterPageTierInterval time.Duration
+
+	// JitterLineTier flushes the sampled cache lines of the targets during
+	// delay windows instead of applying JitterDelayPrimitive.
+	JitterLineTier bool
+
+	// JitterLoadLimits are the host load above which the monitor takes
+	// JitterLoadAction. No limit is set by default.
+	JitterLoadLimits maid.LoadLimits
+
+	// JitterLoadAction sets what the monitor does while the host is over
+	// JitterLoadLimits.
+	JitterLoadAction maid.LoadAction
+
+	// JitterCPUCompensation credits the CPU quota of the sandbox cgroup with
+	// the time the sandbox was delayed.
+	JitterCPUCompensation bool
+
+	// JitterAlert is the webhook URL or named pipe the monitor sends alerts
+	// on suspected attacks to. Alerts are disabled if empty.
+	JitterAlert string
+
+	// JitterIOUring reads the sample events of JitterSamplerDaptraceEvents
+	// with io_uring.
+	JitterIOUring bool
 }
 
 // ToFlags returns a slice of flags that correspond to the given Config.
@@ -312,6 +1419,103 @@ func (c *Config) ToFlags() []string {
 		"--tx-checksum-offload=" + strconv.FormatBool(c.TXChecksumOffload),
 		"--overlayfs-stale-read=" + strconv.FormatBool(c.OverlayfsStaleRead),
 		"--qdisc=" + c.QDisc.String(),
+		"--jitter=" + strconv.FormatBool(c.Jitter),
+		"--jitter-heartbeat-interval=" + c.JitterHeartbeatInterval.String(),
+		"--jitter-heartbeat-action=" + c.JitterHeartbeatAction.String(),
+		"--jitter-msg-buffer=" + strconv.Itoa(c.JitterMsgBuffer),
+		"--jitter-msg-drop=" + c.JitterMsgDrop.String(),
+		"--jitter-scheduling=" + c.JitterScheduling.String(),
+		"--jitter-delay-primitive=" + c.JitterDelayPrimitive.String(),
+		"--jitter-split-huge-pages=" + strconv.FormatBool(c.JitterSplitHugePages),
+		"--jitter-decoy-mode=" + c.JitterDecoyMode.String(),
+		"--jitter-decoy-addrs=" + maid.FormatDecoyAddrs(c.JitterDecoyAddrs),
+		"--jitter-decoy-interval=" + c.JitterDecoyInterval.String(),
+		"--jitter-clock-fuzz-realtime=" + c.JitterClockFuzzRealtime.String(),
+		"--jitter-clock-fuzz-monotonic=" + c.JitterClockFuzzMonotonic.String(),
+		"--jitter-syscalls=" + strings.Join(c.JitterSyscalls, ","),
+		"--jitter-syscall-delay=" + c.JitterSyscallDelay.String(),
+		"--jitter-preempt-interval=" + c.JitterPreemptInterval.String(),
+		"--jitter-backend=" + c.JitterBackend.String(),
+		"--jitter-mba-percent=" + strconv.Itoa(c.JitterMBAPercent),
+		"--jitter-cat-ways=" + strconv.Itoa(c.JitterCATWays),
+		"--jitter-prefetch=" + c.JitterPrefetch.String(),
+		"--jitter-target-policy=" + c.JitterTargetPolicy.String(),
+		"--jitter-sample-scope=" + c.JitterSampleScope.String(),
+		"--jitter-sampler=" + c.JitterSampler.String(),
+		"--jitter-perf-pmu=" + c.JitterPerfPMU.String(),
+		"--jitter-warm-up=" + c.JitterWarmUp.String(),
+		"--jitter-start-on-exec=" + strconv.FormatBool(c.JitterStartOnExec),
+		"--jitter-backoff=" + c.JitterBackoff.Kind.String(),
+		"--jitter-backoff-factor=" + strconv.Itoa(c.JitterBackoff.Factor),
+		"--jitter-backoff-step=" + c.JitterBackoff.Step.String(),
+		"--jitter-backoff-max=" + c.JitterBackoff.Max.String(),
+		"--jitter-backoff-reset=" + c.JitterBackoff.Reset.String(),
+		"--jitter-compensation=" + c.JitterCompensation.Kind.String(),
+		"--jitter-compensation-factor=" + strconv.FormatFloat(c.JitterCompensation.Factor, 'g', -1, 64),
+		"--jitter-record=" + c.JitterRecord,
+		"--jitter-replay=" + c.JitterReplay,
+		"--jitter-activation=" + c.JitterActivation.String(),
+		"--jitter-co-residency=" + c.JitterCoResidency.String(),
+		"--jitter-numa=" + c.JitterNUMA.String(),
+		"--jitter-cpuset=" + c.JitterCPUSet,
+		"--jitter-cpuset-exclusive=" + strconv.FormatBool(c.JitterCPUSetExclusive),
+		"--jitter-delay-scope=" + c.JitterDelayScope.String(),
+		"--jitter-delay-wait=" + c.JitterDelayWait.String(),
+		"--jitter-defer-lock-holders=" + strconv.FormatBool(c.JitterDeferLockHolders),
+		"--jitter-heat-decay=" + strconv.FormatFloat(c.JitterHeatDecay, 'g', -1, 64),
+		"--jitter-top-k=" + strconv.Itoa(c.JitterTopK),
+		"--jitter-daemon=" + strconv.FormatBool(c.JitterDaemon),
+		"--jitter-gofer-delay=" + c.JitterGoferDelay.String(),
+		"--jitter-gofer-hot-accesses=" + strconv.Itoa(c.JitterGoferHotAccesses),
+		"--jitter-net-delay=" + c.JitterNetDelay.String(),
+		"--jitter-min-accesses=" + strconv.Itoa(c.JitterThresholds.Min),
+		"--jitter-spike-accesses=" + strconv.Itoa(c.JitterThresholds.Spike),
+		"--jitter-calibrate=" + strconv.Itoa(c.JitterCalibrate),
+		"--jitter-off-accesses=" + strconv.Itoa(c.JitterHysteresis.Off),
+		"--jitter-min-on-decisions=" + strconv.Itoa(c.JitterHysteresis.MinOn),
+		"--jitter-min-off-decisions=" + strconv.Itoa(c.JitterHysteresis.MinOff),
+		"--jitter-history-window=" + strconv.Itoa(c.JitterHistoryWindow),
+		"--jitter-entropy-mapping=" + c.JitterEntropy.Kind.String(),
+		"--jitter-entropy-min=" + strconv.FormatFloat(c.JitterEntropy.Min, 'g', -1, 64),
+		"--jitter-entropy-max=" + strconv.FormatFloat(c.JitterEntropy.Max, 'g', -1, 64),
+		"--jitter-entropy-step=" + strconv.FormatFloat(c.JitterEntropy.Step, 'g', -1, 64),
+		"--jitter-contention-hitm=" + strconv.Itoa(c.JitterContention.MinHITM),
+		"--jitter-contention-boost=" + strconv.FormatFloat(c.JitterContention.Boost, 'g', -1, 64),
+		"--jitter-hitm-event=0x" + strconv.FormatUint(c.JitterHITMEvent, 16),
+		"--jitter-sample-deadline=" + c.JitterSampleDeadline.String(),
+		"--jitter-stall-action=" + c.JitterStallAction.String(),
+		"--jitter-log-max-size=" + strconv.FormatInt(c.JitterLogMaxSize, 10),
+		"--jitter-log-max-age=" + c.JitterLogMaxAge.String(),
+		"--jitter-log-keep=" + strconv.Itoa(c.JitterLogKeep),
+		"--jitter-work-dir=" + c.JitterWorkDir,
+		"--jitter-module=" + c.JitterModule,
+		"--jitter-module-src=" + c.JitterModuleSrc,
+		"--jitter-in-sandbox=" + strconv.FormatBool(c.JitterInSandbox),
+		"--jitter-privsep=" + strconv.FormatBool(c.JitterPrivsep),
+		"--jitter-audit-key=" + c.JitterAuditKey,
+		"--jitter-delay-budget=" + c.JitterDelayBudget.String(),
+		"--jitter-failure-policy=" + c.JitterFailurePolicy.String(),
+		"--jitter-blind-period=" + c.JitterBlindPeriod.String(),
+		"--jitter-blind-duty=" + strconv.Itoa(c.JitterBlindDuty),
+		"--jitter-config=" + c.JitterConfig,
+		"--jitter-symbolize=" + strconv.FormatBool(c.JitterSymbolize),
+		"--jitter-symbol-rules=" + c.JitterSymbolRules.String(),
+		"--jitter-calendar=" + c.JitterCalendar.String(),
+		"--jitter-profile-dir=" + c.JitterProfileDir,
+		"--jitter-exit-report=" + c.JitterExitReport,
+		"--jitter-chaos=" + strconv.FormatBool(c.JitterChaos),
+		"--jitter-fair-turns=" + strconv.FormatBool(c.JitterFairTurns),
+		"--jitter-widen-radius=" + strconv.Itoa(c.JitterWidenRadius),
+		"--jitter-shuffle-interval=" + c.JitterShuffleInterval.String(),
+		"--jitter-page-tier=" + c.JitterPageTier.String(),
+		"--jitter-page-tier-interval=" + c.JitterPageTierInterval.String(),
+		"--jitter-line-tier=" + strconv.FormatBool(c.JitterLineTier),
+		"--jitter-load-cpu=" + strconv.FormatFloat(c.JitterLoadLimits.CPU, 'g', -1, 64),
+		"--jitter-load-pressure=" + strconv.FormatFloat(c.JitterLoadLimits.Pressure, 'g', -1, 64),
+		"--jitter-load-action=" + c.JitterLoadAction.String(),
+		"--jitter-cpu-compensation=" + strconv.FormatBool(c.JitterCPUCompensation),
+		"--jitter-alert=" + c.JitterAlert,
+		"--jitter-io-uring=" + strconv.FormatBool(c.JitterIOUring),
 	}
 	if c.CPUNumFromQuota {
 		f = append(f, "--cpu-num-from-quota")
@@ -23,6 +23,7 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"gvisor.dev/gvisor/pkg/control/server"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
@@ -87,6 +88,45 @@ const (
 	// the sandbox and return its ExitStatus.
 	ContainerWaitPID = "containerManager.WaitPID"
 
+	// JitterConfig is used by the jitter daemon to get the configuration
+	// the sandbox was created with.
+	JitterConfig = "jitter.Config"
+
+	// JitterReconnect is used by the Cijitter monitor to hand the sandbox a
+	// new address pipe after the previous one broke.
+	JitterReconnect = "jitter.Reconnect"
+
+	// JitterStats is used to get the delay statistics of the sandbox.
+	JitterStats = "jitter.Stats"
+
+	// JitterHeavyHitters is used to get the pages the monitor sampled the
+	// most over the life of the container.
+	JitterHeavyHitters = "jitter.HeavyHitters"
+
+	// JitterReload is used to change the jitter parameters of the sandbox
+	// while it runs.
+	JitterReload = "jitter.Reload"
+
+	// JitterMonitor is used to get whether the sandbox hears from its
+	// jitter monitor.
+	JitterMonitor = "jitter.Monitor"
+
+	// JitterSymbolize is used to resolve sampled addresses to the
+	// application mappings that contain them.
+	JitterSymbolize = "jitter.Symbolize"
+
+	// JitterPreload is used to mark the regions of a learned profile as
+	// secret.
+	JitterPreload = "jitter.Preload"
+
+	// JitterInject is used to apply a recorded or fuzzed stream of monitor
+	// messages.
+	JitterInject = "jitter.Inject"
+
+	// JitterExecs is used to get the processes exec'd in a container that
+	// match the jitter target policy.
+	JitterExecs = "jitter.Execs"
+
 	// NetworkCreateLinksAndRoutes is the URPC endpoint for creating links
 	// and routes in a network stack.
 	NetworkCreateLinksAndRoutes = "Network.CreateLinksAndRoutes"
@@ -154,6 +194,7 @@ func newController(fd int, l *Loader) (*controller, error) {
 	}
 
 	srv.Register(&debug{})
+	srv.Register(&jitter{conf: l.root.conf, l: l})
 	srv.Register(&control.Logging{})
 	if l.root.conf.ProfileEnable {
 		srv.Register(&control.Profile{
@@ -280,6 +321,9 @@ func (cm *containerManager) ExecuteAsync(args *control.ExecArgs, pid *int32) err
 // Checkpoint pauses a sandbox and saves its state.
 func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Checkpoint")
+	// Don't delay or sample the sandbox while it is saved.
+	maid.Suspend()
+	defer maid.Unsuspend()
 	state := control.State{
 		Kernel:   cm.l.k,
 		Watchdog: cm.l.watchdog,
@@ -290,6 +334,7 @@ func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 // Pause suspends a container.
 func (cm *containerManager) Pause(_, _ *struct{}) error {
 	log.Debugf("containerManager.Pause")
+	maid.Suspend()
 	cm.l.k.Pause()
 	return nil
 }
@@ -392,6 +437,7 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 
 	// Change the loader fields to reflect the changes made when restoring.
 	cm.l.k = k
+	setJitterTranslator(cm.l.root.conf, k)
 	cm.l.watchdog = dog
 	cm.l.root.procArgs = kernel.CreateProcessArgs{}
 	cm.l.restore = true
@@ -421,6 +467,7 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 func (cm *containerManager) Resume(_, _ *struct{}) error {
 	log.Debugf("containerManager.Resume")
 	cm.l.k.Unpause()
+	maid.Unsuspend()
 	return nil
 }
 
@@ -0,0 +1,42 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// jitterPerfFilters returns extra syscalls made by the in-sandbox jitter
+// sampler. Its perf events are opened and mapped before filters are
+// installed, so it only enables and disables them.
+func jitterPerfFilters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		syscall.SYS_IOCTL: []seccomp.Rule{
+			{
+				seccomp.AllowAny{},
+				seccomp.AllowValue(unix.PERF_EVENT_IOC_ENABLE),
+				seccomp.AllowValue(0),
+			},
+			{
+				seccomp.AllowAny{},
+				seccomp.AllowValue(unix.PERF_EVENT_IOC_DISABLE),
+				seccomp.AllowValue(0),
+			},
+		},
+	}
+}
@@ -29,6 +29,7 @@ type Options struct {
 	HostNetwork   bool
 	ProfileEnable bool
 	ControllerFD  int
+	JitterPerf    bool
 }
 
 // Install installs seccomp filters for based on the given platform.
@@ -48,6 +49,10 @@ func Install(opt Options) error {
 		Report("profile enabled: syscall filters less restrictive!")
 		s.Merge(profileFilters())
 	}
+	if opt.JitterPerf {
+		Report("in-sandbox jitter sampling enabled: syscall filters less restrictive!")
+		s.Merge(jitterPerfFilters())
+	}
 
 	s.Merge(opt.Platform.SyscallFilters())
 
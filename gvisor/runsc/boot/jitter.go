@@ -0,0 +1,208 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/unet"
+	"gvisor.dev/gvisor/pkg/urpc"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// JitterImageAnnotation is the spec annotation that names the image of a
+// container, to key its learned profile.
+const JitterImageAnnotation = "dev.cijitter.image"
+
+// jitter exposes the Cijitter control endpoints used by the monitor.
+type jitter struct {
+	// conf is the configuration of the sandbox.
+	conf *Config
+
+	// l is the loader of the sandbox.
+	l *Loader
+}
+
+// JitterReconnectArgs are arguments to the Reconnect method.
+type JitterReconnectArgs struct {
+	// FilePayload contains the read end of the new address pipe.
+	urpc.FilePayload
+}
+
+// Reconnect hands a new address pipe to the in-sandbox listener, replacing
+// the one that broke.
+func (*jitter) Reconnect(args *JitterReconnectArgs, _ *struct{}) error {
+	log.Debugf("jitter.Reconnect")
+	if len(args.FilePayload.Files) != 1 {
+		return fmt.Errorf("reconnect requires exactly one file, got %d", len(args.FilePayload.Files))
+	}
+	maid.SetAddrPipe(args.FilePayload.Files[0])
+	return nil
+}
+
+// Config returns the configuration the sandbox was created with.
+func (j *jitter) Config(_ *struct{}, out *Config) error {
+	log.Debugf("jitter.Config")
+	*out = *j.conf
+	return nil
+}
+
+// Execs returns the PIDs of the live processes exec'd in container cid that
+// match the jitter target policy of the sandbox.
+func (j *jitter) Execs(cid *string, out *[]kernel.ThreadID) error {
+	log.Debugf("jitter.Execs")
+	*out = j.l.jitterExecs(*cid, j.conf.JitterTargetPolicy)
+	return nil
+}
+
+// Stats returns the delay statistics of the sandbox.
+func (*jitter) Stats(_ *struct{}, out *maid.Stats) error {
+	log.Debugf("jitter.Stats")
+	*out = maid.CurrentStats()
+	return nil
+}
+
+// HeavyHitters returns the pages the monitor sampled the most over the life
+// of the container, most accessed first, with their estimated access counts.
+// Addresses are as the monitor sampled them.
+func (*jitter) HeavyHitters(_ *struct{}, out *[]maid.Target) error {
+	log.Debugf("jitter.HeavyHitters")
+	*out = maid.CurrentHeavyHitters()
+	return nil
+}
+
+// Symbolize resolves addresses, as the monitor samples them, to the
+// application mappings that contain them.
+func (*jitter) Symbolize(addrs *[]usermem.Addr, out *[]maid.Symbol) error {
+	log.Debugf("jitter.Symbolize: %d addresses", len(*addrs))
+	if len(*addrs) > maid.MaxBatchTargets {
+		return fmt.Errorf("at most %d addresses can be symbolized at once, got %d", maid.MaxBatchTargets, len(*addrs))
+	}
+	*out = maid.Symbolize(*addrs)
+	return nil
+}
+
+// Preload marks the regions of a learned profile, given by mapping and
+// offset, as secret. out is the number of regions mapped so far.
+func (*jitter) Preload(regions *[]maid.Symbol, out *int) error {
+	log.Debugf("jitter.Preload: %d regions", len(*regions))
+	if len(*regions) > maid.MaxSecretPages {
+		return fmt.Errorf("at most %d regions can be preloaded, got %d", maid.MaxSecretPages, len(*regions))
+	}
+	*out = maid.Preload(*regions)
+	return nil
+}
+
+// Inject applies a stream of encoded monitor messages, as if the monitor sent
+// them, e.g. to replay a fuzzing corpus.
+func (*jitter) Inject(data *[]byte, out *maid.InjectResult) error {
+	log.Debugf("jitter.Inject: %d bytes", len(*data))
+	if len(*data) > maid.MaxInjectBytes {
+		return fmt.Errorf("at most %d bytes can be injected at once, got %d", maid.MaxInjectBytes, len(*data))
+	}
+	*out = maid.Inject(*data)
+	return nil
+}
+
+// Monitor returns whether the sandbox hears from its monitor.
+func (*jitter) Monitor(_ *struct{}, out *maid.MonitorHealth) error {
+	log.Debugf("jitter.Monitor")
+	*out = maid.CurrentMonitorHealth()
+	return nil
+}
+
+// Reload applies new jitter parameters to the sandbox.
+func (*jitter) Reload(args *maid.Tunables, _ *struct{}) error {
+	log.Debugf("jitter.Reload: %+v", *args)
+	if err := maid.Reload(args); err != nil {
+		return err
+	}
+	log.Infof("[Cijitter] jitter parameters reloaded: %+v", *args)
+	return nil
+}
+
+// JitterTunables returns the jitter parameters of c that can be changed while
+// the sandbox runs.
+func (c *Config) JitterTunables() maid.Tunables {
+	return maid.Tunables{
+		Primitive:       c.JitterDelayPrimitive,
+		Scope:           c.JitterDelayScope,
+		Wait:            c.JitterDelayWait,
+		SyscallDelay:    c.JitterSyscallDelay,
+		PreemptInterval: c.JitterPreemptInterval,
+		DelayBudget:     c.JitterDelayBudget,
+		WidenRadius:     c.JitterWidenRadius,
+		Thresholds:      c.JitterThresholds,
+		Hysteresis:      c.JitterHysteresis,
+		Backoff:         c.JitterBackoff,
+		Compensation:    c.JitterCompensation,
+		SymbolRules:     c.JitterSymbolRules,
+		Calendar:        c.JitterCalendar,
+	}
+}
+
+// serveJitterControl serves the control server on the connection at fd,
+// which the monitor holds the other end of. The monitor runs in its own
+// network namespace, where the abstract control socket can't be reached. fd
+// is ignored if negative.
+func serveJitterControl(ctrl *controller, fd int) error {
+	if fd < 0 {
+		return nil
+	}
+	conn, err := unet.NewSocket(fd)
+	if err != nil {
+		return err
+	}
+	ctrl.srv.HandleConn(conn)
+	return nil
+}
+
+// reportJitter logs the exit report of the sandbox on the exit of container
+// cid, and appends it to f as a line of JSON unless f is nil.
+func reportJitter(cid string, f *os.File) {
+	r := maid.CurrentReport(cid)
+	log.Infof("[Cijitter] %v", r)
+	if f == nil {
+		return
+	}
+	if err := json.NewEncoder(f).Encode(r); err != nil {
+		log.Warningf("[Cijitter] writing the exit report: %v", err)
+	}
+}
+
+// startJitterListener applies the messages the monitor sends through the
+// address pipe at fd. The pipe is passed with --addr-fd, so its number depends
+// on the other files donated to the sandbox, e.g. the gofer mounts. It returns
+// a function stopping the listener and closing the pipe.
+func startJitterListener(fd int) func() {
+	var pipe *os.File
+	if fd < 0 {
+		log.Infof("[Cijitter] No address pipe, waiting for the monitor to connect")
+	} else {
+		pipe = os.NewFile(uintptr(fd), "jitter addr pipe")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		maid.Listen(ctx, pipe)
+		log.Debugf("[Cijitter] Addr listener finished")
+	}()
+	return cancel
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// jitterFaultSampler samples the sandbox with the application page faults the
+// sentry handles, replacing the monitor process. Before each sample, it
+// unmaps the application from the platform address spaces, so that every
+// page touched during the sample faults once and is counted by
+// maid.CountFault.
+//
+// Unlike jitterPerfSampler, it needs no perf events, and hence no seccomp
+// exception, and no host kernel module. Counts are of pages touched rather
+// than accesses, and the workload pays for a fault on every page it touches
+// after each re-arm.
+type jitterFaultSampler struct {
+	k *kernel.Kernel
+
+	// done is closed to stop sampling.
+	done chan struct{}
+}
+
+// newJitterFaultSampler returns a sampler of the page faults of k.
+func newJitterFaultSampler(k *kernel.Kernel) *jitterFaultSampler {
+	log.Infof("[Cijitter] sampling the page faults handled by the sentry")
+	return &jitterFaultSampler{k: k, done: make(chan struct{})}
+}
+
+// run samples the sandbox and submits the hottest pages to the scheduler
+// until stop is called. warmUp is how long to wait before the first sample.
+func (s *jitterFaultSampler) run(warmUp time.Duration) {
+	for s.wait(warmUp) {
+		if batch := s.sample(jitterPerfSampleDuration); len(batch) != 0 {
+			ack := maid.Listen_target_addrs(maid.NewSamplesMessage(batch))
+			if ack.Err != "" {
+				log.Debugf("[Cijitter] samples rejected: %s", ack.Err)
+			}
+		}
+		warmUp = maid.SampleInterval
+	}
+}
+
+// wait waits for d and returns false if sampling was stopped meanwhile.
+func (s *jitterFaultSampler) wait(d time.Duration) bool {
+	select {
+	case <-s.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// stop stops sampling.
+func (s *jitterFaultSampler) stop() {
+	close(s.done)
+}
+
+// sample counts the page faults of the sandbox for d and returns the pages
+// that faulted most, most first.
+func (s *jitterFaultSampler) sample(d time.Duration) []maid.Target {
+	maid.StartFaultCount()
+	s.k.RearmFaults()
+	time.Sleep(d)
+	return maid.StopFaultCount(jitterPerfBatchSize)
+}
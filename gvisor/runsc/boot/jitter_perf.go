@@ -0,0 +1,259 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	// jitterPerfRingPages is the number of data pages of the ring buffer
+	// of each CPU.
+	jitterPerfRingPages = 64
+
+	// jitterPerfSampleDuration is how long the sandbox is sampled for each
+	// cycle, as the monitor does.
+	jitterPerfSampleDuration = 100 * time.Millisecond
+
+	// jitterPerfBatchSize is the number of hottest pages handed to the
+	// scheduler each cycle.
+	jitterPerfBatchSize = 8
+)
+
+// jitterPerfSampler samples the page faults of the sandbox from within the
+// boot process, replacing the monitor process.
+//
+// All perf events are opened and their ring buffers mapped before the
+// seccomp filters are installed. Afterwards, sampling only needs to enable
+// and disable the events with ioctl(2) and read the ring buffers, which are
+// plain memory. Events are opened per CPU on every thread with inherit set,
+// so that threads created later, e.g. for the application, are sampled too.
+// All the events of a CPU write to the ring buffer of the first one.
+type jitterPerfSampler struct {
+	// fds are the file descriptors of all the events, which are enabled
+	// and disabled together.
+	fds []int
+
+	// rings are the ring buffers of each CPU.
+	rings []*jitterPerfRing
+
+	// done is closed to stop sampling.
+	done chan struct{}
+}
+
+// jitterPerfRing is the ring buffer the events of a CPU write to.
+type jitterPerfRing struct {
+	// mem is the mapping of the metadata page followed by the data pages.
+	mem []byte
+
+	// tail is the offset of the next record to read in the data pages.
+	tail uint64
+}
+
+// newJitterPerfSampler opens the perf events of the in-sandbox sampler. It
+// must be called before the seccomp filters are installed.
+func newJitterPerfSampler() (*jitterPerfSampler, error) {
+	tids, err := jitterPerfThreads()
+	if err != nil {
+		return nil, err
+	}
+	var cpus unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &cpus); err != nil {
+		return nil, fmt.Errorf("getting CPU affinity: %v", err)
+	}
+
+	s := &jitterPerfSampler{done: make(chan struct{})}
+	for cpu, left := 0, cpus.Count(); left > 0; cpu++ {
+		if !cpus.IsSet(cpu) {
+			continue
+		}
+		left--
+		leader := -1
+		for _, tid := range tids {
+			fd, err := openJitterPerfEvent(tid, cpu)
+			if err != nil {
+				s.close()
+				return nil, fmt.Errorf("opening perf event on thread %d, CPU %d: %v", tid, cpu, err)
+			}
+			s.fds = append(s.fds, fd)
+			if leader < 0 {
+				ring, err := mapJitterPerfRing(fd)
+				if err != nil {
+					s.close()
+					return nil, err
+				}
+				s.rings = append(s.rings, ring)
+				leader = fd
+				continue
+			}
+			if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_SET_OUTPUT, leader); err != nil {
+				s.close()
+				return nil, fmt.Errorf("redirecting perf event output: %v", err)
+			}
+		}
+	}
+	if len(s.rings) == 0 {
+		return nil, fmt.Errorf("no CPU to sample on")
+	}
+	log.Infof("[Cijitter] sampling page faults in the sandbox with %d perf events on %d threads", len(s.fds), len(tids))
+	return s, nil
+}
+
+// jitterPerfThreads returns the IDs of the threads of the boot process.
+func jitterPerfThreads() ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return nil, fmt.Errorf("listing threads: %v", err)
+	}
+	tids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
+
+// run samples the sandbox and submits the hottest pages to the scheduler
+// until stop is called. warmUp is how long to wait before the first sample.
+func (s *jitterPerfSampler) run(warmUp time.Duration) {
+	for s.wait(warmUp) {
+		if batch, err := s.sample(jitterPerfSampleDuration); err != nil {
+			log.Warningf("[Cijitter] sampling the sandbox failed: %v", err)
+		} else if len(batch) != 0 {
+			ack := maid.Listen_target_addrs(maid.NewSamplesMessage(batch))
+			if ack.Err != "" {
+				log.Debugf("[Cijitter] samples rejected: %s", ack.Err)
+			}
+		}
+		warmUp = maid.SampleInterval
+	}
+}
+
+// wait waits for d and returns false if sampling was stopped meanwhile.
+func (s *jitterPerfSampler) wait(d time.Duration) bool {
+	select {
+	case <-s.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// stop stops sampling. The events are left open, they are released when the
+// sandbox exits.
+func (s *jitterPerfSampler) stop() {
+	close(s.done)
+}
+
+// sample samples the page faults of the sandbox for d and returns the
+// hottest pages, hottest first.
+func (s *jitterPerfSampler) sample(d time.Duration) ([]maid.Target, error) {
+	if err := s.ioctl(unix.PERF_EVENT_IOC_ENABLE); err != nil {
+		return nil, err
+	}
+	time.Sleep(d)
+	if err := s.ioctl(unix.PERF_EVENT_IOC_DISABLE); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[usermem.Addr]int)
+	for _, r := range s.rings {
+		r.drain(func(addr uint64) {
+			counts[usermem.Addr(addr).RoundDown()]++
+		})
+	}
+
+	batch := make([]maid.Target, 0, len(counts))
+	for page, n := range counts {
+		batch = append(batch, maid.Target{Addr: page, Accesses: n})
+	}
+	sort.Slice(batch, func(i, j int) bool {
+		if batch[i].Accesses != batch[j].Accesses {
+			return batch[i].Accesses > batch[j].Accesses
+		}
+		return batch[i].Addr < batch[j].Addr
+	})
+	if len(batch) > jitterPerfBatchSize {
+		batch = batch[:jitterPerfBatchSize]
+	}
+	return batch, nil
+}
+
+// ioctl issues req on every event. Enabling and disabling an event also
+// applies to the events inherited from it.
+func (s *jitterPerfSampler) ioctl(req uint) error {
+	for _, fd := range s.fds {
+		if err := unix.IoctlSetInt(fd, req, 0); err != nil {
+			return fmt.Errorf("perf event ioctl %#x: %v", req, err)
+		}
+	}
+	return nil
+}
+
+// close releases the events and their ring buffers.
+func (s *jitterPerfSampler) close() {
+	for _, r := range s.rings {
+		unix.Munmap(r.mem)
+	}
+	for _, fd := range s.fds {
+		unix.Close(fd)
+	}
+}
+
+// jitterPerfHeaderSize is the size of struct perf_event_header.
+const jitterPerfHeaderSize = 8
+
+// drain calls fn with the address of each sample in the ring buffer and
+// gives the space back to the kernel.
+func (r *jitterPerfRing) drain(fn func(addr uint64)) {
+	data := r.mem[usermem.PageSize:]
+	head := r.dataHead()
+	for r.tail+jitterPerfHeaderSize <= head {
+		hdr := r.read(data, r.tail, jitterPerfHeaderSize)
+		typ := usermem.ByteOrder.Uint32(hdr[0:4])
+		size := uint64(usermem.ByteOrder.Uint16(hdr[6:8]))
+		if size == 0 {
+			break
+		}
+		// With PERF_SAMPLE_ADDR only, the sample is just the address.
+		if typ == unix.PERF_RECORD_SAMPLE && size >= jitterPerfHeaderSize+8 {
+			fn(usermem.ByteOrder.Uint64(r.read(data, r.tail+jitterPerfHeaderSize, 8)))
+		}
+		r.tail += size
+	}
+	r.setDataTail(r.tail)
+}
+
+// read copies n bytes at off from the ring buffer data, which may wrap
+// around.
+func (r *jitterPerfRing) read(data []byte, off uint64, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = data[(off+uint64(i))%uint64(len(data))]
+	}
+	return b
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Offsets of data_head and data_tail in struct perf_event_mmap_page.
+const (
+	jitterPerfDataHeadOffset = 1024
+	jitterPerfDataTailOffset = 1032
+)
+
+// openJitterPerfEvent opens a disabled page fault sampling event on thread
+// tid and CPU cpu, which threads created by tid inherit.
+func openJitterPerfEvent(tid, cpu int) (int, error) {
+	attr := unix.PerfEventAttr{
+		Type:        unix.PERF_TYPE_SOFTWARE,
+		Config:      unix.PERF_COUNT_SW_PAGE_FAULTS,
+		Sample:      1,
+		Sample_type: unix.PERF_SAMPLE_ADDR,
+		Bits:        unix.PerfBitDisabled | unix.PerfBitInherit | unix.PerfBitExcludeKernel | unix.PerfBitExcludeHv,
+	}
+	attr.Size = uint32(unsafe.Sizeof(attr))
+	return unix.PerfEventOpen(&attr, tid, cpu, -1 /* groupFd */, unix.PERF_FLAG_FD_CLOEXEC)
+}
+
+// mapJitterPerfRing maps the ring buffer of the event fd.
+func mapJitterPerfRing(fd int) (*jitterPerfRing, error) {
+	mem, err := unix.Mmap(fd, 0, (1+jitterPerfRingPages)*usermem.PageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("mapping perf ring buffer: %v", err)
+	}
+	return &jitterPerfRing{mem: mem}, nil
+}
+
+// dataHead returns the offset up to which the kernel wrote records.
+func (r *jitterPerfRing) dataHead() uint64 {
+	return atomic.LoadUint64((*uint64)(unsafe.Pointer(&r.mem[jitterPerfDataHeadOffset])))
+}
+
+// setDataTail tells the kernel that records up to tail were consumed.
+func (r *jitterPerfRing) setDataTail(tail uint64) {
+	atomic.StoreUint64((*uint64)(unsafe.Pointer(&r.mem[jitterPerfDataTailOffset])), tail)
+}
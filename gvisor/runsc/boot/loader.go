@@ -20,6 +20,7 @@ import (
 	mrand "math/rand"
 	"os"
 	"runtime"
+	"sort"
 	"sync/atomic"
 	"syscall"
 	gtime "time"
@@ -30,6 +31,7 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/cpuid"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
 	"gvisor.dev/gvisor/pkg/memutil"
 	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
@@ -106,6 +108,37 @@ type Loader struct {
 
 	watchdog *watchdog.Watchdog
 
+	// heartbeat checks that the jitter monitor is alive. It is nil if
+	// heartbeats are disabled.
+	heartbeat *maid.HeartbeatChecker
+
+	// scheduler runs the kernel's jitter policy when delays are scheduled
+	// by the sentry. It is nil otherwise.
+	scheduler *maid.Scheduler
+
+	// jitterPerf samples the sandbox from within the boot process when
+	// the monitor runs in the sandbox. It is nil otherwise.
+	jitterPerf *jitterPerfSampler
+
+	// jitterFaults samples the sandbox with the page faults of the sentry
+	// when the monitor runs in the sandbox with JitterSamplerSentry. It is
+	// nil otherwise.
+	jitterFaults *jitterFaultSampler
+
+	// stopJitterListener stops applying the messages of the monitor and
+	// closes the address pipe.
+	stopJitterListener func()
+
+	// jitterReportMu guards jitterReport, which containers exiting
+	// concurrently append to.
+	jitterReportMu sync.Mutex
+
+	// jitterReport is the file the exit reports are appended to. It is
+	// nil if the reports are only logged.
+	//
+	// jitterReport is guarded by jitterReportMu.
+	jitterReport *os.File
+
 	// stopSignalForwarding disables forwarding of signals to the sandboxed
 	// container. It should be called when a sandbox is destroyed.
 	stopSignalForwarding func()
@@ -150,6 +183,11 @@ type execProcess struct {
 
 	// pidnsPath is the pid namespace path in spec
 	pidnsPath string
+
+	// argv and envv are the arguments and environment of a process
+	// started with exec, matched against the jitter target policy.
+	argv []string
+	envv []string
 }
 
 func init() {
@@ -186,6 +224,14 @@ type Args struct {
 	UserLogFD int
 
 	AddrFD int
+
+	// JitterControlFD is the sandbox end of a connection to the control
+	// server donated to the jitter monitor, or -1.
+	JitterControlFD int
+
+	// JitterReportFD is the file the jitter exit report is appended to, or
+	// -1.
+	JitterReportFD int
 }
 
 // make sure stdioFDs are always the same on initial start and on restore
@@ -248,6 +294,9 @@ func New(args Args) (*Loader, error) {
 	if err := enableStrace(args.Conf); err != nil {
 		return nil, fmt.Errorf("enabling strace: %v", err)
 	}
+	if err := enableSyscallJitter(args.Conf); err != nil {
+		return nil, fmt.Errorf("enabling syscall jitter: %v", err)
+	}
 
 	// Create root network namespace/stack.
 	netns, err := newRootNetworkNamespace(args.Conf, k, k)
@@ -328,6 +377,26 @@ func New(args Args) (*Loader, error) {
 	dogOpts.TaskTimeoutAction = args.Conf.WatchdogAction
 	dog := watchdog.New(k, dogOpts)
 
+	maid.SetDelayPrimitive(args.Conf.JitterDelayPrimitive)
+	maid.SetDelayScope(args.Conf.JitterDelayScope)
+	maid.SetDeferLockHolders(args.Conf.JitterDeferLockHolders)
+	maid.SetSplitHugePages(args.Conf.JitterSplitHugePages)
+	maid.SetDecoys(args.Conf.JitterDecoyMode, args.Conf.JitterDecoyAddrs, args.Conf.JitterDecoyInterval)
+	maid.SetPreemptInterval(args.Conf.JitterPreemptInterval)
+	maid.SetDelayBudget(args.Conf.JitterDelayBudget)
+	maid.SetWidenRadius(args.Conf.JitterWidenRadius)
+	maid.SetShuffleInterval(args.Conf.JitterShuffleInterval)
+	maid.SetPageTier(maid.PageTier{Primitive: args.Conf.JitterPageTier, Interval: args.Conf.JitterPageTierInterval})
+	maid.SetLineTier(args.Conf.JitterLineTier)
+	maid.SetEntropyMapping(args.Conf.JitterEntropy)
+	setJitterTranslator(args.Conf, k)
+	k.SetClockFuzz(args.Conf.JitterClockFuzzRealtime, args.Conf.JitterClockFuzzMonotonic)
+
+	var heartbeat *maid.HeartbeatChecker
+	if args.Conf.Jitter && !args.Conf.JitterInSandbox && args.Conf.JitterHeartbeatInterval > 0 {
+		heartbeat = maid.NewHeartbeatChecker(args.Conf.JitterHeartbeatInterval, args.Conf.JitterHeartbeatAction, dog.Report)
+	}
+
 	procArgs, err := createProcessArgs(args.ID, args.Spec, creds, k, k.RootPIDNamespace())
 	if err != nil {
 		return nil, fmt.Errorf("creating init process for root container: %v", err)
@@ -378,6 +447,7 @@ func New(args Args) (*Loader, error) {
 	l := &Loader{
 		k:          k,
 		watchdog:   dog,
+		heartbeat:  heartbeat,
 		sandboxID:  args.ID,
 		processes:  map[execID]*execProcess{eid: {}},
 		mountHints: mountHints,
@@ -412,6 +482,14 @@ func New(args Args) (*Loader, error) {
 		return nil, fmt.Errorf("starting control server: %v", err)
 	}
 
+	if err := serveJitterControl(ctrl, args.JitterControlFD); err != nil {
+		return nil, fmt.Errorf("[Cijitter] serving the monitor control connection: %v", err)
+	}
+	l.stopJitterListener = startJitterListener(args.AddrFD)
+	if args.JitterReportFD >= 0 {
+		l.jitterReport = os.NewFile(uintptr(args.JitterReportFD), "jitter exit report")
+	}
+
 	return l, nil
 }
 
@@ -460,6 +538,28 @@ func (l *Loader) Destroy() {
 		l.stopSignalForwarding()
 	}
 	l.watchdog.Stop()
+	if l.heartbeat != nil {
+		l.heartbeat.Stop()
+	}
+	if l.jitterPerf != nil {
+		l.jitterPerf.stop()
+	}
+	if l.jitterFaults != nil {
+		l.jitterFaults.stop()
+	}
+	if l.stopJitterListener != nil {
+		l.stopJitterListener()
+	}
+	l.jitterReportMu.Lock()
+	if l.jitterReport != nil {
+		l.jitterReport.Close()
+		l.jitterReport = nil
+	}
+	l.jitterReportMu.Unlock()
+	if l.scheduler != nil {
+		maid.SetScheduler(nil)
+		l.scheduler.Stop()
+	}
 }
 
 func createPlatform(conf *Config, deviceFile *os.File) (platform.Platform, error) {
@@ -490,6 +590,15 @@ func createMemoryFile() (*pgalloc.MemoryFile, error) {
 }
 
 func (l *Loader) installSeccompFilters() error {
+	if l.root.conf.Jitter && l.root.conf.JitterInSandbox && l.root.conf.JitterSampler != JitterSamplerSentry {
+		// The sampler's perf events can't be opened once filters are
+		// installed.
+		s, err := newJitterPerfSampler()
+		if err != nil {
+			return fmt.Errorf("[Cijitter] opening the in-sandbox sampler: %v", err)
+		}
+		l.jitterPerf = s
+	}
 	if l.root.conf.DisableSeccomp {
 		filter.Report("syscall filter is DISABLED. Running in less secure mode.")
 	} else {
@@ -498,6 +607,7 @@ func (l *Loader) installSeccompFilters() error {
 			HostNetwork:   l.root.conf.Network == NetworkHost,
 			ProfileEnable: l.root.conf.ProfileEnable,
 			ControllerFD:  l.ctrl.srv.FD(),
+			JitterPerf:    l.jitterPerf != nil,
 		}
 		if err := filter.Install(opts); err != nil {
 			return fmt.Errorf("installing seccomp filters: %v", err)
@@ -521,6 +631,26 @@ func (l *Loader) Run() error {
 	return nil
 }
 
+// setJitterTranslator has maid translate the targets sampled by the monitor
+// to application addresses on platforms where the application runs inside the
+// sentry, so that the monitor samples the sentry, bounds targets to the
+// application address space, drops those no address space maps and resolves
+// them to application mappings. The sentry's own fault sampler samples
+// application addresses already.
+//
+// Delays need nothing else from KVM: MProtect revokes the page in the guest
+// page tables of the address space, leaving EPT untouched, and the vCPU page
+// fault comes back as ErrContextSignal to the same fault handler as ptrace.
+func setJitterTranslator(conf *Config, k *kernel.Kernel) {
+	if conf.Platform == "kvm" && !(conf.JitterInSandbox && conf.JitterSampler == JitterSamplerSentry) {
+		maid.SetAddrTranslator(k.AppAddrOfSentryAddr)
+	}
+	maid.SetAddrSpace(k.MinUserAddress(), k.MaxUserAddress())
+	maid.SetAddrValidator(k.IsAppAddrMapped)
+	maid.SetAddrSymbolizer(k.MappingOfAppAddr)
+	maid.SetMappingResolver(k.AppAddrOfMapping)
+}
+
 func (l *Loader) run() error {
 	if l.root.conf.Network == NetworkHost {
 		// Delay host network configuration to this point because network namespace
@@ -603,6 +733,44 @@ func (l *Loader) run() error {
 
 	log.Infof("Process should have started...")
 	l.watchdog.Start()
+	if l.heartbeat != nil {
+		l.heartbeat.Start()
+	}
+	if l.restore {
+		maid.RestoreState(l.k.JitterState)
+	}
+	maid.SetStarted(l.restore)
+	if l.root.conf.JitterScheduling == JitterSchedulingSentry {
+		// A restored kernel carries the policy it was saved with.
+		if l.k.JitterPolicy == nil {
+			l.k.JitterPolicy = maid.NewPolicy()
+			l.k.JitterPolicy.SetBackoff(l.root.conf.JitterBackoff)
+			l.k.JitterPolicy.SetCompensation(l.root.conf.JitterCompensation)
+			l.k.JitterPolicy.SetWaitMode(l.root.conf.JitterDelayWait)
+			l.k.JitterPolicy.SetThresholds(l.root.conf.JitterThresholds)
+			l.k.JitterPolicy.SetHysteresis(l.root.conf.JitterHysteresis)
+			l.k.JitterPolicy.SetHistoryWindow(l.root.conf.JitterHistoryWindow)
+		}
+		l.scheduler = maid.NewScheduler(l.k.JitterPolicy)
+		maid.SetScheduler(l.scheduler)
+		l.scheduler.Start()
+	}
+	if l.root.conf.Jitter && l.root.conf.JitterInSandbox && l.root.conf.JitterSampler == JitterSamplerSentry {
+		l.jitterFaults = newJitterFaultSampler(l.k)
+	}
+	if l.jitterPerf != nil || l.jitterFaults != nil {
+		// The workload starts with the kernel, there is no exec to wait
+		// for, and a restored workload needs no warm up.
+		warmUp := l.root.conf.JitterWarmUp
+		if l.restore || l.root.conf.JitterStartOnExec {
+			warmUp = 0
+		}
+		if l.jitterPerf != nil {
+			go l.jitterPerf.run(warmUp)
+		} else {
+			go l.jitterFaults.run(warmUp)
+		}
+	}
 	return l.k.Start()
 }
 
@@ -703,6 +871,12 @@ func (l *Loader) startContainer(spec *specs.Spec, conf *Config, cid string, file
 	// Success!
 	l.k.StartProcess(tg)
 	ep.tg = tg
+	if l.root.conf.Jitter {
+		go func() {
+			tg.WaitExited()
+			l.reportJitterExit(cid)
+		}()
+	}
 	return nil
 }
 
@@ -932,12 +1106,38 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 		tg:      newTG,
 		tty:     ttyFile,
 		ttyVFS2: ttyFileVFS2,
+		argv:    args.Argv,
+		envv:    args.Envv,
 	}
 	log.Debugf("updated processes: %v", l.processes)
 
 	return tgid, nil
 }
 
+// jitterExecs returns the PIDs of the processes exec'd in container cid that
+// are still running and match policy.
+func (l *Loader) jitterExecs(cid string, policy JitterTargetPolicy) []kernel.ThreadID {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var pids []kernel.ThreadID
+	for eid, ep := range l.processes {
+		// The init process of the container is matched with its spec.
+		if eid.cid != cid || eid.pid == 0 || ep.tg == nil {
+			continue
+		}
+		if ep.tg.PIDNamespace().IDOfThreadGroup(ep.tg) == 0 {
+			// Already reaped.
+			continue
+		}
+		if policy.MatchesProcess(ep.argv, ep.envv) {
+			pids = append(pids, eid.pid)
+		}
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	return pids
+}
+
 // waitContainer waits for the init process of a container to exit.
 func (l *Loader) waitContainer(cid string, waitStatus *uint32) error {
 	// Don't defer unlock, as doing so would make it impossible for
@@ -1007,10 +1207,22 @@ func (l *Loader) WaitForStartSignal() {
 func (l *Loader) WaitExit() kernel.ExitStatus {
 	// Wait for container.
 	l.k.WaitExited()
+	if l.root.conf.Jitter {
+		// The root container has the ID of the sandbox.
+		l.reportJitterExit(l.sandboxID)
+	}
 
 	return l.k.GlobalInit().ExitStatus()
 }
 
+// reportJitterExit reports the defense activity on the exit of container
+// cid.
+func (l *Loader) reportJitterExit(cid string) {
+	l.jitterReportMu.Lock()
+	defer l.jitterReportMu.Unlock()
+	reportJitter(cid, l.jitterReport)
+}
+
 func newRootNetworkNamespace(conf *Config, clock tcpip.Clock, uniqueID stack.UniqueID) (*inet.Namespace, error) {
 	// Create an empty network stack because the network namespace may be empty at
 	// this point. Netns is configured before Run() is called. Netstack is
@@ -20,11 +20,14 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/link/fdbased"
 	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/delay"
 	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fifo"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.dev/gvisor/pkg/tcpip/network/arp"
@@ -128,6 +131,10 @@ type FDBasedLink struct {
 	LinkAddress        net.HardwareAddr
 	QDisc              QueueingDiscipline
 
+	// JitterDelay bounds the time outbound packets are held for while a
+	// delay window is open. 0 disables it.
+	JitterDelay time.Duration
+
 	// NumChannels controls how many underlying FD's are to be used to
 	// create this endpoint.
 	NumChannels int
@@ -251,6 +258,10 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			log.Infof("Enabling FIFO QDisc on %q", link.Name)
 			linkEP = fifo.New(linkEP, runtime.GOMAXPROCS(0), 1000)
 		}
+		if link.JitterDelay > 0 {
+			log.Infof("[Cijitter] Delaying egress on %q by up to %v during delay windows", link.Name, link.JitterDelay)
+			linkEP = delay.New(linkEP, link.JitterDelay, 1000, maid.WindowOpen)
+		}
 
 		log.Infof("Enabling interface %q with id %d on addresses %+v (%v) w/ %d channels", link.Name, nicID, link.Addresses, mac, link.NumChannels)
 		if err := n.createNICWithAddrs(nicID, link.Name, linkEP, link.Addresses); err != nil {
@@ -15,6 +15,8 @@
 package boot
 
 import (
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/strace"
 )
 
@@ -38,3 +40,26 @@ func enableStrace(conf *Config) error {
 	}
 	return strace.Enable(conf.StraceSyscalls, strace.SinkTypeLog)
 }
+
+// enableSyscallJitter marks the syscalls in conf.JitterSyscalls to be delayed
+// during delay windows. Like strace, syscalls are named by their strace name.
+//
+// Preconditions: enableStrace has been called.
+func enableSyscallJitter(conf *Config) error {
+	maid.SetSyscallDelay(conf.JitterSyscallDelay)
+	if len(conf.JitterSyscalls) == 0 {
+		return nil
+	}
+	for _, table := range kernel.SyscallTables() {
+		sys, ok := strace.Lookup(table.OS, table.Arch)
+		if !ok {
+			continue
+		}
+		sysnos, err := sys.ConvertToSysnoMap(conf.JitterSyscalls)
+		if err != nil {
+			return err
+		}
+		table.FeatureEnable.Enable(kernel.JitterEnable, sysnos, false)
+	}
+	return nil
+}
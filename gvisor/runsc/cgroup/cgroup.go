@@ -141,35 +141,48 @@ func fillFromAncestor(path string) (string, error) {
 // countCpuset returns the number of CPU in a string formatted like:
 // 		"0-2,7,12-14  # bits 0, 1, 2, 7, 12, 13, and 14 set" - man 7 cpuset
 func countCpuset(cpuset string) (int, error) {
-	var count int
+	cpus, err := ParseCpuset(cpuset)
+	if err != nil {
+		return 0, err
+	}
+	return len(cpus), nil
+}
+
+// ParseCpuset returns the CPUs in a string formatted like countCpuset
+// expects, in the order they are listed.
+func ParseCpuset(cpuset string) ([]int, error) {
+	var cpus []int
 	for _, p := range strings.Split(cpuset, ",") {
 		interval := strings.Split(p, "-")
 		switch len(interval) {
 		case 1:
-			if _, err := strconv.Atoi(interval[0]); err != nil {
-				return 0, err
+			cpu, err := strconv.Atoi(interval[0])
+			if err != nil {
+				return nil, err
 			}
-			count++
+			cpus = append(cpus, cpu)
 
 		case 2:
 			start, err := strconv.Atoi(interval[0])
 			if err != nil {
-				return 0, err
+				return nil, err
 			}
 			end, err := strconv.Atoi(interval[1])
 			if err != nil {
-				return 0, err
+				return nil, err
 			}
 			if start < 0 || end < 0 || start > end {
-				return 0, fmt.Errorf("invalid cpuset: %q", p)
+				return nil, fmt.Errorf("invalid cpuset: %q", p)
+			}
+			for cpu := start; cpu <= end; cpu++ {
+				cpus = append(cpus, cpu)
 			}
-			count += end - start + 1
 
 		default:
-			return 0, fmt.Errorf("invalid cpuset: %q", p)
+			return nil, fmt.Errorf("invalid cpuset: %q", p)
 		}
 	}
-	return count, nil
+	return cpus, nil
 }
 
 // LoadPaths loads cgroup paths for given 'pid', may be set to 'self'.
@@ -358,6 +371,26 @@ func (c *Cgroup) CPUQuota() (float64, error) {
 	return float64(quota) / float64(period), nil
 }
 
+// CPUBandwidth returns the CFS quota and period, in microseconds, configured
+// in the cpu controller. The quota is negative if unlimited.
+func (c *Cgroup) CPUBandwidth() (quota, period int64, err error) {
+	path := c.makePath("cpu")
+	q, err := getInt(path, "cpu.cfs_quota_us")
+	if err != nil {
+		return 0, 0, err
+	}
+	p, err := getInt(path, "cpu.cfs_period_us")
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(q), int64(p), nil
+}
+
+// SetCPUQuota sets the CFS quota, in microseconds, of the cpu controller.
+func (c *Cgroup) SetCPUQuota(quota int64) error {
+	return setValue(c.makePath("cpu"), "cpu.cfs_quota_us", strconv.FormatInt(quota, 10))
+}
+
 // NumCPU returns the number of CPUs configured in 'cpuset/cpuset.cpus'.
 func (c *Cgroup) NumCPU() (int, error) {
 	path := c.makePath("cpuset")
@@ -378,6 +411,24 @@ func (c *Cgroup) MemoryLimit() (uint64, error) {
 	return strconv.ParseUint(strings.TrimSpace(limStr), 10, 64)
 }
 
+// Procs returns the PIDs of the processes in the cgroup, as listed in
+// 'cpu/cgroup.procs'.
+func (c *Cgroup) Procs() ([]int, error) {
+	data, err := getValue(c.makePath("cpu"), "cgroup.procs")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, f := range strings.Fields(data) {
+		pid, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PID %q in cgroup.procs: %v", f, err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
 func (c *Cgroup) makePath(controllerName string) string {
 	path := c.Name
 	if parent, ok := c.Parents[controllerName]; ok {
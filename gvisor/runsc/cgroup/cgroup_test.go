@@ -18,6 +18,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -36,6 +37,27 @@ func TestUninstallEnoent(t *testing.T) {
 	}
 }
 
+func TestParseCpuset(t *testing.T) {
+	for _, tc := range []struct {
+		str  string
+		want []int
+	}{
+		{str: "3", want: []int{3}},
+		{str: "0-2,7,12-14", want: []int{0, 1, 2, 7, 12, 13, 14}},
+		{str: "8,1-2", want: []int{8, 1, 2}},
+	} {
+		t.Run(tc.str, func(t *testing.T) {
+			got, err := ParseCpuset(tc.str)
+			if err != nil {
+				t.Fatalf("ParseCpuset(%q) failed: %v", tc.str, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseCpuset(%q) want: %v, got: %v", tc.str, tc.want, got)
+			}
+		})
+	}
+}
+
 func TestCountCpuset(t *testing.T) {
 	for _, tc := range []struct {
 		str   string
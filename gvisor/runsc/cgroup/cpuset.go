@@ -0,0 +1,90 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// sysCPUPath is where the kernel exposes the CPU topology.
+var sysCPUPath = "/sys/devices/system/cpu"
+
+// FormatCpuset returns cpus in the format parsed by ParseCpuset, with
+// consecutive CPUs collapsed into ranges.
+func FormatCpuset(cpus []int) string {
+	sorted := append([]int(nil), cpus...)
+	sort.Ints(sorted)
+	var parts []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] <= sorted[j]+1 {
+			j++
+		}
+		if sorted[i] == sorted[j] {
+			parts = append(parts, strconv.Itoa(sorted[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// CoreCPUs returns cpus with the hyperthread siblings of every CPU added, so
+// that the set is made of whole physical cores.
+func CoreCPUs(cpus []int) ([]int, error) {
+	set := make(map[int]bool)
+	for _, cpu := range cpus {
+		path := filepath.Join(sysCPUPath, fmt.Sprintf("cpu%d", cpu), "topology", "thread_siblings_list")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		siblings, err := ParseCpuset(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+		for _, s := range siblings {
+			set[s] = true
+		}
+	}
+	cores := make([]int, 0, len(set))
+	for cpu := range set {
+		cores = append(cores, cpu)
+	}
+	sort.Ints(cores)
+	return cores, nil
+}
+
+// SetCpuset restricts the cgroup to cpus. If exclusive is true, the CPUs are
+// also reserved: sibling cgroups can't use them.
+func (c *Cgroup) SetCpuset(cpus string, exclusive bool) error {
+	path := c.makePath("cpuset")
+	log.Debugf("Setting cpuset of cgroup %q to %q, exclusive: %t", c.Name, cpus, exclusive)
+	if err := setValue(path, "cpuset.cpus", cpus); err != nil {
+		return err
+	}
+	if exclusive {
+		return setValue(path, "cpuset.cpu_exclusive", "1")
+	}
+	return nil
+}
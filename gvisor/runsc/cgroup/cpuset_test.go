@@ -0,0 +1,75 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+func TestFormatCpuset(t *testing.T) {
+	for _, tc := range []struct {
+		cpus []int
+		want string
+	}{
+		{cpus: []int{3}, want: "3"},
+		{cpus: []int{0, 1, 2, 7, 12, 13, 14}, want: "0-2,7,12-14"},
+		{cpus: []int{9, 8, 1}, want: "1,8-9"},
+		{cpus: []int{4, 4, 5}, want: "4-5"},
+	} {
+		t.Run(tc.want, func(t *testing.T) {
+			if got := FormatCpuset(tc.cpus); got != tc.want {
+				t.Errorf("FormatCpuset(%v) want: %q, got: %q", tc.cpus, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCoreCPUs(t *testing.T) {
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "cpu")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 4 cores with 2 hyperthreads each, CPU n and n+4 are siblings.
+	for cpu := 0; cpu < 8; cpu++ {
+		topo := filepath.Join(dir, fmt.Sprintf("cpu%d", cpu), "topology")
+		if err := os.MkdirAll(topo, 0755); err != nil {
+			t.Fatalf("error creating %s: %v", topo, err)
+		}
+		siblings := fmt.Sprintf("%d,%d\n", cpu%4, cpu%4+4)
+		if err := ioutil.WriteFile(filepath.Join(topo, "thread_siblings_list"), []byte(siblings), 0644); err != nil {
+			t.Fatalf("error writing siblings: %v", err)
+		}
+	}
+	old := sysCPUPath
+	sysCPUPath = dir
+	defer func() { sysCPUPath = old }()
+
+	got, err := CoreCPUs([]int{1, 2, 6})
+	if err != nil {
+		t.Fatalf("CoreCPUs() failed: %v", err)
+	}
+	if want := []int{1, 2, 5, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CoreCPUs() want: %v, got: %v", want, got)
+	}
+}
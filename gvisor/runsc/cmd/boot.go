@@ -89,6 +89,13 @@ type Boot struct {
 
 	//send and recv
 	addrFD int
+
+	// jitterControlFD is the sandbox end of the control connection of the
+	// jitter monitor.
+	jitterControlFD int
+
+	// jitterReportFD is the file the jitter exit report is appended to.
+	jitterReportFD int
 }
 
 // Name implements subcommands.Command.Name.
@@ -124,6 +131,8 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&b.mountsFD, "mounts-fd", -1, "mountsFD is the file descriptor to read list of mounts after they have been resolved (direct paths, no symlinks).")
 	f.BoolVar(&b.attached, "attached", false, "if attached is true, kills the sandbox process when the parent process terminates")
 	f.IntVar(&b.addrFD, "addr-fd", -1, "Cijitter: communicate with gofer and sandbox")
+	f.IntVar(&b.jitterControlFD, "jitter-control-fd", -1, "FD of a connected stream socket the control server also serves, whose peer is the jitter monitor")
+	f.IntVar(&b.jitterReportFD, "jitter-report-fd", -1, "FD of the file the jitter exit report is appended to")
 }
 
 // Execute implements subcommands.Command.Execute.  It starts a sandbox in a
@@ -233,6 +242,8 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		UserLogFD:    b.userLogFD,
 		//LIZHI
 		AddrFD:		  b.addrFD,
+		JitterControlFD: b.jitterControlFD,
+		JitterReportFD:  b.jitterReportFD,
 	}
 	l, err := boot.New(bootArgs)
 	if err != nil {
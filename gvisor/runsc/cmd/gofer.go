@@ -173,8 +173,10 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	// Start with root mount, then add any other additional mount as needed.
 	ats := make([]p9.Attacher, 0, len(spec.Mounts)+1)
 	ap, err := fsgofer.NewAttachPoint("/", fsgofer.Config{
-		ROMount:      spec.Root.Readonly || conf.Overlay,
-		PanicOnWrite: g.panicOnWrite,
+		ROMount:       spec.Root.Readonly || conf.Overlay,
+		PanicOnWrite:  g.panicOnWrite,
+		IODelay:       conf.JitterGoferDelay,
+		IOHotAccesses: conf.JitterGoferHotAccesses,
 	})
 	if err != nil {
 		Fatalf("creating attach point: %v", err)
@@ -186,9 +188,11 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	for _, m := range spec.Mounts {
 		if specutils.Is9PMount(m) {
 			cfg := fsgofer.Config{
-				ROMount:      isReadonlyMount(m.Options) || conf.Overlay,
-				PanicOnWrite: g.panicOnWrite,
-				HostUDS:      conf.FSGoferHostUDS,
+				ROMount:       isReadonlyMount(m.Options) || conf.Overlay,
+				PanicOnWrite:  g.panicOnWrite,
+				HostUDS:       conf.FSGoferHostUDS,
+				IODelay:       conf.JitterGoferDelay,
+				IOHotAccesses: conf.JitterGoferHotAccesses,
 			}
 			ap, err := fsgofer.NewAttachPoint(m.Destination, cfg)
 			if err != nil {
@@ -0,0 +1,97 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// JitterAnalyze implements subcommands.Command for the "jitter-analyze"
+// command.
+type JitterAnalyze struct {
+	hot int
+}
+
+// Name implements subcommands.Command.Name.
+func (*JitterAnalyze) Name() string {
+	return "jitter-analyze"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*JitterAnalyze) Synopsis() string {
+	return "compare the decisions of two jitter traces"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*JitterAnalyze) Usage() string {
+	return `jitter-analyze [-hot=<n>] <traceA> <traceB> - compares two traces.
+
+The traces are written by the monitor with --jitter-record, e.g. with two
+policies on the same workload. For each trace, it reports the delay windows and
+the delay they injected, assuming every window lasted the full delay window.
+It then reports how many of the pages delayed both traces share, and which
+fraction of the accesses sampled on the hottest pages of both traces, taken as
+the ground truth hot regions, fall on pages each trace delayed.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (a *JitterAnalyze) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&a.hot, "hot", 16, "number of most sampled pages taken as the ground truth hot regions")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (a *JitterAnalyze) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	if a.hot <= 0 {
+		return Errorf("-hot must be positive, got %d", a.hot)
+	}
+
+	var traces [2]*maid.TraceReader
+	for i := range traces {
+		in, err := os.Open(f.Arg(i))
+		if err != nil {
+			return Errorf("Error opening trace: %v", err)
+		}
+		defer in.Close()
+		traces[i] = maid.NewTraceReader(in)
+	}
+	c, err := maid.CompareTraces(traces[0], traces[1], a.hot)
+	if err != nil {
+		return Errorf("Error comparing traces: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "\tA\tB\n")
+	fmt.Fprintf(w, "samples\t%d\t%d\n", c.A.Samples, c.B.Samples)
+	fmt.Fprintf(w, "delay windows\t%d\t%d\n", c.A.Windows, c.B.Windows)
+	fmt.Fprintf(w, "injected delay\t%v\t%v\n", c.A.Delay, c.B.Delay)
+	fmt.Fprintf(w, "pages delayed\t%d\t%d\n", len(c.A.Delayed), len(c.B.Delayed))
+	fmt.Fprintf(w, "pages delayed by one only\t%d\t%d\n", c.OnlyA, c.OnlyB)
+	fmt.Fprintf(w, "hot region coverage\t%.1f%%\t%.1f%%\n", 100*c.CoverageA, 100*c.CoverageB)
+	w.Flush()
+	fmt.Printf("%d pages delayed by both, overlap %.1f%%, %d hot pages\n", c.Common, 100*c.Overlap, len(c.Hot))
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// JitterAudit implements subcommands.Command for the "jitter-audit" command.
+type JitterAudit struct {
+	key     string
+	records bool
+}
+
+// Name implements subcommands.Command.Name.
+func (*JitterAudit) Name() string {
+	return "jitter-audit"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*JitterAudit) Synopsis() string {
+	return "verify the audit log of the delays injected by jitter"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*JitterAudit) Usage() string {
+	return `jitter-audit -key <public key> <audit log> - verifies an audit log.
+
+The audit log is written by the monitor with --jitter-audit-key. Its records
+are checked against the public key of the host key, e.g. from
+"openssl pkey -pubout". The number of valid records and the hash of the last
+one are printed; keep the hash to detect a truncated log later on.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (a *JitterAudit) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&a.key, "key", "", "path to the PEM encoded public key of the host key")
+	f.BoolVar(&a.records, "records", false, "print the valid records")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (a *JitterAudit) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 || a.key == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	data, err := ioutil.ReadFile(a.key)
+	if err != nil {
+		return Errorf("Error reading public key: %v", err)
+	}
+	pub, err := maid.ParseAuditPublicKey(data)
+	if err != nil {
+		return Errorf("Error: %v", err)
+	}
+	in, err := os.Open(f.Arg(0))
+	if err != nil {
+		return Errorf("Error opening audit log: %v", err)
+	}
+	defer in.Close()
+
+	recs, verr := maid.VerifyAudit(in, pub)
+	if a.records {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+		fmt.Fprint(w, "SEQ\tTIME\tCONTAINER\tDURATION\tTARGETS\tREASON\n")
+		for _, r := range recs {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%d\t%s\n", r.Seq, r.Time.Format(time.RFC3339Nano), r.Container, r.Duration, len(r.Targets), r.Reason)
+		}
+		w.Flush()
+	}
+	if verr != nil {
+		return Errorf("Audit log is invalid after %d valid records: %v", len(recs), verr)
+	}
+	last := ""
+	if len(recs) != 0 {
+		last = recs[len(recs)-1].Hash
+	}
+	fmt.Printf("%d valid records, last hash: %s\n", len(recs), last)
+	return subcommands.ExitSuccess
+}
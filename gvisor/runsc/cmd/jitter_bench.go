@@ -0,0 +1,283 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/control/client"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// jitterStatsInterval is how often jitter-bench polls the sandbox for delay
+// statistics. The sandbox exits with the workload, so the last poll is what
+// gets reported.
+const jitterStatsInterval = 500 * time.Millisecond
+
+// JitterBench implements subcommands.Command for the "jitter-bench" command.
+type JitterBench struct {
+	root string
+	cwd  string
+	runs int
+}
+
+// Name implements subcommands.Command.Name.
+func (*JitterBench) Name() string {
+	return "jitter-bench"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*JitterBench) Synopsis() string {
+	return "measure the overhead of jitter on a workload"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*JitterBench) Usage() string {
+	return `jitter-bench [flags] <cmd> - runs a command with and without jitter.
+
+The command is run in a sandbox set up like with "runsc do", without network,
+first with the jitter monitor disabled and then with it enabled. Wall time,
+CPU time of the sandbox processes and delay statistics are averaged over
+-runs runs and printed side by side.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (b *JitterBench) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&b.root, "root", "/", `path to the root directory, defaults to "/"`)
+	f.StringVar(&b.cwd, "cwd", ".", "path to the current directory, defaults to the current directory")
+	f.IntVar(&b.runs, "runs", 1, "number of runs of each configuration")
+}
+
+// benchResult is the outcome of one or more runs of the workload.
+type benchResult struct {
+	wall  time.Duration
+	cpu   time.Duration
+	stats maid.Stats
+}
+
+// Execute implements subcommands.Command.Execute.
+func (b *JitterBench) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if len(f.Args()) == 0 || b.runs <= 0 {
+		b.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	conf := args[0].(*boot.Config)
+	if conf.Rootless {
+		if err := specutils.MaybeRunAsRoot(); err != nil {
+			return Errorf("Error executing inside namespace: %v", err)
+		}
+	}
+
+	absRoot, err := resolvePath(b.root)
+	if err != nil {
+		return Errorf("Error resolving root: %v", err)
+	}
+	absCwd, err := resolvePath(b.cwd)
+	if err != nil {
+		return Errorf("Error resolving current directory: %v", err)
+	}
+
+	var results [2]benchResult
+	for i, enabled := range []bool{false, true} {
+		for run := 0; run < b.runs; run++ {
+			c := *conf
+			c.Jitter = enabled
+			r, err := b.run(&c, absRoot, absCwd, f.Args())
+			if err != nil {
+				return Errorf("Error running workload with jitter=%t: %v", enabled, err)
+			}
+			results[i].wall += r.wall
+			results[i].cpu += r.cpu
+			results[i].stats.Windows += r.stats.Windows
+			results[i].stats.DelayedAccesses += r.stats.DelayedAccesses
+			results[i].stats.ThrottledDelays += r.stats.ThrottledDelays
+			results[i].stats.DelayNanos += r.stats.DelayNanos
+			// Latencies are distributions over all runs.
+			results[i].stats.AccessLatency.Merge(r.stats.AccessLatency)
+			results[i].stats.WindowLatency.Merge(r.stats.WindowLatency)
+		}
+		results[i].wall /= time.Duration(b.runs)
+		results[i].cpu /= time.Duration(b.runs)
+		results[i].stats.Windows /= uint64(b.runs)
+		results[i].stats.DelayedAccesses /= uint64(b.runs)
+		results[i].stats.ThrottledDelays /= uint64(b.runs)
+		results[i].stats.DelayNanos /= uint64(b.runs)
+	}
+
+	base, jit := results[0], results[1]
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "\tBASELINE\tJITTER\tOVERHEAD\n")
+	fmt.Fprintf(w, "wall time\t%v\t%v\t%s\n", base.wall, jit.wall, overhead(base.wall, jit.wall))
+	fmt.Fprintf(w, "cpu time\t%v\t%v\t%s\n", base.cpu, jit.cpu, overhead(base.cpu, jit.cpu))
+	fmt.Fprintf(w, "delay windows\t%d\t%d\t\n", base.stats.Windows, jit.stats.Windows)
+	fmt.Fprintf(w, "delayed accesses\t%d\t%d\t\n", base.stats.DelayedAccesses, jit.stats.DelayedAccesses)
+	fmt.Fprintf(w, "throttled delays\t%d\t%d\t\n", base.stats.ThrottledDelays, jit.stats.ThrottledDelays)
+	fmt.Fprintf(w, "delay time\t%v\t%v\t\n", time.Duration(base.stats.DelayNanos), time.Duration(jit.stats.DelayNanos))
+	fmt.Fprintf(w, "access latency p50/p99\t%s\t%s\t\n", latencySummary(base.stats.AccessLatency), latencySummary(jit.stats.AccessLatency))
+	fmt.Fprintf(w, "window latency p50/p99\t%s\t%s\t\n", latencySummary(base.stats.WindowLatency), latencySummary(jit.stats.WindowLatency))
+	w.Flush()
+	return subcommands.ExitSuccess
+}
+
+// latencySummary formats the median and 99th percentile of h.
+func latencySummary(h maid.LatencyHistogram) string {
+	if h.Count == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%v/%v", h.Quantile(0.5), h.Quantile(0.99))
+}
+
+// overhead formats the relative increase from base to v.
+func overhead(base, v time.Duration) string {
+	if base == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", 100*float64(v-base)/float64(base))
+}
+
+// run runs the workload once in a new sandbox.
+func (b *JitterBench) run(conf *boot.Config, root, cwd string, argv []string) (benchResult, error) {
+	var r benchResult
+
+	// The host file system is mapped readonly with a writable overlay on
+	// top, like with "runsc do".
+	conf.Overlay = true
+	conf.Network = boot.NetworkNone
+	spec := &specs.Spec{
+		Root: &specs.Root{
+			Path: root,
+		},
+		Process: &specs.Process{
+			Cwd:          cwd,
+			Args:         argv,
+			Env:          os.Environ(),
+			Capabilities: specutils.AllCapabilities(),
+		},
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{{Type: specs.NetworkNamespace}},
+		},
+	}
+
+	tmpDir, err := ioutil.TempDir("", "runsc-jitter-bench")
+	if err != nil {
+		return r, fmt.Errorf("creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	conf.RootDir = tmpDir
+
+	out, err := json.Marshal(spec)
+	if err != nil {
+		return r, fmt.Errorf("marshaling spec: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "config.json"), out, 0755); err != nil {
+		return r, fmt.Errorf("writing spec: %v", err)
+	}
+
+	var before syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &before); err != nil {
+		return r, fmt.Errorf("getrusage: %v", err)
+	}
+
+	cid := fmt.Sprintf("jitter-bench-%06d", rand.Int31n(1000000))
+	ct, err := container.New(conf, container.Args{
+		ID:        cid,
+		Spec:      spec,
+		BundleDir: tmpDir,
+		Attached:  true,
+	})
+	if err != nil {
+		return r, fmt.Errorf("creating container: %v", err)
+	}
+
+	start := time.Now()
+	if err := ct.Start(conf); err != nil {
+		ct.Destroy()
+		return r, fmt.Errorf("starting container: %v", err)
+	}
+
+	done := make(chan struct{})
+	statsC := make(chan maid.Stats, 1)
+	go pollJitterStats(cid, done, statsC)
+
+	ws, err := ct.Wait()
+	r.wall = time.Since(start)
+	close(done)
+	r.stats = <-statsC
+	if derr := ct.Destroy(); derr != nil {
+		log.Warningf("Destroying container %q: %v", cid, derr)
+	}
+	if err != nil {
+		return r, fmt.Errorf("waiting for container: %v", err)
+	}
+	if ws.ExitStatus() != 0 {
+		return r, fmt.Errorf("workload exited with status %d", ws.ExitStatus())
+	}
+
+	// The sandbox processes are reaped by Destroy.
+	var after syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &after); err != nil {
+		return r, fmt.Errorf("getrusage: %v", err)
+	}
+	r.cpu = rusageTime(after) - rusageTime(before)
+	return r, nil
+}
+
+// rusageTime returns the user and system time in ru.
+func rusageTime(ru syscall.Rusage) time.Duration {
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// pollJitterStats polls the delay statistics of sandbox cid until done is
+// closed, then sends the last statistics it got to out.
+func pollJitterStats(cid string, done <-chan struct{}, out chan<- maid.Stats) {
+	var last maid.Stats
+	ticker := time.NewTicker(jitterStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			out <- last
+			return
+		case <-ticker.C:
+		}
+		conn, err := client.ConnectTo(boot.ControlSocketAddr(cid))
+		if err != nil {
+			continue
+		}
+		var s maid.Stats
+		if err := conn.Call(boot.JitterStats, nil, &s); err == nil {
+			last = s
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// JitterExport implements subcommands.Command for the "jitter-export" command.
+type JitterExport struct {
+	output string
+}
+
+// Name implements subcommands.Command.Name.
+func (*JitterExport) Name() string {
+	return "jitter-export"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*JitterExport) Synopsis() string {
+	return "export a jitter trace to CSV for offline analysis"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*JitterExport) Usage() string {
+	return `jitter-export [-o <file>] <trace> - exports a trace to CSV.
+
+The trace is written by the monitor with --jitter-record. Every target of a
+record is a row, with the columns:
+
+  ` + strings.Join(maid.TraceCSVColumns, ",") + `
+
+The CSV is written to stdout unless -o is set.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (e *JitterExport) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&e.output, "o", "", "file to write the CSV to, instead of stdout")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (e *JitterExport) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	in, err := os.Open(f.Arg(0))
+	if err != nil {
+		return Errorf("Error opening trace: %v", err)
+	}
+	defer in.Close()
+
+	var out io.Writer = os.Stdout
+	if e.output != "" {
+		file, err := os.Create(e.output)
+		if err != nil {
+			return Errorf("Error creating %s: %v", e.output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	n, err := maid.ExportTraceCSV(maid.NewTraceReader(in), out)
+	if err != nil {
+		return Errorf("Error exporting trace after %d records: %v", n, err)
+	}
+	if e.output != "" {
+		fmt.Printf("%d records exported to %s\n", n, e.output)
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// JitterHeatmap implements subcommands.Command for the "jitter-heatmap"
+// command.
+type JitterHeatmap struct {
+	format string
+	output string
+	bucket time.Duration
+	pages  int
+}
+
+// Name implements subcommands.Command.Name.
+func (*JitterHeatmap) Name() string {
+	return "jitter-heatmap"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*JitterHeatmap) Synopsis() string {
+	return "render the access heatmap of a jitter trace with the delays overlaid"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*JitterHeatmap) Usage() string {
+	return `jitter-heatmap [-format=svg|json] [-bucket=<duration>] [-pages=<n>] [-o <file>] <trace> - renders a trace as a heatmap.
+
+The trace is written by the monitor with --jitter-record. Time runs along the
+columns, one per bucket, and the pages sampled most along the rows. With svg,
+cells are as red as the page was sampled, on a log scale, and outlined in blue
+where the page was delayed, which shows whether the delays follow the hot spots
+of the workload. With json, the same grid is written as numbers.
+
+The heatmap is written to stdout unless -o is set.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (h *JitterHeatmap) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&h.format, "format", "svg", "output format: svg or json")
+	f.StringVar(&h.output, "o", "", "file to write the heatmap to, instead of stdout")
+	f.DurationVar(&h.bucket, "bucket", time.Second, "time covered by a column of the heatmap")
+	f.IntVar(&h.pages, "pages", 64, "number of most sampled pages to show")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (h *JitterHeatmap) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	if h.format != "svg" && h.format != "json" {
+		return Errorf("Invalid format %q, want svg or json", h.format)
+	}
+
+	in, err := os.Open(f.Arg(0))
+	if err != nil {
+		return Errorf("Error opening trace: %v", err)
+	}
+	defer in.Close()
+	heat, err := maid.NewTraceHeatmap(maid.NewTraceReader(in), h.bucket, h.pages)
+	if err != nil {
+		return Errorf("Error reading trace: %v", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if h.output != "" {
+		file, err := os.Create(h.output)
+		if err != nil {
+			return Errorf("Error creating %s: %v", h.output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if h.format == "json" {
+		err = json.NewEncoder(out).Encode(heat)
+	} else {
+		err = heat.WriteSVG(out)
+	}
+	if err != nil {
+		return Errorf("Error writing heatmap: %v", err)
+	}
+	if h.output != "" {
+		fmt.Printf("%d pages over %d buckets written to %s\n", len(heat.Pages), len(heat.Accesses), h.output)
+	}
+	return subcommands.ExitSuccess
+}
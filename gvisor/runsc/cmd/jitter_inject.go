@@ -0,0 +1,94 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/control/client"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// JitterInject implements subcommands.Command for the "jitter-inject"
+// command.
+type JitterInject struct{}
+
+// Name implements subcommands.Command.Name.
+func (*JitterInject) Name() string {
+	return "jitter-inject"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*JitterInject) Synopsis() string {
+	return "apply a stream of monitor messages to a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*JitterInject) Usage() string {
+	return `jitter-inject <container id> <file>... - injects monitor messages.
+
+Every file is a stream of encoded monitor messages, e.g. an input of the
+FuzzDecode fuzz target of pkg/maid. The sandbox applies the messages as if its
+monitor sent them; this changes its delays, so only use it on test sandboxes.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*JitterInject) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute implements subcommands.Command.Execute.
+func (*JitterInject) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() < 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	cont, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("loading container: %v", err)
+	}
+	conn, err := client.ConnectTo(boot.ControlSocketAddr(cont.Sandbox.ID))
+	if err != nil {
+		Fatalf("connecting to control server: %v", err)
+	}
+	defer conn.Close()
+
+	for _, path := range f.Args()[1:] {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			Fatalf("reading %s: %v", path, err)
+		}
+		var res maid.InjectResult
+		if err := conn.Call(boot.JitterInject, &data, &res); err != nil {
+			Fatalf("injecting %s: %v", path, err)
+		}
+		fmt.Printf("%s: %d applied (%d with errors), %d rejected", path, res.Applied, res.Errors, res.Rejected)
+		if res.Err != "" {
+			fmt.Printf(", stopped: %s", res.Err)
+		}
+		fmt.Println()
+	}
+	return subcommands.ExitSuccess
+}
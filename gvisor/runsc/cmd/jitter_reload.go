@@ -0,0 +1,80 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/control/client"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// JitterReload implements subcommands.Command for the "jitter-reload"
+// command.
+type JitterReload struct{}
+
+// Name implements subcommands.Command.Name.
+func (*JitterReload) Name() string {
+	return "jitter-reload"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*JitterReload) Synopsis() string {
+	return "change the jitter parameters of a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*JitterReload) Usage() string {
+	return `jitter-reload <container id> - applies the jitter flags to a sandbox.
+
+The delay and policy flags, including those of --jitter-config, are sent to
+the sandbox over its control socket. The monitor is left alone: when it
+schedules delays, send it SIGHUP instead, which also reloads the sandbox.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*JitterReload) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute implements subcommands.Command.Execute.
+func (*JitterReload) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*boot.Config)
+
+	cont, err := container.Load(conf.RootDir, id)
+	if err != nil {
+		Fatalf("loading container: %v", err)
+	}
+	conn, err := client.ConnectTo(boot.ControlSocketAddr(cont.Sandbox.ID))
+	if err != nil {
+		Fatalf("connecting to control server: %v", err)
+	}
+	defer conn.Close()
+
+	t := conf.JitterTunables()
+	if err := conn.Call(boot.JitterReload, &t, nil); err != nil {
+		Fatalf("reloading jitter parameters: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/jitter"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// JitterSimulate implements subcommands.Command for the "jitter-simulate"
+// command.
+type JitterSimulate struct {
+	policy string
+	trace  string
+	output string
+	seed   int64
+}
+
+// Name implements subcommands.Command.Name.
+func (*JitterSimulate) Name() string {
+	return "jitter-simulate"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*JitterSimulate) Synopsis() string {
+	return "run a jitter policy offline over a recorded trace"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*JitterSimulate) Usage() string {
+	return `jitter-simulate -trace=<file> [-policy=<name>] [-seed=<n>] [-o <file>] - simulates a policy over a trace.
+
+The trace is written by the monitor with --jitter-record. Its samples are fed
+to the policy in the time they were recorded at, and the decisions the policy
+would have taken are written with them as a trace, which jitter-export,
+jitter-heatmap and jitter-analyze read. Nothing is delayed: every delay window is assumed to
+last the full window, during which samples are skipped.
+
+The policy is configured with the global flags the monitor uses:
+--jitter-backoff, --jitter-compensation, --jitter-min-accesses,
+--jitter-spike-accesses, --jitter-off-accesses, --jitter-min-on-decisions,
+--jitter-min-off-decisions, --jitter-history-window and --jitter-calibrate.
+Registered policies: ` + strings.Join(jitter.Policies(), ", ") + `.
+
+The trace is written to stdout unless -o is set.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (s *JitterSimulate) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&s.policy, "policy", "adaptive", "registered policy to simulate")
+	f.StringVar(&s.trace, "trace", "", "trace recorded with --jitter-record to simulate the policy over")
+	f.StringVar(&s.output, "o", "", "file to write the simulated trace to, instead of stdout")
+	f.Int64Var(&s.seed, "seed", 0, "seed of the policies that decide at random, 0 for the current time")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (s *JitterSimulate) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if s.trace == "" || f.NArg() != 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	conf := args[0].(*boot.Config)
+
+	in, err := os.Open(s.trace)
+	if err != nil {
+		return Errorf("Error opening trace: %v", err)
+	}
+	defer in.Close()
+
+	var out io.Writer = os.Stdout
+	if s.output != "" {
+		file, err := os.Create(s.output)
+		if err != nil {
+			return Errorf("Error creating %s: %v", s.output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	decisions := maid.NewTraceWriter(out)
+
+	policy := maid.NewPolicy()
+	policy.SetBackoff(conf.JitterBackoff)
+	policy.SetCompensation(conf.JitterCompensation)
+	policy.SetThresholds(conf.JitterThresholds)
+	policy.SetHysteresis(conf.JitterHysteresis)
+	policy.SetHistoryWindow(conf.JitterHistoryWindow)
+	m := &jitter.Monitor{
+		Name:       "simulation",
+		Policy:     policy,
+		Thresholds: conf.JitterThresholds,
+		Entropy:    conf.JitterEntropy,
+	}
+	if conf.JitterCalibrate > 0 {
+		m.Calibrator = maid.NewCalibrator(conf.JitterCalibrate)
+	}
+	var writeErr error
+	m.Record = func(rec maid.TraceRecord) {
+		if writeErr == nil {
+			writeErr = decisions.Write(rec)
+		}
+	}
+	seed := s.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if err := jitter.SetPolicy(m, s.policy, seed); err != nil {
+		return Errorf("Error setting policy: %v", err)
+	}
+
+	res, err := m.Simulate(maid.NewTraceReader(in))
+	if err != nil {
+		return Errorf("Error simulating %s: %v", s.policy, err)
+	}
+	if writeErr != nil {
+		return Errorf("Error writing decisions: %v", writeErr)
+	}
+	if s.output != "" {
+		fmt.Printf("%s decided on %d samples, %d delay windows, seed %d, written to %s\n", s.policy, res.Samples, res.Windows, seed, s.output)
+	}
+	return subcommands.ExitSuccess
+}
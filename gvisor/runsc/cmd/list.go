@@ -24,6 +24,8 @@ import (
 
 	"github.com/google/subcommands"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/control/client"
+	"gvisor.dev/gvisor/pkg/maid"
 	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
@@ -90,22 +92,27 @@ func (l *List) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	case "text":
 		// Print a nice table.
 		w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-		fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER\n")
+		fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER\tJITTER\tMONITOR\tHEARTBEAT\n")
 		for _, c := range containers {
-			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n",
+			j := jitterListStatus(c)
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
 				c.ID,
 				c.SandboxPid(),
 				c.Status,
 				c.BundleDir,
 				c.CreatedAt.Format(time.RFC3339Nano),
-				c.Owner)
+				c.Owner,
+				j.Mode,
+				j.MonitorPid,
+				j.Heartbeat)
 		}
 		w.Flush()
 	case "json":
 		// Print just the states.
-		var states []specs.State
+		var states []listState
 		for _, c := range containers {
-			states = append(states, c.State())
+			j := jitterListStatus(c)
+			states = append(states, listState{State: c.State(), Jitter: &j})
 		}
 		if err := json.NewEncoder(os.Stdout).Encode(states); err != nil {
 			Fatalf("marshaling container state: %v", err)
@@ -115,3 +122,60 @@ func (l *List) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	}
 	return subcommands.ExitSuccess
 }
+
+// listState is the state of a container in the JSON output of list.
+type listState struct {
+	specs.State
+
+	// Jitter is the jitter status of the container.
+	Jitter *jitterStatus `json:"jitter"`
+}
+
+// jitterStatus tells whether a container is protected by jitter.
+type jitterStatus struct {
+	// Mode is how the container is delayed: off, monitor, daemon or
+	// in-sandbox.
+	Mode string `json:"mode"`
+
+	// MonitorPid is the PID of the monitor process of the container, 0 if
+	// it has none.
+	MonitorPid int `json:"monitorPid"`
+
+	// Heartbeat is whether the sandbox hears from the monitor: ok, missed,
+	// or - if it doesn't check or can't be asked.
+	Heartbeat string `json:"heartbeat"`
+}
+
+// jitterListStatus returns the jitter status of c.
+func jitterListStatus(c *container.Container) jitterStatus {
+	j := jitterStatus{Mode: "off", MonitorPid: c.MonitorPid, Heartbeat: "-"}
+	switch {
+	case !c.Jitter:
+		return j
+	case c.JitterDaemon:
+		j.Mode = "daemon"
+	case c.MonitorPid != 0:
+		j.Mode = "monitor"
+	default:
+		j.Mode = "in-sandbox"
+	}
+	if c.Sandbox == nil || (c.Status != container.Running && c.Status != container.Paused) {
+		return j
+	}
+
+	conn, err := client.ConnectTo(boot.ControlSocketAddr(c.Sandbox.ID))
+	if err != nil {
+		return j
+	}
+	defer conn.Close()
+	var h maid.MonitorHealth
+	if err := conn.Call(boot.JitterMonitor, nil, &h); err != nil || !h.Checked {
+		return j
+	}
+	if h.Healthy {
+		j.Heartbeat = "ok"
+	} else {
+		j.Heartbeat = "missed"
+	}
+	return j
+}
@@ -23,6 +23,7 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
@@ -30,13 +31,16 @@ import (
 
 	"github.com/cenkalti/backoff"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/cleanup"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/sighandling"
+	"gvisor.dev/gvisor/pkg/unet"
 	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/cgroup"
+	"gvisor.dev/gvisor/runsc/resctrl"
 	"gvisor.dev/gvisor/runsc/sandbox"
 	"gvisor.dev/gvisor/runsc/specutils"
 )
@@ -113,6 +117,17 @@ type Container struct {
 	// processes.
 	Saver StateFile `json:"saver"`
 
+	// JitterDaemon is set if the sandbox is delayed by the host-wide jitter
+	// daemon rather than by a monitor process of its own.
+	JitterDaemon bool `json:"jitterDaemon"`
+
+	// Jitter is set if the container is delayed by jitter.
+	Jitter bool `json:"jitter"`
+
+	// MonitorPid is the PID of the jitter monitor of the container. It is 0
+	// if the container has no monitor process of its own.
+	MonitorPid int `json:"monitorPid"`
+
 	//
 	// Fields below this line are not saved in the state file and will not
 	// be preserved across commands.
@@ -291,6 +306,8 @@ func New(conf *boot.Config, args Args) (*Container, error) {
 			RootDir: conf.RootDir,
 			ID:      args.ID,
 		},
+		JitterDaemon: conf.Jitter && conf.JitterDaemon,
+		Jitter:       conf.Jitter,
 	}
 	// The Cleanup object cleans up partially created containers when an error
 	// occurs. Any errors occurring during cleanup itself are ignored.
@@ -323,6 +340,11 @@ func New(conf *boot.Config, args Args) (*Container, error) {
 				return nil, fmt.Errorf("configuring cgroup: %v", err)
 			}
 		}
+		unpin, err := pinJitterCPUSet(conf, cg)
+		if err != nil {
+			return nil, fmt.Errorf("[Cijitter] pinning sandbox to CPUs %q: %v", conf.JitterCPUSet, err)
+		}
+		defer unpin()
 		if err := runInCgroup(cg, func() error {
 			//add: revAddr
 			ioFiles, specFile, err := c.createGoferProcess(args.Spec, conf, args.BundleDir, args.Attached)
@@ -330,13 +352,32 @@ func New(conf *boot.Config, args Args) (*Container, error) {
 				return err
 			}
 
-			//Create os.Pipe() to monitor and sandbox
-			reader, writer, err := os.Pipe()
-		        if err != nil {
-				log.Debugf("[Cijitter] Create os.Pipe() to monitor and sandbox failed...")
+			// Create the address channel between monitor and sandbox. It
+			// is a socket pair so that the sandbox can acknowledge
+			// messages.
+			fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+			if err != nil {
+				return fmt.Errorf("[Cijitter] creating address channel to monitor: %v", err)
+			}
+			reader := os.NewFile(uintptr(fds[0]), "sandbox addr FD")
+			writer := os.NewFile(uintptr(fds[1]), "monitor addr FD")
+
+			// With the jitter daemon, the sandbox waits for the daemon
+			// to hand it an address channel with jitter.Reconnect.
+			var sandControl *os.File
+			if conf.Jitter && !conf.JitterDaemon && !conf.JitterInSandbox {
+				// The monitor can't reach the control socket from
+				// its network namespace, hand it a connection.
+				fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+				if err != nil {
+					return fmt.Errorf("[Cijitter] creating control connection of monitor: %v", err)
+				}
+				sandControl = os.NewFile(uintptr(fds[0]), "sandbox control FD")
+				monControl := os.NewFile(uintptr(fds[1]), "monitor control FD")
+				c.createMonitorProcess(args.Spec, conf, args.BundleDir, args.Attached, writer, monControl)
+			} else {
+				writer.Close()
 			}
-
-			c.createMonitorProcess(args.Spec, conf, args.BundleDir, args.Attached, writer)
 
 			// Start a new sandbox for this container. Any errors after this point
 			// must destroy the container.
@@ -352,6 +393,7 @@ func New(conf *boot.Config, args Args) (*Container, error) {
 				Attached:      args.Attached,
 				//LIZHI
 				RevAddr:	   reader,
+				JitterControl: sandControl,
 			}
 			sand, err := sandbox.New(conf, sandArgs)
 			if err != nil {
@@ -444,7 +486,15 @@ func (c *Container) Start(conf *boot.Config) error {
 			}
 			defer mountsFile.Close()
 
-			c.createMonitorProcess(c.Spec, conf, c.BundleDir, false, nil)
+			if !conf.JitterDaemon && !conf.JitterInSandbox {
+				// The sandbox is running, connect the monitor to
+				// its control server from here.
+				monControl, err := dialJitterControl(c.Sandbox.ID)
+				if err != nil {
+					return fmt.Errorf("[Cijitter] connecting monitor to control server: %v", err)
+				}
+				c.createMonitorProcess(c.Spec, conf, c.BundleDir, false, nil, monControl)
+			}
 
 			cleanMounts, err := specutils.ReadMounts(mountsFile)
 			if err != nil {
@@ -748,6 +798,12 @@ func (c *Container) Destroy() error {
 		errs = append(errs, err.Error())
 	}
 
+	// The jitter monitor was stopped above and may have left its resctrl
+	// group behind.
+	if err := resctrl.DestroyGroup(resctrl.GroupName(c.ID)); err != nil {
+		log.Warningf("[Cijitter] %v", err)
+	}
+
 	if err := c.Saver.destroy(); err != nil {
 		err = fmt.Errorf("deleting container state files: %v", err)
 		log.Warningf("%v", err)
@@ -874,7 +930,28 @@ func (c *Container) waitForStopped() error {
 	return backoff.Retry(op, b)
 }
 
-func (c *Container) createMonitorProcess(spec *specs.Spec, conf *boot.Config, bundleDir string, attached bool, sender *os.File) ([]*os.File, *os.File, error) {
+// dialJitterControl connects to the control server of sandbox id and returns
+// the connection, to be donated to a jitter monitor.
+func dialJitterControl(id string) (*os.File, error) {
+	conn, err := unet.Connect(boot.ControlSocketAddr(id), false)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := conn.Release()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "monitor control FD"), nil
+}
+
+// createMonitorProcess starts the jitter monitor of the container. sender is
+// the monitor end of the address pipe, and controlConn of a connection to the
+// control server of the sandbox, as the monitor doesn't share its network
+// namespace.
+func (c *Container) createMonitorProcess(spec *specs.Spec, conf *boot.Config, bundleDir string, attached bool, sender, controlConn *os.File) ([]*os.File, *os.File, error) {
+	defer controlConn.Close()
+
 	// Start with the general config flags.
 	args := conf.ToFlags()
 
@@ -903,7 +980,9 @@ func (c *Container) createMonitorProcess(spec *specs.Spec, conf *boot.Config, bu
 				test = t
 			}
 		}
-		debugLogFile, err := specutils.DebugLogFile(conf.DebugLog, "monitor", test)
+		// The monitors of all containers run at once, give each its
+		// own file.
+		debugLogFile, err := specutils.DebugLogFile(specutils.PerContainerLogPattern(conf.DebugLog), "monitor", c.ID, test)
 		if err != nil {
 			return nil, nil, fmt.Errorf("[Cijitter] opening debug log file in %q: %v", conf.DebugLog, err)
 		}
@@ -967,6 +1046,10 @@ func (c *Container) createMonitorProcess(spec *specs.Spec, conf *boot.Config, bu
 	args = append(args, fmt.Sprintf("--addr-fd=%d", nextFD))
 	nextFD++
 
+	goferEnds = append(goferEnds, controlConn)
+	args = append(args, fmt.Sprintf("--control-fd=%d", nextFD))
+	nextFD++
+
 	binPath := specutils.ExePath
 	cmd := exec.Command(binPath, args...)
 	cmd.ExtraFiles = goferEnds
@@ -982,13 +1065,20 @@ func (c *Container) createMonitorProcess(spec *specs.Spec, conf *boot.Config, bu
 
 	// Enter new namespaces to isolate from the rest of the system. Don't unshare
 	// cgroup because gofer is added to a cgroup in the caller's namespace.
+	// The monitor reaches the control server of the sandbox through the
+	// connection it is donated, not the abstract control socket.
 	nss := []specs.LinuxNamespace{
 		{Type: specs.IPCNamespace},
 		{Type: specs.MountNamespace},
 		{Type: specs.NetworkNamespace},
-		{Type: specs.PIDNamespace},
 		{Type: specs.UTSNamespace},
 	}
+	// Perf events name the sampled threads by PID in the caller's PID
+	// namespace, so the rootless monitor must see the sandbox.
+	if !conf.Rootless {
+		nss = append(nss, specs.LinuxNamespace{Type: specs.PIDNamespace})
+	}
+
 
 	// Setup any uid/gid mappings, and create or join the configured user
 	// namespace so the gofer's view of the filesystem aligns with the
@@ -1007,6 +1097,7 @@ func (c *Container) createMonitorProcess(spec *specs.Spec, conf *boot.Config, bu
 		return nil, nil, fmt.Errorf("[Cijitter] Monitor: %v", err)
 	}
 	log.Infof("[Cijitter] Monitor started, PID: %d", cmd.Process.Pid)
+	c.MonitorPid = cmd.Process.Pid
 	c.GoferPid = cmd.Process.Pid
 	c.goferIsChild = true
 	return sandEnds, mountsSand, nil
@@ -1041,7 +1132,7 @@ func (c *Container) createGoferProcess(spec *specs.Spec, conf *boot.Config, bund
 				test = t
 			}
 		}
-		debugLogFile, err := specutils.DebugLogFile(conf.DebugLog, "gofer", test)
+		debugLogFile, err := specutils.DebugLogFile(conf.DebugLog, "gofer", c.ID, test)
 		if err != nil {
 			return nil, nil, fmt.Errorf("opening debug log file in %q: %v", conf.DebugLog, err)
 		}
@@ -1220,6 +1311,53 @@ func runInCgroup(cg *cgroup.Cgroup, fn func() error) error {
 	return fn()
 }
 
+// pinJitterCPUSet pins the sandbox, its gofer and the jitter monitor to
+// conf.JitterCPUSet, so that the workload and the delays injected on it share
+// the same cores. The CPUs are set in cg if runsc created it. Otherwise the
+// calling thread is pinned, so that the processes it creates inherit its
+// affinity, and the returned function unpins it.
+func pinJitterCPUSet(conf *boot.Config, cg *cgroup.Cgroup) (func(), error) {
+	if conf.JitterCPUSet == "" {
+		return func() {}, nil
+	}
+	cpus, err := cgroup.ParseCpuset(conf.JitterCPUSet)
+	if err != nil {
+		return nil, err
+	}
+	if conf.JitterCPUSetExclusive {
+		if cg == nil || !cg.Own {
+			return nil, fmt.Errorf("reserving CPUs requires a cgroup created by runsc")
+		}
+		if cpus, err = cgroup.CoreCPUs(cpus); err != nil {
+			return nil, fmt.Errorf("finding hyperthread siblings: %v", err)
+		}
+	}
+
+	if cg != nil && cg.Own {
+		log.Infof("[Cijitter] pinning cgroup %q to CPUs %s", cg.Name, cgroup.FormatCpuset(cpus))
+		return func() {}, cg.SetCpuset(cgroup.FormatCpuset(cpus), conf.JitterCPUSetExclusive)
+	}
+
+	var set, old unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	runtime.LockOSThread()
+	if err := unix.SchedGetaffinity(0, &old); err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("getting CPU affinity: %v", err)
+	}
+	if err := unix.SchedSetaffinity(0, &set); err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("setting CPU affinity: %v", err)
+	}
+	log.Infof("[Cijitter] pinning sandbox processes to CPUs %s", cgroup.FormatCpuset(cpus))
+	return func() {
+		unix.SchedSetaffinity(0, &old)
+		runtime.UnlockOSThread()
+	}, nil
+}
+
 // adjustGoferOOMScoreAdj sets the oom_store_adj for the container's gofer.
 func (c *Container) adjustGoferOOMScoreAdj() error {
 	if c.GoferPid == 0 || c.Spec.Process.OOMScoreAdj == nil {
@@ -20,12 +20,18 @@ import (
 
 type FlagSet = flag.FlagSet
 
+type Flag = flag.Flag
+
 var (
 	NewFlagSet  = flag.NewFlagSet
 	String      = flag.String
 	Bool        = flag.Bool
+	Duration    = flag.Duration
+	Float64     = flag.Float64
 	Int         = flag.Int
+	Int64       = flag.Int64
 	Uint        = flag.Uint
+	Uint64      = flag.Uint64
 	CommandLine = flag.CommandLine
 	Parse       = flag.Parse
 )
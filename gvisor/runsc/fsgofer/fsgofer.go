@@ -30,6 +30,7 @@ import (
 	"runtime"
 	"strconv"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -88,6 +89,14 @@ type Config struct {
 
 	// HostUDS signals whether the gofer can mount a host's UDS.
 	HostUDS bool
+
+	// IODelay bounds the random delay added to reads and stats of hot
+	// files. 0 disables it.
+	IODelay time.Duration
+
+	// IOHotAccesses is the number of accesses to a file within a second
+	// from which reads and stats of it are delayed.
+	IOHotAccesses int
 }
 
 type attachPoint struct {
@@ -107,6 +116,9 @@ type attachPoint struct {
 	// devices is a map from actual host devices to "small" integers that
 	// can be combined with host inode to form a unique virtual inode id.
 	devices map[uint64]uint8
+
+	// jitter delays accesses to hot files. It is nil if IODelay is 0.
+	jitter *ioJitter
 }
 
 // NewAttachPoint creates a new attacher that gives local file
@@ -120,6 +132,7 @@ func NewAttachPoint(prefix string, c Config) (p9.Attacher, error) {
 		prefix:  prefix,
 		conf:    c,
 		devices: make(map[uint64]uint8),
+		jitter:  newIOJitter(c.IODelay, c.IOHotAccesses),
 	}, nil
 }
 
@@ -600,6 +613,7 @@ func (l *localFile) FSync() error {
 
 // GetAttr implements p9.File.
 func (l *localFile) GetAttr(_ p9.AttrMask) (p9.QID, p9.AttrMask, p9.Attr, error) {
+	l.attachPoint.jitter.delay(l.hostPath)
 	stat, err := fstat(l.file.FD())
 	if err != nil {
 		return p9.QID{}, p9.AttrMask{}, p9.Attr{}, extractErrno(err)
@@ -831,6 +845,7 @@ func (l *localFile) ReadAt(p []byte, offset uint64) (int, error) {
 	if !l.isOpen() {
 		return 0, syscall.EBADF
 	}
+	l.attachPoint.jitter.delay(l.hostPath)
 
 	r, err := l.file.ReadAt(p, int64(offset))
 	switch err {
@@ -0,0 +1,81 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"math/rand"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// hotWindow is the period over which accesses to a file are counted to tell
+// whether it is hot.
+const hotWindow = time.Second
+
+// ioJitter delays reads and stats of hot files by a bounded random time, so
+// that the latency of the gofer doesn't tell whether a file is in the host
+// page cache, which a co-resident attacker could otherwise learn by timing
+// its own accesses to a shared file.
+type ioJitter struct {
+	// max bounds the delay.
+	max time.Duration
+
+	// hotAccesses is the number of accesses within hotWindow from which a
+	// file is hot.
+	hotAccesses int
+
+	mu sync.Mutex
+
+	// start is the beginning of the current window.
+	start time.Time
+
+	// counts are the accesses of the current window, by host path.
+	counts map[string]int
+}
+
+// newIOJitter returns an ioJitter delaying accesses by up to max, or nil if
+// max is 0.
+func newIOJitter(max time.Duration, hotAccesses int) *ioJitter {
+	if max <= 0 {
+		return nil
+	}
+	return &ioJitter{
+		max:         max,
+		hotAccesses: hotAccesses,
+		counts:      make(map[string]int),
+	}
+}
+
+// hot records an access to path at now and returns true if path is hot.
+func (j *ioJitter) hot(path string, now time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if now.Sub(j.start) >= hotWindow {
+		j.start = now
+		j.counts = make(map[string]int)
+	}
+	j.counts[path]++
+	return j.counts[path] >= j.hotAccesses
+}
+
+// delay records an access to path and, if it is hot, sleeps for a random time
+// below the bound. j may be nil, in which case it does nothing.
+func (j *ioJitter) delay(path string) {
+	if j == nil || !j.hot(path, time.Now()) {
+		return
+	}
+	time.Sleep(time.Duration(rand.Int63n(int64(j.max))))
+}
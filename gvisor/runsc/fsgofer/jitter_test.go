@@ -0,0 +1,47 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIOJitterHot(t *testing.T) {
+	j := newIOJitter(time.Millisecond, 3)
+	now := time.Unix(100, 0)
+	for i, want := range []bool{false, false, true, true} {
+		if got := j.hot("/a", now); got != want {
+			t.Errorf("access %d: hot() = %t, want %t", i, got, want)
+		}
+	}
+	if j.hot("/b", now) {
+		t.Errorf("hot(/b) = true after a single access")
+	}
+
+	// Counts start over with the next window.
+	if j.hot("/a", now.Add(hotWindow)) {
+		t.Errorf("hot(/a) = true in a new window")
+	}
+}
+
+func TestIOJitterDisabled(t *testing.T) {
+	j := newIOJitter(0, 1)
+	if j != nil {
+		t.Fatalf("newIOJitter(0) = %+v, want nil", j)
+	}
+	// A nil jitter never delays.
+	j.delay("/a")
+}
@@ -21,28 +21,26 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
-	"strconv"
-	"math"
-	"bytes"
-	"encoding/binary"
 
 	"github.com/google/subcommands"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cgroup"
 	"gvisor.dev/gvisor/runsc/cmd"
 	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/monitor"
 	"gvisor.dev/gvisor/runsc/specutils"
 
-	"os/exec"
-	"encoding/json"
 	"gvisor.dev/gvisor/pkg/maid"
 )
 
@@ -51,7 +49,7 @@ var (
 	// Docker, and thus should not be changed.
 	rootDir     = flag.String("root", "", "root directory for storage of container state.")
 	logFilename = flag.String("log", "", "file path where internal debug information is written, default is stdout.")
-	logFormat   = flag.String("log-format", "text", "log format: text (default), json, or json-k8s.")
+	logFormat   = flag.String("log-format", "text", "log format: text (default), json, json-k8s, or syslog or journald to send the log to the host logging daemon instead of --log.")
 	debug       = flag.Bool("debug", false, "enable debug logging.")
 	showVersion = flag.Bool("version", false, "show version and exit.")
 	// TODO(gvisor.dev/issue/193): support systemd cgroups
@@ -61,13 +59,13 @@ var (
 	// system that are not covered by the runtime spec.
 
 	// Debugging flags.
-	debugLog        = flag.String("debug-log", "", "additional location for logs. If it ends with '/', log files are created inside the directory with default names. The following variables are available: %TIMESTAMP%, %COMMAND%.")
+	debugLog        = flag.String("debug-log", "", "additional location for logs. If it ends with '/', log files are created inside the directory with default names. The following variables are available: %TIMESTAMP%, %COMMAND%, %CONTAINERID%. Monitor logs always go to a file per container.")
 	panicLog        = flag.String("panic-log", "", "file path were panic reports and other Go's runtime messages are written.")
 	logPackets      = flag.Bool("log-packets", false, "enable network packet logging.")
 	logFD           = flag.Int("log-fd", -1, "file descriptor to log to.  If set, the 'log' flag is ignored.")
 	debugLogFD      = flag.Int("debug-log-fd", -1, "file descriptor to write debug logs to.  If set, the 'debug-log-dir' flag is ignored.")
 	panicLogFD      = flag.Int("panic-log-fd", -1, "file descriptor to write Go's runtime messages.")
-	debugLogFormat  = flag.String("debug-log-format", "text", "log format: text (default), json, or json-k8s.")
+	debugLogFormat  = flag.String("debug-log-format", "text", "log format: text (default), json, json-k8s, or syslog or journald to send the debug logs of every command, the monitor included, to the host logging daemon instead of --debug-log.")
 	alsoLogToStderr = flag.Bool("alsologtostderr", false, "send log messages to stderr.")
 
 	// Debugging flags: strace related
@@ -102,7 +100,103 @@ var (
 	testOnlyAllowRunAsCurrentUserWithoutChroot = flag.Bool("TESTONLY-unsafe-nonroot", false, "TEST ONLY; do not ever use! This skips many security measures that isolate the host from the sandbox.")
 	testOnlyTestNameEnv                        = flag.String("TESTONLY-test-name-env", "", "TEST ONLY; do not ever use! Used for automated tests to improve logging.")
 
-	addrSendFD			= flag.Int("addr-fd", -1, "send addr and access number to sandbox.")
+	jitterEnabled           = flag.Bool("jitter", true, "starts the jitter monitor next to the sandbox. When disabled, the sandbox is never delayed.")
+	jitterHeartbeatInterval = flag.Duration("jitter-heartbeat-interval", 5*time.Second, "how often the monitor tells the sandbox it is alive. 0 disables heartbeats.")
+	jitterHeartbeatAction   = flag.String("jitter-heartbeat-action", "log", "sets what the sandbox does when heartbeats from the monitor stop: log (default), disable, watchdog.")
+	jitterMsgBuffer         = flag.Int("jitter-msg-buffer", 1, "number of messages the monitor queues for the sandbox while it is busy.")
+	jitterMsgDrop           = flag.String("jitter-msg-drop", "block", "sets what the monitor does with a sample, history or heartbeat message when its queue is full: block (default), drop-oldest, drop-newest. Messages that open or close delay windows always wait.")
+	jitterDelayPrimitive    = flag.String("jitter-delay-primitive", "mprotect", "mechanism used to slow down accesses to target pages: mprotect (default), sleep, clflush, unmap, recolor.")
+	jitterSplitHugePages    = flag.Bool("jitter-split-huge-pages", false, "split huge pages around target pages, so that only the target page is delayed instead of the whole huge page.")
+	jitterDecoyMode         = flag.String("jitter-decoy-mode", "off", "whether the sandbox issues decoy accesses during delay windows: off (default), decoy (instead of delaying the target), both (in addition to delaying the target).")
+	jitterDecoyAddrs        = flag.String("jitter-decoy-addrs", "", "comma separated hexadecimal addresses decoy accesses go to. If empty, the secondary targets of each batch are used.")
+	jitterDecoyInterval     = flag.Duration("jitter-decoy-interval", time.Millisecond, "how often decoy accesses are issued.")
+	jitterClockFuzzRealtime = flag.String("jitter-clock-fuzz-realtime", "0", "degrades CLOCK_REALTIME as read by the application, in the format resolution[:noise], e.g. 1ms:100us. Times are rounded down to resolution and up to noise is added at random. 0 (default) disables it.")
+	jitterClockFuzzMonotonic = flag.String("jitter-clock-fuzz-monotonic", "0", "degrades CLOCK_MONOTONIC as read by the application, in the same format as --jitter-clock-fuzz-realtime.")
+	jitterSyscalls          = flag.String("jitter-syscalls", "", "comma-separated list of syscalls delayed by a random amount during delay windows.")
+	jitterSyscallDelay      = flag.Duration("jitter-syscall-delay", 50*time.Microsecond, "upper bound of the random delay of --jitter-syscalls.")
+	jitterPreemptInterval   = flag.Duration("jitter-preempt-interval", 0, "upper bound of the random time between two preemptions of the delayed task during delay windows, which moves it between host threads. 0 (default) disables it.")
+	jitterBackend           = flag.String("jitter-backend", "maid", "how the sandbox is slowed down during a delay window: maid (default) delays accesses to target pages, mba throttles the sandbox's memory bandwidth with Intel MBA, cat isolates the sandbox into dedicated LLC ways with Intel CAT.")
+	jitterMBAPercent        = flag.Int("jitter-mba-percent", 10, "memory bandwidth, in percent, the sandbox is throttled to with --jitter-backend=mba.")
+	jitterCATWays           = flag.Int("jitter-cat-ways", 2, "number of LLC ways reserved for the sandbox with --jitter-backend=cat.")
+	jitterPrefetch          = flag.String("jitter-prefetch", "off", "hardware prefetchers disabled on the CPUs the sandbox may run on during delay windows, by writing their MSR: off (default) leaves them alone, all, l1 the L1 data cache prefetchers, l2 the L2 prefetchers. Requires root, the msr module and jitter scheduling in the monitor. Other workloads on these CPUs lose the prefetchers too.")
+	jitterTargetPolicy      = flag.String("jitter-target-policy", "cpu", "selects the processes the monitor samples, as kind[:pattern]: cpu (default) samples the sandbox process using the most CPU, exe:REGEX the sandbox processes whose executable name matches, args:REGEX the container processes if the args of the OCI process, or of a process started with runsc exec, match, env:NAME[=VALUE] the container processes if the environment of one of them has the marker, cgroup:PATH the sandbox processes under the cgroup path, all all container processes.")
+	jitterSampleScope       = flag.String("jitter-sample-scope", "process", "how much of the processes selected by --jitter-target-policy the monitor samples: process (default) every thread of them, thread the busiest thread of the busiest one alone, cgroup every process of the container cgroup.")
+	jitterSampler           = flag.String("jitter-sampler", "auto", "how the monitor samples memory accesses: auto (default) uses perf in rootless mode and daptrace otherwise, daptrace uses the daptrace kernel module and requires root, daptrace-ring streams samples from the ring buffer of the daptrace module which keeps tracing between samples and requires root, daptrace-events receives the samples of the daptrace module as netlink events as they are aggregated and requires root, perf samples page faults with unprivileged perf events, sentry counts the page faults of the application in the sentry and requires --jitter-in-sandbox, --jitter-min-accesses and --jitter-spike-accesses.")
+	jitterPerfPMU           = flag.String("jitter-perf-pmu", "auto", "what the perf sampler samples: auto (default) uses ibs on hosts with AMD IBS and faults otherwise, faults samples page faults, ibs samples the data addresses of memory operations with AMD Instruction-Based Sampling, which may need perf_event_paranoid 0 or less or CAP_PERFMON.")
+	jitterWarmUp            = flag.Duration("jitter-warm-up", maid.WarmUp, "how long the monitor waits after the sandbox is created before it starts sampling.")
+	jitterStartOnExec       = flag.Bool("jitter-start-on-exec", false, "start sampling as soon as the sandbox reports that the workload has started, instead of after --jitter-warm-up.")
+	jitterBackoff           = flag.String("jitter-backoff", "exponential", "how the sampling interval grows while nothing is delayed: exponential (default) multiplies it by --jitter-backoff-factor, linear adds --jitter-backoff-step.")
+	jitterBackoffFactor     = flag.Int("jitter-backoff-factor", maid.DefaultBackoff.Factor, "multiplier of the sampling interval with --jitter-backoff=exponential.")
+	jitterBackoffStep       = flag.Duration("jitter-backoff-step", maid.DefaultBackoff.Step, "increment of the sampling interval with --jitter-backoff=linear.")
+	jitterBackoffMax        = flag.Duration("jitter-backoff-max", maid.DefaultBackoff.Max, "cap of the sampling interval.")
+	jitterBackoffReset      = flag.String("jitter-backoff-reset", maid.DefaultBackoff.Reset.String(), "comma-separated events which reset the sampling interval: delay (default) when a window is delayed, hit when a delay window observed delayed accesses, or none.")
+	jitterCompensation      = flag.String("jitter-compensation", maid.DefaultCompensation.Kind.String(), "how the policy corrects the access count sampled after a delayed window, which the delays bias low: linear (default) makes up --jitter-compensation-factor of the drop from the previous sample, measured divides it by the slowdown measured over previous delay windows, none takes it as is.")
+	jitterCompensationFactor = flag.Float64("jitter-compensation-factor", maid.DefaultCompensation.Factor, "fraction, between 0 and 1, of the drop from the previous sample made up with --jitter-compensation=linear.")
+	jitterRecord            = flag.String("jitter-record", "", "file the monitor records every sample and decision to, with timestamps.")
+	jitterReplay            = flag.String("jitter-replay", "", "trace recorded with --jitter-record that drives the monitor instead of live sampling.")
+	jitterActivation        = flag.String("jitter-activation", "always", "when the monitor delays the sandbox: always (default), or suspected to only delay it while host cache counters show a flush+reload or prime+probe signature.")
+	jitterCoResidency       = flag.String("jitter-co-residency", "ignore", "what the monitor does when no other host process shares physical cores or last level cache with the sandbox: ignore (default) keeps delaying it, disable stops delaying it, downgrade only delays it while an attack is suspected, as with --jitter-activation=suspected.")
+	jitterNUMA              = flag.String("jitter-numa", "off", "how the monitor takes the NUMA nodes of a multi-socket host into account: off (default) ignores them, record logs the nodes of the targets of each window and of the processes suspected of attacking the sandbox, migrate also moves the targets away from the node of the suspects instead of delaying them when that is cheaper.")
+	jitterCPUSet            = flag.String("jitter-cpuset", "", "list of CPUs, e.g. 2-3,6, the sandbox, its gofer and the jitter monitor are pinned to, through the sandbox cgroup when runsc creates it and CPU affinity otherwise.")
+	jitterCPUSetExclusive   = flag.Bool("jitter-cpuset-exclusive", false, "extend --jitter-cpuset to whole physical cores and reserve them for the sandbox. Requires a cgroup created by runsc.")
+	jitterDelayScope        = flag.String("jitter-delay-scope", "sandbox", "which tasks wait when an access to a target traps with --jitter-delay-primitive=mprotect or sleep: sandbox (default) holds fault handling for every task, task only delays the tasks that touched the target.")
+	jitterDelayWait         = flag.String("jitter-delay-wait", "sleep", "how the sentry waits out the delays of the windows the policy opens: sleep (default) costs no CPU but is only as precise as the host scheduler, spin busy-waits for microsecond precision on delays under 1ms and waits out longer ones as hybrid, hybrid sleeps for most of the delay and busy-waits for the calibrated oversleep of the host.")
+	jitterDeferLockHolders  = flag.Bool("jitter-defer-lock-holders", false, "defer the delay of a task holding a futex other tasks wait on, a PI futex or a glibc mutex, until it releases it, so that its waiters aren't stalled with it. Applies to --jitter-delay-scope=task and --jitter-delay-primitive=sleep.")
+	jitterHeatDecay         = flag.Float64("jitter-heat-decay", 0, "factor, in [0, 1), the heat of sampled pages decays by every sampling cycle. Targets are the pages with the most heat, i.e. persistently hot. 0 (default) targets the hottest pages of each sample.")
+	jitterTopK              = flag.Int("jitter-top-k", 16, "number of most sampled pages the monitor tracks, in fixed memory, over the life of the container. The sandbox serves them with the jitter.HeavyHitters control call. 0 disables tracking.")
+	jitterDaemon            = flag.Bool("jitter-daemon", false, "hand the sandbox to the host-wide jitter daemon, the cijitter-monitor service or 'runsc jitter-daemon', instead of starting a monitor process for it.")
+	jitterGoferDelay        = flag.Duration("jitter-gofer-delay", 0, "bound of the random delay the gofer adds to reads and stats of hot files, so that their latency doesn't tell whether they are in the host page cache. 0 (default) disables it.")
+	jitterGoferHotAccesses  = flag.Int("jitter-gofer-hot-accesses", 8, "number of accesses to a file within a second from which the gofer delays its reads and stats with --jitter-gofer-delay.")
+	jitterNetDelay          = flag.Duration("jitter-net-delay", 0, "bound of the random time the sandbox network stack holds outbound packets for during delay windows. Packets held are sent in a single batch. 0 (default) disables it.")
+	jitterMinAccesses       = flag.Int("jitter-min-accesses", maid.DefaultThresholds.Min, "access count sampled on the hottest page at or below which a window is never delayed.")
+	jitterSpikeAccesses     = flag.Int("jitter-spike-accesses", maid.DefaultThresholds.Spike, "access count sampled on the hottest page above which a window is always delayed, whatever the history.")
+	jitterOffAccesses       = flag.Int("jitter-off-accesses", 0, "access count at or below which a policy that is delaying windows stops, while one that is not only starts above --jitter-min-accesses. 0 (default) uses --jitter-min-accesses.")
+	jitterMinOnDecisions    = flag.Int("jitter-min-on-decisions", 0, "minimum number of consecutive decisions the policy delays windows for once it switched to delaying. Spikes are delayed regardless.")
+	jitterMinOffDecisions   = flag.Int("jitter-min-off-decisions", 0, "minimum number of consecutive decisions the policy skips windows for once it switched to skipping.")
+	jitterHistoryWindow     = flag.Int("jitter-history-window", maid.DefaultHistoryWindow, "number of past samples the policy judges a sample against. A longer window makes decisions steadier, a shorter one quicker to follow phase changes.")
+	jitterEntropyMapping    = flag.String("jitter-entropy-mapping", "off", "how the entropy of the accesses sampled when a window opens, from 0 when they all fall on one page to 1 when they spread evenly, scales the delays of the window: off (default), linear, exp, step. Concentrated accesses, typical of leaking phases, get longer delays.")
+	jitterEntropyMin        = flag.Float64("jitter-entropy-min", maid.DefaultEntropyMapping.Min, "factor the delays are scaled by at entropy 1, with --jitter-entropy-mapping.")
+	jitterEntropyMax        = flag.Float64("jitter-entropy-max", maid.DefaultEntropyMapping.Max, "factor the delays are scaled by at entropy 0, with --jitter-entropy-mapping. At most 16.")
+	jitterEntropyStep       = flag.Float64("jitter-entropy-step", maid.DefaultEntropyMapping.Step, "entropy below which the step mapping scales delays by --jitter-entropy-max, and at or above which by --jitter-entropy-min.")
+	jitterContentionHITM    = flag.Int("jitter-contention-hitm", 0, "number of loads sampled on the cache lines of the targets that hit a line modified by another core (HITM) from which cross-core contention is observed: the sample opens a delay window even if the policy wouldn't, and its delays are raised by --jitter-contention-boost. 0 (default) disables the signal.")
+	jitterContentionBoost   = flag.Float64("jitter-contention-boost", maid.DefaultContentionBoost, "factor the delays of windows opened under cross-core contention are raised by, with --jitter-contention-hitm. At most 16.")
+	jitterHITMEvent         = flag.Uint64("jitter-hitm-event", boot.DefaultJitterHITMEvent, "raw hardware event sampling HITM loads for --jitter-contention-hitm, as perf takes it. The default is that of Intel Skylake and later.")
+	jitterSampleDeadline    = flag.Duration("jitter-sample-deadline", 10*time.Second, "time a sample may take in the monitor, e.g. while the kernel module hangs, before --jitter-stall-action is taken. 0 disables the check.")
+	jitterStallAction       = flag.String("jitter-stall-action", "log", "sets what the monitor does when a sample overruns --jitter-sample-deadline: log (default), panic, disable-jitter.")
+	jitterLogMaxSize        = flag.Int64("jitter-log-max-size", 0, "size in bytes from which the monitor rotates its sample archive and --jitter-record file. 0 disables size-based rotation. Without any rotation, only the last sample of the kernel module is kept.")
+	jitterLogMaxAge         = flag.Duration("jitter-log-max-age", 0, "age from which the monitor rotates its sample archive and --jitter-record file. 0 disables time-based rotation.")
+	jitterLogKeep           = flag.Int("jitter-log-keep", 3, "number of rotated sample archives and --jitter-record files the monitor keeps.")
+	jitterWorkDir           = flag.String("jitter-work-dir", "", "directory the monitor keeps the samples of the kernel module in, in a subdirectory per container. Defaults to 'jitter' in the root directory.")
+	jitterModule            = flag.String("jitter-module", "", "daptrace kernel module to load. Defaults to $"+monitor.DaptraceModuleEnv+", then to the module for the running kernel found in /lib/modules or /monitor/kernel.")
+	jitterModuleSrc         = flag.String("jitter-module-src", "", "sources of the daptrace kernel module, with a dkms.conf, to build the module from with DKMS when none is found for the running kernel. Empty disables building.")
+	jitterInSandbox         = flag.Bool("jitter-in-sandbox", false, "sample the sandbox with perf events, or with the page faults of the sentry with --jitter-sampler=sentry, from within the sandbox instead of starting a privileged monitor process. The perf events are opened before the syscall filters are installed. Requires --jitter-scheduling=sentry.")
+	jitterPrivsep           = flag.Bool("jitter-privsep", false, "run the monitor as nobody, leaving loading and driving the daptrace kernel module to a helper process which only keeps CAP_SYS_ADMIN and CAP_SYS_MODULE. The working directory of the monitor is handed over to nobody, --jitter-record must be writable by nobody. Requires --jitter-backend=maid.")
+	jitterDelayBudget       = flag.Duration("jitter-delay-budget", 0, "ceiling on the time the sandbox is delayed per second, enforced by the sentry whatever the monitor asks for, e.g. 200ms. Delays over the budget are shortened or skipped. 0 (default) disables the ceiling.")
+	jitterFailurePolicy     = flag.String("jitter-failure-policy", "open", "what the monitor does once sampling failed 5 times in a row, leaving the workload unprotected: open (default) keeps retrying, closed kills the container processes, pause-container pauses the container until 'runsc resume'.")
+	jitterBlindPeriod       = flag.Duration("jitter-blind-period", 0, "if no sampler can be created, fall back to blind mode: stop the whole sandbox for a random part of every period, e.g. 100ms, instead of delaying sampled pages. 0 (default) disables the fallback, the monitor fails as before.")
+	jitterBlindDuty         = flag.Int("jitter-blind-duty", 20, "average percentage of --jitter-blind-period the sandbox is stopped for in blind mode.")
+	jitterConfig            = flag.String("jitter-config", "", "file of jitter flags, one name=value per line, that override the command line and are read again when the monitor gets SIGHUP, to tune the sandbox while it runs. Only the delay primitive, scope, wait, syscall delay, preempt interval and budget, the access thresholds, hysteresis, backoff, compensation and symbol rule flags may be set.")
+	jitterAuditKey          = flag.String("jitter-audit-key", "", "path of a PEM encoded ed25519 private key, e.g. from 'openssl genpkey -algorithm ed25519'. If set, the monitor appends every delay window it injects to audit.log in its working directory, as records chained by their hashes and signed with the key. Check the log with 'runsc jitter-audit'. Requires jitter scheduling in the monitor.")
+	jitterSymbolize         = flag.Bool("jitter-symbolize", false, "resolve the targets the monitor delays to lib+offset, or to function names if the library has ELF symbols, in its logs and --jitter-record. Requires jitter scheduling in the monitor.")
+	jitterSymbolRules       = flag.String("jitter-symbol-rules", "", "comma separated per-function policies of the monitor, as always:PATTERN or never:PATTERN. Targets whose function or mapping name contains PATTERN are always delayed, or never, e.g. always:libcrypto,never:Interpreter. The first matching rule applies. Requires jitter scheduling in the monitor.")
+	jitterCalendar          = flag.String("jitter-calendar", "", "semicolon separated periods during which the monitor protects the sandbox, outside of which nothing is delayed: cron-like schedules of minute, hour, day of month, month and day of week, e.g. '* 9-17 * * 1-5' for business hours in the host's time zone, or label:KEY[=VALUE] to protect containers annotated so. Empty (default) always protects it. Can be changed in --jitter-config.")
+	jitterProfileDir        = flag.String("jitter-profile-dir", "", "directory where the monitor keeps the hot regions it learns, as mapping and offset, per container image. The next run of the same image delays them from the start, without warm-up. The image is named by the dev.cijitter.image or CRI image annotations, or else by the digest of the entrypoint. Requires jitter scheduling in the monitor.")
+	jitterExitReport        = flag.String("jitter-exit-report", "", "file the sandbox appends its exit report to, as a line of JSON: delay windows, delayed accesses and delay time, the most targeted regions with their symbols, and the sampling errors of the monitor. The report is always written to the debug log. The variables of --debug-log are available, and a trailing '/' names a directory. Sampling errors are only known with --jitter-heartbeat-interval.")
+	jitterChaos             = flag.Bool("jitter-chaos", false, "control arm for evaluations: delay as many windows and targets as the policy decides, but on pages drawn at random from all those sampled and at random times. Requires jitter scheduling in the monitor, and can't be used with --jitter-profile-dir.")
+	jitterWidenRadius       = flag.Int("jitter-widen-radius", 0, "number of pages on each side of every target that are delayed with it, up to 16. Delays are page granular, so the cache lines of the target's own page are always delayed with it; widening covers the neighboring lines of tables that cross page boundaries. 0 (default) delays the target page alone.")
+	jitterShuffleInterval   = flag.Duration("jitter-shuffle-interval", 0, "how often the sandbox permutes the physical frames of the pages applications marked secret with madvise, at least 1ms. An aggressive mode, in the spirit of ORAM: the cache sets of a secret region keep changing, and accesses can't be told apart between its pages. 0 (default) never shuffles.")
+	jitterPageTier          = flag.String("jitter-page-tier", "unmap", "primitive of the page tier, applied to the hot region, the hottest targets of the last window, every --jitter-page-tier-interval whether a window is open or not: clflush, unmap (default), recolor.")
+	jitterPageTierInterval  = flag.Duration("jitter-page-tier-interval", 0, "interval between two rounds of the page tier, at least 1ms. 0 (default) disables the page tier.")
+	jitterLineTier          = flag.Bool("jitter-line-tier", false, "delay windows flush the cache lines of their targets the sampler saw accesses on, instead of applying --jitter-delay-primitive to their whole pages. Targets whose lines aren't known, from samplers other than perf, are flushed whole.")
+	jitterFairTurns         = flag.Bool("jitter-fair-turns", false, "schedule the delay windows of the sandboxes of the host that set it round-robin, one sandbox at a time, instead of simultaneously, to bound the throughput the host loses to jitter. Sandboxes register in the jitter working directory, which they must share. Requires jitter scheduling in the monitor.")
+	jitterLoadCPU           = flag.Float64("jitter-load-cpu", 0, "host CPU utilization, between 0 and 1, above which the monitor takes --jitter-load-action, so that jitter doesn't compound an overload. Jitter is restored once utilization falls below 90% of it. 0 (default) disables the limit.")
+	jitterLoadPressure      = flag.Float64("jitter-load-pressure", 0, "host CPU pressure, the avg10 percentage of /proc/pressure/cpu, above which the monitor takes --jitter-load-action. Jitter is restored once pressure falls below 90% of it. Ignored on kernels without PSI. 0 (default) disables the limit.")
+	jitterLoadAction        = flag.String("jitter-load-action", "suspend", "what the monitor does while the host is over --jitter-load-cpu or --jitter-load-pressure: suspend (default) delays no window, lighten only delays the primary target of each window.")
+	jitterCPUCompensation   = flag.Bool("jitter-cpu-compensation", false, "credit the CFS CPU quota of the sandbox cgroup with the time the sandbox was delayed, up to twice the quota, so that workloads tracked against an SLO keep their throughput. The quota is restored when the monitor ends. Does nothing without a CPU quota.")
+	jitterAlert             = flag.String("jitter-alert", "", "where the monitor sends a JSON alert when it starts suspecting a cache attack, from host cache counters, or samples more accesses than --jitter-spike-accesses: an http:// or https:// webhook it POSTs to, or the path of a named pipe it writes a line to. Alerts of a kind are sent at most once a minute. The monitor of a sandbox has no network, webhooks require --jitter-daemon.")
+	jitterCalibrate         = flag.Int("jitter-calibrate", 0, "number of sampling cycles the monitor observes to derive --jitter-min-accesses and --jitter-spike-accesses from the percentiles of the workload's access counts. The flags apply until calibration ends. 0 (default) disables calibration.")
+	jitterIOUring           = flag.Bool("jitter-io-uring", false, "read the sample events of --jitter-sampler=daptrace-events with io_uring, which keeps reads in flight and resubmits them in batches, so that high-rate sample streams don't dominate the CPU of the monitor. Falls back to a read per event where io_uring isn't available.")
+	jitterScheduling        = flag.String("jitter-scheduling", "monitor", "where delays are scheduled: monitor (default), sentry. With sentry, the monitor only streams raw samples and the policy is saved with the sandbox.")
 )
 
 func main() {
@@ -125,6 +219,14 @@ func main() {
 	subcommands.Register(new(cmd.Events), "")
 	subcommands.Register(new(cmd.Exec), "")
 	subcommands.Register(new(cmd.Gofer), "")
+	subcommands.Register(new(cmd.JitterAnalyze), "")
+	subcommands.Register(new(cmd.JitterAudit), "")
+	subcommands.Register(new(cmd.JitterBench), "")
+	subcommands.Register(new(cmd.JitterExport), "")
+	subcommands.Register(new(cmd.JitterHeatmap), "")
+	subcommands.Register(new(cmd.JitterReload), "")
+	subcommands.Register(new(cmd.JitterSimulate), "")
+	subcommands.Register(new(cmd.JitterInject), "")
 	subcommands.Register(new(cmd.Kill), "")
 	subcommands.Register(new(cmd.List), "")
 	subcommands.Register(new(cmd.Pause), "")
@@ -164,7 +266,9 @@ func main() {
 	}
 
 	var errorLogger io.Writer
-	if *logFD > -1 {
+	if isDaemonLogFormat(*logFormat) {
+		errorLogger = emitterWriter{newEmitter(*logFormat, nil)}
+	} else if *logFD > -1 {
 		errorLogger = os.NewFile(uintptr(*logFD), "error log file")
 
 	} else if *logFilename != "" {
@@ -217,6 +321,370 @@ func main() {
 		cmd.Fatalf("%s", err)
 	}
 
+	if *jitterHeartbeatInterval < 0 {
+		cmd.Fatalf("jitter_heartbeat_interval must be >= 0, got: %v", *jitterHeartbeatInterval)
+	}
+
+	heartbeatAction, err := boot.MakeJitterHeartbeatAction(*jitterHeartbeatAction)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
+	if *jitterMsgBuffer <= 0 {
+		cmd.Fatalf("jitter_msg_buffer must be > 0, got: %d", *jitterMsgBuffer)
+	}
+	msgDrop, err := boot.MakeJitterMsgDrop(*jitterMsgDrop)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
+	schedMode, err := boot.MakeJitterSchedulingMode(*jitterScheduling)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
+	delayPrimitive, err := boot.MakeJitterDelayPrimitive(*jitterDelayPrimitive)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
+	pageTier, err := boot.MakeJitterDelayPrimitive(*jitterPageTier)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
+	delayScope, err := boot.MakeJitterDelayScope(*jitterDelayScope)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	delayWait, err := boot.MakeJitterDelayWait(*jitterDelayWait)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
+	decoyMode, err := boot.MakeJitterDecoyMode(*jitterDecoyMode)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	decoyAddrs, err := maid.ParseDecoyAddrs(*jitterDecoyAddrs)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if decoyMode != maid.DecoyOff && *jitterDecoyInterval <= 0 {
+		cmd.Fatalf("jitter_decoy_interval must be > 0, got: %v", *jitterDecoyInterval)
+	}
+
+	clockFuzzRealtime, err := boot.MakeJitterClockFuzz(*jitterClockFuzzRealtime)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	clockFuzzMonotonic, err := boot.MakeJitterClockFuzz(*jitterClockFuzzMonotonic)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
+	backend, err := boot.MakeJitterBackend(*jitterBackend)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if backend != boot.JitterBackendMaid && schedMode != boot.JitterSchedulingMonitor {
+		cmd.Fatalf("jitter backend %v requires jitter scheduling in the monitor", backend)
+	}
+	if *jitterMBAPercent <= 0 || *jitterMBAPercent > 100 {
+		cmd.Fatalf("jitter_mba_percent must be in (0, 100], got: %d", *jitterMBAPercent)
+	}
+	if *jitterCATWays <= 0 {
+		cmd.Fatalf("jitter_cat_ways must be > 0, got: %d", *jitterCATWays)
+	}
+	prefetch, err := boot.MakeJitterPrefetch(*jitterPrefetch)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if prefetch != boot.JitterPrefetchOff && (schedMode != boot.JitterSchedulingMonitor || *rootless) {
+		cmd.Fatalf("jitter_prefetch requires jitter scheduling in the monitor and can't be used with rootless")
+	}
+
+	targetPolicy, err := boot.MakeJitterTargetPolicy(*jitterTargetPolicy)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	sampleScope, err := boot.MakeJitterSampleScope(*jitterSampleScope)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+
+	sampler, err := boot.MakeJitterSampler(*jitterSampler)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	perfPMU, err := boot.MakeJitterPerfPMU(*jitterPerfPMU)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if *jitterWarmUp < 0 {
+		cmd.Fatalf("jitter_warm_up must be >= 0, got: %v", *jitterWarmUp)
+	}
+
+	backoffKind, err := boot.MakeJitterBackoffKind(*jitterBackoff)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	backoffReset, err := maid.ParseBackoffReset(*jitterBackoffReset)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	backoffPolicy := maid.Backoff{
+		Kind:   backoffKind,
+		Factor: *jitterBackoffFactor,
+		Step:   *jitterBackoffStep,
+		Max:    *jitterBackoffMax,
+		Reset:  backoffReset,
+	}
+	if err := backoffPolicy.Validate(); err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	compensationKind, err := boot.MakeJitterCompensationKind(*jitterCompensation)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	compensation := maid.Compensation{
+		Kind:   compensationKind,
+		Factor: *jitterCompensationFactor,
+	}
+	if err := compensation.Validate(); err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if *jitterRecord != "" && *jitterRecord == *jitterReplay {
+		cmd.Fatalf("jitter_record and jitter_replay must not be the same file")
+	}
+
+	activation, err := boot.MakeJitterActivation(*jitterActivation)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if activation == boot.JitterActivationSuspected && *jitterReplay != "" {
+		cmd.Fatalf("jitter_activation=suspected requires live cache counters, it can't be used with jitter_replay")
+	}
+	coResidency, err := boot.MakeJitterCoResidency(*jitterCoResidency)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if coResidency != boot.JitterCoResidencyIgnore && *jitterReplay != "" {
+		cmd.Fatalf("jitter_co_residency=%v inspects the host, it can't be used with jitter_replay", coResidency)
+	}
+	numa, err := boot.MakeJitterNUMA(*jitterNUMA)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if numa != boot.JitterNUMAOff && *jitterReplay != "" {
+		cmd.Fatalf("jitter_numa=%v inspects the host, it can't be used with jitter_replay", numa)
+	}
+	if *jitterHeatDecay < 0 || *jitterHeatDecay >= 1 {
+		cmd.Fatalf("jitter_heat_decay must be in [0, 1), got: %v", *jitterHeatDecay)
+	}
+	if *jitterTopK < 0 || *jitterTopK > maid.MaxBatchTargets {
+		cmd.Fatalf("jitter_top_k must be in [0, %d], got: %d", maid.MaxBatchTargets, *jitterTopK)
+	}
+	if *jitterCPUSet != "" {
+		if _, err := cgroup.ParseCpuset(*jitterCPUSet); err != nil {
+			cmd.Fatalf("invalid jitter_cpuset %q: %v", *jitterCPUSet, err)
+		}
+	} else if *jitterCPUSetExclusive {
+		cmd.Fatalf("jitter_cpuset_exclusive requires jitter_cpuset")
+	}
+	if *jitterGoferDelay < 0 {
+		cmd.Fatalf("jitter_gofer_delay must be >= 0, got: %v", *jitterGoferDelay)
+	}
+	if *jitterGoferHotAccesses <= 0 {
+		cmd.Fatalf("jitter_gofer_hot_accesses must be > 0, got: %d", *jitterGoferHotAccesses)
+	}
+	if *jitterNetDelay < 0 {
+		cmd.Fatalf("jitter_net_delay must be >= 0, got: %v", *jitterNetDelay)
+	}
+	thresholds := maid.Thresholds{
+		Min:   *jitterMinAccesses,
+		Spike: *jitterSpikeAccesses,
+	}
+	if err := thresholds.Validate(); err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	hysteresis := maid.Hysteresis{
+		Off:    *jitterOffAccesses,
+		MinOn:  *jitterMinOnDecisions,
+		MinOff: *jitterMinOffDecisions,
+	}
+	if err := hysteresis.Validate(thresholds); err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if err := maid.ValidateHistoryWindow(*jitterHistoryWindow); err != nil {
+		cmd.Fatalf("jitter_history_window: %v", err)
+	}
+	entropyKind, err := boot.MakeJitterEntropyMapping(*jitterEntropyMapping)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	entropy := maid.EntropyMapping{
+		Kind: entropyKind,
+		Min:  *jitterEntropyMin,
+		Max:  *jitterEntropyMax,
+		Step: *jitterEntropyStep,
+	}
+	if err := entropy.Validate(); err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	contention := maid.Contention{
+		MinHITM: *jitterContentionHITM,
+		Boost:   *jitterContentionBoost,
+	}
+	if err := contention.Validate(); err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if *jitterSampleDeadline < 0 {
+		cmd.Fatalf("jitter_sample_deadline must be >= 0, got: %v", *jitterSampleDeadline)
+	}
+	stallAction, err := boot.MakeJitterStallAction(*jitterStallAction)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if *jitterLogMaxSize < 0 || *jitterLogMaxAge < 0 || *jitterLogKeep < 0 {
+		cmd.Fatalf("jitter_log_max_size, jitter_log_max_age and jitter_log_keep must be >= 0, got: %d, %v, %d", *jitterLogMaxSize, *jitterLogMaxAge, *jitterLogKeep)
+	}
+	workDir := *jitterWorkDir
+	if workDir == "" {
+		workDir = filepath.Join(*rootDir, "jitter")
+	}
+	if *jitterInSandbox && schedMode != boot.JitterSchedulingSentry {
+		cmd.Fatalf("jitter_in_sandbox requires jitter_scheduling=sentry")
+	}
+	if sampler == boot.JitterSamplerSentry && !*jitterInSandbox {
+		cmd.Fatalf("jitter_sampler=sentry samples from within the sandbox, it requires jitter_in_sandbox")
+	}
+	if sampler == boot.JitterSamplerSentry {
+		// A page faults once per sample, so the sentry's counts stay far
+		// below the default thresholds, which are access counts.
+		set := make(map[string]bool)
+		flag.CommandLine.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["jitter-min-accesses"] || !set["jitter-spike-accesses"] {
+			cmd.Fatalf("jitter_sampler=sentry counts pages touched, not accesses, it requires explicit jitter_min_accesses and jitter_spike_accesses")
+		}
+	}
+	if *jitterInSandbox && (*jitterDaemon || *jitterRecord != "" || *jitterReplay != "") {
+		cmd.Fatalf("jitter_in_sandbox runs without a monitor, it can't be used with jitter_daemon, jitter_record or jitter_replay")
+	}
+	if *jitterPrivsep && backend != boot.JitterBackendMaid {
+		cmd.Fatalf("jitter_privsep requires jitter_backend=maid, got: %v", backend)
+	}
+	if *jitterPrivsep && (*jitterDaemon || *rootless) {
+		cmd.Fatalf("jitter_privsep splits the monitor of a container started as root, it can't be used with jitter_daemon or rootless")
+	}
+	failurePolicy, err := boot.MakeJitterFailurePolicy(*jitterFailurePolicy)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if failurePolicy != boot.JitterFailOpen && (*jitterPrivsep || *jitterInSandbox) {
+		cmd.Fatalf("jitter_failure_policy=%v acts on the container from the monitor, it can't be used with jitter_privsep or jitter_in_sandbox", failurePolicy)
+	}
+	if *jitterBlindPeriod < 0 {
+		cmd.Fatalf("jitter_blind_period must be positive, got: %v", *jitterBlindPeriod)
+	}
+	if *jitterBlindDuty < 1 || *jitterBlindDuty > 90 {
+		cmd.Fatalf("jitter_blind_duty must be between 1 and 90, got: %d", *jitterBlindDuty)
+	}
+	if *jitterBlindPeriod > 0 && (*jitterPrivsep || *jitterInSandbox) {
+		cmd.Fatalf("jitter_blind_period stops the sandbox from the monitor, it can't be used with jitter_privsep or jitter_in_sandbox")
+	}
+	if *jitterDelayBudget < 0 || *jitterDelayBudget > time.Second {
+		cmd.Fatalf("jitter_delay_budget must be between 0 and 1s, got: %v", *jitterDelayBudget)
+	}
+	if *jitterAuditKey != "" && schedMode != boot.JitterSchedulingMonitor {
+		cmd.Fatalf("jitter_audit_key requires jitter scheduling in the monitor")
+	}
+	if *jitterSymbolize && schedMode != boot.JitterSchedulingMonitor {
+		cmd.Fatalf("jitter_symbolize requires jitter scheduling in the monitor")
+	}
+	symbolRules, err := maid.ParseSymbolRules(*jitterSymbolRules)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if len(symbolRules) != 0 && schedMode != boot.JitterSchedulingMonitor {
+		cmd.Fatalf("jitter_symbol_rules requires jitter scheduling in the monitor")
+	}
+	calendar, err := maid.ParseCalendar(*jitterCalendar)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if *jitterProfileDir != "" && schedMode != boot.JitterSchedulingMonitor {
+		cmd.Fatalf("jitter_profile_dir requires jitter scheduling in the monitor")
+	}
+	if *jitterChaos && schedMode != boot.JitterSchedulingMonitor {
+		cmd.Fatalf("jitter_chaos requires jitter scheduling in the monitor")
+	}
+	if *jitterChaos && *jitterProfileDir != "" {
+		cmd.Fatalf("jitter_chaos can't be used with jitter_profile_dir, which delays learned hot regions")
+	}
+	if *jitterFairTurns && schedMode != boot.JitterSchedulingMonitor {
+		cmd.Fatalf("jitter_fair_turns requires jitter scheduling in the monitor")
+	}
+	if *jitterWidenRadius < 0 || *jitterWidenRadius > maid.MaxWidenRadius {
+		cmd.Fatalf("jitter_widen_radius must be between 0 and %d, got: %d", maid.MaxWidenRadius, *jitterWidenRadius)
+	}
+	if *jitterShuffleInterval != 0 && *jitterShuffleInterval < maid.MinShuffleInterval {
+		cmd.Fatalf("jitter_shuffle_interval must be 0 or at least %v, got: %v", maid.MinShuffleInterval, *jitterShuffleInterval)
+	}
+	if err := (maid.PageTier{Primitive: pageTier, Interval: *jitterPageTierInterval}).Validate(); err != nil {
+		cmd.Fatalf("jitter_page_tier: %v", err)
+	}
+	if *jitterLoadCPU < 0 || *jitterLoadCPU > 1 {
+		cmd.Fatalf("jitter_load_cpu must be in [0, 1], got: %v", *jitterLoadCPU)
+	}
+	if *jitterLoadPressure < 0 || *jitterLoadPressure > 100 {
+		cmd.Fatalf("jitter_load_pressure must be in [0, 100], got: %v", *jitterLoadPressure)
+	}
+	loadLimits := maid.LoadLimits{
+		CPU:      *jitterLoadCPU,
+		Pressure: *jitterLoadPressure,
+	}
+	if loadLimits.Enabled() && *jitterInSandbox {
+		cmd.Fatalf("jitter_load_cpu and jitter_load_pressure are checked by the monitor, they can't be used with jitter_in_sandbox")
+	}
+	loadAction, err := boot.MakeJitterLoadAction(*jitterLoadAction)
+	if err != nil {
+		cmd.Fatalf("%v", err)
+	}
+	if *jitterCPUCompensation && (*jitterInSandbox || *jitterPrivsep || *rootless) {
+		cmd.Fatalf("jitter_cpu_compensation sets the sandbox cgroup from the monitor, it can't be used with jitter_in_sandbox, jitter_privsep or rootless")
+	}
+	if *jitterAlert != "" {
+		if monitor.IsWebhook(*jitterAlert) {
+			if _, err := url.Parse(*jitterAlert); err != nil {
+				cmd.Fatalf("invalid jitter_alert URL %q: %v", *jitterAlert, err)
+			}
+			if !*jitterDaemon {
+				cmd.Fatalf("jitter_alert webhooks require jitter_daemon, the monitor of a sandbox has no network")
+			}
+		} else if !filepath.IsAbs(*jitterAlert) {
+			cmd.Fatalf("jitter_alert must be a webhook URL or the absolute path of a named pipe, got: %q", *jitterAlert)
+		}
+		if *jitterInSandbox || *jitterReplay != "" {
+			cmd.Fatalf("jitter_alert needs live cache counters in the monitor, it can't be used with jitter_in_sandbox or jitter_replay")
+		}
+	}
+	if *jitterIOUring && sampler != boot.JitterSamplerDaptraceEvents {
+		cmd.Fatalf("jitter_io_uring reads netlink sample events, it requires jitter_sampler=daptrace-events, got: %v", sampler)
+	}
+	if *jitterCalibrate < 0 {
+		cmd.Fatalf("jitter_calibrate must be >= 0, got: %d", *jitterCalibrate)
+	}
+	if *jitterCalibrate > 0 && schedMode != boot.JitterSchedulingMonitor {
+		cmd.Fatalf("jitter_calibrate requires jitter scheduling in the monitor")
+	}
+	if *jitterDaemon && backend != boot.JitterBackendMaid {
+		cmd.Fatalf("jitter_daemon requires jitter_backend=maid, got: %v", backend)
+	}
+	if *jitterDaemon && (*jitterRecord != "" || *jitterReplay != "") {
+		cmd.Fatalf("jitter_daemon samples every sandbox of the host, it can't be used with jitter_record or jitter_replay")
+	}
+
 	// Sets the reference leak check mode. Also set it in config below to
 	// propagate it to child processes.
 	refs.SetLeakMode(refsLeakMode)
@@ -255,12 +723,105 @@ func main() {
 		VFS2:               *vfs2Enabled,
 		FUSE:               *fuseEnabled,
 		QDisc:              queueingDiscipline,
+		Jitter:                  *jitterEnabled,
+		JitterHeartbeatInterval: *jitterHeartbeatInterval,
+		JitterHeartbeatAction:   heartbeatAction,
+		JitterMsgBuffer:         *jitterMsgBuffer,
+		JitterMsgDrop:           msgDrop,
+		JitterScheduling:        schedMode,
+		JitterDelayPrimitive:    delayPrimitive,
+		JitterSplitHugePages:    *jitterSplitHugePages,
+		JitterDecoyMode:         decoyMode,
+		JitterDecoyAddrs:        decoyAddrs,
+		JitterDecoyInterval:     *jitterDecoyInterval,
+		JitterClockFuzzRealtime:  clockFuzzRealtime,
+		JitterClockFuzzMonotonic: clockFuzzMonotonic,
+		JitterBackend:           backend,
+		JitterMBAPercent:        *jitterMBAPercent,
+		JitterCATWays:           *jitterCATWays,
+		JitterPrefetch:          prefetch,
+		JitterTargetPolicy:      targetPolicy,
+		JitterSampleScope:       sampleScope,
+		JitterSampler:           sampler,
+		JitterPerfPMU:           perfPMU,
+		JitterWarmUp:            *jitterWarmUp,
+		JitterStartOnExec:       *jitterStartOnExec,
+		JitterBackoff:           backoffPolicy,
+		JitterCompensation:      compensation,
+		JitterRecord:            *jitterRecord,
+		JitterReplay:            *jitterReplay,
+		JitterActivation:        activation,
+		JitterCoResidency:       coResidency,
+		JitterNUMA:              numa,
+		JitterCPUSet:            *jitterCPUSet,
+		JitterCPUSetExclusive:   *jitterCPUSetExclusive,
+		JitterDelayScope:        delayScope,
+		JitterDelayWait:         delayWait,
+		JitterDeferLockHolders:  *jitterDeferLockHolders,
+		JitterHeatDecay:         *jitterHeatDecay,
+		JitterTopK:              *jitterTopK,
+		JitterDaemon:            *jitterDaemon,
+		JitterGoferDelay:        *jitterGoferDelay,
+		JitterGoferHotAccesses:  *jitterGoferHotAccesses,
+		JitterNetDelay:          *jitterNetDelay,
+		JitterThresholds:        thresholds,
+		JitterCalibrate:         *jitterCalibrate,
+		JitterHysteresis:        hysteresis,
+		JitterEntropy:           entropy,
+		JitterContention:        contention,
+		JitterHITMEvent:         *jitterHITMEvent,
+		JitterHistoryWindow:     *jitterHistoryWindow,
+		JitterSampleDeadline:    *jitterSampleDeadline,
+		JitterStallAction:       stallAction,
+		JitterLogMaxSize:        *jitterLogMaxSize,
+		JitterLogMaxAge:         *jitterLogMaxAge,
+		JitterLogKeep:           *jitterLogKeep,
+		JitterWorkDir:           workDir,
+		JitterModule:            *jitterModule,
+		JitterModuleSrc:         *jitterModuleSrc,
+		JitterInSandbox:         *jitterInSandbox,
+		JitterPrivsep:           *jitterPrivsep,
+		JitterAuditKey:          *jitterAuditKey,
+		JitterDelayBudget:       *jitterDelayBudget,
+		JitterFailurePolicy:     failurePolicy,
+		JitterBlindPeriod:       *jitterBlindPeriod,
+		JitterBlindDuty:         *jitterBlindDuty,
+		JitterConfig:            *jitterConfig,
+		JitterSymbolize:         *jitterSymbolize,
+		JitterSymbolRules:       symbolRules,
+		JitterCalendar:          calendar,
+		JitterProfileDir:        *jitterProfileDir,
+		JitterExitReport:        *jitterExitReport,
+		JitterChaos:             *jitterChaos,
+		JitterFairTurns:         *jitterFairTurns,
+		JitterWidenRadius:       *jitterWidenRadius,
+		JitterShuffleInterval:   *jitterShuffleInterval,
+		JitterPageTier:          pageTier,
+		JitterPageTierInterval:  *jitterPageTierInterval,
+		JitterLineTier:          *jitterLineTier,
+		JitterLoadLimits:        loadLimits,
+		JitterLoadAction:        loadAction,
+		JitterCPUCompensation:   *jitterCPUCompensation,
+		JitterAlert:             *jitterAlert,
+		JitterIOUring:           *jitterIOUring,
+		JitterSyscallDelay:      *jitterSyscallDelay,
+		JitterPreemptInterval:   *jitterPreemptInterval,
 		TestOnlyAllowRunAsCurrentUserWithoutChroot: *testOnlyAllowRunAsCurrentUserWithoutChroot,
 		TestOnlyTestNameEnv:                        *testOnlyTestNameEnv,
 	}
 	if len(*straceSyscalls) != 0 {
 		conf.StraceSyscalls = strings.Split(*straceSyscalls, ",")
 	}
+	if len(*jitterSyscalls) != 0 {
+		conf.JitterSyscalls = strings.Split(*jitterSyscalls, ",")
+	}
+	if conf.JitterConfig != "" {
+		c, err := monitor.ReadConfig(conf.JitterConfig, conf)
+		if err != nil {
+			cmd.Fatalf("%v", err)
+		}
+		conf = c
+	}
 
 	// Set up logging.
 	if *debug {
@@ -282,13 +843,17 @@ func main() {
 	subcommand := flag.CommandLine.Arg(0)
 
 	var e log.Emitter
-	if *debugLogFD > -1 {
+	if isDaemonLogFormat(*debugLogFormat) {
+		// The host logging daemon takes the logs of every command.
+		e = newEmitter(*debugLogFormat, nil)
+
+	} else if *debugLogFD > -1 {
 		f := os.NewFile(uintptr(*debugLogFD), "debug log file")
 
 		e = newEmitter(*debugLogFormat, f)
 
 	} else if *debugLog != "" {
-		f, err := specutils.DebugLogFile(*debugLog, subcommand, "" /* name */)
+		f, err := specutils.DebugLogFile(*debugLog, subcommand, "" /* cid */, "" /* name */)
 		if err != nil {
 			cmd.Fatalf("error opening debug log file in %q: %v", *debugLog, err)
 		}
@@ -319,27 +884,23 @@ func main() {
 			cmd.Fatalf("error dup'ing fd %d to stderr: %v", fd, err)
 		}
 	} else if *alsoLogToStderr {
-		e = &log.MultiEmitter{e, newEmitter(*debugLogFormat, os.Stderr)}
+		format := *debugLogFormat
+		if isDaemonLogFormat(format) {
+			format = "text"
+		}
+		e = &log.MultiEmitter{e, newEmitter(format, os.Stderr)}
 	}
 
 	log.SetTarget(e)
 
-	// =========Cijitter: strat a thread to read addr=========
-	if subcommand == "boot" {
-		// init listener thread
-		go listener()
-	}
-
 	if subcommand == "monitor" {
-		log.Debugf("[Cijitter] Start to monitor addr...")
-		
-		// init notifier thread
-		addrChan := make(chan string, 1)
-		go notifier(addrChan)
-
-		//strat the monitor
-		_, cid := filepath.Split(os.Args[35])	// get container id
-		monitor(cid, addrChan)
+		monitor.Run(conf)
+	}
+	if subcommand == "jitter-daemon" {
+		monitor.RunDaemon(conf)
+	}
+	if subcommand == "jitter-helper" {
+		monitor.RunHelper(conf)
 	}
 	/*===========================================*/
 
@@ -389,380 +950,55 @@ func newEmitter(format string, logFile io.Writer) log.Emitter {
 		return log.JSONEmitter{&log.Writer{Next: logFile}}
 	case "json-k8s":
 		return log.K8sJSONEmitter{&log.Writer{Next: logFile}}
+	case "syslog", "journald":
+		return newDaemonEmitter(format)
 	}
-	cmd.Fatalf("invalid log format %q, must be 'text', 'json', or 'json-k8s'", format)
+	cmd.Fatalf("invalid log format %q, must be 'text', 'json', 'json-k8s', 'syslog' or 'journald'", format)
 	panic("unreachable")
 }
 
-func init() {
-	// Set default root dir to something (hopefully) user-writeable.
-	*rootDir = "/var/run/runsc"
-	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
-		*rootDir = filepath.Join(runtimeDir, "runsc")
-	}
+// isDaemonLogFormat returns whether logs of format go to the host logging
+// daemon rather than to a file.
+func isDaemonLogFormat(format string) bool {
+	return format == "syslog" || format == "journald"
 }
 
-//========================================================//
-func listener() {
-	reader := os.NewFile(uintptr(13), "reader")
-	defer reader.Close()
-
-	for {
-		var data interface{}
-		decoder := json.NewDecoder(reader)
-		if err := decoder.Decode(&data); err == nil {
-			log.Debugf("[Cijitter] Addr received from child pipe: %v\n", data)
-			addrInfo := fmt.Sprintf("%v", data)
-			maid.Listen_target_addrs(addrInfo)
-		}
+// newDaemonEmitter returns an emitter to the host logging daemon of format.
+// Messages are tagged with the subcommand, e.g. runsc-monitor.
+func newDaemonEmitter(format string) log.Emitter {
+	path := log.SyslogSocket
+	if format == "journald" {
+		path = log.JournaldSocket
 	}
-	log.Debugf("[Cijitter] Addr listener finished!")
-}
-
-func notifier(msgChan chan string) {
-	writer := os.NewFile(uintptr(11), "writer")
-	defer writer.Close()
-
-	for{
-		msg := <-msgChan
-		err := json.NewEncoder(writer).Encode(msg)
-		if err != nil {
-			log.Debugf("[Cijitter] Addr sended failed: %v", err)
-		}
-	}
-	log.Debugf("[Cijitter] Addr notifier finished!")
-}
-
-var duration int = 8050
-var interval int = 500
-func monitor(cid string, msgChan chan string) {
-	log.Debugf("[Cijitter] Monitor start...")
-
-	// judge if it needs to delay
-	var last_addr_acc = [3]int{500, 500, 500}
-	var last_delay = [3]bool{true, true, true}
-	index := 0
-
-	// delay duration
-	delay_duration := time.Duration(duration)		//6750-300, 9000-400
-	delay_interval := time.Duration(interval)
-
-	time.Sleep(40 * time.Second)
-
-	for {
-		// call kernel module
-		addr, acc_num, err := get_target_addr()
-		if !err {
-			log.Debugf("[Cijitter] failed to get target address...")
-			time.Sleep(delay_interval * time.Millisecond)
-			continue
-		}
-
-		log.Debugf("[Cijitter] addr: %s, access: %d", addr, acc_num)
-		addr_acc := addr + " " + strconv.Itoa(acc_num)
-
-		inx := index % 3
-		//decide the duration of delaying
-		delay_int, dstats := delayStates(last_delay, index, delay_interval)
-		delay_interval = delay_int
-		index++
-
-		//make up
-		old_acc := last_addr_acc[inx]
-		last_acc := last_addr_acc[(inx+2)%3]
-		acc_cmp := 0
-                if dstats && (acc_num < last_acc) {
-			acc_cmp = acc_num + int(float64(last_acc - acc_num) * 0.67)
-		} else {
-			acc_cmp = acc_num
-		}
-                last_addr_acc[inx] = acc_cmp
-
-		if acc_num > 3000 {
-			last_addr_acc[inx] = old_acc
-		} else if acc_cmp <= 80 || !judge_delay(last_addr_acc, inx) {
-			log.Debugf("[Cijitter] this is a strip, pass... %d\n", acc_num)
-			// delay in last time
-			if dstats {
-				last_addr_acc[inx] = old_acc
-			}
-			// log delay status
-			last_delay[inx] = false
-			time.Sleep(delay_interval * time.Millisecond)
-			continue
-		}
-
-		// notify: delay target address
-		if strings.Contains(addr, "0x"){
-			log.Debugf("[Cijitter] start to send addr %s", cid)
-			msgChan <- addr_acc
-		}
-
-		// delay time window
-		time.Sleep(delay_duration * time.Millisecond)
-
-		// notify: stop delay target address
-		log.Debugf("[Cijitter] stop delay and start to profiling %s", cid)
-		stopSig := "0x00000 0"
-		msgChan <- stopSig
-		last_delay[inx] = true
-
-		//keep sampling stable
-		delay_interval = time.Duration(interval)
-		time.Sleep(delay_interval * time.Millisecond)
-	}
-}
-
-func delayStates(last_delay [3]bool, index int, delay_interval time.Duration) (time.Duration, bool) {
-	status := true
-	// judge last delay status
-	if index == 0 {
-		return time.Duration(interval), true
-	}
-
-	idx := (index-1)%3
-	status = last_delay[idx]
-
-	for i:=0; i<3; i++ {
-		if last_delay[index%3] {
-			return time.Duration(interval), status
-		}
-	}
-	delay_interval = delay_interval * 10
-	if delay_interval > time.Duration(30000) {
-		delay_interval = time.Duration(30000)
-	}
-	return delay_interval, status
-}
-
-func judge_delay(access [3]int, index int) bool {
-	//return true
-	sum := 0
-	for i:=0; i<3; i++ {
-		log.Debugf("[Cijitter] access is %d", access[i])
-		sum += access[i]
-	}
-	mean := float64(sum)/3.0
-
-	std := 0.0
-	for i := 0; i < 3; i++ {
-		std = std + (float64(access[i]) - mean) * (float64(access[i]) - mean)
-    	}
-	stddev := math.Sqrt(std)
-
-	diff := 0
-	ratio := 0.0
-	count := 0.0
-	if access[index] > access[(index+2)%3] {
-		diff = access[index] - access[(index+2)%3]
-		count = float64(diff)/float64(access[(index+2)%3])
-	} else {
-		diff = access[(index+2)%3] - access[index]
-		count = float64(diff)/float64(access[(index+2)%3])
-	}
-	ratio = stddev/mean
-
-	if count <= 0.1 || ratio <= 0.2 || (ratio <= 0.35 && count <= 0.35) {
-		if mean < 100.0 {
-			return false
-		}
-		return true
-	} else{
-		return false
-	}
-}
-
-//call kernel module to get target address
-var basePath string = "/monitor/"
-var logPath string = basePath + "log/targetAddrs.list"
-var kernelPath string = basePath + "kernel/"
-
-//call kernel module to get target address
-func read_sample_logs() ([]string, map[string]int) {
-	var addr_access map[string]int
-    	addr_access = make(map[string]int)
-	var addrs_order []string
-	addr := "0x000000"
-	access := 0
-
-    	fp, err := os.Open(logPath)
-    	if err != nil {
-		log.Debugf("[Cijitter] read_sample_logs: open log file failed: %s", err)
-		return addrs_order, addr_access
-    	}
-    	defer fp.Close()
-
-    	data := make([]byte, 8)
-    	var k int64
-    	index := 0
-    	loc := 0
-
-    	for {
-        	data = data[:cap(data)]
-
-        	// read bytes to slice
-        	n, err := fp.Read(data)
-        	if err != nil {
-            	if err == io.EOF {
-                	break
-            	}
-            	break
-        }
-
-        data = data[:n]
-	binary.Read(bytes.NewBuffer(data), binary.LittleEndian, &k)
-
-	// get address
-	if index % 3 == 0 {
-		addr = fmt.Sprintf("0x%x", k)
-		addrs_order = append(addrs_order, addr)
-		loc = index + 2
-	}
-	// get access number of the address
-	if index == loc {
-		access = int(k)
-		addr_access[addr] = access
-	}
-	index ++
-    }
-
-    return addrs_order, addr_access
-}
-
-func get_pid() []string {
-	var pids []string
-
-	command := "ps -aux | grep nobody | grep exe | grep -v grep"
-	cmd := exec.Command("bash", "-c", command)
-	output, err := cmd.Output()
+	conn, err := net.Dial("unixgram", path)
 	if err != nil {
-		log.Debugf("[Cijitter] get pid failed:", err, output)
-		return pids
+		cmd.Fatalf("error connecting to %s at %q: %v", format, path, err)
 	}
-
-	max_cpu := 0.0
-	target_pid := "-1"
-	items := strings.Split(string(output), "\n")
-	for _, item := range items {
-		result := strings.Join(strings.Fields(item)," ")
-		datas := strings.Split(result, " ")
-
-		if len(datas) == 1 {
-			continue
-		}
-
-		pid := datas[1]
-		cpu := datas[2]
-		mem := datas[3]
-		//rss := datas[5]
-		time := datas[9]
-
-		if mem != "0.0" || cpu != "0.0" || time != "0:00" {
-			cpu_data, _ := strconv.ParseFloat(cpu, 64)
-			if cpu_data > max_cpu {
-				max_cpu = cpu_data
-				target_pid = pid
-			}
-		}
+	tag := "runsc"
+	if sub := flag.CommandLine.Arg(0); sub != "" {
+		tag += "-" + sub
 	}
-
-	if target_pid != "-1" {
-		pids = append(pids, target_pid) 
+	if format == "journald" {
+		return log.JournaldEmitter{Next: conn, Tag: tag}
 	}
-
-	return pids
+	return log.SyslogEmitter{Next: conn, Tag: tag}
 }
 
-var DBGFS string ="/sys/kernel/debug/mapia/"
-var DBGFS_ATTRS string = DBGFS + "attrs"
-var DBGFS_PIDS string = DBGFS + "pids"
-var DBGFS_TRACING_ON string = DBGFS + "tracing_on"
-
-func chk_prerequisites() bool {
-	// save old log file
-	logf, err := os.Stat(logPath)
-	if err == nil && !logf.IsDir(){
-		os.Rename(logPath, logPath + ".old")
-	} else {
-		log.Debugf("[Cijitter] delete old log failed: %s", err)
-	}
-
-	// check kernel module
-	kernel, err_kernel := os.Stat(DBGFS)
-	if err_kernel != nil || !kernel.IsDir() {
-		command := "cd " + kernelPath + " && sudo insmod daptrace.ko"
-		cmd := exec.Command("bash", "-c", command)
-		output, err := cmd.Output()
-		if err != nil {
-			log.Debugf("[Cijitter] kernel module load faild: %s, %s", err, output)
-			return false
-		}
-	}
-
-	pids, err_pids := os.Stat(DBGFS_PIDS)
-	if err_pids != nil || pids.IsDir() {
-		log.Debugf("[Cijitter] kmapia pids file not exists: %s", err_pids)
-		return false
-	}
-
-	return true
+// emitterWriter writes the error log to a log emitter.
+type emitterWriter struct {
+	log.Emitter
 }
 
-func exit_handler() bool {
-	command := "sudo rmmod daptrace"
-	cmd := exec.Command("bash", "-c", command)
-	output, err := cmd.Output()
-	if err != nil {
-		log.Debugf("[Cijitter] rmmod kernel module failed:", err, output)
-		return false
-	}
-
-	return true
+// Write implements io.Writer.Write.
+func (w emitterWriter) Write(b []byte) (int, error) {
+	w.Emit(0, log.Warning, time.Now(), "%s", b)
+	return len(b), nil
 }
 
-func get_target_addr() (string, int, bool) {
-	addr := ""
-	access := -1
-	targets := get_pid()
-	if len(targets) == 0 {
-		log.Debugf("[Cijitter] CANNOT GET TARGET PID...")
-		return addr, access, false
-	}
-
-    	// strat kernel module
-    	for _, pid := range targets {
-		stat := chk_prerequisites()
-		if !stat {
-			return addr, access, false
-		}
-
-		command := "sudo echo " + pid + " > " + DBGFS_PIDS
-		cmd := exec.Command("bash", "-c", command)
-		cmd.Output()
-
-		command = "sudo echo on > " + DBGFS_TRACING_ON
-		cmd = exec.Command("bash", "-c", command)
-		cmd.Output()
-
-		// sampling duration
-		time.Sleep(100 * time.Millisecond) // 0.1 seconds
-
-		command = "sudo echo off > " + DBGFS_TRACING_ON
-		cmd = exec.Command("bash", "-c", command)
-		cmd.Output()
-
-		if !exit_handler() {
-			break
-		}
-
-		// get the target addr
-		addr_order, addrs_access := read_sample_logs()
-		if len(addr_order) == 0 {
-			return addr, access, false
-		}
-
-		return addr_order[0], addrs_access[addr_order[0]], true
+func init() {
+	// Set default root dir to something (hopefully) user-writeable.
+	*rootDir = "/var/run/runsc"
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		*rootDir = filepath.Join(runtimeDir, "runsc")
 	}
-
-	return addr, access, false
 }
@@ -0,0 +1,115 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+const (
+	// alertInterval is the minimum time between two alerts of the same
+	// kind about a sandbox.
+	alertInterval = time.Minute
+
+	// alertTimeout bounds the delivery of an alert.
+	alertTimeout = 5 * time.Second
+)
+
+// IsWebhook returns whether the --jitter-alert target is a webhook URL rather
+// than a named pipe.
+func IsWebhook(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// alerter delivers the alerts about a sandbox to the --jitter-alert target.
+type alerter struct {
+	cid     string
+	target  string
+	limiter *maid.AlertLimiter
+	client  *http.Client
+}
+
+// newAlerter returns the alerter of container cid, or nil if --jitter-alert
+// isn't set.
+func newAlerter(conf *boot.Config, cid string) *alerter {
+	if conf.JitterAlert == "" {
+		return nil
+	}
+	return &alerter{
+		cid:     cid,
+		target:  conf.JitterAlert,
+		limiter: maid.NewAlertLimiter(alertInterval),
+		client:  &http.Client{Timeout: alertTimeout},
+	}
+}
+
+// raise sends a, unless an alert of the same kind was sent recently. It
+// doesn't wait for delivery. a may be nil, in which case it does nothing.
+func (a *alerter) raise(al maid.Alert) {
+	if a == nil {
+		return
+	}
+	al.Container = a.cid
+	if al.Time.IsZero() {
+		al.Time = time.Now()
+	}
+	if !a.limiter.Allow(al.Kind, al.Time) {
+		return
+	}
+	log.Infof("[Cijitter] raising %s alert about %q", al.Kind, a.cid)
+	go func() {
+		if err := a.deliver(al); err != nil {
+			log.Warningf("[Cijitter] delivering %s alert about %q to %q: %v", al.Kind, a.cid, a.target, err)
+		}
+	}()
+}
+
+// deliver posts al to the webhook or writes it as a line to the named pipe.
+func (a *alerter) deliver(al maid.Alert) error {
+	data, err := json.Marshal(al)
+	if err != nil {
+		return err
+	}
+	if IsWebhook(a.target) {
+		resp, err := a.client.Post(a.target, "application/json", bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("webhook answered %s", resp.Status)
+		}
+		return nil
+	}
+	// Don't block if nothing reads the pipe, the alert is lost then.
+	f, err := os.OpenFile(a.target, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
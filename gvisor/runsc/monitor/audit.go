@@ -0,0 +1,63 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+// auditLogName is the audit log of the delays injected into a container, in
+// the working directory of its monitor.
+const auditLogName = "audit.log"
+
+// readAuditKey reads the host key the audit log is signed with from path.
+func readAuditKey(path string) (maid.AuditKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading audit key: %v", err)
+	}
+	return maid.ParseAuditKey(data)
+}
+
+// openAuditLog opens the audit log in dir, signed with the host key selected
+// in conf, and continues its chain. With --jitter-privsep, the helper holds
+// the key and signs the records.
+func openAuditLog(conf *boot.Config, dir string) (*maid.AuditLog, *os.File, error) {
+	var signer maid.AuditSigner = jitterHelper
+	if jitterHelper == nil {
+		key, err := readAuditKey(conf.JitterAuditKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer = key
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, auditLogName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	last, err := maid.LastAuditRecord(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return maid.NewAuditLog(f, signer, last), f, nil
+}
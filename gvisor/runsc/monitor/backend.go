@@ -0,0 +1,213 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/jitter"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/resctrl"
+)
+
+// newDelayBackend returns the delayer of the backend selected in conf.
+func newDelayBackend(s *jitterSession, conf *boot.Config) (jitter.Delayer, error) {
+	switch conf.JitterBackend {
+	case boot.JitterBackendMaid:
+		return &jitter.MessageDelayer{Notifier: jitter.NotifierFunc(s.send)}, nil
+	case boot.JitterBackendMBA:
+		return newMBABackend(s.cid, conf.JitterMBAPercent)
+	case boot.JitterBackendCAT:
+		return newCATBackend(s.cid, conf.JitterCATWays)
+	default:
+		return nil, fmt.Errorf("unknown jitter backend %v", conf.JitterBackend)
+	}
+}
+
+// mbaBackend throttles the memory bandwidth of the whole sandbox with Intel
+// MBA while a delay window is open. It is coarser than delaying single
+// accesses, but adds no jitter of its own to the sandbox's latency.
+//
+// The resource group is left behind when the monitor is killed and removed
+// when the container is destroyed.
+type mbaBackend struct {
+	group *resctrl.Group
+
+	// pid is the sandbox process currently in group, or 0.
+	pid int
+}
+
+func newMBABackend(cid string, percent int) (*mbaBackend, error) {
+	if !resctrl.Supported(resctrl.ResourceMB) {
+		return nil, fmt.Errorf("memory bandwidth allocation is not available, is resctrl mounted?")
+	}
+	if min, err := resctrl.Info(resctrl.ResourceMB, "min_bandwidth"); err == nil && percent < min {
+		log.Warningf("[Cijitter] MBA throttle of %d%% is below the host minimum, using %d%%", percent, min)
+		percent = min
+	}
+	g, err := resctrl.NewGroup(resctrl.GroupName(cid))
+	if err != nil {
+		return nil, err
+	}
+	if err := g.SetSchemata(resctrl.ResourceMB, strconv.Itoa(percent)); err != nil {
+		g.Destroy()
+		return nil, err
+	}
+	return &mbaBackend{group: g}, nil
+}
+
+// Start implements jitter.Delayer.Start. The throttle is the same whatever the
+// intensity of the window.
+func (b *mbaBackend) Start([]maid.Target, float64, maid.WaitMode) error {
+	pid, err := sandboxPid()
+	if err != nil {
+		return err
+	}
+	if err := b.group.AddProcess(pid); err != nil {
+		return err
+	}
+	b.pid = pid
+	return nil
+}
+
+// Update implements jitter.Delayer.Update. The whole sandbox is throttled
+// whatever its targets.
+func (*mbaBackend) Update([]maid.Target) error {
+	return nil
+}
+
+// Stop implements jitter.Delayer.Stop.
+func (b *mbaBackend) Stop() error {
+	if b.pid == 0 {
+		return nil
+	}
+	pid := b.pid
+	b.pid = 0
+	return resctrl.RemoveProcess(pid)
+}
+
+// catBackend isolates the sandbox into dedicated last level cache ways with
+// Intel CAT while a delay window is open. The ways are taken away from the
+// default resource group for the duration of the window, so that nothing
+// outside the sandbox can prime or probe them.
+//
+// If the monitor is killed during a window the default group keeps the
+// reduced allocation until it is reset by hand.
+type catBackend struct {
+	group *resctrl.Group
+
+	// shared is the capacity bitmask left to the default group during a
+	// window.
+	shared uint64
+
+	// saved is the L3 allocation of the default group before the window.
+	saved string
+
+	// pid is the sandbox process currently in group, or 0.
+	pid int
+}
+
+func newCATBackend(cid string, ways int) (*catBackend, error) {
+	if !resctrl.Supported(resctrl.ResourceL3) {
+		return nil, fmt.Errorf("cache allocation is not available, is resctrl mounted?")
+	}
+	full, err := resctrl.CacheMask(resctrl.ResourceL3)
+	if err != nil {
+		return nil, err
+	}
+	total := bits.Len64(full)
+	min, err := resctrl.Info(resctrl.ResourceL3, "min_cbm_bits")
+	if err != nil {
+		min = 1
+	}
+	if ways < min || total-ways < min {
+		return nil, fmt.Errorf("cannot reserve %d of %d cache ways, each side needs at least %d", ways, total, min)
+	}
+	exclusive := (uint64(1)<<uint(ways) - 1) << uint(total-ways)
+
+	g, err := resctrl.NewGroup(resctrl.GroupName(cid))
+	if err != nil {
+		return nil, err
+	}
+	if err := g.SetSchemata(resctrl.ResourceL3, strconv.FormatUint(exclusive, 16)); err != nil {
+		g.Destroy()
+		return nil, err
+	}
+	return &catBackend{group: g, shared: full &^ exclusive}, nil
+}
+
+// Start implements jitter.Delayer.Start. The isolation is the same whatever the
+// intensity of the window.
+func (b *catBackend) Start([]maid.Target, float64, maid.WaitMode) error {
+	pid, err := sandboxPid()
+	if err != nil {
+		return err
+	}
+	def := resctrl.DefaultGroup()
+	saved, err := def.Schemata(resctrl.ResourceL3)
+	if err != nil {
+		return err
+	}
+	if err := def.SetSchemata(resctrl.ResourceL3, strconv.FormatUint(b.shared, 16)); err != nil {
+		return err
+	}
+	b.saved = saved
+	if err := b.group.AddProcess(pid); err != nil {
+		b.restore()
+		return err
+	}
+	b.pid = pid
+	return nil
+}
+
+// Update implements jitter.Delayer.Update. The whole sandbox is isolated
+// whatever its targets.
+func (*catBackend) Update([]maid.Target) error {
+	return nil
+}
+
+// Stop implements jitter.Delayer.Stop.
+func (b *catBackend) Stop() error {
+	if b.pid == 0 {
+		return nil
+	}
+	pid := b.pid
+	b.pid = 0
+	err := resctrl.RemoveProcess(pid)
+	if rerr := b.restore(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// restore gives the reserved ways back to the default group.
+func (b *catBackend) restore() error {
+	saved := b.saved
+	b.saved = ""
+	return resctrl.DefaultGroup().SetSchemataDomains(resctrl.ResourceL3, saved)
+}
+
+// sandboxPid returns the PID of the sandbox process.
+func sandboxPid() (int, error) {
+	pids := get_pid()
+	if len(pids) == 0 {
+		return 0, fmt.Errorf("sandbox process not found")
+	}
+	return strconv.Atoi(pids[0])
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"math/rand"
+	"syscall"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/container"
+)
+
+// blindThrottler stops the whole sandbox for a random part of every period
+// when no sampler is available, so that the workload gets some protection
+// without knowing which pages to delay. The sandbox process is stopped with
+// SIGSTOP, which takes the sentry and, with it, every task of the sandbox.
+type blindThrottler struct {
+	period time.Duration
+	duty   int
+	rand   *rand.Rand
+
+	// pid is the PID of the sandbox process.
+	pid int
+}
+
+// newBlindThrottler returns the throttler of container cid as conf says.
+func newBlindThrottler(conf *boot.Config, cid string) (*blindThrottler, error) {
+	c, err := container.Load(conf.RootDir, cid)
+	if err != nil {
+		return nil, fmt.Errorf("loading container: %v", err)
+	}
+	if c.Sandbox == nil || c.Sandbox.Pid == 0 {
+		return nil, fmt.Errorf("sandbox of container %q is not running", cid)
+	}
+	return &blindThrottler{
+		period: conf.JitterBlindPeriod,
+		duty:   conf.JitterBlindDuty,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		pid:    c.Sandbox.Pid,
+	}, nil
+}
+
+// next returns how long to let the sandbox run, then stop it, in the next
+// period. The stop lasts between half and one and a half times the duty
+// cycle, at a random point of the period, so that its timing can't be
+// learned.
+func (b *blindThrottler) next() (run, stop time.Duration) {
+	mean := b.period * time.Duration(b.duty) / 100
+	stop = mean/2 + time.Duration(b.rand.Int63n(int64(mean)+1))
+	if stop > b.period {
+		stop = b.period
+	}
+	run = time.Duration(b.rand.Int63n(int64(b.period-stop) + 1))
+	return run, stop
+}
+
+// run throttles the sandbox until s ends. The sandbox is let run while it is
+// suspended or out of its calendar, and always once run returns.
+func (b *blindThrottler) run(s *jitterSession) {
+	log.Warningf("[Cijitter] no sampler available for %q, stopping it %d%% of every %v in blind mode", s.cid, b.duty, b.period)
+	cal := newProtectionCalendar(s)
+	for {
+		run, stop := b.next()
+		if !s.sleep(run) {
+			return
+		}
+		if s.isSuspended() || !cal.protects() {
+			if !s.sleep(b.period - run) {
+				return
+			}
+			continue
+		}
+		if err := syscall.Kill(b.pid, syscall.SIGSTOP); err != nil {
+			log.Warningf("[Cijitter] stopping sandbox of %q: %v, blind mode ends", s.cid, err)
+			return
+		}
+		ended := !s.sleep(stop)
+		if err := syscall.Kill(b.pid, syscall.SIGCONT); err != nil {
+			log.Warningf("[Cijitter] resuming sandbox of %q: %v, blind mode ends", s.cid, err)
+			return
+		}
+		if ended || !s.sleep(b.period-run-stop) {
+			return
+		}
+	}
+}
+
+// runBlind throttles the sandbox of s in blind mode until s ends.
+func runBlind(s *jitterSession, conf *boot.Config) {
+	b, err := newBlindThrottler(conf, s.cid)
+	if err != nil {
+		s.lost(fmt.Errorf("starting blind mode: %v", err))
+		return
+	}
+	s.policy.SetCalendar(conf.JitterCalendar)
+	b.run(s)
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// protectionCalendar tells whether the calendar of a session's policy
+// protects its sandbox now. The calendar can change on reloads, the labels of
+// the container can't: they are the annotations of its spec.
+type protectionCalendar struct {
+	s      *jitterSession
+	labels map[string]string
+
+	// active is the outcome of the last check.
+	active bool
+}
+
+// newProtectionCalendar returns the protectionCalendar of s.
+func newProtectionCalendar(s *jitterSession) *protectionCalendar {
+	c := &protectionCalendar{s: s, active: true}
+	spec, err := specutils.ReadSpec(s.bundleDir)
+	if err != nil {
+		// Label entries then never match, schedules still apply.
+		log.Warningf("[Cijitter] reading the labels of %q: %v", s.cid, err)
+		return c
+	}
+	c.labels = spec.Annotations
+	return c
+}
+
+// protects returns whether the sandbox is protected now.
+func (c *protectionCalendar) protects() bool {
+	cal := c.s.policy.Calendar()
+	active := cal.Active(time.Now(), c.labels)
+	if active != c.active {
+		if active {
+			log.Infof("[Cijitter] %q entered its jitter calendar %q, delays resume", c.s.cid, cal)
+		} else {
+			log.Infof("[Cijitter] %q left its jitter calendar %q, nothing is delayed until it enters it again", c.s.cid, cal)
+		}
+	}
+	c.active = active
+	return active
+}
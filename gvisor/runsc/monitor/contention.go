@@ -0,0 +1,150 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// hitmPeriod is the number of HITM loads between two samples. They are rare
+// outside of contention, so most of them are sampled.
+const hitmPeriod = 4
+
+// hitmSampler is a sampler that samples the loads hitting a cache line
+// modified by another core.
+type hitmSampler interface {
+	// hitmLoads returns the data addresses of the HITM loads sampled by the
+	// last sample.
+	hitmLoads() []usermem.Addr
+}
+
+// contentionSampler samples the HITM loads of the target processes, as perf
+// c2c does, while another sampler samples them.
+type contentionSampler struct {
+	sampler
+
+	// config is the raw hardware event counting HITM loads.
+	config uint64
+
+	// paranoid is the value of kernel.perf_event_paranoid.
+	paranoid int
+
+	// threadScope is set if the IDs to sample are threads rather than
+	// processes.
+	threadScope bool
+
+	// disabled is set once the HITM event can't be opened on any thread,
+	// e.g. because the host's PMU doesn't have it.
+	disabled bool
+
+	// loads are the HITM loads sampled by the last sample.
+	loads []usermem.Addr
+}
+
+// newContentionSampler wraps s with the sampling of the HITM loads counted by
+// the raw hardware event config. threadScope is set if s samples threads
+// rather than processes.
+func newContentionSampler(s sampler, config uint64, threadScope bool) (*contentionSampler, error) {
+	paranoid, err := perfParanoid()
+	if err != nil {
+		return nil, err
+	}
+	c := &contentionSampler{sampler: s, config: config, paranoid: paranoid, threadScope: threadScope}
+	if !pathExists(cpuPMUPath) {
+		log.Warningf("[Cijitter] the host has no PMU, e.g. a virtual machine without a virtualized one: cross-core contention won't be observed")
+		c.disabled = true
+	}
+	return c, nil
+}
+
+// sample implements sampler.sample.
+func (s *contentionSampler) sample(pids []string, d time.Duration) ([]string, map[string]int, error) {
+	s.loads = nil
+	events := s.openEvents(pids)
+	defer func() {
+		for _, e := range events {
+			e.close()
+		}
+	}()
+	for _, e := range events {
+		unix.IoctlSetInt(e.fd, unix.PERF_EVENT_IOC_ENABLE, 0)
+	}
+	addrs, access, err := s.sampler.sample(pids, d)
+	for _, e := range events {
+		unix.IoctlSetInt(e.fd, unix.PERF_EVENT_IOC_DISABLE, 0)
+	}
+	if err != nil {
+		return addrs, access, err
+	}
+	for _, e := range events {
+		e.drain(func(_ int, addr uint64) {
+			if addr != 0 {
+				s.loads = append(s.loads, usermem.Addr(addr))
+			}
+		})
+	}
+	return addrs, access, nil
+}
+
+// openEvents opens a disabled HITM sampling event on every thread of pids.
+// Threads it can't sample are skipped.
+func (s *contentionSampler) openEvents(pids []string) []*perfEvent {
+	if s.disabled {
+		return nil
+	}
+	var (
+		events []*perfEvent
+		tried  bool
+		err    error
+	)
+	for _, pid := range pids {
+		tids, listErr := threadsToSample(pid, s.threadScope)
+		if listErr != nil {
+			continue
+		}
+		for _, tid := range tids {
+			tried = true
+			var e *perfEvent
+			if e, err = openHITMEvent(tid, s.paranoid, s.config); err != nil {
+				// The thread may have exited meanwhile.
+				log.Debugf("[Cijitter] opening HITM event on thread %d failed: %v", tid, err)
+				continue
+			}
+			events = append(events, e)
+		}
+	}
+	if tried && len(events) == 0 {
+		log.Warningf("[Cijitter] HITM event %#x can't be sampled: %v, cross-core contention won't be observed", s.config, err)
+		s.disabled = true
+	}
+	return events
+}
+
+// hitmLoads implements hitmSampler.hitmLoads.
+func (s *contentionSampler) hitmLoads() []usermem.Addr {
+	return s.loads
+}
+
+// lines implements lineSampler.lines.
+func (s *contentionSampler) lines() map[usermem.Addr]uint64 {
+	if ls, ok := s.sampler.(lineSampler); ok {
+		return ls.lines()
+	}
+	return nil
+}
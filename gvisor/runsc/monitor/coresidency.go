@@ -0,0 +1,210 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cgroup"
+)
+
+// coResidencyInterval is how often the monitor checks the host for workloads
+// sharing cores or cache with the sandbox. Workloads come and go, so the
+// answer doesn't hold for long.
+const coResidencyInterval = 30 * time.Second
+
+// sysCPUPath is where the kernel exposes the CPU topology.
+const sysCPUPath = "/sys/devices/system/cpu"
+
+// coResidency tracks whether the sandbox shares physical cores or last level
+// cache with other host workloads. Attacks need a co-resident attacker, so a
+// sandbox on dedicated cores needs less, or no, jitter.
+type coResidency struct {
+	mode boot.JitterCoResidency
+	sel  *targetSelector
+
+	// next is when the host is checked again.
+	next time.Time
+
+	// isolated is the outcome of the last check.
+	isolated bool
+}
+
+// newCoResidency returns a coResidency checking the sandbox of sel.
+func newCoResidency(mode boot.JitterCoResidency, sel *targetSelector) *coResidency {
+	return &coResidency{mode: mode, sel: sel}
+}
+
+// dedicated returns whether the sandbox runs on dedicated cores. The host is
+// inspected at most every coResidencyInterval.
+func (c *coResidency) dedicated() bool {
+	if time.Now().Before(c.next) {
+		return c.isolated
+	}
+	c.next = time.Now().Add(coResidencyInterval)
+
+	procs, err := c.sel.sandboxProcesses()
+	if err != nil {
+		log.Debugf("[Cijitter] co-residency check failed: %v", err)
+		return c.isolated
+	}
+	others, err := coResidents(procs)
+	if err != nil {
+		log.Debugf("[Cijitter] co-residency check failed: %v", err)
+		return c.isolated
+	}
+	isolated := len(others) == 0
+	if isolated != c.isolated {
+		if isolated {
+			log.Infof("[Cijitter] sandbox runs on dedicated cores, jitter co-residency mode %v applies", c.mode)
+		} else {
+			log.Infof("[Cijitter] sandbox shares cores or cache with processes %v, jitter restored", others)
+		}
+	}
+	c.isolated = isolated
+	return isolated
+}
+
+// coResidents returns the PIDs of the host processes outside of sandbox which
+// may run on a CPU sharing a core or the last level cache with a CPU the
+// sandbox may run on.
+func coResidents(sandbox []hostProcess) ([]int, error) {
+	inSandbox := make(map[int]bool, len(sandbox))
+	sandboxCPUs := make(map[int]bool)
+	for _, p := range sandbox {
+		inSandbox[p.pid] = true
+		cpus, err := allowedCPUs(p.pid)
+		if err != nil {
+			// The process may have exited meanwhile.
+			continue
+		}
+		for _, cpu := range cpus {
+			sandboxCPUs[cpu] = true
+		}
+	}
+	if len(sandboxCPUs) == 0 {
+		return nil, fmt.Errorf("no CPU found for the sandbox")
+	}
+
+	domain := make(map[int]bool)
+	for cpu := range sandboxCPUs {
+		shared, err := sharingCPUs(cpu)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range shared {
+			domain[s] = true
+		}
+	}
+
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	var others []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == self || inSandbox[pid] {
+			continue
+		}
+		p, err := readHostProcess(pid)
+		if err != nil || isKernelThread(p) {
+			continue
+		}
+		cpus, err := allowedCPUs(pid)
+		if err != nil {
+			continue
+		}
+		for _, cpu := range cpus {
+			if domain[cpu] {
+				others = append(others, pid)
+				break
+			}
+		}
+	}
+	sort.Ints(others)
+	return others, nil
+}
+
+// isKernelThread returns whether p is a kernel thread. Per-CPU kernel threads
+// run everywhere but aren't workloads.
+func isKernelThread(p hostProcess) bool {
+	return p.pid == 2 || p.ppid == 2
+}
+
+// allowedCPUs returns the CPUs pid may run on.
+func allowedCPUs(pid int) ([]int, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "Cpus_allowed_list:") {
+			return cgroup.ParseCpuset(strings.TrimSpace(strings.TrimPrefix(line, "Cpus_allowed_list:")))
+		}
+	}
+	return nil, fmt.Errorf("no Cpus_allowed_list in /proc/%d/status", pid)
+}
+
+// sharingCPUs returns the CPUs sharing a physical core or the last level
+// cache with cpu, including cpu.
+func sharingCPUs(cpu int) ([]int, error) {
+	cpuDir := filepath.Join(sysCPUPath, fmt.Sprintf("cpu%d", cpu))
+	cpus, err := readCPUList(filepath.Join(cpuDir, "topology", "thread_siblings_list"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The last level cache is the cache index with the highest level.
+	indexes, _ := filepath.Glob(filepath.Join(cpuDir, "cache", "index*"))
+	llc, maxLevel := "", 0
+	for _, index := range indexes {
+		data, err := ioutil.ReadFile(filepath.Join(index, "level"))
+		if err != nil {
+			continue
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && level > maxLevel {
+			llc, maxLevel = index, level
+		}
+	}
+	if llc != "" {
+		shared, err := readCPUList(filepath.Join(llc, "shared_cpu_list"))
+		if err != nil {
+			return nil, err
+		}
+		cpus = append(cpus, shared...)
+	}
+	return cpus, nil
+}
+
+// readCPUList reads a file containing a CPU list.
+func readCPUList(path string) ([]int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return cgroup.ParseCpuset(strings.TrimSpace(string(data)))
+}
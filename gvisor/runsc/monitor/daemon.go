@@ -0,0 +1,206 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cmd"
+	"gvisor.dev/gvisor/runsc/container"
+)
+
+// daemonScanInterval is how often the jitter daemon looks for sandboxes to
+// take over and for sandboxes that are gone.
+const daemonScanInterval = time.Second
+
+// RunDaemon monitors every sandbox under the root directory that was
+// created with --jitter-daemon, with a single sampler shared by all of them.
+// It hands each sandbox an address channel over its control socket, as a
+// reconnecting monitor would, and monitors it with the jitter parameters it
+// was created with. It never returns.
+func RunDaemon(conf *boot.Config) {
+	log.Infof("[Cijitter] Jitter daemon started, watching %q", conf.RootDir)
+	// The samples of all sandboxes go through the same module, in turn.
+	dir, err := monitorWorkDir(conf, "jitter-daemon")
+	if err != nil {
+		cmd.Fatalf("[Cijitter] %v", err)
+	}
+	// Without a sampler, sandboxes are throttled in blind mode.
+	var smp sampler
+	live, err := newLiveSampler(conf, dir)
+	switch {
+	case err == nil:
+		smp = &sharedSampler{sampler: live}
+	case conf.JitterBlindPeriod > 0:
+		log.Warningf("[Cijitter] creating %v sampler: %v, falling back to blind mode", conf.JitterSampler, err)
+	default:
+		cmd.Fatalf("[Cijitter] creating %v sampler: %v", conf.JitterSampler, err)
+	}
+
+	// Each session is reloaded on top of the configuration of its sandbox.
+	hup := jitterHangups(conf)
+	sessions := make(map[string]*daemonSession)
+	for {
+		sandboxes, err := daemonSandboxes(conf.RootDir)
+		if err != nil {
+			log.Warningf("[Cijitter] listing sandboxes in %q: %v", conf.RootDir, err)
+			time.Sleep(daemonScanInterval)
+			continue
+		}
+		for cid, s := range sessions {
+			if _, ok := sandboxes[cid]; ok && !s.ended() {
+				continue
+			}
+			log.Infof("[Cijitter] Ending the session of sandbox %q", cid)
+			s.stop()
+			delete(sessions, cid)
+		}
+		for cid, c := range sandboxes {
+			if _, ok := sessions[cid]; ok {
+				continue
+			}
+			s, err := startDaemonSession(c, conf, smp)
+			if err != nil {
+				log.Warningf("[Cijitter] taking over sandbox %q: %v", cid, err)
+				continue
+			}
+			sessions[cid] = s
+		}
+		select {
+		case <-hup:
+			log.Infof("[Cijitter] reloading jitter parameters from %q", conf.JitterConfig)
+			for cid, s := range sessions {
+				c, err := ReadConfig(conf.JitterConfig, s.conf)
+				if err != nil {
+					log.Warningf("[Cijitter] not reloading sandbox %q: %v", cid, err)
+					continue
+				}
+				s.conf = c
+				s.reload(c.JitterTunables())
+			}
+		case <-time.After(daemonScanInterval):
+		}
+	}
+}
+
+// daemonSandboxes returns the live sandboxes handed to the jitter daemon, by
+// ID.
+func daemonSandboxes(rootDir string) (map[string]*container.Container, error) {
+	ids, err := container.List(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	sandboxes := make(map[string]*container.Container)
+	for _, id := range ids {
+		c, err := container.Load(rootDir, id)
+		if err != nil {
+			// The container may have raced with deletion.
+			log.Debugf("[Cijitter] loading container %q: %v", id, err)
+			continue
+		}
+		if !c.JitterDaemon || c.Sandbox == nil || c.Sandbox.ID != c.ID {
+			continue
+		}
+		switch c.Status {
+		case container.Created, container.Running, container.Paused:
+			sandboxes[c.ID] = c
+		}
+	}
+	return sandboxes, nil
+}
+
+// daemonSession is the session of a sandbox monitored by the jitter daemon.
+type daemonSession struct {
+	*jitterSession
+
+	// conf is the configuration of the sandbox, with the parameters
+	// reloaded from --jitter-config applied.
+	conf *boot.Config
+}
+
+// startDaemonSession hands the sandbox of c a new address channel and starts
+// monitoring it, with smp or in blind mode if smp is nil.
+func startDaemonSession(c *container.Container, conf *boot.Config, smp sampler) (*daemonSession, error) {
+	conf, err := sandboxConfig(c.ID, conf)
+	if err != nil {
+		return nil, fmt.Errorf("getting configuration: %v", err)
+	}
+	if conf.JitterConfig != "" {
+		// Parameters reloaded before the sandbox was taken over
+		// apply to it too.
+		if conf, err = ReadConfig(conf.JitterConfig, conf); err != nil {
+			return nil, err
+		}
+	}
+	w, err := reconnectAddrPipe(c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("handing over address channel: %v", err)
+	}
+	s := newJitterSession(conf, c.ID, c.BundleDir)
+	s.shared = true
+
+	go notifier(s, w)
+	if conf.JitterHeartbeatInterval > 0 {
+		go s.heartbeat(conf.JitterHeartbeatInterval)
+	}
+	if smp == nil {
+		go runBlind(s, conf)
+	} else {
+		go monitor(s, conf, smp)
+	}
+	log.Infof("[Cijitter] Jitter daemon took over sandbox %q", c.ID)
+	return &daemonSession{jitterSession: s, conf: conf}, nil
+}
+
+// sandboxConfig returns the configuration the sandbox of container cid was
+// created with, whose jitter parameters its session follows. The daemon keeps
+// its own root, working directory, --jitter-config and blind mode, which
+// depends on the sampler it shares between sandboxes.
+func sandboxConfig(cid string, conf *boot.Config) (*boot.Config, error) {
+	conn, err := connectControl(cid)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to control server: %v", err)
+	}
+	defer conn.Close()
+	var c boot.Config
+	if err := conn.Call(boot.JitterConfig, nil, &c); err != nil {
+		return nil, err
+	}
+	c.RootDir = conf.RootDir
+	c.JitterWorkDir = conf.JitterWorkDir
+	c.JitterConfig = conf.JitterConfig
+	c.JitterBlindPeriod = conf.JitterBlindPeriod
+	c.JitterBlindDuty = conf.JitterBlindDuty
+	return &c, nil
+}
+
+// sharedSampler serializes the sampling of the sandboxes of the jitter
+// daemon. The daptrace module traces a single set of processes at a time, and
+// sampling one sandbox at a time bounds the perf events the daemon holds.
+type sharedSampler struct {
+	mu sync.Mutex
+	sampler
+}
+
+// sample implements sampler.sample.
+func (s *sharedSampler) sample(pids []string, d time.Duration) ([]string, map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sampler.sample(pids, d)
+}
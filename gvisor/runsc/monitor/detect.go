@@ -0,0 +1,152 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// detectingSampler counts the cache references and misses of the target
+// processes while another sampler samples them, and feeds both to an attack
+// detector.
+type detectingSampler struct {
+	sampler
+	detector *maid.Detector
+
+	// alert is told when the detector starts suspecting an attack.
+	alert *alerter
+
+	// paranoid is the value of kernel.perf_event_paranoid.
+	paranoid int
+
+	// threadScope is set if the IDs to sample are threads rather than
+	// processes.
+	threadScope bool
+
+	// pmu is set if the host has a PMU to count cache references and
+	// misses with. Without one, opening the counters would fail on every
+	// sample.
+	pmu bool
+}
+
+// newDetectingSampler wraps s with the attack detector d, raising alerts with
+// alert. threadScope is set if s samples threads rather than processes.
+func newDetectingSampler(s sampler, d *maid.Detector, alert *alerter, threadScope bool) (*detectingSampler, error) {
+	paranoid, err := perfParanoid()
+	if err != nil {
+		return nil, err
+	}
+	pmu := pathExists(cpuPMUPath)
+	if !pmu {
+		log.Warningf("[Cijitter] the host has no PMU, e.g. a virtual machine without a virtualized one: the attack detector won't count cache references and misses")
+	}
+	return &detectingSampler{sampler: s, detector: d, alert: alert, paranoid: paranoid, threadScope: threadScope, pmu: pmu}, nil
+}
+
+// sample implements sampler.sample.
+func (s *detectingSampler) sample(pids []string, d time.Duration) ([]string, map[string]int, error) {
+	refs := s.openCounters(pids, unix.PERF_COUNT_HW_CACHE_REFERENCES)
+	misses := s.openCounters(pids, unix.PERF_COUNT_HW_CACHE_MISSES)
+	defer closeCounters(refs)
+	defer closeCounters(misses)
+
+	enableCounters(refs)
+	enableCounters(misses)
+	addrs, access, err := s.sampler.sample(pids, d)
+	if err != nil {
+		return addrs, access, err
+	}
+
+	o := maid.Observation{
+		References: readCounters(refs),
+		Misses:     readCounters(misses),
+	}
+	for _, a := range addrs {
+		if addr, err := maid.Hex2addr(a); err == nil {
+			o.Addrs = append(o.Addrs, addr.RoundDown())
+		}
+	}
+	if suspected := s.detector.Suspected(); s.detector.Observe(o) && !suspected {
+		s.alert.raise(maid.Alert{
+			Kind:       maid.AlertAttackSuspected,
+			References: o.References,
+			Misses:     o.Misses,
+		})
+	}
+	return addrs, access, nil
+}
+
+// lines implements lineSampler.lines.
+func (s *detectingSampler) lines() map[usermem.Addr]uint64 {
+	if ls, ok := s.sampler.(lineSampler); ok {
+		return ls.lines()
+	}
+	return nil
+}
+
+// openCounters opens a disabled counter of config on every thread of pids.
+// Threads it can't count are skipped.
+func (s *detectingSampler) openCounters(pids []string, config uint64) []int {
+	if !s.pmu {
+		return nil
+	}
+	var fds []int
+	for _, pid := range pids {
+		tids, err := threadsToSample(pid, s.threadScope)
+		if err != nil {
+			continue
+		}
+		for _, tid := range tids {
+			fd, err := openPerfCounter(tid, s.paranoid, config)
+			if err != nil {
+				log.Debugf("[Cijitter] opening cache counter on thread %d failed: %v", tid, err)
+				continue
+			}
+			fds = append(fds, fd)
+		}
+	}
+	return fds
+}
+
+// enableCounters starts counting on fds.
+func enableCounters(fds []int) {
+	for _, fd := range fds {
+		unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_ENABLE, 0)
+	}
+}
+
+// readCounters returns the sum of the counters fds.
+func readCounters(fds []int) uint64 {
+	var total uint64
+	buf := make([]byte, 8)
+	for _, fd := range fds {
+		if n, err := unix.Read(fd, buf); err == nil && n == len(buf) {
+			total += usermem.ByteOrder.Uint64(buf)
+		}
+	}
+	return total
+}
+
+// closeCounters releases the counters fds.
+func closeCounters(fds []int) {
+	for _, fd := range fds {
+		unix.Close(fd)
+	}
+}
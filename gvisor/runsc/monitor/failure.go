@@ -0,0 +1,100 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"sync/atomic"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/container"
+)
+
+// maxSamplingFailures is the number of sampling cycles in a row that may fail
+// before --jitter-failure-policy applies.
+const maxSamplingFailures = 5
+
+// failureTracker counts the sampling failures of a session and applies the
+// failure policy once the workload has been unprotected for too long.
+type failureTracker struct {
+	policy  boot.JitterFailurePolicy
+	rootDir string
+	cid     string
+
+	// failures is the number of sampling cycles in a row that failed.
+	failures int
+
+	// total counts all the sampling cycles that failed. It is accessed
+	// atomically.
+	total *uint64
+}
+
+// newFailureTracker returns the failure tracker of container cid, which also
+// counts the failed sampling cycles in total.
+func newFailureTracker(conf *boot.Config, cid string, total *uint64) *failureTracker {
+	return &failureTracker{
+		policy:  conf.JitterFailurePolicy,
+		rootDir: conf.RootDir,
+		cid:     cid,
+		total:   total,
+	}
+}
+
+// record records the outcome of a sampling cycle, err being nil if sampling
+// succeeded. The policy applies once, when failures reach
+// maxSamplingFailures; it applies again if sampling recovers and then fails
+// as many times again.
+func (f *failureTracker) record(err error) {
+	if err == nil {
+		if f.failures >= maxSamplingFailures {
+			log.Infof("[Cijitter] sampling of %q recovered after %d failures", f.cid, f.failures)
+		}
+		f.failures = 0
+		return
+	}
+	f.failures++
+	atomic.AddUint64(f.total, 1)
+	if f.failures != maxSamplingFailures {
+		return
+	}
+	log.Warningf("[Cijitter] sampling of %q failed %d times in a row, last: %v", f.cid, f.failures, err)
+	if err := f.apply(); err != nil {
+		log.Warningf("[Cijitter] applying failure policy %v to %q: %v", f.policy, f.cid, err)
+	}
+}
+
+// apply applies the failure policy to the container.
+func (f *failureTracker) apply() error {
+	if f.policy == boot.JitterFailOpen {
+		log.Warningf("[Cijitter] container %q runs unprotected until sampling recovers", f.cid)
+		return nil
+	}
+	c, err := container.Load(f.rootDir, f.cid)
+	if err != nil {
+		return fmt.Errorf("loading container: %v", err)
+	}
+	switch f.policy {
+	case boot.JitterFailClosed:
+		log.Warningf("[Cijitter] killing the processes of container %q", f.cid)
+		return c.SignalContainer(syscall.SIGKILL, true)
+	case boot.JitterFailPause:
+		log.Warningf("[Cijitter] pausing container %q until it is resumed", f.cid)
+		return c.Pause()
+	default:
+		panic(fmt.Sprintf("unknown failure policy %v", f.policy))
+	}
+}
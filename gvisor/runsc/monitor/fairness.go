@@ -0,0 +1,159 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+// fairDirName is the directory, in the jitter working directory, where the
+// sandboxes taking turns register. '@' is not allowed in container IDs, so it
+// is never the working directory of a container.
+const fairDirName = "@fair"
+
+// fairMemberSuffix is the suffix of the registration of a sandbox.
+const fairMemberSuffix = ".lock"
+
+// fairTurns schedules the delay windows of a sandbox round-robin with those of
+// the other sandboxes of the host, so that only one of them is delayed at a
+// time. Every sandbox registers a file in a shared directory and holds a lock
+// on it while it is monitored: the live members are the locked files, whether
+// they belong to other monitors or to other sessions of the jitter daemon.
+type fairTurns struct {
+	dir string
+	cid string
+
+	// window is how long the delay windows of the sandbox last.
+	window time.Duration
+
+	// f is the registration of the sandbox, locked for the life of the
+	// session.
+	f *os.File
+}
+
+// newFairTurns registers container cid, whose delay windows last window, with
+// the sandboxes taking turns.
+func newFairTurns(conf *boot.Config, cid string, window time.Duration) (*fairTurns, error) {
+	dir, err := monitorWorkDir(conf, fairDirName)
+	if err != nil {
+		return nil, err
+	}
+	// Lock the registration before it appears under its name, so that it
+	// is never taken for the leftover of a dead monitor.
+	tmp, err := ioutil.TempFile(dir, ".join-")
+	if err != nil {
+		return nil, fmt.Errorf("registering for fair turns: %v", err)
+	}
+	if err := syscall.Flock(int(tmp.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("locking fair turns registration: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, cid+fairMemberSuffix)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("registering for fair turns: %v", err)
+	}
+	return &fairTurns{dir: dir, cid: cid, window: window, f: tmp}, nil
+}
+
+// close withdraws the sandbox from the turns.
+func (t *fairTurns) close() {
+	if t == nil {
+		return
+	}
+	os.Remove(filepath.Join(t.dir, t.cid+fairMemberSuffix))
+	t.f.Close()
+}
+
+// members returns the IDs of the sandboxes taking turns, sorted. The
+// registrations of monitors that died without withdrawing are removed.
+func (t *fairTurns) members() ([]string, error) {
+	entries, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, fairMemberSuffix) {
+			continue
+		}
+		id := strings.TrimSuffix(name, fairMemberSuffix)
+		if id != t.cid && !fairMemberLive(filepath.Join(t.dir, name)) {
+			log.Debugf("[Cijitter] removing stale fair turns registration of %q", id)
+			os.Remove(filepath.Join(t.dir, name))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// fairMemberLive returns whether the registration at path is still locked by
+// its sandbox.
+func fairMemberLive(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		// Withdrawn in the meantime.
+		return false
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return true
+	}
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return false
+}
+
+// wait returns once the sandbox may open a delay window, or false if the
+// session ended first. Membership is looked at again before every window, so
+// sandboxes joining or leaving take effect within a round.
+func (t *fairTurns) wait(s *jitterSession) bool {
+	if t == nil {
+		return true
+	}
+	ids, err := t.members()
+	if err != nil {
+		// Don't leave the sandbox unprotected over bookkeeping.
+		log.Warningf("[Cijitter] listing fair turns: %v", err)
+		return true
+	}
+	index := sort.SearchStrings(ids, t.cid)
+	now := time.Now()
+	d := maid.NextTurn(now, t.window, index, len(ids)).Sub(now)
+	if d <= 0 {
+		return true
+	}
+	log.Debugf("[Cijitter] waiting %v for the turn of %q, %d of %d", d, t.cid, index+1, len(ids))
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+const (
+	// ibsOpTypePath holds the PMU type of AMD IBS op, if the host has it.
+	ibsOpTypePath = "/sys/bus/event_source/devices/ibs_op/type"
+
+	// onlineCPUsPath lists the online CPUs of the host.
+	onlineCPUsPath = "/sys/devices/system/cpu/online"
+
+	// ibsOpCntCtl has IBS op count dispatched micro-ops rather than
+	// cycles, so that the samples follow the instruction stream.
+	ibsOpCntCtl = 1 << 19
+
+	// ibsOpPeriod is the number of micro-ops between two IBS samples.
+	ibsOpPeriod = 0x10000
+)
+
+// ibsOpType returns the PMU type of AMD IBS op, or an error if the host
+// doesn't have it.
+func ibsOpType() (uint32, error) {
+	data, err := ioutil.ReadFile(ibsOpTypePath)
+	if err != nil {
+		return 0, fmt.Errorf("AMD IBS op is not available: %v", err)
+	}
+	typ, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %v", ibsOpTypePath, err)
+	}
+	return uint32(typ), nil
+}
+
+// openIBSEvents opens a disabled IBS op sampling event on each of tids. Some
+// kernels only support IBS events CPU-wide, in which case it opens one on
+// each online CPU instead, whose samples must be filtered by thread.
+func openIBSEvents(ibsType uint32, tids []int) ([]*perfEvent, error) {
+	var (
+		events []*perfEvent
+		err    error
+	)
+	for _, tid := range tids {
+		var e *perfEvent
+		if e, err = openIBSEvent(ibsType, tid, -1 /* cpu */); err != nil {
+			// The thread may have exited meanwhile.
+			log.Debugf("[Cijitter] opening IBS event on thread %d failed: %v", tid, err)
+			continue
+		}
+		events = append(events, e)
+	}
+	if len(events) != 0 || len(tids) == 0 {
+		return events, nil
+	}
+
+	cpus, cpuErr := readCPUList(onlineCPUsPath)
+	if cpuErr != nil {
+		return nil, fmt.Errorf("opening IBS events per thread: %v, listing CPUs: %v", err, cpuErr)
+	}
+	for _, cpu := range cpus {
+		e, cpuErr := openIBSEvent(ibsType, -1 /* tid */, cpu)
+		if cpuErr != nil {
+			for _, e := range events {
+				e.close()
+			}
+			return nil, fmt.Errorf("opening IBS events per thread: %v, per CPU: %v", err, cpuErr)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"io/ioutil"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+// hostLoadInterval is how often the monitor reads the host load. CPU
+// utilization is averaged over the interval.
+const hostLoadInterval = time.Second
+
+const (
+	// procStatPath holds the CPU times of the host.
+	procStatPath = "/proc/stat"
+
+	// cpuPressurePath holds the CPU pressure of the host on kernels with
+	// PSI.
+	cpuPressurePath = "/proc/pressure/cpu"
+)
+
+// hostLoad tracks whether the host is overloaded, so that jitter backs off
+// rather than compounding the overload.
+type hostLoad struct {
+	gov    *maid.LoadGovernor
+	action maid.LoadAction
+
+	// next is when the host load is read again.
+	next time.Time
+
+	// overloaded is the outcome of the last reading.
+	overloaded bool
+}
+
+// newHostLoad returns a hostLoad judging the host against the load limits of
+// conf, or nil if none is set.
+func newHostLoad(conf *boot.Config) *hostLoad {
+	if !conf.JitterLoadLimits.Enabled() {
+		return nil
+	}
+	l := &hostLoad{gov: maid.NewLoadGovernor(conf.JitterLoadLimits), action: conf.JitterLoadAction}
+	// Take the first CPU times to measure utilization from.
+	l.read()
+	return l
+}
+
+// read reads the host load and updates overloaded.
+func (l *hostLoad) read() {
+	var s maid.LoadSample
+	data, err := ioutil.ReadFile(procStatPath)
+	if err == nil {
+		s.CPU, err = maid.ParseCPUStat(data)
+	}
+	if err != nil {
+		log.Debugf("[Cijitter] reading host CPU times failed: %v", err)
+		return
+	}
+	if data, err := ioutil.ReadFile(cpuPressurePath); err == nil {
+		s.Pressure, err = maid.ParsePressure(data)
+		s.HasPressure = err == nil
+	}
+
+	overloaded := l.gov.Observe(s)
+	if overloaded != l.overloaded {
+		if overloaded {
+			log.Infof("[Cijitter] host is overloaded, jitter load action %v applies", l.action)
+		} else {
+			log.Infof("[Cijitter] host load recovered, jitter restored")
+		}
+	}
+	l.overloaded = overloaded
+}
+
+// check reads the host load at most every hostLoadInterval and returns
+// whether the host is overloaded. l may be nil, in which case it never is.
+func (l *hostLoad) check() bool {
+	if l == nil {
+		return false
+	}
+	if now := time.Now(); !now.Before(l.next) {
+		l.next = now.Add(hostLoadInterval)
+		l.read()
+	}
+	return l.overloaded
+}
+
+// suspended returns whether no window may be delayed because of the host
+// load.
+func (l *hostLoad) suspended() bool {
+	return l.check() && l.action == maid.LoadSuspend
+}
+
+// lighten trims targets to the primary target while the host is overloaded
+// with the lighten action.
+func (l *hostLoad) lighten(targets []maid.Target) []maid.Target {
+	if len(targets) > 1 && l.check() && l.action == maid.LoadLighten {
+		return targets[:1]
+	}
+	return targets
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+const (
+	// daptraceModuleName is the name of the daptrace kernel module.
+	daptraceModuleName = "daptrace"
+
+	// daptraceDKMSVersion is the version the bundled sources of the module
+	// are registered with DKMS as. It must match dkms.conf.
+	daptraceDKMSVersion = "1.0"
+
+	// DaptraceModuleEnv overrides the module to load, unless
+	// --jitter-module is set.
+	DaptraceModuleEnv = "RUNSC_JITTER_MODULE"
+)
+
+// kernelRelease returns the release of the running kernel, as in uname -r.
+func kernelRelease() (string, error) {
+	release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(release)), nil
+}
+
+// daptraceModuleCandidates returns where the module is looked for, in order:
+// where DKMS and out-of-tree builds install it for the running kernel, then
+// the directory the module was historically built in.
+func daptraceModuleCandidates(release string) []string {
+	ko := daptraceModuleName + ".ko"
+	return []string{
+		filepath.Join("/lib/modules", release, "updates", "dkms", ko),
+		filepath.Join("/lib/modules", release, "extra", ko),
+		filepath.Join("/lib/modules", release, "updates", ko),
+		filepath.Join(kernelPath, ko),
+	}
+}
+
+// findDaptraceModule returns the daptrace module selected in conf. Unless
+// overridden, the module is looked for in the standard locations and, if
+// none has it and conf has the module sources, built for the running kernel
+// with DKMS.
+func findDaptraceModule(conf *boot.Config) (string, error) {
+	if conf.JitterModule != "" {
+		return conf.JitterModule, nil
+	}
+	if path := os.Getenv(DaptraceModuleEnv); path != "" {
+		return path, nil
+	}
+	release, err := kernelRelease()
+	if err != nil {
+		return "", fmt.Errorf("getting kernel release: %v", err)
+	}
+	candidates := daptraceModuleCandidates(release)
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			log.Infof("[Cijitter] Using %s module %q", daptraceModuleName, path)
+			return path, nil
+		}
+	}
+	if conf.JitterModuleSrc == "" {
+		return "", fmt.Errorf("no %s module for kernel %s in %s, use --jitter-module or build it with --jitter-module-src", daptraceModuleName, release, strings.Join(candidates, ", "))
+	}
+	if err := buildDaptraceModule(conf.JitterModuleSrc, release); err != nil {
+		return "", err
+	}
+	// DKMS installs to updates/dkms or extra, depending on the distribution.
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s module built with DKMS not found in %s", daptraceModuleName, strings.Join(candidates, ", "))
+}
+
+// buildDaptraceModule builds and installs the module from the sources in src
+// for kernel release with DKMS.
+func buildDaptraceModule(src, release string) error {
+	log.Infof("[Cijitter] Building %s module for kernel %s from %q with DKMS", daptraceModuleName, release, src)
+	module := daptraceModuleName + "/" + daptraceDKMSVersion
+	status, err := exec.Command("dkms", "status", module).Output()
+	if err != nil {
+		return fmt.Errorf("running dkms: %v", err)
+	}
+	if len(strings.TrimSpace(string(status))) == 0 {
+		if out, err := exec.Command("dkms", "add", src).CombinedOutput(); err != nil {
+			return fmt.Errorf("adding %q to DKMS: %v, %s", src, err, out)
+		}
+	}
+	if out, err := exec.Command("dkms", "install", module, "-k", release).CombinedOutput(); err != nil {
+		return fmt.Errorf("building %s with DKMS: %v, %s", module, err, out)
+	}
+	return nil
+}
+
+// daptraceABIVersion is the version of the output format of the module that
+// read_sample_logs parses, of its ring buffer and of its netlink interface.
+// It must match
+// DAPTRACE_ABI_VERSION in daptrace.c.
+const daptraceABIVersion = 3
+
+// checkDaptraceABI returns an error if the loaded module doesn't write
+// samples in the format read_sample_logs parses.
+func checkDaptraceABI(ctl daptraceControl) error {
+	b, err := ctl.read(daptraceVersion)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s module has no ABI version, it predates version %d expected by runsc: rebuild it", daptraceModuleName, daptraceABIVersion)
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s module ABI version: %v", daptraceModuleName, err)
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return fmt.Errorf("invalid %s module ABI version %q", daptraceModuleName, b)
+	}
+	if v != daptraceABIVersion {
+		return fmt.Errorf("%s module has ABI version %d, runsc expects %d: rebuild it from the sources of this runsc", daptraceModuleName, v, daptraceABIVersion)
+	}
+	return nil
+}
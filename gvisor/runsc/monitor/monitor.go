@@ -0,0 +1,993 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package monitor runs the Cijitter monitor of runsc sandboxes: it samples
+// them on the host and drives gvisor.dev/gvisor/pkg/jitter against them,
+// talking to their sentry over the address pipe and the control socket.
+//
+// A sandbox is either monitored by its own monitor process, started by runsc
+// with the sandbox, or by the host-wide jitter daemon, which takes over the
+// sandboxes created with --jitter-daemon.
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"gvisor.dev/gvisor/pkg/control/client"
+	"gvisor.dev/gvisor/pkg/jitter"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/unet"
+	"gvisor.dev/gvisor/pkg/urpc"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cmd"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// Run runs the monitor subcommand of runsc: it monitors the sandbox of the
+// bundle given with --bundle, through the address pipe given with --addr-fd.
+// It returns once the sandbox is gone.
+func Run(conf *boot.Config) {
+	log.Debugf("[Cijitter] Start to monitor addr...")
+
+	bundle := monitorBundle()
+	_, cid := filepath.Split(bundle) // get container id
+	if conf.JitterPrivsep {
+		setUpJitterPrivsep(conf, cid)
+	}
+	donateControl()
+	s := newJitterSession(conf, cid, bundle)
+
+	// init notifier thread
+	go notifier(s, monitorAddrPipe())
+	if conf.JitterHeartbeatInterval > 0 {
+		go s.heartbeat(conf.JitterHeartbeatInterval)
+	}
+	if reloads := jitterReloads(conf); reloads != nil {
+		go func() {
+			for t := range reloads {
+				s.reload(t)
+			}
+		}()
+	}
+
+	//strat the monitor
+	smp := newMonitorSampler(conf, cid)
+	if smp == nil {
+		runBlind(s, conf)
+		return
+	}
+	monitor(s, conf, smp)
+}
+
+// monitorBundle returns the bundle directory passed to the monitor
+// subcommand. Its last element is the container ID.
+func monitorBundle() string {
+	if bundle, ok := subcommandArg("bundle"); ok {
+		return bundle
+	}
+	cmd.Fatalf("[Cijitter] monitor started without --bundle: %v", flag.CommandLine.Args())
+	panic("unreachable")
+}
+
+// monitorAddrPipe returns the monitor end of the address pipe passed to the
+// monitor subcommand with --addr-fd. Its number depends on the other files
+// donated to the monitor, as for the sandbox end.
+func monitorAddrPipe() *os.File {
+	arg, ok := subcommandArg("addr-fd")
+	if !ok {
+		cmd.Fatalf("[Cijitter] monitor started without --addr-fd: %v", flag.CommandLine.Args())
+	}
+	fd, err := strconv.Atoi(arg)
+	if err != nil || fd < 0 {
+		cmd.Fatalf("[Cijitter] invalid --addr-fd %q", arg)
+	}
+	return os.NewFile(uintptr(fd), "monitor addr FD")
+}
+
+// subcommandArg returns the value of the argument --name of the subcommand,
+// given as --name VALUE or --name=VALUE.
+func subcommandArg(name string) (string, bool) {
+	args := flag.CommandLine.Args()
+	for i, arg := range args {
+		if arg == "--"+name && i+1 < len(args) {
+			return args[i+1], true
+		}
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			return strings.TrimPrefix(arg, "--"+name+"="), true
+		}
+	}
+	return "", false
+}
+
+// jitterSession is the monitor state of a single sandbox. The monitor
+// subcommand runs a single session, the jitter daemon one per sandbox.
+type jitterSession struct {
+	cid       string
+	bundleDir string
+
+	// msgs are the messages to send to the sandbox.
+	msgs *maid.MessageQueue
+
+	// policy decides which windows the monitor delays. It is only used
+	// when the monitor schedules delays itself.
+	policy *maid.Policy
+
+	// resumeAcks receives the acks of MessageResume.
+	resumeAcks chan *maid.Ack
+
+	// shared is set if other sandboxes are monitored by the same process.
+	shared bool
+
+	// suspended is 1 while the sandbox is suspended for a pause or a
+	// checkpoint, as the sentry tells. It is accessed atomically.
+	suspended uint32
+
+	// samplerErrors is the number of sampling cycles that failed. It is
+	// accessed atomically.
+	samplerErrors uint64
+
+	// ctx is cancelled when the session ends. The session of the monitor
+	// subcommand lasts as long as the process.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newJitterSession returns a session for container cid, whose bundle is in
+// bundleDir. Its messages are queued as conf says.
+func newJitterSession(conf *boot.Config, cid, bundleDir string) *jitterSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jitterSession{
+		cid:        cid,
+		bundleDir:  bundleDir,
+		msgs:       maid.NewMessageQueue(conf.JitterMsgBuffer, conf.JitterMsgDrop),
+		policy:     maid.NewPolicy(),
+		resumeAcks: make(chan *maid.Ack, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// send queues m for the sandbox. It drops m if the session has ended, or if
+// the queue is full and its drop policy says so.
+func (s *jitterSession) send(m *maid.Message) {
+	s.msgs.Send(s.ctx.Done(), m)
+}
+
+// stop ends the session.
+func (s *jitterSession) stop() {
+	s.cancel()
+}
+
+// ended returns true once the session has ended.
+func (s *jitterSession) ended() bool {
+	return s.ctx.Err() != nil
+}
+
+// sleep waits for d. It returns false if the session ended meanwhile.
+func (s *jitterSession) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// setSuspended records whether the sandbox is suspended.
+func (s *jitterSession) setSuspended(suspended bool) {
+	var v uint32
+	if suspended {
+		v = 1
+	}
+	if atomic.SwapUint32(&s.suspended, v) == v {
+		return
+	}
+	if suspended {
+		log.Infof("[Cijitter] sandbox %q suspended, sampling and delays suspended", s.cid)
+	} else {
+		log.Infof("[Cijitter] sandbox %q resumed, sampling and delays resumed", s.cid)
+	}
+}
+
+// isSuspended returns whether the sandbox is suspended.
+func (s *jitterSession) isSuspended() bool {
+	return atomic.LoadUint32(&s.suspended) != 0
+}
+
+// lost ends the session after its sandbox became unreachable. A session that
+// lasts as long as the process takes the process down with it.
+func (s *jitterSession) lost(err error) {
+	if !s.shared {
+		cmd.Fatalf("[Cijitter] %v", err)
+	}
+	log.Warningf("[Cijitter] %v", err)
+	s.stop()
+}
+
+// heartbeat tells the sandbox that the monitor is alive every interval, so
+// that the sandbox notices when the monitor dies silently. Heartbeats also
+// carry the messages dropped and the sampling cycles failed so far.
+func (s *jitterSession) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m := maid.NewHeartbeatMessage()
+			m.Drops = s.msgs.Drops()
+			m.SamplerErrors = atomic.LoadUint64(&s.samplerErrors)
+			s.send(m)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// notifierMaxRetries is the number of attempts made to re-establish a broken
+// address pipe before the monitor gives up on the sandbox.
+const notifierMaxRetries = 5
+
+// notifier sends the messages of s to the sandbox over writer until the
+// session ends. Failed sends back off, so that a pipe failing persistently
+// doesn't make the monitor spin.
+func notifier(s *jitterSession, writer *os.File) {
+	// Closing the pipe also ends the ack reader blocked on it.
+	defer func() { maid.CloseAddrPipe(writer) }()
+
+	encoder := maid.NewEncoder(writer)
+	errBackoff := maid.NewErrorBackoff(maid.MinErrorBackoff, maid.MaxErrorBackoff)
+	go readAcks(s, writer)
+	for {
+		msg, ok := s.msgs.Next(s.ctx.Done())
+		if !ok {
+			log.Debugf("[Cijitter] Addr notifier finished!")
+			return
+		}
+		err := encoder.Encode(msg)
+		if err == nil {
+			errBackoff.Reset()
+			continue
+		}
+		if !errors.Is(err, syscall.EPIPE) {
+			log.Debugf("[Cijitter] Addr sended failed: %v", err)
+			if !errBackoff.Wait(s.ctx) {
+				log.Debugf("[Cijitter] Addr notifier finished!")
+				return
+			}
+			continue
+		}
+
+		// The sandbox end of the pipe is gone, e.g. the boot process
+		// restarted. Build a new pipe and resend the message over it.
+		log.Warningf("[Cijitter] Addr pipe to sandbox %q broken, reconnecting...", s.cid)
+		newWriter, err := reconnectAddrPipe(s.cid)
+		if err != nil {
+			s.lost(fmt.Errorf("giving up on sandbox %q after %d reconnect attempts: %v", s.cid, notifierMaxRetries, err))
+			return
+		}
+		maid.CloseAddrPipe(writer)
+		writer = newWriter
+		encoder = maid.NewEncoder(writer)
+		go readAcks(s, writer)
+		if err := encoder.Encode(msg); err != nil {
+			log.Debugf("[Cijitter] Addr sended failed after reconnect: %v", err)
+		}
+	}
+}
+
+// readAcks consumes the sentry's acknowledgements arriving on conn until the
+// connection breaks, and feeds them to the policy's target feedback.
+func readAcks(s *jitterSession, conn *os.File) {
+	cid := s.cid
+	decoder := maid.NewDecoder(conn)
+	for {
+		ack, err := decoder.DecodeAck()
+		if err != nil {
+			log.Debugf("[Cijitter] Ack reader for %q finished: %v", cid, err)
+			return
+		}
+		if ack.Type == maid.MessageSuspend {
+			s.setSuspended(ack.Suspended)
+			continue
+		}
+		if ack.Type == maid.MessageResume {
+			select {
+			case s.resumeAcks <- ack:
+			default:
+			}
+		}
+		if ack.Err != "" {
+			log.Warningf("[Cijitter] sandbox %q rejected %v message: %s", cid, ack.Type, ack.Err)
+			continue
+		}
+		if ack.Type == maid.MessageStop && ack.Addr != 0 {
+			log.Debugf("[Cijitter] window on %x observed %d delayed accesses", ack.Addr, ack.Hits)
+			s.policy.Record(ack.Addr, ack.Hits)
+		}
+	}
+}
+
+// donatedControl is the connection to the control server of the sandbox
+// donated to the monitor subcommand with --control-fd. The monitor runs in its
+// own network namespace, where the abstract control socket can't be reached.
+// It is nil in the jitter daemon.
+var donatedControl *urpc.Client
+
+// donateControl sets donatedControl from --control-fd, if given.
+func donateControl() {
+	arg, ok := subcommandArg("control-fd")
+	if !ok {
+		return
+	}
+	fd, err := strconv.Atoi(arg)
+	if err != nil || fd < 0 {
+		cmd.Fatalf("[Cijitter] invalid --control-fd %q", arg)
+	}
+	sock, err := unet.NewSocket(fd)
+	if err != nil {
+		cmd.Fatalf("[Cijitter] using control connection: %v", err)
+	}
+	donatedControl = urpc.NewClient(sock)
+}
+
+// controlClient is a connection to the control server of a sandbox.
+type controlClient interface {
+	Call(method string, arg interface{}, result interface{}) error
+	Close() error
+}
+
+// sharedControl is donatedControl as a controlClient. It stays open when
+// closed, for the other users of the connection.
+type sharedControl struct {
+	*urpc.Client
+}
+
+// Close implements controlClient.Close.
+func (sharedControl) Close() error {
+	return nil
+}
+
+// connectControl connects to the control server of the sandbox of container
+// cid, over donatedControl if set.
+func connectControl(cid string) (controlClient, error) {
+	if donatedControl != nil {
+		return sharedControl{donatedControl}, nil
+	}
+	conn, err := client.ConnectTo(boot.ControlSocketAddr(cid))
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// reconnectAddrPipe creates a new address channel and donates the sandbox end
+// to the sandbox over the control socket. It retries with a bounded
+// exponential backoff and returns the monitor end on success.
+func reconnectAddrPipe(cid string) (*os.File, error) {
+	var writer *os.File
+	op := func() error {
+		conn, err := connectControl(cid)
+		if err != nil {
+			return fmt.Errorf("connecting to control server: %v", err)
+		}
+		defer conn.Close()
+
+		fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("creating address channel: %v", err))
+		}
+		r := os.NewFile(uintptr(fds[0]), "sandbox addr FD")
+		w := os.NewFile(uintptr(fds[1]), "monitor addr FD")
+		defer r.Close()
+
+		args := boot.JitterReconnectArgs{
+			FilePayload: urpc.FilePayload{Files: []*os.File{r}},
+		}
+		if err := conn.Call(boot.JitterReconnect, &args, nil); err != nil {
+			w.Close()
+			return fmt.Errorf("donating address pipe: %v", err)
+		}
+		writer = w
+		return nil
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 100 * time.Millisecond
+	b.MaxInterval = 5 * time.Second
+	notify := func(err error, next time.Duration) {
+		log.Debugf("[Cijitter] reconnect to sandbox %q failed: %v, retrying in %v", cid, err, next)
+	}
+	if err := backoff.RetryNotify(op, backoff.WithMaxRetries(b, notifierMaxRetries), notify); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// jitterTrace records the monitor's samples and decisions with
+// --jitter-record. It is nil when recording is disabled.
+var jitterTrace *maid.TraceWriter
+
+// recordDecision records a decision of the policy to jitterTrace, if
+// enabled.
+func recordDecision(rec maid.TraceRecord) {
+	if jitterTrace == nil {
+		return
+	}
+	rec.Event = maid.TraceDecision
+	if err := jitterTrace.Write(rec); err != nil {
+		log.Warningf("[Cijitter] recording decision failed: %v", err)
+	}
+}
+
+// jitterGated returns why the sandbox must not be delayed now, or "" if it
+// may be.
+func jitterGated(conf *boot.Config, cal *protectionCalendar, detector *maid.Detector, coRes *coResidency, load *hostLoad) string {
+	if !cal.protects() {
+		return "unscheduled"
+	}
+	if load.suspended() {
+		return "overloaded"
+	}
+	suspectedOnly := conf.JitterActivation == boot.JitterActivationSuspected
+	if coRes != nil && coRes.dedicated() {
+		if conf.JitterCoResidency == boot.JitterCoResidencyDisable {
+			return "dedicated"
+		}
+		suspectedOnly = true
+	}
+	if suspectedOnly && !detector.Suspected() {
+		return "unsuspected"
+	}
+	return ""
+}
+
+// resumeTimeout bounds how long a starting monitor waits for the sandbox to
+// tell whether it was restored from a checkpoint.
+const resumeTimeout = time.Minute
+
+// resume asks the sandbox whether it was restored from a checkpoint and, if
+// so, takes back the policy history saved with it. It returns whether the
+// sandbox was restored.
+func (s *jitterSession) resume() bool {
+	s.send(maid.NewResumeMessage())
+	select {
+	case ack := <-s.resumeAcks:
+		if ack.Err != "" || !ack.Restored {
+			return false
+		}
+		if ack.History != nil {
+			s.policy.SetState(ack.History)
+		}
+		log.Infof("[Cijitter] sandbox %q was restored, resuming sampling with %d samples of history", s.cid, s.policy.State().Index)
+		return true
+	case <-time.After(resumeTimeout):
+		log.Warningf("[Cijitter] sandbox %q did not answer the resume message in %v", s.cid, resumeTimeout)
+		return false
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// execPollInterval is how often the monitor asks the sandbox whether the
+// workload has started with --jitter-start-on-exec.
+const execPollInterval = 100 * time.Millisecond
+
+// waitForExec returns once the sandbox reports processes in the container of
+// s, or the session ends.
+func waitForExec(s *jitterSession) {
+	cid := s.cid
+	log.Debugf("[Cijitter] waiting for the workload of %q to start...", cid)
+	for !s.ended() {
+		var procs []*control.Process
+		conn, err := connectControl(cid)
+		if err == nil {
+			err = conn.Call(boot.ContainerProcesses, &cid, &procs)
+			conn.Close()
+		}
+		if err == nil && len(procs) != 0 {
+			log.Debugf("[Cijitter] workload of %q started, sampling", cid)
+			return
+		}
+		time.Sleep(execPollInterval)
+	}
+}
+
+// newMonitorSampler returns the sampler of the monitor subcommand of
+// container cid, recording to jitterTrace with --jitter-record. It returns
+// nil if no sampler is available and --jitter-blind-period is set.
+func newMonitorSampler(conf *boot.Config, cid string) sampler {
+	if ret := jitterLogRetention(conf); conf.JitterRecord != "" && ret.bounded() {
+		// Keep the records of previous runs around as rotated files.
+		if err := rotateFiles(conf.JitterRecord, ret.keep); err != nil {
+			cmd.Fatalf("[Cijitter] rotating jitter record file: %v", err)
+		}
+		f, err := openRotatingFile(conf.JitterRecord, ret)
+		if err != nil {
+			cmd.Fatalf("[Cijitter] opening jitter record file: %v", err)
+		}
+		jitterTrace = maid.NewTraceWriter(f)
+	} else if conf.JitterRecord != "" {
+		f, err := os.OpenFile(conf.JitterRecord, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			cmd.Fatalf("[Cijitter] opening jitter record file: %v", err)
+		}
+		jitterTrace = maid.NewTraceWriter(f)
+	}
+	dir, err := monitorWorkDir(conf, cid)
+	if err != nil {
+		cmd.Fatalf("[Cijitter] %v", err)
+	}
+	smp, err := newSampler(conf, dir, jitterTrace)
+	if err != nil && conf.JitterBlindPeriod > 0 && conf.JitterReplay == "" {
+		log.Warningf("[Cijitter] creating %v sampler: %v, falling back to blind mode", conf.JitterSampler, err)
+		return nil
+	}
+	if err != nil {
+		cmd.Fatalf("[Cijitter] creating %v sampler: %v", conf.JitterSampler, err)
+	}
+	return smp
+}
+
+// monitor samples the sandbox of s with smp and delays it until the session
+// ends.
+func monitor(s *jitterSession, conf *boot.Config, smp sampler) {
+	log.Debugf("[Cijitter] Monitor start...")
+	cid := s.cid
+
+	backend, err := newDelayBackend(s, conf)
+	if err != nil {
+		s.lost(fmt.Errorf("creating %v delay backend: %v", conf.JitterBackend, err))
+		return
+	}
+	if conf.JitterPrefetch != boot.JitterPrefetchOff {
+		if backend, err = newPrefetchDelayer(backend, conf, cid); err != nil {
+			s.lost(fmt.Errorf("creating prefetcher control: %v", err))
+			return
+		}
+	}
+
+	s.policy.SetBackoff(conf.JitterBackoff)
+	s.policy.SetCompensation(conf.JitterCompensation)
+	s.policy.SetWaitMode(conf.JitterDelayWait)
+	s.policy.SetThresholds(conf.JitterThresholds)
+	s.policy.SetHysteresis(conf.JitterHysteresis)
+	s.policy.SetHistoryWindow(conf.JitterHistoryWindow)
+	s.policy.SetSymbolRules(conf.JitterSymbolRules)
+	s.policy.SetCalendar(conf.JitterCalendar)
+	var calibrator *maid.Calibrator
+	if conf.JitterCalibrate > 0 {
+		calibrator = maid.NewCalibrator(conf.JitterCalibrate)
+	}
+
+	// A replayed trace has already been sampled, there are no processes
+	// to select.
+	var sel *targetSelector
+	if conf.JitterReplay == "" {
+		sel, err = newTargetSelector(cid, s.bundleDir, conf)
+		if err != nil {
+			s.lost(fmt.Errorf("creating target selector for %v: %v", conf.JitterTargetPolicy, err))
+			return
+		}
+		sel.shared = s.shared
+	}
+	if conf.JitterNUMA != boot.JitterNUMAOff && sel != nil {
+		if backend, err = newNUMADelayer(backend, conf.JitterNUMA, sel, cid); err != nil {
+			s.lost(fmt.Errorf("reading NUMA topology: %v", err))
+			return
+		}
+	}
+
+	// With suspected activation, sampling goes on to feed the detector but
+	// nothing is delayed until it suspects an attack.
+	// Alerts also need the detector.
+	alert := newAlerter(conf, cid)
+	var detector *maid.Detector
+	if conf.JitterActivation == boot.JitterActivationSuspected || conf.JitterCoResidency == boot.JitterCoResidencyDowngrade || alert != nil {
+		detector = maid.NewDetector()
+		smp, err = newDetectingSampler(smp, detector, alert, conf.JitterSampleScope == boot.JitterSampleThread)
+		if err != nil {
+			s.lost(fmt.Errorf("creating attack detector: %v", err))
+			return
+		}
+	}
+	if conf.JitterContention.MinHITM > 0 {
+		smp, err = newContentionSampler(smp, conf.JitterHITMEvent, conf.JitterSampleScope == boot.JitterSampleThread)
+		if err != nil {
+			s.lost(fmt.Errorf("creating contention sampler: %v", err))
+			return
+		}
+	}
+	var heat *maid.Heatmap
+	if conf.JitterHeatDecay > 0 {
+		heat, err = maid.NewHeatmap(conf.JitterHeatDecay)
+		if err != nil {
+			s.lost(fmt.Errorf("creating heatmap: %v", err))
+			return
+		}
+	}
+	var topK *maid.TopK
+	if conf.JitterTopK > 0 {
+		topK = maid.NewTopK(conf.JitterTopK)
+	}
+	var coRes *coResidency
+	if conf.JitterCoResidency != boot.JitterCoResidencyIgnore {
+		coRes = newCoResidency(conf.JitterCoResidency, sel)
+	}
+	load := newHostLoad(conf)
+	cal := newProtectionCalendar(s)
+	go newQuotaCompensator(conf, cid).run(s)
+
+	var audit *maid.AuditLog
+	if conf.JitterAuditKey != "" {
+		dir, err := monitorWorkDir(conf, cid)
+		if err != nil {
+			s.lost(err)
+			return
+		}
+		var f *os.File
+		audit, f, err = openAuditLog(conf, dir)
+		if err != nil {
+			s.lost(fmt.Errorf("opening audit log: %v", err))
+			return
+		}
+		defer f.Close()
+	}
+
+	// Profiles are learned from the symbols of the targets.
+	var profile *imageProfile
+	if conf.JitterProfileDir != "" {
+		profile = loadImageProfile(conf.JitterProfileDir, s.bundleDir)
+		defer profile.save()
+	}
+	var symb *symbolizer
+	if conf.JitterSymbolize || profile != nil {
+		symb = newSymbolizer(cid, s.bundleDir)
+	}
+
+	var chaos *maid.Chaos
+	if conf.JitterChaos {
+		seed := time.Now().UnixNano()
+		log.Infof("[Cijitter] delaying %q at random as a control arm, seed %d", cid, seed)
+		chaos = maid.NewChaos(seed)
+	}
+
+	var fair *fairTurns
+	if conf.JitterFairTurns {
+		fair, err = newFairTurns(conf, cid, maid.DelayWindow)
+		if err != nil {
+			s.lost(err)
+			return
+		}
+		defer fair.close()
+	}
+
+	smpStage := &sessionSampler{s: s, sel: sel, smp: smp, heat: heat, topK: topK, alert: alert, lines: conf.JitterLineTier}
+	smpStage.failures = newFailureTracker(conf, cid, &s.samplerErrors)
+	if conf.JitterSampleDeadline > 0 {
+		smpStage.stall = maid.NewStallWatchdog(conf.JitterSampleDeadline, conf.JitterStallAction, func() {
+			s.send(maid.NewStopMessage())
+		})
+	}
+	m := &jitter.Monitor{
+		Name:            cid,
+		Policy:          s.policy,
+		Clock:           jitter.RealClock,
+		Sampler:         smpStage,
+		Notifier:        jitter.NotifierFunc(s.send),
+		Delayer:         backend,
+		SentrySchedules: conf.JitterScheduling == boot.JitterSchedulingSentry,
+		Calibrator:      calibrator,
+		Thresholds:      conf.JitterThresholds,
+		Chaos:           chaos,
+		Entropy:         conf.JitterEntropy,
+		Contention:      conf.JitterContention,
+		Gate: func() string {
+			return jitterGated(conf, cal, detector, coRes, load)
+		},
+		Suspended: s.isSuspended,
+		Refine: func(batch []maid.Target) ([]maid.Target, []maid.Symbol, bool) {
+			return applySymbolRules(s, &symb, batch)
+		},
+		Lighten: load.lighten,
+		Observe: func(jitter.Sample) {
+			// Libraries may be mapped after the regions were first
+			// preloaded.
+			profile.preload(cid)
+		},
+		Learn: profile.learn,
+		Wait: func() bool {
+			return fair.wait(s)
+		},
+		Record: recordDecision,
+	}
+	if audit != nil {
+		m.Audit = func(rec maid.AuditRecord) {
+			if err := audit.Record(rec); err != nil {
+				log.Warningf("[Cijitter] recording delay window to the audit log failed: %v", err)
+			}
+		}
+	}
+
+	if s.resume() {
+		// The workload is already running, there is nothing to warm up.
+	} else if profile.learned() {
+		// The hot regions of the image are known from past runs.
+		profile.preload(cid)
+	} else if conf.JitterStartOnExec {
+		waitForExec(s)
+	} else {
+		time.Sleep(conf.JitterWarmUp)
+	}
+	m.Run(s.ctx)
+}
+
+// applySymbolRules applies the per-function policies of s to batch, whose
+// symbols are looked up with *symb, created on first use. It returns the
+// targets left with their symbols, and whether they must always be delayed.
+func applySymbolRules(s *jitterSession, symb **symbolizer, batch []maid.Target) ([]maid.Target, []maid.Symbol, bool) {
+	rules := s.policy.SymbolRules()
+	if *symb == nil && len(rules) != 0 {
+		*symb = newSymbolizer(s.cid, s.bundleDir)
+	}
+	if len(batch) == 0 {
+		return batch, nil, false
+	}
+	syms := (*symb).symbolize(batch)
+	return rules.Apply(batch, syms)
+}
+
+// kernelPath is where the kernel module was historically built, it is
+// looked for there last.
+var kernelPath string = "/monitor/kernel/"
+
+// sampleLogName is the file the kernel module writes its samples to, in the
+// working directory of the monitor.
+const sampleLogName = "targetAddrs.list"
+
+// call kernel module to get target address
+func read_sample_logs(logPath string) ([]string, map[string]int) {
+	var addr_access map[string]int
+	addr_access = make(map[string]int)
+	var addrs_order []string
+	addr := "0x000000"
+	access := 0
+
+	fp, err := os.Open(logPath)
+	if err != nil {
+		log.Debugf("[Cijitter] read_sample_logs: open log file failed: %s", err)
+		return addrs_order, addr_access
+	}
+	defer fp.Close()
+
+	data := make([]byte, 8)
+	var k int64
+	index := 0
+	loc := 0
+
+	for {
+		data = data[:cap(data)]
+
+		// read bytes to slice
+		n, err := fp.Read(data)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			break
+		}
+
+		data = data[:n]
+		binary.Read(bytes.NewBuffer(data), binary.LittleEndian, &k)
+
+		// get address
+		if index%3 == 0 {
+			addr = fmt.Sprintf("0x%x", k)
+			addrs_order = append(addrs_order, addr)
+			loc = index + 2
+		}
+		// get access number of the address
+		if index == loc {
+			access = int(k)
+			addr_access[addr] = access
+		}
+		index++
+	}
+
+	return addrs_order, addr_access
+}
+
+func get_pid() []string {
+	var pids []string
+
+	command := "ps -aux | grep nobody | grep exe | grep -v grep"
+	cmd := exec.Command("bash", "-c", command)
+	output, err := cmd.Output()
+	if err != nil {
+		log.Debugf("[Cijitter] get pid failed:", err, output)
+		return pids
+	}
+
+	max_cpu := 0.0
+	target_pid := "-1"
+	items := strings.Split(string(output), "\n")
+	for _, item := range items {
+		result := strings.Join(strings.Fields(item), " ")
+		datas := strings.Split(result, " ")
+
+		if len(datas) == 1 {
+			continue
+		}
+
+		pid := datas[1]
+		cpu := datas[2]
+		mem := datas[3]
+		//rss := datas[5]
+		time := datas[9]
+
+		if mem != "0.0" || cpu != "0.0" || time != "0:00" {
+			cpu_data, _ := strconv.ParseFloat(cpu, 64)
+			if cpu_data > max_cpu {
+				max_cpu = cpu_data
+				target_pid = pid
+			}
+		}
+	}
+
+	if target_pid != "-1" {
+		pids = append(pids, target_pid)
+	}
+
+	return pids
+}
+
+var DBGFS string = "/sys/kernel/debug/mapia/"
+var DBGFS_ATTRS string = DBGFS + "attrs"
+var DBGFS_PIDS string = DBGFS + "pids"
+var DBGFS_TRACING_ON string = DBGFS + "tracing_on"
+var DBGFS_VERSION string = DBGFS + "version"
+var DBGFS_RING string = DBGFS + "ring"
+
+func chk_prerequisites(ctl daptraceControl, logPath string, archive io.Writer) bool {
+	// save old log file
+	if archive != nil {
+		if err := archiveSampleLog(logPath, archive); err != nil {
+			log.Debugf("[Cijitter] archiving old log failed: %s", err)
+		}
+	} else if logf, err := os.Stat(logPath); err == nil && !logf.IsDir() {
+		os.Rename(logPath, logPath+".old")
+	} else {
+		log.Debugf("[Cijitter] delete old log failed: %s", err)
+	}
+
+	// check kernel module
+	if err := ctl.load(logPath); err != nil {
+		log.Debugf("[Cijitter] kernel module load faild: %s", err)
+		return false
+	}
+
+	return true
+}
+
+func exit_handler(ctl daptraceControl) bool {
+	if err := ctl.unload(); err != nil {
+		log.Debugf("[Cijitter] rmmod kernel module failed: %s", err)
+		return false
+	}
+
+	return true
+}
+
+// get_target_addr samples the processes selected by sel, or none if sel is
+// nil, with smp.
+//
+// With a heatmap, the sample is added to it and the targets are its hottest
+// pages instead of the sample's. With topK, the sample is also added to it.
+//
+// The error is set if sampling failed, rather than sampled nothing.
+func get_target_addr(sel *targetSelector, smp sampler, heat *maid.Heatmap, topK *maid.TopK) (string, int, []maid.Target, bool, error) {
+	addr := ""
+	access := -1
+	var targets []string
+	if sel != nil {
+		var err error
+		targets, err = sel.pids()
+		if err != nil {
+			log.Debugf("[Cijitter] selecting target pids failed: %v", err)
+			return addr, access, nil, false, fmt.Errorf("selecting target pids: %v", err)
+		}
+		if len(targets) == 0 {
+			log.Debugf("[Cijitter] CANNOT GET TARGET PID...")
+			return addr, access, nil, false, nil
+		}
+	}
+
+	// get the target addr
+	addr_order, addrs_access, err := smp.sample(targets, sampleDuration)
+	if err != nil {
+		log.Debugf("[Cijitter] sampling %v failed: %v", targets, err)
+		return addr, access, nil, false, fmt.Errorf("sampling %v: %v", targets, err)
+	}
+	if len(addr_order) == 0 {
+		return addr, access, nil, false, nil
+	}
+
+	if topK != nil {
+		topK.AddTargets(sampledTargets(addr_order, addrs_access))
+	}
+	if heat != nil {
+		heat.Add(sampledTargets(addr_order, addrs_access))
+		batch := heat.Top(targetBatchSize)
+		if len(batch) == 0 {
+			return addr, access, nil, false, nil
+		}
+		return fmt.Sprintf("0x%x", uint64(batch[0].Addr)), batch[0].Accesses, batch, true, nil
+	}
+
+	batch := build_target_batch(addr_order, addrs_access)
+	return addr_order[0], addrs_access[addr_order[0]], batch, true, nil
+}
+
+// sampledTargets returns all the sampled addresses as targets.
+func sampledTargets(addrs []string, access map[string]int) []maid.Target {
+	targets := make([]maid.Target, 0, len(addrs))
+	for _, a := range addrs {
+		addr, err := maid.Hex2addr(a)
+		if err != nil || addr == 0 {
+			continue
+		}
+		targets = append(targets, maid.Target{Addr: addr, Accesses: access[a]})
+	}
+	return targets
+}
+
+// targetBatchSize is the maximum number of sampled pages sent to the sentry
+// in a single Start message.
+const targetBatchSize = 8
+
+// build_target_batch turns the sampled addresses, hottest first, into a batch
+// of page targets. Only the first sample of each page is kept so that the
+// primary target carries the same access count the policy decided on.
+func build_target_batch(addrs []string, access map[string]int) []maid.Target {
+	var batch []maid.Target
+	seen := make(map[usermem.Addr]bool)
+	for _, a := range addrs {
+		if len(batch) == targetBatchSize {
+			break
+		}
+		page, err := maid.Hex2addr(a)
+		if err != nil || page == 0 || access[a] <= 0 || seen[page] {
+			continue
+		}
+		seen[page] = true
+		batch = append(batch, maid.Target{Addr: page, Accesses: access[a]})
+	}
+	return batch
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/maid"
+)
+
+// daptraceNetlinkBuffer is the size of the buffer netlink datagrams are
+// received in. Sample events of the module are below a page.
+const daptraceNetlinkBuffer = 32 << 10
+
+// daptraceNetlink is a generic netlink socket to the daptrace module.
+type daptraceNetlink struct {
+	fd     int
+	family uint16
+	seq    uint32
+}
+
+// dialDaptrace opens a generic netlink socket to the daptrace module, which
+// must be loaded.
+func dialDaptrace() (*daptraceNetlink, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_GENERIC)
+	if err != nil {
+		return nil, fmt.Errorf("opening netlink socket: %v", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("binding netlink socket: %v", err)
+	}
+	n := &daptraceNetlink{fd: fd}
+	resp, err := n.call(maid.EncodeGetFamilyRequest(maid.DaptraceGenlName, n.nextSeq()))
+	if err == unix.ENOENT {
+		err = fmt.Errorf("%s module has no netlink interface, it predates version %d expected by runsc: rebuild it", daptraceModuleName, daptraceABIVersion)
+	}
+	if err == nil {
+		n.family, err = resp.FamilyID()
+	}
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("resolving %s netlink family: %v", daptraceModuleName, err)
+	}
+	return n, nil
+}
+
+// nextSeq returns the sequence number of the next request.
+func (n *daptraceNetlink) nextSeq() uint32 {
+	n.seq++
+	return n.seq
+}
+
+// request sends cmd with attrs to the module and returns its reply, if any.
+// The error is the errno the module acked the request with.
+func (n *daptraceNetlink) request(cmd uint8, attrs ...maid.NetlinkAttr) (*maid.GenlMessage, error) {
+	return n.call(maid.EncodeGenlRequest(n.family, cmd, maid.DaptraceGenlVersion, n.nextSeq(), attrs...))
+}
+
+// call sends the request req and waits for its ack, skipping sample events
+// and messages answering earlier requests.
+func (n *daptraceNetlink) call(req []byte) (*maid.GenlMessage, error) {
+	seq := n.seq
+	if err := unix.Sendto(n.fd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+	var reply *maid.GenlMessage
+	for {
+		msgs, err := n.receive(0)
+		if err != nil {
+			return nil, err
+		}
+		for i := range msgs {
+			m := &msgs[i]
+			if m.Seq != seq {
+				continue
+			}
+			if !m.IsAck() {
+				reply = m
+				continue
+			}
+			if m.Errno != 0 {
+				return nil, m.Errno
+			}
+			return reply, nil
+		}
+	}
+}
+
+// receive receives the messages of a datagram. flags are passed to recvfrom.
+func (n *daptraceNetlink) receive(flags int) ([]maid.GenlMessage, error) {
+	buf := make([]byte, daptraceNetlinkBuffer)
+	size, _, err := unix.Recvfrom(n.fd, buf, flags)
+	if err != nil {
+		return nil, err
+	}
+	return maid.ParseGenlMessages(buf[:size])
+}
+
+// close closes the socket.
+func (n *daptraceNetlink) close() {
+	unix.Close(n.fd)
+}
+
+// file returns the socket as a file, which n no longer owns.
+func (n *daptraceNetlink) file() *os.File {
+	return os.NewFile(uintptr(n.fd), "daptrace netlink socket")
+}
+
+// daptraceRequest performs the request of the daptraceControl write and read
+// operations on file name with netlink. value is the value written, if any.
+// It returns the content read.
+func daptraceRequest(name, value string) ([]byte, error) {
+	n, err := dialDaptrace()
+	if err != nil {
+		return nil, err
+	}
+	defer n.close()
+
+	switch name {
+	case daptracePids:
+		var pids []uint32
+		for _, f := range strings.Fields(value) {
+			pid, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pid %q", f)
+			}
+			pids = append(pids, uint32(pid))
+		}
+		_, err = n.request(maid.DaptraceCmdSetPids, maid.U32ArrayAttr(maid.DaptraceAttrPids, pids))
+		return nil, err
+	case daptraceTracingOn:
+		var on uint8
+		switch value {
+		case "on":
+			on = 1
+		case "off":
+		default:
+			return nil, fmt.Errorf("invalid %s value %q", daptraceTracingOn, value)
+		}
+		_, err = n.request(maid.DaptraceCmdSetTracing, maid.U8Attr(maid.DaptraceAttrTracingOn, on))
+		return nil, err
+	case daptraceVersion:
+		resp, err := n.request(maid.DaptraceCmdGetVersion)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			return nil, fmt.Errorf("no answer to the version request")
+		}
+		v, err := resp.U32(maid.DaptraceAttrVersion)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(fmt.Sprintf("%d\n", v)), nil
+	default:
+		return nil, fmt.Errorf("%s module has no %q", daptraceModuleName, name)
+	}
+}
+
+// subscribeDaptrace returns a netlink socket the module sends its samples
+// to, as a file.
+func subscribeDaptrace() (*os.File, error) {
+	n, err := dialDaptrace()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := n.request(maid.DaptraceCmdSubscribe); err != nil {
+		n.close()
+		return nil, fmt.Errorf("subscribing to %s samples: %v", daptraceModuleName, err)
+	}
+	return n.file(), nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/jitter"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+// sysNodePath is where the kernel exposes the NUMA nodes of the host.
+const sysNodePath = "/sys/devices/system/node"
+
+// hostNUMA is the NUMA topology of the host.
+type hostNUMA struct {
+	// nodes are the online nodes.
+	nodes []int
+
+	// cpuNode is the node of each CPU.
+	cpuNode map[int]int
+}
+
+// readHostNUMA reads the NUMA topology of the host.
+func readHostNUMA() (*hostNUMA, error) {
+	nodes, err := readCPUList(filepath.Join(sysNodePath, "online"))
+	if err != nil {
+		return nil, fmt.Errorf("listing NUMA nodes: %v", err)
+	}
+	h := &hostNUMA{nodes: nodes, cpuNode: make(map[int]int)}
+	for _, node := range nodes {
+		cpus, err := readCPUList(filepath.Join(sysNodePath, "node"+strconv.Itoa(node), "cpulist"))
+		if err != nil {
+			return nil, fmt.Errorf("listing CPUs of NUMA node %d: %v", node, err)
+		}
+		for _, cpu := range cpus {
+			h.cpuNode[cpu] = node
+		}
+	}
+	return h, nil
+}
+
+// numaDelayer records where the targets of the delay windows of another
+// delayer and the suspected attacker are on a multi-socket host. With
+// JitterNUMAMigrate, it migrates the targets living on the node of the
+// attacker to another node instead of opening the window, when that is
+// cheaper than the window.
+//
+// The suspected attackers are the processes sharing cores or last level cache
+// with the sandbox, as for co-residency, and their node the one most of them
+// last ran on.
+type numaDelayer struct {
+	jitter.Delayer
+
+	mode boot.JitterNUMA
+	topo *hostNUMA
+	sel  *targetSelector
+	cid  string
+
+	// attacker is the node of the suspected attacker, -1 if unknown, as of
+	// the last check. The host is checked again from next.
+	attacker int
+	next     time.Time
+
+	// delegated is set while a window of Delayer is open, rather than
+	// replaced by a migration.
+	delegated bool
+}
+
+// newNUMADelayer wraps d to take the NUMA nodes of the host into account in
+// mode for the windows on the container cid, whose processes sel selects. d
+// is returned as is on hosts of a single node.
+func newNUMADelayer(d jitter.Delayer, mode boot.JitterNUMA, sel *targetSelector, cid string) (jitter.Delayer, error) {
+	topo, err := readHostNUMA()
+	if err != nil {
+		return nil, err
+	}
+	if len(topo.nodes) < 2 {
+		log.Infof("[Cijitter] the host has a single NUMA node, jitter NUMA mode %v has no effect", mode)
+		return d, nil
+	}
+	return &numaDelayer{Delayer: d, mode: mode, topo: topo, sel: sel, cid: cid, attacker: -1}, nil
+}
+
+// Start implements jitter.Delayer.Start. The window opens as usual if the
+// placement of the targets can't be found or they can't be migrated.
+func (n *numaDelayer) Start(targets []maid.Target, intensity float64, wait maid.WaitMode) error {
+	pid, p, err := n.placement(targets)
+	if err != nil {
+		log.Debugf("[Cijitter] finding the NUMA nodes of the targets of %q: %v", n.cid, err)
+	} else {
+		log.Infof("[Cijitter] window on %d targets of %q: %v", len(targets), n.cid, p)
+	}
+	if err == nil && n.mode == boot.JitterNUMAMigrate {
+		if pages, dest, ok := p.Migration(maid.WindowCost(intensity)); ok {
+			if err := migratePages(pid, pages, dest); err != nil {
+				log.Warningf("[Cijitter] migrating %d targets of %q to NUMA node %d: %v, delaying them instead", len(pages), n.cid, dest, err)
+			} else {
+				log.Infof("[Cijitter] migrated %d targets of %q from the attacker's NUMA node %d to node %d instead of delaying them", len(pages), n.cid, p.Attacker, dest)
+				return nil
+			}
+		}
+	}
+	if err := n.Delayer.Start(targets, intensity, wait); err != nil {
+		return err
+	}
+	n.delegated = true
+	return nil
+}
+
+// Update implements jitter.Delayer.Update. The targets of a window replaced
+// by a migration are left where they are.
+func (n *numaDelayer) Update(targets []maid.Target) error {
+	if !n.delegated {
+		return nil
+	}
+	return n.Delayer.Update(targets)
+}
+
+// Stop implements jitter.Delayer.Stop.
+func (n *numaDelayer) Stop() error {
+	if !n.delegated {
+		return nil
+	}
+	n.delegated = false
+	return n.Delayer.Stop()
+}
+
+// placement returns the process the targets are in and their placement.
+func (n *numaDelayer) placement(targets []maid.Target) (int, maid.NUMAPlacement, error) {
+	p := maid.NUMAPlacement{Nodes: n.topo.nodes, Pages: make(map[int][]usermem.Addr), Attacker: n.attackerNode()}
+	pid, err := strconv.Atoi(n.sel.primaryPid())
+	if err != nil {
+		return 0, p, fmt.Errorf("no sampled process")
+	}
+	seen := make(map[usermem.Addr]bool, len(targets))
+	pages := make([]usermem.Addr, 0, len(targets))
+	for _, t := range targets {
+		if page := t.Addr.RoundDown(); !seen[page] {
+			seen[page] = true
+			pages = append(pages, page)
+		}
+	}
+	status, err := movePages(pid, pages, nil)
+	if err != nil {
+		return 0, p, err
+	}
+	for i, node := range status {
+		if node >= 0 {
+			p.Pages[int(node)] = append(p.Pages[int(node)], pages[i])
+		}
+	}
+	return pid, p, nil
+}
+
+// attackerNode returns the node most suspected attackers last ran on, -1 if
+// there are none. The host is inspected at most every coResidencyInterval.
+func (n *numaDelayer) attackerNode() int {
+	if time.Now().Before(n.next) {
+		return n.attacker
+	}
+	n.next = time.Now().Add(coResidencyInterval)
+
+	procs, err := n.sel.sandboxProcesses()
+	if err != nil {
+		log.Debugf("[Cijitter] finding suspected attackers failed: %v", err)
+		return n.attacker
+	}
+	suspects, err := coResidents(procs)
+	if err != nil {
+		log.Debugf("[Cijitter] finding suspected attackers failed: %v", err)
+		return n.attacker
+	}
+	count := make(map[int]int)
+	for _, pid := range suspects {
+		p, err := readHostProcess(pid)
+		if err != nil || p.cpu < 0 {
+			continue
+		}
+		if node, ok := n.topo.cpuNode[p.cpu]; ok {
+			count[node]++
+		}
+	}
+	attacker := -1
+	for _, node := range n.topo.nodes {
+		if count[node] > 0 && (attacker < 0 || count[node] > count[attacker]) {
+			attacker = node
+		}
+	}
+	if attacker != n.attacker {
+		if attacker < 0 {
+			log.Infof("[Cijitter] no suspected attacker of %q left", n.cid)
+		} else {
+			log.Infof("[Cijitter] suspected attackers of %q run on NUMA node %d", n.cid, attacker)
+		}
+	}
+	n.attacker = attacker
+	return attacker
+}
+
+// migratePages migrates pages of pid to node. It fails if any of them can't
+// be, e.g. because it is shared with other processes, the others staying
+// migrated.
+func migratePages(pid int, pages []usermem.Addr, node int) error {
+	nodes := make([]int32, len(pages))
+	for i := range nodes {
+		nodes[i] = int32(node)
+	}
+	status, err := movePages(pid, pages, nodes)
+	if err != nil {
+		return err
+	}
+	for i, st := range status {
+		if int(st) != node {
+			return fmt.Errorf("page %#x not migrated: %v", pages[i], unix.Errno(-st))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// mpolMFMove has move_pages(2) move the pages only mapped by the process.
+const mpolMFMove = 1 << 1
+
+// movePages calls move_pages(2) on pages of pid. If nodes is nil, the pages
+// stay where they are. It returns the node each page is on, or a negative
+// errno if it isn't, e.g. not faulted in yet.
+func movePages(pid int, pages []usermem.Addr, nodes []int32) ([]int32, error) {
+	if len(pages) == 0 {
+		return nil, nil
+	}
+	addrs := make([]uintptr, len(pages))
+	for i, page := range pages {
+		addrs[i] = uintptr(page)
+	}
+	status := make([]int32, len(pages))
+	var nodesPtr, flags uintptr
+	if nodes != nil {
+		nodesPtr, flags = uintptr(unsafe.Pointer(&nodes[0])), mpolMFMove
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_MOVE_PAGES, uintptr(pid), uintptr(len(pages)), uintptr(unsafe.Pointer(&addrs[0])), nodesPtr, uintptr(unsafe.Pointer(&status[0])), flags)
+	if errno != 0 {
+		return nil, fmt.Errorf("move_pages: %v", errno)
+	}
+	return status, nil
+}
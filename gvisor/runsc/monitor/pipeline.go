@@ -0,0 +1,98 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"gvisor.dev/gvisor/pkg/jitter"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+)
+
+// sessionSampler samples the sandbox of a session for jitter.Monitor, and
+// watches the samples for what the session reacts to on its own: process
+// switches, access spikes and heavy hitters.
+type sessionSampler struct {
+	s        *jitterSession
+	sel      *targetSelector
+	smp      sampler
+	heat     *maid.Heatmap
+	topK     *maid.TopK
+	stall    *maid.StallWatchdog
+	failures *failureTracker
+	alert    *alerter
+
+	// lines is set if the cache lines of the batch are sampled, for the
+	// line tier.
+	lines bool
+}
+
+// Sample implements jitter.Sampler.Sample.
+func (st *sessionSampler) Sample() (jitter.Sample, bool) {
+	st.stall.Begin()
+	addr, accesses, batch, ok, sampleErr := get_target_addr(st.sel, st.smp, st.heat, st.topK)
+	st.stall.End()
+	st.failures.record(sampleErr)
+	if st.sel != nil && st.sel.switchedProcess() {
+		log.Debugf("[Cijitter] sampled process changed, clearing targets")
+		st.s.send(maid.NewClearMessage())
+	}
+	if !ok {
+		return jitter.Sample{}, false
+	}
+	if accesses > st.s.policy.Thresholds().Spike {
+		st.alert.raise(maid.Alert{Kind: maid.AlertAccessSpike, Addr: addr, Accesses: accesses})
+	}
+	if st.topK != nil {
+		if top := st.topK.Top(); len(top) != 0 {
+			st.s.send(maid.NewHeavyHittersMessage(top))
+		}
+	}
+	if st.lines {
+		markLines(st.smp, batch)
+	}
+	// An invalid address is left to the monitor to skip.
+	target, err := maid.Hex2addr(addr)
+	if err != nil {
+		target = 0
+	}
+	smp := jitter.Sample{Addr: target, Accesses: accesses, Batch: batch}
+	if hs, ok := st.smp.(hitmSampler); ok {
+		smp.HITM = contendedLoads(st.smp, hs, batch, st.lines)
+	}
+	return smp, true
+}
+
+// contendedLoads returns how many of the HITM loads hs sampled fall on the
+// sampled cache lines of batch. marked is set if markLines already set them.
+func contendedLoads(smp sampler, hs hitmSampler, batch []maid.Target, marked bool) int {
+	if !marked {
+		batch = append([]maid.Target(nil), batch...)
+		markLines(smp, batch)
+	}
+	return maid.ContendedLoads(batch, hs.hitmLoads())
+}
+
+// markLines sets the cache lines smp sampled on the pages of batch, if it
+// tells them apart. Pages it didn't sample lines of are left whole.
+func markLines(smp sampler, batch []maid.Target) {
+	ls, ok := smp.(lineSampler)
+	if !ok {
+		return
+	}
+	lines := ls.lines()
+	for i := range batch {
+		batch[i].Lines = lines[batch[i].Addr]
+	}
+}
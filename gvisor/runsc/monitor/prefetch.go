@@ -0,0 +1,312 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/jitter"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/container"
+)
+
+// prefetchMSR is the model specific register controlling the hardware
+// prefetchers of a CPU vendor. A set bit disables a prefetcher.
+type prefetchMSR struct {
+	// msr is the address of the register.
+	msr uint32
+
+	// l1 and l2 are the bits of the L1 data cache and of the L2
+	// prefetchers.
+	l1 uint64
+	l2 uint64
+}
+
+var (
+	// intelPrefetchMSR is MSR_MISC_FEATURE_CONTROL: L2 streamer and
+	// adjacent line, DCU streamer and IP stride.
+	intelPrefetchMSR = prefetchMSR{msr: 0x1a4, l1: 0xc, l2: 0x3}
+
+	// amdPrefetchMSR is PrefetchControl of Zen 4 and later: L1 stream,
+	// stride and region, L2 stream and up/down.
+	amdPrefetchMSR = prefetchMSR{msr: 0xc0000108, l1: 0x7, l2: 0x28}
+)
+
+// hostPrefetchMSR returns the prefetch register of the host CPU vendor.
+func hostPrefetchMSR() (prefetchMSR, error) {
+	data, err := ioutil.ReadFile(cpuinfoPath)
+	if err != nil {
+		return prefetchMSR{}, err
+	}
+	switch {
+	case bytes.Contains(data, []byte("GenuineIntel")):
+		return intelPrefetchMSR, nil
+	case bytes.Contains(data, []byte("AuthenticAMD")):
+		return amdPrefetchMSR, nil
+	default:
+		return prefetchMSR{}, fmt.Errorf("prefetcher control is only supported on Intel and AMD CPUs")
+	}
+}
+
+// mask returns the bits of r disabling the prefetchers selected by p.
+func (r prefetchMSR) mask(p boot.JitterPrefetch) uint64 {
+	switch p {
+	case boot.JitterPrefetchAll:
+		return r.l1 | r.l2
+	case boot.JitterPrefetchL1:
+		return r.l1
+	case boot.JitterPrefetchL2:
+		return r.l2
+	default:
+		return 0
+	}
+}
+
+// msrControl reads and writes the prefetch register of a CPU, which requires
+// CAP_SYS_RAWIO.
+type msrControl interface {
+	// readMSR returns the value of msr on cpu.
+	readMSR(cpu int, msr uint32) (uint64, error)
+
+	// writeMSR sets msr to v on cpu.
+	writeMSR(cpu int, msr uint32, v uint64) error
+}
+
+// newMSRControl returns how MSRs are accessed: through the privileged helper
+// with --jitter-privsep, from the monitor itself otherwise.
+func newMSRControl() msrControl {
+	if jitterHelper != nil {
+		return jitterHelper
+	}
+	return hostMSR{}
+}
+
+// hostMSR accesses MSRs from the current process through the msr driver.
+type hostMSR struct{}
+
+// msrPath returns the msr driver file of cpu.
+func msrPath(cpu int) string {
+	return fmt.Sprintf("/dev/cpu/%d/msr", cpu)
+}
+
+// readMSR implements msrControl.readMSR.
+func (hostMSR) readMSR(cpu int, msr uint32) (uint64, error) {
+	f, err := os.Open(msrPath(cpu))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var buf [8]byte
+	if _, err := f.ReadAt(buf[:], int64(msr)); err != nil {
+		return 0, fmt.Errorf("reading MSR %#x of CPU %d: %v", msr, cpu, err)
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+// writeMSR implements msrControl.writeMSR.
+func (hostMSR) writeMSR(cpu int, msr uint32, v uint64) error {
+	f, err := os.OpenFile(msrPath(cpu), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	if _, err := f.WriteAt(buf[:], int64(msr)); err != nil {
+		return fmt.Errorf("writing MSR %#x of CPU %d: %v", msr, cpu, err)
+	}
+	return nil
+}
+
+// prefetchDirName is the directory, in the jitter working directory, where
+// the monitors count the delay windows that disabled the prefetchers of each
+// CPU. '@' is not allowed in container IDs, so it is never the working
+// directory of a container.
+const prefetchDirName = "@prefetch"
+
+// prefetchDelayer disables hardware prefetchers on the CPUs the sandbox may
+// run on while a delay window of another delayer is open. Prefetches leak
+// the access pattern of the window's pages through the cache even when the
+// accesses themselves are delayed.
+//
+// Sandboxes may share CPUs, so the monitors count the open windows of each
+// CPU in a file of the shared working directory, and the last window to close
+// restores the register as it was before the first one opened. If the monitor
+// is killed during a window, its count is never dropped and the prefetchers
+// stay disabled until a reboot, or until the file of the CPU is removed.
+type prefetchDelayer struct {
+	jitter.Delayer
+
+	ctl     msrControl
+	reg     prefetchMSR
+	mask    uint64
+	rootDir string
+	dir     string
+	cid     string
+
+	// held are the CPUs whose prefetchers the open window disabled.
+	held []int
+}
+
+// newPrefetchDelayer wraps d to disable the prefetchers selected in conf
+// during its windows on container cid.
+func newPrefetchDelayer(d jitter.Delayer, conf *boot.Config, cid string) (*prefetchDelayer, error) {
+	reg, err := hostPrefetchMSR()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := monitorWorkDir(conf, prefetchDirName)
+	if err != nil {
+		return nil, err
+	}
+	return &prefetchDelayer{
+		Delayer: d,
+		ctl:     newMSRControl(),
+		reg:     reg,
+		mask:    reg.mask(conf.JitterPrefetch),
+		rootDir: conf.RootDir,
+		dir:     dir,
+		cid:     cid,
+	}, nil
+}
+
+// Start implements jitter.Delayer.Start. The window opens even if the
+// prefetchers can't be disabled.
+func (p *prefetchDelayer) Start(targets []maid.Target, intensity float64, wait maid.WaitMode) error {
+	if err := p.disable(); err != nil {
+		log.Warningf("[Cijitter] disabling prefetchers of %q: %v", p.cid, err)
+	}
+	if err := p.Delayer.Start(targets, intensity, wait); err != nil {
+		p.restore()
+		return err
+	}
+	return nil
+}
+
+// Stop implements jitter.Delayer.Stop.
+func (p *prefetchDelayer) Stop() error {
+	err := p.Delayer.Stop()
+	p.restore()
+	return err
+}
+
+// disable disables the prefetchers on the CPUs the sandbox may run on.
+func (p *prefetchDelayer) disable() error {
+	c, err := container.Load(p.rootDir, p.cid)
+	if err != nil {
+		return fmt.Errorf("loading container: %v", err)
+	}
+	if c.Sandbox == nil || c.Sandbox.Pid == 0 {
+		return fmt.Errorf("sandbox is not running")
+	}
+	cpus, err := allowedCPUs(c.Sandbox.Pid)
+	if err != nil {
+		return err
+	}
+	for _, cpu := range cpus {
+		if err := p.acquire(cpu); err != nil {
+			return err
+		}
+		p.held = append(p.held, cpu)
+	}
+	log.Debugf("[Cijitter] disabled prefetchers %#x of %q on %d CPUs", p.mask, p.cid, len(p.held))
+	return nil
+}
+
+// restore gives the CPUs their prefetchers back, unless windows of other
+// monitors are still open on them.
+func (p *prefetchDelayer) restore() {
+	for _, cpu := range p.held {
+		if err := p.release(cpu); err != nil {
+			log.Warningf("[Cijitter] restoring prefetchers of CPU %d: %v", cpu, err)
+		}
+	}
+	p.held = nil
+}
+
+// acquire disables the prefetchers of cpu and counts the window on it. The
+// first window saves the register value to restore.
+func (p *prefetchDelayer) acquire(cpu int) error {
+	return p.updateCPU(cpu, func(saved uint64, windows int) (uint64, int, error) {
+		v, err := p.ctl.readMSR(cpu, p.reg.msr)
+		if err != nil {
+			return saved, windows, err
+		}
+		if windows == 0 {
+			saved = v
+		}
+		// Disabled already, by the host or another monitor, otherwise.
+		if v&p.mask != p.mask {
+			if err := p.ctl.writeMSR(cpu, p.reg.msr, v|p.mask); err != nil {
+				return saved, windows, err
+			}
+		}
+		return saved, windows + 1, nil
+	})
+}
+
+// release drops the window from the count of cpu, and restores the saved
+// register value if it was the last one.
+func (p *prefetchDelayer) release(cpu int) error {
+	return p.updateCPU(cpu, func(saved uint64, windows int) (uint64, int, error) {
+		if windows <= 1 {
+			return 0, 0, p.ctl.writeMSR(cpu, p.reg.msr, saved)
+		}
+		return saved, windows - 1, nil
+	})
+}
+
+// updateCPU calls fn with the saved register value and the open windows of
+// cpu, and records what it returns, under a lock shared by all monitors. The
+// record is left as it was if fn fails.
+func (p *prefetchDelayer) updateCPU(cpu int, fn func(saved uint64, windows int) (uint64, int, error)) error {
+	f, err := os.OpenFile(filepath.Join(p.dir, strconv.Itoa(cpu)), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("locking prefetcher count of CPU %d: %v", cpu, err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	var saved uint64
+	var windows int
+	if len(data) != 0 {
+		if _, err := fmt.Sscanf(string(data), "%x %d", &saved, &windows); err != nil {
+			return fmt.Errorf("parsing prefetcher count of CPU %d: %v", cpu, err)
+		}
+	}
+	saved, windows, err = fn(saved, windows)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt([]byte(fmt.Sprintf("%x %d\n", saved, windows)), 0)
+	return err
+}
@@ -0,0 +1,686 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/syndtr/gocapability/capability"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cmd"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// Files of the daptrace module in debugfs. The netlink interface of the
+// module serves the same names, except for the ring buffer, and
+// daptraceEvents names its sample events.
+const (
+	daptracePids      = "pids"
+	daptraceTracingOn = "tracing_on"
+	daptraceVersion   = "version"
+	daptraceRing      = "ring"
+	daptraceEvents    = "events"
+)
+
+// daptraceControl performs the operations on the daptrace module that
+// require privileges. Names are files of the module in debugfs.
+type daptraceControl interface {
+	// load loads the module, writing its samples to output, unless it is
+	// already loaded.
+	load(output string) error
+
+	// unload unloads the module.
+	unload() error
+
+	// write writes value to the file name.
+	write(name, value string) error
+
+	// read returns the content of the file name.
+	read(name string) ([]byte, error)
+
+	// open opens the file name read-only. With daptraceEvents, it
+	// returns a netlink socket the module sends its samples to.
+	open(name string) (*os.File, error)
+}
+
+// jitterHelper is the connection of the monitor to its privileged helper with
+// --jitter-privsep. It is nil otherwise.
+var jitterHelper *helperClient
+
+// newDaptraceControl returns how the daptrace module selected in conf is
+// controlled: through the privileged helper with --jitter-privsep, from the
+// monitor itself otherwise.
+func newDaptraceControl(conf *boot.Config) (daptraceControl, error) {
+	if jitterHelper != nil {
+		return jitterHelper, nil
+	}
+	module, err := findDaptraceModule(conf)
+	if err != nil {
+		return nil, err
+	}
+	return hostDaptrace{module: module}, nil
+}
+
+// hostDaptrace controls the daptrace module from the current process. Unless
+// it runs as root, commands run with sudo.
+type hostDaptrace struct {
+	// module is the path of the module.
+	module string
+}
+
+// run runs the command name with args, with sudo unless running as root.
+func (h hostDaptrace) run(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	if os.Geteuid() != 0 {
+		args = append([]string{name}, args...)
+		name = "sudo"
+	}
+	c := exec.Command(name, args...)
+	c.Stdin = stdin
+	return c.CombinedOutput()
+}
+
+// load implements daptraceControl.load.
+func (h hostDaptrace) load(output string) error {
+	if kernel, err := os.Stat(DBGFS); err != nil || !kernel.IsDir() {
+		if out, err := h.run(nil, "insmod", h.module, "output="+output); err != nil {
+			return fmt.Errorf("loading %s module %q: %v, %s", daptraceModuleName, h.module, err, out)
+		}
+	}
+	if pids, err := os.Stat(DBGFS_PIDS); err != nil || pids.IsDir() {
+		return fmt.Errorf("%s module has no pids file: %v", daptraceModuleName, err)
+	}
+	return nil
+}
+
+// unload implements daptraceControl.unload.
+func (h hostDaptrace) unload() error {
+	if out, err := h.run(nil, "rmmod", daptraceModuleName); err != nil {
+		return fmt.Errorf("unloading %s module: %v, %s", daptraceModuleName, err, out)
+	}
+	return nil
+}
+
+// write implements daptraceControl.write. As root, it goes through the
+// netlink interface of the module, which acks errors. Otherwise it writes the
+// debugfs file with sudo.
+func (h hostDaptrace) write(name, value string) error {
+	if os.Geteuid() != 0 {
+		if out, err := h.run(strings.NewReader(value), "tee", DBGFS+name); err != nil {
+			return fmt.Errorf("writing %q to %s: %v, %s", value, DBGFS+name, err, out)
+		}
+		return nil
+	}
+	if _, err := daptraceRequest(name, value); err != nil {
+		return &os.PathError{Op: "write", Path: name, Err: err}
+	}
+	return nil
+}
+
+// read implements daptraceControl.read.
+func (hostDaptrace) read(name string) ([]byte, error) {
+	if os.Geteuid() != 0 {
+		return ioutil.ReadFile(DBGFS + name)
+	}
+	data, err := daptraceRequest(name, "")
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// open implements daptraceControl.open.
+func (hostDaptrace) open(name string) (*os.File, error) {
+	if name == daptraceEvents {
+		return subscribeDaptrace()
+	}
+	return os.OpenFile(DBGFS+name, os.O_RDONLY, 0)
+}
+
+// Operations of the helper, named after the daptraceControl and msrControl
+// methods.
+const (
+	helperLoad     = "load"
+	helperUnload   = "unload"
+	helperWrite    = "write"
+	helperRead     = "read"
+	helperOpen     = "open"
+	helperSign     = "sign"
+	helperReadMSR  = "read-msr"
+	helperWriteMSR = "write-msr"
+)
+
+// helperRequest is a request of the monitor to its privileged helper.
+type helperRequest struct {
+	// Op is the operation to perform.
+	Op string
+
+	// Output is the argument of helperLoad.
+	Output string
+
+	// Name and Value are the arguments of helperWrite, helperRead and
+	// helperOpen.
+	Name  string
+	Value string
+
+	// Hash is the argument of helperSign.
+	Hash []byte
+
+	// CPU, MSR and MSRValue are the arguments of helperReadMSR and
+	// helperWriteMSR.
+	CPU      int
+	MSR      uint32
+	MSRValue uint64
+}
+
+// helperResponse is the answer of the helper to a helperRequest. The file
+// opened by helperOpen travels alongside it.
+type helperResponse struct {
+	// Err is the error of the operation, if any. Errno is set if it failed
+	// in a system call, so that the monitor can tell errors apart.
+	Err   string
+	Errno syscall.Errno
+
+	// Data is the result of helperRead and helperSign.
+	Data []byte
+
+	// MSRValue is the result of helperReadMSR.
+	MSRValue uint64
+}
+
+// helperMaxMessage bounds the size of the messages between the monitor and
+// its helper.
+const helperMaxMessage = 64 << 10
+
+// sendHelperMessage sends m over the socket fd, along with file unless it is
+// negative.
+func sendHelperMessage(fd int, m interface{}, file int) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		return err
+	}
+	var oob []byte
+	if file >= 0 {
+		oob = unix.UnixRights(file)
+	}
+	return unix.Sendmsg(fd, buf.Bytes(), oob, nil, 0)
+}
+
+// recvHelperMessage receives m from the socket fd, along with the file sent
+// with it if any. It returns io.EOF once the peer is gone.
+func recvHelperMessage(fd int, m interface{}) (*os.File, error) {
+	buf := make([]byte, helperMaxMessage)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := unix.Recvmsg(fd, buf, oob, unix.MSG_CMSG_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, io.EOF
+	}
+	var file *os.File
+	if oobn > 0 {
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(msgs) != 1 {
+			return nil, fmt.Errorf("invalid control message: %v", err)
+		}
+		fds, err := unix.ParseUnixRights(&msgs[0])
+		if err != nil || len(fds) != 1 {
+			return nil, fmt.Errorf("invalid file in control message: %v", err)
+		}
+		file = os.NewFile(uintptr(fds[0]), "jitter helper file")
+	}
+	if err := gob.NewDecoder(bytes.NewReader(buf[:n])).Decode(m); err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// helperClient controls the daptrace module through the privileged helper.
+type helperClient struct {
+	// mu serializes requests, the helper answers them in order.
+	mu sync.Mutex
+
+	// fd is the monitor end of the socket to the helper.
+	fd int
+}
+
+// call sends req to the helper and returns its response, along with the file
+// the helper sent if any.
+func (c *helperClient) call(req helperRequest) (helperResponse, *os.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var resp helperResponse
+	if err := sendHelperMessage(c.fd, &req, -1); err != nil {
+		return resp, nil, fmt.Errorf("sending %s request to jitter helper: %v", req.Op, err)
+	}
+	file, err := recvHelperMessage(c.fd, &resp)
+	if err != nil {
+		return resp, nil, fmt.Errorf("receiving %s response from jitter helper: %v", req.Op, err)
+	}
+	if resp.Errno != 0 {
+		path := DBGFS + req.Name
+		if req.Op == helperReadMSR || req.Op == helperWriteMSR {
+			path = msrPath(req.CPU)
+		}
+		return resp, file, &os.PathError{Op: req.Op, Path: path, Err: resp.Errno}
+	}
+	if resp.Err != "" {
+		return resp, file, errors.New(resp.Err)
+	}
+	return resp, file, nil
+}
+
+// load implements daptraceControl.load.
+func (c *helperClient) load(output string) error {
+	_, _, err := c.call(helperRequest{Op: helperLoad, Output: output})
+	return err
+}
+
+// unload implements daptraceControl.unload.
+func (c *helperClient) unload() error {
+	_, _, err := c.call(helperRequest{Op: helperUnload})
+	return err
+}
+
+// write implements daptraceControl.write.
+func (c *helperClient) write(name, value string) error {
+	_, _, err := c.call(helperRequest{Op: helperWrite, Name: name, Value: value})
+	return err
+}
+
+// read implements daptraceControl.read.
+func (c *helperClient) read(name string) ([]byte, error) {
+	resp, _, err := c.call(helperRequest{Op: helperRead, Name: name})
+	return resp.Data, err
+}
+
+// open implements daptraceControl.open.
+func (c *helperClient) open(name string) (*os.File, error) {
+	_, file, err := c.call(helperRequest{Op: helperOpen, Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("jitter helper sent no file for %s", name)
+	}
+	return file, nil
+}
+
+// SignAudit implements maid.AuditSigner.SignAudit.
+func (c *helperClient) SignAudit(hash []byte) ([]byte, error) {
+	resp, _, err := c.call(helperRequest{Op: helperSign, Hash: hash})
+	return resp.Data, err
+}
+
+// readMSR implements msrControl.readMSR.
+func (c *helperClient) readMSR(cpu int, msr uint32) (uint64, error) {
+	resp, _, err := c.call(helperRequest{Op: helperReadMSR, CPU: cpu, MSR: msr})
+	return resp.MSRValue, err
+}
+
+// writeMSR implements msrControl.writeMSR.
+func (c *helperClient) writeMSR(cpu int, msr uint32, v uint64) error {
+	_, _, err := c.call(helperRequest{Op: helperWriteMSR, CPU: cpu, MSR: msr, MSRValue: v})
+	return err
+}
+
+// nobody is the user and group the monitor runs as with --jitter-privsep.
+const nobody = 65534
+
+// helperFDArg is the argument of the monitor subcommand carrying the socket
+// to the helper once the monitor runs as nobody.
+const helperFDArg = "jitter-helper-fd"
+
+// setUpJitterPrivsep splits the monitor of container cid into a privileged
+// helper and the unprivileged monitor. Started as root, it starts the helper
+// and execs the monitor again as nobody. It only returns in the unprivileged
+// monitor, with jitterHelper connected to the helper.
+func setUpJitterPrivsep(conf *boot.Config, cid string) {
+	if arg, ok := subcommandArg(helperFDArg); ok {
+		fd, err := strconv.Atoi(arg)
+		if err != nil {
+			cmd.Fatalf("[Cijitter] invalid --%s %q", helperFDArg, arg)
+		}
+		// Other processes started by the monitor must not keep the
+		// helper alive.
+		unix.CloseOnExec(fd)
+		jitterHelper = &helperClient{fd: fd}
+		log.Infof("[Cijitter] monitor of %q running as UID %d, GID %d", cid, os.Getuid(), os.Getgid())
+		return
+	}
+
+	dir, err := monitorWorkDir(conf, cid)
+	if err != nil {
+		cmd.Fatalf("[Cijitter] %v", err)
+	}
+	if err := chownWorkDir(conf.JitterWorkDir, dir); err != nil {
+		cmd.Fatalf("[Cijitter] handing working directory over to nobody: %v", err)
+	}
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		cmd.Fatalf("[Cijitter] creating jitter helper socket: %v", err)
+	}
+	helperEnd := os.NewFile(uintptr(fds[1]), "jitter helper socket")
+	helper := exec.Command(specutils.ExePath, append(conf.ToFlags(), "jitter-helper")...)
+	helper.ExtraFiles = []*os.File{helperEnd}
+	helper.Stdout = os.Stderr
+	helper.Stderr = os.Stderr
+	if err := helper.Start(); err != nil {
+		cmd.Fatalf("[Cijitter] starting jitter helper: %v", err)
+	}
+	helperEnd.Close()
+	log.Infof("[Cijitter] jitter helper started, PID: %d", helper.Process.Pid)
+
+	// Only the monitor itself keeps its end across exec.
+	if _, err := unix.FcntlInt(uintptr(fds[0]), unix.F_SETFD, 0); err != nil {
+		cmd.Fatalf("[Cijitter] passing jitter helper socket: %v", err)
+	}
+	args := append(os.Args, fmt.Sprintf("--%s=%d", helperFDArg, fds[0]))
+	if err := execAsNobody(args); err != nil {
+		cmd.Fatalf("[Cijitter] dropping monitor privileges: %v", err)
+	}
+}
+
+// chownWorkDir hands dir, the working directory of a monitor under workDir,
+// and the files in it over to nobody.
+func chownWorkDir(workDir, dir string) error {
+	// Others may traverse workDir to reach their own directory, but not
+	// list it.
+	if err := os.Chmod(workDir, 0711); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Lchown(filepath.Join(dir, f.Name()), nobody, nobody); err != nil {
+			return err
+		}
+	}
+	return os.Chown(dir, nobody, nobody)
+}
+
+// execAsNobody execs runsc with args as nobody, without any capability.
+func execAsNobody(args []string) error {
+	// Keep thread locked while user/group are changed.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if _, _, err := syscall.RawSyscall(syscall.SYS_SETGROUPS, 0, 0, 0); err != 0 {
+		return fmt.Errorf("error clearing supplementary groups: %v", err)
+	}
+	if _, _, err := syscall.RawSyscall(syscall.SYS_SETGID, uintptr(nobody), 0, 0); err != 0 {
+		return fmt.Errorf("error setting gid: %v", err)
+	}
+	if _, _, err := syscall.RawSyscall(syscall.SYS_SETUID, uintptr(nobody), 0, 0); err != 0 {
+		return fmt.Errorf("error setting uid: %v", err)
+	}
+
+	log.Infof("Execve %q again as nobody, bye!", specutils.ExePath)
+	err := syscall.Exec(specutils.ExePath, args, os.Environ())
+	return fmt.Errorf("error executing %s: %v", specutils.ExePath, err)
+}
+
+// helperCaps are the only capabilities the helper keeps: loading the module,
+// driving it over netlink and mapping its ring buffer in debugfs.
+var helperCaps = []capability.Cap{capability.CAP_NET_ADMIN, capability.CAP_SYS_ADMIN, capability.CAP_SYS_MODULE}
+
+// helperMSRCaps are the capabilities the helper keeps on top of helperCaps to
+// control the prefetchers with --jitter-prefetch.
+var helperMSRCaps = []capability.Cap{capability.CAP_SYS_RAWIO}
+
+// execWithHelperCaps execs runsc with args, keeping helperCaps only, and
+// helperMSRCaps if the helper controls the prefetchers.
+func execWithHelperCaps(args []string, msr bool) error {
+	caps := helperCaps
+	if msr {
+		caps = append(append([]capability.Cap(nil), helperCaps...), helperMSRCaps...)
+	}
+
+	// Keep thread locked while capabilities are changed.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	c, err := capability.NewPid2(0)
+	if err != nil {
+		return err
+	}
+	c.Clear(capability.CAPS | capability.BOUNDS | capability.AMBS)
+	c.Set(capability.CAPS|capability.BOUNDS, caps...)
+	if err := c.Apply(capability.CAPS | capability.BOUNDS); err != nil {
+		return fmt.Errorf("restricting capabilities: %v", err)
+	}
+
+	log.Infof("Execve %q again with %v, bye!", specutils.ExePath, caps)
+	err = syscall.Exec(specutils.ExePath, args, os.Environ())
+	return fmt.Errorf("error executing %s: %v", specutils.ExePath, err)
+}
+
+// helperFD is the helper end of the socket to the monitor.
+const helperFD = 3
+
+// RunHelper runs the jitter-helper subcommand, the privileged half of
+// a monitor with --jitter-privsep. It resolves the daptrace module as root,
+// building it if needed, then execs itself with helperCaps only and serves
+// the monitor until it exits. It also holds the audit key, if any, and
+// controls the prefetchers with --jitter-prefetch.
+func RunHelper(conf *boot.Config) {
+	module, ok := subcommandArg("module")
+	if !ok {
+		m, err := findDaptraceModule(conf)
+		if err != nil {
+			cmd.Fatalf("[Cijitter] %v", err)
+		}
+		args := append(os.Args, "--module="+m)
+		if err := execWithHelperCaps(args, conf.JitterPrefetch != boot.JitterPrefetchOff); err != nil {
+			cmd.Fatalf("[Cijitter] %v", err)
+		}
+	}
+
+	unix.CloseOnExec(helperFD)
+	s := helperServer{
+		ctl:     hostDaptrace{module: module},
+		workDir: filepath.Clean(conf.JitterWorkDir),
+	}
+	if conf.JitterAuditKey != "" {
+		key, err := readAuditKey(conf.JitterAuditKey)
+		if err != nil {
+			cmd.Fatalf("[Cijitter] %v", err)
+		}
+		s.signer = key
+	}
+	if conf.JitterPrefetch != boot.JitterPrefetchOff {
+		reg, err := hostPrefetchMSR()
+		if err != nil {
+			cmd.Fatalf("[Cijitter] %v", err)
+		}
+		s.msr, s.prefetch, s.prefetchMask = hostMSR{}, reg, reg.mask(conf.JitterPrefetch)
+	}
+	log.Infof("[Cijitter] jitter helper serving module %q", module)
+	for {
+		var req helperRequest
+		if _, err := recvHelperMessage(helperFD, &req); err != nil {
+			if err != io.EOF {
+				log.Warningf("[Cijitter] jitter helper: receiving request: %v", err)
+			}
+			break
+		}
+		resp, file := s.handle(req)
+		fd := -1
+		if file != nil {
+			fd = int(file.Fd())
+		}
+		err := sendHelperMessage(helperFD, &resp, fd)
+		if file != nil {
+			file.Close()
+		}
+		if err != nil {
+			log.Warningf("[Cijitter] jitter helper: sending response: %v", err)
+			break
+		}
+	}
+	log.Infof("[Cijitter] monitor gone, jitter helper exiting")
+	os.Exit(0)
+}
+
+// helperServer performs the requests of the monitor.
+type helperServer struct {
+	ctl daptraceControl
+
+	// workDir is the working directory of the monitors, where the module
+	// may write its samples.
+	workDir string
+
+	// signer signs the audit log of the monitor. It is nil if auditing is
+	// disabled.
+	signer maid.AuditSigner
+
+	// msr accesses the prefetch register prefetch, of which the monitor
+	// may only change the bits of prefetchMask. It is nil if prefetcher
+	// control is disabled.
+	msr          msrControl
+	prefetch     prefetchMSR
+	prefetchMask uint64
+}
+
+// handle performs req and returns the response to it, along with the file to
+// send with it if any.
+func (s *helperServer) handle(req helperRequest) (helperResponse, *os.File) {
+	var resp helperResponse
+	var file *os.File
+	err := s.check(req)
+	if err == nil {
+		switch req.Op {
+		case helperLoad:
+			err = s.ctl.load(req.Output)
+		case helperUnload:
+			err = s.ctl.unload()
+		case helperWrite:
+			err = s.ctl.write(req.Name, req.Value)
+		case helperRead:
+			resp.Data, err = s.ctl.read(req.Name)
+		case helperOpen:
+			file, err = s.ctl.open(req.Name)
+		case helperSign:
+			resp.Data, err = s.signer.SignAudit(req.Hash)
+		case helperReadMSR:
+			resp.MSRValue, err = s.msr.readMSR(req.CPU, req.MSR)
+		case helperWriteMSR:
+			err = s.msr.writeMSR(req.CPU, req.MSR, req.MSRValue)
+		}
+	}
+	if err != nil {
+		log.Debugf("[Cijitter] jitter helper: %s request failed: %v", req.Op, err)
+		resp.Err = err.Error()
+		var errno syscall.Errno
+		if errors.As(err, &errno) {
+			resp.Errno = errno
+		}
+	}
+	return resp, file
+}
+
+// check returns an error unless req is a request the monitor needs. The
+// monitor is not trusted beyond that.
+func (s *helperServer) check(req helperRequest) error {
+	switch req.Op {
+	case helperLoad:
+		// The output becomes a module parameter, it must not carry
+		// others.
+		out := filepath.Clean(req.Output)
+		if !strings.HasPrefix(out, s.workDir+"/") || strings.ContainsAny(out, " \t\n\"'") {
+			return fmt.Errorf("module output %q is not in %q", req.Output, s.workDir)
+		}
+		return nil
+	case helperUnload:
+		return nil
+	case helperWrite:
+		switch req.Name {
+		case daptracePids:
+			for _, pid := range strings.Fields(req.Value) {
+				if n, err := strconv.Atoi(pid); err != nil || n <= 0 {
+					return fmt.Errorf("invalid pid %q", pid)
+				}
+			}
+			return nil
+		case daptraceTracingOn:
+			if req.Value != "on" && req.Value != "off" {
+				return fmt.Errorf("invalid %s value %q", daptraceTracingOn, req.Value)
+			}
+			return nil
+		}
+	case helperRead:
+		if req.Name == daptraceVersion {
+			return nil
+		}
+	case helperOpen:
+		if req.Name == daptraceRing || req.Name == daptraceEvents {
+			return nil
+		}
+	case helperSign:
+		if s.signer == nil {
+			return fmt.Errorf("auditing is disabled")
+		}
+		if len(req.Hash) != sha256.Size {
+			return fmt.Errorf("audit hash has %d bytes, want %d", len(req.Hash), sha256.Size)
+		}
+		return nil
+	case helperReadMSR, helperWriteMSR:
+		if s.msr == nil {
+			return fmt.Errorf("prefetcher control is disabled")
+		}
+		if req.MSR != s.prefetch.msr || req.CPU < 0 {
+			return fmt.Errorf("MSR %#x of CPU %d is not allowed", req.MSR, req.CPU)
+		}
+		if req.Op == helperReadMSR {
+			return nil
+		}
+		// Only the prefetcher bits may change.
+		cur, err := s.msr.readMSR(req.CPU, req.MSR)
+		if err != nil {
+			return err
+		}
+		if (cur^req.MSRValue)&^s.prefetchMask != 0 {
+			return fmt.Errorf("writing %#x to MSR %#x changes more than the prefetcher bits %#x", req.MSRValue, req.MSR, s.prefetchMask)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %q", req.Op)
+	}
+	return fmt.Errorf("%s of %q is not allowed", req.Op, req.Name)
+}
@@ -0,0 +1,252 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// imageAnnotations are the spec annotations that identify the image of a
+// container, by preference. JitterImageAnnotation can be set by hand, the
+// others are set by CRI runtimes.
+var imageAnnotations = []string{
+	boot.JitterImageAnnotation,
+	"io.kubernetes.cri-o.ImageRef",
+	"io.kubernetes.cri.image-name",
+	"io.kubernetes.cri-o.ImageName",
+}
+
+// imageKey returns what identifies the image of spec: the first image
+// annotation set, or else the digest of the entrypoint executable in the root
+// filesystem. It returns "" if neither is available.
+func imageKey(spec *specs.Spec) string {
+	for _, a := range imageAnnotations {
+		if v := spec.Annotations[a]; v != "" {
+			return v
+		}
+	}
+	if spec.Root == nil || spec.Process == nil || len(spec.Process.Args) == 0 || !filepath.IsAbs(spec.Process.Args[0]) {
+		return ""
+	}
+	f, err := os.Open(filepath.Join(spec.Root.Path, filepath.Clean(spec.Process.Args[0])))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return "entrypoint:sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// profileRegion is a page that was hot in past runs of an image, given by
+// mapping and offset since addresses change from run to run.
+type profileRegion struct {
+	Path     string `json:"path"`
+	Offset   uint64 `json:"offset"`
+	Accesses int    `json:"accesses"`
+}
+
+// imageProfile is what the monitor learned over the runs of an image.
+type imageProfile struct {
+	// Image is the image key.
+	Image string `json:"image"`
+
+	// Regions are the hottest regions, most accessed first. At most
+	// maid.MaxSecretPages are kept.
+	Regions []profileRegion `json:"regions"`
+
+	// path is the file the profile is saved to.
+	path string
+
+	// pending is set while not all regions were preloaded, and attempts
+	// counts the preload attempts.
+	pending  bool
+	attempts int
+
+	// windows counts the windows learned since the profile was last saved.
+	windows int
+}
+
+const (
+	// maxPreloadAttempts is the number of sampling cycles the monitor tries
+	// to preload regions whose mappings don't exist yet.
+	maxPreloadAttempts = 10
+
+	// profileSaveWindows is the number of learned windows after which the
+	// profile is saved.
+	profileSaveWindows = 16
+)
+
+// loadImageProfile returns the profile of the image of the container whose
+// bundle is in bundleDir, from dir. The profile is empty the first time the
+// image runs. It returns nil if the image can't be identified.
+func loadImageProfile(dir, bundleDir string) *imageProfile {
+	spec, err := specutils.ReadSpec(bundleDir)
+	if err != nil {
+		log.Warningf("[Cijitter] reading spec, image profiles are disabled: %v", err)
+		return nil
+	}
+	key := imageKey(spec)
+	if key == "" {
+		log.Infof("[Cijitter] container image unknown, set the %s annotation to keep a profile", boot.JitterImageAnnotation)
+		return nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	p := &imageProfile{
+		Image: key,
+		path:  filepath.Join(dir, hex.EncodeToString(sum[:])+".json"),
+	}
+	data, err := ioutil.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return p
+	}
+	if err == nil {
+		err = json.Unmarshal(data, p)
+	}
+	if err != nil || p.Image != key {
+		log.Warningf("[Cijitter] ignoring profile %s of image %q: %v", p.path, key, err)
+		p.Image, p.Regions = key, nil
+		return p
+	}
+	p.pending = len(p.Regions) != 0
+	log.Infof("[Cijitter] loaded profile of image %q with %d hot regions", key, len(p.Regions))
+	return p
+}
+
+// learned returns whether p has regions from past runs.
+func (p *imageProfile) learned() bool {
+	return p != nil && len(p.Regions) != 0
+}
+
+// preload has the sandbox of cid delay the regions of p from the first
+// window on. Regions whose mappings don't exist yet are retried on the next
+// calls, for a bounded number of attempts.
+func (p *imageProfile) preload(cid string) {
+	if p == nil || !p.pending {
+		return
+	}
+	p.attempts++
+	if p.attempts > maxPreloadAttempts {
+		log.Infof("[Cijitter] giving up preloading the profile of %q", cid)
+		p.pending = false
+		return
+	}
+	regions := make([]maid.Symbol, 0, len(p.Regions))
+	for _, r := range p.Regions {
+		regions = append(regions, maid.Symbol{Mapped: true, Path: r.Path, Offset: r.Offset})
+	}
+	conn, err := connectControl(cid)
+	if err != nil {
+		log.Debugf("[Cijitter] connecting to %q to preload its profile: %v", cid, err)
+		return
+	}
+	var n int
+	err = conn.Call(boot.JitterPreload, &regions, &n)
+	conn.Close()
+	if err != nil {
+		log.Warningf("[Cijitter] preloading the profile of %q: %v", cid, err)
+		p.pending = false
+		return
+	}
+	log.Debugf("[Cijitter] preloaded %d of %d regions of %q", n, len(regions), cid)
+	p.pending = n < len(regions)
+}
+
+// learn adds the targets of a delayed window to p. syms are the symbols of
+// the targets.
+func (p *imageProfile) learn(targets []maid.Target, syms []maid.Symbol) {
+	if p == nil || syms == nil {
+		return
+	}
+	byAddr := make(map[uint64]maid.Symbol, len(syms))
+	for _, sym := range syms {
+		byAddr[uint64(sym.Addr)] = sym
+	}
+	for _, t := range targets {
+		sym, ok := byAddr[uint64(t.Addr)]
+		if !ok || !sym.Mapped || sym.Path == "" {
+			continue
+		}
+		found := false
+		for i := range p.Regions {
+			if r := &p.Regions[i]; r.Path == sym.Path && r.Offset == sym.Offset {
+				r.Accesses += t.Accesses
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.Regions = append(p.Regions, profileRegion{Path: sym.Path, Offset: sym.Offset, Accesses: t.Accesses})
+		}
+	}
+
+	p.windows++
+	if p.windows >= profileSaveWindows {
+		p.save()
+	}
+}
+
+// save writes p to its file, keeping the hottest regions.
+func (p *imageProfile) save() {
+	if p == nil {
+		return
+	}
+	p.windows = 0
+	sort.SliceStable(p.Regions, func(i, j int) bool {
+		return p.Regions[i].Accesses > p.Regions[j].Accesses
+	})
+	if len(p.Regions) > maid.MaxSecretPages {
+		p.Regions = p.Regions[:maid.MaxSecretPages]
+	}
+	if err := p.write(); err != nil {
+		log.Warningf("[Cijitter] saving profile of image %q: %v", p.Image, err)
+	}
+}
+
+// write atomically replaces the profile file with p.
+func (p *imageProfile) write() error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("renaming %s: %v", tmp, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cgroup"
+	"gvisor.dev/gvisor/runsc/container"
+)
+
+// quotaInterval is how often the monitor credits the CPU quota of the sandbox
+// with the time it was delayed.
+const quotaInterval = 10 * time.Second
+
+// quotaCompensator credits the CFS quota of the cgroup of a sandbox with the
+// time the sandbox was delayed, so that workloads tracked against an SLO
+// don't lose the throughput jitter costs them.
+type quotaCompensator struct {
+	rootDir string
+	cid     string
+
+	// cg is the cgroup of the sandbox. It is nil until the sandbox is
+	// loaded.
+	cg *cgroup.Cgroup
+
+	// base and period are the quota and period of cg, in microseconds,
+	// before any credit.
+	base   int64
+	period int64
+
+	// delayed is the delay time of the sandbox at the last credit, and
+	// last when it was read.
+	delayed time.Duration
+	last    time.Time
+}
+
+// newQuotaCompensator returns the compensator of container cid, or nil if
+// --jitter-cpu-compensation isn't set. The sandbox has a single cgroup, so
+// only the monitor of the root container credits it.
+func newQuotaCompensator(conf *boot.Config, cid string) *quotaCompensator {
+	if !conf.JitterCPUCompensation {
+		return nil
+	}
+	return &quotaCompensator{rootDir: conf.RootDir, cid: cid}
+}
+
+// load reads the base quota of the cgroup of the sandbox. It returns false if
+// there is nothing to credit.
+func (q *quotaCompensator) load() (bool, error) {
+	c, err := container.Load(q.rootDir, q.cid)
+	if err != nil {
+		return false, fmt.Errorf("loading container: %v", err)
+	}
+	if !c.Sandbox.IsRootContainer(q.cid) || c.Sandbox.Cgroup == nil {
+		return false, nil
+	}
+	base, period, err := c.Sandbox.Cgroup.CPUBandwidth()
+	if err != nil {
+		return false, fmt.Errorf("reading CPU quota: %v", err)
+	}
+	if base <= 0 || period <= 0 {
+		// No quota, the sandbox isn't throttled.
+		return false, nil
+	}
+	q.cg, q.base, q.period = c.Sandbox.Cgroup, base, period
+	return true, nil
+}
+
+// run credits the quota every quotaInterval until s ends, and restores the
+// base quota then. q may be nil, in which case it does nothing.
+func (q *quotaCompensator) run(s *jitterSession) {
+	if q == nil {
+		return
+	}
+	ticker := time.NewTicker(quotaInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			q.restore()
+			return
+		}
+		if q.cg == nil {
+			// The container may not be saved yet when the monitor
+			// starts.
+			ok, err := q.load()
+			if err != nil {
+				log.Debugf("[Cijitter] CPU quota compensation of %q: %v", q.cid, err)
+				continue
+			}
+			if !ok {
+				return
+			}
+			log.Infof("[Cijitter] crediting the CPU quota of %q, %dus per %dus, with its delays", q.cid, q.base, q.period)
+		}
+		if err := q.credit(); err != nil {
+			log.Debugf("[Cijitter] crediting the CPU quota of %q failed: %v", q.cid, err)
+		}
+	}
+}
+
+// credit sets the quota to the base quota plus the delay time per period
+// since the last credit.
+func (q *quotaCompensator) credit() error {
+	conn, err := connectControl(q.cid)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var stats maid.Stats
+	if err := conn.Call(boot.JitterStats, nil, &stats); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	delayed := time.Duration(stats.DelayNanos)
+	if q.last.IsZero() {
+		// Nothing to measure delays against yet.
+		q.delayed, q.last = delayed, now
+		return nil
+	}
+	base := time.Duration(q.base) * time.Microsecond
+	period := time.Duration(q.period) * time.Microsecond
+	quota := maid.CompensatedQuota(base, period, delayed-q.delayed, now.Sub(q.last))
+	q.delayed, q.last = delayed, now
+	return q.cg.SetCPUQuota(int64(quota / time.Microsecond))
+}
+
+// restore sets the quota back to the base quota, if it was credited.
+func (q *quotaCompensator) restore() {
+	if q.cg == nil {
+		return
+	}
+	if err := q.cg.SetCPUQuota(q.base); err != nil {
+		log.Warningf("[Cijitter] restoring the CPU quota of %q failed: %v", q.cid, err)
+	}
+}
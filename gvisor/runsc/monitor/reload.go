@@ -0,0 +1,157 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// ReadConfig returns a copy of conf with the jitter parameters set in
+// the --jitter-config file at path. The file lists flags of
+// boot.Config.JitterTunables, one "name=value" per line; blank lines and lines
+// starting with '#' are ignored. Parameters the file doesn't set keep their
+// value in conf.
+func ReadConfig(path string, conf *boot.Config) (*boot.Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading jitter config: %v", err)
+	}
+
+	c := *conf
+	fs := flag.NewFlagSet("jitter-config", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	primitive := fs.String("jitter-delay-primitive", c.JitterDelayPrimitive.String(), "")
+	scope := fs.String("jitter-delay-scope", c.JitterDelayScope.String(), "")
+	wait := fs.String("jitter-delay-wait", c.JitterDelayWait.String(), "")
+	fs.DurationVar(&c.JitterSyscallDelay, "jitter-syscall-delay", c.JitterSyscallDelay, "")
+	fs.DurationVar(&c.JitterPreemptInterval, "jitter-preempt-interval", c.JitterPreemptInterval, "")
+	fs.DurationVar(&c.JitterDelayBudget, "jitter-delay-budget", c.JitterDelayBudget, "")
+	fs.IntVar(&c.JitterWidenRadius, "jitter-widen-radius", c.JitterWidenRadius, "")
+	fs.IntVar(&c.JitterThresholds.Min, "jitter-min-accesses", c.JitterThresholds.Min, "")
+	fs.IntVar(&c.JitterThresholds.Spike, "jitter-spike-accesses", c.JitterThresholds.Spike, "")
+	fs.IntVar(&c.JitterHysteresis.Off, "jitter-off-accesses", c.JitterHysteresis.Off, "")
+	fs.IntVar(&c.JitterHysteresis.MinOn, "jitter-min-on-decisions", c.JitterHysteresis.MinOn, "")
+	fs.IntVar(&c.JitterHysteresis.MinOff, "jitter-min-off-decisions", c.JitterHysteresis.MinOff, "")
+	backoff := fs.String("jitter-backoff", c.JitterBackoff.Kind.String(), "")
+	fs.IntVar(&c.JitterBackoff.Factor, "jitter-backoff-factor", c.JitterBackoff.Factor, "")
+	fs.DurationVar(&c.JitterBackoff.Step, "jitter-backoff-step", c.JitterBackoff.Step, "")
+	fs.DurationVar(&c.JitterBackoff.Max, "jitter-backoff-max", c.JitterBackoff.Max, "")
+	backoffReset := fs.String("jitter-backoff-reset", c.JitterBackoff.Reset.String(), "")
+	compensation := fs.String("jitter-compensation", c.JitterCompensation.Kind.String(), "")
+	fs.Float64Var(&c.JitterCompensation.Factor, "jitter-compensation-factor", c.JitterCompensation.Factor, "")
+	symbolRules := fs.String("jitter-symbol-rules", c.JitterSymbolRules.String(), "")
+	calendar := fs.String("jitter-calendar", c.JitterCalendar.String(), "")
+
+	var args []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args = append(args, "--"+strings.TrimLeft(line, "-"))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("jitter config %q: %v", path, err)
+	}
+
+	if c.JitterDelayPrimitive, err = boot.MakeJitterDelayPrimitive(*primitive); err != nil {
+		return nil, err
+	}
+	if c.JitterDelayScope, err = boot.MakeJitterDelayScope(*scope); err != nil {
+		return nil, err
+	}
+	if c.JitterDelayWait, err = boot.MakeJitterDelayWait(*wait); err != nil {
+		return nil, err
+	}
+	if c.JitterBackoff.Kind, err = boot.MakeJitterBackoffKind(*backoff); err != nil {
+		return nil, err
+	}
+	if c.JitterBackoff.Reset, err = maid.ParseBackoffReset(*backoffReset); err != nil {
+		return nil, err
+	}
+	if c.JitterCompensation.Kind, err = boot.MakeJitterCompensationKind(*compensation); err != nil {
+		return nil, err
+	}
+	if c.JitterSymbolRules, err = maid.ParseSymbolRules(*symbolRules); err != nil {
+		return nil, err
+	}
+	if c.JitterCalendar, err = maid.ParseCalendar(*calendar); err != nil {
+		return nil, err
+	}
+	t := c.JitterTunables()
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("jitter config %q: %v", path, err)
+	}
+	return &c, nil
+}
+
+// jitterReloads returns a channel receiving the jitter parameters read from
+// the --jitter-config file on every SIGHUP. Invalid files are logged and
+// skipped. It returns nil without --jitter-config.
+func jitterReloads(conf *boot.Config) <-chan maid.Tunables {
+	hup := jitterHangups(conf)
+	if hup == nil {
+		return nil
+	}
+	reloads := make(chan maid.Tunables)
+	go func() {
+		for range hup {
+			c, err := ReadConfig(conf.JitterConfig, conf)
+			if err != nil {
+				log.Warningf("[Cijitter] not reloading: %v", err)
+				continue
+			}
+			conf = c
+			log.Infof("[Cijitter] reloading jitter parameters from %q", conf.JitterConfig)
+			reloads <- conf.JitterTunables()
+		}
+	}()
+	return reloads
+}
+
+// jitterHangups returns a channel receiving the SIGHUPs asking to read the
+// --jitter-config file again. It returns nil without --jitter-config.
+func jitterHangups(conf *boot.Config) <-chan os.Signal {
+	if conf.JitterConfig == "" {
+		return nil
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	return hup
+}
+
+// reload applies t to the policy of s and to its sandbox.
+func (s *jitterSession) reload(t maid.Tunables) {
+	t.Apply(s.policy)
+	conn, err := connectControl(s.cid)
+	if err != nil {
+		log.Warningf("[Cijitter] reloading sandbox %q: connecting to control server: %v", s.cid, err)
+		return
+	}
+	defer conn.Close()
+	if err := conn.Call(boot.JitterReload, &t, nil); err != nil {
+		log.Warningf("[Cijitter] reloading sandbox %q: %v", s.cid, err)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+// logRetention bounds the files the monitor keeps around.
+type logRetention struct {
+	// maxSize is the size from which a file is rotated. 0 disables
+	// size-based rotation.
+	maxSize int64
+
+	// maxAge is the age from which a file is rotated. 0 disables
+	// time-based rotation.
+	maxAge time.Duration
+
+	// keep is the number of rotated files kept.
+	keep int
+}
+
+// jitterLogRetention returns the retention selected in conf.
+func jitterLogRetention(conf *boot.Config) logRetention {
+	return logRetention{
+		maxSize: conf.JitterLogMaxSize,
+		maxAge:  conf.JitterLogMaxAge,
+		keep:    conf.JitterLogKeep,
+	}
+}
+
+// bounded returns whether r rotates files at all.
+func (r logRetention) bounded() bool {
+	return r.maxSize > 0 || r.maxAge > 0
+}
+
+// rotateFiles renames path to path.1, path.1 to path.2 and so on, dropping
+// path.<keep>. With keep 0, path is removed.
+func rotateFiles(path string, keep int) error {
+	if keep == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	for i := keep; i >= 1; i-- {
+		src := path
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", path, i-1)
+		}
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotatingFile is a file that is rotated once it grows over the size bound
+// of its retention or gets older than the age bound.
+type rotatingFile struct {
+	path string
+	ret  logRetention
+
+	mu sync.Mutex
+
+	// f is the current file.
+	f *os.File
+
+	// size is the size of f.
+	size int64
+
+	// opened is the time f was created.
+	opened time.Time
+}
+
+// openRotatingFile opens path for appending with the given retention.
+func openRotatingFile(path string, ret logRetention) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, ret: ret}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens r.path.
+//
+// Preconditions: r.mu must be locked, or r not shared yet.
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = fi.Size()
+	r.opened = fi.ModTime()
+	if r.size == 0 {
+		r.opened = time.Now()
+	}
+	return nil
+}
+
+// Write implements io.Writer.Write. The file is rotated before writes that
+// would take it over its bounds, so a single write is never split.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.due(int64(len(p))) {
+		r.f.Close()
+		if err := rotateFiles(r.path, r.ret.keep); err != nil {
+			return 0, fmt.Errorf("rotating %q: %v", r.path, err)
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// due returns whether the file must be rotated before writing n bytes to it.
+//
+// Preconditions: r.mu must be locked.
+func (r *rotatingFile) due(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.ret.maxSize > 0 && r.size+n > r.ret.maxSize {
+		return true
+	}
+	return r.ret.maxAge > 0 && time.Since(r.opened) >= r.ret.maxAge
+}
+
+// Close closes the current file.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// archiveSampleLog appends logPath, the output file of the daptrace module,
+// to archive and removes it, so that the next sample starts afresh.
+func archiveSampleLog(logPath string, archive io.Writer) error {
+	f, err := os.Open(logPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(logPath)
+}
@@ -0,0 +1,814 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+// sampleDuration is how long the target processes are sampled for each
+// window.
+const sampleDuration = 100 * time.Millisecond
+
+// sampler samples the memory accesses of the target processes.
+type sampler interface {
+	// sample samples pids for d. It returns the sampled addresses, hottest
+	// first, and how many accesses each of them got.
+	sample(pids []string, d time.Duration) ([]string, map[string]int, error)
+}
+
+// lineSampler is a sampler that tells apart the cache lines of the pages it
+// samples.
+type lineSampler interface {
+	// lines returns the cache lines sampled on each page by the last
+	// sample, as maid.Target.Lines.
+	lines() map[usermem.Addr]uint64
+}
+
+// newSampler returns the sampler selected in conf, working in dir. Its
+// samples are recorded to trace if it is not nil.
+func newSampler(conf *boot.Config, dir string, trace *maid.TraceWriter) (sampler, error) {
+	if conf.JitterReplay != "" {
+		f, err := os.Open(conf.JitterReplay)
+		if err != nil {
+			return nil, fmt.Errorf("opening replay trace: %v", err)
+		}
+		return &replaySampler{trace: maid.NewTraceReader(f)}, nil
+	}
+	s, err := newLiveSampler(conf, dir)
+	if err != nil || trace == nil {
+		return s, err
+	}
+	return &recordingSampler{sampler: s, trace: trace}, nil
+}
+
+// newLiveSampler returns the sampler of the sandbox selected in conf, working
+// in dir.
+func newLiveSampler(conf *boot.Config, dir string) (sampler, error) {
+	switch conf.JitterSampler {
+	case boot.JitterSamplerAuto:
+		if conf.Rootless {
+			return newPerfSampler(conf)
+		}
+		if v := detectVirt(); v.vm() {
+			return newVirtSampler(conf, dir, v)
+		}
+		return newDaptraceSampler(conf, dir)
+	case boot.JitterSamplerDaptrace:
+		return newDaptraceSampler(conf, dir)
+	case boot.JitterSamplerDaptraceRing:
+		return newDaptraceRingSampler(conf, dir)
+	case boot.JitterSamplerDaptraceEvents:
+		return newDaptraceEventSampler(conf, dir)
+	case boot.JitterSamplerPerf:
+		return newPerfSampler(conf)
+	case boot.JitterSamplerSentry:
+		return nil, fmt.Errorf("the %v sampler runs in the sandbox, not in the monitor", conf.JitterSampler)
+	default:
+		return nil, fmt.Errorf("unknown jitter sampler %v", conf.JitterSampler)
+	}
+}
+
+// monitorWorkDir returns the subdirectory name of the working directory
+// selected in conf, creating it if needed. Only its owner can access it, the
+// samples it holds are addresses of the workload.
+func monitorWorkDir(conf *boot.Config, name string) (string, error) {
+	dir := filepath.Join(conf.JitterWorkDir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("creating working directory: %v", err)
+	}
+	return dir, nil
+}
+
+// daptraceSampler samples with the daptrace kernel module. It loads and
+// unloads the module around each window, which requires root.
+type daptraceSampler struct {
+	// ctl loads and drives the module.
+	ctl daptraceControl
+
+	// logPath is the file the module writes its samples to.
+	logPath string
+
+	// archive keeps the output of past samples of the module, if the
+	// monitor logs are bounded. Otherwise only the last one is kept.
+	archive io.Writer
+}
+
+// newDaptraceSampler returns a daptraceSampler working in dir and archiving
+// past samples with the log retention selected in conf.
+func newDaptraceSampler(conf *boot.Config, dir string) (daptraceSampler, error) {
+	ctl, err := newDaptraceControl(conf)
+	if err != nil {
+		return daptraceSampler{}, err
+	}
+	s := daptraceSampler{
+		ctl:     ctl,
+		logPath: filepath.Join(dir, sampleLogName),
+	}
+	if ret := jitterLogRetention(conf); ret.bounded() {
+		archive, err := openRotatingFile(s.logPath+".old", ret)
+		if err != nil {
+			return daptraceSampler{}, fmt.Errorf("opening sample archive: %v", err)
+		}
+		s.archive = archive
+	}
+	if err := s.handshake(); err != nil {
+		return daptraceSampler{}, err
+	}
+	return s, nil
+}
+
+// handshake loads the module once to check that it writes samples in the
+// format read_sample_logs parses. Parsing another format would delay
+// garbage addresses.
+func (s daptraceSampler) handshake() error {
+	if !chk_prerequisites(s.ctl, s.logPath, s.archive) {
+		return fmt.Errorf("loading %s module failed", daptraceModuleName)
+	}
+	err := checkDaptraceABI(s.ctl)
+	if !exit_handler(s.ctl) && err == nil {
+		err = fmt.Errorf("unloading %s module failed", daptraceModuleName)
+	}
+	return err
+}
+
+// sample implements sampler.sample.
+func (s daptraceSampler) sample(pids []string, d time.Duration) ([]string, map[string]int, error) {
+	if !chk_prerequisites(s.ctl, s.logPath, s.archive) {
+		return nil, nil, fmt.Errorf("daptrace module is not available")
+	}
+	if err := checkDaptraceABI(s.ctl); err != nil {
+		exit_handler(s.ctl)
+		return nil, nil, err
+	}
+
+	// The kernel module samples all the pids written to it at once.
+	if err := s.trace(strings.Join(pids, " "), d); err != nil {
+		exit_handler(s.ctl)
+		return nil, nil, err
+	}
+
+	if !exit_handler(s.ctl) {
+		return nil, nil, fmt.Errorf("unloading daptrace module failed")
+	}
+
+	addrs, access := read_sample_logs(s.logPath)
+	return addrs, access, nil
+}
+
+// trace traces pids, space separated, for d.
+func (s daptraceSampler) trace(pids string, d time.Duration) error {
+	if err := s.ctl.write(daptracePids, pids); err != nil {
+		return fmt.Errorf("setting %s pids: %v", daptraceModuleName, err)
+	}
+	if err := s.ctl.write(daptraceTracingOn, "on"); err != nil {
+		return fmt.Errorf("starting %s tracer: %v", daptraceModuleName, err)
+	}
+	time.Sleep(d)
+	if err := s.ctl.write(daptraceTracingOn, "off"); err != nil {
+		return fmt.Errorf("stopping %s tracer: %v", daptraceModuleName, err)
+	}
+	return nil
+}
+
+const (
+	// daptraceRecordSize is the size of struct daptrace_record.
+	daptraceRecordSize = 24
+
+	// daptraceRetraceTimeout bounds how long changing the traced processes
+	// waits for the tracer of the previous ones to stop.
+	daptraceRetraceTimeout = time.Second
+)
+
+// daptraceRingSampler streams the samples of the daptrace kernel module from
+// its ring buffer. Unlike daptraceSampler, the module stays loaded and keeps
+// tracing the target processes between samples: it is only restarted when
+// they change. It requires root.
+type daptraceRingSampler struct {
+	// ctl loads and drives the module.
+	ctl daptraceControl
+
+	// ring is the read-only mapping of the header page followed by the
+	// records.
+	ring []byte
+
+	// nrRecords is the capacity of the ring.
+	nrRecords uint64
+
+	// pids are the processes traced by the module, space separated.
+	pids string
+}
+
+// newDaptraceRingSampler loads the module selected in conf and maps its ring
+// buffer. dir receives the output file the module still writes.
+func newDaptraceRingSampler(conf *boot.Config, dir string) (*daptraceRingSampler, error) {
+	ctl, err := newDaptraceControl(conf)
+	if err != nil {
+		return nil, err
+	}
+	if !chk_prerequisites(ctl, filepath.Join(dir, sampleLogName), nil) {
+		return nil, fmt.Errorf("loading %s module failed", daptraceModuleName)
+	}
+	if err := checkDaptraceABI(ctl); err != nil {
+		return nil, err
+	}
+	ring, nrRecords, err := mapDaptraceRing(ctl)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("[Cijitter] streaming samples from the %s ring buffer, %d records", daptraceModuleName, nrRecords)
+	return &daptraceRingSampler{ctl: ctl, ring: ring, nrRecords: nrRecords}, nil
+}
+
+// sample implements sampler.sample. It sums the records the module writes
+// over d.
+func (s *daptraceRingSampler) sample(pids []string, d time.Duration) ([]string, map[string]int, error) {
+	if want := strings.Join(pids, " "); want != s.pids {
+		if err := s.retrace(want); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	start := s.head()
+	time.Sleep(d)
+	head := s.head()
+	if head-start > s.nrRecords {
+		log.Debugf("[Cijitter] %s ring overrun, lost %d records", daptraceModuleName, head-start-s.nrRecords)
+		start = head - s.nrRecords
+	}
+	records := make([][3]uint64, 0, head-start)
+	data := s.ring[usermem.PageSize:]
+	for i := start; i < head; i++ {
+		off := (i % s.nrRecords) * daptraceRecordSize
+		rec := data[off : off+daptraceRecordSize]
+		records = append(records, [3]uint64{
+			usermem.ByteOrder.Uint64(rec[0:8]),
+			usermem.ByteOrder.Uint64(rec[8:16]),
+			usermem.ByteOrder.Uint64(rec[16:24]),
+		})
+	}
+	// The module kept writing while the records were copied, the oldest
+	// ones may have been overwritten meanwhile.
+	if now := s.head(); now-start > s.nrRecords {
+		lost := now - start - s.nrRecords
+		if lost > uint64(len(records)) {
+			lost = uint64(len(records))
+		}
+		records = records[lost:]
+	}
+
+	counts := make(map[usermem.Addr]int)
+	for _, rec := range records {
+		counts[usermem.Addr(rec[1]).RoundDown()] += int(rec[2])
+	}
+	addrs, access := rankPages(counts)
+	return addrs, access, nil
+}
+
+// retrace makes the module trace pids, space separated, instead of the
+// processes it traces.
+func (s *daptraceRingSampler) retrace(pids string) error {
+	if err := retraceDaptrace(s.ctl, pids); err != nil {
+		return err
+	}
+	s.pids = pids
+	return nil
+}
+
+// retraceDaptrace makes the module driven by ctl trace pids, space separated,
+// instead of the processes it traces.
+func retraceDaptrace(ctl daptraceControl, pids string) error {
+	if err := ctl.write(daptraceTracingOn, "off"); err != nil {
+		return fmt.Errorf("stopping %s tracer: %v", daptraceModuleName, err)
+	}
+	// The module refuses new pids until its tracer has stopped.
+	deadline := time.Now().Add(daptraceRetraceTimeout)
+	for {
+		err := ctl.write(daptracePids, pids)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, unix.EBUSY) || time.Now().After(deadline) {
+			return fmt.Errorf("setting %s pids: %v", daptraceModuleName, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := ctl.write(daptraceTracingOn, "on"); err != nil {
+		return fmt.Errorf("starting %s tracer: %v", daptraceModuleName, err)
+	}
+	return nil
+}
+
+// daptraceEventSampler receives the samples of the daptrace kernel module as
+// netlink events, which the module sends as it aggregates them. Like with
+// daptraceRingSampler, the module keeps tracing the target processes between
+// samples. It requires root.
+type daptraceEventSampler struct {
+	// ctl loads and drives the module.
+	ctl daptraceControl
+
+	// events is the netlink socket the module sends its samples to.
+	events *os.File
+
+	// uring reads events if set, rather than a read per event.
+	uring *uringReader
+
+	// pids are the processes traced by the module, space separated.
+	pids string
+}
+
+// newDaptraceEventSampler loads the module selected in conf and subscribes to
+// its samples. dir receives the output file the module still writes.
+func newDaptraceEventSampler(conf *boot.Config, dir string) (*daptraceEventSampler, error) {
+	ctl, err := newDaptraceControl(conf)
+	if err != nil {
+		return nil, err
+	}
+	if !chk_prerequisites(ctl, filepath.Join(dir, sampleLogName), nil) {
+		return nil, fmt.Errorf("loading %s module failed", daptraceModuleName)
+	}
+	if err := checkDaptraceABI(ctl); err != nil {
+		return nil, err
+	}
+	events, err := ctl.open(daptraceEvents)
+	if err != nil {
+		return nil, err
+	}
+	s := &daptraceEventSampler{ctl: ctl, events: events}
+	if conf.JitterIOUring {
+		// Kernels before 5.1, or seccomp, may lack io_uring: reading
+		// event by event still works.
+		if s.uring, err = newUringReader(int(events.Fd()), daptraceNetlinkBuffer); err != nil {
+			log.Warningf("[Cijitter] reading %s events with io_uring failed, reading them one by one: %v", daptraceModuleName, err)
+		}
+	}
+	log.Infof("[Cijitter] receiving samples from %s as netlink events, io_uring: %t", daptraceModuleName, s.uring != nil)
+	return s, nil
+}
+
+// sample implements sampler.sample. It sums the records of the events the
+// module sends over d.
+func (s *daptraceEventSampler) sample(pids []string, d time.Duration) ([]string, map[string]int, error) {
+	if want := strings.Join(pids, " "); want != s.pids {
+		if err := retraceDaptrace(s.ctl, want); err != nil {
+			return nil, nil, err
+		}
+		s.pids = want
+	}
+
+	// Events queued since the last sample are stale.
+	if err := s.receive(0, func(maid.GenlMessage) {}); err != nil {
+		return nil, nil, err
+	}
+
+	counts := make(map[usermem.Addr]int)
+	add := func(m maid.GenlMessage) {
+		records, err := m.DaptraceRecords()
+		if err != nil {
+			log.Debugf("[Cijitter] invalid %s event: %v", daptraceModuleName, err)
+			return
+		}
+		for _, r := range records {
+			counts[r.Addr.RoundDown()] += int(r.Accesses)
+		}
+	}
+	for deadline := time.Now().Add(d); time.Now().Before(deadline); {
+		if err := s.receive(time.Until(deadline), add); err != nil {
+			return nil, nil, err
+		}
+	}
+	addrs, access := rankPages(counts)
+	return addrs, access, nil
+}
+
+// receive calls fn with the sample events received within timeout, or
+// already queued if timeout is 0.
+func (s *daptraceEventSampler) receive(timeout time.Duration, fn func(maid.GenlMessage)) error {
+	handle := func(data []byte, err error) {
+		var msgs []maid.GenlMessage
+		if err == nil {
+			msgs, err = maid.ParseGenlMessages(data)
+		}
+		if err == unix.ENOBUFS {
+			log.Debugf("[Cijitter] %s events overrun, samples were lost", daptraceModuleName)
+			return
+		}
+		if err != nil {
+			log.Debugf("[Cijitter] receiving %s event failed: %v", daptraceModuleName, err)
+			return
+		}
+		for _, m := range msgs {
+			if !m.IsAck() && m.Cmd == maid.DaptraceCmdSamples {
+				fn(m)
+			}
+		}
+	}
+	if s.uring != nil {
+		return s.uring.read(timeout, handle)
+	}
+
+	fd := int(s.events.Fd())
+	buf := make([]byte, daptraceNetlinkBuffer)
+	// Like with io_uring, receive at most uringDepth events at once.
+	for i := 0; i < uringDepth; i++ {
+		n, _, err := unix.Recvfrom(fd, buf, unix.MSG_DONTWAIT)
+		switch {
+		case err == unix.EAGAIN && timeout > 0:
+			fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+			if _, err := unix.Poll(fds, int(timeout/time.Millisecond)+1); err != nil && err != unix.EINTR {
+				return fmt.Errorf("waiting for %s events: %v", daptraceModuleName, err)
+			}
+			// Only wait once, the caller tracks the deadline.
+			timeout = 0
+		case err == unix.EAGAIN:
+			return nil
+		case err == unix.ENOBUFS:
+			handle(nil, err)
+		case err != nil:
+			return fmt.Errorf("receiving %s events: %v", daptraceModuleName, err)
+		default:
+			handle(buf[:n], nil)
+		}
+	}
+	return nil
+}
+
+const (
+	// perfParanoidPath holds the restrictions on perf events for
+	// unprivileged users.
+	perfParanoidPath = "/proc/sys/kernel/perf_event_paranoid"
+
+	// perfRingPages is the number of data pages of each perf ring buffer.
+	// It must be a power of 2.
+	perfRingPages = 16
+)
+
+// perfSampler samples the page faults of every thread of the target
+// processes with perf events. It doesn't need root, only for the monitor to
+// be allowed to trace the sandbox, i.e. to run as the same user.
+//
+// Page faults only approximate the access pattern: a page is seen again only
+// once it is faulted in again, e.g. after a delay window unmapped it. On AMD
+// hosts, the sampler can sample the data addresses of memory operations with
+// IBS instead, which sees every access.
+type perfSampler struct {
+	// paranoid is the value of kernel.perf_event_paranoid.
+	paranoid int
+
+	// threadScope is set if the IDs to sample are threads rather than
+	// processes.
+	threadScope bool
+
+	// ibsType is the PMU type of AMD IBS op if the sampler samples with
+	// IBS, 0 if it samples page faults.
+	ibsType uint32
+
+	// fallback is set if the sampler falls back to page faults once IBS
+	// events can't be opened.
+	fallback bool
+
+	// sampledLines are the cache lines sampled on each page by the last
+	// sample, as maid.Target.Lines.
+	sampledLines map[usermem.Addr]uint64
+}
+
+// newPerfSampler returns a perfSampler for the sample scope and PMU selected
+// in conf if perf events are available to the monitor.
+func newPerfSampler(conf *boot.Config) (*perfSampler, error) {
+	paranoid, err := perfParanoid()
+	if err != nil {
+		return nil, err
+	}
+	s := &perfSampler{paranoid: paranoid, threadScope: conf.JitterSampleScope == boot.JitterSampleThread}
+	if conf.JitterPerfPMU != boot.JitterPerfFaults {
+		typ, err := ibsOpType()
+		switch {
+		case err == nil:
+			s.ibsType, s.fallback = typ, conf.JitterPerfPMU == boot.JitterPerfAuto
+		case conf.JitterPerfPMU == boot.JitterPerfIBS:
+			return nil, err
+		}
+	}
+	if s.ibsType != 0 {
+		log.Infof("[Cijitter] sampling memory operations with AMD IBS, perf_event_paranoid=%d", paranoid)
+	} else {
+		log.Infof("[Cijitter] sampling page faults with perf events, perf_event_paranoid=%d", paranoid)
+	}
+	return s, nil
+}
+
+// perfParanoid returns the value of kernel.perf_event_paranoid, or an error
+// if perf events are not available to the monitor.
+func perfParanoid() (int, error) {
+	data, err := ioutil.ReadFile(perfParanoidPath)
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %v", perfParanoidPath, err)
+	}
+	paranoid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %v", perfParanoidPath, err)
+	}
+	// Some distributions add a level above 2 which disables perf events
+	// for unprivileged users altogether.
+	if paranoid > 2 && os.Geteuid() != 0 {
+		return 0, fmt.Errorf("perf events are disabled for unprivileged users (perf_event_paranoid=%d)", paranoid)
+	}
+	return paranoid, nil
+}
+
+// sample implements sampler.sample.
+func (s *perfSampler) sample(pids []string, d time.Duration) ([]string, map[string]int, error) {
+	var events []*perfEvent
+	defer func() {
+		for _, e := range events {
+			e.close()
+		}
+	}()
+
+	// Events are opened per thread: CPU-wide events are not available
+	// above perf_event_paranoid=0.
+	var tids []int
+	for _, pid := range pids {
+		t, err := threadsToSample(pid, s.threadScope)
+		if err != nil {
+			log.Debugf("[Cijitter] listing threads of %s failed: %v", pid, err)
+			continue
+		}
+		tids = append(tids, t...)
+	}
+	if s.ibsType != 0 {
+		var err error
+		if events, err = openIBSEvents(s.ibsType, tids); err != nil {
+			if !s.fallback {
+				return nil, nil, err
+			}
+			log.Warningf("[Cijitter] %v, falling back to sampling page faults", err)
+			s.ibsType = 0
+		}
+	}
+	if s.ibsType == 0 {
+		for _, tid := range tids {
+			e, err := openPerfEvent(tid, s.paranoid)
+			if err != nil {
+				// The thread may have exited meanwhile.
+				log.Debugf("[Cijitter] opening perf event on thread %d failed: %v", tid, err)
+				continue
+			}
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		return nil, nil, fmt.Errorf("no perf event could be opened on %v", pids)
+	}
+
+	for _, e := range events {
+		if err := unix.IoctlSetInt(e.fd, unix.PERF_EVENT_IOC_ENABLE, 0); err != nil {
+			return nil, nil, fmt.Errorf("enabling perf event: %v", err)
+		}
+	}
+	time.Sleep(d)
+	for _, e := range events {
+		unix.IoctlSetInt(e.fd, unix.PERF_EVENT_IOC_DISABLE, 0)
+	}
+
+	// CPU-wide events sample other threads too.
+	sampled := make(map[int]bool, len(tids))
+	for _, tid := range tids {
+		sampled[tid] = true
+	}
+	counts := make(map[usermem.Addr]int)
+	s.sampledLines = make(map[usermem.Addr]uint64)
+	for _, e := range events {
+		e.drain(func(tid int, addr uint64) {
+			if addr == 0 || (e.withTID && !sampled[tid]) {
+				// IBS samples operations without a data
+				// address too.
+				return
+			}
+			page := usermem.Addr(addr).RoundDown()
+			counts[page]++
+			s.sampledLines[page] |= maid.LineOf(usermem.Addr(addr))
+		})
+	}
+	addrs, access := rankPages(counts)
+	return addrs, access, nil
+}
+
+// lines implements lineSampler.lines.
+func (s *perfSampler) lines() map[usermem.Addr]uint64 {
+	return s.sampledLines
+}
+
+// rankPages returns the pages of counts, most accessed first, and how many
+// accesses each of them got, in the form samplers return.
+func rankPages(counts map[usermem.Addr]int) ([]string, map[string]int) {
+	pages := make([]usermem.Addr, 0, len(counts))
+	for page := range counts {
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if counts[pages[i]] != counts[pages[j]] {
+			return counts[pages[i]] > counts[pages[j]]
+		}
+		return pages[i] < pages[j]
+	})
+
+	addrs := make([]string, 0, len(pages))
+	access := make(map[string]int, len(pages))
+	for _, page := range pages {
+		addr := fmt.Sprintf("0x%x", uint64(page))
+		addrs = append(addrs, addr)
+		access[addr] = counts[page]
+	}
+	return addrs, access
+}
+
+// threadsOf returns the thread IDs of pid.
+func threadsOf(pid string) ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc/" + pid + "/task")
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
+
+// threadsToSample returns the threads to sample for id, which is a thread ID
+// if threadScope is set and a process ID otherwise.
+func threadsToSample(id string, threadScope bool) ([]int, error) {
+	if !threadScope {
+		return threadsOf(id)
+	}
+	tid, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid thread ID %q", id)
+	}
+	return []int{tid}, nil
+}
+
+// perfEvent is a sampling event, on a single thread or a single CPU, and its
+// ring buffer.
+type perfEvent struct {
+	fd int
+
+	// ring is the mapping of the metadata page followed by the data pages.
+	ring []byte
+
+	// tail is the offset of the next record to read in the data pages.
+	tail uint64
+
+	// withTID is set if the samples carry the thread they were taken on,
+	// as those of CPU-wide events do.
+	withTID bool
+}
+
+// drain calls fn with the thread and the address of each sample in the ring
+// buffer and gives the space back to the kernel. The thread is 0 unless
+// e.withTID is set.
+func (e *perfEvent) drain(fn func(tid int, addr uint64)) {
+	data := e.ring[usermem.PageSize:]
+	head := e.dataHead()
+	// With PERF_SAMPLE_ADDR, the sample is just the address, preceded by
+	// the PID and TID with PERF_SAMPLE_TID.
+	addrOff := uint64(perfHeaderSize)
+	if e.withTID {
+		addrOff += 8
+	}
+	for e.tail+perfHeaderSize <= head {
+		hdr := readRing(data, e.tail, perfHeaderSize)
+		typ := usermem.ByteOrder.Uint32(hdr[0:4])
+		size := uint64(usermem.ByteOrder.Uint16(hdr[6:8]))
+		if size == 0 {
+			break
+		}
+		if typ == unix.PERF_RECORD_SAMPLE && size >= addrOff+8 {
+			tid := 0
+			if e.withTID {
+				tid = int(usermem.ByteOrder.Uint32(readRing(data, e.tail+perfHeaderSize+4, 4)))
+			}
+			fn(tid, usermem.ByteOrder.Uint64(readRing(data, e.tail+addrOff, 8)))
+		}
+		e.tail += size
+	}
+	e.setDataTail(e.tail)
+}
+
+// perfHeaderSize is the size of struct perf_event_header.
+const perfHeaderSize = 8
+
+// readRing copies n bytes at off from the ring buffer data, which may wrap
+// around.
+func readRing(data []byte, off uint64, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = data[(off+uint64(i))%uint64(len(data))]
+	}
+	return b
+}
+
+// close releases the event.
+func (e *perfEvent) close() {
+	if e.ring != nil {
+		unix.Munmap(e.ring)
+	}
+	unix.Close(e.fd)
+}
+
+// recordingSampler records the samples of another sampler in a trace.
+type recordingSampler struct {
+	sampler
+	trace *maid.TraceWriter
+}
+
+// lines implements lineSampler.lines.
+func (s *recordingSampler) lines() map[usermem.Addr]uint64 {
+	if ls, ok := s.sampler.(lineSampler); ok {
+		return ls.lines()
+	}
+	return nil
+}
+
+// sample implements sampler.sample.
+func (s *recordingSampler) sample(pids []string, d time.Duration) ([]string, map[string]int, error) {
+	addrs, access, err := s.sampler.sample(pids, d)
+	if err != nil {
+		return addrs, access, err
+	}
+	rec := maid.TraceRecord{Event: maid.TraceSample}
+	for _, a := range addrs {
+		addr, err := strconv.ParseUint(strings.TrimPrefix(a, "0x"), 16, 64)
+		if err != nil {
+			continue
+		}
+		rec.Targets = append(rec.Targets, maid.Target{Addr: usermem.Addr(addr), Accesses: access[a]})
+	}
+	if err := s.trace.Write(rec); err != nil {
+		log.Warningf("[Cijitter] recording sample failed: %v", err)
+	}
+	return addrs, access, nil
+}
+
+// replaySampler returns the samples of a recorded trace, in order, instead of
+// sampling. Once the trace is exhausted, it blocks forever.
+type replaySampler struct {
+	trace *maid.TraceReader
+}
+
+// sample implements sampler.sample. pids and d are ignored.
+func (s *replaySampler) sample(pids []string, d time.Duration) ([]string, map[string]int, error) {
+	for {
+		rec, err := s.trace.Next()
+		if err == io.EOF {
+			log.Infof("[Cijitter] replay finished")
+			select {}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading replay trace: %v", err)
+		}
+		if rec.Event != maid.TraceSample {
+			continue
+		}
+		addrs := make([]string, 0, len(rec.Targets))
+		access := make(map[string]int, len(rec.Targets))
+		for _, t := range rec.Targets {
+			addr := fmt.Sprintf("0x%x", uint64(t.Addr))
+			addrs = append(addrs, addr)
+			access[addr] = t.Accesses
+		}
+		return addrs, access, nil
+	}
+}
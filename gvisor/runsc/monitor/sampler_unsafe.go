@@ -0,0 +1,184 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Offsets of data_head and data_tail in struct perf_event_mmap_page.
+const (
+	perfDataHeadOffset = 1024
+	perfDataTailOffset = 1032
+)
+
+// openPerfEvent opens a disabled page fault sampling event on thread tid.
+func openPerfEvent(tid, paranoid int) (*perfEvent, error) {
+	attr := unix.PerfEventAttr{
+		Type:        unix.PERF_TYPE_SOFTWARE,
+		Config:      unix.PERF_COUNT_SW_PAGE_FAULTS,
+		Sample:      1,
+		Sample_type: unix.PERF_SAMPLE_ADDR,
+		Bits:        unix.PerfBitDisabled | unix.PerfBitExcludeHv,
+	}
+	fd, err := perfEventOpen(&attr, tid, -1 /* cpu */, paranoid)
+	if err != nil {
+		return nil, err
+	}
+	return mapPerfEvent(fd, false)
+}
+
+// openIBSEvent opens a disabled AMD IBS op sampling event of the PMU type
+// ibsType, on thread tid if cpu is -1, or on all threads running on cpu if
+// tid is -1. The samples of CPU-wide events carry the thread they were taken
+// on.
+//
+// IBS can't leave out kernel space, so the event is only allowed from
+// perf_event_paranoid=1 down, or with CAP_PERFMON.
+func openIBSEvent(ibsType uint32, tid, cpu int) (*perfEvent, error) {
+	attr := unix.PerfEventAttr{
+		Type:        ibsType,
+		Config:      ibsOpCntCtl,
+		Sample:      ibsOpPeriod,
+		Sample_type: unix.PERF_SAMPLE_ADDR,
+		Bits:        unix.PerfBitDisabled,
+	}
+	attr.Size = uint32(unsafe.Sizeof(attr))
+	cpuWide := tid == -1
+	if cpuWide {
+		attr.Sample_type |= unix.PERF_SAMPLE_TID
+	}
+	fd, err := unix.PerfEventOpen(&attr, tid, cpu, -1 /* groupFd */, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("perf_event_open: %v", err)
+	}
+	return mapPerfEvent(fd, cpuWide)
+}
+
+// openHITMEvent opens a disabled sampling event of the raw hardware event
+// config, which must count loads that hit a line modified by another core, on
+// thread tid. Its samples carry the data address of the load, which takes a
+// precise event.
+func openHITMEvent(tid, paranoid int, config uint64) (*perfEvent, error) {
+	attr := unix.PerfEventAttr{
+		Type:        unix.PERF_TYPE_RAW,
+		Config:      config,
+		Sample:      hitmPeriod,
+		Sample_type: unix.PERF_SAMPLE_ADDR,
+		Bits:        unix.PerfBitDisabled | unix.PerfBitExcludeHv | unix.PerfBitPreciseIPBit2,
+	}
+	fd, err := perfEventOpen(&attr, tid, -1 /* cpu */, paranoid)
+	if err != nil {
+		return nil, err
+	}
+	return mapPerfEvent(fd, false)
+}
+
+// mapPerfEvent maps the ring buffer of the sampling event fd. withTID is
+// whether its samples carry a thread ID.
+func mapPerfEvent(fd int, withTID bool) (*perfEvent, error) {
+	ring, err := unix.Mmap(fd, 0, (1+perfRingPages)*usermem.PageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("mapping perf ring buffer: %v", err)
+	}
+	return &perfEvent{fd: fd, ring: ring, withTID: withTID}, nil
+}
+
+// openPerfCounter opens a disabled counting event of the hardware event
+// config on thread tid.
+func openPerfCounter(tid, paranoid int, config uint64) (int, error) {
+	attr := unix.PerfEventAttr{
+		Type:   unix.PERF_TYPE_HARDWARE,
+		Config: config,
+		Bits:   unix.PerfBitDisabled | unix.PerfBitExcludeHv,
+	}
+	return perfEventOpen(&attr, tid, -1 /* cpu */, paranoid)
+}
+
+// perfEventOpen opens the event attr on thread tid and cpu, as
+// perf_event_open(2) takes them, restricted to what perf_event_paranoid
+// allows.
+func perfEventOpen(attr *unix.PerfEventAttr, tid, cpu, paranoid int) (int, error) {
+	attr.Size = uint32(unsafe.Sizeof(*attr))
+	// From perf_event_paranoid=2, unprivileged users may only measure
+	// user space.
+	if paranoid >= 2 {
+		attr.Bits |= unix.PerfBitExcludeKernel
+	}
+	fd, err := unix.PerfEventOpen(attr, tid, cpu, -1 /* groupFd */, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		return -1, fmt.Errorf("perf_event_open: %v", err)
+	}
+	return fd, nil
+}
+
+// dataHead returns the offset up to which the kernel wrote records.
+func (e *perfEvent) dataHead() uint64 {
+	return atomic.LoadUint64((*uint64)(unsafe.Pointer(&e.ring[perfDataHeadOffset])))
+}
+
+// setDataTail tells the kernel that records up to tail were consumed.
+func (e *perfEvent) setDataTail(tail uint64) {
+	atomic.StoreUint64((*uint64)(unsafe.Pointer(&e.ring[perfDataTailOffset])), tail)
+}
+
+// Offsets of the fields of struct daptrace_ring_header.
+const (
+	daptraceRingHeadOffset       = 0
+	daptraceRingNrRecordsOffset  = 8
+	daptraceRingRecordSizeOffset = 16
+	daptraceRingVersionOffset    = 20
+)
+
+// mapDaptraceRing maps the ring buffer of the daptrace module opened with ctl
+// read-only and returns the mapping along with the number of records it holds.
+func mapDaptraceRing(ctl daptraceControl) ([]byte, uint64, error) {
+	f, err := ctl.open(daptraceRing)
+	if err != nil {
+		return nil, 0, fmt.Errorf("opening %s ring buffer: %v", daptraceModuleName, err)
+	}
+	defer f.Close()
+	fd := int(f.Fd())
+
+	hdr, err := unix.Mmap(fd, 0, usermem.PageSize, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, 0, fmt.Errorf("mapping %s ring buffer header: %v", daptraceModuleName, err)
+	}
+	nrRecords := usermem.ByteOrder.Uint64(hdr[daptraceRingNrRecordsOffset:])
+	recordSize := usermem.ByteOrder.Uint32(hdr[daptraceRingRecordSizeOffset:])
+	version := usermem.ByteOrder.Uint32(hdr[daptraceRingVersionOffset:])
+	unix.Munmap(hdr)
+	if version != daptraceABIVersion || recordSize != daptraceRecordSize || nrRecords == 0 {
+		return nil, 0, fmt.Errorf("%s ring buffer has version %d and %d-byte records, runsc expects version %d and %d-byte records", daptraceModuleName, version, recordSize, daptraceABIVersion, daptraceRecordSize)
+	}
+
+	size := usermem.PageSize + int(usermem.Addr(nrRecords*daptraceRecordSize).MustRoundUp())
+	ring, err := unix.Mmap(fd, 0, size, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, 0, fmt.Errorf("mapping %s ring buffer: %v", daptraceModuleName, err)
+	}
+	return ring, nrRecords, nil
+}
+
+// head returns the number of records the module wrote so far.
+func (s *daptraceRingSampler) head() uint64 {
+	return atomic.LoadUint64((*uint64)(unsafe.Pointer(&s.ring[daptraceRingHeadOffset])))
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/maid"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// symbolizer resolves the targets of a container to the libraries and
+// functions that contain them.
+//
+// Host mappings of sandbox processes only show the sentry's memory file, so
+// the sandbox resolves targets to application mappings. Functions are then
+// looked up in the ELF symbols of the mapped file in the container's root
+// filesystem, when it has them.
+type symbolizer struct {
+	cid string
+
+	// rootfs is the host path of the container's root filesystem.
+	rootfs string
+
+	// elfs caches the symbol tables of the files looked up so far, nil for
+	// files without symbols.
+	elfs map[string]*elfSymbols
+}
+
+// newSymbolizer returns a symbolizer for container cid, whose bundle is in
+// bundleDir.
+func newSymbolizer(cid, bundleDir string) *symbolizer {
+	s := &symbolizer{
+		cid:  cid,
+		elfs: make(map[string]*elfSymbols),
+	}
+	if spec, err := specutils.ReadSpec(bundleDir); err != nil {
+		log.Warningf("[Cijitter] reading spec of %q, functions won't be symbolized: %v", cid, err)
+	} else if spec.Root != nil {
+		s.rootfs = spec.Root.Path
+	}
+	return s
+}
+
+// symbolize returns the symbols of targets, in the same order. It returns nil
+// if the sandbox can't be asked.
+func (s *symbolizer) symbolize(targets []maid.Target) []maid.Symbol {
+	if s == nil || len(targets) == 0 {
+		return nil
+	}
+	addrs := make([]usermem.Addr, 0, len(targets))
+	for _, t := range targets {
+		addrs = append(addrs, t.Addr)
+	}
+	conn, err := connectControl(s.cid)
+	if err != nil {
+		log.Debugf("[Cijitter] connecting to %q to symbolize targets: %v", s.cid, err)
+		return nil
+	}
+	var syms []maid.Symbol
+	err = conn.Call(boot.JitterSymbolize, &addrs, &syms)
+	conn.Close()
+	if err != nil {
+		log.Debugf("[Cijitter] symbolizing targets of %q: %v", s.cid, err)
+		return nil
+	}
+
+	for i := range syms {
+		if sym := &syms[i]; sym.Mapped && sym.Path != "" {
+			sym.Func, sym.FuncOffset = s.lookup(sym.Path, sym.Offset)
+		}
+	}
+	return syms
+}
+
+// lookup returns the function that contains offset off of the file at path in
+// the container, if the file has ELF symbols.
+func (s *symbolizer) lookup(path string, off uint64) (string, uint64) {
+	if s.rootfs == "" || !filepath.IsAbs(path) {
+		// Not a file, e.g. [stack].
+		return "", 0
+	}
+	syms, ok := s.elfs[path]
+	if !ok {
+		// Cleaning the absolute path keeps it in the root filesystem.
+		syms = readELFSymbols(filepath.Join(s.rootfs, filepath.Clean(path)))
+		s.elfs[path] = syms
+	}
+	return syms.lookup(off)
+}
+
+// elfSymbols are the function symbols of an ELF file.
+type elfSymbols struct {
+	// loads are the loadable segments, to translate file offsets to
+	// virtual addresses.
+	loads []elf.ProgHeader
+
+	// funcs are the function symbols, by increasing address.
+	funcs []elf.Symbol
+}
+
+// readELFSymbols returns the function symbols of the ELF file at path, or nil
+// if it has none.
+func readELFSymbols(path string) *elfSymbols {
+	f, err := elf.Open(path)
+	if err != nil {
+		log.Debugf("[Cijitter] reading symbols of %s: %v", path, err)
+		return nil
+	}
+	defer f.Close()
+
+	e := &elfSymbols{}
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			e.loads = append(e.loads, p.ProgHeader)
+		}
+	}
+	// Stripped libraries still have their exported functions.
+	all, _ := f.Symbols()
+	dyn, _ := f.DynamicSymbols()
+	for _, sym := range append(all, dyn...) {
+		if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Value != 0 && sym.Size != 0 {
+			e.funcs = append(e.funcs, sym)
+		}
+	}
+	if len(e.funcs) == 0 {
+		return nil
+	}
+	sort.Slice(e.funcs, func(i, j int) bool { return e.funcs[i].Value < e.funcs[j].Value })
+	return e
+}
+
+// lookup returns the function that contains file offset off and the offset
+// of off into it.
+func (e *elfSymbols) lookup(off uint64) (string, uint64) {
+	if e == nil {
+		return "", 0
+	}
+	var vaddr uint64
+	found := false
+	for _, p := range e.loads {
+		if p.Off <= off && off < p.Off+p.Filesz {
+			vaddr = p.Vaddr + off - p.Off
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", 0
+	}
+	i := sort.Search(len(e.funcs), func(i int) bool { return e.funcs[i].Value > vaddr }) - 1
+	if i < 0 || vaddr >= e.funcs[i].Value+e.funcs[i].Size {
+		return "", 0
+	}
+	return e.funcs[i].Name, vaddr - e.funcs[i].Value
+}
@@ -0,0 +1,424 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cgroup"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// targetSelector picks the host processes the monitor samples according to
+// the configured jitter target policy.
+type targetSelector struct {
+	cid     string
+	rootDir string
+	policy  boot.JitterTargetPolicy
+	scope   boot.JitterSampleScope
+
+	// rootless is whether the sandbox runs rootless, in which case the
+	// workload doesn't run as nobody.
+	rootless bool
+
+	// shared is set if the monitor samples other sandboxes too, in which
+	// case the busiest process of the host may belong to one of them.
+	shared bool
+
+	// re is the compiled pattern of JitterTargetExe.
+	re *regexp.Regexp
+
+	// specMatch is whether the container spec matches JitterTargetArgs or
+	// JitterTargetEnv. It is constant for the lifetime of the container.
+	specMatch bool
+
+	// execs are the PIDs of the processes exec'd in the container that
+	// match JitterTargetArgs or JitterTargetEnv, as of execsChecked.
+	execs        []kernel.ThreadID
+	execsChecked time.Time
+
+	// sandboxPid is the PID of the sandbox process, once known.
+	sandboxPid int
+
+	// cg is the cgroup of the sandbox, if any, once the sandbox is known.
+	cg *cgroup.Cgroup
+
+	// primary is the busiest PID selected last, and switched is set when
+	// it changed since switchedProcess was last called. mu protects them
+	// from the delayers, which run alongside sampling.
+	mu       sync.Mutex
+	primary  string
+	switched bool
+}
+
+// newTargetSelector returns a selector for the container cid, whose bundle is
+// in bundleDir.
+func newTargetSelector(cid, bundleDir string, conf *boot.Config) (*targetSelector, error) {
+	s := &targetSelector{
+		cid:     cid,
+		rootDir: conf.RootDir,
+		policy:  conf.JitterTargetPolicy,
+		scope:   conf.JitterSampleScope,
+
+		rootless: conf.Rootless,
+	}
+	switch s.policy.Kind {
+	case boot.JitterTargetExe:
+		re, err := regexp.Compile(s.policy.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		s.re = re
+	case boot.JitterTargetArgs, boot.JitterTargetEnv:
+		spec, err := specutils.ReadSpec(bundleDir)
+		if err != nil {
+			return nil, fmt.Errorf("reading spec: %v", err)
+		}
+		if spec.Process == nil {
+			break
+		}
+		s.specMatch = s.policy.MatchesProcess(spec.Process.Args, spec.Process.Env)
+		if !s.specMatch {
+			log.Infof("[Cijitter] container %q does not match jitter target policy %v, nothing will be sampled until a matching process is exec'd", cid, s.policy)
+		}
+	}
+	return s, nil
+}
+
+// execRefreshInterval is how often the selector asks the sandbox which
+// exec'd processes match the target policy.
+const execRefreshInterval = time.Second
+
+// execMatch returns whether a process exec'd in the container matches
+// JitterTargetArgs or JitterTargetEnv. Processes started with runsc exec
+// don't show in the spec, the sandbox keeps track of them.
+func (s *targetSelector) execMatch() bool {
+	if time.Since(s.execsChecked) < execRefreshInterval {
+		return len(s.execs) != 0
+	}
+	s.execsChecked = time.Now()
+
+	var execs []kernel.ThreadID
+	conn, err := connectControl(s.cid)
+	if err == nil {
+		err = conn.Call(boot.JitterExecs, &s.cid, &execs)
+		conn.Close()
+	}
+	if err != nil {
+		log.Debugf("[Cijitter] listing exec'd processes of %q failed: %v", s.cid, err)
+		return len(s.execs) != 0
+	}
+	switch {
+	case len(execs) != 0 && len(s.execs) == 0:
+		log.Infof("[Cijitter] processes %v exec'd in %q match jitter target policy %v, sampling", execs, s.cid, s.policy)
+	case len(execs) == 0 && len(s.execs) != 0:
+		log.Infof("[Cijitter] no process exec'd in %q matches jitter target policy %v anymore, sampling stopped", s.cid, s.policy)
+	}
+	s.execs = execs
+	return len(s.execs) != 0
+}
+
+// pids returns the host IDs to sample, busiest first: thread IDs with
+// JitterSampleThread, PIDs otherwise.
+func (s *targetSelector) pids() ([]string, error) {
+	pids, err := s.selectPids()
+	if err != nil || len(pids) == 0 {
+		return pids, err
+	}
+	s.mu.Lock()
+	if pids[0] != s.primary {
+		s.switched = s.primary != ""
+		s.primary = pids[0]
+	}
+	s.mu.Unlock()
+	switch s.scope {
+	case boot.JitterSampleThread:
+		return s.busiestThread(pids[0])
+	case boot.JitterSampleCgroup:
+		return s.cgroupPids(pids)
+	}
+	return pids, nil
+}
+
+// busiestThread returns the busiest thread of pid. The threads of a process
+// share its address space, so a switch between them doesn't make the
+// targets sampled so far stale.
+func (s *targetSelector) busiestThread(pid string) ([]string, error) {
+	tids, err := threadsOf(pid)
+	if err != nil {
+		return nil, fmt.Errorf("listing threads of %s: %v", pid, err)
+	}
+	var busiest hostProcess
+	for _, tid := range tids {
+		// Threads may exit while we walk /proc.
+		t, err := readHostProcess(tid)
+		if err != nil {
+			continue
+		}
+		if busiest.pid == 0 || t.cpuTicks > busiest.cpuTicks {
+			busiest = t
+		}
+	}
+	if busiest.pid == 0 {
+		return nil, fmt.Errorf("no thread of %s found", pid)
+	}
+	return []string{strconv.Itoa(busiest.pid)}, nil
+}
+
+// cgroupPids returns all the processes of the cgroup of the sandbox, busiest
+// first. It falls back to pids, the processes selected by the policy, if
+// the sandbox has no cgroup.
+func (s *targetSelector) cgroupPids(pids []string) ([]string, error) {
+	if err := s.loadSandbox(); err != nil {
+		return nil, err
+	}
+	if s.cg == nil {
+		log.Warningf("[Cijitter] container %q has no cgroup, sampling the processes selected by the jitter target policy", s.cid)
+		return pids, nil
+	}
+	cgPids, err := s.cg.Procs()
+	if err != nil {
+		return nil, fmt.Errorf("listing processes of cgroup %q: %v", s.cg.Name, err)
+	}
+	var procs []hostProcess
+	for _, pid := range cgPids {
+		p, err := readHostProcess(pid)
+		if err != nil {
+			continue
+		}
+		procs = append(procs, p)
+	}
+	sort.SliceStable(procs, func(i, j int) bool {
+		return procs[i].cpuTicks > procs[j].cpuTicks
+	})
+	all := make([]string, 0, len(procs))
+	for _, p := range procs {
+		all = append(all, strconv.Itoa(p.pid))
+	}
+	return all, nil
+}
+
+// switchedProcess returns true if the busiest selected process changed since
+// it was last called, in which case the targets sampled so far are stale.
+func (s *targetSelector) switchedProcess() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switched := s.switched
+	s.switched = false
+	return switched
+}
+
+// primaryPid returns the busiest PID selected last, whose address space the
+// targets sampled are in, or "" if none was selected yet.
+func (s *targetSelector) primaryPid() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.primary
+}
+
+// selectPids returns the host PIDs selected by the policy, busiest first.
+func (s *targetSelector) selectPids() ([]string, error) {
+	switch s.policy.Kind {
+	case boot.JitterTargetCPU:
+		if !s.rootless && !s.shared {
+			return get_pid(), nil
+		}
+	case boot.JitterTargetArgs, boot.JitterTargetEnv:
+		if !s.specMatch && !s.execMatch() {
+			return nil, nil
+		}
+	}
+
+	procs, err := s.sandboxProcesses()
+	if err != nil {
+		return nil, err
+	}
+	var selected []hostProcess
+	for _, p := range procs {
+		switch s.policy.Kind {
+		case boot.JitterTargetExe:
+			if !s.re.MatchString(p.exeName()) {
+				continue
+			}
+		case boot.JitterTargetCgroup:
+			if !p.inCgroup(s.policy.Pattern) {
+				continue
+			}
+		}
+		selected = append(selected, p)
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].cpuTicks > selected[j].cpuTicks
+	})
+	if s.policy.Kind == boot.JitterTargetCPU && len(selected) > 1 {
+		selected = selected[:1]
+	}
+
+	pids := make([]string, 0, len(selected))
+	for _, p := range selected {
+		pids = append(pids, strconv.Itoa(p.pid))
+	}
+	return pids, nil
+}
+
+// loadSandbox sets the PID and the cgroup of the sandbox, unless known
+// already.
+func (s *targetSelector) loadSandbox() error {
+	if s.sandboxPid != 0 {
+		return nil
+	}
+	c, err := container.Load(s.rootDir, s.cid)
+	if err != nil {
+		return fmt.Errorf("loading container %q: %v", s.cid, err)
+	}
+	if c.Sandbox == nil || c.Sandbox.Pid == 0 {
+		return fmt.Errorf("sandbox of container %q is not running", s.cid)
+	}
+	s.sandboxPid = c.Sandbox.Pid
+	s.cg = c.Sandbox.Cgroup
+	return nil
+}
+
+// sandboxProcesses returns the sandbox process and all its descendants.
+func (s *targetSelector) sandboxProcesses() ([]hostProcess, error) {
+	if err := s.loadSandbox(); err != nil {
+		return nil, err
+	}
+	return processTree(s.sandboxPid)
+}
+
+// hostProcess is a process as seen in /proc.
+type hostProcess struct {
+	pid  int
+	ppid int
+
+	// cpuTicks is the user and system time used by the process.
+	cpuTicks uint64
+
+	// cpu is the CPU the process last ran on, -1 if unknown.
+	cpu int
+}
+
+// readHostProcess reads pid's entry in /proc/[pid]/stat.
+func readHostProcess(pid int) (hostProcess, error) {
+	p := hostProcess{pid: pid}
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return p, err
+	}
+	// The command name may contain spaces and parentheses, the other fields
+	// start after the last ')'.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return p, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 13 {
+		return p, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	if p.ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return p, fmt.Errorf("malformed /proc/%d/stat: %v", pid, err)
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	p.cpuTicks = utime + stime
+	p.cpu = -1
+	if len(fields) > 36 {
+		if cpu, err := strconv.Atoi(fields[36]); err == nil {
+			p.cpu = cpu
+		}
+	}
+	return p, nil
+}
+
+// processTree returns root and all its descendants.
+func processTree(root int) ([]hostProcess, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var rootProc *hostProcess
+	children := make(map[int][]hostProcess)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// Processes may exit while we walk /proc.
+		p, err := readHostProcess(pid)
+		if err != nil {
+			continue
+		}
+		if pid == root {
+			rootProc = &p
+		}
+		children[p.ppid] = append(children[p.ppid], p)
+	}
+	if rootProc == nil {
+		return nil, fmt.Errorf("sandbox process %d not found", root)
+	}
+
+	tree := []hostProcess{*rootProc}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i].pid]...)
+	}
+	return tree, nil
+}
+
+// exeName returns the name of the executable of p, as shown by ps.
+func (p hostProcess) exeName() string {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", p.pid))
+	if err != nil {
+		return ""
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return filepath.Base(string(data))
+}
+
+// inCgroup returns whether p is in the cgroup path, or below it, in any
+// hierarchy.
+func (p hostProcess) inCgroup(path string) bool {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", p.pid))
+	if err != nil {
+		return false
+	}
+	path = strings.TrimSuffix(path, "/")
+	for _, line := range strings.Split(string(data), "\n") {
+		// Each line is hierarchy-ID:controller-list:cgroup-path.
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[2] == path || strings.HasPrefix(parts[2], path+"/") {
+			return true
+		}
+	}
+	return false
+}
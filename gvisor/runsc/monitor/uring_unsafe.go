@@ -0,0 +1,267 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// io_uring system calls. Their numbers are shared by all architectures.
+const (
+	sysIOUringSetup = 425
+	sysIOUringEnter = 426
+)
+
+// io_uring ABI, see include/uapi/linux/io_uring.h.
+const (
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringOpReadv = 1
+
+	ioringEnterGetEvents = 1
+
+	ioringSQESize = 64
+	ioringCQESize = 16
+)
+
+// ioringOffsets is struct io_sqring_offsets and struct io_cqring_offsets,
+// whose fields differ only by name past ring_entries.
+type ioringOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	// flags and dropped for the submission queue, overflow and cqes for
+	// the completion queue.
+	field4 uint32
+	field5 uint32
+	// array for the submission queue, flags for the completion queue.
+	field6 uint32
+	resv1  uint32
+	resv2  uint64
+}
+
+// ioringParams is struct io_uring_params.
+type ioringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFD         uint32
+	resv         [3]uint32
+	sqOff        ioringOffsets
+	cqOff        ioringOffsets
+}
+
+// ioringSQE is struct io_uring_sqe, for the fields of a readv.
+type ioringSQE struct {
+	opcode   uint8
+	flags    uint8
+	ioprio   uint16
+	fd       int32
+	off      uint64
+	addr     uint64
+	len      uint32
+	rwFlags  uint32
+	userData uint64
+	pad      [3]uint64
+}
+
+// ioringCQE is struct io_uring_cqe.
+type ioringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// uringDepth is the number of reads the uringReader keeps in flight, i.e. the
+// number of datagrams it can receive with a single system call.
+const uringDepth = 64
+
+// uringReader reads the datagrams of a socket with io_uring. It keeps
+// uringDepth reads in flight and resubmits them in batches, so that a burst
+// of datagrams costs a couple of system calls rather than one per datagram.
+// It requires Linux 5.1.
+type uringReader struct {
+	// ringFD is the io_uring instance.
+	ringFD int
+
+	// fd is the socket read from.
+	fd int
+
+	// sq, cq and sqes are the mappings of the submission queue ring, the
+	// completion queue ring and the submission queue entries.
+	sq   []byte
+	cq   []byte
+	sqes []byte
+
+	// sqOff and cqOff locate the fields of sq and cq.
+	sqOff ioringOffsets
+	cqOff ioringOffsets
+
+	// bufs and iovecs are the buffers of the reads in flight, by user
+	// data. The kernel writes to them until the ring is closed.
+	bufs   [][]byte
+	iovecs []unix.Iovec
+
+	// ready are the reads completed and to be resubmitted.
+	ready []uint64
+}
+
+// newUringReader returns a uringReader reading from the socket fd, with
+// every read submitted.
+func newUringReader(fd int, bufSize int) (*uringReader, error) {
+	var p ioringParams
+	ringFD, _, errno := syscall.Syscall(sysIOUringSetup, uringDepth, uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup: %v", errno)
+	}
+	r := &uringReader{ringFD: int(ringFD), fd: fd, sqOff: p.sqOff, cqOff: p.cqOff}
+	var err error
+	if r.sq, err = unix.Mmap(r.ringFD, ioringOffSQRing, int(p.sqOff.field6+p.sqEntries*4), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, fmt.Errorf("mapping io_uring submission queue: %v", err)
+	}
+	if r.cq, err = unix.Mmap(r.ringFD, ioringOffCQRing, int(p.cqOff.field5+p.cqEntries*ioringCQESize), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, fmt.Errorf("mapping io_uring completion queue: %v", err)
+	}
+	if r.sqes, err = unix.Mmap(r.ringFD, ioringOffSQEs, int(p.sqEntries*ioringSQESize), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, fmt.Errorf("mapping io_uring submission entries: %v", err)
+	}
+
+	r.bufs = make([][]byte, uringDepth)
+	r.iovecs = make([]unix.Iovec, uringDepth)
+	for i := range r.bufs {
+		r.bufs[i] = make([]byte, bufSize)
+		r.iovecs[i].Base = &r.bufs[i][0]
+		r.iovecs[i].SetLen(bufSize)
+		r.ready = append(r.ready, uint64(i))
+	}
+	if err := r.submit(); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// u32 returns the ring field at off in ring.
+func u32(ring []byte, off uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&ring[off]))
+}
+
+// submit submits the reads in ready with a single system call.
+func (r *uringReader) submit() error {
+	if len(r.ready) == 0 {
+		return nil
+	}
+	mask := *u32(r.sq, r.sqOff.ringMask)
+	tail := atomic.LoadUint32(u32(r.sq, r.sqOff.tail))
+	for _, i := range r.ready {
+		idx := tail & mask
+		sqe := (*ioringSQE)(unsafe.Pointer(&r.sqes[idx*ioringSQESize]))
+		*sqe = ioringSQE{
+			opcode:   ioringOpReadv,
+			fd:       int32(r.fd),
+			addr:     uint64(uintptr(unsafe.Pointer(&r.iovecs[i]))),
+			len:      1,
+			userData: i,
+		}
+		*u32(r.sq, r.sqOff.field6+4*idx) = idx
+		tail++
+	}
+	// Publish the entries before the tail that covers them.
+	atomic.StoreUint32(u32(r.sq, r.sqOff.tail), tail)
+	n := len(r.ready)
+	r.ready = r.ready[:0]
+	if _, err := r.enter(n, 0, 0); err != nil {
+		return fmt.Errorf("submitting io_uring reads: %v", err)
+	}
+	return nil
+}
+
+// enter calls io_uring_enter, retrying on EINTR.
+func (r *uringReader) enter(toSubmit, minComplete int, flags uintptr) (int, error) {
+	for {
+		n, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(r.ringFD), uintptr(toSubmit), uintptr(minComplete), flags, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return 0, errno
+		}
+		return int(n), nil
+	}
+}
+
+// read calls fn with each datagram received within timeout, and with the
+// error of each failed read. It returns once reads completed or timeout
+// elapsed, after resubmitting the completed reads.
+func (r *uringReader) read(timeout time.Duration, fn func(data []byte, err error)) error {
+	if !r.completed() {
+		fds := []unix.PollFd{{Fd: int32(r.ringFD), Events: unix.POLLIN}}
+		ms := 0
+		if timeout > 0 {
+			ms = int(timeout/time.Millisecond) + 1
+		}
+		if _, err := unix.Poll(fds, ms); err != nil && err != unix.EINTR {
+			return fmt.Errorf("waiting for io_uring completions: %v", err)
+		}
+	}
+
+	mask := *u32(r.cq, r.cqOff.ringMask)
+	head := atomic.LoadUint32(u32(r.cq, r.cqOff.head))
+	tail := atomic.LoadUint32(u32(r.cq, r.cqOff.tail))
+	for ; head != tail; head++ {
+		cqe := (*ioringCQE)(unsafe.Pointer(&r.cq[r.cqOff.field5+(head&mask)*ioringCQESize]))
+		i := cqe.userData
+		if cqe.res < 0 {
+			fn(nil, syscall.Errno(-cqe.res))
+		} else {
+			fn(r.bufs[i][:cqe.res], nil)
+		}
+		r.ready = append(r.ready, i)
+	}
+	// Give the entries back before their buffers are read into again.
+	atomic.StoreUint32(u32(r.cq, r.cqOff.head), head)
+	return r.submit()
+}
+
+// completed returns whether reads completed and await read.
+func (r *uringReader) completed() bool {
+	return atomic.LoadUint32(u32(r.cq, r.cqOff.head)) != atomic.LoadUint32(u32(r.cq, r.cqOff.tail))
+}
+
+// close releases the ring, which cancels the reads in flight. It doesn't
+// close the socket.
+func (r *uringReader) close() {
+	for _, m := range [][]byte{r.sq, r.cq, r.sqes} {
+		if m != nil {
+			unix.Munmap(m)
+		}
+	}
+	unix.Close(r.ringFD)
+}
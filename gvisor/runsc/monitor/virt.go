@@ -0,0 +1,160 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+const (
+	// cpuinfoPath lists the CPUs of the host and their flags.
+	cpuinfoPath = "/proc/cpuinfo"
+
+	// hypervisorTypePath names the hypervisor on Xen guests.
+	hypervisorTypePath = "/sys/hypervisor/type"
+
+	// dmiVendorPath names the vendor of the machine, the hypervisor on
+	// most other guests.
+	dmiVendorPath = "/sys/class/dmi/id/sys_vendor"
+
+	// cpuPMUPath is the core PMU of the host. Guests whose hypervisor
+	// doesn't virtualize the PMU don't have it.
+	cpuPMUPath = "/sys/bus/event_source/devices/cpu"
+
+	// debugfsPath is where debugfs is mounted, which the daptrace module
+	// needs.
+	debugfsPath = "/sys/kernel/debug"
+)
+
+// hostVirt is what the monitor can use of a host that may be a virtual
+// machine.
+type hostVirt struct {
+	// hypervisor names the hypervisor runsc runs under, "" on bare metal.
+	hypervisor string
+
+	// pmu is set if the core PMU is available.
+	pmu bool
+
+	// debugfs is set if debugfs is mounted.
+	debugfs bool
+}
+
+// detectVirt returns whether runsc runs in a virtual machine and what it can
+// use there.
+func detectVirt() hostVirt {
+	v := hostVirt{
+		pmu:     pathExists(cpuPMUPath),
+		debugfs: isDebugfs(debugfsPath),
+	}
+	if cpuHasFlag("hypervisor") {
+		v.hypervisor = hypervisorName()
+	}
+	return v
+}
+
+// vm returns whether the host is a virtual machine.
+func (v hostVirt) vm() bool {
+	return v.hypervisor != ""
+}
+
+// daptrace returns why the daptrace module can't be used in the virtual
+// machine, or "" if it may be.
+func (v hostVirt) daptrace() string {
+	if !v.debugfs {
+		return "debugfs is not mounted"
+	}
+	return ""
+}
+
+// cpuHasFlag returns whether the CPUs of the host have flag in
+// /proc/cpuinfo.
+func cpuHasFlag(flag string) bool {
+	f, err := os.Open(cpuinfoPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[0]) != "flags" {
+			continue
+		}
+		for _, f := range strings.Fields(fields[1]) {
+			if f == flag {
+				return true
+			}
+		}
+		// All CPUs have the same flags.
+		return false
+	}
+	return false
+}
+
+// hypervisorName returns the name of the hypervisor of the guest, or
+// "unknown" if it doesn't tell.
+func hypervisorName() string {
+	for _, path := range []string{hypervisorTypePath, dmiVendorPath} {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			if name := strings.TrimSpace(string(data)); name != "" {
+				return name
+			}
+		}
+	}
+	return "unknown"
+}
+
+// isDebugfs returns whether debugfs is mounted on path.
+func isDebugfs(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	return st.Type == unix.DEBUGFS_MAGIC
+}
+
+// pathExists returns whether path exists.
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// newVirtSampler returns the sampler auto selects in the virtual machine v.
+// The daptrace module is tried if the guest may load it, then perf events.
+// Without a virtualized PMU, perf samples page faults, which are software
+// events.
+func newVirtSampler(conf *boot.Config, dir string, v hostVirt) (sampler, error) {
+	if why := v.daptrace(); why != "" {
+		log.Warningf("[Cijitter] running in a %s virtual machine where %s, sampling with perf events instead of %s", v.hypervisor, why, daptraceModuleName)
+	} else if s, err := newDaptraceSampler(conf, dir); err == nil {
+		return s, nil
+	} else {
+		log.Warningf("[Cijitter] running in a %s virtual machine where %s failed: %v, sampling with perf events instead", v.hypervisor, daptraceModuleName, err)
+	}
+	if !v.pmu && conf.JitterPerfPMU != boot.JitterPerfFaults {
+		log.Warningf("[Cijitter] running in a %s virtual machine without a PMU, sampling page faults", v.hypervisor)
+		c := *conf
+		c.JitterPerfPMU = boot.JitterPerfFaults
+		conf = &c
+	}
+	return newPerfSampler(conf)
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resctrl provides an interface to the Linux resctrl filesystem, which
+// partitions the last level cache (Intel CAT) and memory bandwidth (Intel MBA)
+// between groups of tasks.
+package resctrl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var (
+	// resctrlRoot is where the resctrl filesystem is mounted.
+	resctrlRoot = "/sys/fs/resctrl"
+
+	// procRoot is where procfs is mounted.
+	procRoot = "/proc"
+)
+
+const (
+	// ResourceMB is memory bandwidth allocation.
+	ResourceMB = "MB"
+
+	// ResourceL3 is last level cache allocation.
+	ResourceL3 = "L3"
+)
+
+// Supported returns true if resctrl is mounted and can allocate resource.
+func Supported(resource string) bool {
+	_, err := os.Stat(filepath.Join(resctrlRoot, "info", resource))
+	return err == nil
+}
+
+// GroupName returns the name of the resource group used for the given
+// container.
+func GroupName(id string) string {
+	return "runsc-jitter-" + id
+}
+
+// Group is a resctrl resource group. Tasks in a group share its allocation.
+type Group struct {
+	// Name is the name of the group.
+	Name string
+
+	path string
+}
+
+// NewGroup creates the resource group with the given name, or opens it if it
+// already exists.
+func NewGroup(name string) (*Group, error) {
+	path := filepath.Join(resctrlRoot, name)
+	if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("creating resctrl group %q: %v", name, err)
+	}
+	return &Group{Name: name, path: path}, nil
+}
+
+// DestroyGroup removes the resource group with the given name. Its tasks
+// return to the default group. It is not an error if the group doesn't exist.
+func DestroyGroup(name string) error {
+	if err := syscall.Rmdir(filepath.Join(resctrlRoot, name)); err != nil && err != syscall.ENOENT {
+		return fmt.Errorf("removing resctrl group %q: %v", name, err)
+	}
+	return nil
+}
+
+// Destroy removes the group.
+func (g *Group) Destroy() error {
+	return DestroyGroup(g.Name)
+}
+
+// DefaultGroup returns the default resource group, which holds all tasks that
+// were not moved to another group.
+func DefaultGroup() *Group {
+	return &Group{path: resctrlRoot}
+}
+
+// Domains returns the IDs of the domains, i.e. cache or memory controller
+// instances, in which resource is allocated.
+func Domains(resource string) ([]int, error) {
+	doms, err := DefaultGroup().Schemata(resource)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, dom := range strings.Split(doms, ";") {
+		kv := strings.SplitN(dom, "=", 2)
+		id, err := strconv.Atoi(kv[0])
+		if err != nil || len(kv) != 2 {
+			return nil, fmt.Errorf("invalid %s schemata %q", resource, doms)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Schemata returns the allocation of resource in the group, as the list of
+// domains found in the schemata file, e.g. "0=7ff;1=7ff".
+func (g *Group) Schemata(resource string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(g.path, "schemata"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) == 2 && parts[0] == resource {
+			return parts[1], nil
+		}
+	}
+	return "", fmt.Errorf("resource %s not found in schemata", resource)
+}
+
+// CacheMask returns the capacity bitmask covering all ways of the cache
+// managed by resource, e.g. ResourceL3.
+func CacheMask(resource string) (uint64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(resctrlRoot, "info", resource, "cbm_mask"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 16, 64)
+}
+
+// Info returns the integer value of the given file in resource's info
+// directory, e.g. "min_bandwidth" for ResourceMB.
+func Info(resource, name string) (int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(resctrlRoot, "info", resource, name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// SetSchemata sets the allocation of resource to val in every domain.
+func (g *Group) SetSchemata(resource, val string) error {
+	ids, err := Domains(resource)
+	if err != nil {
+		return err
+	}
+	doms := make([]string, 0, len(ids))
+	for _, id := range ids {
+		doms = append(doms, fmt.Sprintf("%d=%s", id, val))
+	}
+	return g.SetSchemataDomains(resource, strings.Join(doms, ";"))
+}
+
+// SetSchemataDomains sets the allocation of resource to a list of domains as
+// returned by Schemata.
+func (g *Group) SetSchemataDomains(resource, doms string) error {
+	line := fmt.Sprintf("%s:%s\n", resource, doms)
+	if err := ioutil.WriteFile(filepath.Join(g.path, "schemata"), []byte(line), 0644); err != nil {
+		return fmt.Errorf("setting %s schemata of resctrl group %q: %v", resource, g.Name, err)
+	}
+	return nil
+}
+
+// AddProcess moves all threads of process pid into the group.
+func (g *Group) AddProcess(pid int) error {
+	return addProcess(g.path, pid)
+}
+
+// RemoveProcess moves all threads of process pid back to the default group.
+func RemoveProcess(pid int) error {
+	return addProcess(resctrlRoot, pid)
+}
+
+func addProcess(path string, pid int) error {
+	tasks, err := ioutil.ReadDir(filepath.Join(procRoot, strconv.Itoa(pid), "task"))
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		err := ioutil.WriteFile(filepath.Join(path, "tasks"), []byte(task.Name()), 0644)
+		// Threads may exit while they are being moved.
+		if err != nil && !os.IsNotExist(err) && !isESRCH(err) {
+			return fmt.Errorf("moving task %s to %q: %v", task.Name(), path, err)
+		}
+	}
+	return nil
+}
+
+func isESRCH(err error) bool {
+	if perr, ok := err.(*os.PathError); ok {
+		return perr.Err == syscall.ESRCH
+	}
+	return false
+}
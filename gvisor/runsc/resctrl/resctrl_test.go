@@ -0,0 +1,129 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resctrl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testSchemata = `    L3:0=7ff;1=7ff
+    MB:0=100;1=100
+`
+
+// setupRoot points the package at a fake resctrl root and returns it.
+func setupRoot(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "resctrl")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := ioutil.WriteFile(filepath.Join(dir, "schemata"), []byte(testSchemata), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	old := resctrlRoot
+	resctrlRoot = dir
+	t.Cleanup(func() { resctrlRoot = old })
+	return dir
+}
+
+func TestDomains(t *testing.T) {
+	setupRoot(t)
+	for _, res := range []string{ResourceL3, ResourceMB} {
+		got, err := Domains(res)
+		if err != nil {
+			t.Fatalf("Domains(%s) failed: %v", res, err)
+		}
+		if want := []int{0, 1}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Domains(%s) = %v, want %v", res, got, want)
+		}
+	}
+	if _, err := Domains("L2"); err == nil {
+		t.Errorf("Domains(L2) succeeded, want error")
+	}
+}
+
+func TestSetSchemata(t *testing.T) {
+	root := setupRoot(t)
+	g, err := NewGroup(GroupName("test"))
+	if err != nil {
+		t.Fatalf("NewGroup failed: %v", err)
+	}
+	if err := g.SetSchemata(ResourceMB, "10"); err != nil {
+		t.Fatalf("SetSchemata failed: %v", err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(root, g.Name, "schemata"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if want := "MB:0=10;1=10\n"; string(got) != want {
+		t.Errorf("schemata = %q, want %q", got, want)
+	}
+}
+
+func TestDestroyGroupEnoent(t *testing.T) {
+	setupRoot(t)
+	if err := DestroyGroup(GroupName("656e6f656e740a")); err != nil {
+		t.Errorf("DestroyGroup() failed: %v", err)
+	}
+}
+
+func TestDefaultSchemata(t *testing.T) {
+	setupRoot(t)
+	def := DefaultGroup()
+	saved, err := def.Schemata(ResourceL3)
+	if err != nil {
+		t.Fatalf("Schemata failed: %v", err)
+	}
+	if want := "0=7ff;1=7ff"; saved != want {
+		t.Errorf("Schemata(L3) = %q, want %q", saved, want)
+	}
+	if err := def.SetSchemata(ResourceL3, "7fc"); err != nil {
+		t.Fatalf("SetSchemata failed: %v", err)
+	}
+	if got, _ := def.Schemata(ResourceL3); got != "0=7fc;1=7fc" {
+		t.Errorf("Schemata(L3) after SetSchemata = %q", got)
+	}
+	if err := def.SetSchemataDomains(ResourceL3, saved); err != nil {
+		t.Fatalf("SetSchemataDomains failed: %v", err)
+	}
+	if got, _ := def.Schemata(ResourceL3); got != saved {
+		t.Errorf("Schemata(L3) after restore = %q, want %q", got, saved)
+	}
+}
+
+func TestCacheMask(t *testing.T) {
+	root := setupRoot(t)
+	info := filepath.Join(root, "info", ResourceL3)
+	if err := os.MkdirAll(info, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(info, "cbm_mask"), []byte("7ff\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if !Supported(ResourceL3) {
+		t.Errorf("Supported(L3) = false, want true")
+	}
+	mask, err := CacheMask(ResourceL3)
+	if err != nil {
+		t.Fatalf("CacheMask failed: %v", err)
+	}
+	if mask != 0x7ff {
+		t.Errorf("CacheMask(L3) = %#x, want 0x7ff", mask)
+	}
+}
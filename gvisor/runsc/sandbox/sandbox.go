@@ -118,6 +118,10 @@ type Args struct {
 
 	//LIZHI
 	RevAddr *os.File
+
+	// JitterControl is the sandbox end of the control connection of the
+	// jitter monitor, or nil.
+	JitterControl *os.File
 }
 
 // New creates the sandbox process. The caller must call Destroy() on the
@@ -383,7 +387,7 @@ func (s *Sandbox) createSandboxProcess(conf *boot.Config, args *Args, startSyncF
 			}
 		}
 
-		debugLogFile, err := specutils.DebugLogFile(conf.DebugLog, "boot", test)
+		debugLogFile, err := specutils.DebugLogFile(conf.DebugLog, "boot", s.ID, test)
 		if err != nil {
 			return fmt.Errorf("opening debug log file in %q: %v", conf.DebugLog, err)
 		}
@@ -401,7 +405,7 @@ func (s *Sandbox) createSandboxProcess(conf *boot.Config, args *Args, startSyncF
 			}
 		}
 
-		panicLogFile, err := specutils.DebugLogFile(conf.PanicLog, "panic", test)
+		panicLogFile, err := specutils.DebugLogFile(conf.PanicLog, "panic", s.ID, test)
 		if err != nil {
 			return fmt.Errorf("opening debug log file in %q: %v", conf.PanicLog, err)
 		}
@@ -461,6 +465,23 @@ func (s *Sandbox) createSandboxProcess(conf *boot.Config, args *Args, startSyncF
 	nextFD++
 	//===================================
 
+	if args.JitterControl != nil {
+		defer args.JitterControl.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, args.JitterControl)
+		cmd.Args = append(cmd.Args, "--jitter-control-fd="+strconv.Itoa(nextFD))
+		nextFD++
+	}
+	if conf.Jitter && conf.JitterExitReport != "" {
+		reportFile, err := specutils.DebugLogFile(conf.JitterExitReport, "jitter-report", s.ID, "")
+		if err != nil {
+			return fmt.Errorf("opening jitter exit report file %q: %v", conf.JitterExitReport, err)
+		}
+		defer reportFile.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, reportFile)
+		cmd.Args = append(cmd.Args, "--jitter-report-fd="+strconv.Itoa(nextFD))
+		nextFD++
+	}
+
 	gPlatform, err := platform.Lookup(conf.Platform)
 	if err != nil {
 		return err
@@ -389,14 +389,16 @@ func WaitForReady(pid int, timeout time.Duration, ready func() (bool, error)) er
 //   - %TIMESTAMP%: is replaced with a timestamp using the following format:
 //			<yyyymmdd-hhmmss.uuuuuu>
 //	 - %COMMAND%: is replaced with 'command'
+//	 - %CONTAINERID%: is replaced with 'cid' (omitted by default)
 //	 - %TEST%: is replaced with 'test' (omitted by default)
-func DebugLogFile(logPattern, command, test string) (*os.File, error) {
+func DebugLogFile(logPattern, command, cid, test string) (*os.File, error) {
 	if strings.HasSuffix(logPattern, "/") {
 		// Default format: <debug-log>/runsc.log.<yyyymmdd-hhmmss.uuuuuu>.<command>
 		logPattern += "runsc.log.%TIMESTAMP%.%COMMAND%"
 	}
 	logPattern = strings.Replace(logPattern, "%TIMESTAMP%", time.Now().Format("20060102-150405.000000"), -1)
 	logPattern = strings.Replace(logPattern, "%COMMAND%", command, -1)
+	logPattern = strings.Replace(logPattern, "%CONTAINERID%", cid, -1)
 	logPattern = strings.Replace(logPattern, "%TEST%", test, -1)
 
 	dir := filepath.Dir(logPattern)
@@ -406,6 +408,20 @@ func DebugLogFile(logPattern, command, test string) (*os.File, error) {
 	return os.OpenFile(logPattern, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
 }
 
+// PerContainerLogPattern returns a DebugLogFile pattern that gives each
+// container its own file. Patterns that already contain %CONTAINERID% are
+// returned unchanged, others are extended with the command and container ID.
+func PerContainerLogPattern(logPattern string) string {
+	switch {
+	case strings.Contains(logPattern, "%CONTAINERID%"):
+		return logPattern
+	case strings.HasSuffix(logPattern, "/"):
+		return logPattern + "runsc.log.%TIMESTAMP%.%COMMAND%.%CONTAINERID%"
+	default:
+		return logPattern + ".%COMMAND%.%CONTAINERID%"
+	}
+}
+
 // Mount creates the mount point and calls Mount with the given flags.
 func Mount(src, dst, typ string, flags uint32) error {
 	// Create the mount point inside. The type must be the same as the
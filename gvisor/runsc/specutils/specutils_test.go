@@ -16,7 +16,10 @@ package specutils
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -263,3 +266,44 @@ func TestSpecInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestDebugLogFileContainerID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debug-log")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := DebugLogFile(PerContainerLogPattern(filepath.Join(dir, "runsc.log")), "monitor", "abc", "")
+	if err != nil {
+		t.Fatalf("DebugLogFile() failed: %v", err)
+	}
+	f.Close()
+	if want := filepath.Join(dir, "runsc.log.monitor.abc"); f.Name() != want {
+		t.Errorf("DebugLogFile() opened %q, want %q", f.Name(), want)
+	}
+}
+
+func TestPerContainerLogPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		want    string
+	}{
+		{
+			pattern: "/tmp/logs/",
+			want:    "/tmp/logs/runsc.log.%TIMESTAMP%.%COMMAND%.%CONTAINERID%",
+		},
+		{
+			pattern: "/tmp/runsc.log",
+			want:    "/tmp/runsc.log.%COMMAND%.%CONTAINERID%",
+		},
+		{
+			pattern: "/tmp/%CONTAINERID%/runsc.log",
+			want:    "/tmp/%CONTAINERID%/runsc.log",
+		},
+	} {
+		if got := PerContainerLogPattern(tc.pattern); got != tc.want {
+			t.Errorf("PerContainerLogPattern(%q) = %q, want %q", tc.pattern, got, tc.want)
+		}
+	}
+}
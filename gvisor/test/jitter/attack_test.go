@@ -0,0 +1,94 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jitter runs cache side-channel attacks in the sandbox and checks
+// that jitter defeats them. It guards the whole defense pipeline, from
+// sampling in the monitor to delays in the sentry, against regressions.
+//
+// The attacks of the jitter/attack image run twice: once with the baseline
+// runtime, which has jitter disabled, to check that they work at all on this
+// host, and once with the runtime under test. Use the jitter-test make target
+// to install both runtimes and run the tests.
+package jitter
+
+import (
+	"context"
+	"flag"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+)
+
+var (
+	baselineRuntime     = flag.String("baseline-runtime", "runsc-nojitter", "runtime with jitter disabled, to check that the attacks work on this host")
+	minBaselineAccuracy = flag.Float64("min-baseline-accuracy", 0.5, "key recovery accuracy the attacks must reach without jitter for the test to be meaningful")
+	maxAccuracy         = flag.Float64("max-accuracy", 0.25, "key recovery accuracy above which jitter is considered broken. Guessing at random recovers 1/16 of the key.")
+	rounds              = flag.Int("rounds", 1000, "rounds the attacks run per secret nibble")
+)
+
+// attacks are the attacks of the jitter/attack image.
+var attacks = []string{"flush-reload", "prime-probe"}
+
+var accuracyRE = regexp.MustCompile(`accuracy: ([0-9.]+)`)
+
+// runAttack runs attack with runtime and returns the fraction of the secret
+// it recovered.
+func runAttack(ctx context.Context, t *testing.T, runtime, attack string) float64 {
+	t.Helper()
+	d := dockerutil.MakeContainer(ctx, t)
+	defer d.CleanUp(ctx)
+	d.Runtime = runtime
+
+	out, err := d.Run(ctx, dockerutil.RunOpts{
+		Image: "jitter/attack",
+	}, "/attack", attack, strconv.Itoa(*rounds))
+	if err != nil {
+		t.Fatalf("docker run with runtime %q failed: %v", runtime, err)
+	}
+	m := accuracyRE.FindStringSubmatch(out)
+	if m == nil {
+		t.Fatalf("attack output with runtime %q has no accuracy: %s", runtime, out)
+	}
+	accuracy, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		t.Fatalf("invalid accuracy %q: %v", m[1], err)
+	}
+	t.Logf("%s with runtime %q: %s", attack, runtime, out)
+	return accuracy
+}
+
+// TestAttacks checks that jitter brings the key recovery accuracy of the
+// attacks below --max-accuracy.
+func TestAttacks(t *testing.T) {
+	for _, attack := range attacks {
+		t.Run(attack, func(t *testing.T) {
+			ctx := context.Background()
+			if got := runAttack(ctx, t, *baselineRuntime, attack); got < *minBaselineAccuracy {
+				t.Skipf("%s recovers %.3f of the key without jitter, want at least %.3f: the host is too noisy to test jitter", attack, got, *minBaselineAccuracy)
+			}
+			if got := runAttack(ctx, t, dockerutil.Runtime(), attack); got > *maxAccuracy {
+				t.Errorf("%s recovers %.3f of the key with jitter, want at most %.3f", attack, got, *maxAccuracy)
+			}
+		})
+	}
+}
+
+func TestMain(m *testing.M) {
+	dockerutil.EnsureSupportedDockerVersion()
+	flag.Parse()
+	os.Exit(m.Run())
+}
@@ -14,6 +14,8 @@
 #include <linux/slab.h>
 #include <linux/mm.h>
 #include <linux/fs.h>
+#include <linux/vmalloc.h>
+#include <net/genetlink.h>
 
 // start hashtable to store addrs
 unsigned long targets_addr[10];
@@ -147,16 +149,174 @@ void hash_table_release(void)
     }
 }
 
+/*
+ * Version of the layout of the output file and of the ring buffer, read by
+ * the monitor before it parses samples. Bump it whenever
+ * output_targets_addr(), struct daptrace_ring_header/daptrace_record or the
+ * netlink interface change.
+ */
+#define DAPTRACE_ABI_VERSION 3
+
+/*
+ * Ring buffer the monitor mmaps to stream the aggregated samples while the
+ * module keeps tracing, instead of reading the output file after tracing
+ * stops. The header page is followed by ring_pages pages of records. The
+ * ring is overwritten when full: the monitor tells overruns from head.
+ */
+static unsigned int ring_pages = 64;
+module_param(ring_pages, uint, 0444);
+MODULE_PARM_DESC(ring_pages, "number of data pages of the sample ring buffer, 0 disables it");
+
+struct daptrace_ring_header {
+	__u64 head;		/* number of records written so far */
+	__u64 nr_records;	/* capacity of the ring */
+	__u32 record_size;
+	__u32 version;
+};
+
+struct daptrace_record {
+	__u64 epoch;		/* aggregation the record belongs to */
+	__u64 addr;		/* page address */
+	__u64 nr_accesses;
+};
+
+static struct daptrace_ring_header *ring;
+static struct daptrace_record *ring_records;
+static u64 ring_epoch;
+
+static int ring_init(void)
+{
+	if (!ring_pages)
+		return 0;
+	ring = vmalloc_user((1 + ring_pages) * PAGE_SIZE);
+	if (!ring)
+		return -ENOMEM;
+	ring_records = (void *)ring + PAGE_SIZE;
+	ring->nr_records = ring_pages * PAGE_SIZE /
+		sizeof(struct daptrace_record);
+	ring->record_size = sizeof(struct daptrace_record);
+	ring->version = DAPTRACE_ABI_VERSION;
+	return 0;
+}
+
+static void ring_push(unsigned long addr, unsigned int nr_accesses)
+{
+	struct daptrace_record *rec;
+	u64 head;
+
+	if (!ring)
+		return;
+	head = ring->head;
+	rec = &ring_records[head % ring->nr_records];
+	rec->epoch = ring_epoch;
+	rec->addr = addr;
+	rec->nr_accesses = nr_accesses;
+	/* Publish the record before the head that covers it. */
+	smp_store_release(&ring->head, head + 1);
+}
+
+/*
+ * Generic netlink interface the monitor drives the module through. Unlike
+ * writes to the debugfs files, every request is acked with its error, and
+ * the aggregated samples are delivered as events rather than polled.
+ */
+#define DAPTRACE_GENL_NAME	"daptrace"
+#define DAPTRACE_GENL_VERSION	1
+
+enum daptrace_cmd {
+	DAPTRACE_CMD_UNSPEC,
+	DAPTRACE_CMD_GET_VERSION,	/* replies with DAPTRACE_ATTR_VERSION */
+	DAPTRACE_CMD_SET_PIDS,		/* takes DAPTRACE_ATTR_PIDS */
+	DAPTRACE_CMD_SET_TRACING,	/* takes DAPTRACE_ATTR_TRACING_ON */
+	DAPTRACE_CMD_SUBSCRIBE,		/* the sender receives the samples */
+	DAPTRACE_CMD_SAMPLES,		/* event, with DAPTRACE_ATTR_EPOCH and
+					 * DAPTRACE_ATTR_RECORDS */
+	__DAPTRACE_CMD_MAX,
+};
+
+enum daptrace_attr {
+	DAPTRACE_ATTR_UNSPEC,
+	DAPTRACE_ATTR_VERSION,		/* u32 */
+	DAPTRACE_ATTR_PIDS,		/* array of u32 */
+	DAPTRACE_ATTR_TRACING_ON,	/* u8 */
+	DAPTRACE_ATTR_EPOCH,		/* u64 */
+	DAPTRACE_ATTR_RECORDS,		/* array of struct daptrace_record */
+	DAPTRACE_ATTR_PAD,
+	__DAPTRACE_ATTR_MAX,
+};
+#define DAPTRACE_ATTR_MAX (__DAPTRACE_ATTR_MAX - 1)
+
+static struct genl_family daptrace_family;
+
+/*
+ * Port of the socket that subscribed to the samples, 0 if none did. The
+ * records of an aggregation are batched into events of up to
+ * DAPTRACE_EVENT_RECORDS records. Events are dropped when the subscriber
+ * doesn't keep up with them.
+ */
+static u32 events_portid;
+
+#define DAPTRACE_EVENT_RECORDS 128
+static struct daptrace_record events_buf[DAPTRACE_EVENT_RECORDS];
+static unsigned int events_nr;
+
+static void events_flush(void)
+{
+	u32 portid = READ_ONCE(events_portid);
+	struct sk_buff *skb;
+	void *hdr;
+
+	if (!events_nr || !portid)
+		goto out;
+	skb = genlmsg_new(nla_total_size_64bit(sizeof(u64)) +
+			nla_total_size(events_nr * sizeof(events_buf[0])),
+			GFP_KERNEL);
+	if (!skb)
+		goto out;
+	hdr = genlmsg_put(skb, 0, 0, &daptrace_family, 0,
+			DAPTRACE_CMD_SAMPLES);
+	if (!hdr || nla_put_u64_64bit(skb, DAPTRACE_ATTR_EPOCH, ring_epoch,
+				DAPTRACE_ATTR_PAD) ||
+			nla_put(skb, DAPTRACE_ATTR_RECORDS,
+				events_nr * sizeof(events_buf[0]), events_buf)) {
+		nlmsg_free(skb);
+		goto out;
+	}
+	genlmsg_end(skb, hdr);
+	/* The subscriber is gone, stop sending until another one comes. */
+	if (genlmsg_unicast(&init_net, skb, portid) == -ECONNREFUSED)
+		cmpxchg(&events_portid, portid, 0);
+out:
+	events_nr = 0;
+}
+
+static void events_push(unsigned long addr, unsigned int nr_accesses)
+{
+	struct daptrace_record *rec;
+
+	if (!READ_ONCE(events_portid))
+		return;
+	rec = &events_buf[events_nr++];
+	rec->epoch = ring_epoch;
+	rec->addr = addr;
+	rec->nr_accesses = nr_accesses;
+	if (events_nr == DAPTRACE_EVENT_RECORDS)
+		events_flush();
+}
+
 // output the targets addrs
-#define FILE_WRITE "/monitor/log/targetAddrs.list"
+static char *output = "/monitor/log/targetAddrs.list";
+module_param(output, charp, 0444);
+MODULE_PARM_DESC(output, "file the target addresses are written to");
+
 void output_targets_addr(void)
 {
         mm_segment_t fs;
         struct file *fp_w;
-        fp_w = filp_open(FILE_WRITE, O_RDWR|O_CREAT, 0644);
+        fp_w = filp_open(output, O_RDWR|O_CREAT, 0644);
         if (IS_ERR(fp_w))
         {
-                pr_err("faild to open %s\n", FILE_WRITE);
+                pr_err("faild to open %s\n", output);
                 return;
         }
 
@@ -949,10 +1109,16 @@ static void aggregate(void)
 				hash_table_insert(start_addr, r->nr_accesses); 
 			else
 				pNode->nValue += r->nr_accesses;
+			if (r->nr_accesses) {
+				ring_push(start_addr, r->nr_accesses);
+				events_push(start_addr, r->nr_accesses);
+			}
 
 			r->nr_accesses = 0;
 		}
 	}
+	events_flush();
+	ring_epoch++;
 }
 
 /*
@@ -1256,6 +1422,10 @@ static ssize_t debugfs_pids_write(struct file *file,
 	if (ret < 0)
 		return ret;
 
+	/* The tracer walks the tasks, they can't change under it. */
+	if (mapia_trace_task)
+		return -EBUSY;
+
 	targets = str_to_ints(dbg_pids_buf, ret, &nr_targets);
 	mapia_set_pids(targets, nr_targets);
 	kfree(targets);
@@ -1345,6 +1515,16 @@ static ssize_t debugfs_tracing_on_write(struct file *file,
 	return ret;
 }
 
+static ssize_t debugfs_version_read(struct file *file,
+		char __user *buf, size_t count, loff_t *ppos)
+{
+	char kbuf[16];
+	int len;
+
+	len = scnprintf(kbuf, sizeof(kbuf), "%d\n", DAPTRACE_ABI_VERSION);
+	return simple_read_from_buffer(buf, count, ppos, kbuf, len);
+}
+
 static const struct file_operations pids_fops = {
 	.owner = THIS_MODULE,
 	.read = debugfs_pids_read,
@@ -1363,6 +1543,125 @@ static const struct file_operations tracing_on_fops = {
 	.write = debugfs_tracing_on_write,
 };
 
+static const struct file_operations version_fops = {
+	.owner = THIS_MODULE,
+	.read = debugfs_version_read,
+};
+
+static int debugfs_ring_mmap(struct file *file, struct vm_area_struct *vma)
+{
+	if (!ring)
+		return -ENODEV;
+	/* Only the module writes to the ring. */
+	if (vma->vm_flags & VM_WRITE)
+		return -EPERM;
+	vma->vm_flags &= ~VM_MAYWRITE;
+	return remap_vmalloc_range(vma, ring, vma->vm_pgoff);
+}
+
+static const struct file_operations ring_fops = {
+	.owner = THIS_MODULE,
+	.mmap = debugfs_ring_mmap,
+};
+
+static int daptrace_genl_get_version(struct sk_buff *skb,
+		struct genl_info *info)
+{
+	struct sk_buff *msg;
+	void *hdr;
+
+	msg = genlmsg_new(nla_total_size(sizeof(u32)), GFP_KERNEL);
+	if (!msg)
+		return -ENOMEM;
+	hdr = genlmsg_put_reply(msg, info, &daptrace_family, 0,
+			DAPTRACE_CMD_GET_VERSION);
+	if (!hdr || nla_put_u32(msg, DAPTRACE_ATTR_VERSION,
+				DAPTRACE_ABI_VERSION)) {
+		nlmsg_free(msg);
+		return -EMSGSIZE;
+	}
+	genlmsg_end(msg, hdr);
+	return genlmsg_reply(msg, info);
+}
+
+static int daptrace_genl_set_pids(struct sk_buff *skb, struct genl_info *info)
+{
+	struct nlattr *attr = info->attrs[DAPTRACE_ATTR_PIDS];
+	unsigned long *pids;
+	const u32 *data;
+	int i, nr;
+	long ret;
+
+	if (!attr || nla_len(attr) % sizeof(u32))
+		return -EINVAL;
+	/* The tracer walks the tasks, they can't change under it. */
+	if (mapia_trace_task)
+		return -EBUSY;
+
+	nr = nla_len(attr) / sizeof(u32);
+	pids = kmalloc_array(nr, sizeof(*pids), GFP_KERNEL);
+	if (nr && !pids)
+		return -ENOMEM;
+	data = nla_data(attr);
+	for (i = 0; i < nr; i++)
+		pids[i] = data[i];
+	ret = mapia_set_pids(pids, nr);
+	kfree(pids);
+	return ret;
+}
+
+static int daptrace_genl_set_tracing(struct sk_buff *skb,
+		struct genl_info *info)
+{
+	if (!info->attrs[DAPTRACE_ATTR_TRACING_ON])
+		return -EINVAL;
+	return mapia_turn_trace(nla_get_u8(info->attrs[DAPTRACE_ATTR_TRACING_ON]));
+}
+
+static int daptrace_genl_subscribe(struct sk_buff *skb, struct genl_info *info)
+{
+	WRITE_ONCE(events_portid, info->snd_portid);
+	return 0;
+}
+
+static const struct nla_policy daptrace_genl_policy[DAPTRACE_ATTR_MAX + 1] = {
+	[DAPTRACE_ATTR_PIDS] = { .type = NLA_BINARY },
+	[DAPTRACE_ATTR_TRACING_ON] = { .type = NLA_U8 },
+};
+
+static const struct genl_ops daptrace_genl_ops[] = {
+	{
+		.cmd = DAPTRACE_CMD_GET_VERSION,
+		.doit = daptrace_genl_get_version,
+		.flags = GENL_ADMIN_PERM,
+	},
+	{
+		.cmd = DAPTRACE_CMD_SET_PIDS,
+		.doit = daptrace_genl_set_pids,
+		.flags = GENL_ADMIN_PERM,
+	},
+	{
+		.cmd = DAPTRACE_CMD_SET_TRACING,
+		.doit = daptrace_genl_set_tracing,
+		.flags = GENL_ADMIN_PERM,
+	},
+	{
+		.cmd = DAPTRACE_CMD_SUBSCRIBE,
+		.doit = daptrace_genl_subscribe,
+		.flags = GENL_ADMIN_PERM,
+	},
+};
+
+static struct genl_family daptrace_family = {
+	.name = DAPTRACE_GENL_NAME,
+	.version = DAPTRACE_GENL_VERSION,
+	.maxattr = DAPTRACE_ATTR_MAX,
+	.policy = daptrace_genl_policy,
+	.module = THIS_MODULE,
+	.ops = daptrace_genl_ops,
+	.n_ops = ARRAY_SIZE(daptrace_genl_ops),
+};
+
 static struct dentry *debugfs_root;
 
 static int __init debugfs_init(void)
@@ -1391,6 +1690,18 @@ static int __init debugfs_init(void)
 		return -ENOMEM;
 	}
 
+	if (!debugfs_create_file("version", 0400, debugfs_root, NULL,
+				&version_fops)) {
+		pr_err("failed to create version file\n");
+		return -ENOMEM;
+	}
+
+	if (ring && !debugfs_create_file("ring", 0400, debugfs_root, NULL,
+				&ring_fops)) {
+		pr_err("failed to create ring file\n");
+		return -ENOMEM;
+	}
+
 	return 0;
 }
 
@@ -1409,7 +1720,11 @@ static int __init mapia_init(void)
 	ktime_get_coarse_ts64(&last_aggregate_time);
 	last_regions_update_time = last_aggregate_time;
 
+	if (ring_init())
+		pr_err("failed to allocate the ring buffer\n");
 	debugfs_init();
+	if (genl_register_family(&daptrace_family))
+		pr_err("failed to register the netlink family\n");
 
 	return 0;
 }
@@ -1422,7 +1737,9 @@ static void __exit mapia_exit(void)
 	while (mapia_trace_task)
 		msleep(100);
 
+	genl_unregister_family(&daptrace_family);
 	debugfs_exit();
+	vfree(ring);
 }
 
 module_init(mapia_init);